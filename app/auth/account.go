@@ -0,0 +1,230 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит HTTP-обработчики выгрузки данных и удаления аккаунта:
+//   - ExportAccountData: отдает JSON-архив всех данных пользователя
+//   - DeleteAccount: планирует удаление аккаунта после подтверждения паролем или по email
+//   - ConfirmAccountDeletion: планирует удаление по ссылке из письма
+//   - ScheduleAccountDeletion: планирует удаление и завершает все сессии пользователя
+//   - scheduleAccountDeletionTx: планирует удаление и завершает все сессии в транзакции
+//
+// Аккаунт удаляется безвозвратно после срока ожидания ACCOUNT_DELETION_GRACE_DAYS;
+// вход в течение этого срока отменяет удаление.
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// accountDeletionGracePeriod возвращает срок ожидания перед удалением аккаунта в секундах.
+//
+// Использует переменную окружения ACCOUNT_DELETION_GRACE_DAYS (по умолчанию 30 дней).
+func accountDeletionGracePeriod() int64 {
+	return int64(envPositiveInt("ACCOUNT_DELETION_GRACE_DAYS", 30)) * 24 * 60 * 60
+}
+
+// ScheduleAccountDeletion планирует удаление аккаунта и завершает все его сессии.
+//
+// В транзакции сохраняет запрос удаления со сроком now + срок ожидания
+// и отменяет temporaryId и refresh токены на всех устройствах.
+// Используется обработчиками и командой account delete.
+// Возвращает момент, после которого аккаунт будет удален.
+var ScheduleAccountDeletion = func(permanentId string, now int64) (int64, error) {
+	deleteAfter := now + accountDeletionGracePeriod()
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := scheduleAccountDeletionTx(tx, permanentId, now, deleteAfter); err != nil {
+		tx.Rollback()
+		return 0, errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return 0, errors.WithStack(err)
+	}
+	return deleteAfter, nil
+}
+
+// scheduleAccountDeletionTx сохраняет запрос удаления аккаунта со сроком deleteAfter
+// и отменяет temporaryId и refresh токены на всех устройствах в транзакции tx.
+func scheduleAccountDeletionTx(tx *sql.Tx, permanentId string, now, deleteAfter int64) error {
+	if err := data.SetAccountDeletionInDbTx(tx, permanentId, now, deleteAfter); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetAllTemporaryIdsCancelledInDbTx(tx, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetAllRefreshTokensCancelledInDbTx(tx, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// finishAccountDeletion планирует удаление, удаляет cookie и перенаправляет на страницу входа.
+func finishAccountDeletion(w http.ResponseWriter, r *http.Request, permanentId string) {
+	if _, err := ScheduleAccountDeletion(permanentId, time.Now().Unix()); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	data.ClearTemporaryIdInCookies(w)
+	http.Redirect(w, r, consts.SignInURL+"?msg=accountDeletionScheduled", http.StatusFound)
+}
+
+// ExportAccountData отдает все данные пользователя в виде JSON-файла.
+//
+// Ответ не кешируется и отдается как вложение account-data.json.
+// При ошибках перенаправляет на страницу 500.
+func ExportAccountData(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	export, err := data.GetAccountExportFromDb(permanentId, time.Now().Unix())
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, errors.WithStack(err), consts.Err500URL)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account-data.json"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(body)
+}
+
+// DeleteAccount планирует удаление аккаунта.
+//
+// При confirmBy=email сохраняет токен и отправляет на email пользователя одноразовую ссылку подтверждения,
+// иначе требует текущий пароль (см. verifyCurrentPassword). Пользователь, вошедший только через Yandex,
+// пароля не имеет и подтверждает удаление по email.
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if r.FormValue("confirmBy") == "email" {
+		email, err := data.GetEmailFromDb(permanentId)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		baseURL := tmpls.PublicURL("/profile/delete/confirm")
+		deletionLink, err := tools.GenerateAccountDeletionLink(permanentId, baseURL)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		url, err := url.Parse(deletionLink)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, errors.WithStack(err), consts.Err500URL)
+			return
+		}
+
+		if err := data.SetAccountDeletionTokenInDb(url.Query().Get("token"), permanentId); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		if err := tools.AccountDeletionLinkSend(i18n.Locale(r), email, deletionLink); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		redirectToProfile(w, r, "accountDeletionLinkSent")
+		return
+	}
+
+	if !verifyCurrentPassword(w, r, permanentId, r.FormValue("currentPassword")) {
+		return
+	}
+
+	finishAccountDeletion(w, r, permanentId)
+}
+
+// ConfirmAccountDeletion планирует удаление аккаунта по токену из письма.
+//
+// Не требует входа: ссылка могла быть открыта на другом устройстве.
+// В одной транзакции отмечает токен использованным и планирует удаление, поэтому
+// ссылка срабатывает один раз. Если токен невалиден, истек или уже использован,
+// перенаправляет на страницу входа с сообщением.
+func ConfirmAccountDeletion(w http.ResponseWriter, r *http.Request) {
+	deletionToken := r.FormValue("token")
+	invalidURL := consts.SignInURL + "?msg=accountDeletionLinkInvalid"
+
+	claims, err := tools.AccountDeletionTokenValidate(deletionToken)
+	if err != nil {
+		http.Redirect(w, r, invalidURL, http.StatusFound)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetAccountDeletionTokenUsedInDbTx(tx, deletionToken); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrAccountDeletionTokenUsed) {
+			http.Redirect(w, r, invalidURL, http.StatusFound)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	now := time.Now().Unix()
+	if err := scheduleAccountDeletionTx(tx, claims.PermanentId, now, now+accountDeletionGracePeriod()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	data.ClearTemporaryIdInCookies(w)
+	http.Redirect(w, r, consts.SignInURL+"?msg=accountDeletionScheduled", http.StatusFound)
+}
@@ -0,0 +1,55 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит проверку статуса аккаунта:
+//   - accountStatus: получает статус аккаунта и определяет, запрещен ли вход
+//   - accountStatusMsgKey: возвращает ключ сообщения о блокировке
+//   - accountStatusMsg: формирует сообщение о блокировке с причиной и сроком
+//
+// Вход запрещен для статусов disabled и banned. Аккаунт в статусе pending-deletion
+// входит как обычно: вход отменяет запланированное удаление.
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// accountStatus получает текущий статус аккаунта.
+//
+// Возвращает true, если статус запрещает вход.
+func accountStatus(permanentId string) (structs.AccountStatus, bool, error) {
+	status, err := data.GetAccountStatusFromDb(permanentId, time.Now().Unix())
+	if err != nil {
+		return structs.AccountStatus{}, false, errors.WithStack(err)
+	}
+	restricted := status.Status == data.AccountStatusDisabled || status.Status == data.AccountStatusBanned
+	return status, restricted, nil
+}
+
+// accountStatusMsgKey возвращает ключ сообщения о блокировке для параметра msg.
+func accountStatusMsgKey(status structs.AccountStatus) string {
+	if status.Status == data.AccountStatusBanned {
+		return "accountBanned"
+	}
+	return "accountDisabled"
+}
+
+// accountStatusMsg формирует сообщение о блокировке для пользователя.
+//
+// Добавляет причину и срок окончания временной блокировки, если они заданы.
+// Текст берется из каталога i18n на языке запроса r.
+func accountStatusMsg(r *http.Request, status structs.AccountStatus) string {
+	msg := i18n.Msg(r, accountStatusMsgKey(status))
+	if status.Reason != "" {
+		msg += i18n.Msg(r, "accountStatusReason", status.Reason)
+	}
+	if status.ExpiresAt != 0 {
+		msg += i18n.Msg(r, "accountStatusUntil", time.Unix(status.ExpiresAt, 0).UTC().Format("2006-01-02 15:04:05 UTC"))
+	}
+	return msg
+}
@@ -0,0 +1,73 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует проверку статуса аккаунта.
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAccountStatus проверяет, какие статусы запрещают вход.
+// Ожидается: вход запрещен для disabled и banned, разрешен для active и pending-deletion.
+func TestAccountStatus(t *testing.T) {
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+	defer func() { data.GetAccountStatusFromDb = oldGetAccountStatusFromDb }()
+
+	tests := map[string]bool{
+		data.AccountStatusActive:          false,
+		data.AccountStatusPendingDeletion: false,
+		data.AccountStatusDisabled:        true,
+		data.AccountStatusBanned:          true,
+	}
+	for name, wantRestricted := range tests {
+		data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+			return structs.AccountStatus{PermanentId: permanentId, Status: name}, nil
+		}
+
+		status, restricted, err := accountStatus("perm123")
+		assert.NoError(t, err)
+		assert.Equal(t, name, status.Status)
+		assert.Equal(t, wantRestricted, restricted, name)
+	}
+}
+
+// TestAccountStatusMsg проверяет сообщение о блокировке.
+// Ожидается: текст по статусу на языке запроса, причина и срок добавляются, только если заданы.
+func TestAccountStatusMsg(t *testing.T) {
+	tests := []struct {
+		locale string
+		status structs.AccountStatus
+		want   string
+	}{
+		{
+			status: structs.AccountStatus{Status: data.AccountStatusDisabled},
+			want:   i18n.Text(i18n.En, "accountDisabled"),
+		},
+		{
+			status: structs.AccountStatus{Status: data.AccountStatusBanned, Reason: "spam"},
+			want:   i18n.Text(i18n.En, "accountBanned") + " Reason: spam.",
+		},
+		{
+			status: structs.AccountStatus{Status: data.AccountStatusDisabled, ExpiresAt: 86400},
+			want:   i18n.Text(i18n.En, "accountDisabled") + " The restriction ends at 1970-01-02 00:00:00 UTC.",
+		},
+		{
+			locale: i18n.Ru,
+			status: structs.AccountStatus{Status: data.AccountStatusBanned, Reason: "spam", ExpiresAt: 86400},
+			want:   i18n.Text(i18n.Ru, "accountBanned") + " Причина: spam. Ограничение действует до 1970-01-02 00:00:00 UTC.",
+		},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Language", tt.locale)
+		assert.Equal(t, tt.want, accountStatusMsg(r, tt.status))
+	}
+}
@@ -0,0 +1,272 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует выгрузку данных и удаление аккаунта.
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAccountTest дополняет окружение профиля зависимостями выгрузки и удаления аккаунта.
+// Текущий пароль пользователя - "OldPass1!".
+func setupAccountTest() func() {
+	oldIsOKPasswordHashInDb := data.IsOKPasswordHashInDb
+	oldGetAccountExportFromDb := data.GetAccountExportFromDb
+	oldSetAccountDeletionInDbTx := data.SetAccountDeletionInDbTx
+	oldScheduleAccountDeletion := ScheduleAccountDeletion
+	oldGenerateAccountDeletionLink := tools.GenerateAccountDeletionLink
+	oldAccountDeletionLinkSend := tools.AccountDeletionLinkSend
+	oldAccountDeletionTokenValidate := tools.AccountDeletionTokenValidate
+	oldSetAccountDeletionTokenInDb := data.SetAccountDeletionTokenInDb
+	oldSetAccountDeletionTokenUsedInDbTx := data.SetAccountDeletionTokenUsedInDbTx
+
+	data.IsOKPasswordHashInDb = func(permanentId, password string) error {
+		if password != "OldPass1!" {
+			return errors.WithStack(data.ErrPasswordInvalid)
+		}
+		return nil
+	}
+
+	return func() {
+		data.IsOKPasswordHashInDb = oldIsOKPasswordHashInDb
+		data.GetAccountExportFromDb = oldGetAccountExportFromDb
+		data.SetAccountDeletionInDbTx = oldSetAccountDeletionInDbTx
+		ScheduleAccountDeletion = oldScheduleAccountDeletion
+		tools.GenerateAccountDeletionLink = oldGenerateAccountDeletionLink
+		tools.AccountDeletionLinkSend = oldAccountDeletionLinkSend
+		tools.AccountDeletionTokenValidate = oldAccountDeletionTokenValidate
+		data.SetAccountDeletionTokenInDb = oldSetAccountDeletionTokenInDb
+		data.SetAccountDeletionTokenUsedInDbTx = oldSetAccountDeletionTokenUsedInDbTx
+	}
+}
+
+// TestScheduleAccountDeletion проверяет планирование удаления аккаунта.
+// Ожидается: срок ожидания из ACCOUNT_DELETION_GRACE_DAYS, все сессии отменяются в одной транзакции.
+func TestScheduleAccountDeletion(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+	t.Setenv("ACCOUNT_DELETION_GRACE_DAYS", "7")
+
+	var savedDeleteAfter int64
+	data.SetAccountDeletionInDbTx = func(tx *sql.Tx, permanentId string, requestedAt, deleteAfter int64) error {
+		savedDeleteAfter = deleteAfter
+		return nil
+	}
+	var cancelled []string
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		cancelled = append(cancelled, "temporaryIds:"+permanentId)
+		return nil
+	}
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		cancelled = append(cancelled, "refreshTokens:"+permanentId)
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	deleteAfter, err := ScheduleAccountDeletion("perm123", 1000)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1000+7*24*60*60), deleteAfter)
+	assert.Equal(t, deleteAfter, savedDeleteAfter)
+	assert.Equal(t, []string{"temporaryIds:perm123", "refreshTokens:perm123"}, cancelled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestExportAccountData проверяет выгрузку данных пользователя.
+// Ожидается: JSON-вложение без кеширования с данными текущего пользователя.
+func TestExportAccountData(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+
+	data.GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+		return structs.AccountExport{PermanentId: permanentId, ExportedAt: exportedAt, Emails: []structs.ExportedEmail{{Email: "old@example.com"}}}, nil
+	}
+
+	expectProfileUser(mock)
+
+	req := httptest.NewRequest("GET", "/profile/export", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	ExportAccountData(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="account-data.json"`, w.Header().Get("Content-Disposition"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+
+	var export structs.AccountExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, "perm123", export.PermanentId)
+	assert.Equal(t, "old@example.com", export.Emails[0].Email)
+	assert.InDelta(t, time.Now().Unix(), export.ExportedAt, 5)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteAccount_Password проверяет удаление аккаунта с подтверждением паролем.
+// Ожидается: удаление запланировано, cookie удалена, редирект на вход с сообщением.
+func TestDeleteAccount_Password(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+
+	var scheduledId string
+	ScheduleAccountDeletion = func(permanentId string, now int64) (int64, error) {
+		scheduledId = permanentId
+		return now, nil
+	}
+
+	expectProfileUser(mock)
+
+	form := url.Values{"confirmBy": {"password"}, "currentPassword": {"OldPass1!"}}
+	w := httptest.NewRecorder()
+	DeleteAccount(w, profileRequest("/profile/delete", form))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/sign-in?msg=accountDeletionScheduled", w.Header().Get("Location"))
+	assert.Equal(t, "perm123", scheduledId)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Max-Age=0")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteAccount_WrongPassword проверяет отклонение неверного пароля.
+// Ожидается: страница профиля с сообщением, удаление не планируется.
+func TestDeleteAccount_WrongPassword(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	ScheduleAccountDeletion = func(permanentId string, now int64) (int64, error) {
+		t.Error("deletion should not be scheduled")
+		return 0, nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	form := url.Values{"confirmBy": {"password"}, "currentPassword": {"Wrong1!"}}
+	w := httptest.NewRecorder()
+	DeleteAccount(w, profileRequest("/profile/delete", form))
+
+	assert.Equal(t, i18n.Text(i18n.En, "currentPasswordWrong"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteAccount_Email проверяет запрос подтверждения удаления по email.
+// Ожидается: токен ссылки сохранен для пользователя, ссылка отправлена на его email,
+// удаление до перехода по ссылке не планируется.
+func TestDeleteAccount_Email(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+
+	tools.GenerateAccountDeletionLink = func(permanentId, baseURL string) (string, error) {
+		assert.Equal(t, "perm123", permanentId)
+		return baseURL + "?token=delete-token", nil
+	}
+	var savedToken string
+	data.SetAccountDeletionTokenInDb = func(token, permanentId string) error {
+		assert.Equal(t, "perm123", permanentId)
+		savedToken = token
+		return nil
+	}
+	var sentEmail, sentLink string
+	tools.AccountDeletionLinkSend = func(locale, email, deletionLink string) error {
+		sentEmail, sentLink = email, deletionLink
+		return nil
+	}
+	ScheduleAccountDeletion = func(permanentId string, now int64) (int64, error) {
+		t.Error("deletion should not be scheduled before confirmation")
+		return 0, nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	DeleteAccount(w, profileRequest("/profile/delete", url.Values{"confirmBy": {"email"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=accountDeletionLinkSent", w.Header().Get("Location"))
+	assert.Equal(t, "delete-token", savedToken)
+	assert.Equal(t, "old@example.com", sentEmail)
+	assert.Contains(t, sentLink, "/profile/delete/confirm?token=delete-token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmAccountDeletion проверяет подтверждение удаления по ссылке из письма.
+// Ожидается: в одной транзакции токен отмечается использованным, удаление планируется
+// для permanentId из токена и сессии отменяются; невалидный и повторно использованный
+// токен отклоняются без планирования удаления.
+func TestConfirmAccountDeletion(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupAccountTest()()
+
+	tools.AccountDeletionTokenValidate = func(token string) (*structs.AccountDeletionTokenClaims, error) {
+		if token == "forged" {
+			return nil, errors.New("token invalid")
+		}
+		return &structs.AccountDeletionTokenClaims{PermanentId: "perm123"}, nil
+	}
+	usedTokens := map[string]bool{}
+	data.SetAccountDeletionTokenUsedInDbTx = func(tx *sql.Tx, token string) error {
+		if usedTokens[token] {
+			return errors.WithStack(data.ErrAccountDeletionTokenUsed)
+		}
+		usedTokens[token] = true
+		return nil
+	}
+	var calls []string
+	data.SetAccountDeletionInDbTx = func(tx *sql.Tx, permanentId string, requestedAt, deleteAfter int64) error {
+		calls = append(calls, "deletion:"+permanentId)
+		return nil
+	}
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		calls = append(calls, "temporaryIds:"+permanentId)
+		return nil
+	}
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		calls = append(calls, "refreshTokens:"+permanentId)
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	w := httptest.NewRecorder()
+	ConfirmAccountDeletion(w, profileRequest("/profile/delete/confirm", url.Values{"token": {"delete-token"}}))
+	assert.Equal(t, "/sign-in?msg=accountDeletionScheduled", w.Header().Get("Location"))
+	assert.Equal(t, []string{"deletion:perm123", "temporaryIds:perm123", "refreshTokens:perm123"}, calls)
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	w = httptest.NewRecorder()
+	ConfirmAccountDeletion(w, profileRequest("/profile/delete/confirm", url.Values{"token": {"delete-token"}}))
+	assert.Equal(t, "/sign-in?msg=accountDeletionLinkInvalid", w.Header().Get("Location"), "Ссылка должна срабатывать один раз")
+
+	w = httptest.NewRecorder()
+	ConfirmAccountDeletion(w, profileRequest("/profile/delete/confirm", url.Values{"token": {"forged"}}))
+	assert.Equal(t, "/sign-in?msg=accountDeletionLinkInvalid", w.Header().Get("Location"))
+
+	assert.Len(t, calls, 3)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,594 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит раздел администратора:
+//   - AdminUsers: ищет пользователей по началу логина или email
+//   - AdminUser: отображает статус аккаунта, сессии, события и журнал действий администраторов
+//   - AdminDisableUser, AdminEnableUser: блокируют (disabled или banned, бессрочно или на срок) и разблокируют аккаунт
+//   - AdminLogoutUser: завершает все сессии пользователя
+//   - AdminSendPasswordReset: отправляет пользователю ссылку сброса пароля
+//   - AdminChangeLogin, AdminChangeEmail: меняют логин и email пользователя
+//   - AdminGrantRole, AdminRevokeRole: назначают и снимают роли пользователя
+//
+// Доступ к разделу дает право consts.PermissionAdminUsers, к управлению ролями -
+// consts.PermissionRolesManage (проверяются RequirePermission при подключении маршрутов).
+// Каждое действие выполняется в одной транзакции с записью в журнал admin_action,
+// где сохраняются permanentId и логин администратора.
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// adminIdentity получает permanentId и текущий логин администратора.
+//
+// Администратор, созданный через Yandex, может не иметь логина; тогда логин пустой.
+func adminIdentity(r *http.Request) (string, string, error) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+
+	login, err := data.GetLoginFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", "", errors.WithStack(err)
+	}
+	return permanentId, login, nil
+}
+
+// getAdminUser получает логин, email и статус аккаунта пользователя.
+//
+// Возвращает sql.ErrNoRows, если у permanentId нет действующего email.
+func getAdminUser(permanentId string) (structs.AdminUser, error) {
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		return structs.AdminUser{}, errors.WithStack(err)
+	}
+
+	login, err := data.GetLoginFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return structs.AdminUser{}, errors.WithStack(err)
+	}
+
+	status, _, err := accountStatus(permanentId)
+	if err != nil {
+		return structs.AdminUser{}, errors.WithStack(err)
+	}
+	return structs.AdminUser{PermanentId: permanentId, Login: login, Email: email, Status: status}, nil
+}
+
+// redirectToAdminUser перенаправляет на страницу пользователя с ключом сообщения.
+func redirectToAdminUser(w http.ResponseWriter, r *http.Request, permanentId, msgKey string) {
+	http.Redirect(w, r, consts.AdminUserURL+"?id="+url.QueryEscape(permanentId)+"&msg="+url.QueryEscape(msgKey), http.StatusFound)
+}
+
+// adminTargetUser получает пользователя по параметру id формы.
+//
+// Если пользователь не найден, перенаправляет на страницу поиска и возвращает false.
+func adminTargetUser(w http.ResponseWriter, r *http.Request) (structs.AdminUser, bool) {
+	user, err := getAdminUser(r.FormValue("id"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Redirect(w, r, consts.AdminURL+"?msg=userNotExist", http.StatusFound)
+			return structs.AdminUser{}, false
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return structs.AdminUser{}, false
+	}
+	return user, true
+}
+
+// runAdminAction выполняет изменение apply и запись в журнал admin_action в одной транзакции.
+func runAdminAction(r *http.Request, targetPermanentId, action, detail string, apply func(tx *sql.Tx) error) error {
+	adminPermanentId, adminLogin, err := adminIdentity(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if apply != nil {
+		if err := apply(tx); err != nil {
+			tx.Rollback()
+			return errors.WithStack(err)
+		}
+	}
+
+	adminAction := structs.AdminAction{
+		AdminPermanentId:  adminPermanentId,
+		AdminLogin:        adminLogin,
+		TargetPermanentId: targetPermanentId,
+		Action:            action,
+		Detail:            detail,
+		CreatedAt:         time.Now().Unix(),
+	}
+	if err := data.SetAdminActionInDbTx(tx, adminAction); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// notifyAdminAction отправляет пользователю уведомление event о действии администратора.
+//
+// Действие уже выполнено, поэтому ошибка отправки только логируется.
+func notifyAdminAction(user structs.AdminUser, event string, send func(locale, email string, alert structs.SecurityAlert) error) {
+	if !notificationEnabled(user.PermanentId, event) {
+		return
+	}
+	if err := send(userLocale(user.PermanentId), user.Email, adminSecurityAlert(user.PermanentId, user.Email, event)); err != nil {
+		log.Printf("%+v", err)
+	}
+}
+
+// cancelAllSessionsTx отменяет temporaryId и refresh токены пользователя на всех устройствах
+// и доверие ко всем его устройствам.
+func cancelAllSessionsTx(tx *sql.Tx, permanentId string) error {
+	if err := data.SetAllTemporaryIdsCancelledInDbTx(tx, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetAllRefreshTokensCancelledInDbTx(tx, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetTrustedDevicesCancelledInDbTx(tx, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// AdminUsers отображает страницу поиска пользователей.
+//
+// Принимает параметр q из URL query: ищутся пользователи, логин или email которых начинается с q.
+// Без q отображает только форму поиска. Ссылка на приглашения показывается
+// администратору с правом consts.PermissionInvitesManage.
+func AdminUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query().Get("q")
+	page := structs.AdminSearchPage{Query: query, CanManageInvites: HasPermission(r, consts.PermissionInvitesManage), CSRFToken: tmpls.CSRFToken(r)}
+	if msgKey := r.URL.Query().Get("msg"); i18n.Has(msgKey) {
+		page.Msg = i18n.Msg(r, msgKey)
+	}
+
+	if query != "" {
+		permanentIds, err := data.SearchUsersInDb(query)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		for _, permanentId := range permanentIds {
+			user, err := getAdminUser(permanentId)
+			if err != nil {
+				// Аккаунт без действующего email (например, удаляемый) в результаты не попадает
+				if errors.Is(err, sql.ErrNoRows) {
+					continue
+				}
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+			page.Users = append(page.Users, user)
+		}
+		if len(page.Users) == 0 {
+			page.Msg = i18n.Msg(r, "userNotExist")
+		}
+	}
+
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "adminUsers", page); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// AdminUser отображает страницу пользователя по параметру id из URL query.
+//
+// Показывает логин, email, статус блокировки, роли, запланированное удаление,
+// сессии, изменения профиля, отправки кодов и журнал действий администраторов.
+// Формы назначения ролей отображаются, только если у администратора есть право consts.PermissionRolesManage.
+func AdminUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := data.GetUserRolesFromDb(user.PermanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	canManageRoles := HasPermission(r, consts.PermissionRolesManage)
+	var allRoles []structs.Role
+	if canManageRoles {
+		allRoles, err = data.GetRolesFromDb()
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	account, err := data.GetAccountExportFromDb(user.PermanentId, time.Now().Unix())
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	actions, err := data.GetAdminActionsFromDb(user.PermanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	page := structs.AdminUserPage{
+		User:           user,
+		Roles:          roles,
+		AllRoles:       allRoles,
+		CanManageRoles: canManageRoles,
+		Account:        account,
+		Actions:        actions,
+		CSRFToken:      tmpls.CSRFToken(r),
+	}
+	for _, deletion := range account.AccountDeletions {
+		if !deletion.Cancelled {
+			page.DeleteAfter = deletion.DeleteAfter
+		}
+	}
+	if msgKey := r.URL.Query().Get("msg"); i18n.Has(msgKey) {
+		page.Msg = i18n.Msg(r, msgKey)
+	}
+
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "adminUser", page); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// adminStatusReasonMaxLen ограничивает длину причины блокировки (столбец account_status.reason).
+const adminStatusReasonMaxLen = 255
+
+// adminStatusFromForm получает из формы блокировки статус, причину и срок в днях.
+//
+// Пустой статус означает disabled, пустой срок - бессрочную блокировку.
+// Возвращает false, если статус неизвестен или срок не является целым положительным числом.
+func adminStatusFromForm(r *http.Request, permanentId string, now int64) (structs.AccountStatus, bool) {
+	status := structs.AccountStatus{
+		PermanentId: permanentId,
+		Status:      r.FormValue("status"),
+		Reason:      strings.TrimSpace(r.FormValue("reason")),
+		CreatedAt:   now,
+	}
+	if status.Status == "" {
+		status.Status = data.AccountStatusDisabled
+	}
+	if status.Status != data.AccountStatusDisabled && status.Status != data.AccountStatusBanned {
+		return structs.AccountStatus{}, false
+	}
+	if reason := []rune(status.Reason); len(reason) > adminStatusReasonMaxLen {
+		status.Reason = string(reason[:adminStatusReasonMaxLen])
+	}
+
+	if value := r.FormValue("days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return structs.AccountStatus{}, false
+		}
+		status.ExpiresAt = now + int64(days)*24*60*60
+	}
+	return status, true
+}
+
+// AdminDisableUser блокирует аккаунт и завершает все его сессии и refresh токены.
+//
+// Статус (disabled или banned), причина и срок в днях берутся из формы.
+// Администратор не может заблокировать собственный аккаунт.
+// Заблокированный пользователь не может войти ни по паролю, ни через Yandex, ни сбросить пароль.
+func AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	status, ok := adminStatusFromForm(r, user.PermanentId, time.Now().Unix())
+	if !ok {
+		redirectToAdminUser(w, r, user.PermanentId, "accountStatusInvalid")
+		return
+	}
+
+	adminPermanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if adminPermanentId == user.PermanentId {
+		redirectToAdminUser(w, r, user.PermanentId, "adminSelfAction")
+		return
+	}
+
+	action, msgKey := data.AdminActionDisable, "adminUserDisabled"
+	if status.Status == data.AccountStatusBanned {
+		action, msgKey = data.AdminActionBan, "adminUserBanned"
+	}
+
+	if err := runAdminAction(r, user.PermanentId, action, status.Reason, func(tx *sql.Tx) error {
+		if err := data.SetAccountStatusInDbTx(tx, status); err != nil {
+			return err
+		}
+		return cancelAllSessionsTx(tx, user.PermanentId)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	notifyAdminAction(user, data.NotificationAccountLock, tools.AccountLockNotificationSend)
+	redirectToAdminUser(w, r, user.PermanentId, msgKey)
+}
+
+// AdminEnableUser снимает блокировку аккаунта.
+func AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionEnable, "", func(tx *sql.Tx) error {
+		return data.SetAccountStatusCancelledInDbTx(tx, user.PermanentId)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "adminUserEnabled")
+}
+
+// AdminLogoutUser завершает все сессии пользователя на всех устройствах.
+func AdminLogoutUser(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionLogout, "", func(tx *sql.Tx) error {
+		return cancelAllSessionsTx(tx, user.PermanentId)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	notifyAdminAction(user, data.NotificationSessionRevoke, tools.SessionRevokeNotificationSend)
+	redirectToAdminUser(w, r, user.PermanentId, "adminUserLoggedOut")
+}
+
+// AdminSendPasswordReset отправляет пользователю ссылку сброса пароля.
+//
+// Доступно только аккаунтам с email для входа по паролю (yauth = false):
+// аккаунт, созданный через Yandex, сначала устанавливает пароль в профиле.
+// Действие фиксируется в журнале после успешной отправки письма.
+func AdminSendPasswordReset(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	yauth := false
+	permanentId, err := data.GetPermanentIdFromDbByEmail(user.Email, yauth)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if permanentId != user.PermanentId {
+		redirectToAdminUser(w, r, user.PermanentId, "adminResetUnavailable")
+		return
+	}
+
+	alert := adminSecurityAlert(user.PermanentId, user.Email, data.NotificationPasswordResetRequest)
+	if err := sendPasswordResetLink(userLocale(user.PermanentId), user.Email, alert); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionPasswordReset, user.Email, nil); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "adminPasswordResetSent")
+}
+
+// AdminChangeLogin меняет логин пользователя.
+//
+// Проверяет логин так же, как смена логина в профиле. Изменение фиксируется
+// и в журнале профиля, и в журнале действий администраторов.
+func AdminChangeLogin(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	login := r.FormValue("login")
+	if err := tools.LoginValidate(login); err != nil {
+		redirectToAdminUser(w, r, user.PermanentId, "loginInvalid")
+		return
+	}
+	if login == user.Login {
+		redirectToAdminUser(w, r, user.PermanentId, "loginUnchanged")
+		return
+	}
+
+	if _, err := data.GetPermanentIdFromDbByLogin(login); err == nil {
+		redirectToAdminUser(w, r, user.PermanentId, "userAlreadyExist")
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	detail := user.Login + " -> " + login
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionLogin, detail, func(tx *sql.Tx) error {
+		if err := data.SetLoginInDbTx(tx, user.PermanentId, login); err != nil {
+			return err
+		}
+		change := structs.ProfileChange{PermanentId: user.PermanentId, Field: data.ProfileFieldLogin, OldValue: user.Login, NewValue: login}
+		return data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix())
+	}); err != nil {
+		if errors.Is(err, data.ErrLoginAlreadyExist) {
+			redirectToAdminUser(w, r, user.PermanentId, "userAlreadyExist")
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "loginChanged")
+}
+
+// AdminChangeEmail меняет email пользователя для входа по паролю без подтверждения кодом.
+//
+// Проверяет формат и что адрес не занят другим пользователем. Email аккаунта,
+// созданного через Yandex, принадлежит Yandex и здесь не меняется.
+func AdminChangeEmail(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	email := r.FormValue("email")
+	if err := tools.EmailValidate(email); err != nil {
+		redirectToAdminUser(w, r, user.PermanentId, "emailInvalid")
+		return
+	}
+	if email == user.Email {
+		redirectToAdminUser(w, r, user.PermanentId, "emailUnchanged")
+		return
+	}
+
+	yauth := false
+	permanentId, err := data.GetPermanentIdFromDbByEmail(user.Email, yauth)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if permanentId != user.PermanentId {
+		redirectToAdminUser(w, r, user.PermanentId, "adminResetUnavailable")
+		return
+	}
+
+	if _, err := data.GetPermanentIdFromDbByEmail(email, yauth); err == nil {
+		redirectToAdminUser(w, r, user.PermanentId, "userAlreadyExist")
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	detail := user.Email + " -> " + email
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionEmail, detail, func(tx *sql.Tx) error {
+		if err := data.SetEmailInDbTx(tx, user.PermanentId, email, yauth); err != nil {
+			return err
+		}
+		change := structs.ProfileChange{PermanentId: user.PermanentId, Field: data.ProfileFieldEmail, OldValue: user.Email, NewValue: email}
+		return data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix())
+	}); err != nil {
+		if errors.Is(err, data.ErrEmailAlreadyExist) {
+			redirectToAdminUser(w, r, user.PermanentId, "userAlreadyExist")
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	// Уведомление отправляется на прежний адрес; отменить смену администратора по ссылке нельзя,
+	// поэтому ссылка "это был не я" указывает новый адрес и сброс пароля отправляется на него
+	alert := adminSecurityAlert(user.PermanentId, email, data.NotificationEmailChange)
+	if err := tools.EmailChangeNotificationSend(userLocale(user.PermanentId), user.Email, email, "", alert); err != nil {
+		log.Printf("%+v", err)
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "adminEmailChanged")
+}
+
+// AdminGrantRole назначает пользователю роль из параметра role формы.
+//
+// Роль должна существовать. Новые права действуют с ближайшего запроса пользователя.
+func AdminGrantRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	role := r.FormValue("role")
+	exists, err := data.IsRoleInDb(role)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if !exists {
+		redirectToAdminUser(w, r, user.PermanentId, "roleNotExist")
+		return
+	}
+
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionRoleGrant, role, func(tx *sql.Tx) error {
+		return data.SetUserRoleInDbTx(tx, user.PermanentId, role, time.Now().Unix())
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "roleGranted")
+}
+
+// AdminRevokeRole снимает с пользователя роль из параметра role формы.
+//
+// Администратор не может снять роль с себя, чтобы не потерять доступ к разделу;
+// для этого есть команда role revoke.
+func AdminRevokeRole(w http.ResponseWriter, r *http.Request) {
+	user, ok := adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	adminPermanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if adminPermanentId == user.PermanentId {
+		redirectToAdminUser(w, r, user.PermanentId, "adminSelfRoleRevoke")
+		return
+	}
+
+	role := r.FormValue("role")
+	if err := runAdminAction(r, user.PermanentId, data.AdminActionRoleRevoke, role, func(tx *sql.Tx) error {
+		return data.SetUserRoleCancelledInDbTx(tx, user.PermanentId, role)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminUser(w, r, user.PermanentId, "roleRevoked")
+}
@@ -0,0 +1,122 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит управление приглашениями в разделе администратора:
+//   - AdminInvites: отображает последние приглашения со ссылками на регистрацию
+//   - AdminCreateInvite: создает одноразовое приглашение, при необходимости для одного email и на срок
+//   - AdminRevokeInvite: отзывает неиспользованное приглашение
+//
+// Доступ дает право consts.PermissionInvitesManage. Создание и отзыв пишутся в журнал
+// admin_action без целевого аккаунта, код приглашения сохраняется в detail.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/google/uuid"
+)
+
+// redirectToAdminInvites перенаправляет на страницу приглашений с ключом сообщения.
+func redirectToAdminInvites(w http.ResponseWriter, r *http.Request, msgKey string) {
+	http.Redirect(w, r, consts.AdminInvitesURL+"?msg="+url.QueryEscape(msgKey), http.StatusFound)
+}
+
+// inviteFromForm получает из формы email и срок действия приглашения в днях.
+//
+// Пустой email означает приглашение для любого адреса, пустой срок - бессрочное приглашение.
+// Возвращает false, если email некорректен или срок не является целым положительным числом.
+func inviteFromForm(r *http.Request, createdBy string, now int64) (structs.Invite, bool) {
+	invite := structs.Invite{
+		Code:      uuid.New().String(),
+		Email:     strings.TrimSpace(r.FormValue("email")),
+		CreatedBy: createdBy,
+		CreatedAt: now,
+	}
+	if invite.Email != "" && tools.EmailValidate(invite.Email) != nil {
+		return structs.Invite{}, false
+	}
+
+	if value := r.FormValue("days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			return structs.Invite{}, false
+		}
+		invite.ExpiresAt = now + int64(days)*24*60*60
+	}
+	return invite, true
+}
+
+// AdminInvites отображает страницу приглашений.
+//
+// Показывает форму создания и последние приглашения с их состоянием;
+// для неиспользованных приглашений выводится ссылка на регистрацию и форма отзыва.
+func AdminInvites(w http.ResponseWriter, r *http.Request) {
+	invites, err := data.GetInvitesFromDb()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	page := structs.AdminInvitesPage{Invites: invites, CSRFToken: tmpls.CSRFToken(r)}
+	if msgKey := r.URL.Query().Get("msg"); i18n.Has(msgKey) {
+		page.Msg = i18n.Msg(r, msgKey)
+	}
+
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "adminInvites", page); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// AdminCreateInvite создает приглашение из полей email и days формы.
+//
+// Приглашение действует в режиме регистрации invite и используется один раз:
+// по коду на странице регистрации или по ссылке /sign-up?invite=<код>.
+func AdminCreateInvite(w http.ResponseWriter, r *http.Request) {
+	adminPermanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	invite, ok := inviteFromForm(r, adminPermanentId, time.Now().Unix())
+	if !ok {
+		redirectToAdminInvites(w, r, "inviteFormInvalid")
+		return
+	}
+
+	if err := runAdminAction(r, "", data.AdminActionInviteCreate, invite.Code, func(tx *sql.Tx) error {
+		return data.SetInviteInDbTx(tx, invite)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminInvites(w, r, "inviteCreated")
+}
+
+// AdminRevokeInvite отзывает приглашение по параметру code формы.
+//
+// Использованное приглашение не меняется: аккаунт, созданный по нему, остается.
+func AdminRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	code := r.FormValue("code")
+	if err := runAdminAction(r, "", data.AdminActionInviteRevoke, code, func(tx *sql.Tx) error {
+		return data.SetInviteCancelledInDbTx(tx, code)
+	}); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToAdminInvites(w, r, "inviteRevoked")
+}
@@ -0,0 +1,127 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует управление приглашениями в разделе администратора.
+package auth
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupInviteTest сохраняет и восстанавливает функции работы с приглашениями.
+func setupInviteTest() func() {
+	oldGetInvitesFromDb := data.GetInvitesFromDb
+	oldSetInviteInDbTx := data.SetInviteInDbTx
+	oldSetInviteCancelledInDbTx := data.SetInviteCancelledInDbTx
+
+	return func() {
+		data.GetInvitesFromDb = oldGetInvitesFromDb
+		data.SetInviteInDbTx = oldSetInviteInDbTx
+		data.SetInviteCancelledInDbTx = oldSetInviteCancelledInDbTx
+	}
+}
+
+// TestAdminInvites проверяет страницу приглашений.
+// Ожидается: последние приглашения и сообщение по ключу из query.
+func TestAdminInvites(t *testing.T) {
+	_, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupInviteTest()()
+
+	invites := []structs.Invite{{Code: "code1", CreatedAt: 100}}
+	data.GetInvitesFromDb = func() ([]structs.Invite, error) { return invites, nil }
+	var page structs.AdminInvitesPage
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "adminInvites", templateName)
+		page = data.(structs.AdminInvitesPage)
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	AdminInvites(w, httptest.NewRequest("GET", "/admin/invites?msg=inviteCreated", nil))
+
+	assert.Equal(t, invites, page.Invites)
+	assert.NotEmpty(t, page.Msg)
+}
+
+// TestAdminCreateInvite проверяет создание приглашения.
+// Ожидается: приглашение для email со сроком в днях создается от имени администратора
+// и фиксируется в журнале; некорректный email отклоняется.
+func TestAdminCreateInvite(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+	defer setupInviteTest()()
+
+	var invite structs.Invite
+	data.SetInviteInDbTx = func(tx *sql.Tx, newInvite structs.Invite) error {
+		invite = newInvite
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminCreateInvite(w, profileRequest("/admin/invites/create", url.Values{"email": {" new@example.com "}, "days": {"7"}}))
+
+	assert.Equal(t, "/admin/invites?msg=inviteCreated", w.Header().Get("Location"))
+	assert.NotEmpty(t, invite.Code)
+	assert.Equal(t, "new@example.com", invite.Email)
+	assert.Equal(t, "perm123", invite.CreatedBy)
+	assert.Equal(t, invite.CreatedAt+7*24*60*60, invite.ExpiresAt)
+	assert.Equal(t, data.AdminActionInviteCreate, action.Action)
+	assert.Equal(t, "", action.TargetPermanentId)
+	assert.Equal(t, invite.Code, action.Detail)
+
+	for _, form := range []url.Values{{"email": {"not-an-email"}}, {"days": {"0"}}} {
+		expectProfileUser(mock)
+
+		w = httptest.NewRecorder()
+		AdminCreateInvite(w, profileRequest("/admin/invites/create", form))
+
+		assert.Equal(t, "/admin/invites?msg=inviteFormInvalid", w.Header().Get("Location"))
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminRevokeInvite проверяет отзыв приглашения.
+// Ожидается: приглашение отзывается и фиксируется в журнале.
+func TestAdminRevokeInvite(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+	defer setupInviteTest()()
+
+	var revokedCode string
+	data.SetInviteCancelledInDbTx = func(tx *sql.Tx, code string) error {
+		revokedCode = code
+		return nil
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminRevokeInvite(w, profileRequest("/admin/invites/revoke", url.Values{"code": {"code1"}}))
+
+	assert.Equal(t, "/admin/invites?msg=inviteRevoked", w.Header().Get("Location"))
+	assert.Equal(t, "code1", revokedCode)
+	assert.Equal(t, data.AdminActionInviteRevoke, action.Action)
+	assert.Equal(t, "code1", action.Detail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,688 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует раздел администратора: поиск, страницу пользователя, действия над аккаунтом и назначение ролей.
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupAdminTest дополняет окружение профиля зависимостями раздела администратора.
+// Администратор perm123 с логином admin, целевой пользователь perm456 с логином user456 не заблокирован.
+// Возвращает указатель на последнее записанное действие администратора.
+func setupAdminTest(t *testing.T) (*structs.AdminAction, func()) {
+	oldGetUserRolesFromDb := data.GetUserRolesFromDb
+	oldGetRolesFromDb := data.GetRolesFromDb
+	oldIsRoleInDb := data.IsRoleInDb
+	oldSetUserRoleInDbTx := data.SetUserRoleInDbTx
+	oldSetUserRoleCancelledInDbTx := data.SetUserRoleCancelledInDbTx
+	oldSearchUsersInDb := data.SearchUsersInDb
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+	oldSetAccountStatusInDbTx := data.SetAccountStatusInDbTx
+	oldSetAccountStatusCancelledInDbTx := data.SetAccountStatusCancelledInDbTx
+	oldSetAdminActionInDbTx := data.SetAdminActionInDbTx
+	oldGetAdminActionsFromDb := data.GetAdminActionsFromDb
+	oldGetAccountExportFromDb := data.GetAccountExportFromDb
+	oldGeneratePasswordResetLink := tools.GeneratePasswordResetLink
+	oldSetPasswordResetTokenInDb := data.SetPasswordResetTokenInDb
+	oldPasswordResetEmailSend := tools.PasswordResetEmailSend
+	oldGetUserLocaleFromDb := data.GetUserLocaleFromDb
+	oldSessionRevokeNotificationSend := tools.SessionRevokeNotificationSend
+	oldAccountLockNotificationSend := tools.AccountLockNotificationSend
+
+	data.GetUserLocaleFromDb = func(permanentId string) (string, error) { return i18n.En, nil }
+	tools.SessionRevokeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+	tools.AccountLockNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+	tools.EmailChangeNotificationSend = func(locale, oldEmail, newEmail, undoLink string, alert structs.SecurityAlert) error { return nil }
+	data.GetLoginFromDb = func(permanentId string) (string, error) {
+		if permanentId == "perm123" {
+			return "admin", nil
+		}
+		return "user456", nil
+	}
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
+	action := &structs.AdminAction{}
+	data.SetAdminActionInDbTx = func(tx *sql.Tx, adminAction structs.AdminAction) error {
+		*action = adminAction
+		return nil
+	}
+
+	return action, func() {
+		data.GetUserRolesFromDb = oldGetUserRolesFromDb
+		data.GetRolesFromDb = oldGetRolesFromDb
+		data.IsRoleInDb = oldIsRoleInDb
+		data.SetUserRoleInDbTx = oldSetUserRoleInDbTx
+		data.SetUserRoleCancelledInDbTx = oldSetUserRoleCancelledInDbTx
+		data.SearchUsersInDb = oldSearchUsersInDb
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
+		data.SetAccountStatusInDbTx = oldSetAccountStatusInDbTx
+		data.SetAccountStatusCancelledInDbTx = oldSetAccountStatusCancelledInDbTx
+		data.SetAdminActionInDbTx = oldSetAdminActionInDbTx
+		data.GetAdminActionsFromDb = oldGetAdminActionsFromDb
+		data.GetAccountExportFromDb = oldGetAccountExportFromDb
+		tools.GeneratePasswordResetLink = oldGeneratePasswordResetLink
+		data.SetPasswordResetTokenInDb = oldSetPasswordResetTokenInDb
+		tools.PasswordResetEmailSend = oldPasswordResetEmailSend
+		data.GetUserLocaleFromDb = oldGetUserLocaleFromDb
+		tools.SessionRevokeNotificationSend = oldSessionRevokeNotificationSend
+		tools.AccountLockNotificationSend = oldAccountLockNotificationSend
+	}
+}
+
+// expectAdminTarget ожидает запрос email целевого пользователя perm456.
+func expectAdminTarget(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(data.EmailSelectQuery).
+		WithArgs("perm456").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
+}
+
+// adminActionForm возвращает форму действия над пользователем perm456.
+func adminActionForm(values url.Values) url.Values {
+	form := url.Values{"id": {"perm456"}}
+	for key, value := range values {
+		form[key] = value
+	}
+	return form
+}
+
+// TestAdminUsers проверяет поиск пользователей.
+// Ожидается: найденные пользователи с логином, email и статусом; аккаунты без email пропускаются.
+func TestAdminUsers(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	_, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	data.SearchUsersInDb = func(query string) ([]string, error) {
+		assert.Equal(t, "user", query)
+		return []string{"perm456", "perm789"}, nil
+	}
+	banned := structs.AccountStatus{Status: data.AccountStatusBanned, Reason: "spam"}
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		status := banned
+		status.PermanentId = permanentId
+		return status, nil
+	}
+	var page structs.AdminSearchPage
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "adminUsers", templateName)
+		page = data.(structs.AdminSearchPage)
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	mock.ExpectQuery(data.EmailSelectQuery).WithArgs("perm789").WillReturnError(sql.ErrNoRows)
+
+	w := httptest.NewRecorder()
+	AdminUsers(w, httptest.NewRequest("GET", "/admin?q=user", nil))
+
+	assert.Equal(t, "user", page.Query)
+	assert.Equal(t, []structs.AdminUser{{PermanentId: "perm456", Login: "user456", Email: "user@example.com", Status: structs.AccountStatus{PermanentId: "perm456", Status: data.AccountStatusBanned, Reason: "spam"}}}, page.Users)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminUser проверяет страницу пользователя.
+// Ожидается: данные аккаунта, запланированное удаление и журнал действий; неизвестный id ведет на поиск.
+func TestAdminUser(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	_, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	data.GetUserRolesFromDb = func(permanentId string) ([]string, error) { return []string{"support"}, nil }
+	data.GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+		return structs.AccountExport{
+			PermanentId: permanentId,
+			AccountDeletions: []structs.ExportedAccountDeletion{
+				{RequestedAt: 10, DeleteAfter: 20, Cancelled: true},
+				{RequestedAt: 30, DeleteAfter: 40},
+			},
+		}, nil
+	}
+	actions := []structs.AdminAction{{AdminPermanentId: "perm123", AdminLogin: "admin", TargetPermanentId: "perm456", Action: data.AdminActionLogout, CreatedAt: 50}}
+	data.GetAdminActionsFromDb = func(targetPermanentId string) ([]structs.AdminAction, error) { return actions, nil }
+	var page structs.AdminUserPage
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "adminUser", templateName)
+		page = data.(structs.AdminUserPage)
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	mock.ExpectQuery(data.EmailSelectQuery).WithArgs("unknown").WillReturnError(sql.ErrNoRows)
+
+	w := httptest.NewRecorder()
+	AdminUser(w, httptest.NewRequest("GET", "/admin/user?id=perm456&msg=adminUserLoggedOut", nil))
+
+	assert.Equal(t, "user456", page.User.Login)
+	assert.Equal(t, []string{"support"}, page.Roles)
+	assert.False(t, page.CanManageRoles)
+	assert.Empty(t, page.AllRoles)
+	assert.Equal(t, int64(40), page.DeleteAfter)
+	assert.Equal(t, actions, page.Actions)
+	assert.NotEmpty(t, page.Msg)
+
+	w = httptest.NewRecorder()
+	AdminUser(w, httptest.NewRequest("GET", "/admin/user?id=unknown", nil))
+	assert.Equal(t, "/admin?msg=userNotExist", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminDisableUser проверяет блокировку аккаунта.
+// Ожидается: блокировка, завершение всех сессий и запись в журнал с данными администратора в одной транзакции.
+func TestAdminDisableUser(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	var status structs.AccountStatus
+	data.SetAccountStatusInDbTx = func(tx *sql.Tx, accountStatus structs.AccountStatus) error {
+		status = accountStatus
+		return nil
+	}
+	sessionsCancelled := false
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		sessionsCancelled = permanentId == "perm456"
+		return nil
+	}
+	var notifiedAlert structs.SecurityAlert
+	tools.AccountLockNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+		assert.Equal(t, "user@example.com", email)
+		notifiedAlert = alert
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	expectProfileUser(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminDisableUser(w, profileRequest("/admin/user/disable", adminActionForm(nil)))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=adminUserDisabled", w.Header().Get("Location"))
+	assert.Equal(t, "perm456", status.PermanentId)
+	assert.Equal(t, data.AccountStatusDisabled, status.Status)
+	assert.Zero(t, status.ExpiresAt)
+	assert.True(t, sessionsCancelled)
+	assert.Equal(t, "perm456", trustedDevicesCancelledFor)
+	assert.Equal(t, "perm123", action.AdminPermanentId)
+	assert.Equal(t, "admin", action.AdminLogin)
+	assert.Equal(t, "perm456", action.TargetPermanentId)
+	assert.Equal(t, data.AdminActionDisable, action.Action)
+	assert.Equal(t, data.NotificationAccountLock, notifiedAlert.Event)
+	assert.True(t, notifiedAlert.ByAdmin)
+	assert.Empty(t, notifiedAlert.IP, "IP администратора не должен попадать в уведомление")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminDisableUser_Ban проверяет временную блокировку с причиной.
+// Ожидается: статус banned со сроком в днях, причина записывается в журнал.
+func TestAdminDisableUser_Ban(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	var status structs.AccountStatus
+	data.SetAccountStatusInDbTx = func(tx *sql.Tx, accountStatus structs.AccountStatus) error {
+		status = accountStatus
+		return nil
+	}
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+
+	expectAdminTarget(mock)
+	expectProfileUser(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	form := adminActionForm(url.Values{"status": {"banned"}, "reason": {" spam "}, "days": {"3"}})
+	w := httptest.NewRecorder()
+	AdminDisableUser(w, profileRequest("/admin/user/disable", form))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=adminUserBanned", w.Header().Get("Location"))
+	assert.Equal(t, data.AccountStatusBanned, status.Status)
+	assert.Equal(t, "spam", status.Reason)
+	assert.Equal(t, status.CreatedAt+3*24*60*60, status.ExpiresAt)
+	assert.Equal(t, data.AdminActionBan, action.Action)
+	assert.Equal(t, "spam", action.Detail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminDisableUser_InvalidForm проверяет неверный статус или срок блокировки.
+// Ожидается: сообщение, транзакция не начинается.
+func TestAdminDisableUser_InvalidForm(t *testing.T) {
+	for _, values := range []url.Values{
+		{"status": {"active"}},
+		{"days": {"0"}},
+		{"days": {"week"}},
+	} {
+		mock, teardown := setupProfileTest(t)
+		_, adminTeardown := setupAdminTest(t)
+
+		expectAdminTarget(mock)
+
+		w := httptest.NewRecorder()
+		AdminDisableUser(w, profileRequest("/admin/user/disable", adminActionForm(values)))
+
+		assert.Equal(t, "/admin/user?id=perm456&msg=accountStatusInvalid", w.Header().Get("Location"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+
+		adminTeardown()
+		teardown()
+	}
+}
+
+// TestAdminDisableUser_Self проверяет попытку заблокировать собственный аккаунт.
+// Ожидается: сообщение, транзакция не начинается.
+func TestAdminDisableUser_Self(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	_, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	mock.ExpectQuery(data.EmailSelectQuery).
+		WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("admin@example.com"))
+	expectProfileUser(mock)
+
+	w := httptest.NewRecorder()
+	AdminDisableUser(w, profileRequest("/admin/user/disable", url.Values{"id": {"perm123"}}))
+
+	assert.Equal(t, "/admin/user?id=perm123&msg=adminSelfAction", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminEnableAndLogoutUser проверяет разблокировку аккаунта и завершение всех сессий.
+// Ожидается: изменение и запись в журнал в одной транзакции.
+func TestAdminEnableAndLogoutUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		handler  http.HandlerFunc
+		action   string
+		location string
+	}{
+		{name: "enable", handler: AdminEnableUser, action: data.AdminActionEnable, location: "/admin/user?id=perm456&msg=adminUserEnabled"},
+		{name: "logout", handler: AdminLogoutUser, action: data.AdminActionLogout, location: "/admin/user?id=perm456&msg=adminUserLoggedOut"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			action, adminTeardown := setupAdminTest(t)
+			defer adminTeardown()
+
+			applied := false
+			data.SetAccountStatusCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+				applied = true
+				return nil
+			}
+			data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+				applied = true
+				return nil
+			}
+			data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+
+			expectAdminTarget(mock)
+			expectProfileUser(mock)
+			mock.ExpectBegin()
+			mock.ExpectCommit()
+
+			w := httptest.NewRecorder()
+			tt.handler(w, profileRequest("/admin/user/"+tt.name, adminActionForm(nil)))
+
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.True(t, applied)
+			if tt.action == data.AdminActionLogout {
+				assert.Equal(t, "perm456", trustedDevicesCancelledFor)
+			}
+			assert.Equal(t, tt.action, action.Action)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestAdminSendPasswordReset проверяет отправку ссылки сброса пароля администратором.
+// Ожидается: ссылка отправляется на email для входа по паролю, действие фиксируется;
+// аккаунту без такого email ссылка не отправляется.
+func TestAdminSendPasswordReset(t *testing.T) {
+	t.Run("sent", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		action, adminTeardown := setupAdminTest(t)
+		defer adminTeardown()
+
+		data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+			assert.False(t, yauth)
+			return "perm456", nil
+		}
+		tools.GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
+			return "http://localhost:8080/set-new-password?token=reset-token", nil
+		}
+		data.SetPasswordResetTokenInDb = func(token, email string) error {
+			assert.Equal(t, "reset-token", token)
+			assert.Equal(t, "user@example.com", email)
+			return nil
+		}
+		var sentTo string
+		tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error {
+			sentTo = email
+			return nil
+		}
+
+		expectAdminTarget(mock)
+		expectProfileUser(mock)
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		w := httptest.NewRecorder()
+		AdminSendPasswordReset(w, profileRequest("/admin/user/password-reset", adminActionForm(nil)))
+
+		assert.Equal(t, "/admin/user?id=perm456&msg=adminPasswordResetSent", w.Header().Get("Location"))
+		assert.Equal(t, "user@example.com", sentTo)
+		assert.Equal(t, data.AdminActionPasswordReset, action.Action)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("yandex account", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		_, adminTeardown := setupAdminTest(t)
+		defer adminTeardown()
+
+		data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+			return "", errors.WithStack(sql.ErrNoRows)
+		}
+		tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error {
+			t.Error("reset link should not be sent")
+			return nil
+		}
+
+		expectAdminTarget(mock)
+
+		w := httptest.NewRecorder()
+		AdminSendPasswordReset(w, profileRequest("/admin/user/password-reset", adminActionForm(nil)))
+
+		assert.Equal(t, "/admin/user?id=perm456&msg=adminResetUnavailable", w.Header().Get("Location"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestAdminChangeLogin проверяет смену логина администратором.
+// Ожидается: новый логин, запись в журнале профиля и в журнале администраторов с прежним и новым значением.
+func TestAdminChangeLogin(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "", sql.ErrNoRows }
+	var savedLogin string
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		savedLogin = login
+		return nil
+	}
+	var change structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, profileChange structs.ProfileChange, undoToken string, changedAt int64) error {
+		change = profileChange
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminChangeLogin(w, profileRequest("/admin/user/login", adminActionForm(url.Values{"login": {"newLogin"}})))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=loginChanged", w.Header().Get("Location"))
+	assert.Equal(t, "newLogin", savedLogin)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm456", Field: data.ProfileFieldLogin, OldValue: "user456", NewValue: "newLogin"}, change)
+	assert.Equal(t, data.AdminActionLogin, action.Action)
+	assert.Equal(t, "user456 -> newLogin", action.Detail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminChangeLogin_Rejected проверяет отклонение некорректного логина.
+// Ожидается: сообщение на странице пользователя, транзакция не начинается.
+func TestAdminChangeLogin_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		login  string
+		msgKey string
+	}{
+		{name: "invalid", login: "bad login", msgKey: "loginInvalid"},
+		{name: "unchanged", login: "user456", msgKey: "loginUnchanged"},
+		{name: "taken", login: "taken", msgKey: "userAlreadyExist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			_, adminTeardown := setupAdminTest(t)
+			defer adminTeardown()
+
+			data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "perm789", nil }
+
+			expectAdminTarget(mock)
+
+			w := httptest.NewRecorder()
+			AdminChangeLogin(w, profileRequest("/admin/user/login", adminActionForm(url.Values{"login": {tt.login}})))
+
+			assert.Equal(t, "/admin/user?id=perm456&msg="+tt.msgKey, w.Header().Get("Location"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestAdminChangeEmail проверяет смену email администратором.
+// Ожидается: новый email для входа по паролю, записи в журналах; занятый адрес отклоняется.
+func TestAdminChangeEmail(t *testing.T) {
+	t.Run("changed", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		action, adminTeardown := setupAdminTest(t)
+		defer adminTeardown()
+
+		data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+			if email == "user@example.com" {
+				return "perm456", nil
+			}
+			return "", errors.WithStack(sql.ErrNoRows)
+		}
+		var savedEmail string
+		var savedYauth bool
+		data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+			savedEmail, savedYauth = email, yauth
+			return nil
+		}
+		var change structs.ProfileChange
+		data.SetProfileChangeInDbTx = func(tx *sql.Tx, profileChange structs.ProfileChange, undoToken string, changedAt int64) error {
+			change = profileChange
+			return nil
+		}
+		var notifiedEmail string
+		tools.EmailChangeNotificationSend = func(locale, oldEmail, newEmail, undoLink string, alert structs.SecurityAlert) error {
+			notifiedEmail = oldEmail
+			assert.Empty(t, undoLink)
+			assert.True(t, alert.ByAdmin)
+			return nil
+		}
+
+		expectAdminTarget(mock)
+		expectProfileUser(mock)
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		w := httptest.NewRecorder()
+		AdminChangeEmail(w, profileRequest("/admin/user/email", adminActionForm(url.Values{"email": {"new@example.com"}})))
+
+		assert.Equal(t, "/admin/user?id=perm456&msg=adminEmailChanged", w.Header().Get("Location"))
+		assert.Equal(t, "new@example.com", savedEmail)
+		assert.False(t, savedYauth)
+		assert.Equal(t, "user@example.com", change.OldValue)
+		assert.Equal(t, "user@example.com", notifiedEmail)
+		assert.Equal(t, data.AdminActionEmail, action.Action)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("taken", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		_, adminTeardown := setupAdminTest(t)
+		defer adminTeardown()
+
+		data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+			if email == "user@example.com" {
+				return "perm456", nil
+			}
+			return "perm789", nil
+		}
+
+		expectAdminTarget(mock)
+
+		w := httptest.NewRecorder()
+		AdminChangeEmail(w, profileRequest("/admin/user/email", adminActionForm(url.Values{"email": {"taken@example.com"}})))
+
+		assert.Equal(t, "/admin/user?id=perm456&msg=userAlreadyExist", w.Header().Get("Location"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestAdminUser_CanManageRoles проверяет страницу пользователя для администратора с правом управления ролями.
+// Ожидается: список всех ролей для формы назначения.
+func TestAdminUser_CanManageRoles(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	_, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	allRoles := []structs.Role{{Name: "admin"}, {Name: "support"}}
+	data.GetRolesFromDb = func() ([]structs.Role, error) { return allRoles, nil }
+	data.GetUserRolesFromDb = func(permanentId string) ([]string, error) { return nil, nil }
+	data.GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+		return structs.AccountExport{PermanentId: permanentId}, nil
+	}
+	data.GetAdminActionsFromDb = func(targetPermanentId string) ([]structs.AdminAction, error) { return nil, nil }
+	var page structs.AdminUserPage
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		page = data.(structs.AdminUserPage)
+		return nil
+	}
+
+	expectAdminTarget(mock)
+
+	access := structs.Access{PermanentId: "perm123", Permissions: []string{consts.PermissionAdminUsers, consts.PermissionRolesManage}}
+	req := httptest.NewRequest("GET", "/admin/user?id=perm456", nil)
+	req = req.WithContext(context.WithValue(req.Context(), consts.AccessCtxKey, access))
+	w := httptest.NewRecorder()
+	AdminUser(w, req)
+
+	assert.True(t, page.CanManageRoles)
+	assert.Equal(t, allRoles, page.AllRoles)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminGrantRole проверяет назначение роли пользователю.
+// Ожидается: роль назначается и фиксируется в журнале; неизвестная роль отклоняется.
+func TestAdminGrantRole(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	data.IsRoleInDb = func(name string) (bool, error) { return name == "support", nil }
+	var grantedId, grantedRole string
+	data.SetUserRoleInDbTx = func(tx *sql.Tx, permanentId, role string, grantedAt int64) error {
+		grantedId, grantedRole = permanentId, role
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminGrantRole(w, profileRequest("/admin/user/role/grant", adminActionForm(url.Values{"role": {"support"}})))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=roleGranted", w.Header().Get("Location"))
+	assert.Equal(t, "perm456", grantedId)
+	assert.Equal(t, "support", grantedRole)
+	assert.Equal(t, data.AdminActionRoleGrant, action.Action)
+	assert.Equal(t, "support", action.Detail)
+
+	expectAdminTarget(mock)
+
+	w = httptest.NewRecorder()
+	AdminGrantRole(w, profileRequest("/admin/user/role/grant", adminActionForm(url.Values{"role": {"missing"}})))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=roleNotExist", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminRevokeRole проверяет снятие роли с пользователя.
+// Ожидается: роль снимается и фиксируется в журнале; снять роль с себя нельзя.
+func TestAdminRevokeRole(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	action, adminTeardown := setupAdminTest(t)
+	defer adminTeardown()
+
+	var revokedId, revokedRole string
+	data.SetUserRoleCancelledInDbTx = func(tx *sql.Tx, permanentId, role string) error {
+		revokedId, revokedRole = permanentId, role
+		return nil
+	}
+
+	expectAdminTarget(mock)
+	expectProfileUser(mock)
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	AdminRevokeRole(w, profileRequest("/admin/user/role/revoke", adminActionForm(url.Values{"role": {"support"}})))
+
+	assert.Equal(t, "/admin/user?id=perm456&msg=roleRevoked", w.Header().Get("Location"))
+	assert.Equal(t, "perm456", revokedId)
+	assert.Equal(t, "support", revokedRole)
+	assert.Equal(t, data.AdminActionRoleRevoke, action.Action)
+
+	mock.ExpectQuery(data.EmailSelectQuery).
+		WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("admin@example.com"))
+	expectProfileUser(mock)
+
+	w = httptest.NewRecorder()
+	AdminRevokeRole(w, profileRequest("/admin/user/role/revoke", url.Values{"id": {"perm123"}, "role": {"admin"}}))
+
+	assert.Equal(t, "/admin/user?id=perm123&msg=adminSelfRoleRevoke", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
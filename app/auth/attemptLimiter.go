@@ -0,0 +1,77 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит ограничение неудачных попыток подтверждения:
+//   - loadAttemptLimits: загружает лимит попыток из переменных окружения
+//   - failedAttemptsRetryAfter: проверяет, исчерпаны ли попытки
+//   - recordFailedAttempt: учитывает неудачную попытку
+//   - renderTooManyAttempts: отвечает статусом 429 на странице профиля
+//
+// Попытки считаются по пользователю и виду подтверждения (текущий пароль, код смены email,
+// код подтверждения входа)
+// и хранятся в БД, поэтому новая сессия или повтор старой cookie не сбрасывают счетчик.
+package auth
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/pkg/errors"
+)
+
+// attemptLimits описывает ограничение неудачных попыток подтверждения.
+type attemptLimits struct {
+	max    int
+	window int64
+}
+
+// loadAttemptLimits загружает лимит неудачных попыток.
+//
+// Использует переменные окружения:
+//   - FAILED_ATTEMPTS_MAX: максимум неудачных попыток за окно (по умолчанию 5)
+//   - FAILED_ATTEMPTS_WINDOW: окно в секундах (по умолчанию 900)
+//
+// Некорректные или неположительные значения заменяются значениями по умолчанию.
+func loadAttemptLimits() attemptLimits {
+	return attemptLimits{
+		max:    envPositiveInt("FAILED_ATTEMPTS_MAX", 5),
+		window: int64(envPositiveInt("FAILED_ATTEMPTS_WINDOW", 15*60)),
+	}
+}
+
+// failedAttemptsRetryAfter проверяет, исчерпаны ли попытки вида kind.
+//
+// Возвращает время ожидания в секундах до освобождения попытки
+// или 0, если попытка разрешена.
+var failedAttemptsRetryAfter = func(permanentId, kind string, now int64) (int64, error) {
+	limits := loadAttemptLimits()
+	count, firstAt, err := data.GetFailedAttemptsFromDb(permanentId, kind, now-limits.window)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if count < limits.max {
+		return 0, nil
+	}
+	return max(firstAt+limits.window-now, 1), nil
+}
+
+// recordFailedAttempt учитывает неудачную попытку вида kind.
+//
+// Возвращает true, если этой попыткой лимит исчерпан.
+var recordFailedAttempt = func(permanentId, kind string, now int64) (bool, error) {
+	if err := data.SetFailedAttemptInDb(permanentId, kind, now); err != nil {
+		return false, errors.WithStack(err)
+	}
+	retryAfter, err := failedAttemptsRetryAfter(permanentId, kind, now)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return retryAfter > 0, nil
+}
+
+// renderTooManyAttempts отображает страницу профиля с сообщением об исчерпанных попытках
+// и заголовком Retry-After.
+func renderTooManyAttempts(w http.ResponseWriter, r *http.Request, permanentId string, retryAfter int64) {
+	w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	renderProfile(w, r, permanentId, "tooManyAttempts", retryAfter, http.StatusTooManyRequests)
+}
@@ -0,0 +1,71 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл тестирует ограничение неудачных попыток подтверждения.
+package auth
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFailedAttempts проверяет учет неудачных попыток.
+// Ожидается: попытки считаются за окно FAILED_ATTEMPTS_WINDOW, при исчерпании возвращается
+// время до освобождения самой ранней попытки; попытка, достигшая лимита, сообщает об исчерпании.
+func TestFailedAttempts(t *testing.T) {
+	t.Setenv("FAILED_ATTEMPTS_MAX", "3")
+	t.Setenv("FAILED_ATTEMPTS_WINDOW", "600")
+
+	oldGetFailedAttemptsFromDb := data.GetFailedAttemptsFromDb
+	oldSetFailedAttemptInDb := data.SetFailedAttemptInDb
+	defer func() {
+		data.GetFailedAttemptsFromDb = oldGetFailedAttemptsFromDb
+		data.SetFailedAttemptInDb = oldSetFailedAttemptInDb
+	}()
+
+	now := int64(100_000)
+	var attempts []int64
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+		assert.Equal(t, "permanent-123", permanentId)
+		assert.Equal(t, data.FailedAttemptCurrentPassword, kind)
+		count, firstAt := 0, int64(0)
+		for _, attemptedAt := range attempts {
+			if attemptedAt > since {
+				if count == 0 {
+					firstAt = attemptedAt
+				}
+				count++
+			}
+		}
+		return count, firstAt, nil
+	}
+	data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error {
+		attempts = append(attempts, attemptedAt)
+		return nil
+	}
+
+	for _, attemptedAt := range []int64{now - 700, now - 200, now - 100} {
+		exhausted, err := recordFailedAttempt("permanent-123", data.FailedAttemptCurrentPassword, attemptedAt)
+		assert.NoError(t, err)
+		assert.False(t, exhausted)
+	}
+	retryAfter, err := failedAttemptsRetryAfter("permanent-123", data.FailedAttemptCurrentPassword, now)
+	assert.NoError(t, err)
+	assert.Zero(t, retryAfter)
+
+	exhausted, err := recordFailedAttempt("permanent-123", data.FailedAttemptCurrentPassword, now)
+	assert.NoError(t, err)
+	assert.True(t, exhausted)
+	retryAfter, err = failedAttemptsRetryAfter("permanent-123", data.FailedAttemptCurrentPassword, now)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(400), retryAfter)
+
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+		return 0, 0, errors.WithStack(sql.ErrConnDone)
+	}
+	_, err = failedAttemptsRetryAfter("permanent-123", data.FailedAttemptCurrentPassword, now)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+}
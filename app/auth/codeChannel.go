@@ -0,0 +1,131 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит выбор способа доставки кодов подтверждения:
+//   - codeRecipient: адрес, на который отправляется код пользователю
+//   - sendServerAuthCode: отправляет код на email или в SMS
+//   - signUpPhone: проверяет номер телефона, выбранный для получения кода при регистрации
+//   - confirmSignUpPhone: после подтверждения номера отправляет код для проверки email
+//   - secondFactorCodeChannel: способ доставки кода подтверждения входа, выбранный пользователем
+//   - altCodeChannel: способ доставки, на который можно переключить подтверждение входа
+//
+// Код отправляется в SMS, если пользователь выбрал этот способ (consts.CodeChannelSMS)
+// и отправка SMS настроена (tools.SMSEnabled), иначе - на email.
+// Код из SMS подтверждает только номер телефона, поэтому при регистрации с SMS
+// email все равно подтверждается отдельным кодом.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// codeRecipient возвращает адрес, на который отправляется код пользователю:
+// номер телефона для SMS, иначе email.
+//
+// По этому адресу учитываются отправки кодов (см. reserveServerAuthCodeSend).
+func codeRecipient(user structs.User) string {
+	if user.CodeChannel == consts.CodeChannelSMS {
+		return user.Phone
+	}
+	return user.Email
+}
+
+// sendServerAuthCode отправляет код подтверждения на язык locale по способу user.CodeChannel.
+//
+// Возвращает отправленный код.
+func sendServerAuthCode(locale string, user structs.User) (string, error) {
+	if user.CodeChannel == consts.CodeChannelSMS {
+		serverCode, err := tools.ServerAuthCodeSMSSend(locale, user.Phone)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return serverCode, nil
+	}
+
+	serverCode, err := tools.ServerAuthCodeSend(locale, user.Email)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return serverCode, nil
+}
+
+// signUpPhone проверяет номер телефона, на который пользователь хочет получить код при регистрации.
+//
+// Возвращает номер в формате E.164 или ключ сообщения, если отправка SMS не настроена,
+// номер некорректен или уже подтвержден другим пользователем.
+func signUpPhone(phone string) (string, string, error) {
+	if !tools.SMSEnabled() {
+		return "", "smsUnavailable", nil
+	}
+
+	normalized, err := tools.PhoneNormalize(phone)
+	if err != nil {
+		return "", "phoneInvalid", nil
+	}
+
+	if _, err := data.GetPermanentIdFromDbByPhone(normalized); err == nil {
+		return "", "phoneAlreadyExist", nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return "", "", errors.WithStack(err)
+	}
+	return normalized, "", nil
+}
+
+// confirmSignUpPhone отмечает номер телефона подтвержденным после проверки кода из SMS
+// и отправляет код на email регистрации.
+//
+// Без этого кода email не подтвержден: по номеру телефона нельзя зарегистрировать чужой
+// адрес в обход приглашения и списка разрешенных доменов. Пауза и счетчик отправок
+// сессии начинаются заново, квоты адреса получателя считаются уже для email.
+func confirmSignUpPhone(w http.ResponseWriter, r *http.Request, user structs.User) {
+	user.PhoneVerified = true
+	user.CodeChannel = consts.CodeChannelEmail
+	user.ServerCode = ""
+	user.ServerCodeSendedConter = 0
+	user.ServerCodeSendedAt = 0
+	if err := data.SetAuthDataInSession(w, r, user); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	ServerAuthCodeSend(w, r)
+}
+
+// secondFactorCodeChannel возвращает способ доставки кода подтверждения входа.
+//
+// requested - способ, выбранный пользователем на странице ввода кода. SMS выбирается,
+// только если у аккаунта есть подтвержденный номер и отправка SMS настроена;
+// если способ не выбран или недоступен, остается текущий.
+func secondFactorCodeChannel(user structs.User, requested string) string {
+	switch requested {
+	case consts.CodeChannelSMS:
+		if user.Phone != "" && tools.SMSEnabled() {
+			return consts.CodeChannelSMS
+		}
+	case consts.CodeChannelEmail:
+		return consts.CodeChannelEmail
+	}
+	return user.CodeChannel
+}
+
+// altCodeChannel возвращает способ доставки, на который можно переключить подтверждение входа:
+// SMS, если код отправлен на email, а у аккаунта есть подтвержденный номер, и email,
+// если код отправлен в SMS.
+//
+// При регистрации способ не переключается: возвращает пустую строку.
+func altCodeChannel(user structs.User) string {
+	if !user.SecondFactor || user.Phone == "" || !tools.SMSEnabled() {
+		return ""
+	}
+	if user.CodeChannel == consts.CodeChannelSMS {
+		return consts.CodeChannelEmail
+	}
+	return consts.CodeChannelSMS
+}
@@ -0,0 +1,126 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует выбор способа доставки кодов подтверждения.
+package auth
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSendServerAuthCode проверяет отправку кода выбранным способом.
+// Ожидается: SMS на номер для consts.CodeChannelSMS, иначе письмо на email.
+func TestSendServerAuthCode(t *testing.T) {
+	originalServerAuthCodeSend := tools.ServerAuthCodeSend
+	originalServerAuthCodeSMSSend := tools.ServerAuthCodeSMSSend
+	defer func() {
+		tools.ServerAuthCodeSend = originalServerAuthCodeSend
+		tools.ServerAuthCodeSMSSend = originalServerAuthCodeSMSSend
+	}()
+
+	var sentTo string
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		sentTo = email
+		return "1111", nil
+	}
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		sentTo = phone
+		return "2222", nil
+	}
+
+	emailUser := structs.User{Email: "test@example.com", Phone: "+79991234567"}
+	code, err := sendServerAuthCode(i18n.En, emailUser)
+	require.NoError(t, err)
+	assert.Equal(t, "1111", code)
+	assert.Equal(t, "test@example.com", sentTo)
+	assert.Equal(t, "test@example.com", codeRecipient(emailUser))
+
+	smsUser := structs.User{Email: "test@example.com", Phone: "+79991234567", CodeChannel: consts.CodeChannelSMS}
+	code, err = sendServerAuthCode(i18n.En, smsUser)
+	require.NoError(t, err)
+	assert.Equal(t, "2222", code)
+	assert.Equal(t, "+79991234567", sentTo)
+	assert.Equal(t, "+79991234567", codeRecipient(smsUser))
+
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) { return "", errors.New("gateway error") }
+	_, err = sendServerAuthCode(i18n.En, smsUser)
+	assert.Error(t, err)
+}
+
+// TestSignUpPhone проверяет номер, выбранный для получения кода при регистрации.
+// Ожидается: номер в формате E.164 или ключ сообщения; ошибка БД возвращается.
+func TestSignUpPhone(t *testing.T) {
+	originalGetPermanentIdFromDbByPhone := data.GetPermanentIdFromDbByPhone
+	defer func() { data.GetPermanentIdFromDbByPhone = originalGetPermanentIdFromDbByPhone }()
+
+	data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) {
+		switch phone {
+		case "+79997654321":
+			return "perm456", nil
+		case "+79990000000":
+			return "", sql.ErrConnDone
+		}
+		return "", errors.WithStack(sql.ErrNoRows)
+	}
+
+	tests := []struct {
+		name      string
+		smsDriver string
+		phone     string
+		want      string
+		msgKey    string
+		wantErr   bool
+	}{
+		{"sms not configured", "", "+79991234567", "", "smsUnavailable", false},
+		{"invalid", "log", "8 (999)", "", "phoneInvalid", false},
+		{"valid", "log", "00 7 999 123-45-67", "+79991234567", "", false},
+		{"taken", "log", "+79997654321", "", "phoneAlreadyExist", false},
+		{"db error", "log", "+79990000000", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SMS_DRIVER", tt.smsDriver)
+
+			phone, msgKey, err := signUpPhone(tt.phone)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, phone)
+			assert.Equal(t, tt.msgKey, msgKey)
+		})
+	}
+}
+
+// TestSecondFactorCodeChannel проверяет выбор способа доставки кода подтверждения входа.
+// Ожидается: SMS только при подтвержденном номере и настроенной отправке SMS,
+// email по запросу, без запроса или при недоступном SMS - текущий способ.
+func TestSecondFactorCodeChannel(t *testing.T) {
+	withPhone := structs.User{Phone: "+79991234567", SecondFactor: true}
+	smsUser := structs.User{Phone: "+79991234567", SecondFactor: true, CodeChannel: consts.CodeChannelSMS}
+
+	t.Setenv("SMS_DRIVER", "log")
+	assert.Equal(t, consts.CodeChannelSMS, secondFactorCodeChannel(withPhone, consts.CodeChannelSMS))
+	assert.Equal(t, "", secondFactorCodeChannel(structs.User{SecondFactor: true}, consts.CodeChannelSMS))
+	assert.Equal(t, consts.CodeChannelEmail, secondFactorCodeChannel(smsUser, consts.CodeChannelEmail))
+	assert.Equal(t, consts.CodeChannelSMS, secondFactorCodeChannel(smsUser, ""))
+	assert.Equal(t, consts.CodeChannelEmail, altCodeChannel(smsUser))
+	assert.Equal(t, consts.CodeChannelSMS, altCodeChannel(withPhone))
+	assert.Equal(t, "", altCodeChannel(structs.User{SecondFactor: true}))
+	assert.Equal(t, "", altCodeChannel(structs.User{Phone: "+79991234567"}), "при регистрации способ не переключается")
+
+	t.Setenv("SMS_DRIVER", "")
+	assert.Equal(t, "", secondFactorCodeChannel(withPhone, consts.CodeChannelSMS))
+	assert.Equal(t, "", altCodeChannel(withPhone))
+}
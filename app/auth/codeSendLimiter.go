@@ -0,0 +1,110 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит серверные ограничения на отправку кодов аутентификации:
+//   - loadCodeSendLimits: загружает лимиты из переменных окружения
+//   - reserveServerAuthCodeSend: проверяет паузу между отправками и квоты и фиксирует отправку
+//
+// Ограничения действуют одновременно для сессии и для адреса получателя (email
+// или номера телефона, см. codeRecipient), поэтому повторная регистрация
+// или новая сессия не позволяют обойти паузу.
+package auth
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// codeSendLimits описывает ограничения на отправку кодов аутентификации.
+type codeSendLimits struct {
+	cooldown   int64
+	perSession int
+	perHour    int
+	perDay     int
+}
+
+// loadCodeSendLimits загружает лимиты отправки кодов.
+//
+// Использует переменные окружения:
+//   - SERVER_CODE_RESEND_COOLDOWN: пауза между отправками в секундах (по умолчанию 60)
+//   - SERVER_CODE_MAX_SENDS_PER_SESSION: максимум отправок в одной сессии (по умолчанию 3)
+//   - SERVER_CODE_MAX_SENDS_PER_HOUR: максимум отправок на email или телефон за час (по умолчанию 5)
+//   - SERVER_CODE_MAX_SENDS_PER_DAY: максимум отправок на email или телефон за сутки (по умолчанию 20)
+//
+// Некорректные или неположительные значения заменяются значениями по умолчанию.
+func loadCodeSendLimits() codeSendLimits {
+	return codeSendLimits{
+		cooldown:   int64(envPositiveInt("SERVER_CODE_RESEND_COOLDOWN", 60)),
+		perSession: envPositiveInt("SERVER_CODE_MAX_SENDS_PER_SESSION", 3),
+		perHour:    envPositiveInt("SERVER_CODE_MAX_SENDS_PER_HOUR", 5),
+		perDay:     envPositiveInt("SERVER_CODE_MAX_SENDS_PER_DAY", 20),
+	}
+}
+
+// envPositiveInt читает положительное целое из переменной окружения.
+//
+// Возвращает defaultValue, если переменная не задана или некорректна.
+func envPositiveInt(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || value <= 0 {
+		return defaultValue
+	}
+	return value
+}
+
+// reserveServerAuthCodeSend проверяет, можно ли отправить код пользователю, и фиксирует отправку.
+//
+// Последовательно проверяет:
+//   - паузу с момента последней отправки в текущей сессии
+//   - количество отправок в текущей сессии
+//   - паузу с момента последней отправки на адрес получателя
+//   - количество отправок на адрес получателя за час и за сутки
+//
+// Проверка квот адреса и запись об отправке выполняются в одной транзакции
+// (data.ReserveServerAuthCodeSendInDb), поэтому одновременные запросы не превышают лимиты.
+// Отправка фиксируется до самой отправки кода и учитывается, даже если она не удалась.
+//
+// Возвращает ключ сообщения для пользователя и время ожидания в секундах,
+// если отправка запрещена. Пустой ключ означает, что отправка разрешена и учтена.
+// При исчерпании лимита сессии время ожидания равно 0: нужно начать регистрацию заново.
+var reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) {
+	limits := loadCodeSendLimits()
+
+	if wait := user.ServerCodeSendedAt + limits.cooldown - now; user.ServerCodeSendedAt > 0 && wait > 0 {
+		return "serverCodeSendCooldown", wait, nil
+	}
+	if user.ServerCodeSendedConter >= limits.perSession {
+		return "serverCodeSendSessionLimit", 0, nil
+	}
+
+	msgKey, wait, err := data.ReserveServerAuthCodeSendInDb(codeRecipient(user), now, func(stats structs.ServerAuthCodeSendStats) (string, int64) {
+		return codeSendQuotaMsgKey(limits, stats, now)
+	})
+	if err != nil {
+		// Одновременно на тот же адрес уже отправлен код
+		if errors.Is(err, data.ErrServerAuthCodeSendConcurrent) {
+			return "serverCodeSendCooldown", limits.cooldown, nil
+		}
+		return "", 0, errors.WithStack(err)
+	}
+	return msgKey, wait, nil
+}
+
+// codeSendQuotaMsgKey проверяет паузу и квоты адреса получателя по статистике отправок.
+//
+// Возвращает ключ сообщения и время ожидания в секундах или пустой ключ, если отправка разрешена.
+func codeSendQuotaMsgKey(limits codeSendLimits, stats structs.ServerAuthCodeSendStats, now int64) (string, int64) {
+	if wait := stats.LastSentAt + limits.cooldown - now; stats.LastSentAt > 0 && wait > 0 {
+		return "serverCodeSendCooldown", wait
+	}
+	if stats.LastDay >= limits.perDay {
+		return "serverCodeSendQuotaExceeded", stats.FirstInLastDayAt + 24*60*60 - now
+	}
+	if stats.LastHour >= limits.perHour {
+		return "serverCodeSendQuotaExceeded", stats.FirstInLastHourAt + 60*60 - now
+	}
+	return "", 0
+}
@@ -0,0 +1,132 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует серверные ограничения на отправку кодов аутентификации.
+package auth
+
+import (
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestLoadCodeSendLimits проверяет загрузку лимитов из окружения.
+// Ожидается: значения по умолчанию при отсутствии или некорректности переменных.
+func TestLoadCodeSendLimits(t *testing.T) {
+	t.Setenv("SERVER_CODE_RESEND_COOLDOWN", "")
+	t.Setenv("SERVER_CODE_MAX_SENDS_PER_SESSION", "abc")
+	t.Setenv("SERVER_CODE_MAX_SENDS_PER_HOUR", "-1")
+	t.Setenv("SERVER_CODE_MAX_SENDS_PER_DAY", "50")
+
+	limits := loadCodeSendLimits()
+
+	assert.Equal(t, int64(60), limits.cooldown)
+	assert.Equal(t, 3, limits.perSession)
+	assert.Equal(t, 5, limits.perHour)
+	assert.Equal(t, 50, limits.perDay)
+}
+
+// TestReserveServerAuthCodeSend проверяет паузу между отправками и квоты.
+// Ожидается: корректный ключ сообщения и время ожидания для каждого ограничения;
+// при ограничении сессии БД не запрашивается, одновременная отправка на тот же адрес
+// считается паузой.
+func TestReserveServerAuthCodeSend(t *testing.T) {
+	oldReserve := data.ReserveServerAuthCodeSendInDb
+	defer func() { data.ReserveServerAuthCodeSendInDb = oldReserve }()
+
+	now := int64(1_000_000)
+	tests := []struct {
+		name     string
+		user     structs.User
+		stats    structs.ServerAuthCodeSendStats
+		statsErr error
+		wantKey  string
+		wantWait int64
+		wantErr  bool
+	}{
+		{
+			name:    "first send allowed",
+			user:    structs.User{Email: "a@example.com"},
+			wantKey: "",
+		},
+		{
+			name:     "session cooldown",
+			user:     structs.User{Email: "a@example.com", ServerCodeSendedConter: 1, ServerCodeSendedAt: now - 20},
+			wantKey:  "serverCodeSendCooldown",
+			wantWait: 40,
+		},
+		{
+			name:    "session limit",
+			user:    structs.User{Email: "a@example.com", ServerCodeSendedConter: 3, ServerCodeSendedAt: now - 120},
+			wantKey: "serverCodeSendSessionLimit",
+		},
+		{
+			name:     "email cooldown from another session",
+			user:     structs.User{Email: "a@example.com"},
+			stats:    structs.ServerAuthCodeSendStats{LastHour: 1, LastDay: 1, LastSentAt: now - 15, FirstInLastHourAt: now - 15, FirstInLastDayAt: now - 15},
+			wantKey:  "serverCodeSendCooldown",
+			wantWait: 45,
+		},
+		{
+			name:     "hourly quota",
+			user:     structs.User{Email: "a@example.com"},
+			stats:    structs.ServerAuthCodeSendStats{LastHour: 5, LastDay: 7, LastSentAt: now - 300, FirstInLastHourAt: now - 3000, FirstInLastDayAt: now - 7000},
+			wantKey:  "serverCodeSendQuotaExceeded",
+			wantWait: 600,
+		},
+		{
+			name:     "daily quota",
+			user:     structs.User{Email: "a@example.com"},
+			stats:    structs.ServerAuthCodeSendStats{LastHour: 1, LastDay: 20, LastSentAt: now - 300, FirstInLastHourAt: now - 300, FirstInLastDayAt: now - 80000},
+			wantKey:  "serverCodeSendQuotaExceeded",
+			wantWait: 6400,
+		},
+		{
+			name:     "phone quota",
+			user:     structs.User{Email: "a@example.com", Phone: "+79991234567", CodeChannel: consts.CodeChannelSMS},
+			stats:    structs.ServerAuthCodeSendStats{LastHour: 5, LastDay: 5, LastSentAt: now - 300, FirstInLastHourAt: now - 3000, FirstInLastDayAt: now - 3000},
+			wantKey:  "serverCodeSendQuotaExceeded",
+			wantWait: 600,
+		},
+		{
+			name:     "concurrent send",
+			user:     structs.User{Email: "a@example.com"},
+			statsErr: errors.WithStack(data.ErrServerAuthCodeSendConcurrent),
+			wantKey:  "serverCodeSendCooldown",
+			wantWait: 60,
+		},
+		{
+			name:     "database error",
+			user:     structs.User{Email: "a@example.com"},
+			statsErr: errors.New("db error"),
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data.ReserveServerAuthCodeSendInDb = func(email string, n int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+				assert.NotEqual(t, "serverCodeSendSessionLimit", tt.wantKey, "db should not be queried")
+				assert.Equal(t, codeRecipient(tt.user), email)
+				assert.Equal(t, now, n)
+				if tt.statsErr != nil {
+					return "", 0, tt.statsErr
+				}
+				key, wait := check(tt.stats)
+				return key, wait, nil
+			}
+
+			key, wait, err := reserveServerAuthCodeSend(tt.user, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantKey, key)
+			assert.Equal(t, tt.wantWait, wait)
+		})
+	}
+}
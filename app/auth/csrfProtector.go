@@ -0,0 +1,93 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит защиту от CSRF:
+//   - CSRFProtector: middleware, выдающий и проверяющий CSRF токен сессии
+//   - generateCSRFToken: генерирует случайный CSRF токен
+//
+// Токен хранится в отдельной сессии csrfStore и передается в формы через
+// скрытое поле csrfToken. JSON клиенты могут передавать его в заголовке
+// X-CSRF-Token, значение которого сервер возвращает в ответах на безопасные запросы.
+// Отписка по ссылке из письма (consts.UnsubscribeURL) не проверяется: почтовые сервисы
+// отправляют ее без сессии (RFC 8058), а запрос подтверждается подписанным токеном ссылки.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/pkg/errors"
+)
+
+// generateCSRFToken генерирует случайный CSRF токен длиной 32 байта в base64url.
+var generateCSRFToken = func() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// isSafeMethod проверяет, что HTTP метод не изменяет состояние.
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// CSRFProtector защищает изменяющие состояние запросы от CSRF.
+// Для безопасных методов выдает токен сессии (создает его при отсутствии),
+// кладет его в контекст запроса для шаблонов и в заголовок X-CSRF-Token ответа.
+// Для остальных методов сравнивает токен из заголовка X-CSRF-Token или поля формы csrfToken
+// с токеном сессии - при отсутствии или несовпадении отображает страницу 403.
+// При ошибках сохранения сессии перенаправляет на страницу 500.
+func CSRFProtector(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == consts.UnsubscribeURL && !isSafeMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := data.GetCSRFTokenFromSession(r)
+		if err != nil {
+			if !isSafeMethod(r.Method) {
+				tmpls.Err403(w, r)
+				return
+			}
+
+			token, err = generateCSRFToken()
+			if err != nil {
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+
+			if err := data.SetCSRFTokenInSession(w, r, token); err != nil {
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+		}
+
+		if !isSafeMethod(r.Method) {
+			submittedToken := r.Header.Get(consts.CSRFTokenHeader)
+			if submittedToken == "" {
+				submittedToken = r.PostFormValue(consts.CSRFTokenFormField)
+			}
+			if subtle.ConstantTimeCompare([]byte(submittedToken), []byte(token)) != 1 {
+				tmpls.Err403(w, r)
+				return
+			}
+		}
+
+		w.Header().Set(consts.CSRFTokenHeader, token)
+		ctx := context.WithValue(r.Context(), consts.CSRFTokenCtxKey, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
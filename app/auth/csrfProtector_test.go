@@ -0,0 +1,107 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует CSRF защиту: выдачу токена и проверку POST запросов.
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// issueCSRFToken выполняет GET запрос через CSRFProtector и возвращает токен и cookie сессии.
+func issueCSRFToken(t *testing.T) (string, []*http.Cookie) {
+	w := httptest.NewRecorder()
+	CSRFProtector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NotEmpty(t, tmpls.CSRFToken(r))
+	})).ServeHTTP(w, httptest.NewRequest("GET", consts.SignUpURL, nil))
+
+	token := w.Header().Get(consts.CSRFTokenHeader)
+	require.NotEmpty(t, token)
+	return token, w.Result().Cookies()
+}
+
+// TestCSRFProtector проверяет выдачу и проверку CSRF токена.
+// Ожидается: POST с токеном в поле формы или заголовке проходит, без токена или с чужим токеном - 403.
+func TestCSRFProtector(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "test-auth-key-32-bytes-long!!")
+	os.Setenv("CAPTCHA_STORE_SESSION_SECRET_KEY", "test-captcha-secret-32-bytes!!")
+	data.InitStore()
+
+	token, cookies := issueCSRFToken(t)
+
+	tests := []struct {
+		name           string
+		formToken      string
+		headerToken    string
+		withCookies    bool
+		expectedStatus int
+	}{
+		{"form field", token, "", true, http.StatusOK},
+		{"header", "", token, true, http.StatusOK},
+		{"missing token", "", "", true, http.StatusForbidden},
+		{"wrong token", "wrong-token", "", true, http.StatusForbidden},
+		{"no session", token, "", false, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+			if tt.formToken != "" {
+				form.Set(consts.CSRFTokenFormField, tt.formToken)
+			}
+			req := httptest.NewRequest("POST", "/set-new-password", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.headerToken != "" {
+				req.Header.Set(consts.CSRFTokenHeader, tt.headerToken)
+			}
+			if tt.withCookies {
+				for _, cookie := range cookies {
+					req.AddCookie(cookie)
+				}
+			}
+			w := httptest.NewRecorder()
+
+			called := false
+			CSRFProtector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				assert.Equal(t, token, tmpls.CSRFToken(r))
+			})).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedStatus == http.StatusOK, called)
+			if tt.expectedStatus == http.StatusForbidden {
+				assert.Contains(t, w.Body.String(), i18n.Text(i18n.En, "csrfTokenInvalid"))
+			}
+		})
+	}
+}
+
+// TestCSRFProtector_ReusesSessionToken проверяет, что токен сессии не меняется между запросами.
+// Ожидается: повторный GET с cookie сессии возвращает тот же токен без новой cookie.
+func TestCSRFProtector_ReusesSessionToken(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "test-auth-key-32-bytes-long!!")
+	data.InitStore()
+
+	token, cookies := issueCSRFToken(t)
+
+	req := httptest.NewRequest("GET", consts.HomeURL, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	CSRFProtector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, req)
+
+	assert.Equal(t, token, w.Header().Get(consts.CSRFTokenHeader))
+	assert.Empty(t, w.Result().Cookies())
+}
@@ -0,0 +1,77 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит публикацию открытых ключей JWT и выдачу access токенов:
+//   - JWKS: отдает набор открытых ключей в формате JWK Set
+//   - AccessToken: выдает вошедшему пользователю access токен для сторонних сервисов
+//
+// Сторонний сервис проверяет access токен без общего секрета: выбирает открытый ключ
+// из JWKS по kid из заголовка токена и проверяет claim purpose = "access".
+package auth
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// JWKS отдает открытые ключи RS256 и EdDSA для проверки токенов сторонними сервисами.
+// Ключи HS256 не публикуются, при их использовании набор пуст.
+// Ответ кешируется клиентами на 5 минут, поэтому новый ключ нужно добавлять
+// активным заранее, до назначения основным.
+// При ошибке загрузки ключей возвращает статус 500.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := keyring.JWKS()
+	if err != nil {
+		log.Printf("%+v", errors.WithStack(err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(jwks); err != nil {
+		log.Printf("%+v", errors.WithStack(err))
+	}
+}
+
+// AccessToken выдает вошедшему пользователю access токен на tools.AccessTokenExp секунд.
+//
+// Подключается после AuthGuardForHomePath. Отдает JSON с токеном, типом Bearer и сроком
+// действия в секундах; ответ не кешируется. При ошибках перенаправляет на страницу 500.
+func AccessToken(w http.ResponseWriter, r *http.Request) {
+	cookie, err := data.GetTemporaryIdFromCookies(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	permanentId, _, err := data.GetTemporaryIdKeysFromDb(cookie.Value)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	accessToken, err := tools.GenerateAccessToken(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(structs.AccessTokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   tools.AccessTokenExp,
+	}); err != nil {
+		log.Printf("%+v", errors.WithStack(err))
+	}
+}
@@ -0,0 +1,134 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует публикацию открытых ключей JWT и выдачу access токенов.
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestJWKS проверяет ответ с набором открытых ключей.
+// Ожидается: JSON с ключами и заголовком кеширования.
+func TestJWKS(t *testing.T) {
+	originalJWKS := keyring.JWKS
+	defer func() { keyring.JWKS = originalJWKS }()
+
+	keyring.JWKS = func() (structs.JWKS, error) {
+		return structs.JWKS{Keys: []structs.JWK{{Kty: "OKP", Kid: "kid-1", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: "x"}}}, nil
+	}
+
+	w := httptest.NewRecorder()
+	JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=300", w.Header().Get("Cache-Control"))
+
+	var jwks structs.JWKS
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &jwks))
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "kid-1", jwks.Keys[0].Kid)
+	assert.NotContains(t, w.Body.String(), `"n"`)
+}
+
+// TestJWKS_Error проверяет ответ при ошибке загрузки ключей.
+// Ожидается: статус 500.
+func TestJWKS_Error(t *testing.T) {
+	originalJWKS := keyring.JWKS
+	defer func() { keyring.JWKS = originalJWKS }()
+
+	keyring.JWKS = func() (structs.JWKS, error) {
+		return structs.JWKS{}, errors.New("keyring error")
+	}
+
+	w := httptest.NewRecorder()
+	JWKS(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+// setupAccessTokenTest подменяет БД на sqlmock и восстанавливает ее и генерацию access токена после теста.
+func setupAccessTokenTest(t *testing.T) (sqlmock.Sqlmock, func()) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	oldDB := data.Db
+	oldGenerateAccessToken := tools.GenerateAccessToken
+	data.Db = db
+
+	return mock, func() {
+		data.Db = oldDB
+		tools.GenerateAccessToken = oldGenerateAccessToken
+		db.Close()
+	}
+}
+
+// TestAccessToken проверяет выдачу access токена вошедшему пользователю.
+// Ожидается: JSON с токеном для permanentId из сессии, типом Bearer и сроком действия, без кеширования.
+func TestAccessToken(t *testing.T) {
+	mock, teardown := setupAccessTokenTest(t)
+	defer teardown()
+
+	var issuedFor string
+	tools.GenerateAccessToken = func(permanentId string) (string, error) {
+		issuedFor = permanentId
+		return "access-token", nil
+	}
+
+	mock.ExpectQuery(data.TemporaryIdSelectQuery).
+		WithArgs("temp-id").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "userAgent"}).AddRow("perm123", "test-agent"))
+
+	req := httptest.NewRequest("GET", "/token", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	AccessToken(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "perm123", issuedFor)
+
+	var response structs.AccessTokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "access-token", response.AccessToken)
+	assert.Equal(t, "Bearer", response.TokenType)
+	assert.Equal(t, tools.AccessTokenExp, response.ExpiresIn)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAccessToken_Error проверяет ошибку генерации access токена.
+// Ожидается: редирект на страницу 500.
+func TestAccessToken_Error(t *testing.T) {
+	mock, teardown := setupAccessTokenTest(t)
+	defer teardown()
+
+	tools.GenerateAccessToken = func(permanentId string) (string, error) {
+		return "", errors.New("keyring error")
+	}
+
+	mock.ExpectQuery(data.TemporaryIdSelectQuery).
+		WithArgs("temp-id").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "userAgent"}).AddRow("perm123", "test-agent"))
+
+	req := httptest.NewRequest("GET", "/token", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	AccessToken(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Contains(t, w.Header().Get("Location"), "/500")
+}
@@ -0,0 +1,79 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит выбор языка пользователя:
+//   - ChangeLocale: сохраняет язык, выбранный в профиле
+//   - applyUserLocale: переносит язык из профиля в cookie при входе
+//   - userLocale: возвращает язык писем пользователя
+//
+// Язык из профиля хранится в таблице user_locale; язык текущего запроса
+// выбирает i18n.Middleware.
+package auth
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+)
+
+// ChangeLocale сохраняет язык интерфейса и писем, выбранный в профиле.
+//
+// Принимает поле формы locale с одним из языков i18n.Locales. Язык сохраняется
+// в профиле и в cookie, чтобы следующая страница открылась на нем.
+// При успехе перенаправляет на страницу профиля с сообщением.
+func ChangeLocale(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	locale, ok := i18n.Match(r.FormValue("locale"))
+	if !ok {
+		renderProfile(w, r, permanentId, "localeInvalid", 0, http.StatusOK)
+		return
+	}
+
+	if err := data.SetUserLocaleInDb(permanentId, locale); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	data.SetLocaleInCookies(w, locale)
+
+	redirectToProfile(w, r, "localeChanged")
+}
+
+// applyUserLocale устанавливает cookie с языком из профиля пользователя.
+//
+// Вызывается при входе, чтобы язык, выбранный на другом устройстве, действовал и здесь.
+// Если язык не выбран, cookie не меняется; ошибка чтения только логируется:
+// вход не должен срываться из-за языка.
+func applyUserLocale(w http.ResponseWriter, permanentId string) {
+	locale, err := data.GetUserLocaleFromDb(permanentId)
+	if err != nil {
+		log.Printf("%+v", err)
+		return
+	}
+	if locale != "" {
+		data.SetLocaleInCookies(w, locale)
+	}
+}
+
+// userLocale возвращает язык писем пользователя.
+//
+// Используется для писем, отправляемых не из запроса самого пользователя
+// (по действию администратора или при входе с чужого устройства): берется язык
+// из профиля, а если он не выбран - язык по умолчанию.
+func userLocale(permanentId string) string {
+	locale, err := data.GetUserLocaleFromDb(permanentId)
+	if err != nil {
+		log.Printf("%+v", err)
+	}
+	if matched, ok := i18n.Match(locale); ok {
+		return matched
+	}
+	return i18n.DefaultLocale()
+}
@@ -0,0 +1,165 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует выбор языка пользователя.
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupLocaleTest сохраняет подменяемые функции языка пользователя.
+// Возвращает функцию восстановления.
+func setupLocaleTest() func() {
+	oldGetUserLocaleFromDb := data.GetUserLocaleFromDb
+	oldSetUserLocaleInDb := data.SetUserLocaleInDb
+
+	return func() {
+		data.GetUserLocaleFromDb = oldGetUserLocaleFromDb
+		data.SetUserLocaleInDb = oldSetUserLocaleInDb
+	}
+}
+
+// TestChangeLocale_Success проверяет сохранение языка из профиля.
+// Ожидается: язык сохранен в БД и cookie, редирект на профиль с сообщением.
+func TestChangeLocale_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupLocaleTest()()
+
+	var savedPermanentId, savedLocale string
+	data.SetUserLocaleInDb = func(permanentId, locale string) error {
+		savedPermanentId, savedLocale = permanentId, locale
+		return nil
+	}
+
+	expectProfileUser(mock)
+
+	w := httptest.NewRecorder()
+	ChangeLocale(w, profileRequest("/profile/locale", url.Values{"locale": {"ru-RU"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.ProfileURL+"?msg=localeChanged", w.Header().Get("Location"))
+	assert.Equal(t, "perm123", savedPermanentId)
+	assert.Equal(t, i18n.Ru, savedLocale)
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, i18n.Ru, cookies[0].Value)
+	}
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeLocale_Invalid проверяет отклонение неподдерживаемого языка.
+// Ожидается: страница профиля с сообщением, язык не сохраняется.
+func TestChangeLocale_Invalid(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupLocaleTest()()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.SetUserLocaleInDb = func(permanentId, locale string) error {
+		t.Error("locale should not be saved")
+		return nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeLocale(w, profileRequest("/profile/locale", url.Values{"locale": {"de"}}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, i18n.Text(i18n.En, "localeInvalid"), profile.Msg)
+	assert.Empty(t, w.Result().Cookies())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeLocale_DbError проверяет ошибку сохранения языка.
+// Ожидается: редирект на страницу 500, cookie не устанавливается.
+func TestChangeLocale_DbError(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupLocaleTest()()
+
+	data.SetUserLocaleInDb = func(permanentId, locale string) error { return errors.New("db error") }
+
+	expectProfileUser(mock)
+
+	w := httptest.NewRecorder()
+	ChangeLocale(w, profileRequest("/profile/locale", url.Values{"locale": {i18n.Ru}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.Err500URL, w.Header().Get("Location"))
+	assert.Empty(t, w.Result().Cookies())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestApplyUserLocale проверяет перенос языка из профиля в cookie при входе.
+// Ожидается: cookie устанавливается только для выбранного языка, ошибка БД не мешает входу.
+func TestApplyUserLocale(t *testing.T) {
+	defer setupLocaleTest()()
+
+	tests := []struct {
+		name       string
+		locale     string
+		err        error
+		wantCookie bool
+	}{
+		{name: "locale selected", locale: i18n.Ru, wantCookie: true},
+		{name: "locale not selected"},
+		{name: "db error", err: errors.New("db error")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data.GetUserLocaleFromDb = func(permanentId string) (string, error) { return tt.locale, tt.err }
+
+			w := httptest.NewRecorder()
+			applyUserLocale(w, "perm123")
+
+			cookies := w.Result().Cookies()
+			if !tt.wantCookie {
+				assert.Empty(t, cookies)
+				return
+			}
+			if assert.Len(t, cookies, 1) {
+				assert.Equal(t, tt.locale, cookies[0].Value)
+			}
+		})
+	}
+}
+
+// TestUserLocale проверяет язык писем пользователя.
+// Ожидается: язык из профиля, а если он не выбран, не поддерживается или не прочитан - язык по умолчанию.
+func TestUserLocale(t *testing.T) {
+	defer setupLocaleTest()()
+	t.Setenv("DEFAULT_LOCALE", i18n.En)
+
+	tests := []struct {
+		name   string
+		locale string
+		err    error
+		want   string
+	}{
+		{name: "locale selected", locale: i18n.Ru, want: i18n.Ru},
+		{name: "locale not selected", want: i18n.En},
+		{name: "unsupported locale", locale: "de", want: i18n.En},
+		{name: "db error", err: errors.New("db error"), want: i18n.En},
+	}
+
+	for _, tt := range tests {
+		data.GetUserLocaleFromDb = func(permanentId string) (string, error) { return tt.locale, tt.err }
+		assert.Equal(t, tt.want, userLocale("perm123"), tt.name)
+	}
+}
@@ -0,0 +1,285 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит настройки уведомлений пользователя:
+//   - NotificationSettings: отображает страницу настроек уведомлений
+//   - ChangeNotificationSettings: сохраняет настройки уведомлений
+//   - Unsubscribe: отключает уведомление по ссылке отписки из письма
+//   - notificationEnabled: проверяет, нужно ли отправлять уведомление пользователю
+//   - SendSecurityDigests: отправляет еженедельные сводки безопасности
+//
+// Уведомления о подозрительном входе и об изменениях аккаунта (смена пароля или email,
+// запрос сброса пароля, привязка способа входа, завершение сессий, блокировка)
+// критичны для безопасности: они отправляются всегда и на странице настроек не отключаются.
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// securityDigestPeriod - период еженедельной сводки безопасности в секундах.
+const securityDigestPeriod = 7 * 24 * 60 * 60
+
+// notificationSettings - виды уведомлений в порядке отображения со значениями по умолчанию.
+// Critical - уведомление отправляется всегда, настройка пользователя не учитывается.
+var notificationSettings = []structs.NotificationSetting{
+	{Name: data.NotificationNewDeviceLogin, Enabled: true},
+	{Name: data.NotificationSuspiciousLogin, Enabled: true, Critical: true},
+	{Name: data.NotificationPasswordChange, Enabled: true, Critical: true},
+	{Name: data.NotificationEmailChange, Enabled: true, Critical: true},
+	{Name: data.NotificationPasswordResetRequest, Enabled: true, Critical: true},
+	{Name: data.NotificationOAuthLink, Enabled: true, Critical: true},
+	{Name: data.NotificationSessionRevoke, Enabled: true, Critical: true},
+	{Name: data.NotificationAccountLock, Enabled: true, Critical: true},
+	{Name: data.NotificationSecurityDigest, Enabled: false},
+}
+
+// userNotificationSettings возвращает настройки уведомлений пользователя:
+// значения по умолчанию, замененные сохраненными для некритичных уведомлений.
+func userNotificationSettings(permanentId string) ([]structs.NotificationSetting, error) {
+	saved, err := data.GetNotificationSettingsFromDb(permanentId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	settings := make([]structs.NotificationSetting, 0, len(notificationSettings))
+	for _, setting := range notificationSettings {
+		if enabled, ok := saved[setting.Name]; ok && !setting.Critical {
+			setting.Enabled = enabled
+		}
+		settings = append(settings, setting)
+	}
+	return settings, nil
+}
+
+// notificationEnabled сообщает, нужно ли отправлять пользователю уведомление вида name.
+//
+// Критичные уведомления отправляются без обращения к БД. Ошибка чтения настроек
+// только логируется, и уведомление отправляется: пропустить предупреждение хуже,
+// чем отправить лишнее письмо.
+func notificationEnabled(permanentId, name string) bool {
+	for _, setting := range notificationSettings {
+		if setting.Name == name && setting.Critical {
+			return true
+		}
+	}
+
+	settings, err := userNotificationSettings(permanentId)
+	if err != nil {
+		log.Printf("%+v", err)
+		return true
+	}
+	for _, setting := range settings {
+		if setting.Name == name {
+			return setting.Enabled
+		}
+	}
+	return true
+}
+
+// NotificationSettings отображает страницу настроек уведомлений.
+//
+// Принимает параметр msg из URL query как ключ сообщения из каталога i18n.
+// При ошибках перенаправляет на страницу 500.
+func NotificationSettings(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	settings, err := userNotificationSettings(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	page := structs.NotificationSettingsPage{Settings: settings, CSRFToken: tmpls.CSRFToken(r)}
+	if msgKey := r.URL.Query().Get("msg"); i18n.Has(msgKey) {
+		page.Msg = i18n.Msg(r, msgKey)
+	}
+
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "notificationSettings", page); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// ChangeNotificationSettings сохраняет настройки уведомлений.
+//
+// Для каждого некритичного вида уведомления поле формы с его именем и значением true
+// включает уведомление, отсутствие поля - отключает. Настройки сохраняются в транзакции.
+// При успехе перенаправляет на страницу настроек с сообщением.
+func ChangeNotificationSettings(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	for _, setting := range notificationSettings {
+		if setting.Critical {
+			continue
+		}
+		if err := data.SetNotificationSettingInDbTx(tx, permanentId, setting.Name, r.FormValue(setting.Name) == "true"); err != nil {
+			tx.Rollback()
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	http.Redirect(w, r, consts.ProfileNotificationsURL+"?msg="+url.QueryEscape("notificationsSaved"), http.StatusFound)
+}
+
+// Unsubscribe отключает уведомление по ссылке отписки из заголовка List-Unsubscribe.
+//
+// Принимает token из URL query или формы: почтовые сервисы отправляют одношаговую
+// отписку (RFC 8058) POST запросом на ссылку из заголовка, пользователь - формой
+// со страницы подтверждения. Уведомление отключается для всех аккаунтов с email
+// из токена; критичные уведомления отключить нельзя. Если аккаунта с этим email
+// больше нет, отписка считается выполненной.
+// Перенаправляет на страницу входа с сообщением.
+func Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	claims, err := tools.UnsubscribeTokenValidate(r.FormValue("token"))
+	if err != nil || !notificationOptional(claims.Setting) {
+		http.Redirect(w, r, consts.SignInURL+"?msg=unsubscribeInvalid", http.StatusFound)
+		return
+	}
+
+	var permanentIds []string
+	for _, yauth := range []bool{false, true} {
+		permanentId, err := data.GetPermanentIdFromDbByEmail(claims.UnsubscribeEmail, yauth)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		permanentIds = append(permanentIds, permanentId)
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	for _, permanentId := range permanentIds {
+		if err := data.SetNotificationSettingInDbTx(tx, permanentId, claims.Setting, false); err != nil {
+			tx.Rollback()
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	http.Redirect(w, r, consts.SignInURL+"?msg=unsubscribed", http.StatusFound)
+}
+
+// notificationOptional сообщает, что уведомление вида name существует и пользователь может его отключить.
+func notificationOptional(name string) bool {
+	for _, setting := range notificationSettings {
+		if setting.Name == name {
+			return !setting.Critical
+		}
+	}
+	return false
+}
+
+// SendSecurityDigests отправляет еженедельную сводку безопасности пользователям,
+// которые ее включили и не получали сводку последние 7 дней.
+//
+// Сводка содержит входы и изменения профиля за 7 дней до now. Ошибка для одного
+// пользователя логируется и не мешает отправке остальным; такому пользователю
+// сводка будет отправлена при следующем вызове.
+// Возвращает число отправленных сводок.
+func SendSecurityDigests(now int64) (int, error) {
+	permanentIds, err := data.GetSecurityDigestRecipientsFromDb(now - securityDigestPeriod)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	sent := 0
+	for _, permanentId := range permanentIds {
+		if err := sendSecurityDigest(permanentId, now); err != nil {
+			log.Printf("%+v", err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// sendSecurityDigest формирует и отправляет сводку безопасности пользователю permanentId.
+func sendSecurityDigest(permanentId string, now int64) error {
+	account, err := data.GetAccountExportFromDb(permanentId, now)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	since := now - securityDigestPeriod
+	digest := structs.SecurityDigest{Since: since, SettingsLink: tmpls.PublicURL(consts.ProfileNotificationsURL)}
+	for _, session := range account.Sessions {
+		if session.CreatedAt > since {
+			digest.Sessions = append(digest.Sessions, session)
+		}
+	}
+	for _, change := range account.ProfileChanges {
+		if change.ChangedAt > since {
+			digest.ProfileChanges = append(digest.ProfileChanges, change)
+		}
+	}
+
+	if err := tools.SecurityDigestSend(userLocale(permanentId), email, digest); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetSecurityDigestSentInDb(permanentId, now); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
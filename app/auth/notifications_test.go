@@ -0,0 +1,313 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует настройки уведомлений пользователя и сводку безопасности.
+package auth
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupNotificationTest сохраняет подменяемые функции настроек уведомлений и сводки.
+// Возвращает функцию восстановления.
+func setupNotificationTest() func() {
+	oldGetNotificationSettingsFromDb := data.GetNotificationSettingsFromDb
+	oldSetNotificationSettingInDbTx := data.SetNotificationSettingInDbTx
+	oldGetSecurityDigestRecipientsFromDb := data.GetSecurityDigestRecipientsFromDb
+	oldSetSecurityDigestSentInDb := data.SetSecurityDigestSentInDb
+	oldGetAccountExportFromDb := data.GetAccountExportFromDb
+	oldGetUserLocaleFromDb := data.GetUserLocaleFromDb
+	oldSecurityDigestSend := tools.SecurityDigestSend
+	oldUnsubscribeTokenValidate := tools.UnsubscribeTokenValidate
+	oldGetPermanentIdFromDbByEmail := data.GetPermanentIdFromDbByEmail
+
+	return func() {
+		data.GetNotificationSettingsFromDb = oldGetNotificationSettingsFromDb
+		data.SetNotificationSettingInDbTx = oldSetNotificationSettingInDbTx
+		data.GetSecurityDigestRecipientsFromDb = oldGetSecurityDigestRecipientsFromDb
+		data.SetSecurityDigestSentInDb = oldSetSecurityDigestSentInDb
+		data.GetAccountExportFromDb = oldGetAccountExportFromDb
+		data.GetUserLocaleFromDb = oldGetUserLocaleFromDb
+		tools.SecurityDigestSend = oldSecurityDigestSend
+		tools.UnsubscribeTokenValidate = oldUnsubscribeTokenValidate
+		data.GetPermanentIdFromDbByEmail = oldGetPermanentIdFromDbByEmail
+	}
+}
+
+// TestNotificationEnabled проверяет выбор, отправлять ли уведомление.
+// Ожидается: критичные уведомления отправляются без чтения настроек, остальные -
+// по сохраненной настройке или значению по умолчанию, при ошибке БД - отправляются.
+func TestNotificationEnabled(t *testing.T) {
+	defer setupNotificationTest()()
+
+	tests := []struct {
+		name     string
+		setting  string
+		saved    map[string]bool
+		err      error
+		expected bool
+	}{
+		{name: "default on", setting: data.NotificationNewDeviceLogin, saved: map[string]bool{}, expected: true},
+		{name: "default off", setting: data.NotificationSecurityDigest, saved: map[string]bool{}, expected: false},
+		{name: "disabled", setting: data.NotificationNewDeviceLogin, saved: map[string]bool{data.NotificationNewDeviceLogin: false}, expected: false},
+		{name: "enabled", setting: data.NotificationSecurityDigest, saved: map[string]bool{data.NotificationSecurityDigest: true}, expected: true},
+		{name: "db error", setting: data.NotificationNewDeviceLogin, err: errors.New("db error"), expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data.GetNotificationSettingsFromDb = func(permanentId string) (map[string]bool, error) {
+				assert.Equal(t, "perm123", permanentId)
+				return tt.saved, tt.err
+			}
+			assert.Equal(t, tt.expected, notificationEnabled("perm123", tt.setting))
+		})
+	}
+
+	data.GetNotificationSettingsFromDb = func(permanentId string) (map[string]bool, error) {
+		t.Error("settings should not be read for critical notifications")
+		return nil, nil
+	}
+	for _, setting := range []string{data.NotificationSuspiciousLogin, data.NotificationPasswordChange, data.NotificationEmailChange, data.NotificationPasswordResetRequest, data.NotificationOAuthLink, data.NotificationSessionRevoke, data.NotificationAccountLock} {
+		assert.True(t, notificationEnabled("perm123", setting), setting)
+	}
+}
+
+// TestNotificationSettings проверяет отображение страницы настроек уведомлений.
+// Ожидается: все виды уведомлений с сохраненными значениями, критичные - включены
+// независимо от сохраненного значения, сообщение по ключу из query.
+func TestNotificationSettings(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupNotificationTest()()
+
+	data.GetNotificationSettingsFromDb = func(permanentId string) (map[string]bool, error) {
+		return map[string]bool{
+			data.NotificationNewDeviceLogin:  false,
+			data.NotificationSecurityDigest:  true,
+			data.NotificationPasswordChange:  false,
+			data.NotificationSuspiciousLogin: false,
+		}, nil
+	}
+	var page structs.NotificationSettingsPage
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "notificationSettings", templateName)
+		page = data.(structs.NotificationSettingsPage)
+		return nil
+	}
+
+	expectProfileUser(mock)
+
+	req := httptest.NewRequest(http.MethodGet, consts.ProfileNotificationsURL+"?msg=notificationsSaved", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	NotificationSettings(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []structs.NotificationSetting{
+		{Name: data.NotificationNewDeviceLogin, Enabled: false},
+		{Name: data.NotificationSuspiciousLogin, Enabled: true, Critical: true},
+		{Name: data.NotificationPasswordChange, Enabled: true, Critical: true},
+		{Name: data.NotificationEmailChange, Enabled: true, Critical: true},
+		{Name: data.NotificationPasswordResetRequest, Enabled: true, Critical: true},
+		{Name: data.NotificationOAuthLink, Enabled: true, Critical: true},
+		{Name: data.NotificationSessionRevoke, Enabled: true, Critical: true},
+		{Name: data.NotificationAccountLock, Enabled: true, Critical: true},
+		{Name: data.NotificationSecurityDigest, Enabled: true},
+	}, page.Settings)
+	assert.Equal(t, i18n.Text(i18n.En, "notificationsSaved"), page.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeNotificationSettings_Success проверяет сохранение настроек уведомлений.
+// Ожидается: в транзакции сохраняются только некритичные уведомления, отмеченные - включенными,
+// редирект на страницу настроек с сообщением.
+func TestChangeNotificationSettings_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupNotificationTest()()
+
+	saved := map[string]bool{}
+	data.SetNotificationSettingInDbTx = func(tx *sql.Tx, permanentId, setting string, enabled bool) error {
+		assert.Equal(t, "perm123", permanentId)
+		saved[setting] = enabled
+		return nil
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	form := url.Values{
+		data.NotificationSecurityDigest: {"true"},
+		data.NotificationPasswordChange: {"false"},
+	}
+	w := httptest.NewRecorder()
+	ChangeNotificationSettings(w, profileRequest(consts.ProfileNotificationsURL, form))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.ProfileNotificationsURL+"?msg=notificationsSaved", w.Header().Get("Location"))
+	assert.Equal(t, map[string]bool{data.NotificationNewDeviceLogin: false, data.NotificationSecurityDigest: true}, saved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeNotificationSettings_DbError проверяет ошибку сохранения настроек.
+// Ожидается: откат транзакции и редирект на страницу 500.
+func TestChangeNotificationSettings_DbError(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupNotificationTest()()
+
+	data.SetNotificationSettingInDbTx = func(tx *sql.Tx, permanentId, setting string, enabled bool) error {
+		return errors.New("db error")
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	w := httptest.NewRecorder()
+	ChangeNotificationSettings(w, profileRequest(consts.ProfileNotificationsURL, url.Values{}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.Err500URL, w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUnsubscribe проверяет отписку по ссылке из письма.
+// Ожидается: уведомление из токена отключается для всех аккаунтов с email из токена
+// без CSRF токена; недействительный токен и критичное уведомление отклоняются.
+func TestUnsubscribe(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupNotificationTest()()
+
+	setting := data.NotificationNewDeviceLogin
+	tools.UnsubscribeTokenValidate = func(signedToken string) (*structs.UnsubscribeTokenClaims, error) {
+		if signedToken != "token123" {
+			return nil, errors.New("token invalid")
+		}
+		return &structs.UnsubscribeTokenClaims{UnsubscribeEmail: "user@example.com", Setting: setting}, nil
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		assert.Equal(t, "user@example.com", email)
+		if yauth {
+			return "", errors.WithStack(sql.ErrNoRows)
+		}
+		return "perm123", nil
+	}
+	saved := map[string]bool{}
+	data.SetNotificationSettingInDbTx = func(tx *sql.Tx, permanentId, setting string, enabled bool) error {
+		saved[permanentId+"/"+setting] = enabled
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	req := httptest.NewRequest(http.MethodPost, consts.UnsubscribeURL+"?token=token123", strings.NewReader("List-Unsubscribe=One-Click"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	CSRFProtector(http.HandlerFunc(Unsubscribe)).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.SignInURL+"?msg=unsubscribed", w.Header().Get("Location"))
+	assert.Equal(t, map[string]bool{"perm123/" + data.NotificationNewDeviceLogin: false}, saved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	for _, tc := range []struct {
+		name    string
+		token   string
+		setting string
+	}{
+		{name: "invalid token", token: "bad", setting: data.NotificationNewDeviceLogin},
+		{name: "critical notification", token: "token123", setting: data.NotificationPasswordChange},
+		{name: "unknown notification", token: "token123", setting: "unknown"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setting = tc.setting
+			w := httptest.NewRecorder()
+			Unsubscribe(w, httptest.NewRequest(http.MethodPost, consts.UnsubscribeURL+"?token="+tc.token, nil))
+
+			assert.Equal(t, consts.SignInURL+"?msg=unsubscribeInvalid", w.Header().Get("Location"))
+		})
+	}
+	assert.Len(t, saved, 1)
+}
+
+// TestSendSecurityDigests проверяет отправку еженедельных сводок безопасности.
+// Ожидается: сводка содержит только активность за последние 7 дней и отправляется на языке
+// пользователя; сводка, которую не удалось отправить, не отмечается отправленной.
+func TestSendSecurityDigests(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupNotificationTest()()
+
+	const now = int64(1000000)
+	data.GetSecurityDigestRecipientsFromDb = func(sentBefore int64) ([]string, error) {
+		assert.Equal(t, now-securityDigestPeriod, sentBefore)
+		return []string{"perm1", "perm2"}, nil
+	}
+	data.GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+		return structs.AccountExport{
+			Sessions: []structs.ExportedSession{
+				{UserAgent: "old", CreatedAt: now - securityDigestPeriod - 1},
+				{UserAgent: "new", CreatedAt: now - 60},
+			},
+			ProfileChanges: []structs.ExportedProfileChange{{Field: "login", ChangedAt: now - 120}},
+		}, nil
+	}
+	data.GetUserLocaleFromDb = func(permanentId string) (string, error) { return i18n.Ru, nil }
+
+	var digests []structs.SecurityDigest
+	tools.SecurityDigestSend = func(locale, email string, digest structs.SecurityDigest) error {
+		assert.Equal(t, i18n.Ru, locale)
+		if email == "perm2@example.com" {
+			return errors.New("send error")
+		}
+		assert.Equal(t, "perm1@example.com", email)
+		digests = append(digests, digest)
+		return nil
+	}
+	var sentTo []string
+	data.SetSecurityDigestSentInDb = func(permanentId string, sentAt int64) error {
+		assert.Equal(t, now, sentAt)
+		sentTo = append(sentTo, permanentId)
+		return nil
+	}
+
+	mock.ExpectQuery(data.EmailSelectQuery).WithArgs("perm1").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("perm1@example.com"))
+	mock.ExpectQuery(data.EmailSelectQuery).WithArgs("perm2").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("perm2@example.com"))
+
+	sent, err := SendSecurityDigests(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sent)
+	assert.Equal(t, []string{"perm1"}, sentTo)
+	require.Len(t, digests, 1)
+	assert.Equal(t, now-securityDigestPeriod, digests[0].Since)
+	assert.Equal(t, []structs.ExportedSession{{UserAgent: "new", CreatedAt: now - 60}}, digests[0].Sessions)
+	assert.Len(t, digests[0].ProfileChanges, 1)
+	assert.Equal(t, "http://localhost:8080"+consts.ProfileNotificationsURL, digests[0].SettingsLink)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	data.GetSecurityDigestRecipientsFromDb = func(sentBefore int64) ([]string, error) { return nil, errors.New("db error") }
+	_, err = SendSecurityDigests(now)
+	assert.Error(t, err)
+}
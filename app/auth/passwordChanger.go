@@ -0,0 +1,179 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит HTTP-обработчик смены пароля вошедшим пользователем:
+//   - ChangePassword: проверяет текущий пароль и устанавливает новый
+//   - verifyCurrentPassword: проверяет текущий пароль с учетом лимита неудачных попыток
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// ChangePassword меняет пароль вошедшего пользователя.
+//
+// Требует текущий пароль (см. verifyCurrentPassword), проверяет совпадение нового пароля с подтверждением и его формат.
+// В транзакции сохраняет новый пароль и запись в журнале изменений профиля и отменяет
+// доверие ко всем устройствам пользователя; если отмечен флаг signOutOtherSessions, отменяет все сессии, кроме текущей: текущая определяется
+// по temporaryId из cookie и ее refresh токену, поэтому сессия с тем же User-Agent не сохраняется.
+// После фиксации отправляет пользователю уведомление о смене пароля
+// и перенаправляет на страницу профиля с сообщением.
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	cookie, err := data.GetTemporaryIdFromCookies(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	temporaryId := cookie.Value
+	permanentId, userAgent, err := data.GetTemporaryIdKeysFromDb(temporaryId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	currentPassword := r.FormValue("currentPassword")
+	if !verifyCurrentPassword(w, r, permanentId, currentPassword) {
+		return
+	}
+
+	newPassword := r.FormValue("newPassword")
+	if newPassword != r.FormValue("confirmPassword") {
+		renderProfile(w, r, permanentId, "passwordsNotMatch", 0, http.StatusOK)
+		return
+	}
+	if newPassword == currentPassword {
+		renderProfile(w, r, permanentId, "passwordUnchanged", 0, http.StatusOK)
+		return
+	}
+	if err := tools.PasswordValidate(newPassword); err != nil {
+		renderProfile(w, r, permanentId, "passwordInvalid", 0, http.StatusOK)
+		return
+	}
+
+	signOutOtherSessions := r.FormValue("signOutOtherSessions") == "true"
+	var refreshToken string
+	if signOutOtherSessions {
+		refreshToken, err = data.GetRefreshTokenFromDb(permanentId, userAgent)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetPasswordInDbTx(tx, permanentId, newPassword); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldPassword}
+	if err := data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	// Устройства, доверенные до смены пароля, снова подтверждают вход кодом
+	if err := data.SetTrustedDevicesCancelledInDbTx(tx, permanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if signOutOtherSessions {
+		if err := data.SetOtherTemporaryIdsCancelledInDbTx(tx, permanentId, temporaryId); err != nil {
+			tx.Rollback()
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		if err := data.SetOtherRefreshTokensCancelledInDbTx(tx, permanentId, refreshToken); err != nil {
+			tx.Rollback()
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if notificationEnabled(permanentId, data.NotificationPasswordChange) {
+		alert := securityAlert(r, permanentId, email, data.NotificationPasswordChange)
+		if err := tools.PasswordChangeNotificationSend(i18n.Locale(r), email, alert); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	redirectToProfile(w, r, "passwordChanged")
+}
+
+// verifyCurrentPassword проверяет текущий пароль пользователя.
+//
+// Число неудачных попыток ограничено (см. failedAttemptsRetryAfter): при исчерпании
+// отвечает статусом 429, не проверяя пароль. Успешная проверка сбрасывает счетчик.
+// Если пароль неверен или попытки исчерпаны, сама отображает страницу профиля
+// с сообщением и возвращает false.
+func verifyCurrentPassword(w http.ResponseWriter, r *http.Request, permanentId, password string) bool {
+	now := time.Now().Unix()
+	retryAfter, err := failedAttemptsRetryAfter(permanentId, data.FailedAttemptCurrentPassword, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return false
+	}
+	if retryAfter > 0 {
+		renderTooManyAttempts(w, r, permanentId, retryAfter)
+		return false
+	}
+
+	if err := data.IsOKPasswordHashInDb(permanentId, password); err != nil {
+		// Пользователь, вошедший только через Yandex, не имеет пароля
+		if !errors.Is(err, data.ErrPasswordInvalid) && !errors.Is(err, sql.ErrNoRows) {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return false
+		}
+		if _, err := recordFailedAttempt(permanentId, data.FailedAttemptCurrentPassword, now); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return false
+		}
+		renderProfile(w, r, permanentId, "currentPasswordWrong", 0, http.StatusOK)
+		return false
+	}
+
+	if err := data.DeleteFailedAttemptsFromDb(permanentId, data.FailedAttemptCurrentPassword); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return false
+	}
+	return true
+}
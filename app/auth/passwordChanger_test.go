@@ -0,0 +1,302 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует смену пароля вошедшим пользователем.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPasswordChangeTest дополняет окружение профиля зависимостями смены пароля.
+// Текущий пароль пользователя - "OldPass1!".
+func setupPasswordChangeTest(t *testing.T) func() {
+	oldIsOKPasswordHashInDb := data.IsOKPasswordHashInDb
+	oldSetPasswordInDbTx := data.SetPasswordInDbTx
+	oldSetOtherTemporaryIdsCancelledInDbTx := data.SetOtherTemporaryIdsCancelledInDbTx
+	oldSetOtherRefreshTokensCancelledInDbTx := data.SetOtherRefreshTokensCancelledInDbTx
+	oldPasswordChangeNotificationSend := tools.PasswordChangeNotificationSend
+
+	data.IsOKPasswordHashInDb = func(permanentId, password string) error {
+		if password != "OldPass1!" {
+			return errors.WithStack(data.ErrPasswordInvalid)
+		}
+		return nil
+	}
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		return nil
+	}
+
+	return func() {
+		data.IsOKPasswordHashInDb = oldIsOKPasswordHashInDb
+		data.SetPasswordInDbTx = oldSetPasswordInDbTx
+		data.SetOtherTemporaryIdsCancelledInDbTx = oldSetOtherTemporaryIdsCancelledInDbTx
+		data.SetOtherRefreshTokensCancelledInDbTx = oldSetOtherRefreshTokensCancelledInDbTx
+		tools.PasswordChangeNotificationSend = oldPasswordChangeNotificationSend
+	}
+}
+
+// expectCurrentRefreshToken ожидает запрос refresh токена текущей сессии.
+func expectCurrentRefreshToken(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(data.RefreshTokenSelectQuery).
+		WithArgs("perm123", "test-agent").
+		WillReturnRows(sqlmock.NewRows([]string{"token"}).AddRow("refresh-token"))
+}
+
+// TestChangePassword_Success проверяет смену пароля с завершением других сессий.
+// Ожидается: пароль и запись журнала в транзакции, отмена сессий кроме текущего temporaryId
+// и его refresh токена, уведомление на email.
+func TestChangePassword_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupPasswordChangeTest(t)()
+
+	var savedPassword string
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error {
+		savedPassword = password
+		return nil
+	}
+	var savedChange structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		savedChange = change
+		return nil
+	}
+	var keptTemporaryId, keptRefreshToken string
+	data.SetOtherTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId, temporaryId string) error {
+		keptTemporaryId = temporaryId
+		return nil
+	}
+	data.SetOtherRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId, refreshToken string) error {
+		keptRefreshToken = refreshToken
+		return nil
+	}
+	var notifiedEmail string
+	tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+		notifiedEmail = email
+		assert.Equal(t, data.NotificationPasswordChange, alert.Event)
+		assert.Equal(t, "http://localhost:8080/security/revoke?token=alert-token", alert.RevokeLink)
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectCurrentRefreshToken(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	expectProfileEmail(mock)
+
+	form := url.Values{
+		"currentPassword":      {"OldPass1!"},
+		"newPassword":          {"NewPass1!"},
+		"confirmPassword":      {"NewPass1!"},
+		"signOutOtherSessions": {"true"},
+	}
+	w := httptest.NewRecorder()
+	ChangePassword(w, profileRequest("/profile/password", form))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=passwordChanged", w.Header().Get("Location"))
+	assert.Equal(t, "NewPass1!", savedPassword)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldPassword}, savedChange)
+	assert.Equal(t, "temp-id", keptTemporaryId)
+	assert.Equal(t, "refresh-token", keptRefreshToken)
+	assert.Equal(t, "perm123", trustedDevicesCancelledFor)
+	assert.Equal(t, "old@example.com", notifiedEmail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangePassword_SignsOutSameUserAgent проверяет завершение другой сессии с тем же User-Agent.
+// Ожидается: сессия другого устройства с тем же userAgent отменяется, текущая сессия сохраняется.
+func TestChangePassword_SignsOutSameUserAgent(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupPasswordChangeTest(t)()
+
+	// Сессии пользователя: temporaryId -> userAgent
+	sessions := map[string]string{"temp-id": "test-agent", "other-temp-id": "test-agent"}
+	cancelled := map[string]bool{}
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error { return nil }
+	data.SetOtherTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId, temporaryId string) error {
+		for id := range sessions {
+			if id != temporaryId {
+				cancelled[id] = true
+			}
+		}
+		return nil
+	}
+	data.SetOtherRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId, refreshToken string) error { return nil }
+	tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+
+	expectProfileUser(mock)
+	expectCurrentRefreshToken(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	expectProfileEmail(mock)
+
+	form := url.Values{
+		"currentPassword":      {"OldPass1!"},
+		"newPassword":          {"NewPass1!"},
+		"confirmPassword":      {"NewPass1!"},
+		"signOutOtherSessions": {"true"},
+	}
+	req := profileRequest("/profile/password", form)
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+	ChangePassword(w, req)
+
+	assert.Equal(t, "/profile?msg=passwordChanged", w.Header().Get("Location"))
+	assert.True(t, cancelled["other-temp-id"], "Сессия с тем же User-Agent должна быть отменена")
+	assert.False(t, cancelled["temp-id"], "Текущая сессия не должна отменяться")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangePassword_KeepsOtherSessions проверяет смену пароля без флага signOutOtherSessions.
+// Ожидается: пароль сменен, сессии других устройств не отменяются.
+func TestChangePassword_KeepsOtherSessions(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupPasswordChangeTest(t)()
+
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error { return nil }
+	data.SetOtherTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId, temporaryId string) error {
+		t.Error("other sessions should not be cancelled")
+		return nil
+	}
+	data.SetOtherRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId, refreshToken string) error {
+		t.Error("other refresh tokens should not be cancelled")
+		return nil
+	}
+	tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	expectProfileEmail(mock)
+
+	form := url.Values{"currentPassword": {"OldPass1!"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}
+	w := httptest.NewRecorder()
+	ChangePassword(w, profileRequest("/profile/password", form))
+
+	assert.Equal(t, "/profile?msg=passwordChanged", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangePassword_Rejected проверяет отклонение смены пароля.
+// Ожидается: страница профиля с сообщением, пароль не сохраняется, уведомление не отправляется.
+func TestChangePassword_Rejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		msgKey  string
+		hashErr error
+	}{
+		{"wrong current password", url.Values{"currentPassword": {"Wrong1!"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}, "currentPasswordWrong", nil},
+		{"no password for yandex user", url.Values{"currentPassword": {"OldPass1!"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}, "currentPasswordWrong", sql.ErrNoRows},
+		{"passwords not match", url.Values{"currentPassword": {"OldPass1!"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass2!"}}, "passwordsNotMatch", nil},
+		{"same password", url.Values{"currentPassword": {"OldPass1!"}, "newPassword": {"OldPass1!"}, "confirmPassword": {"OldPass1!"}}, "passwordUnchanged", nil},
+		{"invalid new password", url.Values{"currentPassword": {"OldPass1!"}, "newPassword": {"new pass"}, "confirmPassword": {"new pass"}}, "passwordInvalid", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			defer setupPasswordChangeTest(t)()
+
+			if tt.hashErr != nil {
+				data.IsOKPasswordHashInDb = func(permanentId, password string) error { return errors.WithStack(tt.hashErr) }
+			}
+			data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+			data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error {
+				t.Error("password should not be saved")
+				return nil
+			}
+			tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+				t.Error("notification should not be sent")
+				return nil
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			ChangePassword(w, profileRequest("/profile/password", tt.form))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestChangePassword_AttemptsLimit проверяет ограничение попыток ввода текущего пароля.
+// Ожидается: неверный пароль учитывается как неудачная попытка, при исчерпанных попытках
+// пароль не проверяется и возвращается 429 с Retry-After.
+func TestChangePassword_AttemptsLimit(t *testing.T) {
+	form := url.Values{"currentPassword": {"Wrong1!"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}
+
+	t.Run("wrong password recorded", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		defer setupPasswordChangeTest(t)()
+
+		data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+		var recordedKind string
+		data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error {
+			recordedKind = kind
+			return nil
+		}
+		var profile structs.Profile
+		captureProfile(t, &profile)
+
+		expectProfileUser(mock)
+		expectProfileEmail(mock)
+
+		w := httptest.NewRecorder()
+		ChangePassword(w, profileRequest("/profile/password", form))
+
+		assert.Equal(t, data.FailedAttemptCurrentPassword, recordedKind)
+		assert.Equal(t, i18n.Text(i18n.En, "currentPasswordWrong"), profile.Msg)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("attempts exhausted", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		defer setupPasswordChangeTest(t)()
+
+		data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+		data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+			return 5, since + 60, nil
+		}
+		data.IsOKPasswordHashInDb = func(permanentId, password string) error {
+			t.Error("password should not be checked")
+			return nil
+		}
+		var profile structs.Profile
+		captureProfile(t, &profile)
+
+		expectProfileUser(mock)
+		expectProfileEmail(mock)
+
+		w := httptest.NewRecorder()
+		ChangePassword(w, profileRequest("/profile/password", form))
+
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "60", w.Header().Get("Retry-After"))
+		assert.Equal(t, i18n.Text(i18n.En, "tooManyAttempts"), profile.Msg)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -7,12 +7,15 @@ package auth
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
 	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -33,7 +36,8 @@ func GeneratePasswordResetLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := tools.EmailValidate(email); err != nil {
-		data := structs.MsgForUser{Msg: consts.MsgForUser["invalidEmail"].Msg, Regs: nil}
+		data := structs.MsgForUser{Msg: i18n.Msg(r, "emailInvalid"), MsgKey: "emailInvalid"}
+		data.CSRFToken = tmpls.CSRFToken(r)
 		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "generatePasswordResetLink", data); err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -42,9 +46,16 @@ func GeneratePasswordResetLink(w http.ResponseWriter, r *http.Request) {
 	}
 
 	yauth := false
-	if _, err := data.GetPermanentIdFromDbByEmail(email, yauth); err != nil {
+	permanentId, err := data.GetPermanentIdFromDbByEmail(email, yauth)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			data := structs.MsgForUser{Msg: consts.MsgForUser["userNotExist"].Msg, Regs: nil}
+			msgKey := "userNotExist"
+			// Аккаунт создан через Yandex: пароль сначала устанавливается в профиле
+			if isYauthEmail(email) {
+				msgKey = "yauthPasswordNotSet"
+			}
+			data := structs.MsgForUser{Msg: i18n.Msg(r, msgKey), MsgKey: msgKey}
+			data.CSRFToken = tmpls.CSRFToken(r)
 			if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "generatePasswordResetLink", data); err != nil {
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
@@ -55,43 +66,69 @@ func GeneratePasswordResetLink(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	baseURL := "http://localhost:8080/set-new-password"
-	passwordResetLink, err := tools.GeneratePasswordResetLink(email, baseURL)
-	if err != nil {
-		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
-		return
-	}
-
-	url, err := url.Parse(passwordResetLink)
+	// Заблокированному аккаунту ссылка не отправляется: войти после сброса он все равно не сможет
+	status, restricted, err := accountStatus(permanentId)
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
-
-	resetToken := url.Query().Get("token")
-	if err := data.SetPasswordResetTokenInDb(resetToken); err != nil {
-		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+	if restricted {
+		data := structs.MsgForUser{Msg: accountStatusMsg(r, status), CSRFToken: tmpls.CSRFToken(r)}
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "generatePasswordResetLink", data); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
 		return
 	}
 
 	var msgFromUserData structs.MsgForUser
-	if err := tools.PasswordResetEmailSend(email, passwordResetLink); err != nil {
-		msgFromUserData = structs.MsgForUser{Msg: consts.MsgForUser["failedMailSendingStatus"].Msg}
+	alert := securityAlert(r, permanentId, email, data.NotificationPasswordResetRequest)
+	if err := sendPasswordResetLink(i18n.Locale(r), email, alert); err != nil {
+		msgFromUserData = structs.MsgForUser{Msg: i18n.Msg(r, "failedMailSendingStatus"), MsgKey: "failedMailSendingStatus"}
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	} else {
-		msgFromUserData = structs.MsgForUser{Msg: consts.MsgForUser["successfulMailSendingStatus"].Msg}
+		msgFromUserData = structs.MsgForUser{Msg: i18n.Msg(r, "successfulMailSendingStatus"), MsgKey: "successfulMailSendingStatus"}
 	}
+	msgFromUserData.CSRFToken = tmpls.CSRFToken(r)
 	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "generatePasswordResetLink", msgFromUserData); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 }
 
+// sendPasswordResetLink создает ссылку сброса пароля, сохраняет ее токен и отправляет ссылку на email.
+//
+// Используется формой сброса пароля и администратором; письмо формируется на языке locale
+// и содержит сведения о запросе alert со ссылкой "это был не я".
+func sendPasswordResetLink(locale, email string, alert structs.SecurityAlert) error {
+	baseURL := tmpls.PublicURL("/set-new-password")
+	passwordResetLink, err := tools.GeneratePasswordResetLink(email, baseURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	url, err := url.Parse(passwordResetLink)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	resetToken := url.Query().Get("token")
+	if err := data.SetPasswordResetTokenInDb(resetToken, email); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := tools.PasswordResetEmailSend(locale, email, passwordResetLink, alert); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
 // SetNewPassword устанавливает новый пароль по токену.
 //
 // Проверяет совпадение паролей, валидирует токен и устанавливает новый пароль.
-// При успехе аннулирует все сессии пользователя и перенаправляет на страницу входа.
+// При успехе аннулирует все сессии пользователя и доверие к его устройствам
+// и перенаправляет на страницу входа.
 func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 	resetToken := r.FormValue("token")
 	if err := data.IsPasswordResetTokenCancelled(resetToken); err != nil {
@@ -121,7 +158,8 @@ func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if newPassword != confirmPassword {
-		data := structs.MsgForUser{Msg: consts.MsgForUser["passwordsNotMatch"].Msg, Regs: nil}
+		data := structs.MsgForUser{Msg: i18n.Msg(r, "passwordsNotMatch"), MsgKey: "passwordsNotMatch"}
+		data.CSRFToken = tmpls.CSRFToken(r)
 		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "setNewPassword", data); err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -130,7 +168,30 @@ func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := tools.PasswordValidate(newPassword); err != nil {
-		data := structs.MsgForUser{Msg: consts.MsgForUser["invalidPassword"].Msg, Regs: nil}
+		data := structs.MsgForUser{Msg: i18n.Msg(r, "passwordInvalid"), MsgKey: "passwordInvalid"}
+		data.CSRFToken = tmpls.CSRFToken(r)
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "setNewPassword", data); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
+
+	yauth := false
+	permanentId, err := data.GetPermanentIdFromDbByEmail(claims.Email, yauth)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	// Ссылка могла быть отправлена до блокировки аккаунта
+	status, restricted, err := accountStatus(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if restricted {
+		data := structs.MsgForUser{Msg: accountStatusMsg(r, status), CSRFToken: tmpls.CSRFToken(r)}
 		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "setNewPassword", data); err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -150,25 +211,35 @@ func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	yauth := false
-	permanentId, err := data.GetPermanentIdFromDbByEmail(claims.Email, yauth)
-	if err != nil {
+	if err := data.SetPasswordInDbTx(tx, permanentId, newPassword); err != nil {
+		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
-	if err := data.SetPasswordInDbTx(tx, permanentId, newPassword); err != nil {
+	change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldPasswordReset}
+	if err := data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
 	userAgent := r.UserAgent()
 	if err := data.SetTemporaryIdCancelledInDbTx(tx, permanentId, userAgent); err != nil {
+		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
 	if err := data.SetRefreshTokenCancelledInDbTx(tx, permanentId, userAgent); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	// Устройства, доверенные до сброса пароля, снова подтверждают вход кодом
+	if err := data.SetTrustedDevicesCancelledInDbTx(tx, permanentId); err != nil {
+		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -179,6 +250,11 @@ func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	successMsg := "Password has been set successfully."
-	http.Redirect(w, r, consts.SignInURL+"?msg="+url.QueryEscape(successMsg), http.StatusFound)
+	// Пароль уже установлен, поэтому ошибка отправки уведомления только логируется
+	alert := securityAlert(r, permanentId, claims.Email, data.NotificationPasswordChange)
+	if err := tools.PasswordChangeNotificationSend(i18n.Locale(r), claims.Email, alert); err != nil {
+		log.Printf("%+v", err)
+	}
+
+	http.Redirect(w, r, consts.SignInURL+"?msg=passwordResetDone", http.StatusFound)
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -33,6 +34,7 @@ func setupTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldDB := data.Db
 	oldTmplsRenderer := tmpls.TmplsRenderer
 	oldEmailValidate := tools.EmailValidate
+	oldPasswordValidate := tools.PasswordValidate
 	oldGetPermanentIdFromDbByEmail := data.GetPermanentIdFromDbByEmail
 	oldGeneratePasswordResetLink := tools.GeneratePasswordResetLink
 	oldResetTokenValidate := tools.ResetTokenValidate
@@ -42,14 +44,29 @@ func setupTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldSetTemporaryIdCancelledInDbTx := data.SetTemporaryIdCancelledInDbTx
 	oldSetRefreshTokenCancelledInDbTx := data.SetRefreshTokenCancelledInDbTx
 	oldIsPasswordResetTokenCancelled := data.IsPasswordResetTokenCancelled
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+	oldGenerateSecurityAlertLink := tools.GenerateSecurityAlertLink
+	oldSetSecurityAlertTokenInDb := data.SetSecurityAlertTokenInDb
+	oldPasswordChangeNotificationSend := tools.PasswordChangeNotificationSend
+	oldSetTrustedDevicesCancelledInDbTx := data.SetTrustedDevicesCancelledInDbTx
 
 	data.Db = db
+	data.SetTrustedDevicesCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	tools.GenerateSecurityAlertLink = func(permanentId, email, event, baseURL string) (string, error) {
+		return baseURL + "?token=alert-token", nil
+	}
+	data.SetSecurityAlertTokenInDb = func(token, permanentId string) error { return nil }
+	tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
 
 	return db, mock, func() {
 		data.Db = oldDB
 		db.Close()
 		tmpls.TmplsRenderer = oldTmplsRenderer
 		tools.EmailValidate = oldEmailValidate
+		tools.PasswordValidate = oldPasswordValidate
 		data.GetPermanentIdFromDbByEmail = oldGetPermanentIdFromDbByEmail
 		tools.GeneratePasswordResetLink = oldGeneratePasswordResetLink
 		tools.ResetTokenValidate = oldResetTokenValidate
@@ -59,6 +76,11 @@ func setupTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 		data.SetTemporaryIdCancelledInDbTx = oldSetTemporaryIdCancelledInDbTx
 		data.SetRefreshTokenCancelledInDbTx = oldSetRefreshTokenCancelledInDbTx
 		data.IsPasswordResetTokenCancelled = oldIsPasswordResetTokenCancelled
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
+		tools.GenerateSecurityAlertLink = oldGenerateSecurityAlertLink
+		data.SetSecurityAlertTokenInDb = oldSetSecurityAlertTokenInDb
+		tools.PasswordChangeNotificationSend = oldPasswordChangeNotificationSend
+		data.SetTrustedDevicesCancelledInDbTx = oldSetTrustedDevicesCancelledInDbTx
 	}
 }
 
@@ -75,17 +97,19 @@ func TestGeneratePasswordResetLink_Success(t *testing.T) {
 	tools.GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
 		return "http://localhost:8080/set-new-password?token=mock-token-123", nil
 	}
-	data.SetPasswordResetTokenInDb = func(token string) error {
+	data.SetPasswordResetTokenInDb = func(token, email string) error {
 		return nil
 	}
-	tools.PasswordResetEmailSend = func(email, link string) error {
+	var sentAlert structs.SecurityAlert
+	tools.PasswordResetEmailSend = func(locale, email, link string, alert structs.SecurityAlert) error {
+		sentAlert = alert
 		return nil
 	}
 
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "generatePasswordResetLink", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["successfulMailSendingStatus"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "successfulMailSendingStatus"), msgData.Msg)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -100,6 +124,45 @@ func TestGeneratePasswordResetLink_Success(t *testing.T) {
 
 	GeneratePasswordResetLink(w, req)
 
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, data.NotificationPasswordResetRequest, sentAlert.Event)
+	assert.Equal(t, "192.0.2.1", sentAlert.IP)
+	assert.Equal(t, "http://localhost:8080/security/revoke?token=alert-token", sentAlert.RevokeLink)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGeneratePasswordResetLink_AccountRestricted проверяет запрос сброса пароля для заблокированного аккаунта.
+// Ожидается: HTTP 200, сообщение о блокировке, ссылка не отправляется.
+func TestGeneratePasswordResetLink_AccountRestricted(t *testing.T) {
+	_, mock, teardown := setupTest(t)
+	defer teardown()
+
+	tools.EmailValidate = func(email string) error { return nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		return "permanent-123", nil
+	}
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusDisabled}, nil
+	}
+	tools.PasswordResetEmailSend = func(locale, email, link string, alert structs.SecurityAlert) error {
+		t.Error("reset link should not be sent")
+		return nil
+	}
+
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "generatePasswordResetLink", templateName)
+		assert.Equal(t, i18n.Text(i18n.En, "accountDisabled"), data.(structs.MsgForUser).Msg)
+		return nil
+	}
+
+	form := url.Values{}
+	form.Add("email", "test@example.com")
+	req := httptest.NewRequest("POST", "/generate-password-reset-link", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	GeneratePasswordResetLink(w, req)
+
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -117,7 +180,7 @@ func TestGeneratePasswordResetLink_InvalidEmail(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "generatePasswordResetLink", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["invalidEmail"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "emailInvalid"), msgData.Msg)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -150,7 +213,7 @@ func TestGeneratePasswordResetLink_UserNotFound(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "generatePasswordResetLink", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["userNotExist"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "userNotExist"), msgData.Msg)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -169,6 +232,40 @@ func TestGeneratePasswordResetLink_UserNotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestGeneratePasswordResetLink_YandexAccount проверяет запрос сброса для email аккаунта, созданного через Yandex.
+// Ожидается: HTTP 200, подсказка войти через Yandex и установить пароль.
+func TestGeneratePasswordResetLink_YandexAccount(t *testing.T) {
+	_, mock, teardown := setupTest(t)
+	defer teardown()
+
+	tools.EmailValidate = func(email string) error { return nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		if yauth {
+			return "perm123", nil
+		}
+		return "", sql.ErrNoRows
+	}
+
+	var msg string
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "generatePasswordResetLink", templateName)
+		msg = data.(structs.MsgForUser).Msg
+		return nil
+	}
+
+	form := url.Values{}
+	form.Add("email", "user@yandex.ru")
+	req := httptest.NewRequest("POST", "/generate-password-reset-link", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	GeneratePasswordResetLink(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, i18n.Text(i18n.En, "yauthPasswordNotSet"), msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestSetNewPassword_Success проверяет успешную установку пароля.
 // Ожидается: HTTP 302, редирект на страницу входа.
 func TestSetNewPassword_Success(t *testing.T) {
@@ -198,6 +295,25 @@ func TestSetNewPassword_Success(t *testing.T) {
     data.SetRefreshTokenCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent string) error {
         return nil
     }
+    var trustedDevicesCancelledFor string
+    data.SetTrustedDevicesCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+        trustedDevicesCancelledFor = permanentId
+        return nil
+    }
+    oldSetProfileChangeInDbTx := data.SetProfileChangeInDbTx
+    defer func() { data.SetProfileChangeInDbTx = oldSetProfileChangeInDbTx }()
+    var savedChange structs.ProfileChange
+    data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+        savedChange = change
+        return nil
+    }
+
+    var notifiedEmail string
+    tools.PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+        notifiedEmail = email
+        assert.Equal(t, data.NotificationPasswordChange, alert.Event)
+        return nil
+    }
 
     mock.ExpectCommit()
 
@@ -214,7 +330,10 @@ func TestSetNewPassword_Success(t *testing.T) {
 
     assert.Equal(t, http.StatusFound, w.Code)
     assert.Contains(t, w.Header().Get("Location"), consts.SignInURL)
-    assert.Contains(t, w.Header().Get("Location"), "Password+has+been+set+successfully")
+    assert.Contains(t, w.Header().Get("Location"), "msg=passwordResetDone")
+    assert.Equal(t, structs.ProfileChange{PermanentId: "perm-123", Field: data.ProfileFieldPasswordReset}, savedChange)
+    assert.Equal(t, "test@example.com", notifiedEmail)
+    assert.Equal(t, "perm-123", trustedDevicesCancelledFor)
 
     assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -282,7 +401,7 @@ func TestSetNewPassword_PasswordsDontMatch(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "setNewPassword", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["passwordsNotMatch"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "passwordsNotMatch"), msgData.Msg)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -320,7 +439,7 @@ func TestSetNewPassword_InvalidNewPassword(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "setNewPassword", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["invalidPassword"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "passwordInvalid"), msgData.Msg)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
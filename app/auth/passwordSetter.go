@@ -0,0 +1,182 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит HTTP-обработчик установки логина и пароля для аккаунтов, созданных через Yandex:
+//   - SetLoginAndPassword: задает логин (если его нет) и первый пароль
+//   - isYauthEmail: определяет, что адрес принадлежит аккаунту, созданному через Yandex
+//
+// После установки пользователь входит по логину и паролю или через Yandex под тем же permanentId,
+// а сброс пароля по email работает так же, как для аккаунтов, созданных через регистрацию.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// isYauthEmail проверяет, что email принадлежит аккаунту, созданному через Yandex.
+//
+// Используется для подсказки войти через Yandex и установить пароль; ошибки БД
+// не прерывают обработку, пользователь получает обычное сообщение.
+func isYauthEmail(email string) bool {
+	yauth := true
+	_, err := data.GetPermanentIdFromDbByEmail(email, yauth)
+	return err == nil
+}
+
+// SetLoginAndPassword устанавливает логин и пароль аккаунту без пароля.
+//
+// Если пароль уже установлен, отображает профиль с сообщением: смена пароля требует текущий.
+// Логин берется из формы, только если у аккаунта его еще нет; он проверяется регулярным
+// выражением и на уникальность. Пароль проверяется на совпадение с подтверждением и формат.
+// В транзакции сохраняет логин, пароль и email для входа по паролю (yauth = false),
+// если адрес не занят другим аккаунтом, и фиксирует изменения в журнале профиля.
+// После фиксации отправляет уведомление о смене пароля и перенаправляет на страницу профиля.
+func SetLoginAndPassword(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	hasPassword, err := data.HasPasswordInDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if hasPassword {
+		renderProfile(w, r, permanentId, "passwordAlreadySet", 0, http.StatusOK)
+		return
+	}
+
+	currentLogin, err := data.GetLoginFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	login := ""
+	if currentLogin == "" {
+		login = r.FormValue("login")
+		if err := tools.LoginValidate(login); err != nil {
+			renderProfile(w, r, permanentId, "loginInvalid", 0, http.StatusOK)
+			return
+		}
+
+		if _, err := data.GetPermanentIdFromDbByLogin(login); err == nil {
+			renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+			return
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	newPassword := r.FormValue("newPassword")
+	if newPassword != r.FormValue("confirmPassword") {
+		renderProfile(w, r, permanentId, "passwordsNotMatch", 0, http.StatusOK)
+		return
+	}
+	if err := tools.PasswordValidate(newPassword); err != nil {
+		renderProfile(w, r, permanentId, "passwordInvalid", 0, http.StatusOK)
+		return
+	}
+
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	// Email от Yandex хранится с yauth = true; для сброса пароля нужен адрес с yauth = false
+	yauth := false
+	addEmail := false
+	if _, err := data.GetPermanentIdFromDbByEmail(email, yauth); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		addEmail = true
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	changedAt := time.Now().Unix()
+	if login != "" {
+		if err := data.SetLoginInDbTx(tx, permanentId, login); err != nil {
+			tx.Rollback()
+			if errors.Is(err, data.ErrLoginAlreadyExist) {
+				renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+				return
+			}
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
+		change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldLogin, NewValue: login}
+		if err := data.SetProfileChangeInDbTx(tx, change, "", changedAt); err != nil {
+			tx.Rollback()
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := data.SetPasswordInDbTx(tx, permanentId, newPassword); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldPassword}
+	if err := data.SetProfileChangeInDbTx(tx, change, "", changedAt); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if addEmail {
+		if err := data.SetEmailInDbTx(tx, permanentId, email, yauth); err != nil {
+			tx.Rollback()
+			if errors.Is(err, data.ErrEmailAlreadyExist) {
+				renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+				return
+			}
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if notificationEnabled(permanentId, data.NotificationOAuthLink) {
+		alert := securityAlert(r, permanentId, email, data.NotificationOAuthLink)
+		if err := tools.OAuthLinkNotificationSend(i18n.Locale(r), email, alert); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	redirectToProfile(w, r, "loginAndPasswordSet")
+}
@@ -0,0 +1,194 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует установку логина и пароля для аккаунтов, созданных через Yandex.
+package auth
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPasswordSetTest дополняет окружение профиля зависимостями установки пароля.
+// По умолчанию у аккаунта нет ни логина, ни пароля, а email получен от Yandex.
+func setupPasswordSetTest(t *testing.T) func() {
+	oldSetPasswordInDbTx := data.SetPasswordInDbTx
+	oldOAuthLinkNotificationSend := tools.OAuthLinkNotificationSend
+
+	data.HasPasswordInDb = func(permanentId string) (bool, error) { return false, nil }
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "", errors.WithStack(sql.ErrNoRows) }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "", sql.ErrNoRows }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		if yauth {
+			return "perm123", nil
+		}
+		return "", errors.WithStack(sql.ErrNoRows)
+	}
+	tools.OAuthLinkNotificationSend = func(locale, email string, alert structs.SecurityAlert) error { return nil }
+
+	return func() {
+		data.SetPasswordInDbTx = oldSetPasswordInDbTx
+		tools.OAuthLinkNotificationSend = oldOAuthLinkNotificationSend
+	}
+}
+
+// TestSetLoginAndPassword_Success проверяет установку логина и пароля аккаунту из Yandex.
+// Ожидается: логин, пароль, email для входа по паролю и записи журнала в одной транзакции, уведомление на email.
+func TestSetLoginAndPassword_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupPasswordSetTest(t)()
+
+	var savedLogin, savedPassword string
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		savedLogin = login
+		return nil
+	}
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error {
+		savedPassword = password
+		return nil
+	}
+	var savedFields []string
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		savedFields = append(savedFields, change.Field)
+		return nil
+	}
+	var savedEmail string
+	var savedYauth bool
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		savedEmail, savedYauth = email, yauth
+		return nil
+	}
+	var notifiedEmail string
+	tools.OAuthLinkNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+		notifiedEmail = email
+		assert.Equal(t, data.NotificationOAuthLink, alert.Event)
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	form := url.Values{"login": {"newLogin"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}
+	w := httptest.NewRecorder()
+	SetLoginAndPassword(w, profileRequest("/profile/set-password", form))
+
+	assert.Equal(t, "/profile?msg=loginAndPasswordSet", w.Header().Get("Location"))
+	assert.Equal(t, "newLogin", savedLogin)
+	assert.Equal(t, "NewPass1!", savedPassword)
+	assert.Equal(t, []string{data.ProfileFieldLogin, data.ProfileFieldPassword}, savedFields)
+	assert.Equal(t, "old@example.com", savedEmail)
+	assert.False(t, savedYauth)
+	assert.Equal(t, "old@example.com", notifiedEmail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetLoginAndPassword_ExistingLogin проверяет установку пароля аккаунту, у которого логин уже есть.
+// Ожидается: логин из формы игнорируется, сохраняется только пароль.
+func TestSetLoginAndPassword_ExistingLogin(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupPasswordSetTest(t)()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "perm123", nil }
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		t.Error("login should not be changed")
+		return nil
+	}
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		t.Error("email for password sign-in already exists")
+		return nil
+	}
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error { return nil }
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		assert.Equal(t, data.ProfileFieldPassword, change.Field)
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	form := url.Values{"login": {"other"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}}
+	w := httptest.NewRecorder()
+	SetLoginAndPassword(w, profileRequest("/profile/set-password", form))
+
+	assert.Equal(t, "/profile?msg=loginAndPasswordSet", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetLoginAndPassword_Rejected проверяет отклонение некорректных данных.
+// Ожидается: страница профиля с сообщением, транзакция не начинается.
+func TestSetLoginAndPassword_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		setup  func()
+		msgKey string
+	}{
+		{
+			name:   "password already set",
+			form:   url.Values{"login": {"newLogin"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}},
+			setup:  func() { data.HasPasswordInDb = func(permanentId string) (bool, error) { return true, nil } },
+			msgKey: "passwordAlreadySet",
+		},
+		{
+			name:   "invalid login",
+			form:   url.Values{"login": {"bad login"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}},
+			msgKey: "loginInvalid",
+		},
+		{
+			name: "login taken",
+			form: url.Values{"login": {"taken"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"NewPass1!"}},
+			setup: func() {
+				data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "perm456", nil }
+			},
+			msgKey: "userAlreadyExist",
+		},
+		{
+			name:   "passwords do not match",
+			form:   url.Values{"login": {"newLogin"}, "newPassword": {"NewPass1!"}, "confirmPassword": {"Other1!"}},
+			msgKey: "passwordsNotMatch",
+		},
+		{
+			name:   "invalid password",
+			form:   url.Values{"login": {"newLogin"}, "newPassword": {"new pass"}, "confirmPassword": {"new pass"}},
+			msgKey: "passwordInvalid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			defer setupPasswordSetTest(t)()
+
+			if tt.setup != nil {
+				tt.setup()
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			SetLoginAndPassword(w, profileRequest("/profile/set-password", tt.form))
+
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит проверку прав доступа по ролям:
+//   - RequirePermission: middleware, пропускающий только пользователей с указанными правами
+//   - AccessFromContext: получает роли и права пользователя из контекста запроса
+//   - HasPermission: проверяет право пользователя текущего запроса
+//   - loadAccess: получает роли и права пользователя из БД
+//
+// Права пользователя - объединение прав всех его действующих ролей. Они читаются из БД
+// на каждый запрос, поэтому назначение и снятие роли действуют сразу.
+package auth
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/pkg/errors"
+)
+
+// loadAccess получает действующие роли и права пользователя.
+func loadAccess(permanentId string) (structs.Access, error) {
+	roles, err := data.GetUserRolesFromDb(permanentId)
+	if err != nil {
+		return structs.Access{}, errors.WithStack(err)
+	}
+
+	permissions, err := data.GetUserPermissionsFromDb(permanentId)
+	if err != nil {
+		return structs.Access{}, errors.WithStack(err)
+	}
+	return structs.Access{PermanentId: permanentId, Roles: roles, Permissions: permissions}, nil
+}
+
+// RequirePermission возвращает middleware, пропускающий запрос, только если у пользователя
+// есть все перечисленные права. Без прав только загружает роли пользователя.
+//
+// Роли и права кладутся в контекст запроса, обработчики получают их через AccessFromContext.
+// Без cookie сессии перенаправляет на страницу входа, при нехватке прав отображает страницу 403.
+// Отмененная, истекшая сессия и сессия заблокированного аккаунта не пропускаются (см. activeSession).
+// User agent и refresh токен не проверяет и активность не продлевает, поэтому подключается
+// после AuthGuardForHomePath:
+//
+//	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Get(...)
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cookie, err := data.GetTemporaryIdFromCookies(r)
+			if err != nil {
+				http.Redirect(w, r, consts.SignInURL, http.StatusFound)
+				return
+			}
+
+			permanentId, _, _, ok := activeSession(w, r, cookie.Value, loadSessionLifetime(), time.Now().Unix())
+			if !ok {
+				return
+			}
+
+			access, err := loadAccess(permanentId)
+			if err != nil {
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+
+			for _, permission := range permissions {
+				if !slices.Contains(access.Permissions, permission) {
+					tmpls.Forbidden(w, r, "permissionRequired")
+					return
+				}
+			}
+
+			ctx := context.WithValue(r.Context(), consts.AccessCtxKey, access)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// AccessFromContext получает роли и права пользователя, загруженные RequirePermission.
+//
+// Возвращает false, если маршрут не защищен RequirePermission.
+func AccessFromContext(r *http.Request) (structs.Access, bool) {
+	access, ok := r.Context().Value(consts.AccessCtxKey).(structs.Access)
+	return access, ok
+}
+
+// HasPermission проверяет, что у пользователя текущего запроса есть право permission.
+func HasPermission(r *http.Request, permission string) bool {
+	access, ok := AccessFromContext(r)
+	return ok && slices.Contains(access.Permissions, permission)
+}
@@ -0,0 +1,184 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует проверку прав доступа по ролям.
+package auth
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupPermissionTest подменяет получение ролей и прав пользователя perm123.
+// Сессия temp-id действует, аккаунт активен.
+func setupPermissionTest(t *testing.T, roles, permissions []string) func() {
+	oldGetUserRolesFromDb := data.GetUserRolesFromDb
+	oldGetUserPermissionsFromDb := data.GetUserPermissionsFromDb
+	oldGetTemporaryIdActivityFromDb := data.GetTemporaryIdActivityFromDb
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+
+	now := time.Now().Unix()
+	data.GetTemporaryIdActivityFromDb = func(temporaryId string) (structs.SessionActivity, error) {
+		assert.Equal(t, "temp-id", temporaryId)
+		return structs.SessionActivity{CreatedAt: now, LastActivityAt: now}, nil
+	}
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
+	data.GetUserRolesFromDb = func(permanentId string) ([]string, error) {
+		assert.Equal(t, "perm123", permanentId)
+		return roles, nil
+	}
+	data.GetUserPermissionsFromDb = func(permanentId string) ([]string, error) {
+		assert.Equal(t, "perm123", permanentId)
+		return permissions, nil
+	}
+
+	return func() {
+		data.GetUserRolesFromDb = oldGetUserRolesFromDb
+		data.GetUserPermissionsFromDb = oldGetUserPermissionsFromDb
+		data.GetTemporaryIdActivityFromDb = oldGetTemporaryIdActivityFromDb
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
+	}
+}
+
+// TestRequirePermission проверяет доступ к маршруту по правам пользователя.
+// Ожидается: пользователь со всеми правами проходит дальше и получает роли в контексте,
+// при нехватке хотя бы одного права - 403.
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []string
+		allowed     bool
+	}{
+		{name: "all permissions", permissions: []string{consts.PermissionAdminUsers, consts.PermissionRolesManage}, allowed: true},
+		{name: "missing permission", permissions: []string{consts.PermissionAdminUsers}, allowed: false},
+		{name: "no roles", permissions: nil, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			defer setupPermissionTest(t, []string{"admin"}, tt.permissions)()
+
+			tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+				assert.Equal(t, "err403", templateName)
+				return nil
+			}
+			expectProfileUser(mock)
+
+			var access structs.Access
+			var canManageRoles bool
+			nextCalled := false
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				access, _ = AccessFromContext(r)
+				canManageRoles = HasPermission(r, consts.PermissionRolesManage)
+			})
+			w := httptest.NewRecorder()
+			RequirePermission(consts.PermissionAdminUsers, consts.PermissionRolesManage)(next).ServeHTTP(w, profileRequest("/admin", nil))
+
+			assert.Equal(t, tt.allowed, nextCalled)
+			if tt.allowed {
+				assert.Equal(t, "perm123", access.PermanentId)
+				assert.Equal(t, []string{"admin"}, access.Roles)
+				assert.True(t, canManageRoles)
+			} else {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestRequirePermission_NoSession проверяет запрос без cookie сессии.
+// Ожидается: перенаправление на страницу входа.
+func TestRequirePermission_NoSession(t *testing.T) {
+	nextCalled := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+	w := httptest.NewRecorder()
+	RequirePermission(consts.PermissionAdminUsers)(next).ServeHTTP(w, httptest.NewRequest("GET", "/admin", nil))
+
+	assert.False(t, nextCalled)
+	assert.Equal(t, consts.SignInURL, w.Header().Get("Location"))
+}
+
+// TestRequirePermission_InactiveSession проверяет отмененную сессию и сессию заблокированного аккаунта.
+// Ожидается: права не проверяются, cookie очищается, перенаправление на страницу входа,
+// сессия заблокированного аккаунта отменяется с сообщением о блокировке.
+func TestRequirePermission_InactiveSession(t *testing.T) {
+	t.Run("cancelled", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		defer setupPermissionTest(t, []string{"admin"}, []string{consts.PermissionAdminUsers})()
+
+		data.GetTemporaryIdActivityFromDb = func(temporaryId string) (structs.SessionActivity, error) {
+			return structs.SessionActivity{}, errors.WithStack(sql.ErrNoRows)
+		}
+		data.GetUserPermissionsFromDb = func(permanentId string) ([]string, error) {
+			t.Error("permissions should not be loaded")
+			return nil, nil
+		}
+		expectProfileUser(mock)
+
+		nextCalled := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+		w := httptest.NewRecorder()
+		RequirePermission(consts.PermissionAdminUsers)(next).ServeHTTP(w, profileRequest("/admin", nil))
+
+		assert.False(t, nextCalled)
+		assert.Equal(t, consts.SignInURL, w.Header().Get("Location"))
+		assert.Contains(t, w.Header().Get("Set-Cookie"), "Max-Age=0")
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("disabled account", func(t *testing.T) {
+		mock, teardown := setupProfileTest(t)
+		defer teardown()
+		defer setupPermissionTest(t, []string{"admin"}, []string{consts.PermissionAdminUsers})()
+
+		data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+			return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusDisabled}, nil
+		}
+		expectProfileUser(mock)
+		mock.ExpectBegin()
+		mock.ExpectExec(data.TemporaryIdCancelledUpdateQuery).
+			WithArgs("perm123", "test-agent").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(data.RefreshTokenCancelledUpdateQuery).
+			WithArgs("perm123", "test-agent").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		nextCalled := false
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nextCalled = true })
+		w := httptest.NewRecorder()
+		RequirePermission(consts.PermissionAdminUsers)(next).ServeHTTP(w, profileRequest("/admin", nil))
+
+		assert.False(t, nextCalled)
+		assert.Equal(t, consts.SignInURL+"?msg=accountDisabled", w.Header().Get("Location"))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestHasPermission проверяет права маршрута без RequirePermission.
+// Ожидается: в контексте нет ролей, права отсутствуют.
+func TestHasPermission(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+
+	_, ok := AccessFromContext(req)
+	assert.False(t, ok)
+	assert.False(t, HasPermission(req, consts.PermissionAdminUsers))
+}
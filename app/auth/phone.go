@@ -0,0 +1,241 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит HTTP-обработчики номера телефона на странице профиля:
+//   - ChangePhone: отправляет код подтверждения в SMS на новый номер
+//   - ConfirmPhoneChange: подтверждает код и сохраняет номер
+//   - RemovePhone: удаляет номер из профиля
+//
+// Номер сохраняется только после подтверждения кодом из SMS, так как по нему
+// затем отправляются коды подтверждения.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// ChangePhone отправляет код подтверждения в SMS на новый номер телефона.
+//
+// Приводит номер к формату E.164 и проверяет, что он не занят другим пользователем.
+// Соблюдает те же паузу и квоты отправки кодов, что и смена email: при превышении
+// отвечает статусом 429 с заголовком Retry-After.
+// Номер меняется только после подтверждения кода в ConfirmPhoneChange,
+// до этого смена хранится в сессии входа.
+func ChangePhone(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if !tools.SMSEnabled() {
+		renderProfile(w, r, permanentId, "smsUnavailable", 0, http.StatusOK)
+		return
+	}
+
+	newPhone, err := tools.PhoneNormalize(r.FormValue("phone"))
+	if err != nil {
+		renderProfile(w, r, permanentId, "phoneInvalid", 0, http.StatusOK)
+		return
+	}
+
+	oldPhone, err := data.GetPhoneFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if newPhone == oldPhone {
+		renderProfile(w, r, permanentId, "phoneUnchanged", 0, http.StatusOK)
+		return
+	}
+
+	if _, err := data.GetPermanentIdFromDbByPhone(newPhone); err == nil {
+		renderProfile(w, r, permanentId, "phoneAlreadyExist", 0, http.StatusOK)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change := structs.PhoneChange{PermanentId: permanentId, NewPhone: newPhone}
+	if pending, err := data.GetPhoneChangeFromSession(r); err == nil && pending.PermanentId == permanentId {
+		change.ServerCodeSendedConter = pending.ServerCodeSendedConter
+		change.ServerCodeSendedAt = pending.ServerCodeSendedAt
+	}
+
+	now := time.Now().Unix()
+	quotaUser := structs.User{Phone: newPhone, CodeChannel: consts.CodeChannelSMS, ServerCodeSendedConter: change.ServerCodeSendedConter, ServerCodeSendedAt: change.ServerCodeSendedAt}
+	msgKey, retryAfter, err := reserveServerAuthCodeSend(quotaUser, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if msgKey != "" {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+		renderProfile(w, r, permanentId, msgKey, retryAfter, http.StatusTooManyRequests)
+		return
+	}
+
+	serverCode, err := sendServerAuthCode(i18n.Locale(r), quotaUser)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change.ServerCode = serverCode
+	change.ServerCodeSendedConter++
+	change.ServerCodeSendedAt = now
+	if err := data.SetPhoneChangeInSession(w, r, change); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToProfile(w, r, "phoneChangeCodeSent")
+}
+
+// ConfirmPhoneChange подтверждает код и сохраняет номер телефона пользователя.
+//
+// Сверяет код со сменой номера из сессии и повторно проверяет, что номер не занят
+// (если номер одновременно подтвердил другой пользователь, вставку отклонит уникальный индекс).
+// В транзакции сохраняет номер (прежний помечается cancelled) и запись в журнале изменений.
+func ConfirmPhoneChange(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change, err := data.GetPhoneChangeFromSession(r)
+	if err != nil || change.PermanentId != permanentId {
+		renderProfile(w, r, permanentId, "phoneChangeNotPending", 0, http.StatusOK)
+		return
+	}
+
+	if err := tools.CodeValidate(r, r.FormValue("clientCode"), change.ServerCode); err != nil {
+		renderProfile(w, r, permanentId, "wrongCode", 0, http.StatusOK)
+		return
+	}
+
+	oldPhone, err := data.GetPhoneFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if _, err := data.GetPermanentIdFromDbByPhone(change.NewPhone); err == nil {
+		renderProfile(w, r, permanentId, "phoneAlreadyExist", 0, http.StatusOK)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetPhoneInDbTx(tx, permanentId, change.NewPhone); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrPhoneAlreadyExist) {
+			renderProfile(w, r, permanentId, "phoneAlreadyExist", 0, http.StatusOK)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	profileChange := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldPhone, OldValue: oldPhone, NewValue: change.NewPhone}
+	if err := data.SetProfileChangeInDbTx(tx, profileChange, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.DeletePhoneChangeFromSession(w, r); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToProfile(w, r, "phoneChanged")
+}
+
+// RemovePhone удаляет номер телефона из профиля.
+//
+// В транзакции помечает номер cancelled и фиксирует удаление в журнале изменений.
+// После удаления коды подтверждения отправляются только на email.
+func RemovePhone(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	oldPhone, err := data.GetPhoneFromDb(permanentId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			renderProfile(w, r, permanentId, "phoneNotSet", 0, http.StatusOK)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetPhoneCancelledInDbTx(tx, permanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	profileChange := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldPhone, OldValue: oldPhone}
+	if err := data.SetProfileChangeInDbTx(tx, profileChange, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToProfile(w, r, "phoneRemoved")
+}
@@ -0,0 +1,274 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует смену, подтверждение и удаление номера телефона на странице профиля.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestChangePhone_SendsCode проверяет отправку кода в SMS на новый номер.
+// Ожидается: номер приведен к E.164, код отправлен в SMS и учтен по номеру,
+// смена сохранена в сессии, номер в БД не меняется.
+func TestChangePhone_SendsCode(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	t.Setenv("SMS_DRIVER", "log")
+	data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) { return "", sql.ErrNoRows }
+	reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) {
+		assert.Equal(t, "+79991234567", codeRecipient(user))
+		return "", 0, nil
+	}
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		assert.Equal(t, "+79991234567", phone)
+		return "1234", nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent to email")
+		return "", nil
+	}
+	var savedChange structs.PhoneChange
+	data.SetPhoneChangeInSession = func(w http.ResponseWriter, r *http.Request, change structs.PhoneChange) error {
+		savedChange = change
+		return nil
+	}
+	data.SetPhoneInDbTx = func(tx *sql.Tx, permanentId, phone string) error {
+		t.Error("phone should not be saved before confirmation")
+		return nil
+	}
+
+	expectProfileUser(mock)
+
+	w := httptest.NewRecorder()
+	ChangePhone(w, profileRequest("/profile/phone", url.Values{"phone": {"+7 (999) 123-45-67"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=phoneChangeCodeSent", w.Header().Get("Location"))
+	assert.Equal(t, structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79991234567", ServerCode: "1234", ServerCodeSendedConter: 1, ServerCodeSendedAt: savedChange.ServerCodeSendedAt}, savedChange)
+	assert.NotZero(t, savedChange.ServerCodeSendedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangePhone_Rejected проверяет отклонение номера до отправки кода.
+// Ожидается: сообщение на странице профиля, SMS не отправляется.
+func TestChangePhone_Rejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		smsDriver string
+		phone     string
+		msgKey    string
+	}{
+		{"sms not configured", "", "+79991234567", "smsUnavailable"},
+		{"invalid phone", "log", "12345", "phoneInvalid"},
+		{"same phone", "log", "+79991234567", "phoneUnchanged"},
+		{"phone taken", "log", "+79997654321", "phoneAlreadyExist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+
+			t.Setenv("SMS_DRIVER", tt.smsDriver)
+			data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+			data.GetPhoneFromDb = func(permanentId string) (string, error) { return "+79991234567", nil }
+			data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) { return "perm456", nil }
+			tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+				t.Error("code should not be sent")
+				return "", nil
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			ChangePhone(w, profileRequest("/profile/phone", url.Values{"phone": {tt.phone}}))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestChangePhone_QuotaExceeded проверяет ограничение отправки кодов при смене номера.
+// Ожидается: HTTP 429, заголовок Retry-After, SMS не отправляется.
+func TestChangePhone_QuotaExceeded(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	t.Setenv("SMS_DRIVER", "log")
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) { return "", sql.ErrNoRows }
+	reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) {
+		assert.Equal(t, consts.CodeChannelSMS, user.CodeChannel)
+		return "serverCodeSendCooldown", 42, nil
+	}
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangePhone(w, profileRequest("/profile/phone", url.Values{"phone": {"+79991234567"}}))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "42", w.Header().Get("Retry-After"))
+	assert.Equal(t, i18n.Text(i18n.En, "serverCodeSendCooldown"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmPhoneChange_Success проверяет подтверждение номера телефона.
+// Ожидается: номер и запись журнала в одной транзакции, смена удалена из сессии.
+func TestConfirmPhoneChange_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetPhoneChangeFromSession = func(r *http.Request) (structs.PhoneChange, error) {
+		return structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79997654321", ServerCode: "1234"}, nil
+	}
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "+79991234567", nil }
+	data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) { return "", sql.ErrNoRows }
+	var savedPhone string
+	data.SetPhoneInDbTx = func(tx *sql.Tx, permanentId, phone string) error {
+		savedPhone = phone
+		return nil
+	}
+	var savedChange structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		savedChange = change
+		return nil
+	}
+	sessionDeleted := false
+	data.DeletePhoneChangeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+		sessionDeleted = true
+		return nil
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	ConfirmPhoneChange(w, profileRequest("/profile/phone/confirm", url.Values{"clientCode": {"1234"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=phoneChanged", w.Header().Get("Location"))
+	assert.Equal(t, "+79997654321", savedPhone)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldPhone, OldValue: "+79991234567", NewValue: "+79997654321"}, savedChange)
+	assert.True(t, sessionDeleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmPhoneChange_Rejected проверяет неверный код, отсутствие ожидающей смены
+// и номер, подтвержденный другим пользователем после отправки кода.
+// Ожидается: сообщение на странице профиля, номер не сохраняется.
+func TestConfirmPhoneChange_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		change structs.PhoneChange
+		owner  string
+		msgKey string
+	}{
+		{"wrong code", structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79997654321", ServerCode: "9999"}, "", "wrongCode"},
+		{"change of another user", structs.PhoneChange{PermanentId: "perm456", NewPhone: "+79997654321", ServerCode: "1234"}, "", "phoneChangeNotPending"},
+		{"phone taken", structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79997654321", ServerCode: "1234"}, "perm456", "phoneAlreadyExist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+
+			data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+			data.GetPhoneChangeFromSession = func(r *http.Request) (structs.PhoneChange, error) { return tt.change, nil }
+			data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) {
+				if tt.owner == "" {
+					return "", sql.ErrNoRows
+				}
+				return tt.owner, nil
+			}
+			data.SetPhoneInDbTx = func(tx *sql.Tx, permanentId, phone string) error {
+				t.Error("phone should not be saved")
+				return nil
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			ConfirmPhoneChange(w, profileRequest("/profile/phone/confirm", url.Values{"clientCode": {"1234"}}))
+
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestRemovePhone проверяет удаление номера телефона.
+// Ожидается: номер помечен cancelled и удаление записано в журнал; без номера - сообщение phoneNotSet.
+func TestRemovePhone(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "+79991234567", nil }
+	cancelled := false
+	data.SetPhoneCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		cancelled = permanentId == "perm123"
+		return nil
+	}
+	var savedChange structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		savedChange = change
+		return nil
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	RemovePhone(w, profileRequest("/profile/phone/remove", url.Values{}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=phoneRemoved", w.Header().Get("Location"))
+	assert.True(t, cancelled)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldPhone, OldValue: "+79991234567"}, savedChange)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "", errors.WithStack(sql.ErrNoRows) }
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w = httptest.NewRecorder()
+	RemovePhone(w, profileRequest("/profile/phone/remove", url.Values{}))
+
+	assert.Equal(t, i18n.Text(i18n.En, "phoneNotSet"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
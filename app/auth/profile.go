@@ -0,0 +1,510 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит HTTP-обработчики страницы профиля:
+//   - Profile: отображает текущие логин, email и номер телефона
+//   - ChangeLogin: меняет логин пользователя
+//   - ChangeEmail: отправляет код подтверждения на новый email
+//   - ConfirmEmailChange: подтверждает код и меняет email
+//   - UndoEmailChange: отменяет смену email по ссылке из письма на прежний адрес
+//
+// Изменения выполняются в транзакции и фиксируются в журнале profile_change,
+// прежние значения сохраняются в таблицах login и email с флагом cancelled.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// profilePermanentId получает permanentId пользователя по temporaryId из cookie.
+func profilePermanentId(r *http.Request) (string, error) {
+	cookie, err := data.GetTemporaryIdFromCookies(r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	permanentId, _, err := data.GetTemporaryIdKeysFromDb(cookie.Value)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return permanentId, nil
+}
+
+// renderProfile отображает страницу профиля с сообщением по ключу msgKey.
+//
+// Подставляет текущие логин, email и номер телефона из БД и новые email и номер,
+// если их смена ожидает подтверждения.
+// У аккаунтов, созданных через Yandex, логина и пароля нет: логин остается пустым,
+// а вместо формы смены пароля отображается форма установки логина и пароля.
+// Статус status, отличный от 200, записывается до рендеринга.
+func renderProfile(w http.ResponseWriter, r *http.Request, permanentId, msgKey string, retryAfter int64, status int) {
+	login, err := data.GetLoginFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	hasPassword, err := data.HasPasswordInDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	phone, err := data.GetPhoneFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	profile := structs.Profile{Login: login, Email: email, Phone: phone, SMSEnabled: tools.SMSEnabled(), HasPassword: hasPassword, RetryAfter: retryAfter, CSRFToken: tmpls.CSRFToken(r)}
+	if i18n.Has(msgKey) {
+		profile.Msg = i18n.Msg(r, msgKey)
+		profile.Regs = i18n.Reqs(r, msgKey)
+	}
+	if change, err := data.GetEmailChangeFromSession(r); err == nil && change.PermanentId == permanentId {
+		profile.PendingEmail = change.NewEmail
+	}
+	if change, err := data.GetPhoneChangeFromSession(r); err == nil && change.PermanentId == permanentId {
+		profile.PendingPhone = change.NewPhone
+	}
+
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+	}
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "profile", profile); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// redirectToProfile перенаправляет на страницу профиля с ключом сообщения.
+func redirectToProfile(w http.ResponseWriter, r *http.Request, msgKey string) {
+	http.Redirect(w, r, consts.ProfileURL+"?msg="+url.QueryEscape(msgKey), http.StatusFound)
+}
+
+// Profile отображает страницу профиля.
+//
+// Принимает параметр msg из URL query как ключ сообщения из каталога i18n;
+// неизвестные ключи игнорируются.
+// При ошибках перенаправляет на страницу 500.
+func Profile(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	renderProfile(w, r, permanentId, r.URL.Query().Get("msg"), 0, http.StatusOK)
+}
+
+// ChangeLogin меняет логин пользователя.
+//
+// Проверяет логин регулярным выражением и уникальность среди действующих логинов.
+// В транзакции сохраняет новый логин (прежний помечается cancelled) и запись в журнале изменений.
+// При успехе перенаправляет на страницу профиля с сообщением.
+func ChangeLogin(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	login := r.FormValue("login")
+	if err := tools.LoginValidate(login); err != nil {
+		renderProfile(w, r, permanentId, "loginInvalid", 0, http.StatusOK)
+		return
+	}
+
+	// У аккаунта, созданного через Yandex, прежнего логина нет
+	oldLogin, err := data.GetLoginFromDb(permanentId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if login == oldLogin {
+		renderProfile(w, r, permanentId, "loginUnchanged", 0, http.StatusOK)
+		return
+	}
+
+	if _, err := data.GetPermanentIdFromDbByLogin(login); err == nil {
+		renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetLoginInDbTx(tx, permanentId, login); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrLoginAlreadyExist) {
+			renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldLogin, OldValue: oldLogin, NewValue: login}
+	if err := data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToProfile(w, r, "loginChanged")
+}
+
+// ChangeEmail отправляет код подтверждения на новый email.
+//
+// Проверяет формат email, ограничения доменов из правил регистрации (emailDomainMsgKey),
+// чтобы сменой email нельзя было обойти запрет доменов, и что адрес не занят другим пользователем.
+// Соблюдает те же паузу и квоты отправки кодов, что и регистрация: при превышении
+// отвечает статусом 429 с заголовком Retry-After.
+// Email меняется только после подтверждения кода в ConfirmEmailChange,
+// до этого смена хранится в сессии входа.
+func ChangeEmail(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	newEmail := r.FormValue("email")
+	if err := tools.EmailValidate(newEmail); err != nil {
+		renderProfile(w, r, permanentId, "emailInvalid", 0, http.StatusOK)
+		return
+	}
+	if msgKey := loadSignUpPolicy().emailDomainMsgKey(newEmail); msgKey != "" {
+		renderProfile(w, r, permanentId, msgKey, 0, http.StatusOK)
+		return
+	}
+
+	oldEmail, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if newEmail == oldEmail {
+		renderProfile(w, r, permanentId, "emailUnchanged", 0, http.StatusOK)
+		return
+	}
+
+	yauth := false
+	if _, err := data.GetPermanentIdFromDbByEmail(newEmail, yauth); err == nil {
+		renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change := structs.EmailChange{PermanentId: permanentId, NewEmail: newEmail}
+	if pending, err := data.GetEmailChangeFromSession(r); err == nil && pending.PermanentId == permanentId {
+		change.ServerCodeSendedConter = pending.ServerCodeSendedConter
+		change.ServerCodeSendedAt = pending.ServerCodeSendedAt
+	}
+
+	now := time.Now().Unix()
+	quotaUser := structs.User{Email: newEmail, ServerCodeSendedConter: change.ServerCodeSendedConter, ServerCodeSendedAt: change.ServerCodeSendedAt}
+	msgKey, retryAfter, err := reserveServerAuthCodeSend(quotaUser, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if msgKey != "" {
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+		renderProfile(w, r, permanentId, msgKey, retryAfter, http.StatusTooManyRequests)
+		return
+	}
+
+	serverCode, err := tools.ServerAuthCodeSend(i18n.Locale(r), newEmail)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change.ServerCode = serverCode
+	change.ServerCodeSendedConter++
+	change.ServerCodeSendedAt = now
+	if err := data.SetEmailChangeInSession(w, r, change); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	redirectToProfile(w, r, "emailChangeCodeSent")
+}
+
+// ConfirmEmailChange подтверждает код и меняет email пользователя.
+//
+// Сверяет код со сменой email из сессии. Число неверных кодов ограничено
+// (см. failedAttemptsRetryAfter): попытка, исчерпавшая лимит, отменяет смену email в сессии.
+// В транзакции сохраняет новый email
+// (прежний помечается cancelled) и запись в журнале изменений с токеном отмены.
+// После фиксации отправляет на прежний адрес уведомление со ссылкой отмены.
+func ConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	permanentId, err := profilePermanentId(r)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	change, err := data.GetEmailChangeFromSession(r)
+	if err != nil || change.PermanentId != permanentId {
+		renderProfile(w, r, permanentId, "emailChangeNotPending", 0, http.StatusOK)
+		return
+	}
+
+	now := time.Now().Unix()
+	retryAfter, err := failedAttemptsRetryAfter(permanentId, data.FailedAttemptEmailChangeCode, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if retryAfter > 0 {
+		renderTooManyAttempts(w, r, permanentId, retryAfter)
+		return
+	}
+
+	if err := tools.CodeValidate(r, r.FormValue("clientCode"), change.ServerCode); err != nil {
+		exhausted, err := recordFailedAttempt(permanentId, data.FailedAttemptEmailChangeCode, now)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		if !exhausted {
+			renderProfile(w, r, permanentId, "wrongCode", 0, http.StatusOK)
+			return
+		}
+		if err := data.DeleteEmailChangeFromSession(w, r); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		renderProfile(w, r, permanentId, "emailChangeAttemptsExceeded", 0, http.StatusOK)
+		return
+	}
+
+	if err := data.DeleteFailedAttemptsFromDb(permanentId, data.FailedAttemptEmailChangeCode); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	oldEmail, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	yauth := false
+	if _, err := data.GetPermanentIdFromDbByEmail(change.NewEmail, yauth); err == nil {
+		renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+		return
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	baseURL := tmpls.PublicURL("/profile/email/undo")
+	undoLink, err := tools.GenerateEmailChangeUndoLink(oldEmail, change.NewEmail, baseURL)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	parsedUndoLink, err := url.Parse(undoLink)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	undoToken := parsedUndoLink.Query().Get("token")
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetEmailInDbTx(tx, permanentId, change.NewEmail, yauth); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrEmailAlreadyExist) {
+			renderProfile(w, r, permanentId, "userAlreadyExist", 0, http.StatusOK)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	profileChange := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldEmail, OldValue: oldEmail, NewValue: change.NewEmail}
+	if err := data.SetProfileChangeInDbTx(tx, profileChange, undoToken, now); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.DeleteEmailChangeFromSession(w, r); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if notificationEnabled(permanentId, data.NotificationEmailChange) {
+		alert := securityAlert(r, permanentId, oldEmail, data.NotificationEmailChange)
+		if err := tools.EmailChangeNotificationSend(i18n.Locale(r), oldEmail, change.NewEmail, undoLink, alert); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	redirectToProfile(w, r, "emailChanged")
+}
+
+// UndoEmailChange отменяет смену email по токену из письма на прежний адрес.
+//
+// Проверяет подпись и срок токена и что он не использован. В транзакции возвращает
+// прежний email, помечает смену отмененной, фиксирует отмену в журнале, завершает
+// все сессии пользователя и отменяет доверие к его устройствам, так как смена
+// могла быть выполнена злоумышленником.
+// Если токен невалиден или прежний email уже занят, перенаправляет на страницу входа с сообщением.
+func UndoEmailChange(w http.ResponseWriter, r *http.Request) {
+	undoToken := r.FormValue("token")
+	invalidURL := consts.SignInURL + "?msg=emailChangeUndoInvalid"
+
+	claims, err := tools.EmailChangeUndoTokenValidate(undoToken)
+	if err != nil {
+		http.Redirect(w, r, invalidURL, http.StatusFound)
+		return
+	}
+
+	change, err := data.GetEmailChangeByUndoTokenFromDb(undoToken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Redirect(w, r, invalidURL, http.StatusFound)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if claims.OldEmail != change.OldValue || claims.NewEmail != change.NewValue {
+		http.Redirect(w, r, invalidURL, http.StatusFound)
+		return
+	}
+
+	yauth := false
+	if permanentId, err := data.GetPermanentIdFromDbByEmail(change.OldValue, yauth); err == nil && permanentId != change.PermanentId {
+		http.Redirect(w, r, invalidURL, http.StatusFound)
+		return
+	} else if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetEmailInDbTx(tx, change.PermanentId, change.OldValue, yauth); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrEmailAlreadyExist) {
+			http.Redirect(w, r, invalidURL, http.StatusFound)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.SetProfileChangeCancelledInDbTx(tx, undoToken); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	undoChange := structs.ProfileChange{PermanentId: change.PermanentId, Field: data.ProfileFieldEmail, OldValue: change.NewValue, NewValue: change.OldValue}
+	if err := data.SetProfileChangeInDbTx(tx, undoChange, "", time.Now().Unix()); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.SetAllTemporaryIdsCancelledInDbTx(tx, change.PermanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.SetAllRefreshTokensCancelledInDbTx(tx, change.PermanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.SetTrustedDevicesCancelledInDbTx(tx, change.PermanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	data.ClearTemporaryIdInCookies(w)
+	http.Redirect(w, r, consts.SignInURL+"?msg=emailChangeUndone", http.StatusFound)
+}
@@ -0,0 +1,735 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует страницу профиля: смену логина, смену email с подтверждением и ее отмену.
+package auth
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trustedDevicesCancelledFor - пользователь, доверие к устройствам которого отменено в тесте.
+var trustedDevicesCancelledFor string
+
+// setupProfileTest создает мок базы данных и сохраняет подменяемые зависимости профиля.
+// Отмена доверенных устройств сохраняет пользователя в trustedDevicesCancelledFor.
+// Возвращает мок и функцию восстановления.
+func setupProfileTest(t *testing.T) (sqlmock.Sqlmock, func()) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	oldDB := data.Db
+	oldTmplsRenderer := tmpls.TmplsRenderer
+	oldGetLoginFromDb := data.GetLoginFromDb
+	oldHasPasswordInDb := data.HasPasswordInDb
+	oldGetPermanentIdFromDbByLogin := data.GetPermanentIdFromDbByLogin
+	oldGetPermanentIdFromDbByEmail := data.GetPermanentIdFromDbByEmail
+	oldSetLoginInDbTx := data.SetLoginInDbTx
+	oldSetEmailInDbTx := data.SetEmailInDbTx
+	oldSetProfileChangeInDbTx := data.SetProfileChangeInDbTx
+	oldGetEmailChangeFromSession := data.GetEmailChangeFromSession
+	oldSetEmailChangeInSession := data.SetEmailChangeInSession
+	oldDeleteEmailChangeFromSession := data.DeleteEmailChangeFromSession
+	oldGetEmailChangeByUndoTokenFromDb := data.GetEmailChangeByUndoTokenFromDb
+	oldSetProfileChangeCancelledInDbTx := data.SetProfileChangeCancelledInDbTx
+	oldSetAllTemporaryIdsCancelledInDbTx := data.SetAllTemporaryIdsCancelledInDbTx
+	oldSetAllRefreshTokensCancelledInDbTx := data.SetAllRefreshTokensCancelledInDbTx
+	oldCheckServerAuthCodeSendQuota := reserveServerAuthCodeSend
+	oldServerAuthCodeSend := tools.ServerAuthCodeSend
+	oldGenerateEmailChangeUndoLink := tools.GenerateEmailChangeUndoLink
+	oldEmailChangeUndoTokenValidate := tools.EmailChangeUndoTokenValidate
+	oldEmailChangeNotificationSend := tools.EmailChangeNotificationSend
+	oldGenerateSecurityAlertLink := tools.GenerateSecurityAlertLink
+	oldSetSecurityAlertTokenInDb := data.SetSecurityAlertTokenInDb
+	oldGetPhoneFromDb := data.GetPhoneFromDb
+	oldGetPermanentIdFromDbByPhone := data.GetPermanentIdFromDbByPhone
+	oldSetPhoneInDbTx := data.SetPhoneInDbTx
+	oldSetPhoneCancelledInDbTx := data.SetPhoneCancelledInDbTx
+	oldGetPhoneChangeFromSession := data.GetPhoneChangeFromSession
+	oldSetPhoneChangeInSession := data.SetPhoneChangeInSession
+	oldDeletePhoneChangeFromSession := data.DeletePhoneChangeFromSession
+	oldServerAuthCodeSMSSend := tools.ServerAuthCodeSMSSend
+	oldGetFailedAttemptsFromDb := data.GetFailedAttemptsFromDb
+	oldSetFailedAttemptInDb := data.SetFailedAttemptInDb
+	oldDeleteFailedAttemptsFromDb := data.DeleteFailedAttemptsFromDb
+	oldSetTrustedDevicesCancelledInDbTx := data.SetTrustedDevicesCancelledInDbTx
+
+	data.Db = db
+	trustedDevicesCancelledFor = ""
+	data.SetTrustedDevicesCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		trustedDevicesCancelledFor = permanentId
+		return nil
+	}
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) { return 0, 0, nil }
+	data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error { return nil }
+	data.DeleteFailedAttemptsFromDb = func(permanentId, kind string) error { return nil }
+	tools.GenerateSecurityAlertLink = func(permanentId, email, event, baseURL string) (string, error) {
+		return baseURL + "?token=alert-token", nil
+	}
+	data.SetSecurityAlertTokenInDb = func(token, permanentId string) error { return nil }
+	data.HasPasswordInDb = func(permanentId string) (bool, error) { return true, nil }
+	data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+		return structs.EmailChange{}, errors.New("emailChange not exist")
+	}
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "", errors.WithStack(sql.ErrNoRows) }
+	data.GetPhoneChangeFromSession = func(r *http.Request) (structs.PhoneChange, error) {
+		return structs.PhoneChange{}, errors.New("phoneChange not exist")
+	}
+
+	return mock, func() {
+		data.Db = oldDB
+		db.Close()
+		tmpls.TmplsRenderer = oldTmplsRenderer
+		data.GetLoginFromDb = oldGetLoginFromDb
+		data.HasPasswordInDb = oldHasPasswordInDb
+		data.GetPermanentIdFromDbByLogin = oldGetPermanentIdFromDbByLogin
+		data.GetPermanentIdFromDbByEmail = oldGetPermanentIdFromDbByEmail
+		data.SetLoginInDbTx = oldSetLoginInDbTx
+		data.SetEmailInDbTx = oldSetEmailInDbTx
+		data.SetProfileChangeInDbTx = oldSetProfileChangeInDbTx
+		data.GetEmailChangeFromSession = oldGetEmailChangeFromSession
+		data.SetEmailChangeInSession = oldSetEmailChangeInSession
+		data.DeleteEmailChangeFromSession = oldDeleteEmailChangeFromSession
+		data.GetEmailChangeByUndoTokenFromDb = oldGetEmailChangeByUndoTokenFromDb
+		data.SetProfileChangeCancelledInDbTx = oldSetProfileChangeCancelledInDbTx
+		data.SetAllTemporaryIdsCancelledInDbTx = oldSetAllTemporaryIdsCancelledInDbTx
+		data.SetAllRefreshTokensCancelledInDbTx = oldSetAllRefreshTokensCancelledInDbTx
+		reserveServerAuthCodeSend = oldCheckServerAuthCodeSendQuota
+		tools.ServerAuthCodeSend = oldServerAuthCodeSend
+		tools.GenerateEmailChangeUndoLink = oldGenerateEmailChangeUndoLink
+		tools.EmailChangeUndoTokenValidate = oldEmailChangeUndoTokenValidate
+		tools.EmailChangeNotificationSend = oldEmailChangeNotificationSend
+		tools.GenerateSecurityAlertLink = oldGenerateSecurityAlertLink
+		data.SetSecurityAlertTokenInDb = oldSetSecurityAlertTokenInDb
+		data.GetPhoneFromDb = oldGetPhoneFromDb
+		data.GetPermanentIdFromDbByPhone = oldGetPermanentIdFromDbByPhone
+		data.SetPhoneInDbTx = oldSetPhoneInDbTx
+		data.SetPhoneCancelledInDbTx = oldSetPhoneCancelledInDbTx
+		data.GetPhoneChangeFromSession = oldGetPhoneChangeFromSession
+		data.SetPhoneChangeInSession = oldSetPhoneChangeInSession
+		data.DeletePhoneChangeFromSession = oldDeletePhoneChangeFromSession
+		tools.ServerAuthCodeSMSSend = oldServerAuthCodeSMSSend
+		data.GetFailedAttemptsFromDb = oldGetFailedAttemptsFromDb
+		data.SetFailedAttemptInDb = oldSetFailedAttemptInDb
+		data.DeleteFailedAttemptsFromDb = oldDeleteFailedAttemptsFromDb
+		data.SetTrustedDevicesCancelledInDbTx = oldSetTrustedDevicesCancelledInDbTx
+	}
+}
+
+// profileRequest создает POST запрос профиля с формой и cookie temporaryId.
+func profileRequest(path string, form url.Values) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	signed, _ := data.SignTemporaryId("temp-id")
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signed})
+	return req
+}
+
+// expectProfileUser ожидает запрос permanentId по temporaryId.
+func expectProfileUser(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(data.TemporaryIdSelectQuery).
+		WithArgs("temp-id").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "userAgent"}).AddRow("perm123", "test-agent"))
+}
+
+// expectProfileEmail ожидает запрос текущего email пользователя.
+func expectProfileEmail(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(data.EmailSelectQuery).
+		WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("old@example.com"))
+}
+
+// captureProfile подменяет рендеринг и сохраняет данные страницы профиля.
+func captureProfile(t *testing.T, profile *structs.Profile) {
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "profile", templateName)
+		*profile = data.(structs.Profile)
+		return nil
+	}
+}
+
+// TestProfile проверяет отображение страницы профиля.
+// Ожидается: текущие логин, email и номер телефона, ожидающие подтверждения email и номер
+// и сообщение по ключу из query.
+func TestProfile(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+		return structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com"}, nil
+	}
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "+79991234567", nil }
+	data.GetPhoneChangeFromSession = func(r *http.Request) (structs.PhoneChange, error) {
+		return structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79997654321"}, nil
+	}
+	t.Setenv("SMS_DRIVER", "log")
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	req := httptest.NewRequest("GET", "/profile?msg=loginChanged", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	Profile(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user123", profile.Login)
+	assert.Equal(t, "old@example.com", profile.Email)
+	assert.Equal(t, "new@example.com", profile.PendingEmail)
+	assert.Equal(t, "+79991234567", profile.Phone)
+	assert.Equal(t, "+79997654321", profile.PendingPhone)
+	assert.True(t, profile.SMSEnabled)
+	assert.Equal(t, i18n.Text(i18n.En, "loginChanged"), profile.Msg)
+	assert.True(t, profile.HasPassword)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestProfile_YandexAccount проверяет страницу профиля аккаунта, созданного через Yandex.
+// Ожидается: страница отображается без логина и с признаком отсутствия пароля.
+func TestProfile_YandexAccount(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "", errors.WithStack(sql.ErrNoRows) }
+	data.HasPasswordInDb = func(permanentId string) (bool, error) { return false, nil }
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	req := httptest.NewRequest("GET", "/profile", nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+	Profile(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, profile.Login)
+	assert.Equal(t, "old@example.com", profile.Email)
+	assert.False(t, profile.HasPassword)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeLogin_Success проверяет смену логина.
+// Ожидается: новый логин и запись журнала в одной транзакции, редирект на профиль.
+func TestChangeLogin_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "oldLogin", nil }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "", sql.ErrNoRows }
+	var savedLogin string
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		savedLogin = login
+		return nil
+	}
+	var savedChange structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		savedChange = change
+		assert.Empty(t, undoToken)
+		return nil
+	}
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	ChangeLogin(w, profileRequest("/profile/login", url.Values{"login": {"newLogin"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=loginChanged", w.Header().Get("Location"))
+	assert.Equal(t, "newLogin", savedLogin)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldLogin, OldValue: "oldLogin", NewValue: "newLogin"}, savedChange)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeLogin_Rejected проверяет отклонение невалидного, прежнего и занятого логина.
+// Ожидается: страница профиля с сообщением, транзакция не начинается.
+func TestChangeLogin_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		login  string
+		msgKey string
+	}{
+		{"invalid login", "a b", "loginInvalid"},
+		{"same login", "oldLogin", "loginUnchanged"},
+		{"login taken", "takenLogin", "userAlreadyExist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+
+			data.GetLoginFromDb = func(permanentId string) (string, error) { return "oldLogin", nil }
+			data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "perm456", nil }
+			data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+				t.Error("login should not be saved")
+				return nil
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			ChangeLogin(w, profileRequest("/profile/login", url.Values{"login": {tt.login}}))
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestChangeLogin_TakenConcurrently проверяет логин, занятый другим пользователем после проверки.
+// Ожидается: уникальный индекс отклоняет запись, транзакция откатывается, сообщение о занятом логине.
+func TestChangeLogin_TakenConcurrently(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "oldLogin", nil }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "", sql.ErrNoRows }
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		return errors.WithStack(data.ErrLoginAlreadyExist)
+	}
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		t.Error("change should not be logged")
+		return nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeLogin(w, profileRequest("/profile/login", url.Values{"login": {"newLogin"}}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, i18n.Text(i18n.En, "userAlreadyExist"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeEmail_SendsCode проверяет отправку кода на новый email.
+// Ожидается: код отправлен на новый адрес, смена сохранена в сессии, email в БД не меняется.
+func TestChangeEmail_SendsCode(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "", sql.ErrNoRows }
+	reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) {
+		assert.Equal(t, "new@example.com", user.Email)
+		return "", 0, nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		assert.Equal(t, "new@example.com", email)
+		return "1234", nil
+	}
+	var savedChange structs.EmailChange
+	data.SetEmailChangeInSession = func(w http.ResponseWriter, r *http.Request, change structs.EmailChange) error {
+		savedChange = change
+		return nil
+	}
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		t.Error("email should not be saved before confirmation")
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeEmail(w, profileRequest("/profile/email", url.Values{"email": {"new@example.com"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=emailChangeCodeSent", w.Header().Get("Location"))
+	assert.Equal(t, "perm123", savedChange.PermanentId)
+	assert.Equal(t, "new@example.com", savedChange.NewEmail)
+	assert.Equal(t, "1234", savedChange.ServerCode)
+	assert.Equal(t, 1, savedChange.ServerCodeSendedConter)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeEmail_QuotaExceeded проверяет ограничение отправки кодов при смене email.
+// Ожидается: HTTP 429, заголовок Retry-After, код не отправляется.
+func TestChangeEmail_QuotaExceeded(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "", sql.ErrNoRows }
+	reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) {
+		return "serverCodeSendCooldown", 42, nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeEmail(w, profileRequest("/profile/email", url.Values{"email": {"new@example.com"}}))
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "42", w.Header().Get("Retry-After"))
+	assert.Equal(t, i18n.Text(i18n.En, "serverCodeSendCooldown"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeEmail_AlreadyExist проверяет отклонение занятого email.
+// Ожидается: сообщение userAlreadyExist, код не отправляется.
+func TestChangeEmail_AlreadyExist(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "perm456", nil }
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeEmail(w, profileRequest("/profile/email", url.Values{"email": {"taken@example.com"}}))
+
+	assert.Equal(t, i18n.Text(i18n.En, "userAlreadyExist"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestChangeEmail_DomainNotAllowed проверяет ограничения доменов при смене email.
+// Ожидается: сообщение emailDomainNotAllowed, занятость адреса не проверяется, код не отправляется.
+func TestChangeEmail_DomainNotAllowed(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	t.Setenv("SIGNUP_ALLOWED_DOMAINS", "corp.example")
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		t.Error("email should not be looked up")
+		return "", sql.ErrNoRows
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ChangeEmail(w, profileRequest("/profile/email", url.Values{"email": {"user@gmail.com"}}))
+
+	assert.Equal(t, i18n.Text(i18n.En, "emailDomainNotAllowed"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmEmailChange_Success проверяет подтверждение смены email.
+// Ожидается: новый email и запись журнала с токеном отмены в транзакции, уведомление на прежний адрес.
+func TestConfirmEmailChange_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+		return structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com", ServerCode: "1234"}, nil
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "", sql.ErrNoRows }
+	tools.GenerateEmailChangeUndoLink = func(oldEmail, newEmail, baseURL string) (string, error) {
+		assert.Equal(t, "old@example.com", oldEmail)
+		assert.Equal(t, "new@example.com", newEmail)
+		return baseURL + "?token=undo-token", nil
+	}
+	var savedEmail string
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		savedEmail = email
+		return nil
+	}
+	var savedUndoToken string
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldEmail, OldValue: "old@example.com", NewValue: "new@example.com"}, change)
+		savedUndoToken = undoToken
+		return nil
+	}
+	sessionDeleted := false
+	data.DeleteEmailChangeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+		sessionDeleted = true
+		return nil
+	}
+	var notifiedEmail, notifiedLink string
+	tools.EmailChangeNotificationSend = func(locale, oldEmail, newEmail, undoLink string, alert structs.SecurityAlert) error {
+		notifiedEmail, notifiedLink = oldEmail, undoLink
+		assert.Equal(t, data.NotificationEmailChange, alert.Event)
+		assert.Equal(t, "192.0.2.1", alert.IP)
+		return nil
+	}
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	ConfirmEmailChange(w, profileRequest("/profile/email/confirm", url.Values{"clientCode": {"1234"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/profile?msg=emailChanged", w.Header().Get("Location"))
+	assert.Equal(t, "new@example.com", savedEmail)
+	assert.Equal(t, "undo-token", savedUndoToken)
+	assert.True(t, sessionDeleted)
+	assert.Equal(t, "old@example.com", notifiedEmail)
+	assert.Contains(t, notifiedLink, "/profile/email/undo?token=undo-token")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmEmailChange_TakenConcurrently проверяет email, занятый другим пользователем после проверки.
+// Ожидается: уникальный индекс отклоняет запись, транзакция откатывается, уведомление не отправляется,
+// сообщение о занятом адресе.
+func TestConfirmEmailChange_TakenConcurrently(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+		return structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com", ServerCode: "1234"}, nil
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "", sql.ErrNoRows }
+	tools.GenerateEmailChangeUndoLink = func(oldEmail, newEmail, baseURL string) (string, error) {
+		return baseURL + "?token=undo-token", nil
+	}
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		return errors.WithStack(data.ErrEmailAlreadyExist)
+	}
+	tools.EmailChangeNotificationSend = func(locale, oldEmail, newEmail, undoLink string, alert structs.SecurityAlert) error {
+		t.Error("notification should not be sent")
+		return nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ConfirmEmailChange(w, profileRequest("/profile/email/confirm", url.Values{"clientCode": {"1234"}}))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, i18n.Text(i18n.En, "userAlreadyExist"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestConfirmEmailChange_Rejected проверяет неверный код и отсутствие ожидающей смены.
+// Ожидается: сообщение на странице профиля, email не меняется.
+func TestConfirmEmailChange_Rejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		change structs.EmailChange
+		msgKey string
+	}{
+		{"wrong code", structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com", ServerCode: "9999"}, "wrongCode"},
+		{"change of another user", structs.EmailChange{PermanentId: "perm456", NewEmail: "new@example.com", ServerCode: "1234"}, "emailChangeNotPending"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+
+			data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+			data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) { return tt.change, nil }
+			data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+				t.Error("email should not be saved")
+				return nil
+			}
+			var profile structs.Profile
+			captureProfile(t, &profile)
+
+			expectProfileUser(mock)
+			expectProfileEmail(mock)
+
+			w := httptest.NewRecorder()
+			ConfirmEmailChange(w, profileRequest("/profile/email/confirm", url.Values{"clientCode": {"1234"}}))
+
+			assert.Equal(t, i18n.Text(i18n.En, tt.msgKey), profile.Msg)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestConfirmEmailChange_AttemptsExhausted проверяет неверный код, исчерпавший лимит попыток.
+// Ожидается: смена email удалена из сессии, email не меняется, сообщение об отмене смены.
+func TestConfirmEmailChange_AttemptsExhausted(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+	data.GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+		return structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com", ServerCode: "9999"}, nil
+	}
+	attempts := 4
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+		assert.Equal(t, data.FailedAttemptEmailChangeCode, kind)
+		return attempts, since + 60, nil
+	}
+	data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error {
+		attempts++
+		return nil
+	}
+	deleted := false
+	data.DeleteEmailChangeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+		deleted = true
+		return nil
+	}
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		t.Error("email should not be saved")
+		return nil
+	}
+	var profile structs.Profile
+	captureProfile(t, &profile)
+
+	expectProfileUser(mock)
+	expectProfileEmail(mock)
+
+	w := httptest.NewRecorder()
+	ConfirmEmailChange(w, profileRequest("/profile/email/confirm", url.Values{"clientCode": {"1234"}}))
+
+	assert.True(t, deleted)
+	assert.Equal(t, i18n.Text(i18n.En, "emailChangeAttemptsExceeded"), profile.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUndoEmailChange_Success проверяет отмену смены email.
+// Ожидается: прежний email восстановлен, смена отменена, все сессии завершены, редирект на вход.
+func TestUndoEmailChange_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+
+	tools.EmailChangeUndoTokenValidate = func(token string) (*structs.EmailChangeUndoTokenClaims, error) {
+		return &structs.EmailChangeUndoTokenClaims{OldEmail: "old@example.com", NewEmail: "new@example.com"}, nil
+	}
+	data.GetEmailChangeByUndoTokenFromDb = func(token string) (structs.ProfileChange, error) {
+		return structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldEmail, OldValue: "old@example.com", NewValue: "new@example.com"}, nil
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "", sql.ErrNoRows }
+	var calls []string
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		calls = append(calls, "email:"+email)
+		return nil
+	}
+	data.SetProfileChangeCancelledInDbTx = func(tx *sql.Tx, undoToken string) error {
+		calls = append(calls, "cancel:"+undoToken)
+		return nil
+	}
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+		calls = append(calls, "log:"+change.OldValue+">"+change.NewValue)
+		return nil
+	}
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		calls = append(calls, "temporaryIds:"+permanentId)
+		return nil
+	}
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		calls = append(calls, "refreshTokens:"+permanentId)
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	UndoEmailChange(w, profileRequest("/profile/email/undo", url.Values{"token": {"undo-token"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/sign-in?msg=emailChangeUndone", w.Header().Get("Location"))
+	assert.Equal(t, []string{
+		"email:old@example.com",
+		"cancel:undo-token",
+		"log:new@example.com>old@example.com",
+		"temporaryIds:perm123",
+		"refreshTokens:perm123",
+	}, calls)
+	assert.Equal(t, "perm123", trustedDevicesCancelledFor)
+	assert.Contains(t, w.Header().Get("Set-Cookie"), "Max-Age=0")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUndoEmailChange_Invalid проверяет невалидный, использованный и занятый токен отмены.
+// Ожидается: редирект на вход с сообщением, транзакция не начинается.
+func TestUndoEmailChange_Invalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		validateErr error
+		lookupErr   error
+		ownerId     string
+	}{
+		{"invalid token", errors.New("token invalid"), nil, ""},
+		{"used token", nil, sql.ErrNoRows, ""},
+		{"previous email taken", nil, nil, "perm456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+
+			tools.EmailChangeUndoTokenValidate = func(token string) (*structs.EmailChangeUndoTokenClaims, error) {
+				if tt.validateErr != nil {
+					return nil, tt.validateErr
+				}
+				return &structs.EmailChangeUndoTokenClaims{OldEmail: "old@example.com", NewEmail: "new@example.com"}, nil
+			}
+			data.GetEmailChangeByUndoTokenFromDb = func(token string) (structs.ProfileChange, error) {
+				if tt.lookupErr != nil {
+					return structs.ProfileChange{}, errors.WithStack(tt.lookupErr)
+				}
+				return structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldEmail, OldValue: "old@example.com", NewValue: "new@example.com"}, nil
+			}
+			data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return tt.ownerId, nil }
+
+			w := httptest.NewRecorder()
+			UndoEmailChange(w, profileRequest("/profile/email/undo", url.Values{"token": {"undo-token"}}))
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, "/sign-in?msg=emailChangeUndoInvalid", w.Header().Get("Location"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"database/sql"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
@@ -104,9 +105,12 @@ func ResetTokenGuard(next http.Handler) http.Handler {
 
 // AuthGuardForHomePath защищает домашнюю страницу.
 // Проверяет наличие temporaryId, получает permanentId и userAgent из базы данных.
+// Завершает сессию с сообщением на странице входа, если истекло время бездействия или общий срок сессии
+// либо аккаунт заблокирован.
 // Проверяет совпадение User-Agent с текущим запросом - при несовпадении отправляет уведомление и выполняет выход.
 // Проверяет наличие и валидность refresh токена - при отсутствии или невалидности выполняет выход.
-// При успешной проверке передает управление следующему обработчику.
+// При успешной проверке фиксирует активность (не чаще интервала обновления),
+// продлевает cookie и refresh токен и передает управление следующему обработчику.
 func AuthGuardForHomePath(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -118,9 +122,10 @@ func AuthGuardForHomePath(next http.Handler) http.Handler {
 
 		temporaryId := Cookies.Value
 
-		permanentId, userAgent, err := data.GetTemporaryIdKeysFromDb(temporaryId)
-		if err != nil {
-			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		lifetime := loadSessionLifetime()
+		now := time.Now().Unix()
+		permanentId, userAgent, activity, ok := activeSession(w, r, temporaryId, lifetime, now)
+		if !ok {
 			return
 		}
 
@@ -131,9 +136,11 @@ func AuthGuardForHomePath(next http.Handler) http.Handler {
 		}
 
 		if userAgent != r.UserAgent() {
-			if err := tools.SuspiciousLoginEmailSend(email, r.UserAgent()); err != nil {
-				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
-				return
+			if notificationEnabled(permanentId, data.NotificationSuspiciousLogin) {
+				if err := tools.SuspiciousLoginEmailSend(userLocale(permanentId), email, r.UserAgent()); err != nil {
+					errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+					return
+				}
 			}
 			Logout(w, r)
 			return
@@ -154,6 +161,11 @@ func AuthGuardForHomePath(next http.Handler) http.Handler {
 			return
 		}
 
+		if err := touchSession(w, temporaryId, permanentId, userAgent, activity, lifetime, now); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+
 		next.ServeHTTP(w, r)
 	})
 }
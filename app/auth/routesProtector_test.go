@@ -17,6 +17,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gimaevra94/auth/app/consts"
@@ -40,6 +41,7 @@ func setupRoutesProtectorTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "test-auth-key-32-bytes-long!!")
 	os.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "test-encryption-key-32-bytes!!")
 	os.Setenv("CAPTCHA_STORE_SESSION_SECRET_KEY", "test-captcha-secret-32-bytes!!")
+	os.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
 
 	data.InitStore()
 
@@ -51,8 +53,21 @@ func setupRoutesProtectorTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldSetRefreshTokenCancelledInDbTx := data.SetRefreshTokenCancelledInDbTx
 	oldSuspiciousLoginEmailSend := tools.SuspiciousLoginEmailSend
 	oldRefreshTokenValidate := tools.RefreshTokenValidate
+	oldGetTemporaryIdActivityFromDb := data.GetTemporaryIdActivityFromDb
+	oldTouchSession := touchSession
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
 
 	data.Db = db
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
+	data.GetTemporaryIdActivityFromDb = func(temporaryId string) (structs.SessionActivity, error) {
+		now := time.Now().Unix()
+		return structs.SessionActivity{CreatedAt: now, LastActivityAt: now}, nil
+	}
+	touchSession = func(w http.ResponseWriter, temporaryId, permanentId, userAgent string, activity structs.SessionActivity, lifetime sessionLifetime, now int64) error {
+		return nil
+	}
 
 	return db, mock, func() {
 		data.Db = oldDb
@@ -64,6 +79,9 @@ func setupRoutesProtectorTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 		data.SetRefreshTokenCancelledInDbTx = oldSetRefreshTokenCancelledInDbTx
 		tools.SuspiciousLoginEmailSend = oldSuspiciousLoginEmailSend
 		tools.RefreshTokenValidate = oldRefreshTokenValidate
+		data.GetTemporaryIdActivityFromDb = oldGetTemporaryIdActivityFromDb
+		touchSession = oldTouchSession
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
 	}
 }
 
@@ -91,6 +109,25 @@ func TestAuthGuardForSignUpAndSignInPath_NoCookie(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestAuthGuardForHomePath_ForgedTemporaryId проверяет отклонение cookie с неверной подписью.
+// Ожидается: редирект на регистрацию без обращения к базе данных.
+func TestAuthGuardForHomePath_ForgedTemporaryId(t *testing.T) {
+	_, mock, teardown := setupRoutesProtectorTest(t)
+	defer teardown()
+
+	req := httptest.NewRequest("GET", consts.HomeURL, nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id.forged"})
+	w := httptest.NewRecorder()
+
+	AuthGuardForHomePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.SignUpURL, w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestAuthGuardForSignUpAndSignInPath_CancelledTemporaryId проверяет обработку отмененного temporaryId.
 //
 // Имитирует ошибку базы данных при проверке отмененного temporaryId и убеждается,
@@ -109,7 +146,7 @@ func TestAuthGuardForSignUpAndSignInPath_CancelledTemporaryId(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/sign-up", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "cancelled-temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "cancelled-temp-id")})
 	w := httptest.NewRecorder()
 
 	guard := AuthGuardForSignUpAndSignInPath(nextHandler)
@@ -139,7 +176,7 @@ func TestAuthGuardForSignUpAndSignInPath_ValidTemporaryId(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/sign-up", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "valid-temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "valid-temp-id")})
 	w := httptest.NewRecorder()
 
 	guard := AuthGuardForSignUpAndSignInPath(nextHandler)
@@ -169,7 +206,7 @@ func TestAuthGuardForSignUpAndSignInPath_DatabaseError(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/sign-up", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	w := httptest.NewRecorder()
 
 	guard := AuthGuardForSignUpAndSignInPath(nextHandler)
@@ -368,7 +405,7 @@ func TestAuthGuardForHomePath_DatabaseError(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/home", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	w := httptest.NewRecorder()
 
 	guard := AuthGuardForHomePath(nextHandler)
@@ -387,7 +424,7 @@ func TestAuthGuardForHomePath_DatabaseError(t *testing.T) {
 func TestAuthGuardForHomePath_SuspiciousUserAgent(t *testing.T) {
 	_, mock, teardown := setupRoutesProtectorTest(t)
 	defer teardown()
-	tools.SuspiciousLoginEmailSend = func(email, userAgent string) error {
+	tools.SuspiciousLoginEmailSend = func(locale, email, userAgent string) error {
 		return nil
 	}
 
@@ -422,7 +459,7 @@ func TestAuthGuardForHomePath_SuspiciousUserAgent(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/home", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	req.Header.Set("User-Agent", "current-user-agent")
 	w := httptest.NewRecorder()
 
@@ -477,7 +514,7 @@ func TestAuthGuardForHomePath_NoRefreshToken(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/home", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	req.Header.Set("User-Agent", "same-user-agent")
 	w := httptest.NewRecorder()
 
@@ -534,7 +571,7 @@ func TestAuthGuardForHomePath_InvalidRefreshToken(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/home", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	req.Header.Set("User-Agent", "same-user-agent")
 	w := httptest.NewRecorder()
 
@@ -580,7 +617,7 @@ func TestAuthGuardForHomePath_ValidAccess(t *testing.T) {
 	})
 
 	req := httptest.NewRequest("GET", "/home", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	req.Header.Set("User-Agent", "same-user-agent")
 	w := httptest.NewRecorder()
 
@@ -623,7 +660,7 @@ func TestLogout_DatabaseError(t *testing.T) {
 		WillReturnError(errors.New("database connection error"))
 
 	req := httptest.NewRequest("POST", "/logout", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	w := httptest.NewRecorder()
 
 	Logout(w, req)
@@ -657,7 +694,7 @@ func TestLogout_Success(t *testing.T) {
 	mock.ExpectCommit()
 
 	req := httptest.NewRequest("POST", "/logout", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	w := httptest.NewRecorder()
 
 	Logout(w, req)
@@ -702,7 +739,7 @@ func TestLogout_TransactionRollback(t *testing.T) {
 	defer func() { data.SetTemporaryIdCancelledInDbTx = originalSetTemporaryIdCancelledInDbTx }()
 
 	req := httptest.NewRequest("POST", "/logout", nil)
-	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: "temp-id"})
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
 	w := httptest.NewRecorder()
 
 	assert.Panics(t, func() {
@@ -779,3 +816,43 @@ func TestAuthGuardForServerAuthCodeSendPath_EdgeCases(t *testing.T) {
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// TestAuthGuardForHomePath_AccountRestricted проверяет сессию заблокированного аккаунта.
+// Ожидается: отзыв сессии и редирект на страницу входа с ключом сообщения о блокировке.
+func TestAuthGuardForHomePath_AccountRestricted(t *testing.T) {
+	_, mock, teardown := setupRoutesProtectorTest(t)
+	defer teardown()
+
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		assert.Equal(t, "permanent-123", permanentId)
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusBanned}, nil
+	}
+	data.SetTemporaryIdCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent string) error { return nil }
+	data.SetRefreshTokenCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent string) error { return nil }
+
+	mock.ExpectQuery("select permanentId, userAgent from temporary_id").
+		WithArgs("temp-id").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "userAgent"}).AddRow("permanent-123", "agent"))
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("GET", consts.HomeURL, nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+
+	AuthGuardForHomePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.SignInURL+"?msg=accountBanned", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// signedTemporaryId возвращает подписанное значение cookie с временным ID.
+func signedTemporaryId(t *testing.T, temporaryId string) string {
+	t.Helper()
+	signed, err := data.SignTemporaryId(temporaryId)
+	require.NoError(t, err)
+	return signed
+}
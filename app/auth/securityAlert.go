@@ -0,0 +1,229 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит уведомления безопасности об изменениях аккаунта:
+//   - securityAlert: собирает сведения о событии (время, IP, устройство) и ссылку "это был не я"
+//   - adminSecurityAlert: то же для действия администратора
+//   - RevokeBySecurityAlert: по ссылке "это был не я" завершает все сессии и отправляет ссылку сброса пароля
+//   - restoreAlertedEmailTx: возвращает аккаунту адрес, на который было отправлено уведомление
+//
+// Ссылка содержит подписанный токен (tools.GenerateSecurityAlertLink), который
+// сохраняется в security_alert_token и срабатывает один раз, как токен сброса пароля.
+// В токене указан адрес уведомления: ссылка сброса пароля отправляется на него,
+// а не на текущий email, который мог сменить злоумышленник.
+package auth
+
+import (
+	"database/sql"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// clientIP возвращает IP-адрес клиента.
+//
+// По умолчанию берется адрес соединения. Первый адрес заголовка X-Forwarded-For
+// используется, только если TRUST_PROXY_HEADERS=true: без прокси заголовок
+// задает сам клиент.
+func clientIP(r *http.Request) string {
+	if os.Getenv("TRUST_PROXY_HEADERS") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// securityAlert возвращает сведения о событии event аккаунта permanentId,
+// выполненном запросом r, со ссылкой "это был не я" для уведомления на адрес email.
+func securityAlert(r *http.Request, permanentId, email, event string) structs.SecurityAlert {
+	alert := structs.SecurityAlert{
+		Event:      event,
+		OccurredAt: time.Now().Unix(),
+		IP:         clientIP(r),
+		UserAgent:  r.UserAgent(),
+	}
+	alert.RevokeLink = securityAlertLink(permanentId, email, event)
+	return alert
+}
+
+// adminSecurityAlert возвращает сведения о событии event, выполненном администратором.
+//
+// IP-адрес и устройство администратора пользователю не показываются.
+func adminSecurityAlert(permanentId, email, event string) structs.SecurityAlert {
+	alert := structs.SecurityAlert{
+		Event:      event,
+		OccurredAt: time.Now().Unix(),
+		ByAdmin:    true,
+	}
+	alert.RevokeLink = securityAlertLink(permanentId, email, event)
+	return alert
+}
+
+// securityAlertLink создает ссылку "это был не я" для уведомления на адрес email и сохраняет ее токен.
+//
+// Ошибка только логируется и возвращается пустая ссылка: уведомление
+// важнее ссылки и отправляется без нее.
+func securityAlertLink(permanentId, email, event string) string {
+	baseURL := tmpls.PublicURL("/security/revoke")
+	alertLink, err := tools.GenerateSecurityAlertLink(permanentId, email, event, baseURL)
+	if err != nil {
+		log.Printf("%+v", err)
+		return ""
+	}
+
+	url, err := url.Parse(alertLink)
+	if err != nil {
+		log.Printf("%+v", errors.WithStack(err))
+		return ""
+	}
+
+	if err := data.SetSecurityAlertTokenInDb(url.Query().Get("token"), permanentId); err != nil {
+		log.Printf("%+v", err)
+		return ""
+	}
+	return alertLink
+}
+
+// RevokeBySecurityAlert обрабатывает подтверждение по ссылке "это был не я".
+//
+// Проверяет подпись и срок токена, в транзакции отмечает токен использованным,
+// завершает все сессии и refresh токены пользователя, отменяет доверие к его устройствам и, если email для входа по паролю
+// сменился после уведомления, возвращает адрес, на который оно было отправлено.
+// Затем, если аккаунт не заблокирован, отправляет ссылку сброса пароля на этот адрес;
+// ошибка отправки только логируется - сессии уже завершены.
+// Перенаправляет на страницу входа с сообщением.
+func RevokeBySecurityAlert(w http.ResponseWriter, r *http.Request) {
+	alertToken := r.FormValue("token")
+	invalidURL := consts.SignInURL + "?msg=securityAlertInvalid"
+
+	claims, err := tools.SecurityAlertTokenValidate(alertToken)
+	if err != nil {
+		http.Redirect(w, r, invalidURL, http.StatusFound)
+		return
+	}
+	permanentId := claims.AlertPermanentId
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetSecurityAlertTokenUsedInDbTx(tx, alertToken); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrSecurityAlertTokenUsed) {
+			http.Redirect(w, r, invalidURL, http.StatusFound)
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := cancelAllSessionsTx(tx, permanentId); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	resetAvailable, err := restoreAlertedEmailTx(tx, permanentId, claims.AlertEmail)
+	if err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if resetAvailable {
+		if err := startSecurityAlertReset(permanentId, claims.AlertEmail); err != nil {
+			log.Printf("%+v", err)
+		}
+	}
+
+	data.ClearTemporaryIdInCookies(w)
+	http.Redirect(w, r, consts.SignInURL+"?msg=securityAlertRevoked", http.StatusFound)
+}
+
+// restoreAlertedEmailTx возвращает аккаунту permanentId email для входа по паролю alertEmail,
+// на который было отправлено уведомление, если с тех пор email сменился (например,
+// злоумышленник сменил email, и уведомление ушло на прежний адрес). Восстановление
+// фиксируется в журнале изменений профиля.
+//
+// Возвращает true, если alertEmail - email аккаунта для входа по паролю и на него можно
+// отправить ссылку сброса пароля. У аккаунта без пароля (созданного через Yandex)
+// email не меняется; адрес, занятый другим аккаунтом, не восстанавливается.
+func restoreAlertedEmailTx(tx *sql.Tx, permanentId, alertEmail string) (bool, error) {
+	yauth := false
+	alertPermanentId, err := data.GetPermanentIdFromDbByEmail(alertEmail, yauth)
+	if err == nil {
+		return alertPermanentId == permanentId, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, errors.WithStack(err)
+	}
+
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	emailPermanentId, err := data.GetPermanentIdFromDbByEmail(email, yauth)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, errors.WithStack(err)
+	}
+	if emailPermanentId != permanentId {
+		return false, nil
+	}
+
+	if err := data.SetEmailInDbTx(tx, permanentId, alertEmail, yauth); err != nil {
+		return false, errors.WithStack(err)
+	}
+	change := structs.ProfileChange{PermanentId: permanentId, Field: data.ProfileFieldEmail, OldValue: email, NewValue: alertEmail}
+	if err := data.SetProfileChangeInDbTx(tx, change, "", time.Now().Unix()); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return true, nil
+}
+
+// startSecurityAlertReset отправляет ссылку сброса пароля на адрес уведомления email
+// после подтверждения "это был не я".
+//
+// Заблокированному аккаунту ссылка не отправляется.
+func startSecurityAlertReset(permanentId, email string) error {
+	if _, restricted, err := accountStatus(permanentId); err != nil {
+		return errors.WithStack(err)
+	} else if restricted {
+		return nil
+	}
+
+	if err := sendPasswordResetLink(userLocale(permanentId), email, structs.SecurityAlert{}); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует уведомления безопасности и ссылку "это был не я".
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// setupSecurityAlertTest сохраняет подменяемые зависимости ссылки "это был не я".
+// По умолчанию токен действителен для perm123 и выдан на old@example.com, аккаунт не заблокирован
+// и old@example.com по-прежнему его email для входа по паролю.
+// Возвращает функцию восстановления.
+func setupSecurityAlertTest(t *testing.T) func() {
+	oldSecurityAlertTokenValidate := tools.SecurityAlertTokenValidate
+	oldSetSecurityAlertTokenUsedInDbTx := data.SetSecurityAlertTokenUsedInDbTx
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+	oldGetUserLocaleFromDb := data.GetUserLocaleFromDb
+	oldGeneratePasswordResetLink := tools.GeneratePasswordResetLink
+	oldSetPasswordResetTokenInDb := data.SetPasswordResetTokenInDb
+	oldPasswordResetEmailSend := tools.PasswordResetEmailSend
+
+	tools.SecurityAlertTokenValidate = func(signedToken string) (*structs.SecurityAlertTokenClaims, error) {
+		return &structs.SecurityAlertTokenClaims{AlertPermanentId: "perm123", AlertEmail: "old@example.com", Event: data.NotificationPasswordChange}, nil
+	}
+	data.SetSecurityAlertTokenUsedInDbTx = func(tx *sql.Tx, token string) error { return nil }
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
+	data.GetUserLocaleFromDb = func(permanentId string) (string, error) { return i18n.En, nil }
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "perm123", nil }
+	tools.GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
+		return baseURL + "?token=reset-token", nil
+	}
+	data.SetPasswordResetTokenInDb = func(token, email string) error { return nil }
+	tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error { return nil }
+
+	return func() {
+		tools.SecurityAlertTokenValidate = oldSecurityAlertTokenValidate
+		data.SetSecurityAlertTokenUsedInDbTx = oldSetSecurityAlertTokenUsedInDbTx
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
+		data.GetUserLocaleFromDb = oldGetUserLocaleFromDb
+		tools.GeneratePasswordResetLink = oldGeneratePasswordResetLink
+		data.SetPasswordResetTokenInDb = oldSetPasswordResetTokenInDb
+		tools.PasswordResetEmailSend = oldPasswordResetEmailSend
+	}
+}
+
+// TestClientIP проверяет определение IP-адреса клиента.
+// Ожидается: адрес соединения, X-Forwarded-For - только при TRUST_PROXY_HEADERS=true.
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.10:5000"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1, 10.0.0.1")
+
+	t.Setenv("TRUST_PROXY_HEADERS", "")
+	assert.Equal(t, "203.0.113.10", clientIP(req))
+
+	t.Setenv("TRUST_PROXY_HEADERS", "true")
+	assert.Equal(t, "198.51.100.1", clientIP(req))
+
+	req.Header.Del("X-Forwarded-For")
+	req.RemoteAddr = "203.0.113.10"
+	assert.Equal(t, "203.0.113.10", clientIP(req))
+}
+
+// TestSecurityAlert проверяет сведения о событии для уведомления.
+// Ожидается: IP и устройство запроса и сохраненная ссылка; у действия администратора
+// IP и устройства нет; при ошибке сохранения токена уведомление остается без ссылки.
+func TestSecurityAlert(t *testing.T) {
+	_, teardown := setupProfileTest(t)
+	defer teardown()
+
+	var savedToken, savedPermanentId string
+	data.SetSecurityAlertTokenInDb = func(token, permanentId string) error {
+		savedToken, savedPermanentId = token, permanentId
+		return nil
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("User-Agent", "test-agent")
+	alert := securityAlert(req, "perm123", "old@example.com", data.NotificationPasswordChange)
+	assert.Equal(t, data.NotificationPasswordChange, alert.Event)
+	assert.NotZero(t, alert.OccurredAt)
+	assert.Equal(t, "192.0.2.1", alert.IP)
+	assert.Equal(t, "test-agent", alert.UserAgent)
+	assert.False(t, alert.ByAdmin)
+	assert.Equal(t, "http://localhost:8080/security/revoke?token=alert-token", alert.RevokeLink)
+	assert.Equal(t, "alert-token", savedToken)
+	assert.Equal(t, "perm123", savedPermanentId)
+
+	adminAlert := adminSecurityAlert("perm456", "user@example.com", data.NotificationAccountLock)
+	assert.True(t, adminAlert.ByAdmin)
+	assert.Empty(t, adminAlert.IP)
+	assert.Empty(t, adminAlert.UserAgent)
+	assert.NotEmpty(t, adminAlert.RevokeLink)
+
+	data.SetSecurityAlertTokenInDb = func(token, permanentId string) error { return errors.New("db error") }
+	alert = securityAlert(req, "perm123", "old@example.com", data.NotificationPasswordChange)
+	assert.Empty(t, alert.RevokeLink)
+	assert.Equal(t, "192.0.2.1", alert.IP)
+}
+
+// TestRevokeBySecurityAlert_Success проверяет подтверждение по ссылке "это был не я".
+// Ожидается: токен отмечается использованным и все сессии завершаются в одной транзакции,
+// на адрес уведомления отправляется ссылка сброса пароля, редирект на страницу входа.
+func TestRevokeBySecurityAlert_Success(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupSecurityAlertTest(t)()
+
+	var usedToken string
+	data.SetSecurityAlertTokenUsedInDbTx = func(tx *sql.Tx, token string) error {
+		usedToken = token
+		return nil
+	}
+	var cancelled []string
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		cancelled = append(cancelled, "temporaryId:"+permanentId)
+		return nil
+	}
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+		cancelled = append(cancelled, "refreshToken:"+permanentId)
+		return nil
+	}
+	var resetSentTo string
+	tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error {
+		resetSentTo = email
+		assert.Empty(t, alert.RevokeLink)
+		return nil
+	}
+
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		t.Error("email should not be changed")
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	RevokeBySecurityAlert(w, profileRequest("/security/revoke", url.Values{"token": {"alert-token"}}))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.SignInURL+"?msg=securityAlertRevoked", w.Header().Get("Location"))
+	assert.Equal(t, "alert-token", usedToken)
+	assert.Equal(t, []string{"temporaryId:perm123", "refreshToken:perm123"}, cancelled)
+	assert.Equal(t, "perm123", trustedDevicesCancelledFor)
+	assert.Equal(t, "old@example.com", resetSentTo)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRevokeBySecurityAlert_EmailChanged проверяет подтверждение "это был не я" после смены email.
+// Ожидается: в той же транзакции аккаунту возвращается адрес уведомления, изменение
+// фиксируется в журнале, ссылка сброса уходит на адрес уведомления, а не на новый email.
+func TestRevokeBySecurityAlert_EmailChanged(t *testing.T) {
+	mock, teardown := setupProfileTest(t)
+	defer teardown()
+	defer setupSecurityAlertTest(t)()
+
+	tools.SecurityAlertTokenValidate = func(signedToken string) (*structs.SecurityAlertTokenClaims, error) {
+		return &structs.SecurityAlertTokenClaims{AlertPermanentId: "perm123", AlertEmail: "alerted@example.com", Event: data.NotificationEmailChange}, nil
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		if email == "old@example.com" {
+			return "perm123", nil
+		}
+		return "", errors.WithStack(sql.ErrNoRows)
+	}
+	data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	var restoredEmail string
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		assert.Equal(t, "perm123", permanentId)
+		assert.False(t, yauth)
+		restoredEmail = email
+		return nil
+	}
+	var change structs.ProfileChange
+	data.SetProfileChangeInDbTx = func(tx *sql.Tx, c structs.ProfileChange, undoToken string, changedAt int64) error {
+		change = c
+		assert.Empty(t, undoToken)
+		return nil
+	}
+	var resetSentTo string
+	tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error {
+		resetSentTo = email
+		return nil
+	}
+
+	mock.ExpectBegin()
+	expectProfileEmail(mock)
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	RevokeBySecurityAlert(w, profileRequest("/security/revoke", url.Values{"token": {"alert-token"}}))
+
+	assert.Equal(t, consts.SignInURL+"?msg=securityAlertRevoked", w.Header().Get("Location"))
+	assert.Equal(t, "alerted@example.com", restoredEmail)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: data.ProfileFieldEmail, OldValue: "old@example.com", NewValue: "alerted@example.com"}, change)
+	assert.Equal(t, "alerted@example.com", resetSentTo)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRevokeBySecurityAlert_NoReset проверяет подтверждение для аккаунта, которому сброс недоступен.
+// Ожидается: сессии завершаются, но ссылка сброса не отправляется аккаунту из Yandex,
+// заблокированному аккаунту и на адрес, который теперь занят другим аккаунтом.
+func TestRevokeBySecurityAlert_NoReset(t *testing.T) {
+	tests := []struct {
+		name       string
+		prepare    func()
+		readsEmail bool
+	}{
+		{name: "yandex account", readsEmail: true, prepare: func() {
+			data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+				return "", errors.WithStack(sql.ErrNoRows)
+			}
+		}},
+		{name: "email taken by another account", prepare: func() {
+			data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) { return "perm999", nil }
+		}},
+		{name: "restricted account", prepare: func() {
+			data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+				return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusDisabled}, nil
+			}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			defer setupSecurityAlertTest(t)()
+
+			data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+			data.SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+			tools.PasswordResetEmailSend = func(locale, email, resetLink string, alert structs.SecurityAlert) error {
+				t.Error("reset link should not be sent")
+				return nil
+			}
+			data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+				t.Error("email should not be changed")
+				return nil
+			}
+			tt.prepare()
+
+			mock.ExpectBegin()
+			if tt.readsEmail {
+				expectProfileEmail(mock)
+			}
+			mock.ExpectCommit()
+
+			w := httptest.NewRecorder()
+			RevokeBySecurityAlert(w, profileRequest("/security/revoke", url.Values{"token": {"alert-token"}}))
+
+			assert.Equal(t, consts.SignInURL+"?msg=securityAlertRevoked", w.Header().Get("Location"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestRevokeBySecurityAlert_Invalid проверяет недействительную и повторно использованную ссылку.
+// Ожидается: сессии не завершаются, редирект на страницу входа с сообщением о недействительной ссылке;
+// ошибка БД приводит к откату и редиректу на страницу 500.
+func TestRevokeBySecurityAlert_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		tokenErr error
+		useErr   error
+		location string
+	}{
+		{name: "invalid token", tokenErr: errors.New("token invalid"), location: consts.SignInURL + "?msg=securityAlertInvalid"},
+		{name: "used token", useErr: errors.WithStack(data.ErrSecurityAlertTokenUsed), location: consts.SignInURL + "?msg=securityAlertInvalid"},
+		{name: "db error", useErr: errors.New("db error"), location: consts.Err500URL},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupProfileTest(t)
+			defer teardown()
+			defer setupSecurityAlertTest(t)()
+
+			if tt.tokenErr != nil {
+				tools.SecurityAlertTokenValidate = func(signedToken string) (*structs.SecurityAlertTokenClaims, error) {
+					return nil, tt.tokenErr
+				}
+			} else {
+				mock.ExpectBegin()
+				mock.ExpectRollback()
+			}
+			data.SetSecurityAlertTokenUsedInDbTx = func(tx *sql.Tx, token string) error { return tt.useErr }
+			data.SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+				t.Error("sessions should not be cancelled")
+				return nil
+			}
+
+			w := httptest.NewRecorder()
+			RevokeBySecurityAlert(w, profileRequest("/security/revoke", url.Values{"token": {"alert-token"}}))
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -0,0 +1,212 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит функции управления временем жизни сессии:
+//   - loadSessionLifetime: загружает настройки времени жизни из переменных окружения
+//   - sessionExpiredMsgKey: определяет, истекла ли сессия по бездействию или по общему сроку
+//   - activeSession: получает пользователя действующей сессии или завершает ее
+//   - redirectIfSessionNotFound: перенаправляет на страницу входа, если сессия не найдена
+//   - touchSession: обновляет время активности и продлевает cookie и refresh токен
+//   - expireSession: отзывает истекшую сессию и перенаправляет на страницу входа
+//
+// Время последней активности обновляется не чаще одного раза за интервал,
+// чтобы не выполнять запись в БД на каждый запрос.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// sessionLifetime описывает ограничения времени жизни сессии (в секундах).
+type sessionLifetime struct {
+	idleTimeout            int64
+	absoluteLifetime       int64
+	activityUpdateInterval int64
+}
+
+// loadSessionLifetime загружает настройки времени жизни сессии.
+//
+// Использует переменные окружения:
+//   - SESSION_IDLE_TIMEOUT: время бездействия до завершения сессии (по умолчанию 3 дня)
+//   - SESSION_ABSOLUTE_LIFETIME: максимальный срок сессии с момента входа (по умолчанию 30 дней)
+//   - SESSION_ACTIVITY_UPDATE_INTERVAL: минимальный интервал обновления активности (по умолчанию 60 секунд)
+func loadSessionLifetime() sessionLifetime {
+	return sessionLifetime{
+		idleTimeout:            int64(envPositiveInt("SESSION_IDLE_TIMEOUT", 3*24*60*60)),
+		absoluteLifetime:       int64(envPositiveInt("SESSION_ABSOLUTE_LIFETIME", 30*24*60*60)),
+		activityUpdateInterval: int64(envPositiveInt("SESSION_ACTIVITY_UPDATE_INTERVAL", 60)),
+	}
+}
+
+// sessionExpiredMsgKey определяет, истекла ли сессия.
+//
+// Возвращает "sessionAbsoluteExpired", если превышен общий срок сессии,
+// "sessionIdleExpired", если превышено время бездействия, и пустую строку,
+// если сессия активна.
+func sessionExpiredMsgKey(activity structs.SessionActivity, lifetime sessionLifetime, now int64) string {
+	if now-activity.CreatedAt >= lifetime.absoluteLifetime {
+		return "sessionAbsoluteExpired"
+	}
+	if now-activity.LastActivityAt >= lifetime.idleTimeout {
+		return "sessionIdleExpired"
+	}
+	return ""
+}
+
+// activeSession получает пользователя сессии temporaryId и проверяет, что сессия действует.
+//
+// Отмененная или неизвестная сессия очищает cookie и перенаправляет на страницу входа.
+// Истекшая сессия и сессия заблокированного аккаунта завершаются через expireSession.
+// В этих случаях и при ошибках БД ответ уже записан и возвращается false.
+// Иначе возвращает permanentId, userAgent и параметры активности сессии.
+func activeSession(w http.ResponseWriter, r *http.Request, temporaryId string, lifetime sessionLifetime, now int64) (string, string, structs.SessionActivity, bool) {
+	permanentId, userAgent, err := data.GetTemporaryIdKeysFromDb(temporaryId)
+	if err != nil {
+		redirectIfSessionNotFound(w, r, err)
+		return "", "", structs.SessionActivity{}, false
+	}
+
+	activity, err := data.GetTemporaryIdActivityFromDb(temporaryId)
+	if err != nil {
+		redirectIfSessionNotFound(w, r, err)
+		return "", "", structs.SessionActivity{}, false
+	}
+
+	if msgKey := sessionExpiredMsgKey(activity, lifetime, now); msgKey != "" {
+		expireSession(w, r, permanentId, userAgent, msgKey)
+		return "", "", structs.SessionActivity{}, false
+	}
+
+	status, restricted, err := accountStatus(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return "", "", structs.SessionActivity{}, false
+	}
+	if restricted {
+		expireSession(w, r, permanentId, userAgent, accountStatusMsgKey(status))
+		return "", "", structs.SessionActivity{}, false
+	}
+	return permanentId, userAgent, activity, true
+}
+
+// redirectIfSessionNotFound очищает cookie и перенаправляет на страницу входа, если сессия
+// не найдена или отменена (sql.ErrNoRows), иначе перенаправляет на страницу 500.
+func redirectIfSessionNotFound(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		data.ClearTemporaryIdInCookies(w)
+		http.Redirect(w, r, consts.SignInURL, http.StatusFound)
+		return
+	}
+	errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+}
+
+// slidingExp вычисляет новый срок действия cookie и refresh токена.
+//
+// Срок равен исходному окну (7 дней для rememberMe, иначе 24 часа),
+// но не выходит за пределы общего срока сессии.
+func slidingExp(activity structs.SessionActivity, lifetime sessionLifetime, now int64) int {
+	window := int64(24 * 60 * 60)
+	if activity.RememberMe {
+		window = consts.Exp7Days
+	}
+	if remaining := activity.CreatedAt + lifetime.absoluteLifetime - now; remaining < window {
+		window = remaining
+	}
+	return int(window)
+}
+
+// touchSession фиксирует активность пользователя и продлевает сессию.
+//
+// Если с последнего обновления прошло меньше activityUpdateInterval, ничего не делает.
+// Иначе в одной транзакции обновляет lastActivityAt в temporary_id и выпускает
+// новый refresh токен, затем продлевает cookie temporaryId.
+var touchSession = func(w http.ResponseWriter, temporaryId, permanentId, userAgent string, activity structs.SessionActivity, lifetime sessionLifetime, now int64) error {
+	if now-activity.LastActivityAt < lifetime.activityUpdateInterval {
+		return nil
+	}
+
+	exp := slidingExp(activity, lifetime, now)
+	roles, err := data.GetUserRolesFromDb(permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	refreshToken, err := tools.GenerateRefreshToken(exp, true, roles)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tx, err := data.Db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetTemporaryIdActivityInDbTx(tx, temporaryId, now); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := data.SetRefreshTokenInDbTx(tx, permanentId, refreshToken, userAgent, activity.Yauth); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	data.SetTemporaryIdInCookies(w, temporaryId, exp, true)
+	return nil
+}
+
+// expireSession завершает истекшую сессию.
+//
+// В транзакции отменяет temporaryId и refresh токен, очищает cookie
+// и перенаправляет на страницу входа с ключом сообщения в параметре msg.
+func expireSession(w http.ResponseWriter, r *http.Request, permanentId, userAgent, msgKey string) {
+	tx, err := data.Db.Begin()
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := data.SetTemporaryIdCancelledInDbTx(tx, permanentId, userAgent); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := data.SetRefreshTokenCancelledInDbTx(tx, permanentId, userAgent); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	data.ClearTemporaryIdInCookies(w)
+	http.Redirect(w, r, consts.SignInURL+"?msg="+msgKey, http.StatusFound)
+}
@@ -0,0 +1,178 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует управление временем жизни сессии: бездействие, общий срок и продление.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadSessionLifetime проверяет загрузку настроек времени жизни сессии.
+// Ожидается: значения из окружения или значения по умолчанию.
+func TestLoadSessionLifetime(t *testing.T) {
+	t.Setenv("SESSION_IDLE_TIMEOUT", "600")
+	t.Setenv("SESSION_ABSOLUTE_LIFETIME", "")
+	t.Setenv("SESSION_ACTIVITY_UPDATE_INTERVAL", "0")
+
+	lifetime := loadSessionLifetime()
+
+	assert.Equal(t, int64(600), lifetime.idleTimeout)
+	assert.Equal(t, int64(30*24*60*60), lifetime.absoluteLifetime)
+	assert.Equal(t, int64(60), lifetime.activityUpdateInterval)
+}
+
+// TestSessionExpiredMsgKey проверяет определение истекших сессий.
+// Ожидается: ключ сообщения для бездействия и общего срока, пустая строка для активной сессии.
+func TestSessionExpiredMsgKey(t *testing.T) {
+	lifetime := sessionLifetime{idleTimeout: 100, absoluteLifetime: 1000, activityUpdateInterval: 10}
+	now := int64(5000)
+
+	tests := []struct {
+		name     string
+		activity structs.SessionActivity
+		want     string
+	}{
+		{"active", structs.SessionActivity{CreatedAt: now - 500, LastActivityAt: now - 50}, ""},
+		{"idle expired", structs.SessionActivity{CreatedAt: now - 500, LastActivityAt: now - 100}, "sessionIdleExpired"},
+		{"absolute expired", structs.SessionActivity{CreatedAt: now - 1000, LastActivityAt: now - 1}, "sessionAbsoluteExpired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sessionExpiredMsgKey(tt.activity, lifetime, now))
+		})
+	}
+}
+
+// TestSlidingExp проверяет расчет продленного срока cookie и refresh токена.
+// Ожидается: окно 24 часа или 7 дней, ограниченное общим сроком сессии.
+func TestSlidingExp(t *testing.T) {
+	lifetime := sessionLifetime{idleTimeout: 3600, absoluteLifetime: 30 * 24 * 60 * 60}
+	now := int64(10_000_000)
+
+	assert.Equal(t, 24*60*60, slidingExp(structs.SessionActivity{CreatedAt: now}, lifetime, now))
+	assert.Equal(t, consts.Exp7Days, slidingExp(structs.SessionActivity{CreatedAt: now, RememberMe: true}, lifetime, now))
+	assert.Equal(t, 500, slidingExp(structs.SessionActivity{CreatedAt: now - lifetime.absoluteLifetime + 500, RememberMe: true}, lifetime, now))
+}
+
+// TestTouchSession проверяет обновление активности и продление сессии.
+// Ожидается: без обращения к БД внутри интервала, транзакция и новое cookie после него.
+func TestTouchSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	oldDb := data.Db
+	oldGenerateRefreshToken := tools.GenerateRefreshToken
+	oldSetTemporaryIdActivityInDbTx := data.SetTemporaryIdActivityInDbTx
+	oldSetRefreshTokenInDbTx := data.SetRefreshTokenInDbTx
+	oldSetTemporaryIdInCookies := data.SetTemporaryIdInCookies
+	oldGetUserRolesFromDb := data.GetUserRolesFromDb
+	defer func() {
+		data.Db = oldDb
+		data.GetUserRolesFromDb = oldGetUserRolesFromDb
+		tools.GenerateRefreshToken = oldGenerateRefreshToken
+		data.SetTemporaryIdActivityInDbTx = oldSetTemporaryIdActivityInDbTx
+		data.SetRefreshTokenInDbTx = oldSetRefreshTokenInDbTx
+		data.SetTemporaryIdInCookies = oldSetTemporaryIdInCookies
+	}()
+	data.Db = db
+
+	lifetime := sessionLifetime{idleTimeout: 3600, absoluteLifetime: 30 * 24 * 60 * 60, activityUpdateInterval: 60}
+	now := int64(10_000_000)
+
+	t.Run("within update interval", func(t *testing.T) {
+		activity := structs.SessionActivity{CreatedAt: now - 100, LastActivityAt: now - 30}
+		w := httptest.NewRecorder()
+
+		assert.NoError(t, touchSession(w, "temp-id", "perm-id", "agent", activity, lifetime, now))
+		assert.Empty(t, w.Result().Cookies())
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("activity updated and session extended", func(t *testing.T) {
+		activity := structs.SessionActivity{CreatedAt: now - 100, LastActivityAt: now - 120, RememberMe: true, Yauth: true}
+		var tokenExp, cookieExp int
+		var tokenRoles []string
+		var storedToken string
+
+		data.GetUserRolesFromDb = func(permanentId string) ([]string, error) { return []string{"admin"}, nil }
+		tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
+			tokenExp = refreshTokenExp
+			tokenRoles = roles
+			return "new-refresh-token", nil
+		}
+		data.SetTemporaryIdActivityInDbTx = func(tx *sql.Tx, temporaryId string, lastActivityAt int64) error {
+			assert.Equal(t, "temp-id", temporaryId)
+			assert.Equal(t, now, lastActivityAt)
+			return nil
+		}
+		data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, yauth bool) error {
+			storedToken = refreshToken
+			assert.True(t, yauth)
+			return nil
+		}
+		data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
+			cookieExp = temporaryIdExp
+		}
+
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+
+		assert.NoError(t, touchSession(httptest.NewRecorder(), "temp-id", "perm-id", "agent", activity, lifetime, now))
+		assert.Equal(t, consts.Exp7Days, tokenExp)
+		assert.Equal(t, consts.Exp7Days, cookieExp)
+		assert.Equal(t, []string{"admin"}, tokenRoles)
+		assert.Equal(t, "new-refresh-token", storedToken)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestAuthGuardForHomePath_IdleExpired проверяет завершение сессии по бездействию.
+// Ожидается: отзыв сессии и редирект на страницу входа с ключом сообщения.
+func TestAuthGuardForHomePath_IdleExpired(t *testing.T) {
+	_, mock, teardown := setupRoutesProtectorTest(t)
+	defer teardown()
+
+	t.Setenv("SESSION_IDLE_TIMEOUT", "60")
+	data.GetTemporaryIdActivityFromDb = func(temporaryId string) (structs.SessionActivity, error) {
+		return structs.SessionActivity{CreatedAt: 1, LastActivityAt: 1}, nil
+	}
+	t.Setenv("SESSION_ABSOLUTE_LIFETIME", "2000000000")
+	data.SetTemporaryIdCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent string) error {
+		assert.Equal(t, "permanent-123", permanentId)
+		return nil
+	}
+	data.SetRefreshTokenCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent string) error {
+		return nil
+	}
+
+	mock.ExpectQuery("select permanentId, userAgent from temporary_id").
+		WithArgs("temp-id").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "userAgent"}).AddRow("permanent-123", "agent"))
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("GET", consts.HomeURL, nil)
+	req.AddCookie(&http.Cookie{Name: "temporaryId", Value: signedTemporaryId(t, "temp-id")})
+	w := httptest.NewRecorder()
+
+	AuthGuardForHomePath(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.SignInURL+"?msg=sessionIdleExpired", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,228 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит подтверждение входа кодом с нераспознанного устройства:
+//   - signInSecondFactorRequired: проверяет, включено ли подтверждение входа кодом
+//   - isUnrecognizedDevice: проверяет, что браузер не отмечен доверенным устройством пользователя
+//   - trustSignInDevice: отмечает браузер доверенным устройством пользователя
+//   - startSignInSecondFactor: отправляет код на email и перенаправляет на страницу ввода кода
+//     (если у аккаунта есть подтвержденный номер, там же можно получить код в SMS)
+//   - signInCodeAllowed: проверяет срок действия кода и лимит попыток до сверки кода
+//   - recordSignInCodeFailure: учитывает неверный код
+//   - completeSignInSecondFactor: создает сессию после проверки кода
+//   - endSignInSecondFactor: завершает подтверждение входа с сообщением на странице входа
+//
+// Код отправляется и проверяется теми же обработчиками, что и при регистрации
+// (ServerAuthCodeSend, CodeValidate), с теми же паузой и квотами отправки.
+// Сессия создается только после ввода кода, поэтому утекшего пароля недостаточно для входа
+// с нового устройства. Неверные коды считаются по аккаунту в БД (data.FailedAttemptSignInCode):
+// после FAILED_ATTEMPTS_MAX ошибок подтверждение завершается, и новый вход с нераспознанного
+// устройства до конца окна невозможен. Код действует FAILED_ATTEMPTS_WINDOW секунд,
+// поэтому повтор старой cookie сессии не дает новых попыток для того же кода.
+//
+// После ввода кода браузер становится доверенным устройством (таблица trusted_device
+// и подписанный cookie с идентификатором устройства) и следующий вход с него код не требует.
+// Доверие отменяется на сервере вместе с завершением всех сессий и при смене пароля.
+// User agent для этого не используется: его задает клиент.
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// signInSecondFactorRequired проверяет, включено ли подтверждение входа кодом.
+//
+// Использует переменную окружения SIGNIN_SECOND_FACTOR: off (по умолчанию) или new-device.
+// Неизвестное значение считается new-device, чтобы опечатка не отключала защиту.
+func signInSecondFactorRequired() bool {
+	switch os.Getenv("SIGNIN_SECOND_FACTOR") {
+	case "", consts.SignInSecondFactorOff:
+		return false
+	default:
+		return true
+	}
+}
+
+// isUnrecognizedDevice проверяет, что браузер запроса не отмечен доверенным устройством пользователя.
+//
+// Браузер распознается, если в cookie есть подписанный идентификатор устройства, доверенного
+// этому пользователю, и доверие не отменено и не истекло.
+var isUnrecognizedDevice = func(r *http.Request, permanentId string) (bool, error) {
+	deviceId, err := data.GetTrustedDeviceFromCookies(r)
+	if err != nil {
+		return true, nil
+	}
+	trusted, err := data.IsTrustedDeviceInDb(deviceId, permanentId, time.Now().Unix())
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return !trusted, nil
+}
+
+// trustSignInDevice отмечает браузер запроса доверенным устройством пользователя
+// на data.TrustedDeviceExp секунд.
+func trustSignInDevice(w http.ResponseWriter, permanentId string) error {
+	deviceId := uuid.New().String()
+	if err := data.SetTrustedDeviceInDb(deviceId, permanentId, time.Now().Unix()+data.TrustedDeviceExp); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := data.SetTrustedDeviceInCookies(w, deviceId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// startSignInSecondFactor начинает подтверждение входа кодом.
+//
+// Сохраняет в сессию входа пользователя с признаком SecondFactor (пароль не сохраняется)
+// и передает управление ServerAuthCodeSend, который отправляет код на текущий email
+// аккаунта и перенаправляет на страницу ввода кода. Если отправка SMS настроена,
+// в сессию сохраняется и подтвержденный номер аккаунта: на странице ввода кода
+// пользователь может получить код в SMS (см. secondFactorCodeChannel).
+//
+// Если неверные коды для аккаунта исчерпаны, код не отправляется.
+func startSignInSecondFactor(w http.ResponseWriter, r *http.Request, permanentId, login string, rememberMe bool) {
+	retryAfter, err := failedAttemptsRetryAfter(permanentId, data.FailedAttemptSignInCode, time.Now().Unix())
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if retryAfter > 0 {
+		http.Redirect(w, r, consts.SignInURL+"?msg=signInCodeAttemptsExceeded", http.StatusFound)
+		return
+	}
+
+	email, err := data.GetEmailFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	var phone string
+	if tools.SMSEnabled() {
+		phone, err = data.GetPhoneFromDb(permanentId)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	user := structs.User{
+		Login:        login,
+		Email:        email,
+		Phone:        phone,
+		PermanentId:  permanentId,
+		RememberMe:   rememberMe,
+		UserAgent:    r.UserAgent(),
+		SecondFactor: true,
+	}
+	if err := data.SetAuthDataInSession(w, r, user); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	ServerAuthCodeSend(w, r)
+}
+
+// signInCodeAllowed проверяет, можно ли сверять код подтверждения входа.
+//
+// Если срок действия кода истек или неверные коды для аккаунта исчерпаны,
+// завершает подтверждение входа и возвращает false: ответ уже отправлен.
+func signInCodeAllowed(w http.ResponseWriter, r *http.Request, user structs.User) bool {
+	now := time.Now().Unix()
+	if now-user.ServerCodeSendedAt > loadAttemptLimits().window {
+		endSignInSecondFactor(w, r, "signInCodeExpired")
+		return false
+	}
+
+	retryAfter, err := failedAttemptsRetryAfter(user.PermanentId, data.FailedAttemptSignInCode, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return false
+	}
+	if retryAfter > 0 {
+		endSignInSecondFactor(w, r, "signInCodeAttemptsExceeded")
+		return false
+	}
+	return true
+}
+
+// recordSignInCodeFailure учитывает неверный код подтверждения входа.
+//
+// Если этой попыткой лимит исчерпан, завершает подтверждение входа (код больше
+// не проверяется) и возвращает false: ответ уже отправлен.
+func recordSignInCodeFailure(w http.ResponseWriter, r *http.Request, user structs.User) bool {
+	exhausted, err := recordFailedAttempt(user.PermanentId, data.FailedAttemptSignInCode, time.Now().Unix())
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return false
+	}
+	if exhausted {
+		endSignInSecondFactor(w, r, "signInCodeAttemptsExceeded")
+		return false
+	}
+	return true
+}
+
+// completeSignInSecondFactor создает сессию после проверки кода подтверждения входа.
+//
+// Код должен быть введен с того же user agent, для которого он запрошен.
+// Статус аккаунта проверяется повторно: за время ввода кода аккаунт могли заблокировать.
+// Неверные коды для аккаунта сбрасываются, браузер становится доверенным устройством.
+func completeSignInSecondFactor(w http.ResponseWriter, r *http.Request, user structs.User) {
+	if user.UserAgent != r.UserAgent() {
+		endSignInSecondFactor(w, r, "signInCodeDeviceMismatch")
+		return
+	}
+
+	if err := data.DeleteFailedAttemptsFromDb(user.PermanentId, data.FailedAttemptSignInCode); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	status, restricted, err := accountStatus(user.PermanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if restricted {
+		if err := data.EndAuthAndCaptchaSessions(w, r); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		msgForUser := structs.MsgForUser{Msg: accountStatusMsg(r, status), CSRFToken: tmpls.CSRFToken(r)}
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
+
+	if err := trustSignInDevice(w, user.PermanentId); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
+	createSignInSession(w, r, user.PermanentId, user.Login, user.RememberMe)
+}
+
+// endSignInSecondFactor завершает подтверждение входа: удаляет сессию с кодом
+// и перенаправляет на страницу входа с сообщением msgKey.
+func endSignInSecondFactor(w http.ResponseWriter, r *http.Request, msgKey string) {
+	if err := data.EndAuthAndCaptchaSessions(w, r); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	http.Redirect(w, r, consts.SignInURL+"?msg="+msgKey, http.StatusFound)
+}
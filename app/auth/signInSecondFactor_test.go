@@ -0,0 +1,516 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует подтверждение входа кодом с нераспознанного устройства.
+package auth
+
+import (
+	"database/sql"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/captcha"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// trustedDevicesInDb подменяет таблицу trusted_device: идентификатор устройства -> permanentId.
+var trustedDevicesInDb map[string]string
+
+// setupSignInSecondFactorTest дополняет setupSignInTest зависимостями отправки и проверки кода.
+// Пароль, капча и создание сессии подменяются успешными вызовами,
+// доверенные устройства хранятся в trustedDevicesInDb.
+// Возвращает мок и функцию восстановления.
+func setupSignInSecondFactorTest(t *testing.T) (sqlmock.Sqlmock, func()) {
+	_, mock, teardownSignIn := setupSignInTest(t)
+
+	oldSetAuthDataInSession := data.SetAuthDataInSession
+	oldGetAuthDataFromSession := data.GetAuthDataFromSession
+	oldGetCaptchaCounterFromSession := data.GetCaptchaCounterFromSession
+	oldGetShowCaptchaFromSession := data.GetShowCaptchaFromSession
+	oldCheckServerAuthCodeSendQuota := reserveServerAuthCodeSend
+	oldServerAuthCodeSend := tools.ServerAuthCodeSend
+	oldServerAuthCodeSMSSend := tools.ServerAuthCodeSMSSend
+	oldGetPhoneFromDb := data.GetPhoneFromDb
+	oldCodeValidate := tools.CodeValidate
+	oldGetFailedAttemptsFromDb := data.GetFailedAttemptsFromDb
+	oldSetFailedAttemptInDb := data.SetFailedAttemptInDb
+	oldDeleteFailedAttemptsFromDb := data.DeleteFailedAttemptsFromDb
+	oldSetTrustedDeviceInDb := data.SetTrustedDeviceInDb
+	oldIsTrustedDeviceInDb := data.IsTrustedDeviceInDb
+
+	t.Setenv("SIGNIN_SECOND_FACTOR", consts.SignInSecondFactorNewDevice)
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) { return 3, false, nil }
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool { return false }
+	tools.InputValidate = func(r *http.Request, login, email, password string, isSignIn bool) (string, error) { return "", nil }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "permanent-123", nil }
+	data.IsOKPasswordHashInDb = func(permanentId, password string) error { return nil }
+	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {}
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
+		return "refresh-token-123", nil
+	}
+	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error { return nil }
+	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error { return nil }
+	data.GetCaptchaCounterFromSession = func(r *http.Request) (int64, error) { return 3, nil }
+	data.GetShowCaptchaFromSession = func(r *http.Request) (bool, error) { return false, nil }
+	reserveServerAuthCodeSend = func(user structs.User, now int64) (string, int64, error) { return "", 0, nil }
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) { return 0, 0, nil }
+	data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error { return nil }
+	data.DeleteFailedAttemptsFromDb = func(permanentId, kind string) error { return nil }
+	trustedDevicesInDb = map[string]string{}
+	data.SetTrustedDeviceInDb = func(deviceId, permanentId string, expiresAt int64) error {
+		trustedDevicesInDb[deviceId] = permanentId
+		return nil
+	}
+	data.IsTrustedDeviceInDb = func(deviceId, permanentId string, now int64) (bool, error) {
+		return trustedDevicesInDb[deviceId] == permanentId, nil
+	}
+
+	return mock, func() {
+		data.SetAuthDataInSession = oldSetAuthDataInSession
+		data.GetAuthDataFromSession = oldGetAuthDataFromSession
+		data.GetCaptchaCounterFromSession = oldGetCaptchaCounterFromSession
+		data.GetShowCaptchaFromSession = oldGetShowCaptchaFromSession
+		reserveServerAuthCodeSend = oldCheckServerAuthCodeSendQuota
+		tools.ServerAuthCodeSend = oldServerAuthCodeSend
+		tools.ServerAuthCodeSMSSend = oldServerAuthCodeSMSSend
+		data.GetPhoneFromDb = oldGetPhoneFromDb
+		tools.CodeValidate = oldCodeValidate
+		data.GetFailedAttemptsFromDb = oldGetFailedAttemptsFromDb
+		data.SetFailedAttemptInDb = oldSetFailedAttemptInDb
+		data.DeleteFailedAttemptsFromDb = oldDeleteFailedAttemptsFromDb
+		data.SetTrustedDeviceInDb = oldSetTrustedDeviceInDb
+		data.IsTrustedDeviceInDb = oldIsTrustedDeviceInDb
+		teardownSignIn()
+	}
+}
+
+// signInRequest создает POST запрос входа с логином, паролем и user agent.
+func signInRequest(userAgent string, rememberMe bool) *http.Request {
+	form := url.Values{"login": {"testuser"}, "password": {"ValidPassword123!"}}
+	if rememberMe {
+		form.Set("rememberMe", "on")
+	}
+	req := httptest.NewRequest("POST", "/sign-in", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	return req
+}
+
+// trustDevice отмечает устройство доверенным пользователю permanentId
+// и добавляет в запрос его cookie.
+func trustDevice(t *testing.T, req *http.Request, permanentId string) {
+	w := httptest.NewRecorder()
+	require.NoError(t, trustSignInDevice(w, permanentId))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	req.AddCookie(cookies[0])
+}
+
+// codeValidateRequest создает POST запрос проверки кода с user agent.
+func codeValidateRequest(userAgent string) *http.Request {
+	form := url.Values{"clientCode": {"1234"}}
+	req := httptest.NewRequest("POST", "/code-validate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	return req
+}
+
+// TestSignInSecondFactorRequired проверяет чтение политики SIGNIN_SECOND_FACTOR.
+// Ожидается: выключено без переменной и для off, включено для new-device и неизвестного значения.
+func TestSignInSecondFactorRequired(t *testing.T) {
+	tests := []struct {
+		value string
+		want  bool
+	}{
+		{"", false},
+		{consts.SignInSecondFactorOff, false},
+		{consts.SignInSecondFactorNewDevice, true},
+		{"nwe-device", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("SIGNIN_SECOND_FACTOR", tt.value)
+			assert.Equal(t, tt.want, signInSecondFactorRequired())
+		})
+	}
+}
+
+// TestIsUnrecognizedDevice проверяет распознавание устройства по доверенному устройству в БД.
+// Ожидается: браузер с cookie устройства, доверенного пользователю, распознан; без cookie,
+// для другого пользователя и после отмены доверия на сервере - нет; ошибка БД возвращается.
+func TestIsUnrecognizedDevice(t *testing.T) {
+	_, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+
+	req := httptest.NewRequest("POST", "/sign-in", nil)
+	unrecognized, err := isUnrecognizedDevice(req, "permanent-123")
+	require.NoError(t, err)
+	assert.True(t, unrecognized)
+
+	trustDevice(t, req, "permanent-123")
+	unrecognized, err = isUnrecognizedDevice(req, "permanent-123")
+	require.NoError(t, err)
+	assert.False(t, unrecognized)
+	unrecognized, err = isUnrecognizedDevice(req, "permanent-456")
+	require.NoError(t, err)
+	assert.True(t, unrecognized)
+
+	// Смена пароля или завершение всех сессий отменяет доверие в БД
+	trustedDevicesInDb = map[string]string{}
+	unrecognized, err = isUnrecognizedDevice(req, "permanent-123")
+	require.NoError(t, err)
+	assert.True(t, unrecognized, "Отмененное доверие не должно приниматься")
+
+	data.IsTrustedDeviceInDb = func(deviceId, permanentId string, now int64) (bool, error) {
+		return false, errors.WithStack(sql.ErrConnDone)
+	}
+	_, err = isUnrecognizedDevice(req, "permanent-123")
+	assert.Error(t, err)
+}
+
+// TestCheckInDbAndValidateSignInUserInput_SecondFactorNewDevice проверяет вход с нового устройства
+// при включенном подтверждении кодом. User agent уже встречался у пользователя, но cookie
+// доверенного устройства нет.
+// Ожидается: код отправлен на email аккаунта, сессия не создается, данные входа без пароля
+// сохранены в сессии, редирект на страницу ввода кода с сообщением.
+func TestCheckInDbAndValidateSignInUserInput_SecondFactorNewDevice(t *testing.T) {
+	mock, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+
+	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) {
+		return []string{"new-user-agent"}, nil
+	}
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		t.Error("session should not be created before the code is confirmed")
+		return nil
+	}
+	var sentTo string
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		sentTo = email
+		return "1234", nil
+	}
+	var savedUser structs.User
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, user any) error {
+		savedUser = user.(structs.User)
+		return nil
+	}
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) { return savedUser, nil }
+
+	mock.ExpectQuery(regexp.QuoteMeta(data.EmailSelectQuery)).
+		WithArgs("permanent-123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
+
+	w := httptest.NewRecorder()
+	CheckInDbAndValidateSignInUserInput(w, signInRequest("new-user-agent", true))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.ServerAuthCodeSendURL+"?msg=signInCodeSent", w.Header().Get("Location"))
+	assert.Equal(t, "user@example.com", sentTo)
+	assert.Equal(t, structs.User{
+		Login:                  "testuser",
+		Email:                  "user@example.com",
+		ServerCode:             "1234",
+		ServerCodeSendedConter: 1,
+		ServerCodeSendedAt:     savedUser.ServerCodeSendedAt,
+		UserAgent:              "new-user-agent",
+		PermanentId:            "permanent-123",
+		RememberMe:             true,
+		SecondFactor:           true,
+	}, savedUser)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCheckInDbAndValidateSignInUserInput_SecondFactorKnownDevice проверяет вход с известного устройства
+// при включенном подтверждении кодом.
+// Ожидается: код не отправляется, сессия создается сразу.
+func TestCheckInDbAndValidateSignInUserInput_SecondFactorKnownDevice(t *testing.T) {
+	mock, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+
+	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) {
+		return []string{"test-user-agent"}, nil
+	}
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		return nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	req := signInRequest("test-user-agent", false)
+	trustDevice(t, req, "permanent-123")
+	w := httptest.NewRecorder()
+	CheckInDbAndValidateSignInUserInput(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCodeValidate_SignInSecondFactor проверяет создание сессии после ввода кода подтверждения входа.
+// Ожидается: temporaryId сохранен для user agent запроса с rememberMe из формы входа,
+// аккаунт не создается, неверные коды сбрасываются, браузер получает cookie доверенного
+// устройства, редирект на главную страницу.
+func TestCodeValidate_SignInSecondFactor(t *testing.T) {
+	mock, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{Login: "testuser", Email: "user@example.com", ServerCode: "1234", ServerCodeSendedAt: time.Now().Unix(), UserAgent: "new-user-agent", PermanentId: "permanent-123", RememberMe: true, SecondFactor: true}, nil
+	}
+	var deletedKind string
+	data.DeleteFailedAttemptsFromDb = func(permanentId, kind string) error {
+		deletedKind = kind
+		return nil
+	}
+	tools.CodeValidate = func(r *http.Request, clientCode, serverCode string) error { return nil }
+	var sessionPermanentId, sessionUserAgent string
+	var sessionRememberMe bool
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		sessionPermanentId, sessionUserAgent, sessionRememberMe = permanentId, userAgent, rememberMe
+		return nil
+	}
+	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) {
+		return []string{"new-user-agent"}, nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	CodeValidate(w, codeValidateRequest("new-user-agent"))
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.Equal(t, "permanent-123", sessionPermanentId)
+	assert.Equal(t, "new-user-agent", sessionUserAgent)
+	assert.True(t, sessionRememberMe)
+	assert.Equal(t, data.FailedAttemptSignInCode, deletedKind)
+
+	req := httptest.NewRequest("POST", "/sign-in", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	unrecognized, err := isUnrecognizedDevice(req, "permanent-123")
+	require.NoError(t, err)
+	assert.False(t, unrecognized, "После ввода кода устройство должно стать доверенным")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCodeValidate_SignInSecondFactorRejected проверяет отказ во входе после ввода кода:
+// код введен с другого устройства или аккаунт заблокирован за время ввода.
+// Ожидается: сессия не создается, данные входа удаляются из сессии.
+func TestCodeValidate_SignInSecondFactorRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		status    string
+	}{
+		{"another device", "other-user-agent", data.AccountStatusActive},
+		{"account disabled", "new-user-agent", data.AccountStatusDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupSignInSecondFactorTest(t)
+			defer teardown()
+
+			data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+				return structs.User{Login: "testuser", ServerCode: "1234", ServerCodeSendedAt: time.Now().Unix(), UserAgent: "new-user-agent", PermanentId: "permanent-123", SecondFactor: true}, nil
+			}
+			tools.CodeValidate = func(r *http.Request, clientCode, serverCode string) error { return nil }
+			data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+				return structs.AccountStatus{PermanentId: permanentId, Status: tt.status}, nil
+			}
+			data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+				t.Error("session should not be created")
+				return nil
+			}
+			sessionEnded := false
+			data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
+				sessionEnded = true
+				return nil
+			}
+			var msgForUser structs.MsgForUser
+			tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+				assert.Equal(t, "signIn", templateName)
+				msgForUser = data.(structs.MsgForUser)
+				return nil
+			}
+
+			w := httptest.NewRecorder()
+			CodeValidate(w, codeValidateRequest(tt.userAgent))
+
+			assert.True(t, sessionEnded)
+			if tt.status == data.AccountStatusActive {
+				assert.Equal(t, consts.SignInURL+"?msg=signInCodeDeviceMismatch", w.Header().Get("Location"))
+			} else {
+				assert.Equal(t, i18n.Text(i18n.En, "accountDisabled"), msgForUser.Msg)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestSignInSecondFactor_SMS проверяет получение кода подтверждения входа в SMS.
+// Ожидается: первый код уходит на email со ссылкой на SMS; по запросу channel=sms код
+// отправляется на подтвержденный номер аккаунта, страница предлагает вернуться к email.
+func TestSignInSecondFactor_SMS(t *testing.T) {
+	mock, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+	t.Setenv("SMS_DRIVER", "log")
+
+	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) { return nil, nil }
+	data.GetPhoneFromDb = func(permanentId string) (string, error) { return "+79991234567", nil }
+	var sentTo []string
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		sentTo = append(sentTo, email)
+		return "1234", nil
+	}
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		sentTo = append(sentTo, phone)
+		return "5678", nil
+	}
+	var savedUser structs.User
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, user any) error {
+		savedUser = user.(structs.User)
+		return nil
+	}
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) { return savedUser, nil }
+
+	mock.ExpectQuery(regexp.QuoteMeta(data.EmailSelectQuery)).
+		WithArgs("permanent-123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
+
+	w := httptest.NewRecorder()
+	CheckInDbAndValidateSignInUserInput(w, signInRequest("new-user-agent", false))
+	assert.Equal(t, consts.ServerAuthCodeSendURL+"?altChannel=sms&msg=signInCodeSent", w.Header().Get("Location"))
+	assert.Equal(t, "+79991234567", savedUser.Phone)
+
+	savedUser.ServerCodeSendedAt = 0
+	w = httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", consts.ServerAuthCodeSendAgainURL+"?channel=sms", nil))
+	assert.Equal(t, consts.ServerAuthCodeSendURL+"?altChannel=email&channel=sms&msg=signInCodeSentSMS", w.Header().Get("Location"))
+	assert.Equal(t, []string{"user@example.com", "+79991234567"}, sentTo)
+	assert.Equal(t, consts.CodeChannelSMS, savedUser.CodeChannel)
+	assert.Equal(t, "5678", savedUser.ServerCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCodeValidate_SignInCodeAttempts проверяет лимит неверных кодов подтверждения входа.
+// Ожидается: неверный код учитывается и страница кода показывается снова; попытка, исчерпавшая
+// лимит, завершает подтверждение; при исчерпанном лимите и истекшем коде код не сверяется.
+func TestCodeValidate_SignInCodeAttempts(t *testing.T) {
+	tests := []struct {
+		name         string
+		sentAgo      int64
+		failedBefore int
+		location     string
+		checked      bool
+		recorded     bool
+	}{
+		{name: "wrong code", failedBefore: 1, checked: true, recorded: true},
+		{name: "last attempt", failedBefore: 4, location: consts.SignInURL + "?msg=signInCodeAttemptsExceeded", checked: true, recorded: true},
+		{name: "attempts exhausted", failedBefore: 5, location: consts.SignInURL + "?msg=signInCodeAttemptsExceeded"},
+		{name: "code expired", sentAgo: 16 * 60, location: consts.SignInURL + "?msg=signInCodeExpired"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, teardown := setupSignInSecondFactorTest(t)
+			defer teardown()
+
+			data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+				return structs.User{ServerCode: "1234", ServerCodeSendedAt: time.Now().Unix() - tt.sentAgo, UserAgent: "new-user-agent", PermanentId: "permanent-123", SecondFactor: true}, nil
+			}
+			failed := tt.failedBefore
+			data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+				assert.Equal(t, data.FailedAttemptSignInCode, kind)
+				return failed, time.Now().Unix(), nil
+			}
+			recorded := false
+			data.SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error {
+				assert.Equal(t, "permanent-123", permanentId)
+				assert.Equal(t, data.FailedAttemptSignInCode, kind)
+				recorded = true
+				failed++
+				return nil
+			}
+			checked := false
+			tools.CodeValidate = func(r *http.Request, clientCode, serverCode string) error {
+				checked = true
+				return errors.New("code invalid")
+			}
+			sessionEnded := false
+			data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
+				sessionEnded = true
+				return nil
+			}
+			var templateName string
+			tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, name string, data interface{}) error {
+				templateName = name
+				return nil
+			}
+
+			w := httptest.NewRecorder()
+			CodeValidate(w, codeValidateRequest("new-user-agent"))
+
+			assert.Equal(t, tt.checked, checked)
+			assert.Equal(t, tt.recorded, recorded)
+			if tt.location == "" {
+				assert.Equal(t, "serverAuthCodeSend", templateName)
+				assert.False(t, sessionEnded)
+			} else {
+				assert.Equal(t, tt.location, w.Header().Get("Location"))
+				assert.True(t, sessionEnded)
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+// TestCheckInDbAndValidateSignInUserInput_SecondFactorAttemptsExhausted проверяет вход с нового
+// устройства, когда неверные коды для аккаунта исчерпаны.
+// Ожидается: код не отправляется, сессия не создается, редирект на страницу входа с сообщением.
+func TestCheckInDbAndValidateSignInUserInput_SecondFactorAttemptsExhausted(t *testing.T) {
+	mock, teardown := setupSignInSecondFactorTest(t)
+	defer teardown()
+
+	data.GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+		return 5, time.Now().Unix(), nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent")
+		return "", nil
+	}
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		t.Error("session should not be created")
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	CheckInDbAndValidateSignInUserInput(w, signInRequest("new-user-agent", false))
+
+	assert.Equal(t, consts.SignInURL+"?msg=signInCodeAttemptsExceeded", w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
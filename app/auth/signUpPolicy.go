@@ -0,0 +1,209 @@
+// Package auth предоставляет функции для аутентификации и авторизации.
+//
+// Файл содержит правила регистрации новых аккаунтов:
+//   - loadSignUpPolicy: загружает режим регистрации и ограничения доменов из переменных окружения
+//   - checkSignUpPolicy: проверяет, можно ли зарегистрировать email с кодом приглашения
+//   - useInviteTx: отмечает приглашение использованным при создании аккаунта
+//   - SignUpPage: отображает страницу регистрации с учетом режима регистрации
+//   - renderSignUpPolicyMsg: возвращает пользователя на страницу регистрации с сообщением
+//
+// Правила одинаковы для регистрации по паролю и первого входа через Yandex.
+// Ограничения доменов действуют в режимах open и invite, в том числе для приглашенных.
+package auth
+
+import (
+	"database/sql"
+	_ "embed"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/pkg/errors"
+)
+
+// disposableEmailDomainsList содержит встроенный список доменов одноразовой почты.
+//
+//go:embed disposableEmailDomains.txt
+var disposableEmailDomainsList string
+
+// disposableEmailDomains - домены одноразовой почты из disposableEmailDomainsList.
+var disposableEmailDomains = parseDomains(strings.Split(disposableEmailDomainsList, "\n"))
+
+// signUpPolicy описывает правила регистрации.
+type signUpPolicy struct {
+	mode            string
+	allowedDomains  map[string]bool
+	deniedDomains   map[string]bool
+	blockDisposable bool
+}
+
+// loadSignUpPolicy загружает правила регистрации.
+//
+// Использует переменные окружения:
+//   - SIGNUP_MODE: open (по умолчанию), closed или invite; неизвестное значение считается closed
+//   - SIGNUP_ALLOWED_DOMAINS: домены через запятую, с которых разрешена регистрация (по умолчанию любые)
+//   - SIGNUP_DENIED_DOMAINS: домены через запятую, с которых регистрация запрещена
+//   - SIGNUP_BLOCK_DISPOSABLE_EMAILS: false разрешает одноразовую почту (по умолчанию запрещена)
+func loadSignUpPolicy() signUpPolicy {
+	mode := os.Getenv("SIGNUP_MODE")
+	switch mode {
+	case "":
+		mode = consts.SignUpModeOpen
+	case consts.SignUpModeOpen, consts.SignUpModeClosed, consts.SignUpModeInvite:
+	default:
+		mode = consts.SignUpModeClosed
+	}
+
+	return signUpPolicy{
+		mode:            mode,
+		allowedDomains:  parseDomains(strings.Split(os.Getenv("SIGNUP_ALLOWED_DOMAINS"), ",")),
+		deniedDomains:   parseDomains(strings.Split(os.Getenv("SIGNUP_DENIED_DOMAINS"), ",")),
+		blockDisposable: os.Getenv("SIGNUP_BLOCK_DISPOSABLE_EMAILS") != "false",
+	}
+}
+
+// parseDomains приводит домены к нижнему регистру и пропускает пустые строки и комментарии (#).
+func parseDomains(lines []string) map[string]bool {
+	domains := map[string]bool{}
+	for _, line := range lines {
+		domain := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(line)), "@")
+		if domain == "" || strings.HasPrefix(domain, "#") {
+			continue
+		}
+		domains[domain] = true
+	}
+	return domains
+}
+
+// domainInList проверяет, совпадает ли домен или один из его родительских доменов с доменом списка.
+func domainInList(domain string, domains map[string]bool) bool {
+	for {
+		if domains[domain] {
+			return true
+		}
+		dot := strings.Index(domain, ".")
+		if dot < 0 {
+			return false
+		}
+		domain = domain[dot+1:]
+	}
+}
+
+// emailDomainMsgKey проверяет домен email по спискам доменов.
+//
+// Запрещенные домены проверяются первыми. Если задан список разрешенных доменов,
+// регистрация возможна только с них, и одноразовая почта из него не блокируется.
+// Возвращает ключ сообщения или пустую строку, если домен подходит.
+func (policy signUpPolicy) emailDomainMsgKey(email string) string {
+	domain := strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+	if domainInList(domain, policy.deniedDomains) {
+		return "emailDomainNotAllowed"
+	}
+	if len(policy.allowedDomains) > 0 {
+		if !domainInList(domain, policy.allowedDomains) {
+			return "emailDomainNotAllowed"
+		}
+		return ""
+	}
+	if policy.blockDisposable && domainInList(domain, disposableEmailDomains) {
+		return "disposableEmail"
+	}
+	return ""
+}
+
+// checkSignUpPolicy проверяет, можно ли создать аккаунт с email и кодом приглашения inviteCode.
+//
+// В режиме invite приглашение должно существовать, не быть использованным, отозванным
+// или истекшим, а приглашение с email - совпадать с регистрируемым адресом.
+// Возвращает ключ сообщения для пользователя (пустой, если регистрация разрешена)
+// и код приглашения, который нужно отметить использованным (пустой вне режима invite).
+var checkSignUpPolicy = func(email, inviteCode string, now int64) (string, string, error) {
+	policy := loadSignUpPolicy()
+	if policy.mode == consts.SignUpModeClosed {
+		return "signUpClosed", "", nil
+	}
+	if msgKey := policy.emailDomainMsgKey(email); msgKey != "" {
+		return msgKey, "", nil
+	}
+	if policy.mode != consts.SignUpModeInvite {
+		return "", "", nil
+	}
+
+	inviteCode = strings.TrimSpace(inviteCode)
+	if inviteCode == "" {
+		return "inviteRequired", "", nil
+	}
+	invite, err := data.GetInviteFromDb(inviteCode)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "inviteInvalid", "", nil
+		}
+		return "", "", errors.WithStack(err)
+	}
+	if invite.Cancelled || invite.UsedAt != 0 || invite.ExpiresAt != 0 && invite.ExpiresAt <= now {
+		return "inviteInvalid", "", nil
+	}
+	if invite.Email != "" && !strings.EqualFold(invite.Email, email) {
+		return "inviteEmailMismatch", "", nil
+	}
+	return "", invite.Code, nil
+}
+
+// useInviteTx отмечает приглашение inviteCode использованным аккаунтом permanentId.
+//
+// Пустой код (регистрация без приглашения) пропускается.
+// Возвращает data.ErrInviteUnavailable, если приглашение успели использовать или отозвать.
+func useInviteTx(tx *sql.Tx, inviteCode, permanentId string) error {
+	if inviteCode == "" {
+		return nil
+	}
+	if err := data.SetInviteUsedInDbTx(tx, inviteCode, permanentId, time.Now().Unix()); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SignUpPage отображает страницу регистрации.
+//
+// Код приглашения берется из параметра invite (ссылка из приглашения).
+// Режим регистрации определяется так же, как при проверке (loadSignUpPolicy):
+// в режиме closed, в том числе при неизвестном SIGNUP_MODE, страница показывает
+// сообщение о закрытой регистрации.
+var SignUpPage = func(w http.ResponseWriter, r *http.Request) {
+	msgKey := ""
+	if loadSignUpPolicy().mode == consts.SignUpModeClosed {
+		msgKey = "signUpClosed"
+	}
+	renderSignUpPolicyMsg(w, r, msgKey, r.URL.Query().Get("invite"))
+}
+
+// renderSignUpPolicyMsg отображает страницу регистрации с сообщением по ключу msgKey.
+//
+// Поле кода приглашения показывается в режиме invite или если код передан,
+// и заполняется этим кодом; выбор получения кода в SMS - если отправка SMS настроена.
+// Пустой ключ отображает страницу без сообщения.
+func renderSignUpPolicyMsg(w http.ResponseWriter, r *http.Request, msgKey, inviteCode string) {
+	msgForUser := structs.MsgForUser{
+		CSRFToken:      tmpls.CSRFToken(r),
+		InviteCode:     inviteCode,
+		InviteRequired: loadSignUpPolicy().mode == consts.SignUpModeInvite,
+		SMSEnabled:     tools.SMSEnabled(),
+	}
+	if i18n.Has(msgKey) {
+		msgForUser.Msg = i18n.Msg(r, msgKey)
+		msgForUser.MsgKey = msgKey
+		msgForUser.Regs = i18n.Reqs(r, msgKey)
+	}
+	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signUp", msgForUser); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
@@ -0,0 +1,200 @@
+// Package auth предоставляет тесты для модуля аутентификации и авторизации.
+//
+// Файл тестирует правила регистрации новых аккаунтов.
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadSignUpPolicy проверяет загрузку правил регистрации из окружения.
+// Ожидается: по умолчанию open с блокировкой одноразовой почты, неизвестный режим - closed,
+// домены приводятся к нижнему регистру без "@" и пробелов.
+func TestLoadSignUpPolicy(t *testing.T) {
+	t.Setenv("SIGNUP_MODE", "")
+	t.Setenv("SIGNUP_ALLOWED_DOMAINS", "")
+	t.Setenv("SIGNUP_DENIED_DOMAINS", "")
+	t.Setenv("SIGNUP_BLOCK_DISPOSABLE_EMAILS", "")
+	policy := loadSignUpPolicy()
+	assert.Equal(t, consts.SignUpModeOpen, policy.mode)
+	assert.Empty(t, policy.allowedDomains)
+	assert.True(t, policy.blockDisposable)
+
+	t.Setenv("SIGNUP_MODE", "invites")
+	t.Setenv("SIGNUP_ALLOWED_DOMAINS", " Example.com, @corp.example.org ,")
+	t.Setenv("SIGNUP_BLOCK_DISPOSABLE_EMAILS", "false")
+	policy = loadSignUpPolicy()
+	assert.Equal(t, consts.SignUpModeClosed, policy.mode)
+	assert.Equal(t, map[string]bool{"example.com": true, "corp.example.org": true}, policy.allowedDomains)
+	assert.False(t, policy.blockDisposable)
+
+	t.Setenv("SIGNUP_MODE", consts.SignUpModeInvite)
+	assert.Equal(t, consts.SignUpModeInvite, loadSignUpPolicy().mode)
+}
+
+// TestEmailDomainMsgKey проверяет ограничения доменов email.
+// Ожидается: запрещенный домен и его поддомены отклоняются, при списке разрешенных
+// проходят только они, одноразовая почта блокируется, если не разрешена явно.
+func TestEmailDomainMsgKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy signUpPolicy
+		email  string
+		msgKey string
+	}{
+		{name: "any domain", policy: signUpPolicy{blockDisposable: true}, email: "user@example.com", msgKey: ""},
+		{name: "denied domain", policy: signUpPolicy{deniedDomains: map[string]bool{"example.com": true}}, email: "user@Mail.Example.com", msgKey: "emailDomainNotAllowed"},
+		{name: "allowed domain", policy: signUpPolicy{allowedDomains: map[string]bool{"corp.com": true}}, email: "user@corp.com", msgKey: ""},
+		{name: "not allowed domain", policy: signUpPolicy{allowedDomains: map[string]bool{"corp.com": true}}, email: "user@notcorp.com", msgKey: "emailDomainNotAllowed"},
+		{name: "disposable", policy: signUpPolicy{blockDisposable: true}, email: "user@mailinator.com", msgKey: "disposableEmail"},
+		{name: "disposable subdomain", policy: signUpPolicy{blockDisposable: true}, email: "user@eu.yopmail.com", msgKey: "disposableEmail"},
+		{name: "disposable allowed", policy: signUpPolicy{}, email: "user@mailinator.com", msgKey: ""},
+		{name: "disposable in allowlist", policy: signUpPolicy{allowedDomains: map[string]bool{"mailinator.com": true}, blockDisposable: true}, email: "user@mailinator.com", msgKey: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.msgKey, tt.policy.emailDomainMsgKey(tt.email))
+		})
+	}
+}
+
+// TestCheckSignUpPolicy проверяет режимы регистрации и приглашения.
+// Ожидается: в режиме closed регистрация запрещена, в режиме invite нужен действующий
+// код приглашения, приглашение с email действует только для этого адреса.
+func TestCheckSignUpPolicy(t *testing.T) {
+	oldGetInviteFromDb := data.GetInviteFromDb
+	defer func() { data.GetInviteFromDb = oldGetInviteFromDb }()
+	data.GetInviteFromDb = func(code string) (structs.Invite, error) {
+		invites := map[string]structs.Invite{
+			"any":     {Code: "any"},
+			"bound":   {Code: "bound", Email: "User@Example.com"},
+			"used":    {Code: "used", UsedAt: 50},
+			"revoked": {Code: "revoked", Cancelled: true},
+			"expired": {Code: "expired", ExpiresAt: 100},
+			"valid":   {Code: "valid", ExpiresAt: 101},
+		}
+		if code == "broken" {
+			return structs.Invite{}, sql.ErrConnDone
+		}
+		invite, ok := invites[code]
+		if !ok {
+			return structs.Invite{}, sql.ErrNoRows
+		}
+		return invite, nil
+	}
+	t.Setenv("SIGNUP_ALLOWED_DOMAINS", "")
+	t.Setenv("SIGNUP_DENIED_DOMAINS", "denied.com")
+	t.Setenv("SIGNUP_BLOCK_DISPOSABLE_EMAILS", "")
+
+	tests := []struct {
+		name       string
+		mode       string
+		email      string
+		inviteCode string
+		msgKey     string
+		useCode    string
+	}{
+		{name: "open", mode: consts.SignUpModeOpen, email: "user@example.com", inviteCode: "any", msgKey: "", useCode: ""},
+		{name: "open denied domain", mode: consts.SignUpModeOpen, email: "user@denied.com", msgKey: "emailDomainNotAllowed"},
+		{name: "closed", mode: consts.SignUpModeClosed, email: "user@example.com", inviteCode: "any", msgKey: "signUpClosed"},
+		{name: "invite required", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: " ", msgKey: "inviteRequired"},
+		{name: "invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: " any ", msgKey: "", useCode: "any"},
+		{name: "invite for email", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "bound", msgKey: "", useCode: "bound"},
+		{name: "invite for other email", mode: consts.SignUpModeInvite, email: "other@example.com", inviteCode: "bound", msgKey: "inviteEmailMismatch"},
+		{name: "invite denied domain", mode: consts.SignUpModeInvite, email: "user@denied.com", inviteCode: "any", msgKey: "emailDomainNotAllowed"},
+		{name: "unknown invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "missing", msgKey: "inviteInvalid"},
+		{name: "used invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "used", msgKey: "inviteInvalid"},
+		{name: "revoked invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "revoked", msgKey: "inviteInvalid"},
+		{name: "expired invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "expired", msgKey: "inviteInvalid"},
+		{name: "not expired invite", mode: consts.SignUpModeInvite, email: "user@example.com", inviteCode: "valid", msgKey: "", useCode: "valid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("SIGNUP_MODE", tt.mode)
+			msgKey, useCode, err := checkSignUpPolicy(tt.email, tt.inviteCode, 100)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.msgKey, msgKey)
+			assert.Equal(t, tt.useCode, useCode)
+		})
+	}
+
+	t.Setenv("SIGNUP_MODE", consts.SignUpModeInvite)
+	_, _, err := checkSignUpPolicy("user@example.com", "broken", 100)
+	assert.Error(t, err)
+}
+
+// TestUseInviteTx проверяет отметку приглашения при создании аккаунта.
+// Ожидается: без кода запрос не выполняется, использованный код возвращает ErrInviteUnavailable.
+func TestUseInviteTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.InviteUseUpdateQuery).WithArgs("perm123", sqlmock.AnyArg(), "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(data.InviteUseUpdateQuery).WithArgs("perm456", sqlmock.AnyArg(), "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, useInviteTx(tx, "", "perm123"))
+	assert.NoError(t, useInviteTx(tx, "code1", "perm123"))
+	assert.ErrorIs(t, useInviteTx(tx, "code1", "perm456"), data.ErrInviteUnavailable)
+	require.NoError(t, tx.Rollback())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSignUpPage проверяет страницу регистрации в разных режимах регистрации.
+// Ожидается: CSRF токен в форме; в режиме invite поле кода приглашения с кодом из ссылки,
+// который передается и в форму входа через Yandex; в режиме open без кода поля нет;
+// при неизвестном режиме - сообщение о закрытой регистрации; выбор SMS только при SMS_DRIVER.
+func TestSignUpPage(t *testing.T) {
+	signUpPage := func(target string) string {
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(context.WithValue(req.Context(), consts.CSRFTokenCtxKey, "csrf123"))
+		w := httptest.NewRecorder()
+		SignUpPage(w, req)
+		return w.Body.String()
+	}
+
+	t.Setenv("SIGNUP_MODE", consts.SignUpModeInvite)
+	body := signUpPage("/sign-up?invite=code1")
+	assert.Contains(t, body, `name="csrfToken" value="csrf123"`)
+	assert.Contains(t, body, `name="invite" value="code1"`)
+	assert.Contains(t, body, `type="hidden" name="invite" value="code1"`)
+
+	t.Setenv("SIGNUP_MODE", consts.SignUpModeOpen)
+	body = signUpPage("/sign-up")
+	assert.NotContains(t, body, `name="invite"`)
+	assert.NotContains(t, body, i18n.Text(i18n.En, "signUpClosed"))
+
+	t.Setenv("SIGNUP_MODE", "invite-only")
+	assert.Contains(t, signUpPage("/sign-up"), i18n.Text(i18n.En, "signUpClosed"))
+
+	t.Setenv("SIGNUP_MODE", "")
+	t.Setenv("SMS_DRIVER", "log")
+	body = signUpPage("/sign-up")
+	assert.Contains(t, body, `name="phone"`)
+	assert.Contains(t, body, `value="email" checked`)
+	assert.Contains(t, body, `value="sms">`)
+
+	t.Setenv("SMS_DRIVER", "")
+	body = signUpPage("/sign-up")
+	assert.NotContains(t, body, `name="phone"`)
+	assert.NotContains(t, body, `name="codeChannel"`)
+}
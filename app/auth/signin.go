@@ -5,6 +5,7 @@ package auth
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 	"slices"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
 	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -20,21 +22,36 @@ import (
 	"github.com/pkg/errors"
 )
 
+// getPermanentIdBySignInIdentifier получает permanentId по логину или email из формы входа.
+//
+// Идентификатор с символом "@" считается email и ищется среди адресов для входа по паролю
+// (yauth = false), иначе - среди логинов. Возвращает sql.ErrNoRows, если пользователь не найден.
+func getPermanentIdBySignInIdentifier(identifier string) (string, error) {
+	if strings.Contains(identifier, "@") {
+		yauth := false
+		return data.GetPermanentIdFromDbByEmail(identifier, yauth)
+	}
+	return data.GetPermanentIdFromDbByLogin(identifier)
+}
+
 // CheckInDbAndValidateSignInUserInput обрабатывает запрос на вход пользователя в систему.
 //
 // Функция выполняет следующие шаги:
 // 1. Инициализирует состояние капчи и проверяет необходимость её отображения
-// 2. Валидирует входные данные (логин и пароль)
-// 3. Проверяет существование пользователя в базе данных
+// 2. Валидирует входные данные (логин или email и пароль)
+// 3. Проверяет существование пользователя в базе данных по логину или email
 // 4. Проверяет корректность пароля
-// 5. Отменяет (revokes) все ранее выданные refresh токены и временные идентификаторы (temporary IDs)
+// 5. Если включено подтверждение входа кодом (SIGNIN_SECOND_FACTOR) и user agent не встречался ранее,
+//    отправляет код на email и перенаправляет на страницу ввода кода: сессия создается
+//    только после его проверки (см. startSignInSecondFactor)
+// 6. Отменяет (revokes) все ранее выданные refresh токены и временные идентификаторы (temporary IDs)
 //    для данного пользователя (permanentId) и user agent'а (или всех, в зависимости от политики).
-// 6. Создаёт новую пару: временный идентификатор сессии (temporary ID) и refresh token
+// 7. Создаёт новую пару: временный идентификатор сессии (temporary ID) и refresh token
 //    в одной транзакции для обеспечения целостности данных.
-// 7. Сохраняет temporary ID в куки.
-// 8. Отправляет уведомление о входе с нового устройства (если user agent не встречался ранее).
-// 9. Завершает аутентификационные сессии (капча, данные входа).
-// 10. Перенаправляет на главную страницу.
+// 8. Сохраняет temporary ID в куки.
+// 9. Ставит в очередь уведомление о входе с нового устройства на email пользователя (если user agent не встречался ранее); ошибка не прерывает вход.
+// 10. Завершает аутентификационные сессии (капча, данные входа).
+// 11. Перенаправляет на главную страницу.
 //
 // При ошибках возвращает пользователя на страницу входа с соответствующим сообщением.
 // При исчерпании попыток входа требует ввод капчи.
@@ -45,7 +62,7 @@ import (
 //
 // Параметры:
 //   - w: http.ResponseWriter для записи ответа
-//   - r: *http.Request с данными формы входа (login, email, password, rememberMe)
+//   - r: *http.Request с данными формы входа (login - логин или email, password, rememberMe)
 func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request) {
 	captchaCounter, showCaptcha, err := captcha.InitCaptchaState(w, r)
 	if err != nil {
@@ -55,13 +72,12 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 
 	captchaMsgErr := captcha.ShowCaptchaMsg(r, showCaptcha)
 	var msgForUser structs.MsgForUser
+	// Поле login принимает логин или email
 	login := r.FormValue("login")
-	email := r.FormValue("email")
 	password := r.FormValue("password")
 
 	user := structs.User{
 		Login:    login,
-		Email:    email,
 		Password: password,
 	}
 
@@ -69,12 +85,12 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		errMsgKey, err := tools.InputValidate(r, login, "", password, true)
 		if err != nil {
 			if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-				msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
 			} else {
 				if strings.Contains(err.Error(), "passwordInvalid") {
-					msgForUser = structs.MsgForUser{Msg: consts.MsgForUser[errMsgKey].Msg, ShowCaptcha: showCaptcha, ShowForgotPassword: true, Regs: consts.MsgForUser[errMsgKey].Regs}
+					msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, errMsgKey), MsgKey: errMsgKey, ShowCaptcha: showCaptcha, ShowForgotPassword: true, Regs: i18n.Reqs(r, errMsgKey)}
 				} else {
-					msgForUser = structs.MsgForUser{Msg: consts.MsgForUser[errMsgKey].Msg, ShowCaptcha: showCaptcha, Regs: consts.MsgForUser[errMsgKey].Regs}
+					msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, errMsgKey), MsgKey: errMsgKey, ShowCaptcha: showCaptcha, Regs: i18n.Reqs(r, errMsgKey)}
 				}
 			}
 
@@ -82,6 +98,7 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
 			}
+			msgForUser.CSRFToken = tmpls.CSRFToken(r)
 			if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
@@ -91,13 +108,16 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
-	permanentId, err := data.GetPermanentIdFromDbByLogin(user.Login)
+	permanentId, err := getPermanentIdBySignInIdentifier(user.Login)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-				msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
+			} else if strings.Contains(user.Login, "@") && isYauthEmail(user.Login) {
+				// Аккаунт создан через Yandex и не имеет логина и пароля
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "yauthPasswordNotSet"), MsgKey: "yauthPasswordNotSet", ShowCaptcha: showCaptcha}
 			} else {
-				msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["userNotExist"].Msg, ShowCaptcha: showCaptcha}
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "userNotExist"), MsgKey: "userNotExist", ShowCaptcha: showCaptcha}
 			}
 		}
 
@@ -105,6 +125,7 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
 		}
+		msgForUser.CSRFToken = tmpls.CSRFToken(r)
 		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -115,9 +136,9 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 	if err := data.IsOKPasswordHashInDb(permanentId, user.Password); err != nil {
 		if strings.Contains(err.Error(), "password invalid") {
 			if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-				msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
 			} else {
-				msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["passwordInvalid"].Msg, ShowCaptcha: showCaptcha, ShowForgotPassword: true, Regs: consts.MsgForUser["passwordInvalid"].Regs}
+				msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "passwordInvalid"), MsgKey: "passwordInvalid", ShowCaptcha: showCaptcha, ShowForgotPassword: true, Regs: i18n.Reqs(r, "passwordInvalid")}
 			}
 		}
 
@@ -125,6 +146,7 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
 		}
+		msgForUser.CSRFToken = tmpls.CSRFToken(r)
 		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -132,6 +154,45 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Заблокированный аккаунт не может войти даже с верным паролем
+	status, restricted, err := accountStatus(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if restricted {
+		msgForUser = structs.MsgForUser{Msg: accountStatusMsg(r, status), CSRFToken: tmpls.CSRFToken(r)}
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
+
+	rememberMe := r.FormValue("rememberMe") != ""
+	if signInSecondFactorRequired() {
+		unrecognized, err := isUnrecognizedDevice(r, permanentId)
+		if err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		if unrecognized {
+			startSignInSecondFactor(w, r, permanentId, user.Login, rememberMe)
+			return
+		}
+	}
+
+	createSignInSession(w, r, permanentId, user.Login, rememberMe)
+}
+
+// createSignInSession создает сессию пользователя, вошедшего по паролю.
+//
+// В одной транзакции сохраняет temporaryId и refresh token для user agent запроса
+// и отменяет запланированное удаление аккаунта. Ставит в очередь уведомление о входе
+// с нового устройства, завершает аутентификационные сессии и перенаправляет на главную страницу.
+//
+// Вызывается после проверки пароля, а при подтверждении входа кодом - после проверки кода.
+func createSignInSession(w http.ResponseWriter, r *http.Request, permanentId, login string, rememberMe bool) {
 	tx, err := data.Db.Begin()
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
@@ -146,16 +207,20 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 	}()
 
 	temporaryId := uuid.New().String()
-	rememberMe := r.FormValue("rememberMe") != ""
 	data.SetTemporaryIdInCookies(w, temporaryId, consts.Exp7Days, rememberMe)
 
 	userAgent := r.UserAgent()
-	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, false); err != nil {
+	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, false, rememberMe); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
-	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe)
+	roles, err := data.GetUserRolesFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe, roles)
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
@@ -165,6 +230,12 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Вход в течение срока ожидания отменяет запланированное удаление аккаунта
+	if err := data.SetAccountDeletionCancelledInDbTx(tx, permanentId); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
@@ -177,11 +248,15 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		return
 	} else {
 		isNewDevice := !slices.Contains(uniqueUserAgents, r.UserAgent())
-		if isNewDevice {
-			if err := tools.SendNewDeviceLoginEmail(user.Login, user.Email, r.UserAgent()); err != nil {
+		if isNewDevice && notificationEnabled(permanentId, data.NotificationNewDeviceLogin) {
+			email, err := data.GetEmailFromDb(permanentId)
+			if err != nil {
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
 			}
+			if err := tools.SendNewDeviceLoginEmail(userLocale(permanentId), login, email, r.UserAgent()); err != nil {
+				log.Printf("%+v", err)
+			}
 		}
 	}
 
@@ -190,5 +265,6 @@ func CheckInDbAndValidateSignInUserInput(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	applyUserLocale(w, permanentId)
 	http.Redirect(w, r, consts.HomeURL, http.StatusFound)
 }
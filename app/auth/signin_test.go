@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
 	"strings"
 	"testing"
 
@@ -16,6 +17,7 @@ import (
 	"github.com/gimaevra94/auth/app/captcha"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -37,6 +39,7 @@ func setupSignInTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldUpdateCaptchaState := captcha.UpdateCaptchaState
 	oldInputValidate := tools.InputValidate
 	oldGetPermanentIdFromDbByLogin := data.GetPermanentIdFromDbByLogin
+	oldGetPermanentIdFromDbByEmail := data.GetPermanentIdFromDbByEmail
 	oldIsOKPasswordHashInDb := data.IsOKPasswordHashInDb
 	oldSetTemporaryIdInCookies := data.SetTemporaryIdInCookies
 	oldSetTemporaryIdInDbTx := data.SetTemporaryIdInDbTx
@@ -45,8 +48,16 @@ func setupSignInTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldGetUniqueUserAgentsFromDb := data.GetUniqueUserAgentsFromDb
 	oldEndAuthAndCaptchaSessions := data.EndAuthAndCaptchaSessions
 	oldSendNewDeviceLoginEmail := tools.SendNewDeviceLoginEmail
+	oldSetAccountDeletionCancelledInDbTx := data.SetAccountDeletionCancelledInDbTx
+	oldGetAccountStatusFromDb := data.GetAccountStatusFromDb
+	oldGetUserRolesFromDb := data.GetUserRolesFromDb
 
 	data.Db = db
+	data.SetAccountDeletionCancelledInDbTx = func(tx *sql.Tx, permanentId string) error { return nil }
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusActive}, nil
+	}
+	data.GetUserRolesFromDb = func(permanentId string) ([]string, error) { return nil, nil }
 
 	return db, mock, func() {
 		data.Db = oldDB
@@ -57,6 +68,7 @@ func setupSignInTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 		captcha.UpdateCaptchaState = oldUpdateCaptchaState
 		tools.InputValidate = oldInputValidate
 		data.GetPermanentIdFromDbByLogin = oldGetPermanentIdFromDbByLogin
+		data.GetPermanentIdFromDbByEmail = oldGetPermanentIdFromDbByEmail
 		data.IsOKPasswordHashInDb = oldIsOKPasswordHashInDb
 		data.SetTemporaryIdInCookies = oldSetTemporaryIdInCookies
 		data.SetTemporaryIdInDbTx = oldSetTemporaryIdInDbTx
@@ -65,6 +77,9 @@ func setupSignInTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 		data.GetUniqueUserAgentsFromDb = oldGetUniqueUserAgentsFromDb
 		data.EndAuthAndCaptchaSessions = oldEndAuthAndCaptchaSessions
 		tools.SendNewDeviceLoginEmail = oldSendNewDeviceLoginEmail
+		data.SetAccountDeletionCancelledInDbTx = oldSetAccountDeletionCancelledInDbTx
+		data.GetAccountStatusFromDb = oldGetAccountStatusFromDb
+		data.GetUserRolesFromDb = oldGetUserRolesFromDb
 	}
 }
 
@@ -91,10 +106,10 @@ func TestCheckInDbAndValidateSignInUserInput_Success(t *testing.T) {
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
@@ -147,7 +162,7 @@ func TestCheckInDbAndValidateSignInUserInput_EmptyLogin(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signIn", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["loginInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "loginInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -190,7 +205,7 @@ func TestCheckInDbAndValidateSignInUserInput_EmptyPassword(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signIn", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["passwordInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "passwordInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 			assert.False(t, msgData.ShowForgotPassword)
 		} else {
@@ -237,7 +252,7 @@ func TestCheckInDbAndValidateSignInUserInput_UserNotFound(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signIn", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["userNotExist"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "userNotExist"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -258,6 +273,54 @@ func TestCheckInDbAndValidateSignInUserInput_UserNotFound(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestCheckInDbAndValidateSignInUserInput_YandexAccount проверяет вход по email аккаунта, созданного через Yandex.
+// Ожидается: HTTP 200, подсказка войти через Yandex и установить пароль.
+func TestCheckInDbAndValidateSignInUserInput_YandexAccount(t *testing.T) {
+	_, mock, teardown := setupSignInTest(t)
+	defer teardown()
+
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) {
+		return 3, false, nil
+	}
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool {
+		return false
+	}
+	captcha.UpdateCaptchaState = func(w http.ResponseWriter, r *http.Request, captchaCounter int64, showCaptcha bool) error {
+		return nil
+	}
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) {
+		t.Error("email should not be looked up as login")
+		return "", sql.ErrNoRows
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		assert.Equal(t, "user@yandex.ru", email)
+		if !yauth {
+			return "", sql.ErrNoRows
+		}
+		return "perm123", nil
+	}
+
+	var msg string
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signIn", templateName)
+		msg = data.(structs.MsgForUser).Msg
+		return nil
+	}
+
+	form := url.Values{}
+	form.Add("login", "user@yandex.ru")
+	form.Add("password", "ValidPassword123!")
+	req := httptest.NewRequest("POST", "/sign-in", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	CheckInDbAndValidateSignInUserInput(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, i18n.Text(i18n.En, "yauthPasswordNotSet"), msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestCheckInDbAndValidateSignInUserInput_InvalidPassword проверяет обработку неверного пароля.
 // Ожидается: HTTP 200, сообщение об ошибке пароля с опцией "забыли пароль".
 func TestCheckInDbAndValidateSignInUserInput_InvalidPassword(t *testing.T) {
@@ -286,7 +349,7 @@ func TestCheckInDbAndValidateSignInUserInput_InvalidPassword(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signIn", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["passwordInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "passwordInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 			assert.True(t, msgData.ShowForgotPassword)
 		} else {
@@ -308,6 +371,55 @@ func TestCheckInDbAndValidateSignInUserInput_InvalidPassword(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestCheckInDbAndValidateSignInUserInput_AccountDisabled проверяет вход в заблокированный аккаунт.
+// Ожидается: HTTP 200, сообщение о блокировке с причиной и сроком, сессия не создается.
+func TestCheckInDbAndValidateSignInUserInput_AccountDisabled(t *testing.T) {
+	_, mock, teardown := setupSignInTest(t)
+	defer teardown()
+
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) {
+		return 3, false, nil
+	}
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool {
+		return false
+	}
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) {
+		return "permanent-123", nil
+	}
+	data.IsOKPasswordHashInDb = func(permanentId, password string) error {
+		return nil
+	}
+	data.GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+		assert.Equal(t, "permanent-123", permanentId)
+		return structs.AccountStatus{PermanentId: permanentId, Status: data.AccountStatusBanned, Reason: "spam", ExpiresAt: 86400}, nil
+	}
+	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, exp int, rememberMe bool) {
+		t.Error("session should not be created")
+	}
+
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signIn", templateName)
+		if msgData, ok := data.(structs.MsgForUser); ok {
+			assert.Equal(t, i18n.Text(i18n.En, "accountBanned")+" Reason: spam. The restriction ends at 1970-01-02 00:00:00 UTC.", msgData.Msg)
+		} else {
+			t.Errorf("Expected structs.MsgForUser, got %T", data)
+		}
+		return nil
+	}
+
+	form := url.Values{}
+	form.Add("login", "testuser")
+	form.Add("password", "Password123!")
+	req := httptest.NewRequest("POST", "/sign-in", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	CheckInDbAndValidateSignInUserInput(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestCheckInDbAndValidateSignInUserInput_CaptchaRequired проверяет требование капчи.
 // Ожидается: HTTP 200, сообщение о необходимости капчи.
 func TestCheckInDbAndValidateSignInUserInput_CaptchaRequired(t *testing.T) {
@@ -330,7 +442,7 @@ func TestCheckInDbAndValidateSignInUserInput_CaptchaRequired(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signIn", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["captchaRequired"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "captchaRequired"), msgData.Msg)
 			assert.True(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -374,10 +486,10 @@ func TestCheckInDbAndValidateSignInUserInput_NewDeviceNotification(t *testing.T)
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
@@ -386,7 +498,9 @@ func TestCheckInDbAndValidateSignInUserInput_NewDeviceNotification(t *testing.T)
 	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) {
 		return []string{"old-user-agent"}, nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	var notifiedEmail string
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
+		notifiedEmail = email
 		return nil
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -395,6 +509,9 @@ func TestCheckInDbAndValidateSignInUserInput_NewDeviceNotification(t *testing.T)
 
 	mock.ExpectBegin()
 	mock.ExpectCommit()
+	mock.ExpectQuery(regexp.QuoteMeta(data.EmailSelectQuery)).
+		WithArgs("permanent-123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
 
 	form := url.Values{}
 	form.Add("login", "testuser")
@@ -408,6 +525,70 @@ func TestCheckInDbAndValidateSignInUserInput_NewDeviceNotification(t *testing.T)
 
 	assert.Equal(t, http.StatusFound, w.Code)
 	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.Equal(t, "user@example.com", notifiedEmail)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCheckInDbAndValidateSignInUserInput_ByEmail проверяет вход по email вместо логина.
+// Ожидается: пользователь найден по email для входа по паролю, HTTP 302, редирект на домашнюю страницу.
+func TestCheckInDbAndValidateSignInUserInput_ByEmail(t *testing.T) {
+	_, mock, teardown := setupSignInTest(t)
+	defer teardown()
+
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) {
+		return 3, false, nil
+	}
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool {
+		return false
+	}
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) {
+		t.Error("email should not be looked up as login")
+		return "", sql.ErrNoRows
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		assert.Equal(t, "user@example.com", email)
+		assert.False(t, yauth)
+		return "permanent-123", nil
+	}
+	var checkedId string
+	data.IsOKPasswordHashInDb = func(permanentId, password string) error {
+		checkedId = permanentId
+		return nil
+	}
+	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
+	}
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		return nil
+	}
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
+		return "refresh-token-123", nil
+	}
+	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
+		return nil
+	}
+	data.GetUniqueUserAgentsFromDb = func(permanentId string) ([]string, error) {
+		return []string{"test-agent"}, nil
+	}
+	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	form := url.Values{}
+	form.Add("login", "user@example.com")
+	form.Add("password", "ValidPassword123!")
+	req := httptest.NewRequest("POST", "/sign-in", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+
+	CheckInDbAndValidateSignInUserInput(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.Equal(t, "permanent-123", checkedId)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -496,10 +677,10 @@ func TestCheckInDbAndValidateSignInUserInput_WithRememberMe(t *testing.T) {
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
@@ -2,23 +2,32 @@
 //
 // Файл signup.go содержит следующие основные функции:
 // - CheckInDbAndValidateSignUpUserInput: проверка данных пользователя в БД и валидация
-// - ServerAuthCodeSend: отправка кода аутентификации на email
+// - ServerAuthCodeSend: отправка кода аутентификации на email или в SMS
 // - CodeValidate: валидация кода, введенного пользователем
 // - SetUserInDb: сохранение пользователя в базе данных
 //
 // Процесс регистрации включает проверку уникальности email, валидацию введенных данных,
+// проверку правил регистрации (см. signUpPolicy.go),
 // отправку кода подтверждения, валидацию кода и создание записи пользователя в БД.
+// Если пользователь выбрал получение кода в SMS, номер телефона подтверждается
+// этим кодом, затем email подтверждается кодом, отправленным на email,
+// и номер сохраняется вместе с аккаунтом.
 package auth
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gimaevra94/auth/app/captcha"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
 	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -34,9 +43,11 @@ import (
 // - Инициализирует состояние капчи
 // - Проверяет существование пользователя в БД по email
 // - Валидирует введенные данные (логин, email, пароль)
+// - Проверяет режим регистрации, домен email и код приглашения (checkSignUpPolicy)
+// - Проверяет номер телефона, если код выбрано получить в SMS (signUpPhone)
 // - Обрабатывает требования капчи при ошибках
 // - Сохраняет данные в сессию при успешной валидации
-// - Отправляет код аутентификации на email
+// - Отправляет код аутентификации на email или в SMS
 //
 // При ошибках возвращает пользователя на страницу регистрации с соответствующим сообщением.
 var CheckInDbAndValidateSignUpUserInput=func (w http.ResponseWriter, r *http.Request) {
@@ -65,15 +76,17 @@ var CheckInDbAndValidateSignUpUserInput=func (w http.ResponseWriter, r *http.Req
 			if err != nil {
 				if strings.Contains(err.Error(), "login") || strings.Contains(err.Error(), "email") || strings.Contains(err.Error(), "password") {
 					if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-						msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+						msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
 					} else {
-						msgForUser = structs.MsgForUser{Msg: consts.MsgForUser[errMsgKey].Msg, ShowCaptcha: showCaptcha, Regs: consts.MsgForUser[errMsgKey].Regs}
+						msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, errMsgKey), MsgKey: errMsgKey, ShowCaptcha: showCaptcha, Regs: i18n.Reqs(r, errMsgKey)}
 					}
 
 					if err := captcha.UpdateCaptchaState(w, r, captchaCounter-1, showCaptcha); err != nil {
 						errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 						return
 					}
+					msgForUser.CSRFToken = tmpls.CSRFToken(r)
+					msgForUser.InviteCode = r.FormValue("invite")
 					if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signUp", msgForUser); err != nil {
 						errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 						return
@@ -82,6 +95,31 @@ var CheckInDbAndValidateSignUpUserInput=func (w http.ResponseWriter, r *http.Req
 				return
 			}
 
+			msgKey, inviteCode, err := checkSignUpPolicy(user.Email, r.FormValue("invite"), time.Now().Unix())
+			if err != nil {
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+			if msgKey != "" {
+				renderSignUpPolicyMsg(w, r, msgKey, r.FormValue("invite"))
+				return
+			}
+			user.InviteCode = inviteCode
+
+			if r.FormValue("codeChannel") == consts.CodeChannelSMS {
+				phone, msgKey, err := signUpPhone(r.FormValue("phone"))
+				if err != nil {
+					errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+					return
+				}
+				if msgKey != "" {
+					renderSignUpPolicyMsg(w, r, msgKey, r.FormValue("invite"))
+					return
+				}
+				user.Phone = phone
+				user.CodeChannel = consts.CodeChannelSMS
+			}
+
 			if err := data.SetAuthDataInSession(w, r, user); err != nil {
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
@@ -94,39 +132,78 @@ var CheckInDbAndValidateSignUpUserInput=func (w http.ResponseWriter, r *http.Req
 	}
 
 	if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-		msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+		msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
 	} else {
-		msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["userAlreadyExist"].Msg, ShowCaptcha: showCaptcha}
+		msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "userAlreadyExist"), MsgKey: "userAlreadyExist", ShowCaptcha: showCaptcha}
 	}
 
 	if err := captcha.UpdateCaptchaState(w, r, captchaCounter-1, showCaptcha); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
+	msgForUser.CSRFToken = tmpls.CSRFToken(r)
+	msgForUser.InviteCode = r.FormValue("invite")
 	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signUp", msgForUser); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 }
 
-// ServerAuthCodeSend отправляет код аутентификации на email пользователя.
+// ServerAuthCodeSend отправляет код аутентификации на email или номер телефона пользователя.
 //
 // Функция:
 // - Получает данные пользователя из сессии
-// - Генерирует и отправляет код подтверждения на email
+// - При подтверждении входа учитывает способ доставки из параметра channel (secondFactorCodeChannel)
+// - Проверяет паузу между отправками и квоты для сессии и адреса получателя
+//   и в той же транзакции фиксирует отправку в БД (reserveServerAuthCodeSend)
+// - Генерирует и отправляет код подтверждения на email или в SMS (sendServerAuthCode)
 // - Увеличивает счетчик отправленных кодов
 // - Сохраняет обновленные данные в сессию
-// - Перенаправляет на страницу ввода кода
+// - Перенаправляет на страницу ввода кода, для SMS - с параметром channel=sms,
+//   при подтверждении входа - с сообщением о входе с нового устройства и другим
+//   доступным способом доставки (altChannel), после подтверждения номера
+//   при регистрации - с сообщением о коде на email
 //
-// При ошибках перенаправляет на страницу 500.
+// При превышении квоты отвечает статусом 429 и отображает сообщение
+// с оставшимся временем ожидания. При ошибках перенаправляет на страницу 500.
 func ServerAuthCodeSend(w http.ResponseWriter, r *http.Request) {
 	user, err := data.GetAuthDataFromSession(r)
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
+	if user.SecondFactor {
+		user.CodeChannel = secondFactorCodeChannel(user, r.URL.Query().Get("channel"))
+	}
+
+	now := time.Now().Unix()
+	msgKey, retryAfter, err := reserveServerAuthCodeSend(user, now)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if msgKey != "" {
+		tmplName := "serverAuthCodeSend"
+		if user.ServerCode == "" {
+			tmplName = "signUp"
+			if user.SecondFactor {
+				tmplName = "signIn"
+			}
+		}
+		msgForUser := structs.MsgForUser{Msg: i18n.Msg(r, msgKey), MsgKey: msgKey, RetryAfter: retryAfter, SMSEnabled: tools.SMSEnabled(), CodeChannel: user.CodeChannel, AltCodeChannel: altCodeChannel(user)}
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		msgForUser.CSRFToken = tmpls.CSRFToken(r)
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, tmplName, msgForUser); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
 
-	authServerCode, err := tools.ServerAuthCodeSend(user.Email)
+	authServerCode, err := sendServerAuthCode(i18n.Locale(r), user)
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
@@ -134,12 +211,33 @@ func ServerAuthCodeSend(w http.ResponseWriter, r *http.Request) {
 
 	user.ServerCode = authServerCode
 	user.ServerCodeSendedConter++
+	user.ServerCodeSendedAt = now
 	if err := data.SetAuthDataInSession(w, r, user); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
-	http.Redirect(w, r, consts.ServerAuthCodeSendURL, http.StatusFound)
+	query := url.Values{}
+	if user.CodeChannel == consts.CodeChannelSMS {
+		query.Set("channel", consts.CodeChannelSMS)
+	}
+	if user.SecondFactor {
+		if user.CodeChannel == consts.CodeChannelSMS {
+			query.Set("msg", "signInCodeSentSMS")
+		} else {
+			query.Set("msg", "signInCodeSent")
+		}
+		if altChannel := altCodeChannel(user); altChannel != "" {
+			query.Set("altChannel", altChannel)
+		}
+	} else if user.PhoneVerified {
+		query.Set("msg", "signUpPhoneConfirmed")
+	}
+	codeURL := consts.ServerAuthCodeSendURL
+	if len(query) > 0 {
+		codeURL += "?" + query.Encode()
+	}
+	http.Redirect(w, r, codeURL, http.StatusFound)
 }
 
 // CodeValidate проверяет код, введенный пользователем.
@@ -151,7 +249,11 @@ func ServerAuthCodeSend(w http.ResponseWriter, r *http.Request) {
 // - При успешной валидации создает запись пользователя в БД
 // - При ошибках обновляет счетчик капчи и возвращает сообщение
 //
-// При успешной валидации вызывает SetUserInDb для создания пользователя.
+// Для ошибочных кодов подтверждения входа действует лимит попыток (signInCodeAllowed,
+// recordSignInCodeFailure). При успешной валидации регистрации отмечает код
+// подтвержденным в сессии и вызывает SetUserInDb для создания пользователя,
+// после кода из SMS при регистрации - confirmSignUpPhone для проверки email,
+// а при подтверждении входа с нового устройства - completeSignInSecondFactor.
 func CodeValidate(w http.ResponseWriter, r *http.Request) {
 	user, err := data.GetAuthDataFromSession(r)
 	if err != nil {
@@ -182,13 +284,33 @@ func CodeValidate(w http.ResponseWriter, r *http.Request) {
 	var msgForUser structs.MsgForUser
 	captchaMsgErr := captcha.ShowCaptchaMsg(r, showCaptcha)
 
+	if user.SecondFactor && !signInCodeAllowed(w, r, user) {
+		return
+	}
+
 	if err := tools.CodeValidate(r, clientCode, user.ServerCode); err != nil {
+		if user.SecondFactor && !recordSignInCodeFailure(w, r, user) {
+			return
+		}
 		if captchaCounter == 0 && r.Method == "POST" && captchaMsgErr {
-			msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["captchaRequired"].Msg, ShowCaptcha: showCaptcha}
+			msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "captchaRequired"), MsgKey: "captchaRequired", ShowCaptcha: showCaptcha}
 		} else {
-			msgForUser = structs.MsgForUser{Msg: consts.MsgForUser["wrongCode"].Msg, ShowCaptcha: showCaptcha}
+			msgForUser = structs.MsgForUser{Msg: i18n.Msg(r, "wrongCode"), MsgKey: "wrongCode", ShowCaptcha: showCaptcha}
 		}
 	} else {
+		if user.SecondFactor {
+			completeSignInSecondFactor(w, r, user)
+			return
+		}
+		if user.CodeChannel == consts.CodeChannelSMS {
+			confirmSignUpPhone(w, r, user)
+			return
+		}
+		user.CodeVerified = true
+		if err := data.SetAuthDataInSession(w, r, user); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
 		SetUserInDb(w, r)
 		return
 	}
@@ -198,6 +320,9 @@ func CodeValidate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	msgForUser.CSRFToken = tmpls.CSRFToken(r)
+	msgForUser.CodeChannel = user.CodeChannel
+	msgForUser.AltCodeChannel = altCodeChannel(user)
 	if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "serverAuthCodeSend", msgForUser); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
@@ -206,12 +331,19 @@ func CodeValidate(w http.ResponseWriter, r *http.Request) {
 
 // SetUserInDb создает запись пользователя в базе данных.
 //
+// Сессия регистрации должна быть подтверждена кодом (CodeVerified); сессия подтверждения
+// входа (SecondFactor) и сессия без подтвержденного кода перенаправляются на страницу регистрации.
+//
 // Функция выполняет транзакцию в БД:
 // - Создает постоянный ID пользователя
 // - Сохраняет логин, email и хеш пароля
+// - Сохраняет номер телефона, если он подтвержден кодом из SMS; если номер
+//   тем временем подтвердил другой пользователь, регистрация не выполняется
+// - Отмечает использованным приглашение, если регистрация была по нему
 // - Создает временный ID для сессии
 // - Устанавливает refresh token
-// - Отправляет уведомление о входе с нового устройства
+// - Отмечает браузер доверенным устройством
+// - Ставит в очередь уведомление о входе с нового устройства (ошибка только логируется: аккаунт уже создан)
 // - Завершает сессии аутентификации и капчи
 //
 // Использует транзакцию для обеспечения целостности данных.
@@ -222,6 +354,10 @@ func SetUserInDb(w http.ResponseWriter, r *http.Request) {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
+	if user.SecondFactor || !user.CodeVerified {
+		http.Redirect(w, r, consts.SignUpURL, http.StatusFound)
+		return
+	}
 
 	tx, err := data.Db.Begin()
 	if err != nil {
@@ -239,6 +375,10 @@ func SetUserInDb(w http.ResponseWriter, r *http.Request) {
 	permanentId := uuid.New().String()
 	if err := data.SetLoginInDbTx(tx, permanentId, user.Login); err != nil {
 		tx.Rollback()
+		if errors.Is(err, data.ErrLoginAlreadyExist) {
+			renderSignUpPolicyMsg(w, r, "userAlreadyExist", "")
+			return
+		}
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -246,6 +386,10 @@ func SetUserInDb(w http.ResponseWriter, r *http.Request) {
 	yauth := false
 	if err := data.SetEmailInDbTx(tx, permanentId, user.Email, yauth); err != nil {
 		tx.Rollback()
+		if errors.Is(err, data.ErrEmailAlreadyExist) {
+			renderSignUpPolicyMsg(w, r, "userAlreadyExist", "")
+			return
+		}
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -256,18 +400,40 @@ func SetUserInDb(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.PhoneVerified {
+		if err := data.SetPhoneInDbTx(tx, permanentId, user.Phone); err != nil {
+			tx.Rollback()
+			if errors.Is(err, data.ErrPhoneAlreadyExist) {
+				renderSignUpPolicyMsg(w, r, "phoneAlreadyExist", "")
+				return
+			}
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
+	if err := useInviteTx(tx, user.InviteCode, permanentId); err != nil {
+		tx.Rollback()
+		if errors.Is(err, data.ErrInviteUnavailable) {
+			renderSignUpPolicyMsg(w, r, "inviteInvalid", "")
+			return
+		}
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
 	temporaryId := uuid.New().String()
 	rememberMe := r.FormValue("rememberMe") != ""
 	data.SetTemporaryIdInCookies(w, temporaryId, consts.Exp7Days, rememberMe)
 
 	userAgent := r.UserAgent()
-	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, yauth); err != nil {
+	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, yauth, rememberMe); err != nil {
 		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
-	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe)
+	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe, nil)
 	if err != nil {
 		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
@@ -285,9 +451,8 @@ func SetUserInDb(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = tools.SendNewDeviceLoginEmail(user.Login, user.Email, userAgent); err != nil {
-		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
-		return
+	if err = tools.SendNewDeviceLoginEmail(i18n.Locale(r), user.Login, user.Email, userAgent); err != nil {
+		log.Printf("%+v", err)
 	}
 
 	if err = data.EndAuthAndCaptchaSessions(w, r); err != nil {
@@ -13,11 +13,13 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gimaevra94/auth/app/captcha"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
@@ -60,8 +62,17 @@ func setupSignUpTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 	oldSetRefreshTokenInDbTx := data.SetRefreshTokenInDbTx
 	oldSendNewDeviceLoginEmail := tools.SendNewDeviceLoginEmail
 	oldEndAuthAndCaptchaSessions := data.EndAuthAndCaptchaSessions
+	oldReserveServerAuthCodeSendInDb := data.ReserveServerAuthCodeSendInDb
+	oldCheckSignUpPolicy := checkSignUpPolicy
+	oldServerAuthCodeSMSSend := tools.ServerAuthCodeSMSSend
+	oldGetPermanentIdFromDbByPhone := data.GetPermanentIdFromDbByPhone
+	oldSetPhoneInDbTx := data.SetPhoneInDbTx
 
 	data.Db = db
+	data.ReserveServerAuthCodeSendInDb = func(email string, now int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+		msgKey, wait := check(structs.ServerAuthCodeSendStats{})
+		return msgKey, wait, nil
+	}
 
 	return db, mock, func() {
 		data.Db = oldDB
@@ -87,6 +98,11 @@ func setupSignUpTest(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 		data.SetRefreshTokenInDbTx = oldSetRefreshTokenInDbTx
 		tools.SendNewDeviceLoginEmail = oldSendNewDeviceLoginEmail
 		data.EndAuthAndCaptchaSessions = oldEndAuthAndCaptchaSessions
+		data.ReserveServerAuthCodeSendInDb = oldReserveServerAuthCodeSendInDb
+		checkSignUpPolicy = oldCheckSignUpPolicy
+		tools.ServerAuthCodeSMSSend = oldServerAuthCodeSMSSend
+		data.GetPermanentIdFromDbByPhone = oldGetPermanentIdFromDbByPhone
+		data.SetPhoneInDbTx = oldSetPhoneInDbTx
 	}
 }
 
@@ -111,7 +127,7 @@ func TestCheckInDbAndValidateSignUpUserInput_Success(t *testing.T) {
 	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, consts any) error {
 		return nil
 	}
-	tools.ServerAuthCodeSend = func(email string) (string, error) {
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
 		return "123456", nil
 	}
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
@@ -133,6 +149,157 @@ func TestCheckInDbAndValidateSignUpUserInput_Success(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestCheckInDbAndValidateSignUpUserInput_SignUpPolicy проверяет регистрацию, запрещенную правилами.
+// Ожидается: страница регистрации с сообщением и полем кода приглашения, данные в сессию не сохраняются;
+// при разрешенной регистрации код приглашения сохраняется вместе с данными пользователя.
+func TestCheckInDbAndValidateSignUpUserInput_SignUpPolicy(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+	t.Setenv("SIGNUP_MODE", consts.SignUpModeInvite)
+
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) {
+		return 3, false, nil
+	}
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool {
+		return false
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, isOAuth bool) (string, error) {
+		return "", sql.ErrNoRows
+	}
+	tools.InputValidate = func(r *http.Request, login, email, password string, isSignIn bool) (string, error) {
+		return "", nil
+	}
+	checkSignUpPolicy = func(email, inviteCode string, now int64) (string, string, error) {
+		assert.Equal(t, "test@example.com", email)
+		if inviteCode == "code1" {
+			return "", "code1", nil
+		}
+		return "inviteInvalid", "", nil
+	}
+	var savedUser structs.User
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, user any) error {
+		savedUser = user.(structs.User)
+		return nil
+	}
+	var msgForUser structs.MsgForUser
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signUp", templateName)
+		msgForUser = data.(structs.MsgForUser)
+		return nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		return "123456", nil
+	}
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return savedUser, nil
+	}
+
+	form := url.Values{"login": {"testuser"}, "email": {"test@example.com"}, "password": {"ValidPassword123!"}, "invite": {"wrong"}}
+	req := httptest.NewRequest("POST", "/sign-up", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	CheckInDbAndValidateSignUpUserInput(w, req)
+
+	assert.Equal(t, i18n.Text(i18n.En, "inviteInvalid"), msgForUser.Msg)
+	assert.Equal(t, "wrong", msgForUser.InviteCode)
+	assert.True(t, msgForUser.InviteRequired)
+	assert.Empty(t, savedUser.Email)
+
+	form.Set("invite", "code1")
+	req = httptest.NewRequest("POST", "/sign-up", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	CheckInDbAndValidateSignUpUserInput(w, req)
+
+	assert.Equal(t, consts.ServerAuthCodeSendURL, w.Header().Get("Location"))
+	assert.Equal(t, "code1", savedUser.InviteCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCheckInDbAndValidateSignUpUserInput_SMS проверяет регистрацию с получением кода в SMS.
+// Ожидается: занятый номер - страница регистрации с сообщением; свободный номер сохраняется
+// в формате E.164, код отправляется в SMS, редирект на страницу кода с channel=sms.
+func TestCheckInDbAndValidateSignUpUserInput_SMS(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+	t.Setenv("SMS_DRIVER", "log")
+
+	captcha.InitCaptchaState = func(w http.ResponseWriter, r *http.Request) (int64, bool, error) {
+		return 3, false, nil
+	}
+	captcha.ShowCaptchaMsg = func(r *http.Request, showCaptcha bool) bool {
+		return false
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, isOAuth bool) (string, error) {
+		return "", sql.ErrNoRows
+	}
+	tools.InputValidate = func(r *http.Request, login, email, password string, isSignIn bool) (string, error) {
+		return "", nil
+	}
+	data.GetPermanentIdFromDbByPhone = func(phone string) (string, error) {
+		if phone == "+79997654321" {
+			return "perm456", nil
+		}
+		return "", sql.ErrNoRows
+	}
+	var savedUser structs.User
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, user any) error {
+		savedUser = user.(structs.User)
+		return nil
+	}
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return savedUser, nil
+	}
+	var msgForUser structs.MsgForUser
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signUp", templateName)
+		msgForUser = data.(structs.MsgForUser)
+		return nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code should not be sent to email")
+		return "", nil
+	}
+	var smsPhone string
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		smsPhone = phone
+		return "1234", nil
+	}
+	var recordedRecipient string
+	data.ReserveServerAuthCodeSendInDb = func(recipient string, now int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+		recordedRecipient = recipient
+		return "", 0, nil
+	}
+
+	form := url.Values{"login": {"testuser"}, "email": {"test@example.com"}, "password": {"ValidPassword123!"}, "codeChannel": {consts.CodeChannelSMS}, "phone": {"+7 999 765-43-21"}}
+	req := httptest.NewRequest("POST", "/sign-up", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	CheckInDbAndValidateSignUpUserInput(w, req)
+
+	assert.Equal(t, i18n.Text(i18n.En, "phoneAlreadyExist"), msgForUser.Msg)
+	assert.True(t, msgForUser.SMSEnabled)
+	assert.Empty(t, savedUser.Email)
+
+	form.Set("phone", "+7 999 123-45-67")
+	req = httptest.NewRequest("POST", "/sign-up", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w = httptest.NewRecorder()
+
+	CheckInDbAndValidateSignUpUserInput(w, req)
+
+	assert.Equal(t, consts.ServerAuthCodeSendURL+"?channel=sms", w.Header().Get("Location"))
+	assert.Equal(t, "+79991234567", savedUser.Phone)
+	assert.Equal(t, consts.CodeChannelSMS, savedUser.CodeChannel)
+	assert.Equal(t, "1234", savedUser.ServerCode)
+	assert.Equal(t, "+79991234567", smsPhone)
+	assert.Equal(t, "+79991234567", recordedRecipient)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestCheckInDbAndValidateSignUpUserInput_InvalidLogin проверяет обработку невалидного логина.
 // Ожидается: HTTP 200, сообщение об ошибке валидации логина.
 func TestCheckInDbAndValidateSignUpUserInput_InvalidLogin(t *testing.T) {
@@ -158,9 +325,9 @@ func TestCheckInDbAndValidateSignUpUserInput_InvalidLogin(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["loginInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "loginInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
-			assert.Equal(t, consts.MsgForUser["loginInvalid"].Regs, msgData.Regs)
+			assert.Equal(t, i18n.Requirements(i18n.En, "loginInvalid"), msgData.Regs)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -206,9 +373,9 @@ func TestCheckInDbAndValidateSignUpUserInput_InvalidEmail(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["emailInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "emailInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
-			assert.Equal(t, consts.MsgForUser["emailInvalid"].Regs, msgData.Regs)
+			assert.Equal(t, i18n.Requirements(i18n.En, "emailInvalid"), msgData.Regs)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -254,9 +421,9 @@ func TestCheckInDbAndValidateSignUpUserInput_InvalidPassword(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["passwordInvalid"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "passwordInvalid"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
-			assert.Equal(t, consts.MsgForUser["passwordInvalid"].Regs, msgData.Regs)
+			assert.Equal(t, i18n.Requirements(i18n.En, "passwordInvalid"), msgData.Regs)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
 		}
@@ -299,7 +466,7 @@ func TestCheckInDbAndValidateSignUpUserInput_UserAlreadyExists(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["userAlreadyExist"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "userAlreadyExist"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -346,7 +513,7 @@ func TestCheckInDbAndValidateSignUpUserInput_CaptchaRequired(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["captchaRequired"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "captchaRequired"), msgData.Msg)
 			assert.True(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -390,7 +557,7 @@ func TestCheckInDbAndValidateSignUpUserInput_CaptchaRequired_UserExists(t *testi
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "signUp", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["captchaRequired"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "captchaRequired"), msgData.Msg)
 			assert.True(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -483,7 +650,7 @@ func TestServerAuthCodeSend_Success(t *testing.T) {
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{Email: "test@example.com"}, nil
 	}
-	tools.ServerAuthCodeSend = func(email string) (string, error) {
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
 		return "123456", nil
 	}
 	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, consts any) error {
@@ -529,7 +696,7 @@ func TestServerAuthCodeSend_EmailError(t *testing.T) {
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{Email: "test@example.com"}, nil
 	}
-	tools.ServerAuthCodeSend = func(email string) (string, error) {
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
 		return "", errors.New("email send error")
 	}
 
@@ -543,14 +710,83 @@ func TestServerAuthCodeSend_EmailError(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestServerAuthCodeSend_Cooldown проверяет запрет повторной отправки до истечения паузы.
+// Ожидается: HTTP 429, заголовок Retry-After и сообщение с временем ожидания.
+func TestServerAuthCodeSend_Cooldown(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{Email: "test@example.com", ServerCode: "1234", ServerCodeSendedConter: 1, ServerCodeSendedAt: time.Now().Unix() - 10}, nil
+	}
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		t.Error("code must not be sent during cooldown")
+		return "", nil
+	}
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "serverAuthCodeSend", templateName)
+		msgData, ok := data.(structs.MsgForUser)
+		require.True(t, ok)
+		assert.Equal(t, i18n.Text(i18n.En, "serverCodeSendCooldown"), msgData.Msg)
+		assert.InDelta(t, 50, msgData.RetryAfter, 1)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", consts.ServerAuthCodeSendAgainURL, nil)
+	w := httptest.NewRecorder()
+
+	ServerAuthCodeSend(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestServerAuthCodeSend_EmailQuotaExceeded проверяет отказ при исчерпании квоты email на первой отправке.
+// Ожидается: HTTP 429 и страница регистрации с сообщением о квоте.
+func TestServerAuthCodeSend_EmailQuotaExceeded(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	now := time.Now().Unix()
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{Email: "test@example.com"}, nil
+	}
+	data.ReserveServerAuthCodeSendInDb = func(email string, n int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+		msgKey, wait := check(structs.ServerAuthCodeSendStats{LastHour: 5, LastDay: 5, LastSentAt: now - 600, FirstInLastHourAt: now - 3000, FirstInLastDayAt: now - 3000})
+		return msgKey, wait, nil
+	}
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signUp", templateName)
+		msgData, ok := data.(structs.MsgForUser)
+		require.True(t, ok)
+		assert.Equal(t, i18n.Text(i18n.En, "serverCodeSendQuotaExceeded"), msgData.Msg)
+		assert.InDelta(t, 600, msgData.RetryAfter, 1)
+		return nil
+	}
+
+	req := httptest.NewRequest("GET", consts.ServerAuthCodeSendAgainURL, nil)
+	w := httptest.NewRecorder()
+
+	ServerAuthCodeSend(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestCodeValidate_Success проверяет успешную валидацию кода.
-// Ожидается: HTTP 302, редирект на домашнюю страницу.
+// Ожидается: код отмечается подтвержденным в сессии, HTTP 302, редирект на домашнюю страницу.
 func TestCodeValidate_Success(t *testing.T) {
 	_, mock, teardown := setupSignUpTest(t)
 	defer teardown()
 
+	user := structs.User{ServerCode: "123456"}
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
-		return structs.User{ServerCode: "123456"}, nil
+		return user, nil
+	}
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, value any) error {
+		user = value.(structs.User)
+		return nil
 	}
 	data.GetCaptchaCounterFromSession = func(r *http.Request) (int64, error) {
 		return 3, nil
@@ -563,16 +799,16 @@ func TestCodeValidate_Success(t *testing.T) {
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
 		return nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
 		return nil
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -599,6 +835,54 @@ func TestCodeValidate_Success(t *testing.T) {
 
 	assert.Equal(t, http.StatusFound, w.Code)
 	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.True(t, user.CodeVerified)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestCodeValidate_SMSConfirmsPhone проверяет код из SMS при регистрации.
+// Ожидается: пользователь не создается, номер отмечается подтвержденным, код отправляется
+// на email регистрации с новыми паузой и счетчиком, редирект на страницу кода с сообщением.
+func TestCodeValidate_SMSConfirmsPhone(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	user := structs.User{Email: "test@example.com", Phone: "+79991234567", CodeChannel: consts.CodeChannelSMS, ServerCode: "1234", ServerCodeSendedConter: 3, ServerCodeSendedAt: time.Now().Unix()}
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) { return user, nil }
+	data.SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, value any) error {
+		user = value.(structs.User)
+		return nil
+	}
+	data.GetCaptchaCounterFromSession = func(r *http.Request) (int64, error) { return 3, nil }
+	data.GetShowCaptchaFromSession = func(r *http.Request) (bool, error) { return false, nil }
+	tools.CodeValidate = func(r *http.Request, clientCode, serverCode string) error { return nil }
+	tools.ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+		t.Error("code should not be sent by SMS again")
+		return "", nil
+	}
+	var emailCodeSentTo string
+	tools.ServerAuthCodeSend = func(locale, email string) (string, error) {
+		emailCodeSentTo = email
+		return "5678", nil
+	}
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+		t.Error("user should not be created before email is confirmed")
+		return nil
+	}
+
+	form := url.Values{"clientCode": {"1234"}}
+	req := httptest.NewRequest("POST", "/code-validate", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	CodeValidate(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.ServerAuthCodeSendURL+"?msg=signUpPhoneConfirmed", w.Header().Get("Location"))
+	assert.Equal(t, "test@example.com", emailCodeSentTo)
+	assert.True(t, user.PhoneVerified)
+	assert.Equal(t, consts.CodeChannelEmail, user.CodeChannel)
+	assert.Equal(t, "5678", user.ServerCode)
+	assert.Equal(t, 1, user.ServerCodeSendedConter)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -656,7 +940,7 @@ func TestCodeValidate_WrongCode(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "serverAuthCodeSend", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["wrongCode"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "wrongCode"), msgData.Msg)
 			assert.False(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -704,7 +988,7 @@ func TestCodeValidate_CaptchaRequired(t *testing.T) {
 	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 		assert.Equal(t, "serverAuthCodeSend", templateName)
 		if msgData, ok := data.(structs.MsgForUser); ok {
-			assert.Equal(t, consts.MsgForUser["captchaRequired"].Msg, msgData.Msg)
+			assert.Equal(t, i18n.Text(i18n.En, "captchaRequired"), msgData.Msg)
 			assert.True(t, msgData.ShowCaptcha)
 		} else {
 			t.Errorf("Expected structs.MsgForUser, got %T", data)
@@ -755,23 +1039,24 @@ func TestSetUserInDb_Success(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
 		return nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
 		return nil
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -800,6 +1085,64 @@ func TestSetUserInDb_Success(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+// TestSetUserInDb_WithPhone проверяет сохранение номера телефона, подтвержденного кодом из SMS.
+// Ожидается: номер сохраняется в той же транзакции, что и пользователь.
+func TestSetUserInDb_WithPhone(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{
+			Login:         "testuser",
+			Email:         "test@example.com",
+			Password:      "hashedpassword",
+			Phone:         "+79991234567",
+			PhoneVerified: true,
+			CodeChannel:   consts.CodeChannelEmail,
+			CodeVerified:  true,
+		}, nil
+	}
+	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
+	}
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
+		return nil
+	}
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
+		return "refresh-token-123", nil
+	}
+	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
+		return nil
+	}
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
+		return nil
+	}
+	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("update login set cancelled = true").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into login").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("update email set cancelled = true").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into email").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("update password_hash set cancelled = true").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("insert into password_hash").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("update phone set cancelled = true").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("insert into phone").WithArgs(sqlmock.AnyArg(), "+79991234567", false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest("POST", "/set-user", strings.NewReader(""))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", "test-user-agent")
+	w := httptest.NewRecorder()
+
+	SetUserInDb(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestSetUserInDb_WithRememberMe проверяет успешное сохранение пользователя с опцией "Запомнить меня".
 // Ожидается: HTTP 302, редирект на домашнюю страницу.
 func TestSetUserInDb_WithRememberMe(t *testing.T) {
@@ -808,23 +1151,24 @@ func TestSetUserInDb_WithRememberMe(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
 		return nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
 		return nil
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -884,9 +1228,10 @@ func TestSetUserInDb_TransactionError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 
@@ -912,9 +1257,10 @@ func TestSetUserInDb_LoginError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 
@@ -943,9 +1289,10 @@ func TestSetUserInDb_EmailError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 
@@ -976,9 +1323,10 @@ func TestSetUserInDb_PasswordError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 
@@ -1011,14 +1359,15 @@ func TestSetUserInDb_TemporaryIdError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return errors.New("temporary id error")
 	}
 
@@ -1052,17 +1401,18 @@ func TestSetUserInDb_RefreshTokenError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "", errors.New("refresh token error")
 	}
 
@@ -1096,17 +1446,18 @@ func TestSetUserInDb_RefreshTokenDbError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
@@ -1143,17 +1494,18 @@ func TestSetUserInDb_CommitError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
@@ -1183,30 +1535,31 @@ func TestSetUserInDb_CommitError(t *testing.T) {
 }
 
 // TestSetUserInDb_EmailNotificationError проверяет обработку ошибки при отправке email уведомления.
-// Ожидается: HTTP 302, редирект на 500.
+// Ожидается: аккаунт уже создан, поэтому ошибка только логируется - HTTP 302, редирект на главную.
 func TestSetUserInDb_EmailNotificationError(t *testing.T) {
 	_, mock, teardown := setupSignUpTest(t)
 	defer teardown()
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
 		return nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
 		return errors.New("email notification error")
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -1231,7 +1584,7 @@ func TestSetUserInDb_EmailNotificationError(t *testing.T) {
 	SetUserInDb(w, req)
 
 	assert.Equal(t, http.StatusFound, w.Code)
-	assert.Equal(t, consts.Err500URL, w.Header().Get("Location"))
+	assert.Equal(t, consts.HomeURL, w.Header().Get("Location"))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -1243,23 +1596,24 @@ func TestSetUserInDb_EndSessionError(t *testing.T) {
 
 	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 		return structs.User{
-			Login:    "testuser",
-			Email:    "test@example.com",
-			Password: "hashedpassword",
+			Login:        "testuser",
+			Email:        "test@example.com",
+			Password:     "hashedpassword",
+			CodeVerified: true,
 		}, nil
 	}
 	data.SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
 	}
-	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth bool) error {
+	data.SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, isOAuth, rememberMe bool) error {
 		return nil
 	}
-	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
+	tools.GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
 		return "refresh-token-123", nil
 	}
 	data.SetRefreshTokenInDbTx = func(tx *sql.Tx, permanentId, refreshToken, userAgent string, isOAuth bool) error {
 		return nil
 	}
-	tools.SendNewDeviceLoginEmail = func(login, email, userAgent string) error {
+	tools.SendNewDeviceLoginEmail = func(locale, login, email, userAgent string) error {
 		return nil
 	}
 	data.EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
@@ -1287,3 +1641,105 @@ func TestSetUserInDb_EndSessionError(t *testing.T) {
 	assert.Equal(t, consts.Err500URL, w.Header().Get("Location"))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+// TestSetUserInDb_InviteUnavailable проверяет регистрацию по приглашению, которое успели использовать.
+// Ожидается: транзакция откатывается, страница регистрации с сообщением о недействительном приглашении.
+func TestSetUserInDb_InviteUnavailable(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{Login: "testuser", Email: "test@example.com", Password: "hashedpassword", InviteCode: "code1", CodeVerified: true}, nil
+	}
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error { return nil }
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error { return nil }
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error { return nil }
+	var msgForUser structs.MsgForUser
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signUp", templateName)
+		msgForUser = data.(structs.MsgForUser)
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("update invite set usedBy").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("POST", "/set-user", nil)
+	w := httptest.NewRecorder()
+
+	SetUserInDb(w, req)
+
+	assert.Equal(t, i18n.Text(i18n.En, "inviteInvalid"), msgForUser.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetUserInDb_PhoneAlreadyExist проверяет регистрацию с номером, который тем временем подтвердил другой пользователь.
+// Ожидается: транзакция откатывается, страница регистрации с сообщением о занятом номере.
+func TestSetUserInDb_PhoneAlreadyExist(t *testing.T) {
+	_, mock, teardown := setupSignUpTest(t)
+	defer teardown()
+
+	data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
+		return structs.User{Login: "testuser", Email: "test@example.com", Password: "hashedpassword", Phone: "+79991234567", PhoneVerified: true, CodeVerified: true}, nil
+	}
+	data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error { return nil }
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error { return nil }
+	data.SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error { return nil }
+	data.SetPhoneInDbTx = func(tx *sql.Tx, permanentId, phone string) error {
+		return errors.WithStack(data.ErrPhoneAlreadyExist)
+	}
+	var msgForUser structs.MsgForUser
+	tmpls.TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+		assert.Equal(t, "signUp", templateName)
+		msgForUser = data.(structs.MsgForUser)
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	req := httptest.NewRequest("POST", "/set-user", nil)
+	w := httptest.NewRecorder()
+
+	SetUserInDb(w, req)
+
+	assert.Equal(t, i18n.Text(i18n.En, "phoneAlreadyExist"), msgForUser.Msg)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetUserInDb_CodeNotVerified проверяет прямой запрос создания пользователя без подтвержденного кода.
+// Ожидается: для сессии регистрации без подтверждения кода и для сессии подтверждения входа
+// (даже с подтвержденным кодом) пользователь не создается, редирект на страницу регистрации.
+func TestSetUserInDb_CodeNotVerified(t *testing.T) {
+	tests := []struct {
+		name string
+		user structs.User
+	}{
+		{name: "sign-up code not verified", user: structs.User{Login: "testuser", Email: "test@example.com", Password: "hashedpassword", ServerCode: "1234"}},
+		{name: "sign-in second factor", user: structs.User{Login: "testuser", Email: "victim@example.com", PermanentId: "permanent-123", SecondFactor: true, CodeVerified: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, mock, teardown := setupSignUpTest(t)
+			defer teardown()
+
+			data.GetAuthDataFromSession = func(r *http.Request) (structs.User, error) { return tt.user, nil }
+			data.SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
+				t.Error("user should not be created")
+				return nil
+			}
+
+			req := httptest.NewRequest("POST", "/set-user-in-db", nil)
+			w := httptest.NewRecorder()
+
+			SetUserInDb(w, req)
+
+			assert.Equal(t, http.StatusFound, w.Code)
+			assert.Equal(t, consts.SignUpURL, w.Header().Get("Location"))
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
@@ -3,6 +3,7 @@
 // Файл содержит HTTP-обработчики для аутентификации через Яндекс OAuth:
 //   - YandexAuthHandler: перенаправляет пользователя на страницу авторизации Яндекса
 //   - YandexCallbackHandler: обрабатывает callback от Яндекса после авторизации
+//   - createYandexAccount: создает аккаунт при первом входе через Яндекс
 //   - getAccessToken: получает access token по коду авторизации
 //   - getYandexUserInfo: получает информацию о пользователе из Яндекса
 package auth
@@ -11,15 +12,18 @@ import (
 	"database/sql"
 	"encoding/json"
 	"io"
+	"log"
 	"net/http"
 	"net/url"
 	"os"
 	"slices"
+	"time"
 
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
 	"github.com/gimaevra94/auth/app/errs"
 	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/gimaevra94/auth/app/tools"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -35,7 +39,15 @@ const (
 // YandexAuthHandler перенаправляет пользователя на страницу авторизации Яндекса.
 //
 // Формирует URL с параметрами OAuth и выполняет перенаправление.
+// Код приглашения из параметра invite сохраняется в сессии до возврата из Яндекса.
 func YandexAuthHandler(w http.ResponseWriter, r *http.Request) {
+	if inviteCode := r.URL.Query().Get("invite"); inviteCode != "" {
+		if err := data.SetInviteCodeInSession(w, r, inviteCode); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+	}
+
 	authParams := url.Values{
 		"response_type": {"code"},
 		"client_id":     {os.Getenv("clientId")},
@@ -51,6 +63,8 @@ func YandexAuthHandler(w http.ResponseWriter, r *http.Request) {
 // Получает код авторизации, обменивает его на access token, получает информацию
 // о пользователе, создаёт или обновляет запись в БД, устанавливает cookies
 // и перенаправляет на главную страницу.
+// Новый аккаунт создается, только если это разрешают правила регистрации
+// (режим, домен email и приглашение из сессии).
 func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	yauthCode := r.URL.Query().Get("code")
 	if yauthCode == "" {
@@ -76,11 +90,40 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	DbPermanentId, err := data.GetPermanentIdFromDbByEmail(yandexUser.Email, yauth)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			permanentId = uuid.New().String()
-			if err := data.SetEmailInDb(permanentId, yandexUser.Email, yauth); err != nil {
+			// Новый аккаунт создается по тем же правилам регистрации, что и по паролю
+			sessionInviteCode, err := data.GetInviteCodeFromSession(r)
+			if err != nil {
 				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 				return
 			}
+			msgKey, inviteCode, err := checkSignUpPolicy(yandexUser.Email, sessionInviteCode, time.Now().Unix())
+			if err != nil {
+				errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+				return
+			}
+			if msgKey != "" {
+				renderSignUpPolicyMsg(w, r, msgKey, sessionInviteCode)
+				return
+			}
+
+			permanentId = uuid.New().String()
+			createErr := createYandexAccount(permanentId, yandexUser.Email, inviteCode)
+			if createErr != nil && !errors.Is(createErr, data.ErrInviteUnavailable) {
+				errs.LogAndRedirectIfErrNotNill(w, r, createErr, consts.Err500URL)
+				return
+			}
+
+			// Приглашение использовано (этим или другим аккаунтом) и больше не нужно в сессии
+			if sessionInviteCode != "" {
+				if err := data.DeleteInviteCodeFromSession(w, r); err != nil {
+					errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+					return
+				}
+			}
+			if createErr != nil {
+				renderSignUpPolicyMsg(w, r, "inviteInvalid", "")
+				return
+			}
 		} else {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
@@ -89,6 +132,21 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		permanentId = DbPermanentId
 	}
 
+	// Заблокированный аккаунт не может войти через Yandex
+	status, restricted, err := accountStatus(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	if restricted {
+		msgForUser := structs.MsgForUser{Msg: accountStatusMsg(r, status), CSRFToken: tmpls.CSRFToken(r)}
+		if err := tmpls.TmplsRenderer(w, tmpls.BaseTmpl, "signIn", msgForUser); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
+
 	tx, err := data.Db.Begin()
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
@@ -107,12 +165,17 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 	data.SetTemporaryIdInCookies(w, temporaryId, consts.Exp7Days, rememberMe)
 
 	userAgent := r.UserAgent()
-	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, yauth); err != nil {
+	if err := data.SetTemporaryIdInDbTx(tx, permanentId, temporaryId, userAgent, yauth, rememberMe); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 
-	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe)
+	roles, err := data.GetUserRolesFromDb(permanentId)
+	if err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+	refreshToken, err := tools.GenerateRefreshToken(consts.Exp7Days, rememberMe, roles)
 	if err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
@@ -122,6 +185,12 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Вход в течение срока ожидания отменяет запланированное удаление аккаунта
+	if err := data.SetAccountDeletionCancelledInDbTx(tx, permanentId); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
@@ -133,11 +202,16 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
-	if !slices.Contains(uniqueUserAgents, r.UserAgent()) {
-		if err := tools.SendNewDeviceLoginEmail(yandexUser.Login, yandexUser.Email, r.UserAgent()); err != nil {
+	if !slices.Contains(uniqueUserAgents, r.UserAgent()) && notificationEnabled(permanentId, data.NotificationNewDeviceLogin) {
+		// Email от Yandex мог быть заменен в профиле, уведомление уходит на действующий адрес
+		email, err := data.GetEmailFromDb(permanentId)
+		if err != nil {
 			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 			return
 		}
+		if err := tools.SendNewDeviceLoginEmail(userLocale(permanentId), yandexUser.Login, email, r.UserAgent()); err != nil {
+			log.Printf("%+v", err)
+		}
 	}
 
 	if err = data.EndAuthAndCaptchaSessions(w, r); err != nil {
@@ -145,9 +219,44 @@ func YandexCallbackHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	applyUserLocale(w, permanentId)
 	http.Redirect(w, r, consts.HomeURL, http.StatusFound)
 }
 
+// createYandexAccount создает аккаунт с email из Яндекса.
+//
+// Приглашение inviteCode (если есть) отмечается использованным в той же транзакции,
+// поэтому один код не создаст два аккаунта.
+func createYandexAccount(permanentId, email, inviteCode string) error {
+	tx, err := data.Db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := useInviteTx(tx, inviteCode, permanentId); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	yauth := true
+	if err := data.SetEmailInDbTx(tx, permanentId, email, yauth); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
 // getAccessToken получает access token Яндекса по коду авторизации.
 //
 // Обменивает код авторизации на access token через API Яндекса.
@@ -20,6 +20,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tools"
 	"github.com/google/uuid"
@@ -33,11 +34,11 @@ type MockDependencies struct {
 	GetYandexUserInfo         func(string) (structs.User, error)
 	GetPermanentIdFromDb      func(string, bool) (string, error)
 	SetEmailInDb              func(string, string, bool) error
-	SetTemporaryIdInDbTx      func(*sql.Tx, string, string, string, bool) error
-	GenerateRefreshToken      func(int, bool) (string, error)
+	SetTemporaryIdInDbTx      func(*sql.Tx, string, string, string, bool, bool) error
+	GenerateRefreshToken      func(int, bool, []string) (string, error)
 	SetRefreshTokenInDbTx     func(*sql.Tx, string, string, string, bool) error
 	GetUniqueUserAgentsFromDb func(string) ([]string, error)
-	SendNewDeviceLoginEmail   func(string, string, string) error
+	SendNewDeviceLoginEmail   func(string, string, string, string) error
 	EndAuthAndCaptchaSessions func(http.ResponseWriter, *http.Request) error
 	BeginTransaction          func() (*sql.Tx, error)
 }
@@ -129,25 +130,25 @@ func YandexCallbackHandlerWithDeps(w http.ResponseWriter, r *http.Request, deps
 	data.SetTemporaryIdInCookies(w, temporaryId, consts.Exp7Days, rememberMe)
 
 	userAgent := r.UserAgent()
-	var setTemporaryIdFunc func(*sql.Tx, string, string, string, bool) error
+	var setTemporaryIdFunc func(*sql.Tx, string, string, string, bool, bool) error
 	if deps != nil && deps.SetTemporaryIdInDbTx != nil {
 		setTemporaryIdFunc = deps.SetTemporaryIdInDbTx
 	} else {
 		setTemporaryIdFunc = data.SetTemporaryIdInDbTx
 	}
-	if err := setTemporaryIdFunc(tx, permanentId, temporaryId, userAgent, yauth); err != nil {
+	if err := setTemporaryIdFunc(tx, permanentId, temporaryId, userAgent, yauth, rememberMe); err != nil {
 		http.Redirect(w, r, consts.Err500URL, http.StatusFound)
 		return
 	}
 
 	var refreshToken string
-	var generateTokenFunc func(int, bool) (string, error)
+	var generateTokenFunc func(int, bool, []string) (string, error)
 	if deps != nil && deps.GenerateRefreshToken != nil {
 		generateTokenFunc = deps.GenerateRefreshToken
 	} else {
 		generateTokenFunc = tools.GenerateRefreshToken
 	}
-	refreshToken, err = generateTokenFunc(consts.Exp7Days, rememberMe)
+	refreshToken, err = generateTokenFunc(consts.Exp7Days, rememberMe, nil)
 	if err != nil {
 		http.Redirect(w, r, consts.Err500URL, http.StatusFound)
 		return
@@ -183,13 +184,13 @@ func YandexCallbackHandlerWithDeps(w http.ResponseWriter, r *http.Request, deps
 	}
 
 	if !contains(uniqueUserAgents, r.UserAgent()) {
-		var sendEmailFunc func(string, string, string) error
+		var sendEmailFunc func(string, string, string, string) error
 		if deps != nil && deps.SendNewDeviceLoginEmail != nil {
 			sendEmailFunc = deps.SendNewDeviceLoginEmail
 		} else {
 			sendEmailFunc = tools.SendNewDeviceLoginEmail
 		}
-		if err := sendEmailFunc(yandexUser.Login, yandexUser.Email, r.UserAgent()); err != nil {
+		if err := sendEmailFunc(i18n.Locale(r), yandexUser.Login, yandexUser.Email, r.UserAgent()); err != nil {
 			http.Redirect(w, r, consts.Err500URL, http.StatusFound)
 			return
 		}
@@ -511,6 +512,8 @@ func TestGetYandexUserInfoWithMockServer(t *testing.T) {
 // TestYandexCallbackHandlerWithDeps проверяет обработчик OAuth callback с мок зависимостями.
 // Тестирует полные сценарии авторизации включая регистрацию новых пользователей.
 func TestYandexCallbackHandlerWithDeps(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	tests := []struct {
 		name              string
 		queryParams       string
@@ -570,10 +573,10 @@ func TestYandexCallbackHandlerWithDeps(t *testing.T) {
 					tx, err := db.Begin()
 					return tx, err
 				},
-				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 					return nil
 				},
-				GenerateRefreshToken: func(exp int, rememberMe bool) (string, error) {
+				GenerateRefreshToken: func(exp int, rememberMe bool, roles []string) (string, error) {
 					if !rememberMe {
 						t.Errorf("expected rememberMe=true, got false")
 					}
@@ -585,7 +588,7 @@ func TestYandexCallbackHandlerWithDeps(t *testing.T) {
 				GetUniqueUserAgentsFromDb: func(permanentId string) ([]string, error) {
 					return []string{}, nil
 				},
-				SendNewDeviceLoginEmail: func(login, email, userAgent string) error {
+				SendNewDeviceLoginEmail: func(locale, login, email, userAgent string) error {
 					return nil
 				},
 				EndAuthAndCaptchaSessions: func(w http.ResponseWriter, r *http.Request) error {
@@ -621,10 +624,10 @@ func TestYandexCallbackHandlerWithDeps(t *testing.T) {
 					tx, err := db.Begin()
 					return tx, err
 				},
-				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 					return nil
 				},
-				GenerateRefreshToken: func(exp int, rememberMe bool) (string, error) {
+				GenerateRefreshToken: func(exp int, rememberMe bool, roles []string) (string, error) {
 					if rememberMe {
 						t.Errorf("expected rememberMe=false, got true")
 					}
@@ -636,7 +639,7 @@ func TestYandexCallbackHandlerWithDeps(t *testing.T) {
 				GetUniqueUserAgentsFromDb: func(permanentId string) ([]string, error) {
 					return []string{"test-agent"}, nil
 				},
-				SendNewDeviceLoginEmail: func(login, email, userAgent string) error {
+				SendNewDeviceLoginEmail: func(locale, login, email, userAgent string) error {
 					t.Errorf("email should not be sent for existing device")
 					return nil
 				},
@@ -673,7 +676,7 @@ func TestYandexCallbackHandlerWithDeps(t *testing.T) {
 					tx, err := db.Begin()
 					return tx, err
 				},
-				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 					return errors.New("transaction error")
 				},
 			},
@@ -794,13 +797,13 @@ func TestYandexCallbackHandlerEdgeCases(t *testing.T) {
 					tx, err := db.Begin()
 					return tx, err
 				},
-				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 					if len(userAgent) != 1000 {
 						t.Errorf("expected long user agent")
 					}
 					return nil
 				},
-				GenerateRefreshToken: func(exp int, rememberMe bool) (string, error) {
+				GenerateRefreshToken: func(exp int, rememberMe bool, roles []string) (string, error) {
 					return "refresh-token", nil
 				},
 				SetRefreshTokenInDbTx: func(tx *sql.Tx, permanentId, refreshToken, userAgent string, yauth bool) error {
@@ -809,7 +812,7 @@ func TestYandexCallbackHandlerEdgeCases(t *testing.T) {
 				GetUniqueUserAgentsFromDb: func(permanentId string) ([]string, error) {
 					return []string{}, nil
 				},
-				SendNewDeviceLoginEmail: func(login, email, userAgent string) error {
+				SendNewDeviceLoginEmail: func(locale, login, email, userAgent string) error {
 					return nil
 				},
 				EndAuthAndCaptchaSessions: func(w http.ResponseWriter, r *http.Request) error {
@@ -844,11 +847,11 @@ func TestYandexCallbackHandlerEdgeCases(t *testing.T) {
 					tx, err := db.Begin()
 					return tx, err
 				},
-				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+				SetTemporaryIdInDbTx: func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 					time.Sleep(5 * time.Millisecond) // Simulate DB delay
 					return nil
 				},
-				GenerateRefreshToken: func(exp int, rememberMe bool) (string, error) {
+				GenerateRefreshToken: func(exp int, rememberMe bool, roles []string) (string, error) {
 					return "refresh-token", nil
 				},
 				SetRefreshTokenInDbTx: func(tx *sql.Tx, permanentId, refreshToken, userAgent string, yauth bool) error {
@@ -857,7 +860,7 @@ func TestYandexCallbackHandlerEdgeCases(t *testing.T) {
 				GetUniqueUserAgentsFromDb: func(permanentId string) ([]string, error) {
 					return []string{}, nil
 				},
-				SendNewDeviceLoginEmail: func(login, email, userAgent string) error {
+				SendNewDeviceLoginEmail: func(locale, login, email, userAgent string) error {
 					return nil
 				},
 				EndAuthAndCaptchaSessions: func(w http.ResponseWriter, r *http.Request) error {
@@ -902,3 +905,75 @@ func TestYandexCallbackHandlerEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// TestYandexAuthHandler_Invite проверяет переход к Yandex OAuth по ссылке из приглашения.
+// Ожидается: код приглашения сохраняется в сессии до возврата из Яндекса.
+func TestYandexAuthHandler_Invite(t *testing.T) {
+	oldSetInviteCodeInSession := data.SetInviteCodeInSession
+	defer func() { data.SetInviteCodeInSession = oldSetInviteCodeInSession }()
+
+	var savedCode string
+	data.SetInviteCodeInSession = func(w http.ResponseWriter, r *http.Request, code string) error {
+		savedCode = code
+		return nil
+	}
+
+	w := httptest.NewRecorder()
+	YandexAuthHandler(w, httptest.NewRequest("GET", "/yauth?invite=code1", nil))
+
+	if savedCode != "code1" {
+		t.Errorf("expected invite code1 in session, got %q", savedCode)
+	}
+	if !strings.HasPrefix(w.Header().Get("Location"), authURL) {
+		t.Errorf("expected redirect to %s, got %s", authURL, w.Header().Get("Location"))
+	}
+}
+
+// TestCreateYandexAccount проверяет создание аккаунта при первом входе через Яндекс.
+// Ожидается: приглашение и email сохраняются в одной транзакции,
+// уже использованное приглашение откатывает транзакцию с ErrInviteUnavailable.
+func TestCreateYandexAccount(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	oldDB := data.Db
+	oldSetEmailInDbTx := data.SetEmailInDbTx
+	defer func() {
+		data.Db = oldDB
+		data.SetEmailInDbTx = oldSetEmailInDbTx
+	}()
+	data.Db = db
+	var createdEmail string
+	data.SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) error {
+		if yauth {
+			createdEmail = email
+		}
+		return nil
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.InviteUseUpdateQuery).WithArgs("perm123", sqlmock.AnyArg(), "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := createYandexAccount("perm123", "ya@example.com", "code1"); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if createdEmail != "ya@example.com" {
+		t.Errorf("expected yauth email ya@example.com, got %q", createdEmail)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.InviteUseUpdateQuery).WithArgs("perm456", sqlmock.AnyArg(), "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	if err := createYandexAccount("perm456", "other@example.com", "code1"); !errors.Is(err, data.ErrInviteUnavailable) {
+		t.Errorf("expected ErrInviteUnavailable, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
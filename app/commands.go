@@ -0,0 +1,509 @@
+// Package main предоставляет точку входа для веб-приложения аутентификации.
+//
+// Файл содержит служебные команды командной строки:
+//   - runCommand: выбирает команду по первому аргументу
+//   - runKeysCommand: управляет связкой ключей подписи (list, add, import, promote, retire)
+//   - runAccountCommand: выгружает и удаляет аккаунты по запросам в поддержку (export, delete, purge)
+//   - runRoleCommand: управляет ролями и их назначением (list, create, members, grant, revoke)
+//   - runInviteCommand: управляет приглашениями на регистрацию (list, create, revoke)
+//   - runTemplatesCommand: проверяет и выгружает шаблоны страниц и писем (check, export)
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/auth"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const accountUsage = "usage: account export <login|email> | account delete <login|email> | account purge"
+
+const roleUsage = "usage: role list | role create <role> <permission,...> [description] | role members <role> | role grant <login|email> <role> | role revoke <login|email> <role>"
+
+const inviteUsage = "usage: invite list | invite create <email|any> [days] | invite revoke <code>"
+
+const templatesUsage = "usage: templates check [dir] | templates export <dir>"
+
+// inviteAnyEmail в команде invite create означает приглашение для любого адреса.
+const inviteAnyEmail = "any"
+
+// adminCLILogin записывается в журнал admin_action вместо логина администратора для команд role и invite.
+const adminCLILogin = "cli"
+
+// accountDbConn подключается к базе данных для команд account, role и invite, подменяется в тестах.
+var accountDbConn = data.DbConn
+
+const keysUsage = "usage: keys list | keys add <jwt|loginStore|captchaStore|cookie> | keys import jwt <RS256|EdDSA> <pem-file> | keys promote <set> <kid> | keys retire <set> <kid>"
+
+// runCommand выполняет служебную команду вместо запуска сервера.
+//
+// Поддерживаемые команды:
+//   - keys: управление связкой ключей подписи
+//   - account: выгрузка и удаление аккаунтов
+//   - role: управление ролями и правами доступа
+//   - invite: управление приглашениями на регистрацию
+//   - templates: проверка и выгрузка шаблонов
+func runCommand(args []string, out io.Writer) error {
+	switch args[0] {
+	case "keys":
+		return runKeysCommand(args[1:], out)
+	case "account":
+		return runAccountCommand(args[1:], out)
+	case "role":
+		return runRoleCommand(args[1:], out)
+	case "invite":
+		return runInviteCommand(args[1:], out)
+	case "templates":
+		return runTemplatesCommand(args[1:], out)
+	}
+	return errors.Errorf("unknown command: %s", args[0])
+}
+
+// runKeysCommand управляет связкой ключей в файле KEYRING_FILE.
+//
+// Подкоманды:
+//   - list: выводит kid, статус и дату создания ключей без секретов
+//   - add <set>: добавляет новый ключ (основным, если в наборе нет основного, иначе активным)
+//   - import jwt <alg> <pem-file>: добавляет асимметричный ключ JWT из PEM файла
+//   - promote <set> <kid>: делает ключ основным, прежний основной становится активным
+//   - retire <set> <kid>: выводит ключ из использования
+//
+// Ротация: add, затем перезапуск всех экземпляров, затем promote и снова перезапуск,
+// после истечения старых токенов и cookie - retire.
+func runKeysCommand(args []string, out io.Writer) error {
+	path := os.Getenv("KEYRING_FILE")
+	if path == "" {
+		return errors.New("KEYRING_FILE environment variable is not set")
+	}
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	keyringData, err := keyring.LoadFile(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		printKeySet(out, keyring.SetJWT, keyringData.JWT)
+		printKeySet(out, keyring.SetLoginStore, keyringData.LoginStore)
+		printKeySet(out, keyring.SetCaptchaStore, keyringData.CaptchaStore)
+		printKeySet(out, keyring.SetCookie, keyringData.Cookie)
+		return nil
+
+	case args[0] == "add" && len(args) == 2:
+		key, err := keyring.AddKey(&keyringData, args[1], time.Now().Unix())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := keyring.Save(path, keyringData); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "added %s key %s (%s)\n", args[1], key.Kid, key.Status)
+		return nil
+
+	case args[0] == "import" && len(args) == 4 && args[1] == keyring.SetJWT:
+		key, err := keyring.ImportKey(&keyringData, args[2], args[3], time.Now().Unix())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := keyring.Save(path, keyringData); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "imported %s key %s %s (%s)\n", args[1], key.Alg, key.Kid, key.Status)
+		return nil
+
+	case args[0] == "promote" && len(args) == 3:
+		if err := keyring.PromoteKey(&keyringData, args[1], args[2]); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := keyring.Save(path, keyringData); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "promoted %s key %s\n", args[1], args[2])
+		return nil
+
+	case args[0] == "retire" && len(args) == 3:
+		if err := keyring.RetireKey(&keyringData, args[1], args[2]); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := keyring.Save(path, keyringData); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "retired %s key %s\n", args[1], args[2])
+		return nil
+	}
+
+	return errors.New(keysUsage)
+}
+
+// printKeySet выводит ключи набора без секретов.
+func printKeySet(out io.Writer, set string, keys []structs.SigningKey) {
+	for _, key := range keys {
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\n", set, key.Kid, key.Status, time.Unix(key.CreatedAt, 0).UTC().Format(time.RFC3339))
+	}
+}
+
+// runAccountCommand выполняет запросы пользователей, поступившие в поддержку.
+//
+// Подкоманды:
+//   - export <login|email>: выводит JSON со всеми данными пользователя, как на странице профиля
+//   - delete <login|email>: планирует удаление аккаунта с тем же сроком ожидания и завершает все сессии
+//   - purge: безвозвратно удаляет аккаунты с истекшим сроком ожидания
+//
+// Личность пользователя проверяется поддержкой до выполнения команды.
+func runAccountCommand(args []string, out io.Writer) error {
+	validArgs := len(args) == 1 && args[0] == "purge" ||
+		len(args) == 2 && (args[0] == "export" || args[0] == "delete")
+	if !validArgs {
+		return errors.New(accountUsage)
+	}
+
+	if err := accountDbConn(); err != nil {
+		return errors.WithStack(err)
+	}
+	now := time.Now().Unix()
+
+	if args[0] == "purge" {
+		deleted, err := data.DeleteDueAccountsFromDb(now)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "deleted %d accounts\n", deleted)
+		return nil
+	}
+
+	permanentId, err := findAccount(args[1])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if args[0] == "export" {
+		export, err := data.GetAccountExportFromDb(permanentId, now)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(export); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
+	deleteAfter, err := auth.ScheduleAccountDeletion(permanentId, now)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(out, "account %s scheduled for deletion after %s\n", permanentId, time.Unix(deleteAfter, 0).UTC().Format(time.RFC3339))
+	return nil
+}
+
+// findAccount находит permanentId по логину или email.
+//
+// Значение с "@" ищется среди email, включая вход через Yandex, иначе среди логинов.
+func findAccount(loginOrEmail string) (string, error) {
+	if !strings.Contains(loginOrEmail, "@") {
+		permanentId, err := data.GetPermanentIdFromDbByLogin(loginOrEmail)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", errors.Errorf("account not found: %s", loginOrEmail)
+		}
+		return permanentId, err
+	}
+
+	for _, yauth := range []bool{false, true} {
+		permanentId, err := data.GetPermanentIdFromDbByEmail(loginOrEmail, yauth)
+		if err == nil {
+			return permanentId, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return "", errors.WithStack(err)
+		}
+	}
+	return "", errors.Errorf("account not found: %s", loginOrEmail)
+}
+
+// runRoleCommand управляет ролями и их назначением пользователям.
+//
+// Подкоманды:
+//   - list: выводит роли, их права и описания
+//   - create <role> <permission,...> [description]: создает роль или заменяет права и описание существующей
+//   - members <role>: выводит permanentId, логин и email пользователей с ролью
+//   - grant <login|email> <role>: назначает пользователю роль
+//   - revoke <login|email> <role>: снимает с пользователя роль
+//
+// Назначение и снятие ролей фиксируются в журнале admin_action с логином cli.
+func runRoleCommand(args []string, out io.Writer) error {
+	validArgs := len(args) == 1 && args[0] == "list" ||
+		len(args) == 2 && args[0] == "members" ||
+		len(args) >= 3 && args[0] == "create" ||
+		len(args) == 3 && (args[0] == "grant" || args[0] == "revoke")
+	if !validArgs {
+		return errors.New(roleUsage)
+	}
+
+	if err := accountDbConn(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch args[0] {
+	case "list":
+		roles, err := data.GetRolesFromDb()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, role := range roles {
+			fmt.Fprintf(out, "%s\t%s\t%s\n", role.Name, strings.Join(role.Permissions, ","), role.Description)
+		}
+		return nil
+
+	case "create":
+		role := structs.Role{Name: args[1], Permissions: strings.Split(args[2], ","), Description: strings.Join(args[3:], " ")}
+		if err := runInTx(func(tx *sql.Tx) error { return data.SetRoleInDbTx(tx, role) }); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "saved role %s\n", role.Name)
+		return nil
+
+	case "members":
+		permanentIds, err := data.GetRoleMembersFromDb(args[1])
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, permanentId := range permanentIds {
+			login, err := data.GetLoginFromDb(permanentId)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return errors.WithStack(err)
+			}
+			email, err := data.GetEmailFromDb(permanentId)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return errors.WithStack(err)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\n", permanentId, login, email)
+		}
+		return nil
+	}
+
+	permanentId, err := findAccount(args[1])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	role := args[2]
+	exists, err := data.IsRoleInDb(role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !exists {
+		return errors.Errorf("role not found: %s", role)
+	}
+
+	roles, err := data.GetUserRolesFromDb(permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	grant := args[0] == "grant"
+	if grant && slices.Contains(roles, role) {
+		fmt.Fprintf(out, "account %s already has role %s\n", permanentId, role)
+		return nil
+	}
+	if !grant && !slices.Contains(roles, role) {
+		fmt.Fprintf(out, "account %s does not have role %s\n", permanentId, role)
+		return nil
+	}
+
+	now := time.Now().Unix()
+	action, result := data.AdminActionRoleRevoke, "revoked"
+	if grant {
+		action, result = data.AdminActionRoleGrant, "granted"
+	}
+	adminAction := structs.AdminAction{AdminLogin: adminCLILogin, TargetPermanentId: permanentId, Action: action, Detail: role, CreatedAt: now}
+	if err := runInTx(func(tx *sql.Tx) error {
+		if grant {
+			if err := data.SetUserRoleInDbTx(tx, permanentId, role, now); err != nil {
+				return err
+			}
+		} else {
+			if err := data.SetUserRoleCancelledInDbTx(tx, permanentId, role); err != nil {
+				return err
+			}
+		}
+		return data.SetAdminActionInDbTx(tx, adminAction)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(out, "%s role %s for account %s\n", result, role, permanentId)
+	return nil
+}
+
+// runInviteCommand управляет приглашениями на регистрацию в режиме SIGNUP_MODE=invite.
+//
+// Подкоманды:
+//   - list: выводит код, email, дату создания, срок действия и состояние последних приглашений
+//   - create <email|any> [days]: создает приглашение для email или любого адреса, бессрочное или на days дней
+//   - revoke <code>: отзывает неиспользованное приглашение
+//
+// Создание и отзыв фиксируются в журнале admin_action с логином cli.
+func runInviteCommand(args []string, out io.Writer) error {
+	validArgs := len(args) == 1 && args[0] == "list" ||
+		(len(args) == 2 || len(args) == 3) && args[0] == "create" ||
+		len(args) == 2 && args[0] == "revoke"
+	if !validArgs {
+		return errors.New(inviteUsage)
+	}
+
+	now := time.Now().Unix()
+	var invite structs.Invite
+	if args[0] == "create" {
+		invite = structs.Invite{Code: uuid.New().String(), CreatedAt: now}
+		if args[1] != inviteAnyEmail {
+			if err := tools.EmailValidate(args[1]); err != nil {
+				return errors.WithStack(err)
+			}
+			invite.Email = args[1]
+		}
+		if len(args) == 3 {
+			days, err := strconv.Atoi(args[2])
+			if err != nil || days <= 0 {
+				return errors.New(inviteUsage)
+			}
+			invite.ExpiresAt = now + int64(days)*24*60*60
+		}
+	}
+
+	if err := accountDbConn(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch args[0] {
+	case "list":
+		invites, err := data.GetInvitesFromDb()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, invite := range invites {
+			state := "active"
+			if invite.UsedAt != 0 {
+				state = "used by " + invite.UsedBy
+			} else if invite.Cancelled {
+				state = "revoked"
+			} else if invite.ExpiresAt != 0 && invite.ExpiresAt <= now {
+				state = "expired"
+			}
+			expiresAt := "-"
+			if invite.ExpiresAt != 0 {
+				expiresAt = time.Unix(invite.ExpiresAt, 0).UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%s\n", invite.Code, invite.Email, time.Unix(invite.CreatedAt, 0).UTC().Format(time.RFC3339), expiresAt, state)
+		}
+		return nil
+
+	case "create":
+		adminAction := structs.AdminAction{AdminLogin: adminCLILogin, Action: data.AdminActionInviteCreate, Detail: invite.Code, CreatedAt: now}
+		if err := runInTx(func(tx *sql.Tx) error {
+			if err := data.SetInviteInDbTx(tx, invite); err != nil {
+				return err
+			}
+			return data.SetAdminActionInDbTx(tx, adminAction)
+		}); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "created invite %s\n%s?invite=%s\n", invite.Code, tmpls.PublicURL("/sign-up"), invite.Code)
+		return nil
+	}
+
+	existing, err := data.GetInviteFromDb(args[1])
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.Errorf("invite not found: %s", args[1])
+		}
+		return errors.WithStack(err)
+	}
+	if existing.UsedAt != 0 || existing.Cancelled {
+		fmt.Fprintf(out, "invite %s is already used or revoked\n", args[1])
+		return nil
+	}
+
+	adminAction := structs.AdminAction{AdminLogin: adminCLILogin, Action: data.AdminActionInviteRevoke, Detail: args[1], CreatedAt: now}
+	if err := runInTx(func(tx *sql.Tx) error {
+		if err := data.SetInviteCancelledInDbTx(tx, args[1]); err != nil {
+			return err
+		}
+		return data.SetAdminActionInDbTx(tx, adminAction)
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(out, "revoked invite %s\n", args[1])
+	return nil
+}
+
+// runTemplatesCommand проверяет и выгружает шаблоны страниц и писем.
+//
+// Подкоманды:
+//   - check [dir]: проверяет шаблоны из каталога dir (по умолчанию TEMPLATES_DIR) так же, как при запуске сервера
+//   - export <dir>: записывает встроенные шаблоны в каталог, существующие файлы не заменяются
+func runTemplatesCommand(args []string, out io.Writer) error {
+	switch {
+	case (len(args) == 1 || len(args) == 2) && args[0] == "check":
+		dir := os.Getenv("TEMPLATES_DIR")
+		if len(args) == 2 {
+			dir = args[1]
+		}
+		if err := tmpls.CheckTmpls(dir); err != nil {
+			return errors.WithStack(err)
+		}
+		if dir == "" {
+			dir = "embedded"
+		}
+		fmt.Fprintf(out, "templates ok: %s\n", dir)
+		return nil
+
+	case len(args) == 2 && args[0] == "export":
+		if err := tmpls.ExportTmpls(args[1]); err != nil {
+			return errors.WithStack(err)
+		}
+		fmt.Fprintf(out, "exported templates to %s\n", args[1])
+		return nil
+	}
+	return errors.New(templatesUsage)
+}
+
+// runInTx выполняет apply в транзакции и фиксирует ее, при ошибке выполняет откат.
+func runInTx(apply func(tx *sql.Tx) error) error {
+	tx, err := data.Db.Begin()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			tx.Rollback()
+			panic(err)
+		}
+	}()
+
+	if err := apply(tx); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,345 @@
+// Package main предоставляет точку входа для веб-приложения аутентификации.
+//
+// Файл тестирует служебные команды командной строки.
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/auth"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRunKeysCommand проверяет добавление, назначение, вывод и просмотр ключей.
+// Ожидается: изменения сохраняются в файл связки, list не выводит секреты.
+func TestRunKeysCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"keys", "add", "jwt"}, &out))
+	require.NoError(t, runCommand([]string{"keys", "add", "jwt"}, &out))
+
+	keyringData, err := keyring.LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, keyringData.JWT, 2)
+	oldKid, newKid := keyringData.JWT[0].Kid, keyringData.JWT[1].Kid
+
+	require.NoError(t, runCommand([]string{"keys", "promote", "jwt", newKid}, &out))
+	require.NoError(t, runCommand([]string{"keys", "retire", "jwt", oldKid}, &out))
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"keys", "list"}, &out))
+	assert.Contains(t, out.String(), "jwt\t"+newKid+"\tprimary")
+	assert.Contains(t, out.String(), "jwt\t"+oldKid+"\tretired")
+	assert.False(t, strings.Contains(out.String(), keyringData.JWT[0].Secret))
+
+	assert.Error(t, runCommand([]string{"keys", "retire", "jwt", newKid}, &out))
+	assert.Error(t, runCommand([]string{"keys", "add"}, &out))
+	assert.Error(t, runCommand([]string{"unknown"}, &out))
+}
+
+// TestRunKeysCommand_NoKeyringFile проверяет запуск без KEYRING_FILE.
+// Ожидается: ошибка.
+func TestRunKeysCommand_NoKeyringFile(t *testing.T) {
+	t.Setenv("KEYRING_FILE", "")
+	assert.Error(t, runCommand([]string{"keys", "list"}, &bytes.Buffer{}))
+}
+
+// TestRunKeysCommand_Import проверяет импорт асимметричного ключа JWT из PEM файла.
+// Ожидается: ключ сохраняется в связке с алгоритмом и путем к файлу, неверный набор или алгоритм отклоняются.
+func TestRunKeysCommand_Import(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	pemPath := filepath.Join(t.TempDir(), "ed25519.pem")
+	require.NoError(t, os.WriteFile(pemPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"keys", "import", "jwt", "EdDSA", pemPath}, &out))
+	assert.Contains(t, out.String(), "imported jwt key EdDSA")
+
+	keyringData, err := keyring.LoadFile(path)
+	require.NoError(t, err)
+	require.Len(t, keyringData.JWT, 1)
+	assert.Equal(t, "EdDSA", keyringData.JWT[0].Alg)
+	assert.Equal(t, pemPath, keyringData.JWT[0].PrivateKeyFile)
+	assert.Equal(t, keyring.StatusPrimary, keyringData.JWT[0].Status)
+	assert.Empty(t, keyringData.JWT[0].Secret)
+
+	assert.Error(t, runCommand([]string{"keys", "import", "loginStore", "EdDSA", pemPath}, &out))
+	assert.Error(t, runCommand([]string{"keys", "import", "jwt", "RS256", pemPath}, &out))
+}
+
+// TestRunAccountCommand проверяет выгрузку, удаление и очистку аккаунтов из командной строки.
+// Ожидается: аккаунт находится по логину и email, export выводит JSON, delete и purge вызывают общую логику.
+func TestRunAccountCommand(t *testing.T) {
+	oldAccountDbConn := accountDbConn
+	oldGetPermanentIdFromDbByLogin := data.GetPermanentIdFromDbByLogin
+	oldGetPermanentIdFromDbByEmail := data.GetPermanentIdFromDbByEmail
+	oldGetAccountExportFromDb := data.GetAccountExportFromDb
+	oldDeleteDueAccountsFromDb := data.DeleteDueAccountsFromDb
+	oldScheduleAccountDeletion := auth.ScheduleAccountDeletion
+	defer func() {
+		accountDbConn = oldAccountDbConn
+		data.GetPermanentIdFromDbByLogin = oldGetPermanentIdFromDbByLogin
+		data.GetPermanentIdFromDbByEmail = oldGetPermanentIdFromDbByEmail
+		data.GetAccountExportFromDb = oldGetAccountExportFromDb
+		data.DeleteDueAccountsFromDb = oldDeleteDueAccountsFromDb
+		auth.ScheduleAccountDeletion = oldScheduleAccountDeletion
+	}()
+
+	accountDbConn = func() error { return nil }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) {
+		if login == "user123" {
+			return "perm123", nil
+		}
+		return "", sql.ErrNoRows
+	}
+	data.GetPermanentIdFromDbByEmail = func(email string, yauth bool) (string, error) {
+		if email == "ya@example.com" && yauth {
+			return "perm456", nil
+		}
+		return "", sql.ErrNoRows
+	}
+	data.GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+		return structs.AccountExport{PermanentId: permanentId, Logins: []structs.ExportedLogin{{Login: "user123"}}}, nil
+	}
+	var scheduled []string
+	auth.ScheduleAccountDeletion = func(permanentId string, now int64) (int64, error) {
+		scheduled = append(scheduled, permanentId)
+		return 0, nil
+	}
+	data.DeleteDueAccountsFromDb = func(now int64) (int, error) { return 2, nil }
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"account", "export", "user123"}, &out))
+	var export structs.AccountExport
+	require.NoError(t, json.Unmarshal(out.Bytes(), &export))
+	assert.Equal(t, "perm123", export.PermanentId)
+	assert.Equal(t, "user123", export.Logins[0].Login)
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"account", "delete", "ya@example.com"}, &out))
+	assert.Equal(t, []string{"perm456"}, scheduled)
+	assert.Contains(t, out.String(), "account perm456 scheduled for deletion after")
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"account", "purge"}, &out))
+	assert.Equal(t, "deleted 2 accounts\n", out.String())
+
+	assert.Error(t, runCommand([]string{"account", "export", "missing@example.com"}, &out))
+	assert.Error(t, runCommand([]string{"account", "delete", "missing"}, &out))
+	assert.Error(t, runCommand([]string{"account", "export"}, &out))
+	assert.Error(t, runCommand([]string{"account", "purge", "user123"}, &out))
+}
+
+// TestRunRoleCommand проверяет создание ролей, их назначение и снятие из командной строки.
+// Ожидается: изменения выполняются в транзакции с записью в журнал от имени cli,
+// повторное назначение ничего не меняет, неизвестная роль отклоняется.
+func TestRunRoleCommand(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	oldDB := data.Db
+	oldAccountDbConn := accountDbConn
+	oldGetPermanentIdFromDbByLogin := data.GetPermanentIdFromDbByLogin
+	oldGetRolesFromDb := data.GetRolesFromDb
+	oldIsRoleInDb := data.IsRoleInDb
+	oldGetUserRolesFromDb := data.GetUserRolesFromDb
+	oldGetRoleMembersFromDb := data.GetRoleMembersFromDb
+	oldGetLoginFromDb := data.GetLoginFromDb
+	defer func() {
+		data.Db = oldDB
+		db.Close()
+		accountDbConn = oldAccountDbConn
+		data.GetPermanentIdFromDbByLogin = oldGetPermanentIdFromDbByLogin
+		data.GetRolesFromDb = oldGetRolesFromDb
+		data.IsRoleInDb = oldIsRoleInDb
+		data.GetUserRolesFromDb = oldGetUserRolesFromDb
+		data.GetRoleMembersFromDb = oldGetRoleMembersFromDb
+		data.GetLoginFromDb = oldGetLoginFromDb
+	}()
+
+	data.Db = db
+	accountDbConn = func() error { return nil }
+	data.GetPermanentIdFromDbByLogin = func(login string) (string, error) { return "perm123", nil }
+	data.GetRolesFromDb = func() ([]structs.Role, error) {
+		return []structs.Role{{Name: "admin", Description: "Administrators", Permissions: []string{"admin.users", "roles.manage"}}}, nil
+	}
+	data.IsRoleInDb = func(name string) (bool, error) { return name != "missing", nil }
+	var userRoles []string
+	data.GetUserRolesFromDb = func(permanentId string) ([]string, error) { return userRoles, nil }
+	data.GetRoleMembersFromDb = func(role string) ([]string, error) { return []string{"perm123"}, nil }
+	data.GetLoginFromDb = func(permanentId string) (string, error) { return "user123", nil }
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"role", "list"}, &out))
+	assert.Equal(t, "admin\tadmin.users,roles.manage\tAdministrators\n", out.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.RoleDeleteQuery).WithArgs("support").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(data.RoleInsertQuery).WithArgs("support", "Support team").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(data.RolePermissionDeleteQuery).WithArgs("support").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(data.RolePermissionInsertQuery).WithArgs("support", "admin.users").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(data.RolePermissionInsertQuery).WithArgs("support", "reports.view").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	out.Reset()
+	require.NoError(t, runCommand([]string{"role", "create", "support", "admin.users,reports.view", "Support", "team"}, &out))
+	assert.Equal(t, "saved role support\n", out.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.UserRoleUpdateQuery).WithArgs("perm123", "admin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(data.UserRoleInsertQuery).WithArgs("perm123", "admin", sqlmock.AnyArg(), false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(data.AdminActionInsertQuery).WithArgs("", adminCLILogin, "perm123", data.AdminActionRoleGrant, "admin", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	out.Reset()
+	require.NoError(t, runCommand([]string{"role", "grant", "user123", "admin"}, &out))
+	assert.Equal(t, "granted role admin for account perm123\n", out.String())
+
+	userRoles = []string{"admin"}
+	out.Reset()
+	require.NoError(t, runCommand([]string{"role", "grant", "user123", "admin"}, &out))
+	assert.Equal(t, "account perm123 already has role admin\n", out.String())
+
+	mock.ExpectQuery(data.EmailSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("user@example.com"))
+	out.Reset()
+	require.NoError(t, runCommand([]string{"role", "members", "admin"}, &out))
+	assert.Equal(t, "perm123\tuser123\tuser@example.com\n", out.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.UserRoleUpdateQuery).WithArgs("perm123", "admin").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(data.AdminActionInsertQuery).WithArgs("", adminCLILogin, "perm123", data.AdminActionRoleRevoke, "admin", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	out.Reset()
+	require.NoError(t, runCommand([]string{"role", "revoke", "user123", "admin"}, &out))
+	assert.Equal(t, "revoked role admin for account perm123\n", out.String())
+
+	assert.Error(t, runCommand([]string{"role", "grant", "user123", "missing"}, &out))
+	assert.Error(t, runCommand([]string{"role", "grant", "user123"}, &out))
+	assert.Error(t, runCommand([]string{"role", "list", "admin"}, &out))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRunInviteCommand проверяет создание, вывод и отзыв приглашений из командной строки.
+// Ожидается: приглашение создается и отзывается в транзакции с записью в журнал от имени cli,
+// некорректный email, срок и неизвестный код отклоняются.
+func TestRunInviteCommand(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	oldDB := data.Db
+	oldAccountDbConn := accountDbConn
+	oldGetInvitesFromDb := data.GetInvitesFromDb
+	oldGetInviteFromDb := data.GetInviteFromDb
+	defer func() {
+		data.Db = oldDB
+		db.Close()
+		accountDbConn = oldAccountDbConn
+		data.GetInvitesFromDb = oldGetInvitesFromDb
+		data.GetInviteFromDb = oldGetInviteFromDb
+	}()
+
+	data.Db = db
+	accountDbConn = func() error { return nil }
+	data.GetInvitesFromDb = func() ([]structs.Invite, error) {
+		return []structs.Invite{
+			{Code: "code1", Email: "user@example.com", CreatedAt: 0},
+			{Code: "code2", CreatedAt: 0, UsedBy: "perm123", UsedAt: 10},
+			{Code: "code3", CreatedAt: 0, ExpiresAt: 10},
+		}, nil
+	}
+	data.GetInviteFromDb = func(code string) (structs.Invite, error) {
+		switch code {
+		case "code1":
+			return structs.Invite{Code: code}, nil
+		case "code2":
+			return structs.Invite{Code: code, UsedAt: 10}, nil
+		}
+		return structs.Invite{}, sql.ErrNoRows
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"invite", "list"}, &out))
+	assert.Equal(t, "code1\tuser@example.com\t1970-01-01T00:00:00Z\t-\tactive\n"+
+		"code2\t\t1970-01-01T00:00:00Z\t-\tused by perm123\n"+
+		"code3\t\t1970-01-01T00:00:00Z\t1970-01-01T00:00:10Z\texpired\n", out.String())
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.InviteInsertQuery).WithArgs(sqlmock.AnyArg(), "user@example.com", "", sqlmock.AnyArg(), sqlmock.AnyArg(), "", 0, false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(data.AdminActionInsertQuery).WithArgs("", adminCLILogin, "", data.AdminActionInviteCreate, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	out.Reset()
+	require.NoError(t, runCommand([]string{"invite", "create", "user@example.com", "7"}, &out))
+	assert.Contains(t, out.String(), "http://localhost:8080/sign-up?invite=")
+
+	mock.ExpectBegin()
+	mock.ExpectExec(data.InviteCancelUpdateQuery).WithArgs("code1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(data.AdminActionInsertQuery).WithArgs("", adminCLILogin, "", data.AdminActionInviteRevoke, "code1", sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	out.Reset()
+	require.NoError(t, runCommand([]string{"invite", "revoke", "code1"}, &out))
+	assert.Equal(t, "revoked invite code1\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"invite", "revoke", "code2"}, &out))
+	assert.Equal(t, "invite code2 is already used or revoked\n", out.String())
+
+	assert.Error(t, runCommand([]string{"invite", "revoke", "missing"}, &out))
+	assert.Error(t, runCommand([]string{"invite", "create", "not-an-email"}, &out))
+	assert.Error(t, runCommand([]string{"invite", "create", inviteAnyEmail, "0"}, &out))
+	assert.Error(t, runCommand([]string{"invite", "create"}, &out))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestRunTemplatesCommand проверяет выгрузку и проверку шаблонов.
+// Ожидается: выгруженные шаблоны проходят проверку, шаблон с ошибкой - нет.
+func TestRunTemplatesCommand(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "templates")
+	t.Setenv("TEMPLATES_DIR", "")
+
+	var out bytes.Buffer
+	require.NoError(t, runCommand([]string{"templates", "export", dir}, &out))
+	assert.Equal(t, "exported templates to "+dir+"\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"templates", "check", dir}, &out))
+	assert.Equal(t, "templates ok: "+dir+"\n", out.String())
+
+	out.Reset()
+	require.NoError(t, runCommand([]string{"templates", "check"}, &out))
+	assert.Equal(t, "templates ok: embedded\n", out.String())
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "signIn.html"), []byte(`{{define "signIn"}}{{.Unknown}}{{end}}`), 0o644))
+	t.Setenv("TEMPLATES_DIR", dir)
+	assert.Error(t, runCommand([]string{"templates", "check"}, &out))
+
+	assert.Error(t, runCommand([]string{"templates", "export", dir}, &out))
+	assert.Error(t, runCommand([]string{"templates", "export"}, &out))
+	assert.Error(t, runCommand([]string{"templates"}, &out))
+}
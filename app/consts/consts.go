@@ -1,59 +1,55 @@
 package consts
 
-import "github.com/gimaevra94/auth/app/structs"
-
 const (
 	SignUpURL                  = "/sign-up"
 	ServerAuthCodeSendURL      = "/server-auth-code-send"
 	ServerAuthCodeSendAgainURL = "/server-auth-code-send-again"
 	SignInURL                  = "/sign-in"
 	HomeURL                    = "/home"
+	ProfileURL                 = "/profile"
+	ProfileNotificationsURL    = "/profile/notifications"
+	UnsubscribeURL             = "/unsubscribe"
+	AdminURL                   = "/admin"
+	AdminUserURL               = "/admin/user"
+	AdminInvitesURL            = "/admin/invites"
 	Err500URL                  = "/500"
 )
 
+const Exp7Days = 7 * 24 * 60 * 60
+
+// Режимы регистрации (переменная окружения SIGNUP_MODE)
 const (
-	invalidLogin                   = "Login is invalid"
-	invalidEmail                   = "Email is invalid"
-	invalidPassword                = "Password is invalid"
-	userAlreadyExist               = "User already exists"
-	userNotExist                   = "User does not exist"
-	captchaRequiredMsg             = "Pass the verification reCAPTCHA."
-	wrongCodeMsg                   = "Wrong code"
-	failedMailSendingStatusMsg     = "Failed to send password reset link"
-	successfulMailSendingStatusMsg = "Password reset link has been sent"
-	serverCodeHasBeenSend          = "Auth code has been sent. You can send it again in 1 minute."
+	SignUpModeOpen   = "open"
+	SignUpModeClosed = "closed"
+	SignUpModeInvite = "invite"
 )
 
-const Exp7Days = 7 * 24 * 60 * 60
+// Способы доставки кодов подтверждения
+const (
+	CodeChannelEmail = "email"
+	CodeChannelSMS   = "sms"
+)
 
-var (
-	loginReqs = []string{
-		"3-30 characters long",
-		"Latin or Cyrillic letters",
-		"Numbers 0-9",
-	}
-	emailReqs = []string{
-		"Must contain Latin letters, numbers and allowed special characters: . _ % + -",
-		"Must contain exactly one '@' symbol",
-		"Domain must be valId and end with .com, .org, etc.",
-	}
-	PswrdReqs = []string{
-		"8-30 characters long",
-		"Latin letters only",
-		"Numbers 0-9",
-		"Special symbols: !@#$%^&*",
-	}
+// Политики подтверждения входа кодом (переменная окружения SIGNIN_SECOND_FACTOR)
+const (
+	SignInSecondFactorOff       = "off"
+	SignInSecondFactorNewDevice = "new-device"
 )
 
-var MsgForUser = map[string]structs.MsgForUser{
-	"loginInvalid":                {Msg: invalidLogin, Regs: loginReqs},
-	"emailInvalid":                {Msg: invalidEmail, Regs: emailReqs},
-	"captchaRequired":             {Msg: captchaRequiredMsg, Regs: nil},
-	"passwordInvalid":             {Msg: invalidPassword, Regs: PswrdReqs},
-	"userAlreadyExist":            {Msg: userAlreadyExist, Regs: nil},
-	"userNotExist":                {Msg: userNotExist, Regs: nil},
-	"wrongCode":                   {Msg: wrongCodeMsg, Regs: nil},
-	"failedMailSendingStatus":     {Msg: failedMailSendingStatusMsg, Regs: nil},
-	"successfulMailSendingStatus": {Msg: successfulMailSendingStatusMsg, Regs: nil},
-	"serverCodeHasBeenSend":       {Msg: serverCodeHasBeenSend, Regs: nil},
-}
+type ctxKey string
+
+const (
+	CSRFTokenCtxKey    ctxKey = "csrfToken"
+	CSRFTokenHeader           = "X-CSRF-Token"
+	CSRFTokenFormField        = "csrfToken"
+	AccessCtxKey       ctxKey = "access"
+	LocaleCtxKey       ctxKey = "locale"
+)
+
+// Права доступа, которые проверяет само приложение; остальные права задаются ролями для внешних сервисов
+const (
+	PermissionAdminUsers       = "admin.users"
+	PermissionRolesManage      = "roles.manage"
+	PermissionInvitesManage    = "invites.manage"
+	PermissionTemplatesPreview = "templates.preview"
+)
@@ -0,0 +1,377 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для выгрузки и удаления аккаунта:
+//   - GetAccountExportFromDb: собирает все данные пользователя по permanentId
+//   - SetAccountDeletionTokenInDb: сохраняет токен ссылки подтверждения удаления
+//   - SetAccountDeletionTokenUsedInDbTx: отмечает токен подтверждения удаления использованным
+//   - SetAccountDeletionInDbTx: планирует удаление аккаунта
+//   - SetAccountDeletionCancelledInDbTx: отменяет запланированное удаление
+//   - GetDueAccountDeletionsFromDb: получает аккаунты с истекшим сроком ожидания
+//   - DeleteAccountFromDbTx: безвозвратно удаляет строки пользователя из всех таблиц
+//   - DeleteDueAccountsFromDb: удаляет все аккаунты с истекшим сроком ожидания
+//
+// Токены сброса пароля (reset_token) связаны с пользователем через email, на который отправлена
+// ссылка, как отправки кодов; значения токенов не выгружаются.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для выгрузки данных аккаунта
+const (
+	AccountLoginsSelectQuery          = "select login, cancelled from login where permanentId = ?"
+	AccountEmailsSelectQuery          = "select email, yauth, cancelled from email where permanentId = ?"
+	AccountPhonesSelectQuery          = "select phone, cancelled from phone where permanentId = ?"
+	AccountPasswordCountSelectQuery   = "select count(*) from password_hash where permanentId = ?"
+	AccountSessionsSelectQuery        = "select userAgent, yauth, rememberMe, createdAt, lastActivityAt, cancelled from temporary_id where permanentId = ?"
+	AccountRefreshTokensSelectQuery   = "select userAgent, yauth, cancelled from refresh_token where permanentId = ?"
+	AccountProfileChangesSelectQuery  = "select field, oldValue, newValue, changedAt, cancelled from profile_change where permanentId = ?"
+	AccountCodeSendsSelectQuery       = "select email, sentAt from server_auth_code_send where email in (select email from email where permanentId = ?)"
+	AccountResetTokensSelectQuery     = "select email, cancelled from reset_token where email in (select email from email where permanentId = ?)"
+	AccountPhoneCodeSendsSelectQuery  = "select email, sentAt from server_auth_code_send where email in (select phone from phone where permanentId = ?)"
+	AccountDeletionsSelectQuery       = "select requestedAt, deleteAfter, cancelled from account_deletion where permanentId = ?"
+	AccountStatusesSelectQuery        = "select status, reason, createdAt, expiresAt, cancelled from account_status where permanentId = ?"
+	AccountDeletionUpdateQuery        = "update account_deletion set cancelled = true where permanentId = ? and cancelled = false"
+	AccountDeletionInsertQuery        = "insert into account_deletion (permanentId, requestedAt, deleteAfter, cancelled) values (?, ?, ?, ?)"
+	DueAccountDeletionsSelectQuery    = "select distinct permanentId from account_deletion where deleteAfter <= ? and cancelled = false"
+	DueAccountDeletionLockSelectQuery = "select permanentId from account_deletion where permanentId = ? and deleteAfter <= ? and cancelled = false for update"
+	AccountDeletionTokenInsertQuery   = "insert into account_deletion_token (token, permanentId, cancelled) values (?, ?, ?)"
+	AccountDeletionTokenUseQuery      = "update account_deletion_token set cancelled = true where token = ? and cancelled = false"
+)
+
+// ErrAccountDeletionTokenUsed возвращается, если токен подтверждения удаления уже использован или не выдавался.
+var ErrAccountDeletionTokenUsed = errors.New("account deletion token is used or unknown")
+
+// accountDeleteQueries удаляют строки пользователя из всех таблиц.
+//
+// Отправки кодов, токены сброса пароля и письма из очереди удаляются первыми, пока по таблицам
+// email и phone можно найти адреса и номера пользователя.
+// Журнал admin_action не удаляется: это журнал действий администраторов.
+var accountDeleteQueries = []string{
+	"delete from server_auth_code_send where email in (select email from email where permanentId = ?)",
+	"delete from server_auth_code_send where email in (select phone from phone where permanentId = ?)",
+	"delete from reset_token where email in (select email from email where permanentId = ?)",
+	"delete from mail_outbox where recipient in (select email from email where permanentId = ?)",
+	"delete from login where permanentId = ?",
+	"delete from email where permanentId = ?",
+	"delete from phone where permanentId = ?",
+	"delete from password_hash where permanentId = ?",
+	"delete from temporary_id where permanentId = ?",
+	"delete from refresh_token where permanentId = ?",
+	"delete from profile_change where permanentId = ?",
+	"delete from account_deletion where permanentId = ?",
+	"delete from account_deletion_token where permanentId = ?",
+	"delete from account_status where permanentId = ?",
+	"delete from user_role where permanentId = ?",
+	"delete from user_locale where permanentId = ?",
+	"delete from notification_setting where permanentId = ?",
+	"delete from security_digest where permanentId = ?",
+	"delete from security_alert_token where permanentId = ?",
+	"delete from failed_attempt where permanentId = ?",
+	"delete from trusted_device where permanentId = ?",
+	"delete from invite where usedBy = ?",
+}
+
+// scanAccountRows выполняет запрос по permanentId и передает каждую строку в scan.
+func scanAccountRows(query, permanentId string, scan func(rows *sql.Rows) error) error {
+	rows, err := Db.Query(query, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetAccountExportFromDb собирает все данные, хранимые для permanentId.
+//
+// Выгружает логины, email и номера телефонов (включая прежние), сессии с user agent, refresh токены,
+// журнал изменений профиля, отправки кодов на адреса и номера пользователя, ссылки сброса пароля,
+// запросы удаления, блокировки аккаунта и назначения ролей.
+// Хеши паролей и значения токенов не выгружаются, для паролей указывается только их количество.
+var GetAccountExportFromDb = func(permanentId string, exportedAt int64) (structs.AccountExport, error) {
+	export := structs.AccountExport{
+		PermanentId:      permanentId,
+		ExportedAt:       exportedAt,
+		Logins:           []structs.ExportedLogin{},
+		Emails:           []structs.ExportedEmail{},
+		Phones:           []structs.ExportedPhone{},
+		Sessions:         []structs.ExportedSession{},
+		RefreshTokens:    []structs.ExportedRefreshToken{},
+		ProfileChanges:   []structs.ExportedProfileChange{},
+		CodeSends:        []structs.ExportedCodeSend{},
+		ResetTokens:      []structs.ExportedResetToken{},
+		AccountDeletions: []structs.ExportedAccountDeletion{},
+		AccountStatuses:  []structs.ExportedAccountStatus{},
+		Roles:            []structs.ExportedRole{},
+	}
+
+	if err := scanAccountRows(AccountLoginsSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var login structs.ExportedLogin
+		if err := rows.Scan(&login.Login, &login.Cancelled); err != nil {
+			return err
+		}
+		export.Logins = append(export.Logins, login)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountEmailsSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var email structs.ExportedEmail
+		if err := rows.Scan(&email.Email, &email.Yauth, &email.Cancelled); err != nil {
+			return err
+		}
+		export.Emails = append(export.Emails, email)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountPhonesSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var phone structs.ExportedPhone
+		if err := rows.Scan(&phone.Phone, &phone.Cancelled); err != nil {
+			return err
+		}
+		export.Phones = append(export.Phones, phone)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := Db.QueryRow(AccountPasswordCountSelectQuery, permanentId).Scan(&export.PasswordCount); err != nil {
+		return structs.AccountExport{}, errors.WithStack(err)
+	}
+
+	if err := scanAccountRows(AccountSessionsSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var session structs.ExportedSession
+		if err := rows.Scan(&session.UserAgent, &session.Yauth, &session.RememberMe, &session.CreatedAt, &session.LastActivityAt, &session.Cancelled); err != nil {
+			return err
+		}
+		export.Sessions = append(export.Sessions, session)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountRefreshTokensSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var refreshToken structs.ExportedRefreshToken
+		if err := rows.Scan(&refreshToken.UserAgent, &refreshToken.Yauth, &refreshToken.Cancelled); err != nil {
+			return err
+		}
+		export.RefreshTokens = append(export.RefreshTokens, refreshToken)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountProfileChangesSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var change structs.ExportedProfileChange
+		if err := rows.Scan(&change.Field, &change.OldValue, &change.NewValue, &change.ChangedAt, &change.Cancelled); err != nil {
+			return err
+		}
+		export.ProfileChanges = append(export.ProfileChanges, change)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	for _, query := range []string{AccountCodeSendsSelectQuery, AccountPhoneCodeSendsSelectQuery} {
+		if err := scanAccountRows(query, permanentId, func(rows *sql.Rows) error {
+			var codeSend structs.ExportedCodeSend
+			if err := rows.Scan(&codeSend.Email, &codeSend.SentAt); err != nil {
+				return err
+			}
+			export.CodeSends = append(export.CodeSends, codeSend)
+			return nil
+		}); err != nil {
+			return structs.AccountExport{}, err
+		}
+	}
+
+	if err := scanAccountRows(AccountResetTokensSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var resetToken structs.ExportedResetToken
+		if err := rows.Scan(&resetToken.Email, &resetToken.Cancelled); err != nil {
+			return err
+		}
+		export.ResetTokens = append(export.ResetTokens, resetToken)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountDeletionsSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var deletion structs.ExportedAccountDeletion
+		if err := rows.Scan(&deletion.RequestedAt, &deletion.DeleteAfter, &deletion.Cancelled); err != nil {
+			return err
+		}
+		export.AccountDeletions = append(export.AccountDeletions, deletion)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountStatusesSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var status structs.ExportedAccountStatus
+		if err := rows.Scan(&status.Status, &status.Reason, &status.CreatedAt, &status.ExpiresAt, &status.Cancelled); err != nil {
+			return err
+		}
+		export.AccountStatuses = append(export.AccountStatuses, status)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	if err := scanAccountRows(AccountRolesSelectQuery, permanentId, func(rows *sql.Rows) error {
+		var role structs.ExportedRole
+		if err := rows.Scan(&role.Role, &role.GrantedAt, &role.Cancelled); err != nil {
+			return err
+		}
+		export.Roles = append(export.Roles, role)
+		return nil
+	}); err != nil {
+		return structs.AccountExport{}, err
+	}
+
+	return export, nil
+}
+
+// SetAccountDeletionTokenInDb сохраняет токен ссылки подтверждения удаления, отправленной пользователю permanentId.
+var SetAccountDeletionTokenInDb = func(token, permanentId string) error {
+	if _, err := Db.Exec(AccountDeletionTokenInsertQuery, token, permanentId, false); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAccountDeletionTokenUsedInDbTx отмечает токен подтверждения удаления использованным.
+//
+// Проверка и отметка выполняются одним запросом, поэтому ссылка срабатывает один раз
+// даже при одновременных переходах.
+// Возвращает ErrAccountDeletionTokenUsed, если токен уже использован или не выдавался.
+var SetAccountDeletionTokenUsedInDbTx = func(tx *sql.Tx, token string) error {
+	result, err := tx.Exec(AccountDeletionTokenUseQuery, token)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return errors.WithStack(ErrAccountDeletionTokenUsed)
+	}
+	return nil
+}
+
+// SetAccountDeletionInDbTx планирует удаление аккаунта на момент deleteAfter.
+//
+// Прежний запрос удаления, если он есть, помечается cancelled.
+var SetAccountDeletionInDbTx = func(tx *sql.Tx, permanentId string, requestedAt, deleteAfter int64) error {
+	_, err := tx.Exec(AccountDeletionUpdateQuery, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.Exec(AccountDeletionInsertQuery, permanentId, requestedAt, deleteAfter, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAccountDeletionCancelledInDbTx отменяет запланированное удаление аккаунта.
+//
+// Вызывается при входе пользователя в течение срока ожидания.
+var SetAccountDeletionCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	_, err := tx.Exec(AccountDeletionUpdateQuery, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetDueAccountDeletionsFromDb получает permanentId аккаунтов, срок ожидания удаления которых истек к now.
+var GetDueAccountDeletionsFromDb = func(now int64) ([]string, error) {
+	rows, err := Db.Query(DueAccountDeletionsSelectQuery, now)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var permanentIds []string
+	for rows.Next() {
+		var permanentId string
+		if err := rows.Scan(&permanentId); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		permanentIds = append(permanentIds, permanentId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return permanentIds, nil
+}
+
+// DeleteAccountFromDbTx безвозвратно удаляет строки пользователя из всех таблиц.
+var DeleteAccountFromDbTx = func(tx *sql.Tx, permanentId string) error {
+	for _, query := range accountDeleteQueries {
+		if _, err := tx.Exec(query, permanentId); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// DeleteDueAccountsFromDb удаляет аккаунты, срок ожидания удаления которых истек к now.
+//
+// Каждый аккаунт удаляется в отдельной транзакции. Перед удалением запрос повторно
+// проверяется с блокировкой строки, чтобы не удалить аккаунт, удаление которого
+// отменено входом после выборки.
+// Возвращает количество удаленных аккаунтов.
+var DeleteDueAccountsFromDb = func(now int64) (int, error) {
+	permanentIds, err := GetDueAccountDeletionsFromDb(now)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	deleted := 0
+	for _, permanentId := range permanentIds {
+		tx, err := Db.Begin()
+		if err != nil {
+			return deleted, errors.WithStack(err)
+		}
+
+		var lockedId string
+		if err := tx.QueryRow(DueAccountDeletionLockSelectQuery, permanentId, now).Scan(&lockedId); err != nil {
+			tx.Rollback()
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return deleted, errors.WithStack(err)
+		}
+
+		if err := DeleteAccountFromDbTx(tx, permanentId); err != nil {
+			tx.Rollback()
+			return deleted, errors.WithStack(err)
+		}
+
+		if err := tx.Commit(); err != nil {
+			tx.Rollback()
+			return deleted, errors.WithStack(err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,89 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для работы со статусом аккаунта:
+//   - GetAccountStatusFromDb: получает текущий статус аккаунта
+//   - SetAccountStatusInDbTx: блокирует аккаунт
+//   - SetAccountStatusCancelledInDbTx: снимает блокировку аккаунта
+//
+// Блокировки (disabled, banned) хранятся в account_status и могут иметь срок действия,
+// после которого перестают действовать без отдельного снятия. Статус pending-deletion
+// не хранится отдельно и определяется по запланированному удалению в account_deletion.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// Статусы аккаунта
+const (
+	AccountStatusActive          = "active"
+	AccountStatusDisabled        = "disabled"
+	AccountStatusBanned          = "banned"
+	AccountStatusPendingDeletion = "pending-deletion"
+)
+
+// SQL-запросы для статуса аккаунта
+const (
+	AccountStatusSelectQuery          = "select status, reason, createdAt, expiresAt from account_status where permanentId = ? and cancelled = false and (expiresAt = 0 or expiresAt > ?) order by createdAt desc limit 1"
+	AccountStatusUpdateQuery          = "update account_status set cancelled = true where permanentId = ? and cancelled = false"
+	AccountStatusInsertQuery          = "insert into account_status (permanentId, status, reason, createdAt, expiresAt, cancelled) values (?, ?, ?, ?, ?, ?)"
+	PendingAccountDeletionSelectQuery = "select requestedAt, deleteAfter from account_deletion where permanentId = ? and cancelled = false order by requestedAt desc limit 1"
+)
+
+// GetAccountStatusFromDb получает статус аккаунта на момент now.
+//
+// Действующая блокировка важнее запланированного удаления. Для pending-deletion
+// ExpiresAt содержит момент удаления. Аккаунт без блокировки и удаления - active.
+var GetAccountStatusFromDb = func(permanentId string, now int64) (structs.AccountStatus, error) {
+	status := structs.AccountStatus{PermanentId: permanentId}
+
+	row := Db.QueryRow(AccountStatusSelectQuery, permanentId, now)
+	err := row.Scan(&status.Status, &status.Reason, &status.CreatedAt, &status.ExpiresAt)
+	if err == nil {
+		return status, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return structs.AccountStatus{}, errors.WithStack(err)
+	}
+
+	row = Db.QueryRow(PendingAccountDeletionSelectQuery, permanentId)
+	err = row.Scan(&status.CreatedAt, &status.ExpiresAt)
+	if err == nil {
+		status.Status = AccountStatusPendingDeletion
+		return status, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return structs.AccountStatus{}, errors.WithStack(err)
+	}
+
+	status.Status = AccountStatusActive
+	return status, nil
+}
+
+// SetAccountStatusInDbTx блокирует аккаунт со статусом disabled или banned.
+//
+// Прежняя блокировка, если она есть, помечается cancelled.
+// Нулевой ExpiresAt означает бессрочную блокировку.
+var SetAccountStatusInDbTx = func(tx *sql.Tx, status structs.AccountStatus) error {
+	_, err := tx.Exec(AccountStatusUpdateQuery, status.PermanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.Exec(AccountStatusInsertQuery, status.PermanentId, status.Status, status.Reason, status.CreatedAt, status.ExpiresAt, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAccountStatusCancelledInDbTx снимает блокировку аккаунта.
+var SetAccountStatusCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	_, err := tx.Exec(AccountStatusUpdateQuery, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
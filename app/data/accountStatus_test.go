@@ -0,0 +1,74 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы со статусом аккаунта.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetAccountStatusFromDb проверяет определение статуса аккаунта.
+// Ожидается: действующая блокировка важнее запланированного удаления,
+// без блокировки и удаления аккаунт активен.
+func TestGetAccountStatusFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	statusColumns := []string{"status", "reason", "createdAt", "expiresAt"}
+	mock.ExpectQuery(AccountStatusSelectQuery).WithArgs("perm123", int64(500)).
+		WillReturnRows(sqlmock.NewRows(statusColumns).AddRow(AccountStatusBanned, "spam", 100, 1000))
+	mock.ExpectQuery(AccountStatusSelectQuery).WithArgs("perm123", int64(500)).
+		WillReturnRows(sqlmock.NewRows(statusColumns))
+	mock.ExpectQuery(PendingAccountDeletionSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"requestedAt", "deleteAfter"}).AddRow(200, 900))
+	mock.ExpectQuery(AccountStatusSelectQuery).WithArgs("perm123", int64(500)).
+		WillReturnRows(sqlmock.NewRows(statusColumns))
+	mock.ExpectQuery(PendingAccountDeletionSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"requestedAt", "deleteAfter"}))
+	mock.ExpectQuery(AccountStatusSelectQuery).WithArgs("perm123", int64(500)).
+		WillReturnError(sql.ErrConnDone)
+
+	status, err := GetAccountStatusFromDb("perm123", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, structs.AccountStatus{PermanentId: "perm123", Status: AccountStatusBanned, Reason: "spam", CreatedAt: 100, ExpiresAt: 1000}, status)
+
+	status, err = GetAccountStatusFromDb("perm123", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, structs.AccountStatus{PermanentId: "perm123", Status: AccountStatusPendingDeletion, CreatedAt: 200, ExpiresAt: 900}, status)
+
+	status, err = GetAccountStatusFromDb("perm123", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, AccountStatusActive, status.Status)
+
+	_, err = GetAccountStatusFromDb("perm123", 500)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAccountStatusQueries проверяет блокировку и разблокировку аккаунта.
+// Ожидается: блокировка заменяет прежнюю, разблокировка отменяет действующую.
+func TestAccountStatusQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(AccountStatusUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(AccountStatusInsertQuery).WithArgs("perm123", AccountStatusDisabled, "abuse", int64(100), int64(200), false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(AccountStatusUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	status := structs.AccountStatus{PermanentId: "perm123", Status: AccountStatusDisabled, Reason: "abuse", CreatedAt: 100, ExpiresAt: 200}
+	assert.NoError(t, SetAccountStatusInDbTx(tx, status))
+	assert.NoError(t, SetAccountStatusCancelledInDbTx(tx, "perm123"))
+	require.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,191 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует выгрузку данных и удаление аккаунта.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAccountDb подменяет Db моком и возвращает функцию восстановления.
+func setupAccountDb(t *testing.T) (sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+
+	oldDb := Db
+	Db = db
+	return mock, func() {
+		Db = oldDb
+		db.Close()
+	}
+}
+
+// TestGetAccountExportFromDb проверяет выгрузку данных пользователя.
+// Ожидается: данные всех таблиц по permanentId, пустые разделы выгружаются пустыми списками.
+func TestGetAccountExportFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(AccountLoginsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"login", "cancelled"}).AddRow("oldLogin", true).AddRow("user123", false))
+	mock.ExpectQuery(AccountEmailsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email", "yauth", "cancelled"}).AddRow("user@example.com", false, false))
+	mock.ExpectQuery(AccountPhonesSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"phone", "cancelled"}).AddRow("+79991234567", false))
+	mock.ExpectQuery(AccountPasswordCountSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectQuery(AccountSessionsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"userAgent", "yauth", "rememberMe", "createdAt", "lastActivityAt", "cancelled"}).AddRow("test-agent", false, true, 100, 200, false))
+	mock.ExpectQuery(AccountRefreshTokensSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"userAgent", "yauth", "cancelled"}).AddRow("test-agent", false, false))
+	mock.ExpectQuery(AccountProfileChangesSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"field", "oldValue", "newValue", "changedAt", "cancelled"}).AddRow(ProfileFieldPasswordReset, "", "", 150, false))
+	mock.ExpectQuery(AccountCodeSendsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email", "sentAt"}).AddRow("user@example.com", 50))
+	mock.ExpectQuery(AccountPhoneCodeSendsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email", "sentAt"}).AddRow("+79991234567", 60))
+	mock.ExpectQuery(AccountResetTokensSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"email", "cancelled"}).AddRow("user@example.com", true))
+	mock.ExpectQuery(AccountDeletionsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"requestedAt", "deleteAfter", "cancelled"}))
+	mock.ExpectQuery(AccountStatusesSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"status", "reason", "createdAt", "expiresAt", "cancelled"}).AddRow(AccountStatusBanned, "spam", 120, 0, true))
+	mock.ExpectQuery(AccountRolesSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "grantedAt", "cancelled"}).AddRow("admin", 130, false))
+
+	export, err := GetAccountExportFromDb("perm123", 300)
+	require.NoError(t, err)
+
+	assert.Equal(t, "perm123", export.PermanentId)
+	assert.Equal(t, int64(300), export.ExportedAt)
+	assert.Equal(t, []structs.ExportedLogin{{Login: "oldLogin", Cancelled: true}, {Login: "user123"}}, export.Logins)
+	assert.Equal(t, []structs.ExportedEmail{{Email: "user@example.com"}}, export.Emails)
+	assert.Equal(t, 2, export.PasswordCount)
+	assert.Equal(t, []structs.ExportedSession{{UserAgent: "test-agent", RememberMe: true, CreatedAt: 100, LastActivityAt: 200}}, export.Sessions)
+	assert.Equal(t, []structs.ExportedRefreshToken{{UserAgent: "test-agent"}}, export.RefreshTokens)
+	assert.Equal(t, []structs.ExportedProfileChange{{Field: ProfileFieldPasswordReset, ChangedAt: 150}}, export.ProfileChanges)
+	assert.Equal(t, []structs.ExportedPhone{{Phone: "+79991234567"}}, export.Phones)
+	assert.Equal(t, []structs.ExportedCodeSend{{Email: "user@example.com", SentAt: 50}, {Email: "+79991234567", SentAt: 60}}, export.CodeSends)
+	assert.Equal(t, []structs.ExportedResetToken{{Email: "user@example.com", Cancelled: true}}, export.ResetTokens)
+	assert.NotNil(t, export.AccountDeletions)
+	assert.Empty(t, export.AccountDeletions)
+	assert.Equal(t, []structs.ExportedAccountStatus{{Status: AccountStatusBanned, Reason: "spam", CreatedAt: 120, Cancelled: true}}, export.AccountStatuses)
+	assert.Equal(t, []structs.ExportedRole{{Role: "admin", GrantedAt: 130}}, export.Roles)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetAccountExportFromDb_Error проверяет ошибку базы данных при выгрузке.
+// Ожидается: ошибка возвращается, выгрузка прерывается.
+func TestGetAccountExportFromDb_Error(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(AccountLoginsSelectQuery).WithArgs("perm123").WillReturnError(sql.ErrConnDone)
+
+	_, err := GetAccountExportFromDb("perm123", 300)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAccountDeletionQueries проверяет планирование и отмену удаления аккаунта.
+// Ожидается: прежний запрос отменяется перед новым, вход отменяет запрос.
+func TestAccountDeletionQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(AccountDeletionUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(AccountDeletionInsertQuery).WithArgs("perm123", int64(100), int64(200), false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(AccountDeletionUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(AccountDeletionUpdateQuery).WithArgs("perm123").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+
+	assert.NoError(t, SetAccountDeletionInDbTx(tx, "perm123", 100, 200))
+	assert.NoError(t, SetAccountDeletionCancelledInDbTx(tx, "perm123"))
+	assert.Error(t, SetAccountDeletionInDbTx(tx, "perm123", 100, 200))
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAccountDeletionTokenQueries проверяет сохранение и использование токена подтверждения удаления.
+// Ожидается: токен сохраняется для пользователя и используется один раз,
+// повторное использование возвращает ErrAccountDeletionTokenUsed.
+func TestAccountDeletionTokenQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectExec(AccountDeletionTokenInsertQuery).WithArgs("delete-token", "perm123", false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectBegin()
+	mock.ExpectExec(AccountDeletionTokenUseQuery).WithArgs("delete-token").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(AccountDeletionTokenUseQuery).WithArgs("delete-token").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(AccountDeletionTokenUseQuery).WithArgs("other-token").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	assert.NoError(t, SetAccountDeletionTokenInDb("delete-token", "perm123"))
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetAccountDeletionTokenUsedInDbTx(tx, "delete-token"))
+	assert.ErrorIs(t, SetAccountDeletionTokenUsedInDbTx(tx, "delete-token"), ErrAccountDeletionTokenUsed)
+	err = SetAccountDeletionTokenUsedInDbTx(tx, "other-token")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrAccountDeletionTokenUsed)
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteDueAccountsFromDb проверяет удаление аккаунтов с истекшим сроком ожидания.
+// Ожидается: строки удаляются из всех таблиц, аккаунт с отмененным после выборки удалением пропускается.
+func TestDeleteDueAccountsFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(DueAccountDeletionsSelectQuery).WithArgs(int64(500)).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm123").AddRow("perm456"))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(DueAccountDeletionLockSelectQuery).WithArgs("perm123", int64(500)).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm123"))
+	for _, query := range accountDeleteQueries {
+		mock.ExpectExec(query).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(DueAccountDeletionLockSelectQuery).WithArgs("perm456", int64(500)).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}))
+	mock.ExpectRollback()
+
+	deleted, err := DeleteDueAccountsFromDb(500)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestDeleteAccountFromDbTx_Error проверяет ошибку при удалении строк аккаунта.
+// Ожидается: ошибка возвращается, остальные таблицы не затрагиваются.
+func TestDeleteAccountFromDbTx_Error(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(accountDeleteQueries[0]).WithArgs("perm123").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.Error(t, DeleteAccountFromDbTx(tx, "perm123"))
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
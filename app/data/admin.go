@@ -0,0 +1,109 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для администрирования пользователей:
+//   - SearchUsersInDb: ищет пользователей по началу логина или email
+//   - SetAdminActionInDbTx: фиксирует действие администратора в журнале
+//   - GetAdminActionsFromDb: получает последние действия администраторов над аккаунтом
+//
+// Права доступа к разделу администратора задаются ролями (см. role.go),
+// блокировка аккаунта - статусом аккаунта (см. accountStatus.go).
+// Журнал admin_action хранит permanentId и логин администратора на момент действия
+// и не удаляется вместе с аккаунтом.
+package data
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// Действия администратора в журнале
+const (
+	AdminActionRoleGrant     = "roleGrant"
+	AdminActionRoleRevoke    = "roleRevoke"
+	AdminActionDisable       = "disable"
+	AdminActionBan           = "ban"
+	AdminActionEnable        = "enable"
+	AdminActionLogout        = "logout"
+	AdminActionPasswordReset = "passwordReset"
+	AdminActionLogin         = "login"
+	AdminActionEmail         = "email"
+	AdminActionInviteCreate  = "inviteCreate"
+	AdminActionInviteRevoke  = "inviteRevoke"
+)
+
+// adminSearchLimit ограничивает число пользователей в результатах поиска.
+const adminSearchLimit = 20
+
+// adminActionsLimit ограничивает число действий в журнале на странице пользователя.
+const adminActionsLimit = 50
+
+// SQL-запросы для администрирования пользователей
+const (
+	AdminUserSearchQuery            = "select permanentId from login where login like ? and cancelled = false union select permanentId from email where email like ? and cancelled = false limit ?"
+	AdminActionInsertQuery          = "insert into admin_action (adminPermanentId, adminLogin, targetPermanentId, action, detail, createdAt) values (?, ?, ?, ?, ?, ?)"
+	AdminActionsByTargetSelectQuery = "select adminPermanentId, adminLogin, targetPermanentId, action, detail, createdAt from admin_action where targetPermanentId = ? order by createdAt desc limit ?"
+)
+
+// escapeLike экранирует спецсимволы шаблона LIKE.
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// SearchUsersInDb ищет пользователей, действующий логин или email которых начинается с query.
+//
+// Возвращает не более adminSearchLimit permanentId без повторов.
+var SearchUsersInDb = func(query string) ([]string, error) {
+	pattern := escapeLike(query) + "%"
+	rows, err := Db.Query(AdminUserSearchQuery, pattern, pattern, adminSearchLimit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var permanentIds []string
+	for rows.Next() {
+		var permanentId string
+		if err := rows.Scan(&permanentId); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		permanentIds = append(permanentIds, permanentId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return permanentIds, nil
+}
+
+// SetAdminActionInDbTx фиксирует действие администратора в журнале.
+var SetAdminActionInDbTx = func(tx *sql.Tx, action structs.AdminAction) error {
+	_, err := tx.Exec(AdminActionInsertQuery, action.AdminPermanentId, action.AdminLogin, action.TargetPermanentId, action.Action, action.Detail, action.CreatedAt)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetAdminActionsFromDb получает последние действия администраторов над аккаунтом, начиная с новых.
+var GetAdminActionsFromDb = func(targetPermanentId string) ([]structs.AdminAction, error) {
+	rows, err := Db.Query(AdminActionsByTargetSelectQuery, targetPermanentId, adminActionsLimit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var actions []structs.AdminAction
+	for rows.Next() {
+		var action structs.AdminAction
+		if err := rows.Scan(&action.AdminPermanentId, &action.AdminLogin, &action.TargetPermanentId, &action.Action, &action.Detail, &action.CreatedAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		actions = append(actions, action)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return actions, nil
+}
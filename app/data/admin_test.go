@@ -0,0 +1,67 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции администрирования пользователей.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSearchUsersInDb проверяет поиск пользователей по началу логина или email.
+// Ожидается: спецсимволы LIKE экранируются, результат ограничен.
+func TestSearchUsersInDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(AdminUserSearchQuery).WithArgs(`user\_1%`, `user\_1%`, adminSearchLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm123").AddRow("perm456"))
+	mock.ExpectQuery(AdminUserSearchQuery).WithArgs(`\%%`, `\%%`, adminSearchLimit).
+		WillReturnError(sql.ErrConnDone)
+
+	permanentIds, err := SearchUsersInDb("user_1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"perm123", "perm456"}, permanentIds)
+
+	_, err = SearchUsersInDb("%")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestAdminActionQueries проверяет запись и чтение журнала действий администраторов.
+// Ожидается: действие сохраняется с данными администратора и читается по целевому аккаунту.
+func TestAdminActionQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	action := structs.AdminAction{
+		AdminPermanentId:  "admin1",
+		AdminLogin:        "admin",
+		TargetPermanentId: "perm123",
+		Action:            AdminActionDisable,
+		CreatedAt:         100,
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(AdminActionInsertQuery).WithArgs("admin1", "admin", "perm123", AdminActionDisable, "", int64(100)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(AdminActionsByTargetSelectQuery).WithArgs("perm123", adminActionsLimit).
+		WillReturnRows(sqlmock.NewRows([]string{"adminPermanentId", "adminLogin", "targetPermanentId", "action", "detail", "createdAt"}).
+			AddRow("admin1", "admin", "perm123", AdminActionDisable, "", 100))
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetAdminActionInDbTx(tx, action))
+	require.NoError(t, tx.Commit())
+
+	actions, err := GetAdminActionsFromDb("perm123")
+	assert.NoError(t, err)
+	assert.Equal(t, []structs.AdminAction{action}, actions)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,91 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для учета отправленных кодов аутентификации:
+//   - ReserveServerAuthCodeSendInDb: проверяет квоты и фиксирует отправку кода на email
+//
+// Статистика используется для ограничения частоты и количества отправок.
+// Для кодов в SMS вместо email передается номер телефона в формате E.164.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для работы с таблицей отправленных кодов
+const (
+	ServerAuthCodeSendStatsSelectQuery = "select coalesce(sum(sentAt > ?), 0), count(*), coalesce(max(sentAt), 0), coalesce(min(case when sentAt > ? then sentAt end), 0), coalesce(min(sentAt), 0) from server_auth_code_send where email = ? and sentAt > ? for update"
+	ServerAuthCodeSendInsertQuery      = "insert into server_auth_code_send (email, sentAt) values (?, ?)"
+)
+
+// mysqlDeadlockErrorNumber - код ошибки MySQL, с которым InnoDB откатывает одну из
+// транзакций, взаимно ожидающих блокировки.
+const mysqlDeadlockErrorNumber = 1213
+
+// ErrServerAuthCodeSendConcurrent возвращается, если одновременно с текущей
+// на тот же адрес была зафиксирована другая отправка кода.
+var ErrServerAuthCodeSendConcurrent = errors.New("concurrent server auth code send")
+
+// ReserveServerAuthCodeSendInDb проверяет квоты и фиксирует отправку кода на email в одной транзакции.
+//
+// Считает отправки за последний час и за последние сутки относительно now, время последней
+// отправки и время самых ранних отправок в каждом окне (unix-время, 0 если отправок не было),
+// и передает статистику в check. Если check вернул непустой ключ сообщения, отправка
+// не фиксируется и ключ с временем ожидания возвращается вызывающему.
+//
+// Строки адреса читаются с блокировкой (select ... for update по индексу (email, sentAt)),
+// поэтому одновременные запросы на один адрес не превышают квоты. Если InnoDB откатил
+// транзакцию из-за взаимной блокировки с такой же отправкой, возвращается
+// ErrServerAuthCodeSendConcurrent.
+var ReserveServerAuthCodeSendInDb = func(email string, now int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+
+	msgKey, wait, err := reserveServerAuthCodeSendTx(tx, email, now, check)
+	if err != nil || msgKey != "" {
+		tx.Rollback()
+		return msgKey, wait, concurrentSendErr(err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return "", 0, concurrentSendErr(errors.WithStack(err))
+	}
+	return "", 0, nil
+}
+
+// reserveServerAuthCodeSendTx читает статистику отправок с блокировкой и, если check
+// разрешает отправку, добавляет запись о ней.
+func reserveServerAuthCodeSendTx(tx *sql.Tx, email string, now int64, check func(structs.ServerAuthCodeSendStats) (string, int64)) (string, int64, error) {
+	hourAgo := now - 60*60
+	dayAgo := now - 24*60*60
+	row := tx.QueryRow(ServerAuthCodeSendStatsSelectQuery, hourAgo, hourAgo, email, dayAgo)
+
+	var stats structs.ServerAuthCodeSendStats
+	if err := row.Scan(&stats.LastHour, &stats.LastDay, &stats.LastSentAt, &stats.FirstInLastHourAt, &stats.FirstInLastDayAt); err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+
+	if msgKey, wait := check(stats); msgKey != "" {
+		return msgKey, wait, nil
+	}
+
+	if _, err := tx.Exec(ServerAuthCodeSendInsertQuery, email, now); err != nil {
+		return "", 0, errors.WithStack(err)
+	}
+	return "", 0, nil
+}
+
+// concurrentSendErr заменяет ошибку взаимной блокировки на ErrServerAuthCodeSendConcurrent.
+func concurrentSendErr(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDeadlockErrorNumber {
+		return errors.WithStack(ErrServerAuthCodeSendConcurrent)
+	}
+	return err
+}
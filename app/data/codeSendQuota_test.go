@@ -0,0 +1,102 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл тестирует функции учета отправленных кодов аутентификации.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReserveServerAuthCodeSendInDb проверяет проверку квот и фиксацию отправки в одной транзакции.
+// Ожидается: статистика читается с блокировкой за корректные окна времени; разрешенная отправка
+// записывается и фиксируется, запрещенная - откатывается с ключом сообщения; взаимная
+// блокировка возвращает ErrServerAuthCodeSendConcurrent.
+func TestReserveServerAuthCodeSendInDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	Db = db
+	now := int64(100_000)
+	statsRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"lastHour", "lastDay", "lastSentAt", "firstInHour", "firstInDay"}).
+			AddRow(2, 4, now-30, now-1000, now-5000)
+	}
+	wantStats := structs.ServerAuthCodeSendStats{LastHour: 2, LastDay: 4, LastSentAt: now - 30, FirstInLastHourAt: now - 1000, FirstInLastDayAt: now - 5000}
+
+	t.Run("send allowed", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(ServerAuthCodeSendStatsSelectQuery).
+			WithArgs(now-3600, now-3600, "test@example.com", now-86400).
+			WillReturnRows(statsRows())
+		mock.ExpectExec(ServerAuthCodeSendInsertQuery).
+			WithArgs("test@example.com", now).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		var gotStats structs.ServerAuthCodeSendStats
+		msgKey, wait, err := ReserveServerAuthCodeSendInDb("test@example.com", now, func(stats structs.ServerAuthCodeSendStats) (string, int64) {
+			gotStats = stats
+			return "", 0
+		})
+		assert.NoError(t, err)
+		assert.Empty(t, msgKey)
+		assert.Zero(t, wait)
+		assert.Equal(t, wantStats, gotStats)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("quota exceeded", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(ServerAuthCodeSendStatsSelectQuery).
+			WithArgs(now-3600, now-3600, "test@example.com", now-86400).
+			WillReturnRows(statsRows())
+		mock.ExpectRollback()
+
+		msgKey, wait, err := ReserveServerAuthCodeSendInDb("test@example.com", now, func(stats structs.ServerAuthCodeSendStats) (string, int64) {
+			return "serverCodeSendCooldown", 30
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "serverCodeSendCooldown", msgKey)
+		assert.Equal(t, int64(30), wait)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(ServerAuthCodeSendStatsSelectQuery).
+			WithArgs(now-3600, now-3600, "test@example.com", now-86400).
+			WillReturnError(sql.ErrConnDone)
+		mock.ExpectRollback()
+
+		_, _, err := ReserveServerAuthCodeSendInDb("test@example.com", now, func(stats structs.ServerAuthCodeSendStats) (string, int64) {
+			return "", 0
+		})
+		assert.ErrorIs(t, err, sql.ErrConnDone)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("deadlock with concurrent send", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectQuery(ServerAuthCodeSendStatsSelectQuery).
+			WithArgs(now-3600, now-3600, "test@example.com", now-86400).
+			WillReturnRows(statsRows())
+		mock.ExpectExec(ServerAuthCodeSendInsertQuery).
+			WithArgs("test@example.com", now).
+			WillReturnError(&mysql.MySQLError{Number: mysqlDeadlockErrorNumber, Message: "Deadlock found"})
+		mock.ExpectRollback()
+
+		_, _, err := ReserveServerAuthCodeSendInDb("test@example.com", now, func(stats structs.ServerAuthCodeSendStats) (string, int64) {
+			return "", 0
+		})
+		assert.ErrorIs(t, err, ErrServerAuthCodeSendConcurrent)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
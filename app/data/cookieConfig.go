@@ -0,0 +1,184 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит настройки cookie и подпись идентификатора сессии:
+//   - IsDevProfile: проверяет, запущено ли приложение в профиле разработки
+//   - loadCookieConfig: загружает настройки cookie из переменных окружения
+//   - cookieName: формирует имя cookie с учетом префикса __Host-
+//   - CheckCookieSigningKey: проверяет, что ключ подписи временного ID задан
+//   - SignTemporaryId: подписывает временный ID с помощью HMAC
+//   - verifyTemporaryId: проверяет подпись и извлекает временный ID
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/pkg/errors"
+)
+
+const hostCookiePrefix = "__Host-"
+
+// ErrCookieSigningKeyNotSet возвращается, если не задан COOKIE_SIGNING_KEY
+// и в связке ключей нет набора cookie.
+var ErrCookieSigningKeyNotSet = errors.New("cookie signing key not set")
+
+// cookieConfig описывает общие параметры cookie приложения.
+type cookieConfig struct {
+	name       string
+	domain     string
+	secure     bool
+	hostPrefix bool
+	sameSite   http.SameSite
+}
+
+// IsDevProfile проверяет, запущено ли приложение в профиле разработки.
+//
+// Профиль задается переменной окружения APP_PROFILE=dev и разрешает
+// работу по обычному HTTP на локальной машине.
+func IsDevProfile() bool {
+	return os.Getenv("APP_PROFILE") == "dev"
+}
+
+// loadCookieConfig загружает настройки cookie.
+//
+// Использует переменные окружения:
+//   - COOKIE_NAME: имя cookie с временным ID (по умолчанию "temporaryId")
+//   - COOKIE_DOMAIN: домен cookie (по умолчанию не задается)
+//   - COOKIE_SAMESITE: lax, strict или none (по умолчанию lax)
+//   - COOKIE_HOST_PREFIX: "true" добавляет к именам cookie префикс __Host-
+//   - COOKIE_SECURE: учитывается только в профиле dev, вне его флаг Secure всегда включен
+//
+// Префикс __Host- требует флага Secure и отсутствия домена, поэтому
+// при выключенном Secure префикс не применяется, а домен с префиксом игнорируется.
+// SameSite=None без Secure браузеры отклоняют, в этом случае используется Lax.
+func loadCookieConfig() cookieConfig {
+	config := cookieConfig{
+		name:     "temporaryId",
+		domain:   os.Getenv("COOKIE_DOMAIN"),
+		secure:   true,
+		sameSite: http.SameSiteLaxMode,
+	}
+
+	if name := os.Getenv("COOKIE_NAME"); name != "" {
+		config.name = name
+	}
+
+	if IsDevProfile() {
+		config.secure = os.Getenv("COOKIE_SECURE") == "true"
+	}
+
+	switch strings.ToLower(os.Getenv("COOKIE_SAMESITE")) {
+	case "strict":
+		config.sameSite = http.SameSiteStrictMode
+	case "none":
+		if config.secure {
+			config.sameSite = http.SameSiteNoneMode
+		}
+	}
+
+	config.hostPrefix = os.Getenv("COOKIE_HOST_PREFIX") == "true" && config.secure
+	if config.hostPrefix {
+		config.domain = ""
+	}
+
+	return config
+}
+
+// cookieName возвращает имя cookie с учетом префикса __Host-.
+func cookieName(config cookieConfig, name string) string {
+	if config.hostPrefix {
+		return hostCookiePrefix + name
+	}
+	return name
+}
+
+// cookieSigningKeys возвращает ключи подписи cookie из связки ключей (см. keyring.CookieSigningKeys).
+//
+// Первым ключом подписываются новые cookie, остальными только проверяются, поэтому
+// ротация ключа не завершает сессии. Если ключей нет, возвращает ErrCookieSigningKeyNotSet:
+// подпись пустым ключом позволила бы любому подделать временный ID.
+func cookieSigningKeys() ([][]byte, error) {
+	keys, err := keyring.CookieSigningKeys()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(keys) == 0 {
+		return nil, errors.WithStack(ErrCookieSigningKeyNotSet)
+	}
+	return keys, nil
+}
+
+// CheckCookieSigningKey проверяет, что ключ подписи временного ID задан.
+//
+// Вызывается при запуске сервера, чтобы приложение без ключа не запускалось.
+func CheckCookieSigningKey() error {
+	_, err := cookieSigningKeys()
+	return err
+}
+
+// cookieSignature вычисляет HMAC-SHA256 подпись значения ключом key.
+func cookieSignature(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signCookieValue подписывает значение основным ключом подписи cookie.
+func signCookieValue(value string) (string, error) {
+	keys, err := cookieSigningKeys()
+	if err != nil {
+		return "", err
+	}
+	return cookieSignature(keys[0], value), nil
+}
+
+// verifyCookieSignature проверяет подпись значения всеми действующими ключами подписи cookie.
+//
+// Возвращает false, если подпись не совпадает ни с одним ключом.
+func verifyCookieSignature(value, signature string) (bool, error) {
+	keys, err := cookieSigningKeys()
+	if err != nil {
+		return false, err
+	}
+	for _, key := range keys {
+		if hmac.Equal([]byte(signature), []byte(cookieSignature(key, value))) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SignTemporaryId подписывает временный ID.
+//
+// Возвращает значение для cookie в формате "<temporaryId>.<подпись>".
+// Если ключ подписи не задан, возвращает ErrCookieSigningKeyNotSet.
+func SignTemporaryId(temporaryId string) (string, error) {
+	signature, err := signCookieValue(temporaryId)
+	if err != nil {
+		return "", err
+	}
+	return temporaryId + "." + signature, nil
+}
+
+// verifyTemporaryId проверяет подпись значения cookie и возвращает временный ID.
+//
+// Возвращает ошибку, если формат значения неверен или подпись не совпадает.
+func verifyTemporaryId(value string) (string, error) {
+	temporaryId, signature, ok := strings.Cut(value, ".")
+	if !ok || temporaryId == "" {
+		return "", errors.New("temporaryId signature invalid")
+	}
+	valid, err := verifyCookieSignature(temporaryId, signature)
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return "", errors.New("temporaryId signature invalid")
+	}
+	return temporaryId, nil
+}
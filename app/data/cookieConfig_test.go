@@ -0,0 +1,176 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл тестирует настройки cookie, подпись временного ID и ротацию ключей подписи.
+package data
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/keyring"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLoadCookieConfig проверяет загрузку настроек cookie.
+// Ожидается: Secure вне профиля dev, префикс __Host- без домена, откат SameSite=None на Lax без Secure.
+func TestLoadCookieConfig(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		config := loadCookieConfig()
+		assert.Equal(t, "temporaryId", config.name)
+		assert.True(t, config.secure)
+		assert.False(t, config.hostPrefix)
+		assert.Equal(t, http.SameSiteLaxMode, config.sameSite)
+	})
+
+	t.Run("secure cannot be disabled outside dev profile", func(t *testing.T) {
+		t.Setenv("COOKIE_SECURE", "false")
+		assert.True(t, loadCookieConfig().secure)
+	})
+
+	t.Run("host prefix drops domain", func(t *testing.T) {
+		t.Setenv("COOKIE_HOST_PREFIX", "true")
+		t.Setenv("COOKIE_DOMAIN", "example.com")
+		t.Setenv("COOKIE_NAME", "sid")
+		t.Setenv("COOKIE_SAMESITE", "strict")
+
+		config := loadCookieConfig()
+		assert.True(t, config.hostPrefix)
+		assert.Empty(t, config.domain)
+		assert.Equal(t, "__Host-sid", cookieName(config, config.name))
+		assert.Equal(t, http.SameSiteStrictMode, config.sameSite)
+	})
+
+	t.Run("dev profile allows plain http", func(t *testing.T) {
+		t.Setenv("APP_PROFILE", "dev")
+		t.Setenv("COOKIE_HOST_PREFIX", "true")
+		t.Setenv("COOKIE_SAMESITE", "none")
+
+		config := loadCookieConfig()
+		assert.False(t, config.secure)
+		assert.False(t, config.hostPrefix)
+		assert.Equal(t, http.SameSiteLaxMode, config.sameSite)
+	})
+}
+
+// TestVerifyTemporaryId проверяет подпись временного ID.
+// Ожидается: подписанное значение принимается, измененное или неподписанное отклоняется.
+func TestVerifyTemporaryId(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
+	signed, err := SignTemporaryId("temp-id")
+	require.NoError(t, err)
+	temporaryId, err := verifyTemporaryId(signed)
+	require.NoError(t, err)
+	assert.Equal(t, "temp-id", temporaryId)
+
+	for _, value := range []string{"temp-id", "other-id" + signed[len("temp-id"):], signed + "x", "." + signed} {
+		_, err := verifyTemporaryId(value)
+		assert.Error(t, err, value)
+	}
+
+	t.Setenv("COOKIE_SIGNING_KEY", "another-key")
+	_, err = verifyTemporaryId(signed)
+	assert.Error(t, err)
+}
+
+// TestCookieSigningKey_NotSet проверяет работу без ключа подписи.
+// Ожидается: ключ хранилища сессий вместо него не используется, запуск отклоняется,
+// временный ID не подписывается и не проверяется, cookie не устанавливается.
+func TestCookieSigningKey_NotSet(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "")
+	t.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "test-auth-key")
+
+	assert.ErrorIs(t, CheckCookieSigningKey(), ErrCookieSigningKeyNotSet)
+
+	_, err := SignTemporaryId("temp-id")
+	assert.ErrorIs(t, err, ErrCookieSigningKeyNotSet)
+
+	_, err = verifyTemporaryId("temp-id.c2lnbmF0dXJl")
+	assert.ErrorIs(t, err, ErrCookieSigningKeyNotSet)
+
+	w := httptest.NewRecorder()
+	SetTemporaryIdInCookies(w, "temp-id", 3600, true)
+	assert.Empty(t, w.Result().Cookies())
+}
+
+// TestCookieSigningKeys_Rotation проверяет ротацию ключа подписи cookie через связку ключей.
+// Ожидается: новые cookie подписываются основным ключом набора cookie, cookie, подписанные
+// COOKIE_SIGNING_KEY и прежним основным ключом, принимаются, пока ключ действует,
+// а после вывода ключа отклоняются.
+func TestCookieSigningKeys_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
+	signedWithEnvKey, err := SignTemporaryId("temp-id")
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	require.NoError(t, SetTrustedDeviceInCookies(w, "device-123"))
+	trustedDeviceCookie := w.Result().Cookies()[0]
+
+	var keyringData structs.Keyring
+	oldKey, err := keyring.AddKey(&keyringData, keyring.SetCookie, 1700000000)
+	require.NoError(t, err)
+	require.NoError(t, keyring.Save(path, keyringData))
+
+	signedWithOldKey, err := SignTemporaryId("temp-id")
+	require.NoError(t, err)
+	assert.NotEqual(t, signedWithEnvKey, signedWithOldKey)
+
+	newKey, err := keyring.AddKey(&keyringData, keyring.SetCookie, 1700000001)
+	require.NoError(t, err)
+	require.NoError(t, keyring.PromoteKey(&keyringData, keyring.SetCookie, newKey.Kid))
+	require.NoError(t, keyring.Save(path, keyringData))
+
+	signedWithNewKey, err := SignTemporaryId("temp-id")
+	require.NoError(t, err)
+	assert.NotEqual(t, signedWithOldKey, signedWithNewKey)
+
+	for _, signed := range []string{signedWithEnvKey, signedWithOldKey, signedWithNewKey} {
+		temporaryId, err := verifyTemporaryId(signed)
+		require.NoError(t, err, signed)
+		assert.Equal(t, "temp-id", temporaryId)
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(trustedDeviceCookie)
+	deviceId, err := GetTrustedDeviceFromCookies(req)
+	require.NoError(t, err)
+	assert.Equal(t, "device-123", deviceId)
+
+	require.NoError(t, keyring.RetireKey(&keyringData, keyring.SetCookie, oldKey.Kid))
+	require.NoError(t, keyring.Save(path, keyringData))
+	_, err = verifyTemporaryId(signedWithOldKey)
+	assert.Error(t, err)
+
+	t.Setenv("COOKIE_SIGNING_KEY", "")
+	_, err = verifyTemporaryId(signedWithEnvKey)
+	assert.Error(t, err)
+	_, err = verifyTemporaryId(signedWithNewKey)
+	assert.NoError(t, err)
+}
+
+// TestTemporaryIdCookie_HostPrefix проверяет круговой обмен cookie с префиксом __Host-.
+// Ожидается: cookie с префиксом и Secure, из которого извлекается исходный временный ID.
+func TestTemporaryIdCookie_HostPrefix(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
+	t.Setenv("COOKIE_HOST_PREFIX", "true")
+
+	w := httptest.NewRecorder()
+	SetTemporaryIdInCookies(w, "temp-id", 3600, true)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "__Host-temporaryId", cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookies[0])
+	cookie, err := GetTemporaryIdFromCookies(req)
+	require.NoError(t, err)
+	assert.Equal(t, "temp-id", cookie.Value)
+}
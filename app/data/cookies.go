@@ -8,6 +8,7 @@
 package data
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gimaevra94/auth/app/consts"
@@ -16,53 +17,74 @@ import (
 
 // SetTemporaryIdInCookies устанавливает временный ID в cookie.
 //
-// Создает cookie с именем "temporaryId" для хранения временного идентификатора сессии.
+// Создает cookie (по умолчанию с именем "temporaryId") для хранения временного идентификатора сессии.
+// Значение подписывается HMAC, чтобы подмененный ID отклонялся до обращения к БД.
 // Если rememberMe=false, устанавливает срок действия 24 часа.
-// Cookie настраивается с флагами HttpOnly, SameSiteLaxMode для безопасности.
+// Флаги Secure, SameSite, домен и префикс __Host- берутся из настроек cookie.
+// Без ключа подписи cookie не устанавливается.
 var SetTemporaryIdInCookies = func(w http.ResponseWriter, value string, temporaryIdExp int, rememberMe bool) {
+	signedValue, err := SignTemporaryId(value)
+	if err != nil {
+		log.Printf("%+v", err)
+		return
+	}
+
 	temporaryIdExp24Hours := 24 * 60 * 60
 	if !rememberMe {
 		temporaryIdExp = temporaryIdExp24Hours
 	}
 
+	config := loadCookieConfig()
 	http.SetCookie(w, &http.Cookie{
-		Name:     "temporaryId",
+		Name:     cookieName(config, config.name),
 		Path:     "/",
+		Domain:   config.domain,
 		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-		Value:    value,
+		Secure:   config.secure,
+		SameSite: config.sameSite,
+		Value:    signedValue,
 		MaxAge:   temporaryIdExp,
 	})
 }
 
 // GetTemporaryIdFromCookies получает временный ID из cookie.
 //
-// Извлекает cookie с именем "temporaryId" из HTTP запроса.
-// Проверяет наличие и непустоту значения cookie.
-// Возвращает ошибку, если cookie отсутствует или пустой.
+// Извлекает cookie с временным ID из HTTP запроса и проверяет его подпись.
+// Возвращает копию cookie, в которой Value содержит временный ID без подписи.
+// Возвращает ошибку, если cookie отсутствует, пустой или подпись неверна.
 func GetTemporaryIdFromCookies(r *http.Request) (*http.Cookie, error) {
-	Cookies, err := r.Cookie("temporaryId")
+	config := loadCookieConfig()
+	Cookies, err := r.Cookie(cookieName(config, config.name))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	if Cookies.Value == "" {
 		return nil, errors.New("temporaryId not exist")
 	}
-	return Cookies, nil
+
+	temporaryId, err := verifyTemporaryId(Cookies.Value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	verifiedCookie := *Cookies
+	verifiedCookie.Value = temporaryId
+	return &verifiedCookie, nil
 }
 
 // ClearTemporaryIdInCookies удаляет временный ID из cookie.
 //
-// Создает cookie с тем же именем "temporaryId", но с отрицательным MaxAge
+// Создает cookie с тем же именем и атрибутами, но с отрицательным MaxAge
 // для немедленного удаления cookie из браузера клиента.
 func ClearTemporaryIdInCookies(w http.ResponseWriter) {
+	config := loadCookieConfig()
 	http.SetCookie(w, &http.Cookie{
-		Name:     "temporaryId",
+		Name:     cookieName(config, config.name),
 		Path:     "/",
+		Domain:   config.domain,
 		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
+		Secure:   config.secure,
+		SameSite: config.sameSite,
 		MaxAge:   -1,
 	})
 }
@@ -16,6 +16,8 @@ import (
 // TestSetTemporaryIdInCookies_WithRememberMe проверяет установку cookie с флагом rememberMe.
 // Ожидается: cookie с правильными свойствами и временем жизни 7 дней.
 func TestSetTemporaryIdInCookies_WithRememberMe(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	w := httptest.NewRecorder()
 	value := "test-temp-id"
 	temporaryIdExp := 7 * 24 * 60 * 60
@@ -32,8 +34,8 @@ func TestSetTemporaryIdInCookies_WithRememberMe(t *testing.T) {
 	if cookie.Name != "temporaryId" {
 		t.Errorf("Expected cookie name 'temporaryId', got '%s'", cookie.Name)
 	}
-	if cookie.Value != value {
-		t.Errorf("Expected cookie value '%s', got '%s'", value, cookie.Value)
+	if cookie.Value != signedTemporaryId(t, value) {
+		t.Errorf("Expected signed cookie value '%s', got '%s'", signedTemporaryId(t, value), cookie.Value)
 	}
 	if cookie.Path != "/" {
 		t.Errorf("Expected cookie path '/', got '%s'", cookie.Path)
@@ -41,8 +43,8 @@ func TestSetTemporaryIdInCookies_WithRememberMe(t *testing.T) {
 	if !cookie.HttpOnly {
 		t.Error("Expected cookie to be HttpOnly")
 	}
-	if cookie.Secure {
-		t.Error("Expected cookie Secure to be false")
+	if !cookie.Secure {
+		t.Error("Expected cookie Secure to be true")
 	}
 	if cookie.SameSite != http.SameSiteLaxMode {
 		t.Errorf("Expected SameSiteLaxMode, got %v", cookie.SameSite)
@@ -55,6 +57,8 @@ func TestSetTemporaryIdInCookies_WithRememberMe(t *testing.T) {
 // TestSetTemporaryIdInCookies_WithoutRememberMe проверяет установку cookie без флага rememberMe.
 // Ожидается: cookie с временем жизни 24 часа.
 func TestSetTemporaryIdInCookies_WithoutRememberMe(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	w := httptest.NewRecorder()
 	value := "test-temp-id"
 	temporaryIdExp := 7 * 24 * 60 * 60
@@ -75,8 +79,10 @@ func TestSetTemporaryIdInCookies_WithoutRememberMe(t *testing.T) {
 }
 
 // TestSetTemporaryIdInCookies_EmptyValue проверяет установку cookie с пустым значением.
-// Ожидается: cookie с пустым значением.
+// Ожидается: cookie с подписанным пустым значением, которое не проходит проверку.
 func TestSetTemporaryIdInCookies_EmptyValue(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	w := httptest.NewRecorder()
 	value := ""
 	temporaryIdExp := 7 * 24 * 60 * 60
@@ -90,14 +96,19 @@ func TestSetTemporaryIdInCookies_EmptyValue(t *testing.T) {
 	}
 
 	cookie := cookies[0]
-	if cookie.Value != "" {
-		t.Errorf("Expected empty cookie value, got '%s'", cookie.Value)
+	if cookie.Value != signedTemporaryId(t, "") {
+		t.Errorf("Expected signed empty cookie value, got '%s'", cookie.Value)
+	}
+	if _, err := verifyTemporaryId(cookie.Value); err == nil {
+		t.Error("Expected signed empty value to be rejected")
 	}
 }
 
 // TestSetTemporaryIdInCookies_ZeroExpiration проверяет установку cookie с нулевым временем жизни.
 // Ожидается: cookie с MaxAge равным 0.
 func TestSetTemporaryIdInCookies_ZeroExpiration(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	w := httptest.NewRecorder()
 	value := "test-temp-id"
 	temporaryIdExp := 0
@@ -119,11 +130,13 @@ func TestSetTemporaryIdInCookies_ZeroExpiration(t *testing.T) {
 // TestGetTemporaryIdFromCookies_Success проверяет успешное получение cookie.
 // Ожидается: успешное извлечение cookie с правильным значением.
 func TestGetTemporaryIdFromCookies_Success(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	value := "test-temp-id"
 	req := httptest.NewRequest("GET", "/", nil)
 	req.AddCookie(&http.Cookie{
 		Name:  "temporaryId",
-		Value: value,
+		Value: signedTemporaryId(t, value),
 	})
 
 	cookie, err := GetTemporaryIdFromCookies(req)
@@ -200,6 +213,8 @@ func TestGetTemporaryIdFromCookies_WrongCookieName(t *testing.T) {
 // TestGetTemporaryIdFromCookies_MultipleCookies проверяет получение нужного cookie из нескольких.
 // Ожидается: успешное извлечение правильного cookie.
 func TestGetTemporaryIdFromCookies_MultipleCookies(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	value := "test-temp-id"
 	req := httptest.NewRequest("GET", "/", nil)
 	req.AddCookie(&http.Cookie{
@@ -208,7 +223,7 @@ func TestGetTemporaryIdFromCookies_MultipleCookies(t *testing.T) {
 	})
 	req.AddCookie(&http.Cookie{
 		Name:  "temporaryId",
-		Value: value,
+		Value: signedTemporaryId(t, value),
 	})
 	req.AddCookie(&http.Cookie{
 		Name:  "anotherCookie",
@@ -246,8 +261,8 @@ func TestClearTemporaryIdInCookies(t *testing.T) {
 	if !cookie.HttpOnly {
 		t.Error("Expected cookie to be HttpOnly")
 	}
-	if cookie.Secure {
-		t.Error("Expected cookie Secure to be false")
+	if !cookie.Secure {
+		t.Error("Expected cookie Secure to be true")
 	}
 	if cookie.SameSite != http.SameSiteLaxMode {
 		t.Errorf("Expected SameSiteLaxMode, got %v", cookie.SameSite)
@@ -383,6 +398,8 @@ func TestClearCookiesDev_WithExistingCookies(t *testing.T) {
 // TestSetTemporaryIdInCookies_CookieProperties проверяет свойства устанавливаемого cookie.
 // Ожидается: корректные свойства cookie без домена и даты истечения.
 func TestSetTemporaryIdInCookies_CookieProperties(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	w := httptest.NewRecorder()
 	value := "test-value"
 	temporaryIdExp := 3600
@@ -407,10 +424,12 @@ func TestSetTemporaryIdInCookies_CookieProperties(t *testing.T) {
 // TestGetTemporaryIdFromCookies_CookieProperties проверяет свойства получаемого cookie.
 // Ожидается: корректные свойства cookie.
 func TestGetTemporaryIdFromCookies_CookieProperties(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
 	req := httptest.NewRequest("GET", "/", nil)
 	testCookie := &http.Cookie{
 		Name:  "temporaryId",
-		Value: "test-value",
+		Value: signedTemporaryId(t, "test-value"),
 	}
 	req.AddCookie(testCookie)
 
@@ -421,8 +440,8 @@ func TestGetTemporaryIdFromCookies_CookieProperties(t *testing.T) {
 	if cookie.Name != testCookie.Name {
 		t.Errorf("Expected name '%s', got '%s'", testCookie.Name, cookie.Name)
 	}
-	if cookie.Value != testCookie.Value {
-		t.Errorf("Expected value '%s', got '%s'", testCookie.Value, cookie.Value)
+	if cookie.Value != "test-value" {
+		t.Errorf("Expected value 'test-value', got '%s'", cookie.Value)
 	}
 }
 
@@ -449,3 +468,13 @@ func TestClearTemporaryIdInCookies_CookieProperties(t *testing.T) {
 		t.Errorf("Expected empty Domain, got '%s'", cookie.Domain)
 	}
 }
+
+// signedTemporaryId возвращает подписанное значение cookie с временным ID.
+func signedTemporaryId(t *testing.T, temporaryId string) string {
+	t.Helper()
+	signed, err := SignTemporaryId(temporaryId)
+	if err != nil {
+		t.Fatalf("SignTemporaryId: %v", err)
+	}
+	return signed
+}
@@ -20,7 +20,9 @@ import (
 	"crypto/x509"
 	"database/sql"
 	"os"
+	"time"
 
+	"github.com/gimaevra94/auth/app/structs"
 	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"golang.org/x/crypto/bcrypt"
@@ -32,7 +34,7 @@ const (
 	PermanentIdByLoginSelectQuery          = "select permanentId from login where login = ? and cancelled = false"
 	UniqueUserAgentsSelectQuery            = "select userAgent from temporary_id where permanentId = ?"
 	TemporaryIdSelectQuery                 = "select permanentId, userAgent from temporary_id where temporaryId = ?"
-	EmailSelectQuery                       = "select email from email where permanentId = ? and cancelled = false"
+	EmailSelectQuery                       = "select email from email where permanentId = ? and cancelled = false order by yauth limit 1"
 	RefreshTokenSelectQuery                = "select token from refresh_token where permanentId = ? and userAgent = ? and cancelled = false"
 	LoginUpdateQuery                       = "update login set cancelled = true where permanentId = ? and cancelled = false"
 	LoginInsertQuery                       = "insert into login (permanentId, login, cancelled) values (?, ?, ?)"
@@ -41,12 +43,14 @@ const (
 	PasswordHashUpdateQuery                = "update password_hash set cancelled = true where permanentId = ? and cancelled = false"
 	PasswordHashInsertQuery                = "insert into password_hash (permanentId, passwordHash, cancelled) values (?, ?, ?)"
 	TemporaryIdUpdateQuery                 = "update temporary_id set cancelled = true where permanentId = ? and userAgent = ? and yauth = ? and cancelled = false"
-	TemporaryIdInsertQuery                 = "insert into temporary_id (permanentId, temporaryId, userAgent,yauth,cancelled) values (?, ?, ?, ?, ?)"
+	TemporaryIdInsertQuery                 = "insert into temporary_id (permanentId, temporaryId, userAgent, yauth, rememberMe, createdAt, lastActivityAt, cancelled) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	TemporaryIdActivitySelectQuery         = "select rememberMe, yauth, createdAt, lastActivityAt from temporary_id where temporaryId = ? and cancelled = false"
+	TemporaryIdActivityUpdateQuery         = "update temporary_id set lastActivityAt = ? where temporaryId = ? and cancelled = false"
 	RefreshTokenUpdateQuery                = "update refresh_token set cancelled = true where permanentId = ? and userAgent = ? and yauth = ? and cancelled = false"
 	RefreshTokenInsertQuery                = "insert into refresh_token (permanentId, token, userAgent,yauth,cancelled) values (?, ?, ?, ?, ?)"
 	TemporaryIdCancelledUpdateQuery        = "update temporary_id set cancelled = true where permanentId = ? and userAgent = ? and cancelled = false"
 	RefreshTokenCancelledUpdateQuery       = "update refresh_token set cancelled = true where permanentId = ? and userAgent = ? and cancelled = false"
-	PasswordResetTokenInsertQuery          = "insert into reset_token (token, cancelled) values (?, ?)"
+	PasswordResetTokenInsertQuery          = "insert into reset_token (token, email, cancelled) values (?, ?, ?)"
 	IsOKPasswordHashInDbSelectQuery        = "select passwordHash from password_hash where permanentId = ? and cancelled = false"
 	PasswordResetTokenCancelledSelectQuery = "select cancelled from reset_token where token = ? and cancelled = false"
 	TemporaryIdCancelledSelectQuery        = "select cancelled from temporary_id where temporaryId = ? and cancelled = false"
@@ -176,6 +180,11 @@ func GetTemporaryIdKeysFromDb(temporaryId string) (string, string, error) {
 	return permanentId, userAgent, nil
 }
 
+// GetEmailFromDb получает действующий email пользователя.
+//
+// У аккаунта, созданного через Yandex, кроме email от Yandex (yauth = true) может быть
+// email для входа по паролю (yauth = false), который пользователь меняет в профиле;
+// в этом случае возвращается email для входа по паролю.
 func GetEmailFromDb(permamentId string) (string, error) {
 	row := Db.QueryRow(EmailSelectQuery, permamentId)
 	var email string
@@ -203,6 +212,9 @@ var SetLoginInDbTx = func(tx *sql.Tx, permanentId, login string) error {
 	}
 	_, err = tx.Exec(LoginInsertQuery, permanentId, login, false)
 	if err != nil {
+		if isDuplicateEntry(err) {
+			return errors.WithStack(ErrLoginAlreadyExist)
+		}
 		return errors.WithStack(err)
 	}
 	return nil
@@ -215,6 +227,9 @@ var SetEmailInDbTx = func(tx *sql.Tx, permanentId, email string, yauth bool) err
 	}
 	_, err = tx.Exec(EmailInsertQuery, permanentId, email, yauth, false)
 	if err != nil {
+		if isDuplicateEntry(err) {
+			return errors.WithStack(ErrEmailAlreadyExist)
+		}
 		return errors.WithStack(err)
 	}
 	return nil
@@ -248,12 +263,35 @@ var SetPasswordInDbTx = func(tx *sql.Tx, permanentId, password string) error {
 	return nil
 }
 
-var SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth bool) error {
+var SetTemporaryIdInDbTx = func(tx *sql.Tx, permanentId, temporaryId, userAgent string, yauth, rememberMe bool) error {
 	_, err := tx.Exec(TemporaryIdUpdateQuery, permanentId, userAgent, yauth)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	_, err = tx.Exec(TemporaryIdInsertQuery, permanentId, temporaryId, userAgent, yauth, false)
+	now := time.Now().Unix()
+	_, err = tx.Exec(TemporaryIdInsertQuery, permanentId, temporaryId, userAgent, yauth, rememberMe, now, now, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetTemporaryIdActivityFromDb получает параметры активности сессии по temporaryId.
+//
+// Возвращает флаг rememberMe, способ входа, время создания и время последней активности.
+var GetTemporaryIdActivityFromDb = func(temporaryId string) (structs.SessionActivity, error) {
+	row := Db.QueryRow(TemporaryIdActivitySelectQuery, temporaryId)
+	var activity structs.SessionActivity
+	err := row.Scan(&activity.RememberMe, &activity.Yauth, &activity.CreatedAt, &activity.LastActivityAt)
+	if err != nil {
+		return structs.SessionActivity{}, errors.WithStack(err)
+	}
+	return activity, nil
+}
+
+// SetTemporaryIdActivityInDbTx обновляет время последней активности сессии.
+var SetTemporaryIdActivityInDbTx = func(tx *sql.Tx, temporaryId string, lastActivityAt int64) error {
+	_, err := tx.Exec(TemporaryIdActivityUpdateQuery, lastActivityAt, temporaryId)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -288,8 +326,11 @@ var SetRefreshTokenCancelledInDbTx = func(tx *sql.Tx, permanentId, userAgent str
 	return nil
 }
 
-var SetPasswordResetTokenInDb = func(token string) error {
-	_, err := Db.Exec(PasswordResetTokenInsertQuery, token, false)
+// SetPasswordResetTokenInDb сохраняет токен ссылки сброса пароля, отправленной на email.
+//
+// По email токены выгружаются вместе с данными аккаунта и удаляются вместе с ним.
+var SetPasswordResetTokenInDb = func(token, email string) error {
+	_, err := Db.Exec(PasswordResetTokenInsertQuery, token, email, false)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -326,6 +367,9 @@ var IsPasswordResetTokenCancelled = func(token string) error {
 	return nil
 }
 
+// ErrPasswordInvalid возвращается IsOKPasswordHashInDb, если пароль не совпадает с хешем в БД.
+var ErrPasswordInvalid = errors.New("password invalid")
+
 var IsOKPasswordHashInDb = func(permanentId, password string) error {
 	row := Db.QueryRow(IsOKPasswordHashInDbSelectQuery, permanentId)
 	var passwordHash string
@@ -335,9 +379,7 @@ var IsOKPasswordHashInDb = func(permanentId, password string) error {
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)); err != nil {
-		err := errors.New("password invalid")
-		traceErr := errors.WithStack(err)
-		return errors.WithStack(traceErr)
+		return errors.WithStack(ErrPasswordInvalid)
 	}
 	return nil
 }
\ No newline at end of file
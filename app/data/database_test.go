@@ -10,6 +10,8 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -310,7 +312,8 @@ func TestGetRefreshTokenFromDb(t *testing.T) {
 }
 
 // TestSetLoginInDbTx проверяет установку логина в транзакции.
-// Ожидается: успешная транзакция, обработка ошибок при update и insert операциях.
+// Ожидается: успешная транзакция, обработка ошибок при update и insert операциях,
+// ErrLoginAlreadyExist при нарушении уникального индекса.
 func TestSetLoginInDbTx(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	require.NoError(t, err)
@@ -372,10 +375,31 @@ func TestSetLoginInDbTx(t *testing.T) {
 		tx.Rollback()
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("login already exists", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(LoginUpdateQuery).
+			WithArgs("perm123").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(LoginInsertQuery).
+			WithArgs("perm123", "newlogin", false).
+			WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateEntryErrorNumber, Message: "Duplicate entry"})
+		mock.ExpectRollback()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+
+		err = SetLoginInDbTx(tx, "perm123", "newlogin")
+		assert.ErrorIs(t, err, ErrLoginAlreadyExist)
+
+		tx.Rollback()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 // TestSetEmailInDbTx проверяет установку email в транзакции.
-// Ожидается: успешная транзакция, обработка ошибок при update и insert операциях.
+// Ожидается: успешная транзакция, обработка ошибок при update и insert операциях,
+// ErrEmailAlreadyExist при нарушении уникального индекса.
 func TestSetEmailInDbTx(t *testing.T) {
 	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
 	require.NoError(t, err)
@@ -437,6 +461,26 @@ func TestSetEmailInDbTx(t *testing.T) {
 		tx.Rollback()
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("email already exists", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.ExpectExec(EmailUpdateQuery).
+			WithArgs("perm123", false).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(EmailInsertQuery).
+			WithArgs("perm123", "email@example.com", false, false).
+			WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateEntryErrorNumber, Message: "Duplicate entry"})
+		mock.ExpectRollback()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+
+		err = SetEmailInDbTx(tx, "perm123", "email@example.com", false)
+		assert.ErrorIs(t, err, ErrEmailAlreadyExist)
+
+		tx.Rollback()
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 // TestSetEmailInDb проверяет установку email без транзакции.
@@ -568,14 +612,14 @@ func TestSetTemporaryIdInDbTx(t *testing.T) {
 			WithArgs("perm123", "Chrome", true).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectExec(TemporaryIdInsertQuery).
-			WithArgs("perm123", "temp123", "Chrome", true, false).
+			WithArgs("perm123", "temp123", "Chrome", true, true, sqlmock.AnyArg(), sqlmock.AnyArg(), false).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 		mock.ExpectCommit()
 
 		tx, err := db.Begin()
 		require.NoError(t, err)
 
-		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", true)
+		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", true, true)
 		assert.NoError(t, err)
 
 		tx.Commit()
@@ -592,7 +636,7 @@ func TestSetTemporaryIdInDbTx(t *testing.T) {
 		tx, err := db.Begin()
 		require.NoError(t, err)
 
-		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", false)
+		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", false, false)
 		assert.Error(t, err)
 
 		tx.Rollback()
@@ -605,14 +649,14 @@ func TestSetTemporaryIdInDbTx(t *testing.T) {
 			WithArgs("perm123", "Chrome", true).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectExec(TemporaryIdInsertQuery).
-			WithArgs("perm123", "temp123", "Chrome", true, false).
+			WithArgs("perm123", "temp123", "Chrome", true, true, sqlmock.AnyArg(), sqlmock.AnyArg(), false).
 			WillReturnError(sql.ErrConnDone)
 		mock.ExpectRollback()
 
 		tx, err := db.Begin()
 		require.NoError(t, err)
 
-		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", true)
+		err = SetTemporaryIdInDbTx(tx, "perm123", "temp123", "Chrome", true, true)
 		assert.Error(t, err)
 
 		tx.Rollback()
@@ -620,6 +664,63 @@ func TestSetTemporaryIdInDbTx(t *testing.T) {
 	})
 }
 
+// TestGetTemporaryIdActivityFromDb проверяет получение параметров активности сессии.
+// Ожидается: успешное чтение полей и обработка отсутствия записи.
+func TestGetTemporaryIdActivityFromDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	Db = db
+
+	t.Run("successful retrieval", func(t *testing.T) {
+		mock.ExpectQuery(TemporaryIdActivitySelectQuery).
+			WithArgs("temp123").
+			WillReturnRows(sqlmock.NewRows([]string{"rememberMe", "yauth", "createdAt", "lastActivityAt"}).AddRow(true, false, 100, 200))
+
+		activity, err := GetTemporaryIdActivityFromDb("temp123")
+		assert.NoError(t, err)
+		assert.Equal(t, structs.SessionActivity{RememberMe: true, Yauth: false, CreatedAt: 100, LastActivityAt: 200}, activity)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("no rows found", func(t *testing.T) {
+		mock.ExpectQuery(TemporaryIdActivitySelectQuery).
+			WithArgs("missing").
+			WillReturnError(sql.ErrNoRows)
+
+		_, err := GetTemporaryIdActivityFromDb("missing")
+		assert.Equal(t, sql.ErrNoRows, errors.Cause(err))
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+// TestSetTemporaryIdActivityInDbTx проверяет обновление времени активности сессии.
+// Ожидается: выполнение update в транзакции и обработка ошибок.
+func TestSetTemporaryIdActivityInDbTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(TemporaryIdActivityUpdateQuery).
+		WithArgs(int64(300), "temp123").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(TemporaryIdActivityUpdateQuery).
+		WithArgs(int64(301), "temp123").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	assert.NoError(t, SetTemporaryIdActivityInDbTx(tx, "temp123", 300))
+	assert.Error(t, SetTemporaryIdActivityInDbTx(tx, "temp123", 301))
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 // TestSetRefreshTokenInDbTx проверяет установку refresh токена в транзакции.
 // Ожидается: успешная транзакция, обработка ошибок при update и insert операциях.
 func TestSetRefreshTokenInDbTx(t *testing.T) {
@@ -780,20 +881,20 @@ func TestSetPasswordResetTokenInDb(t *testing.T) {
 
 	t.Run("successful operation", func(t *testing.T) {
 		mock.ExpectExec(PasswordResetTokenInsertQuery).
-			WithArgs("token123", false).
+			WithArgs("token123", "user@example.com", false).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
-		err := SetPasswordResetTokenInDb("token123")
+		err := SetPasswordResetTokenInDb("token123", "user@example.com")
 		assert.NoError(t, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 
 	t.Run("database error", func(t *testing.T) {
 		mock.ExpectExec(PasswordResetTokenInsertQuery).
-			WithArgs("errortoken").
+			WithArgs("errortoken", "user@example.com", false).
 			WillReturnError(sql.ErrConnDone)
 
-		err := SetPasswordResetTokenInDb("errortoken")
+		err := SetPasswordResetTokenInDb("errortoken", "user@example.com")
 		assert.Error(t, err)
 	})
 }
@@ -0,0 +1,57 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для учета неудачных попыток подтверждения:
+//   - GetFailedAttemptsFromDb: считает неудачные попытки пользователя за окно времени
+//   - SetFailedAttemptInDb: записывает неудачную попытку
+//   - DeleteFailedAttemptsFromDb: удаляет попытки пользователя после успешного подтверждения
+//
+// Попытки хранятся в БД, а не в сессии: сессии хранятся в cookie, и повтор
+// старой cookie сбрасывал бы счетчик.
+package data
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Виды подтверждений, для которых ограничено число неудачных попыток.
+const (
+	FailedAttemptCurrentPassword = "currentPassword"
+	FailedAttemptEmailChangeCode = "emailChangeCode"
+	FailedAttemptSignInCode      = "signInCode"
+)
+
+// SQL-запросы для работы с таблицей неудачных попыток
+const (
+	FailedAttemptsSelectQuery = "select count(*), coalesce(min(attemptedAt), 0) from failed_attempt where permanentId = ? and kind = ? and attemptedAt > ?"
+	FailedAttemptInsertQuery  = "insert into failed_attempt (permanentId, kind, attemptedAt) values (?, ?, ?)"
+	FailedAttemptsDeleteQuery = "delete from failed_attempt where permanentId = ? and kind = ?"
+)
+
+// GetFailedAttemptsFromDb считает неудачные попытки вида kind после since.
+//
+// Возвращает количество попыток и время самой ранней из них (unix-время, 0 если попыток не было).
+var GetFailedAttemptsFromDb = func(permanentId, kind string, since int64) (int, int64, error) {
+	row := Db.QueryRow(FailedAttemptsSelectQuery, permanentId, kind, since)
+	var count int
+	var firstAt int64
+	if err := row.Scan(&count, &firstAt); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	return count, firstAt, nil
+}
+
+// SetFailedAttemptInDb записывает неудачную попытку вида kind.
+var SetFailedAttemptInDb = func(permanentId, kind string, attemptedAt int64) error {
+	if _, err := Db.Exec(FailedAttemptInsertQuery, permanentId, kind, attemptedAt); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// DeleteFailedAttemptsFromDb удаляет неудачные попытки вида kind.
+var DeleteFailedAttemptsFromDb = func(permanentId, kind string) error {
+	if _, err := Db.Exec(FailedAttemptsDeleteQuery, permanentId, kind); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
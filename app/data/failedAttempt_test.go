@@ -0,0 +1,49 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл тестирует функции учета неудачных попыток подтверждения.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestFailedAttempts проверяет учет неудачных попыток.
+// Ожидается: попытки считаются за окно с временем самой ранней, запись и удаление
+// выполняются по пользователю и виду попытки, ошибки БД возвращаются.
+func TestFailedAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	Db = db
+
+	mock.ExpectQuery(FailedAttemptsSelectQuery).
+		WithArgs("permanent-123", FailedAttemptCurrentPassword, int64(1000)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "firstAt"}).AddRow(3, 1100))
+	count, firstAt, err := GetFailedAttemptsFromDb("permanent-123", FailedAttemptCurrentPassword, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.Equal(t, int64(1100), firstAt)
+
+	mock.ExpectExec(FailedAttemptInsertQuery).
+		WithArgs("permanent-123", FailedAttemptEmailChangeCode, int64(2000)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	assert.NoError(t, SetFailedAttemptInDb("permanent-123", FailedAttemptEmailChangeCode, 2000))
+
+	mock.ExpectExec(FailedAttemptsDeleteQuery).
+		WithArgs("permanent-123", FailedAttemptEmailChangeCode).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	assert.NoError(t, DeleteFailedAttemptsFromDb("permanent-123", FailedAttemptEmailChangeCode))
+
+	mock.ExpectQuery(FailedAttemptsSelectQuery).
+		WithArgs("permanent-123", FailedAttemptCurrentPassword, int64(1000)).
+		WillReturnError(sql.ErrConnDone)
+	_, _, err = GetFailedAttemptsFromDb("permanent-123", FailedAttemptCurrentPassword, 1000)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,114 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для работы с приглашениями на регистрацию:
+//   - SetInviteInDbTx: создает приглашение
+//   - GetInviteFromDb: получает приглашение по коду
+//   - GetInvitesFromDb: получает последние созданные приглашения
+//   - SetInviteUsedInDbTx: отмечает приглашение использованным
+//   - SetInviteCancelledInDbTx: отзывает приглашение
+//
+// Приглашение одноразовое: код можно использовать один раз до истечения срока действия,
+// если оно не отозвано. Приглашение с email действует только для этого адреса.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// ErrInviteUnavailable возвращается, если приглашение уже использовано, отозвано или истекло.
+var ErrInviteUnavailable = errors.New("invite is used, cancelled or expired")
+
+// invitesLimit ограничивает число приглашений на странице администратора.
+const invitesLimit = 50
+
+// SQL-запросы для приглашений
+const (
+	InviteInsertQuery       = "insert into invite (code, email, createdBy, createdAt, expiresAt, usedBy, usedAt, cancelled) values (?, ?, ?, ?, ?, ?, ?, ?)"
+	InviteSelectQuery       = "select code, email, createdBy, createdAt, expiresAt, usedBy, usedAt, cancelled from invite where code = ?"
+	InvitesSelectQuery      = "select code, email, createdBy, createdAt, expiresAt, usedBy, usedAt, cancelled from invite order by createdAt desc limit ?"
+	InviteUseUpdateQuery    = "update invite set usedBy = ?, usedAt = ? where code = ? and usedAt = 0 and cancelled = false and (expiresAt = 0 or expiresAt > ?)"
+	InviteCancelUpdateQuery = "update invite set cancelled = true where code = ? and usedAt = 0 and cancelled = false"
+)
+
+// scanInvite читает строку приглашения в порядке столбцов запросов InviteSelectQuery и InvitesSelectQuery.
+func scanInvite(scan func(dest ...interface{}) error) (structs.Invite, error) {
+	var invite structs.Invite
+	err := scan(&invite.Code, &invite.Email, &invite.CreatedBy, &invite.CreatedAt, &invite.ExpiresAt, &invite.UsedBy, &invite.UsedAt, &invite.Cancelled)
+	return invite, err
+}
+
+// SetInviteInDbTx создает приглашение.
+//
+// Пустой Email означает приглашение для любого адреса, нулевой ExpiresAt - бессрочное.
+var SetInviteInDbTx = func(tx *sql.Tx, invite structs.Invite) error {
+	_, err := tx.Exec(InviteInsertQuery, invite.Code, invite.Email, invite.CreatedBy, invite.CreatedAt, invite.ExpiresAt, "", 0, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetInviteFromDb получает приглашение по коду.
+//
+// Возвращает sql.ErrNoRows, если приглашения нет.
+var GetInviteFromDb = func(code string) (structs.Invite, error) {
+	invite, err := scanInvite(Db.QueryRow(InviteSelectQuery, code).Scan)
+	if err != nil {
+		return structs.Invite{}, errors.WithStack(err)
+	}
+	return invite, nil
+}
+
+// GetInvitesFromDb получает не более invitesLimit последних созданных приглашений.
+var GetInvitesFromDb = func() ([]structs.Invite, error) {
+	rows, err := Db.Query(InvitesSelectQuery, invitesLimit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var invites []structs.Invite
+	for rows.Next() {
+		invite, err := scanInvite(rows.Scan)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return invites, nil
+}
+
+// SetInviteUsedInDbTx отмечает приглашение использованным аккаунтом permanentId на момент now.
+//
+// Проверка и отметка выполняются одним запросом, поэтому один код не может быть
+// использован дважды при одновременной регистрации.
+// Возвращает ErrInviteUnavailable, если приглашение уже использовано, отозвано или истекло.
+var SetInviteUsedInDbTx = func(tx *sql.Tx, code, permanentId string, now int64) error {
+	result, err := tx.Exec(InviteUseUpdateQuery, permanentId, now, code, now)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return errors.WithStack(ErrInviteUnavailable)
+	}
+	return nil
+}
+
+// SetInviteCancelledInDbTx отзывает неиспользованное приглашение.
+var SetInviteCancelledInDbTx = func(tx *sql.Tx, code string) error {
+	_, err := tx.Exec(InviteCancelUpdateQuery, code)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
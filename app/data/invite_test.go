@@ -0,0 +1,81 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с приглашениями на регистрацию.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inviteColumns - столбцы запросов InviteSelectQuery и InvitesSelectQuery.
+var inviteColumns = []string{"code", "email", "createdBy", "createdAt", "expiresAt", "usedBy", "usedAt", "cancelled"}
+
+// TestGetInviteFromDb проверяет получение приглашения по коду.
+// Ожидается: приглашение читается целиком, отсутствующий код возвращает sql.ErrNoRows.
+func TestGetInviteFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(InviteSelectQuery).WithArgs("code1").
+		WillReturnRows(sqlmock.NewRows(inviteColumns).AddRow("code1", "user@example.com", "admin1", 100, 200, "", 0, false))
+	mock.ExpectQuery(InviteSelectQuery).WithArgs("missing").WillReturnRows(sqlmock.NewRows(inviteColumns))
+
+	invite, err := GetInviteFromDb("code1")
+	assert.NoError(t, err)
+	assert.Equal(t, structs.Invite{Code: "code1", Email: "user@example.com", CreatedBy: "admin1", CreatedAt: 100, ExpiresAt: 200}, invite)
+
+	_, err = GetInviteFromDb("missing")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetInvitesFromDb проверяет получение последних приглашений.
+// Ожидается: приглашения возвращаются в порядке запроса с ограничением invitesLimit.
+func TestGetInvitesFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(InvitesSelectQuery).WithArgs(invitesLimit).
+		WillReturnRows(sqlmock.NewRows(inviteColumns).
+			AddRow("code2", "", "admin1", 200, 0, "perm123", 300, false).
+			AddRow("code1", "", "admin1", 100, 0, "", 0, true))
+
+	invites, err := GetInvitesFromDb()
+	assert.NoError(t, err)
+	assert.Equal(t, []structs.Invite{
+		{Code: "code2", CreatedBy: "admin1", CreatedAt: 200, UsedBy: "perm123", UsedAt: 300},
+		{Code: "code1", CreatedBy: "admin1", CreatedAt: 100, Cancelled: true},
+	}, invites)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestInviteQueries проверяет создание, использование и отзыв приглашения.
+// Ожидается: повторное использование возвращает ErrInviteUnavailable.
+func TestInviteQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(InviteInsertQuery).WithArgs("code1", "user@example.com", "admin1", int64(100), int64(200), "", 0, false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(InviteUseUpdateQuery).WithArgs("perm123", int64(150), "code1", int64(150)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(InviteUseUpdateQuery).WithArgs("perm456", int64(160), "code1", int64(160)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(InviteCancelUpdateQuery).WithArgs("code2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	invite := structs.Invite{Code: "code1", Email: "user@example.com", CreatedBy: "admin1", CreatedAt: 100, ExpiresAt: 200}
+	assert.NoError(t, SetInviteInDbTx(tx, invite))
+	assert.NoError(t, SetInviteUsedInDbTx(tx, "code1", "perm123", 150))
+	assert.ErrorIs(t, SetInviteUsedInDbTx(tx, "code1", "perm456", 160), ErrInviteUnavailable)
+	assert.NoError(t, SetInviteCancelledInDbTx(tx, "code2"))
+	require.NoError(t, tx.Commit())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
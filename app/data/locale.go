@@ -0,0 +1,78 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для языка интерфейса, выбранного пользователем:
+//   - GetUserLocaleFromDb: получает язык пользователя
+//   - SetUserLocaleInDb: сохраняет язык пользователя
+//   - GetLocaleFromCookies: получает язык из cookie
+//   - SetLocaleInCookies: сохраняет язык в cookie
+//
+// Язык из профиля хранится в user_locale и переносится в cookie при входе,
+// поэтому страницы не обращаются к БД, чтобы выбрать язык.
+package data
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для языка пользователя
+const (
+	UserLocaleSelectQuery = "select locale from user_locale where permanentId = ?"
+	UserLocaleUpsertQuery = "insert into user_locale (permanentId, locale) values (?, ?) on duplicate key update locale = values(locale)"
+)
+
+// localeCookieName - имя cookie с языком интерфейса (без префикса __Host-).
+const localeCookieName = "locale"
+
+// localeCookieExp - время жизни cookie с языком в секундах (1 год).
+const localeCookieExp = 365 * 24 * 60 * 60
+
+// GetUserLocaleFromDb получает язык, выбранный пользователем в профиле.
+//
+// Возвращает пустую строку, если пользователь язык не выбирал.
+var GetUserLocaleFromDb = func(permanentId string) (string, error) {
+	var locale string
+	if err := Db.QueryRow(UserLocaleSelectQuery, permanentId).Scan(&locale); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", errors.WithStack(err)
+	}
+	return locale, nil
+}
+
+// SetUserLocaleInDb сохраняет язык пользователя, заменяя выбранный ранее.
+var SetUserLocaleInDb = func(permanentId, locale string) error {
+	if _, err := Db.Exec(UserLocaleUpsertQuery, permanentId, locale); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetLocaleFromCookies получает язык из cookie или пустую строку, если cookie нет.
+func GetLocaleFromCookies(r *http.Request) string {
+	cookie, err := r.Cookie(cookieName(loadCookieConfig(), localeCookieName))
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// SetLocaleInCookies сохраняет язык в cookie на год.
+//
+// Флаги Secure, SameSite, домен и префикс __Host- берутся из настроек cookie.
+var SetLocaleInCookies = func(w http.ResponseWriter, locale string) {
+	config := loadCookieConfig()
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName(config, localeCookieName),
+		Path:     "/",
+		Domain:   config.domain,
+		HttpOnly: true,
+		Secure:   config.secure,
+		SameSite: config.sameSite,
+		Value:    locale,
+		MaxAge:   localeCookieExp,
+	})
+}
@@ -0,0 +1,75 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с языком пользователя.
+package data
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetUserLocaleFromDb проверяет получение языка пользователя.
+// Ожидается: сохраненный язык, пустая строка без выбора языка, ошибка БД возвращается.
+func TestGetUserLocaleFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(UserLocaleSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"locale"}).AddRow("ru"))
+	mock.ExpectQuery(UserLocaleSelectQuery).WithArgs("perm123").WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(UserLocaleSelectQuery).WithArgs("perm123").WillReturnError(sql.ErrConnDone)
+
+	locale, err := GetUserLocaleFromDb("perm123")
+	require.NoError(t, err)
+	assert.Equal(t, "ru", locale)
+
+	locale, err = GetUserLocaleFromDb("perm123")
+	require.NoError(t, err)
+	assert.Empty(t, locale)
+
+	_, err = GetUserLocaleFromDb("perm123")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetUserLocaleInDb проверяет сохранение языка пользователя.
+// Ожидается: язык записывается запросом с заменой, ошибка БД возвращается.
+func TestSetUserLocaleInDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectExec(UserLocaleUpsertQuery).WithArgs("perm123", "ru").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(UserLocaleUpsertQuery).WithArgs("perm123", "en").WillReturnError(sql.ErrConnDone)
+
+	assert.NoError(t, SetUserLocaleInDb("perm123", "ru"))
+	assert.Error(t, SetUserLocaleInDb("perm123", "en"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestLocaleCookies проверяет cookie с языком интерфейса.
+// Ожидается: cookie на год с общими флагами, значение читается обратно, без cookie - пустая строка.
+func TestLocaleCookies(t *testing.T) {
+	t.Setenv("COOKIE_HOST_PREFIX", "true")
+	w := httptest.NewRecorder()
+	SetLocaleInCookies(w, "ru")
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "__Host-locale", cookies[0].Name)
+	assert.Equal(t, "ru", cookies[0].Value)
+	assert.Equal(t, "/", cookies[0].Path)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, localeCookieExp, cookies[0].MaxAge)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Empty(t, GetLocaleFromCookies(r))
+	r.AddCookie(cookies[0])
+	assert.Equal(t, "ru", GetLocaleFromCookies(r))
+}
@@ -0,0 +1,103 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для настроек уведомлений пользователя:
+//   - GetNotificationSettingsFromDb: получает сохраненные настройки уведомлений
+//   - SetNotificationSettingInDbTx: сохраняет настройку уведомления
+//   - GetSecurityDigestRecipientsFromDb: получает пользователей, которым пора отправить сводку
+//   - SetSecurityDigestSentInDb: отмечает отправку сводки
+//
+// В notification_setting хранятся только настройки, которые пользователь менял;
+// для остальных действуют значения по умолчанию (см. auth.notificationSettings).
+package data
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// Виды уведомлений
+const (
+	NotificationNewDeviceLogin  = "newDeviceLogin"
+	NotificationSuspiciousLogin = "suspiciousLogin"
+	NotificationPasswordChange  = "passwordChange"
+	NotificationEmailChange     = "emailChange"
+	NotificationSecurityDigest  = "securityDigest"
+
+	NotificationPasswordResetRequest = "passwordResetRequest"
+	NotificationOAuthLink            = "oauthLink"
+	NotificationSessionRevoke        = "sessionRevoke"
+	NotificationAccountLock          = "accountLock"
+)
+
+// SQL-запросы для настроек уведомлений
+const (
+	NotificationSettingsSelectQuery     = "select setting, enabled from notification_setting where permanentId = ?"
+	NotificationSettingUpsertQuery      = "insert into notification_setting (permanentId, setting, enabled) values (?, ?, ?) on duplicate key update enabled = values(enabled)"
+	SecurityDigestRecipientsSelectQuery = "select n.permanentId from notification_setting n left join security_digest d on d.permanentId = n.permanentId where n.setting = ? and n.enabled = true and (d.sentAt is null or d.sentAt <= ?)"
+	SecurityDigestUpsertQuery           = "insert into security_digest (permanentId, sentAt) values (?, ?) on duplicate key update sentAt = values(sentAt)"
+)
+
+// GetNotificationSettingsFromDb получает настройки уведомлений, сохраненные пользователем.
+//
+// Возвращает вид уведомления и признак включения; виды, которые пользователь не менял, отсутствуют.
+var GetNotificationSettingsFromDb = func(permanentId string) (map[string]bool, error) {
+	rows, err := Db.Query(NotificationSettingsSelectQuery, permanentId)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	settings := map[string]bool{}
+	for rows.Next() {
+		var setting string
+		var enabled bool
+		if err := rows.Scan(&setting, &enabled); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		settings[setting] = enabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return settings, nil
+}
+
+// SetNotificationSettingInDbTx включает или отключает уведомление вида setting.
+var SetNotificationSettingInDbTx = func(tx *sql.Tx, permanentId, setting string, enabled bool) error {
+	if _, err := tx.Exec(NotificationSettingUpsertQuery, permanentId, setting, enabled); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetSecurityDigestRecipientsFromDb получает пользователей, включивших еженедельную сводку,
+// которым сводка не отправлялась или отправлялась не позже sentBefore.
+var GetSecurityDigestRecipientsFromDb = func(sentBefore int64) ([]string, error) {
+	rows, err := Db.Query(SecurityDigestRecipientsSelectQuery, NotificationSecurityDigest, sentBefore)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var permanentIds []string
+	for rows.Next() {
+		var permanentId string
+		if err := rows.Scan(&permanentId); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		permanentIds = append(permanentIds, permanentId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return permanentIds, nil
+}
+
+// SetSecurityDigestSentInDb отмечает, что сводка пользователю отправлена в sentAt.
+var SetSecurityDigestSentInDb = func(permanentId string, sentAt int64) error {
+	if _, err := Db.Exec(SecurityDigestUpsertQuery, permanentId, sentAt); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
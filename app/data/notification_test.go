@@ -0,0 +1,93 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с настройками уведомлений.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetNotificationSettingsFromDb проверяет получение настроек уведомлений.
+// Ожидается: сохраненные настройки, пустой список без изменений, ошибка БД возвращается.
+func TestGetNotificationSettingsFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(NotificationSettingsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"setting", "enabled"}).
+			AddRow(NotificationNewDeviceLogin, false).
+			AddRow(NotificationSecurityDigest, true))
+	mock.ExpectQuery(NotificationSettingsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"setting", "enabled"}))
+	mock.ExpectQuery(NotificationSettingsSelectQuery).WithArgs("perm123").WillReturnError(sql.ErrConnDone)
+
+	settings, err := GetNotificationSettingsFromDb("perm123")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{NotificationNewDeviceLogin: false, NotificationSecurityDigest: true}, settings)
+
+	settings, err = GetNotificationSettingsFromDb("perm123")
+	require.NoError(t, err)
+	assert.Empty(t, settings)
+
+	_, err = GetNotificationSettingsFromDb("perm123")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetNotificationSettingInDbTx проверяет сохранение настройки уведомления.
+// Ожидается: настройка записывается запросом с заменой, ошибка БД возвращается.
+func TestSetNotificationSettingInDbTx(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(NotificationSettingUpsertQuery).WithArgs("perm123", NotificationNewDeviceLogin, false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(NotificationSettingUpsertQuery).WithArgs("perm123", NotificationSecurityDigest, true).
+		WillReturnError(sql.ErrConnDone)
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetNotificationSettingInDbTx(tx, "perm123", NotificationNewDeviceLogin, false))
+	assert.Error(t, SetNotificationSettingInDbTx(tx, "perm123", NotificationSecurityDigest, true))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetSecurityDigestRecipientsFromDb проверяет получение получателей сводки.
+// Ожидается: пользователи, включившие сводку, ошибка БД возвращается.
+func TestGetSecurityDigestRecipientsFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(SecurityDigestRecipientsSelectQuery).WithArgs(NotificationSecurityDigest, int64(100)).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm1").AddRow("perm2"))
+	mock.ExpectQuery(SecurityDigestRecipientsSelectQuery).WithArgs(NotificationSecurityDigest, int64(100)).
+		WillReturnError(sql.ErrConnDone)
+
+	permanentIds, err := GetSecurityDigestRecipientsFromDb(100)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"perm1", "perm2"}, permanentIds)
+
+	_, err = GetSecurityDigestRecipientsFromDb(100)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetSecurityDigestSentInDb проверяет отметку об отправке сводки.
+// Ожидается: время отправки записывается запросом с заменой, ошибка БД возвращается.
+func TestSetSecurityDigestSentInDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectExec(SecurityDigestUpsertQuery).WithArgs("perm123", int64(200)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(SecurityDigestUpsertQuery).WithArgs("perm123", int64(300)).WillReturnError(sql.ErrConnDone)
+
+	assert.NoError(t, SetSecurityDigestSentInDb("perm123", 200))
+	assert.Error(t, SetSecurityDigestSentInDb("perm123", 300))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,137 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для очереди исходящих писем:
+//   - SetOutboxMailInDb: добавляет письмо в очередь
+//   - ClaimOutboxMailsFromDb: выбирает письма, готовые к отправке, и блокирует их за обработчиком
+//   - SetOutboxMailSentInDb: отмечает письмо отправленным
+//   - SetOutboxMailFailedInDb: откладывает письмо до следующей попытки или переводит в dead
+//
+// Письмо идентифицируется ключом идемпотентности, а одинаковые письма - хешем содержимого:
+// письмо не добавляется, если такое же было добавлено после заданного момента. Письма
+// со статусом dead не отправляются и остаются в таблице без текста, но с последней ошибкой для разбора.
+package data
+
+import (
+	"unicode/utf8"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Статусы писем в очереди.
+const (
+	OutboxStatusPending = "pending"
+	OutboxStatusSent    = "sent"
+	OutboxStatusDead    = "dead"
+)
+
+// outboxLastErrorMaxLen ограничивает длину текста ошибки в символах (столбец lastError VARCHAR(255)).
+const outboxLastErrorMaxLen = 255
+
+// SQL-запросы для очереди писем
+const (
+	OutboxMailInsertQuery       = "insert ignore into mail_outbox (idempotencyKey, contentHash, sender, recipient, subject, message, status, attempts, nextAttemptAt, lockedUntil, lastError, createdAt, sentAt) select ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ? from dual where not exists (select 1 from mail_outbox where contentHash = ? and createdAt > ?)"
+	OutboxMailsClaimSelectQuery = "select idempotencyKey, sender, recipient, subject, message, attempts, createdAt from mail_outbox where status = ? and nextAttemptAt <= ? and lockedUntil <= ? order by nextAttemptAt limit ? for update skip locked"
+	OutboxMailLockUpdateQuery   = "update mail_outbox set lockedUntil = ? where idempotencyKey = ?"
+	OutboxMailSentUpdateQuery   = "update mail_outbox set status = ?, attempts = ?, lockedUntil = 0, lastError = '', message = '', sentAt = ? where idempotencyKey = ?"
+	OutboxMailFailedUpdateQuery = "update mail_outbox set status = ?, attempts = ?, nextAttemptAt = ?, lockedUntil = 0, lastError = ? where idempotencyKey = ?"
+	OutboxMailDeadUpdateQuery   = "update mail_outbox set status = ?, attempts = ?, nextAttemptAt = ?, lockedUntil = 0, lastError = ?, message = '' where idempotencyKey = ?"
+)
+
+// SetOutboxMailInDb добавляет письмо в очередь для отправки с момента mail.CreatedAt.
+//
+// Если письмо с тем же ключом идемпотентности или с тем же хешем содержимого, добавленное
+// позже since, уже есть, ничего не меняется. Проверка скользящая, поэтому одинаковые письма
+// по разные стороны любой границы времени тоже считаются одним. Если InnoDB откатил вставку
+// из-за взаимной блокировки с такой же одновременной вставкой, письмо тоже считается дубликатом.
+var SetOutboxMailInDb = func(mail structs.OutboxMail, since int64) error {
+	_, err := Db.Exec(OutboxMailInsertQuery, mail.IdempotencyKey, mail.ContentHash, mail.Sender, mail.Recipient, mail.Subject, mail.Message,
+		OutboxStatusPending, 0, mail.CreatedAt, 0, "", mail.CreatedAt, 0, mail.ContentHash, since)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDeadlockErrorNumber {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ClaimOutboxMailsFromDb выбирает не более limit писем, время отправки которых наступило к now,
+// и блокирует их до lockedUntil.
+//
+// Строки, выбранные другим обработчиком, пропускаются, поэтому несколько обработчиков
+// не отправляют одно письмо одновременно. Если обработчик не отметил результат
+// до lockedUntil, письмо снова становится доступным.
+var ClaimOutboxMailsFromDb = func(now, lockedUntil int64, limit int) ([]structs.OutboxMail, error) {
+	tx, err := Db.Begin()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	rows, err := tx.Query(OutboxMailsClaimSelectQuery, OutboxStatusPending, now, now, limit)
+	if err != nil {
+		tx.Rollback()
+		return nil, errors.WithStack(err)
+	}
+
+	var mails []structs.OutboxMail
+	for rows.Next() {
+		var mail structs.OutboxMail
+		if err := rows.Scan(&mail.IdempotencyKey, &mail.Sender, &mail.Recipient, &mail.Subject, &mail.Message, &mail.Attempts, &mail.CreatedAt); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, errors.WithStack(err)
+		}
+		mails = append(mails, mail)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		tx.Rollback()
+		return nil, errors.WithStack(err)
+	}
+	rows.Close()
+
+	for _, mail := range mails {
+		if _, err := tx.Exec(OutboxMailLockUpdateQuery, lockedUntil, mail.IdempotencyKey); err != nil {
+			tx.Rollback()
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, errors.WithStack(err)
+	}
+	return mails, nil
+}
+
+// SetOutboxMailSentInDb отмечает письмо отправленным с попытки attempts.
+//
+// Текст письма удаляется: в нем могут быть коды и ссылки для входа.
+var SetOutboxMailSentInDb = func(idempotencyKey string, attempts int, now int64) error {
+	if _, err := Db.Exec(OutboxMailSentUpdateQuery, OutboxStatusSent, attempts, now, idempotencyKey); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetOutboxMailFailedInDb сохраняет неудачную попытку attempts с ошибкой lastError.
+//
+// Со статусом OutboxStatusPending письмо будет отправлено снова после nextAttemptAt,
+// со статусом OutboxStatusDead больше не отправляется, и его текст удаляется.
+// Ошибка обрезается до outboxLastErrorMaxLen символов, не разрывая многобайтовые символы.
+var SetOutboxMailFailedInDb = func(idempotencyKey, status string, attempts int, nextAttemptAt int64, lastError string) error {
+	if utf8.RuneCountInString(lastError) > outboxLastErrorMaxLen {
+		lastError = string([]rune(lastError)[:outboxLastErrorMaxLen])
+	}
+	query := OutboxMailFailedUpdateQuery
+	if status == OutboxStatusDead {
+		query = OutboxMailDeadUpdateQuery
+	}
+	if _, err := Db.Exec(query, status, attempts, nextAttemptAt, lastError, idempotencyKey); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
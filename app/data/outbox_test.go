@@ -0,0 +1,90 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции очереди исходящих писем.
+package data
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestSetOutboxMailInDb проверяет добавление письма в очередь.
+// Ожидается: письмо добавляется со статусом pending и временем отправки createdAt,
+// если с since не было письма с тем же хешем содержимого; взаимная блокировка
+// с такой же вставкой считается дубликатом, другие ошибки возвращаются.
+func TestSetOutboxMailInDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mail := structs.OutboxMail{IdempotencyKey: "key1", ContentHash: "hash1", Sender: "server@example.com", Recipient: "user@example.com", Subject: "Subject", Message: []byte("msg"), CreatedAt: 100}
+	args := []driver.Value{"key1", "hash1", "server@example.com", "user@example.com", "Subject", []byte("msg"), OutboxStatusPending, 0, int64(100), 0, "", int64(100), 0, "hash1", int64(40)}
+	mock.ExpectExec(OutboxMailInsertQuery).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(OutboxMailInsertQuery).WithArgs(args...).
+		WillReturnError(&mysql.MySQLError{Number: mysqlDeadlockErrorNumber, Message: "Deadlock found"})
+	mock.ExpectExec(OutboxMailInsertQuery).WithArgs(args...).WillReturnError(sql.ErrConnDone)
+
+	assert.NoError(t, SetOutboxMailInDb(mail, 40))
+	assert.NoError(t, SetOutboxMailInDb(mail, 40))
+	assert.ErrorIs(t, SetOutboxMailInDb(mail, 40), sql.ErrConnDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestClaimOutboxMailsFromDb проверяет выбор писем для отправки.
+// Ожидается: выбранные письма блокируются до lockedUntil в одной транзакции,
+// при ошибке блокировки транзакция откатывается.
+func TestClaimOutboxMailsFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	columns := []string{"idempotencyKey", "sender", "recipient", "subject", "message", "attempts", "createdAt"}
+	mock.ExpectBegin()
+	mock.ExpectQuery(OutboxMailsClaimSelectQuery).WithArgs(OutboxStatusPending, int64(100), int64(100), 10).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow("key1", "server@example.com", "user@example.com", "Subject", []byte("msg1"), 0, 90).
+			AddRow("key2", "server@example.com", "other@example.com", "Subject", []byte("msg2"), 2, 50))
+	mock.ExpectExec(OutboxMailLockUpdateQuery).WithArgs(int64(700), "key1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(OutboxMailLockUpdateQuery).WithArgs(int64(700), "key2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mails, err := ClaimOutboxMailsFromDb(100, 700, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []structs.OutboxMail{
+		{IdempotencyKey: "key1", Sender: "server@example.com", Recipient: "user@example.com", Subject: "Subject", Message: []byte("msg1"), Attempts: 0, CreatedAt: 90},
+		{IdempotencyKey: "key2", Sender: "server@example.com", Recipient: "other@example.com", Subject: "Subject", Message: []byte("msg2"), Attempts: 2, CreatedAt: 50},
+	}, mails)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(OutboxMailsClaimSelectQuery).WithArgs(OutboxStatusPending, int64(100), int64(100), 10).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow("key1", "server@example.com", "user@example.com", "Subject", []byte("msg1"), 0, 90))
+	mock.ExpectExec(OutboxMailLockUpdateQuery).WithArgs(int64(700), "key1").WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	_, err = ClaimOutboxMailsFromDb(100, 700, 10)
+	assert.ErrorIs(t, err, sql.ErrConnDone)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestOutboxMailResultQueries проверяет сохранение результата отправки.
+// Ожидается: отправленное письмо отмечается sent, у неотправленного сохраняется
+// время следующей попытки и обрезанный по символам текст ошибки, у dead удаляется текст письма.
+func TestOutboxMailResultQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	longError := strings.Repeat("ошибка", outboxLastErrorMaxLen)
+	mock.ExpectExec(OutboxMailSentUpdateQuery).WithArgs(OutboxStatusSent, 1, int64(100), "key1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(OutboxMailFailedUpdateQuery).WithArgs(OutboxStatusPending, 2, int64(220), "smtp error", "key2").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(OutboxMailDeadUpdateQuery).WithArgs(OutboxStatusDead, 8, int64(300), string([]rune(longError)[:outboxLastErrorMaxLen]), "key3").WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, SetOutboxMailSentInDb("key1", 1, 100))
+	assert.NoError(t, SetOutboxMailFailedInDb("key2", OutboxStatusPending, 2, 220, "smtp error"))
+	assert.NoError(t, SetOutboxMailFailedInDb("key3", OutboxStatusDead, 8, 300, longError))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,76 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для номера телефона пользователя:
+//   - GetPhoneFromDb: получает подтвержденный номер телефона пользователя
+//   - GetPermanentIdFromDbByPhone: получает permanentId по номеру телефона
+//   - SetPhoneInDbTx: сохраняет подтвержденный номер телефона
+//   - SetPhoneCancelledInDbTx: удаляет номер телефона из профиля
+//
+// В таблице phone хранятся только подтвержденные кодом из SMS номера в формате E.164,
+// прежние номера помечаются cancelled, как прежние email в таблице email.
+// Действующий номер уникален (индекс по столбцу activePhone), поэтому один номер
+// не могут одновременно подтвердить два пользователя.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для номера телефона
+const (
+	PhoneSelectQuery              = "select phone from phone where permanentId = ? and cancelled = false"
+	PermanentIdByPhoneSelectQuery = "select permanentId from phone where phone = ? and cancelled = false"
+	PhoneCancelledUpdateQuery     = "update phone set cancelled = true where permanentId = ? and cancelled = false"
+	PhoneInsertQuery              = "insert into phone (permanentId, phone, cancelled) values (?, ?, ?)"
+)
+
+// ErrPhoneAlreadyExist возвращается, если номер уже подтвержден другим пользователем.
+var ErrPhoneAlreadyExist = errors.New("phone already exists")
+
+// GetPhoneFromDb получает подтвержденный номер телефона пользователя.
+//
+// Возвращает sql.ErrNoRows, если номер не указан.
+var GetPhoneFromDb = func(permanentId string) (string, error) {
+	var phone string
+	if err := Db.QueryRow(PhoneSelectQuery, permanentId).Scan(&phone); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return phone, nil
+}
+
+// GetPermanentIdFromDbByPhone получает permanentId пользователя, подтвердившего номер phone.
+//
+// Возвращает sql.ErrNoRows, если номер никому не принадлежит.
+var GetPermanentIdFromDbByPhone = func(phone string) (string, error) {
+	var permanentId string
+	if err := Db.QueryRow(PermanentIdByPhoneSelectQuery, phone).Scan(&permanentId); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return permanentId, nil
+}
+
+// SetPhoneInDbTx сохраняет подтвержденный номер телефона, прежний номер помечается cancelled.
+//
+// Возвращает ErrPhoneAlreadyExist, если номер уже подтвержден другим пользователем.
+var SetPhoneInDbTx = func(tx *sql.Tx, permanentId, phone string) error {
+	if _, err := tx.Exec(PhoneCancelledUpdateQuery, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := tx.Exec(PhoneInsertQuery, permanentId, phone, false); err != nil {
+		if isDuplicateEntry(err) {
+			return errors.WithStack(ErrPhoneAlreadyExist)
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetPhoneCancelledInDbTx удаляет номер телефона из профиля, помечая его cancelled.
+var SetPhoneCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	if _, err := tx.Exec(PhoneCancelledUpdateQuery, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
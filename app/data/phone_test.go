@@ -0,0 +1,77 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с номером телефона пользователя.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetPhoneFromDb проверяет получение номера телефона.
+// Ожидается: номер из БД, sql.ErrNoRows, если номер не указан.
+func TestGetPhoneFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(PhoneSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"phone"}).AddRow("+79991234567"))
+	mock.ExpectQuery(PhoneSelectQuery).WithArgs("perm456").WillReturnError(sql.ErrNoRows)
+
+	phone, err := GetPhoneFromDb("perm123")
+	assert.NoError(t, err)
+	assert.Equal(t, "+79991234567", phone)
+
+	_, err = GetPhoneFromDb("perm456")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetPermanentIdFromDbByPhone проверяет поиск пользователя по номеру телефона.
+// Ожидается: permanentId владельца номера, sql.ErrNoRows для свободного номера.
+func TestGetPermanentIdFromDbByPhone(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(PermanentIdByPhoneSelectQuery).WithArgs("+79991234567").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm123"))
+	mock.ExpectQuery(PermanentIdByPhoneSelectQuery).WithArgs("+79997654321").WillReturnError(sql.ErrNoRows)
+
+	permanentId, err := GetPermanentIdFromDbByPhone("+79991234567")
+	assert.NoError(t, err)
+	assert.Equal(t, "perm123", permanentId)
+
+	_, err = GetPermanentIdFromDbByPhone("+79997654321")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetPhoneInDbTx проверяет сохранение и удаление номера телефона.
+// Ожидается: прежний номер помечается cancelled перед записью нового, ошибка БД возвращается,
+// номер, уже подтвержденный другим пользователем, отклоняется с ErrPhoneAlreadyExist.
+func TestSetPhoneInDbTx(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(PhoneCancelledUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(PhoneInsertQuery).WithArgs("perm123", "+79991234567", false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(PhoneCancelledUpdateQuery).WithArgs("perm123").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(PhoneCancelledUpdateQuery).WithArgs("perm456").WillReturnError(sql.ErrConnDone)
+	mock.ExpectExec(PhoneCancelledUpdateQuery).WithArgs("perm789").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(PhoneInsertQuery).WithArgs("perm789", "+79991234567", false).
+		WillReturnError(&mysql.MySQLError{Number: mysqlDuplicateEntryErrorNumber, Message: "Duplicate entry"})
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetPhoneInDbTx(tx, "perm123", "+79991234567"))
+	assert.NoError(t, SetPhoneCancelledInDbTx(tx, "perm123"))
+	assert.Error(t, SetPhoneInDbTx(tx, "perm456", "+79997654321"))
+	assert.ErrorIs(t, SetPhoneInDbTx(tx, "perm789", "+79991234567"), ErrPhoneAlreadyExist)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,160 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для изменения профиля пользователя:
+//   - GetLoginFromDb: получает текущий логин пользователя
+//   - HasPasswordInDb: проверяет, установлен ли у пользователя пароль
+//   - SetProfileChangeInDbTx: фиксирует изменение логина, email или телефона
+//   - GetEmailChangeByUndoTokenFromDb: получает изменение email по токену отмены
+//   - SetProfileChangeCancelledInDbTx: помечает изменение отмененным
+//   - SetAllTemporaryIdsCancelledInDbTx: отменяет все temporaryId пользователя
+//   - SetAllRefreshTokensCancelledInDbTx: отменяет все refresh токены пользователя
+//   - SetOtherTemporaryIdsCancelledInDbTx: отменяет temporaryId пользователя на других устройствах
+//   - SetOtherRefreshTokensCancelledInDbTx: отменяет refresh токены пользователя на других устройствах
+//
+// История значений хранится в таблицах login и email (прежние записи помечаются cancelled,
+// действующие значения уникальны), таблица profile_change хранит журнал изменений
+// и токены отмены смены email.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+// Поля профиля в журнале изменений
+const (
+	ProfileFieldLogin         = "login"
+	ProfileFieldEmail         = "email"
+	ProfileFieldPhone         = "phone"
+	ProfileFieldPassword      = "password"
+	ProfileFieldPasswordReset = "passwordReset"
+)
+
+// SQL-запросы для работы с профилем пользователя
+const (
+	LoginSelectQuery                       = "select login from login where permanentId = ? and cancelled = false"
+	PasswordHashCountSelectQuery           = "select count(*) from password_hash where permanentId = ? and cancelled = false"
+	ProfileChangeInsertQuery               = "insert into profile_change (permanentId, field, oldValue, newValue, undoToken, changedAt, cancelled) values (?, ?, ?, ?, ?, ?, ?)"
+	ProfileChangeByUndoTokenSelectQuery    = "select permanentId, field, oldValue, newValue from profile_change where undoToken = ? and field = ? and cancelled = false"
+	ProfileChangeCancelledUpdateQuery      = "update profile_change set cancelled = true where undoToken = ? and cancelled = false"
+	AllTemporaryIdsCancelledUpdateQuery    = "update temporary_id set cancelled = true where permanentId = ? and cancelled = false"
+	AllRefreshTokensCancelledUpdateQuery   = "update refresh_token set cancelled = true where permanentId = ? and cancelled = false"
+	OtherTemporaryIdsCancelledUpdateQuery  = "update temporary_id set cancelled = true where permanentId = ? and temporaryId != ? and cancelled = false"
+	OtherRefreshTokensCancelledUpdateQuery = "update refresh_token set cancelled = true where permanentId = ? and token != ? and cancelled = false"
+)
+
+// mysqlDuplicateEntryErrorNumber - код ошибки MySQL при нарушении уникального индекса.
+const mysqlDuplicateEntryErrorNumber = 1062
+
+// ErrLoginAlreadyExist возвращается SetLoginInDbTx, если логин уже занят другим пользователем.
+var ErrLoginAlreadyExist = errors.New("login already exists")
+
+// ErrEmailAlreadyExist возвращается SetEmailInDbTx, если email уже занят другим пользователем.
+var ErrEmailAlreadyExist = errors.New("email already exists")
+
+// isDuplicateEntry проверяет, что запрос нарушил уникальный индекс.
+//
+// Действующие логин и email уникальны на уровне БД (индексы по activeLogin и activeEmail),
+// поэтому при одновременной смене на один адрес вторая транзакция получает эту ошибку,
+// даже если обе прошли предварительную проверку.
+func isDuplicateEntry(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntryErrorNumber
+}
+
+// GetLoginFromDb получает текущий логин пользователя по permanentId.
+var GetLoginFromDb = func(permanentId string) (string, error) {
+	row := Db.QueryRow(LoginSelectQuery, permanentId)
+	var login string
+	if err := row.Scan(&login); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return login, nil
+}
+
+// HasPasswordInDb проверяет, установлен ли у пользователя пароль.
+//
+// У аккаунтов, созданных через Yandex, пароля нет, пока пользователь не задаст его в профиле.
+var HasPasswordInDb = func(permanentId string) (bool, error) {
+	row := Db.QueryRow(PasswordHashCountSelectQuery, permanentId)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return count > 0, nil
+}
+
+// SetProfileChangeInDbTx фиксирует изменение поля профиля в журнале.
+//
+// undoToken передается только для смены email, для логина и пароля - пустая строка.
+// Для пароля значения не сохраняются, фиксируется только факт смены.
+var SetProfileChangeInDbTx = func(tx *sql.Tx, change structs.ProfileChange, undoToken string, changedAt int64) error {
+	_, err := tx.Exec(ProfileChangeInsertQuery, change.PermanentId, change.Field, change.OldValue, change.NewValue, undoToken, changedAt, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// GetEmailChangeByUndoTokenFromDb получает неотмененное изменение email по токену отмены.
+//
+// Возвращает sql.ErrNoRows, если токен не найден или уже использован.
+var GetEmailChangeByUndoTokenFromDb = func(undoToken string) (structs.ProfileChange, error) {
+	row := Db.QueryRow(ProfileChangeByUndoTokenSelectQuery, undoToken, ProfileFieldEmail)
+	var change structs.ProfileChange
+	if err := row.Scan(&change.PermanentId, &change.Field, &change.OldValue, &change.NewValue); err != nil {
+		return structs.ProfileChange{}, errors.WithStack(err)
+	}
+	return change, nil
+}
+
+// SetProfileChangeCancelledInDbTx помечает изменение с токеном отмены отмененным.
+var SetProfileChangeCancelledInDbTx = func(tx *sql.Tx, undoToken string) error {
+	_, err := tx.Exec(ProfileChangeCancelledUpdateQuery, undoToken)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAllTemporaryIdsCancelledInDbTx отменяет temporaryId пользователя на всех устройствах.
+var SetAllTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	_, err := tx.Exec(AllTemporaryIdsCancelledUpdateQuery, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetAllRefreshTokensCancelledInDbTx отменяет refresh токены пользователя на всех устройствах.
+var SetAllRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	_, err := tx.Exec(AllRefreshTokensCancelledUpdateQuery, permanentId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetOtherTemporaryIdsCancelledInDbTx отменяет temporaryId пользователя на всех устройствах, кроме текущего.
+//
+// Текущая сессия определяется по самому temporaryId, а не по userAgent:
+// сессия с тем же User-Agent на другом устройстве тоже отменяется.
+var SetOtherTemporaryIdsCancelledInDbTx = func(tx *sql.Tx, permanentId, temporaryId string) error {
+	_, err := tx.Exec(OtherTemporaryIdsCancelledUpdateQuery, permanentId, temporaryId)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetOtherRefreshTokensCancelledInDbTx отменяет refresh токены пользователя, кроме refreshToken текущей сессии.
+var SetOtherRefreshTokensCancelledInDbTx = func(tx *sql.Tx, permanentId, refreshToken string) error {
+	_, err := tx.Exec(OtherRefreshTokensCancelledUpdateQuery, permanentId, refreshToken)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
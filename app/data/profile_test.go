@@ -0,0 +1,201 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл тестирует функции изменения профиля пользователя.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetLoginFromDb проверяет получение текущего логина.
+// Ожидается: логин из БД, ошибка при отсутствии записи.
+func TestGetLoginFromDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	Db = db
+
+	mock.ExpectQuery(LoginSelectQuery).
+		WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"login"}).AddRow("user"))
+	login, err := GetLoginFromDb("perm123")
+	assert.NoError(t, err)
+	assert.Equal(t, "user", login)
+
+	mock.ExpectQuery(LoginSelectQuery).
+		WithArgs("perm456").
+		WillReturnError(sql.ErrNoRows)
+	_, err = GetLoginFromDb("perm456")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestHasPasswordInDb проверяет наличие пароля у пользователя.
+// Ожидается: true при действующем хеше пароля, false для аккаунта без пароля.
+func TestHasPasswordInDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	Db = db
+
+	mock.ExpectQuery(PasswordHashCountSelectQuery).
+		WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	hasPassword, err := HasPasswordInDb("perm123")
+	assert.NoError(t, err)
+	assert.True(t, hasPassword)
+
+	mock.ExpectQuery(PasswordHashCountSelectQuery).
+		WithArgs("perm456").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	hasPassword, err = HasPasswordInDb("perm456")
+	assert.NoError(t, err)
+	assert.False(t, hasPassword)
+
+	mock.ExpectQuery(PasswordHashCountSelectQuery).
+		WithArgs("perm789").
+		WillReturnError(sql.ErrConnDone)
+	_, err = HasPasswordInDb("perm789")
+	assert.Error(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetProfileChangeInDbTx проверяет запись изменения профиля в журнал.
+// Ожидается: вставка записи с токеном отмены и обработка ошибок.
+func TestSetProfileChangeInDbTx(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	change := structs.ProfileChange{PermanentId: "perm123", Field: ProfileFieldEmail, OldValue: "old@example.com", NewValue: "new@example.com"}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(ProfileChangeInsertQuery).
+		WithArgs("perm123", ProfileFieldEmail, "old@example.com", "new@example.com", "undo-token", int64(100), false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(ProfileChangeInsertQuery).
+		WithArgs("perm123", ProfileFieldEmail, "old@example.com", "new@example.com", "", int64(101), false).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	assert.NoError(t, SetProfileChangeInDbTx(tx, change, "undo-token", 100))
+	assert.Error(t, SetProfileChangeInDbTx(tx, change, "", 101))
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetEmailChangeByUndoTokenFromDb проверяет получение смены email по токену отмены.
+// Ожидается: данные смены, sql.ErrNoRows для неизвестного или использованного токена.
+func TestGetEmailChangeByUndoTokenFromDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	Db = db
+
+	mock.ExpectQuery(ProfileChangeByUndoTokenSelectQuery).
+		WithArgs("undo-token", ProfileFieldEmail).
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId", "field", "oldValue", "newValue"}).
+			AddRow("perm123", ProfileFieldEmail, "old@example.com", "new@example.com"))
+	change, err := GetEmailChangeByUndoTokenFromDb("undo-token")
+	assert.NoError(t, err)
+	assert.Equal(t, structs.ProfileChange{PermanentId: "perm123", Field: ProfileFieldEmail, OldValue: "old@example.com", NewValue: "new@example.com"}, change)
+
+	mock.ExpectQuery(ProfileChangeByUndoTokenSelectQuery).
+		WithArgs("used-token", ProfileFieldEmail).
+		WillReturnError(sql.ErrNoRows)
+	_, err = GetEmailChangeByUndoTokenFromDb("used-token")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestProfileCancelQueries проверяет отмену смены email и всех сессий пользователя.
+// Ожидается: выполнение запросов в транзакции и обработка ошибок.
+func TestProfileCancelQueries(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(ProfileChangeCancelledUpdateQuery).
+		WithArgs("undo-token").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(AllTemporaryIdsCancelledUpdateQuery).
+		WithArgs("perm123").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(AllRefreshTokensCancelledUpdateQuery).
+		WithArgs("perm123").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(ProfileChangeCancelledUpdateQuery).
+		WithArgs("undo-token").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectExec(AllTemporaryIdsCancelledUpdateQuery).
+		WithArgs("perm123").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectExec(AllRefreshTokensCancelledUpdateQuery).
+		WithArgs("perm123").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	assert.NoError(t, SetProfileChangeCancelledInDbTx(tx, "undo-token"))
+	assert.NoError(t, SetAllTemporaryIdsCancelledInDbTx(tx, "perm123"))
+	assert.NoError(t, SetAllRefreshTokensCancelledInDbTx(tx, "perm123"))
+	assert.Error(t, SetProfileChangeCancelledInDbTx(tx, "undo-token"))
+	assert.Error(t, SetAllTemporaryIdsCancelledInDbTx(tx, "perm123"))
+	assert.Error(t, SetAllRefreshTokensCancelledInDbTx(tx, "perm123"))
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestOtherSessionsCancelQueries проверяет отмену сессий на других устройствах.
+// Ожидается: запросы исключают temporaryId и refresh токен текущей сессии, ошибки БД возвращаются.
+func TestOtherSessionsCancelQueries(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(OtherTemporaryIdsCancelledUpdateQuery).
+		WithArgs("perm123", "temp-id").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(OtherRefreshTokensCancelledUpdateQuery).
+		WithArgs("perm123", "refresh-token").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(OtherTemporaryIdsCancelledUpdateQuery).
+		WithArgs("perm123", "temp-id").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectExec(OtherRefreshTokensCancelledUpdateQuery).
+		WithArgs("perm123", "refresh-token").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	assert.NoError(t, SetOtherTemporaryIdsCancelledInDbTx(tx, "perm123", "temp-id"))
+	assert.NoError(t, SetOtherRefreshTokensCancelledInDbTx(tx, "perm123", "refresh-token"))
+	assert.Error(t, SetOtherTemporaryIdsCancelledInDbTx(tx, "perm123", "temp-id"))
+	assert.Error(t, SetOtherRefreshTokensCancelledInDbTx(tx, "perm123", "refresh-token"))
+
+	tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,174 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для работы с ролями и правами доступа:
+//   - GetRolesFromDb: получает все роли с их правами
+//   - IsRoleInDb: проверяет, что роль существует
+//   - SetRoleInDbTx: создает роль или заменяет ее описание и права
+//   - GetUserRolesFromDb: получает действующие роли пользователя
+//   - GetUserPermissionsFromDb: получает права, которые дают пользователю его роли
+//   - GetRoleMembersFromDb: получает permanentId пользователей с ролью
+//   - SetUserRoleInDbTx: назначает пользователю роль
+//   - SetUserRoleCancelledInDbTx: снимает с пользователя роль
+//
+// Роль - именованный набор прав (role, role_permission). Назначения ролей пользователям
+// хранятся в user_role; снятая роль помечается cancelled.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для ролей и прав доступа
+const (
+	RolesSelectQuery           = "select name, description from role order by name"
+	RolePermissionsSelectQuery = "select role, permission from role_permission order by role, permission"
+	RoleSelectQuery            = "select count(*) from role where name = ?"
+	RoleDeleteQuery            = "delete from role where name = ?"
+	RoleInsertQuery            = "insert into role (name, description) values (?, ?)"
+	RolePermissionDeleteQuery  = "delete from role_permission where role = ?"
+	RolePermissionInsertQuery  = "insert into role_permission (role, permission) values (?, ?)"
+	UserRolesSelectQuery       = "select distinct role from user_role where permanentId = ? and cancelled = false order by role"
+	UserPermissionsSelectQuery = "select distinct permission from role_permission where role in (select role from user_role where permanentId = ? and cancelled = false) order by permission"
+	RoleMembersSelectQuery     = "select distinct permanentId from user_role where role = ? and cancelled = false"
+	UserRoleUpdateQuery        = "update user_role set cancelled = true where permanentId = ? and role = ? and cancelled = false"
+	UserRoleInsertQuery        = "insert into user_role (permanentId, role, grantedAt, cancelled) values (?, ?, ?, ?)"
+	AccountRolesSelectQuery    = "select role, grantedAt, cancelled from user_role where permanentId = ?"
+)
+
+// scanStrings выполняет запрос и возвращает значения первого столбца всех строк.
+func scanStrings(query string, args ...interface{}) ([]string, error) {
+	rows, err := Db.Query(query, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		values = append(values, value)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return values, nil
+}
+
+// GetRolesFromDb получает все роли с их правами, упорядоченные по имени.
+var GetRolesFromDb = func() ([]structs.Role, error) {
+	rows, err := Db.Query(RolesSelectQuery)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var roles []structs.Role
+	index := map[string]int{}
+	for rows.Next() {
+		var role structs.Role
+		if err := rows.Scan(&role.Name, &role.Description); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		index[role.Name] = len(roles)
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	permissionRows, err := Db.Query(RolePermissionsSelectQuery)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer permissionRows.Close()
+
+	for permissionRows.Next() {
+		var roleName, permission string
+		if err := permissionRows.Scan(&roleName, &permission); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if i, ok := index[roleName]; ok {
+			roles[i].Permissions = append(roles[i].Permissions, permission)
+		}
+	}
+	if err := permissionRows.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return roles, nil
+}
+
+// IsRoleInDb проверяет, что роль с именем name существует.
+var IsRoleInDb = func(name string) (bool, error) {
+	row := Db.QueryRow(RoleSelectQuery, name)
+	var count int
+	if err := row.Scan(&count); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return count > 0, nil
+}
+
+// SetRoleInDbTx создает роль или заменяет описание и права существующей роли.
+//
+// Назначения роли пользователям сохраняются.
+var SetRoleInDbTx = func(tx *sql.Tx, role structs.Role) error {
+	if _, err := tx.Exec(RoleDeleteQuery, role.Name); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := tx.Exec(RoleInsertQuery, role.Name, role.Description); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := tx.Exec(RolePermissionDeleteQuery, role.Name); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, permission := range role.Permissions {
+		if _, err := tx.Exec(RolePermissionInsertQuery, role.Name, permission); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// GetUserRolesFromDb получает действующие роли пользователя, упорядоченные по имени.
+var GetUserRolesFromDb = func(permanentId string) ([]string, error) {
+	return scanStrings(UserRolesSelectQuery, permanentId)
+}
+
+// GetUserPermissionsFromDb получает права, которые дают пользователю его действующие роли.
+var GetUserPermissionsFromDb = func(permanentId string) ([]string, error) {
+	return scanStrings(UserPermissionsSelectQuery, permanentId)
+}
+
+// GetRoleMembersFromDb получает permanentId пользователей, которым назначена роль.
+var GetRoleMembersFromDb = func(role string) ([]string, error) {
+	return scanStrings(RoleMembersSelectQuery, role)
+}
+
+// SetUserRoleInDbTx назначает пользователю роль.
+//
+// Прежнее назначение той же роли, если оно есть, помечается cancelled.
+var SetUserRoleInDbTx = func(tx *sql.Tx, permanentId, role string, grantedAt int64) error {
+	_, err := tx.Exec(UserRoleUpdateQuery, permanentId, role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = tx.Exec(UserRoleInsertQuery, permanentId, role, grantedAt, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetUserRoleCancelledInDbTx снимает с пользователя роль.
+var SetUserRoleCancelledInDbTx = func(tx *sql.Tx, permanentId, role string) error {
+	_, err := tx.Exec(UserRoleUpdateQuery, permanentId, role)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с ролями и правами доступа.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestGetRolesFromDb проверяет получение ролей с правами.
+// Ожидается: права распределены по ролям, права неизвестной роли пропускаются.
+func TestGetRolesFromDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectQuery(RolesSelectQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"name", "description"}).
+			AddRow("admin", "Administrators").
+			AddRow("support", "Support"))
+	mock.ExpectQuery(RolePermissionsSelectQuery).
+		WillReturnRows(sqlmock.NewRows([]string{"role", "permission"}).
+			AddRow("admin", "admin.users").
+			AddRow("admin", "roles.manage").
+			AddRow("removed", "reports.view").
+			AddRow("support", "admin.users"))
+
+	roles, err := GetRolesFromDb()
+	assert.NoError(t, err)
+	assert.Equal(t, []structs.Role{
+		{Name: "admin", Description: "Administrators", Permissions: []string{"admin.users", "roles.manage"}},
+		{Name: "support", Description: "Support", Permissions: []string{"admin.users"}},
+	}, roles)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetRoleInDbTx проверяет создание роли.
+// Ожидается: прежние описание и права роли заменяются новыми.
+func TestSetRoleInDbTx(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(RoleDeleteQuery).WithArgs("support").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(RoleInsertQuery).WithArgs("support", "Support").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(RolePermissionDeleteQuery).WithArgs("support").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(RolePermissionInsertQuery).WithArgs("support", "admin.users").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(RolePermissionInsertQuery).WithArgs("support", "reports.view").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(RoleSelectQuery).WithArgs("support").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetRoleInDbTx(tx, structs.Role{Name: "support", Description: "Support", Permissions: []string{"admin.users", "reports.view"}}))
+	require.NoError(t, tx.Commit())
+
+	exists, err := IsRoleInDb("support")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestUserRoleQueries проверяет назначение и снятие ролей и получение прав пользователя.
+// Ожидается: прежнее назначение отменяется перед новым, права собираются по действующим ролям.
+func TestUserRoleQueries(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(UserRoleUpdateQuery).WithArgs("perm123", "admin").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(UserRoleInsertQuery).WithArgs("perm123", "admin", int64(100), false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(UserRoleUpdateQuery).WithArgs("perm123", "support").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectQuery(UserRolesSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow("admin"))
+	mock.ExpectQuery(UserPermissionsSelectQuery).WithArgs("perm123").
+		WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("admin.users").AddRow("roles.manage"))
+	mock.ExpectQuery(RoleMembersSelectQuery).WithArgs("admin").
+		WillReturnRows(sqlmock.NewRows([]string{"permanentId"}).AddRow("perm123"))
+	mock.ExpectQuery(UserPermissionsSelectQuery).WithArgs("perm456").WillReturnError(sql.ErrConnDone)
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetUserRoleInDbTx(tx, "perm123", "admin", 100))
+	assert.NoError(t, SetUserRoleCancelledInDbTx(tx, "perm123", "support"))
+	require.NoError(t, tx.Commit())
+
+	roles, err := GetUserRolesFromDb("perm123")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, roles)
+
+	permissions, err := GetUserPermissionsFromDb("perm123")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admin.users", "roles.manage"}, permissions)
+
+	members, err := GetRoleMembersFromDb("admin")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"perm123"}, members)
+
+	_, err = GetUserPermissionsFromDb("perm456")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
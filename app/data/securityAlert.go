@@ -0,0 +1,52 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для токенов ссылок "это был не я" из уведомлений безопасности:
+//   - SetSecurityAlertTokenInDb: сохраняет токен отправленной ссылки
+//   - SetSecurityAlertTokenUsedInDbTx: отмечает токен использованным
+//
+// Токен подписан и проверяется tools.SecurityAlertTokenValidate, а таблица
+// security_alert_token делает его одноразовым, как reset_token - токен сброса пароля.
+package data
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+// SQL-запросы для токенов уведомлений безопасности
+const (
+	SecurityAlertTokenInsertQuery = "insert into security_alert_token (token, permanentId, cancelled) values (?, ?, ?)"
+	SecurityAlertTokenUseQuery    = "update security_alert_token set cancelled = true where token = ? and cancelled = false"
+)
+
+// ErrSecurityAlertTokenUsed возвращается, если токен уже использован или не выдавался.
+var ErrSecurityAlertTokenUsed = errors.New("security alert token is used or unknown")
+
+// SetSecurityAlertTokenInDb сохраняет токен ссылки "это был не я", отправленной пользователю permanentId.
+var SetSecurityAlertTokenInDb = func(token, permanentId string) error {
+	if _, err := Db.Exec(SecurityAlertTokenInsertQuery, token, permanentId, false); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SetSecurityAlertTokenUsedInDbTx отмечает токен использованным.
+//
+// Проверка и отметка выполняются одним запросом, поэтому ссылка срабатывает один раз
+// даже при одновременных переходах.
+// Возвращает ErrSecurityAlertTokenUsed, если токен уже использован или не выдавался.
+var SetSecurityAlertTokenUsedInDbTx = func(tx *sql.Tx, token string) error {
+	result, err := tx.Exec(SecurityAlertTokenUseQuery, token)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if affected == 0 {
+		return errors.WithStack(ErrSecurityAlertTokenUsed)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// Package data предоставляет тесты для функций работы с базой данных.
+//
+// Файл тестирует функции работы с токенами уведомлений безопасности.
+package data
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSetSecurityAlertTokenInDb проверяет сохранение токена ссылки "это был не я".
+// Ожидается: токен записывается неиспользованным, ошибка БД возвращается.
+func TestSetSecurityAlertTokenInDb(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectExec(SecurityAlertTokenInsertQuery).WithArgs("token1", "perm123", false).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(SecurityAlertTokenInsertQuery).WithArgs("token2", "perm123", false).WillReturnError(sql.ErrConnDone)
+
+	assert.NoError(t, SetSecurityAlertTokenInDb("token1", "perm123"))
+	assert.Error(t, SetSecurityAlertTokenInDb("token2", "perm123"))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestSetSecurityAlertTokenUsedInDbTx проверяет одноразовость токена.
+// Ожидается: первый вызов отмечает токен, повторный возвращает ErrSecurityAlertTokenUsed,
+// ошибка БД возвращается.
+func TestSetSecurityAlertTokenUsedInDbTx(t *testing.T) {
+	mock, teardown := setupAccountDb(t)
+	defer teardown()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(SecurityAlertTokenUseQuery).WithArgs("token1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(SecurityAlertTokenUseQuery).WithArgs("token1").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(SecurityAlertTokenUseQuery).WithArgs("token2").WillReturnError(sql.ErrConnDone)
+
+	tx, err := Db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetSecurityAlertTokenUsedInDbTx(tx, "token1"))
+	assert.True(t, errors.Is(SetSecurityAlertTokenUsedInDbTx(tx, "token1"), ErrSecurityAlertTokenUsed))
+	err = SetSecurityAlertTokenUsedInDbTx(tx, "token2")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrSecurityAlertTokenUsed))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -8,13 +8,26 @@
 //   - GetShowCaptchaFromSession: получает флаг отображения капчи из сессии
 //   - GetAuthDataFromSession: получает данные пользователя из сессии
 //   - EndAuthAndCaptchaSessions: завершает все сессии пользователя
+//   - GetCSRFTokenFromSession: получает CSRF токен из сессии
+//   - SetCSRFTokenInSession: сохраняет CSRF токен в сессии
+//   - SetEmailChangeInSession: сохраняет ожидающую подтверждения смену email
+//   - GetEmailChangeFromSession: получает ожидающую подтверждения смену email
+//   - DeleteEmailChangeFromSession: удаляет смену email из сессии
+//   - SetPhoneChangeInSession: сохраняет ожидающую подтверждения смену номера телефона
+//   - GetPhoneChangeFromSession: получает ожидающую подтверждения смену номера телефона
+//   - DeletePhoneChangeFromSession: удаляет смену номера телефона из сессии
+//   - SetInviteCodeInSession: сохраняет код приглашения на время входа через Yandex
+//   - GetInviteCodeFromSession: получает код приглашения из сессии
+//   - DeleteInviteCodeFromSession: удаляет код приглашения из сессии
 package data
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
 	"os"
 
+	"github.com/gimaevra94/auth/app/keyring"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gorilla/sessions"
 	"github.com/pkg/errors"
@@ -22,39 +35,77 @@ import (
 
 var loginStore *sessions.CookieStore
 var captchaStore *sessions.CookieStore
+var csrfStore *sessions.CookieStore
+
+var loginStoreName = "loginStore"
+var captchaStoreName = "captchaStore"
+var csrfStoreName = "csrfStore"
 
 // InitStore инициализирует хранилища сессий для аутентификации и капчи.
 //
-// Создает два CookieStore:
+// Создает три CookieStore:
 //   - loginStore: для сессий аутентификации (время жизни 30 минут)
 //   - captchaStore: для сессий капчи (время жизни 30 дней)
+//   - csrfStore: для CSRF токена (cookie живет до закрытия браузера, подписывается ключом loginStore)
 //
-// Использует переменные окружения для ключей:
+// Ключи берутся из связки ключей (keyring): основной ключ используется для подписи,
+// активные - для проверки cookie, выданных до ротации. Без связки используются
+// переменные окружения:
 //   - LOGIN_STORE_SESSION_AUTH_KEY: ключ аутентификации для сессий входа
 //   - LOGIN_STORE_SESSION_ENCRYPTION_KEY: ключ шифрования для сессий входа
 //   - CAPTCHA_STORE_SESSION_SECRET_KEY: секретный ключ для сессий капчи
+//
+// Флаги Secure, SameSite и домен обоих хранилищ берутся из настроек cookie.
 func InitStore() *sessions.CookieStore {
-	sessionAuthKey := []byte(os.Getenv("LOGIN_STORE_SESSION_AUTH_KEY"))
-	sessionEncryptionKey := []byte(os.Getenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY"))
-	loginStore = sessions.NewCookieStore(sessionAuthKey, sessionEncryptionKey)
+	config := loadCookieConfig()
+	loginStoreName = cookieName(config, "loginStore")
+	captchaStoreName = cookieName(config, "captchaStore")
+	csrfStoreName = cookieName(config, "csrfStore")
+
+	loginStoreKeyPairs, err := keyring.LoginStoreKeyPairs()
+	if err != nil {
+		log.Printf("%+v", err)
+		loginStoreKeyPairs = [][]byte{[]byte(os.Getenv("LOGIN_STORE_SESSION_AUTH_KEY")), []byte(os.Getenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY"))}
+	}
+	loginStore = sessions.NewCookieStore(loginStoreKeyPairs...)
 	loginStoreLifeTime := 30 * 60
 	loginStore.Options = &sessions.Options{
 		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+		SameSite: config.sameSite,
 		Path:     "/",
+		Domain:   config.domain,
 		MaxAge:   loginStoreLifeTime,
-		Secure:   false,
+		Secure:   config.secure,
 	}
 
-	sessionSecret := []byte(os.Getenv("CAPTCHA_STORE_SESSION_SECRET_KEY"))
-	captchaStore = sessions.NewCookieStore(sessionSecret)
+	captchaStoreKeyPairs, err := keyring.CaptchaStoreKeyPairs()
+	if err != nil {
+		log.Printf("%+v", err)
+		captchaStoreKeyPairs = [][]byte{[]byte(os.Getenv("CAPTCHA_STORE_SESSION_SECRET_KEY"))}
+	}
+	captchaStore = sessions.NewCookieStore(captchaStoreKeyPairs...)
 	captchaStoreLifeTime := 30 * 24 * 60 * 60
 	captchaStore.Options = &sessions.Options{
 		HttpOnly: true,
-		SameSite: http.SameSiteLaxMode,
+		SameSite: config.sameSite,
 		Path:     "/",
+		Domain:   config.domain,
 		MaxAge:   captchaStoreLifeTime,
-		Secure:   false,
+		Secure:   config.secure,
+	}
+
+	csrfStoreKeyPairs, err := keyring.CSRFStoreKeyPairs()
+	if err != nil {
+		log.Printf("%+v", err)
+		csrfStoreKeyPairs = [][]byte{[]byte(os.Getenv("LOGIN_STORE_SESSION_AUTH_KEY"))}
+	}
+	csrfStore = sessions.NewCookieStore(csrfStoreKeyPairs...)
+	csrfStore.Options = &sessions.Options{
+		HttpOnly: true,
+		SameSite: config.sameSite,
+		Path:     "/",
+		Domain:   config.domain,
+		Secure:   config.secure,
 	}
 
 	return nil
@@ -71,7 +122,7 @@ func InitStore() *sessions.CookieStore {
 //   - key: ключ для сохранения данных в сессии
 //   - consts: данные для сохранения (любой тип, сериализуемый в JSON)
 var SetCaptchaDataInSession = func(w http.ResponseWriter, r *http.Request, key string, consts any) error {
-	captchaSession, err := captchaStore.Get(r, "captchaStore")
+	captchaSession, err := captchaStore.Get(r, captchaStoreName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -100,7 +151,7 @@ var SetCaptchaDataInSession = func(w http.ResponseWriter, r *http.Request, key s
 //   - r: *http.Request для получения сессии
 //   - consts: данные пользователя для сохранения (любой тип, сериализуемый в JSON)
 var SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, consts any) error {
-	loginSession, err := loginStore.Get(r, "loginStore")
+	loginSession, err := loginStore.Get(r, loginStoreName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -130,7 +181,7 @@ var SetAuthDataInSession = func(w http.ResponseWriter, r *http.Request, consts a
 //   - int64: значение счетчика попыток капчи
 //   - error: ошибка, если счетчик отсутствует или произошла ошибка десериализации
 var GetCaptchaCounterFromSession = func(r *http.Request) (int64, error) {
-	session, err := captchaStore.Get(r, "captchaStore")
+	session, err := captchaStore.Get(r, captchaStoreName)
 	if err != nil {
 		return 0, errors.WithStack(err)
 	}
@@ -161,7 +212,7 @@ var GetCaptchaCounterFromSession = func(r *http.Request) (int64, error) {
 //   - bool: флаг, указывающий нужно ли отображать капчу
 //   - error: ошибка, если флаг отсутствует или произошла ошибка десериализации
 var GetShowCaptchaFromSession = func(r *http.Request) (bool, error) {
-	session, err := captchaStore.Get(r, "captchaStore")
+	session, err := captchaStore.Get(r, captchaStoreName)
 	if err != nil {
 		return false, errors.WithStack(err)
 	}
@@ -192,7 +243,7 @@ var GetShowCaptchaFromSession = func(r *http.Request) (bool, error) {
 //   - structs.User: данные пользователя из сессии
 //   - error: ошибка, если данные отсутствуют или произошла ошибка десериализации
 var GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
-	session, err := loginStore.Get(r, "loginStore")
+	session, err := loginStore.Get(r, loginStoreName)
 	if err != nil {
 		return structs.User{}, errors.WithStack(err)
 	}
@@ -223,7 +274,7 @@ var GetAuthDataFromSession = func(r *http.Request) (structs.User, error) {
 // Возвращает:
 //   - error: ошибка при завершении сессий
 var EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) error {
-	session, err := loginStore.Get(r, "loginStore")
+	session, err := loginStore.Get(r, loginStoreName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -234,7 +285,7 @@ var EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) err
 		return errors.WithStack(err)
 	}
 
-	captchaSession, err := captchaStore.Get(r, "captchaStore")
+	captchaSession, err := captchaStore.Get(r, captchaStoreName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -247,3 +298,197 @@ var EndAuthAndCaptchaSessions = func(w http.ResponseWriter, r *http.Request) err
 
 	return nil
 }
+
+// GetCSRFTokenFromSession получает CSRF токен из сессии.
+//
+// Возвращает ошибку, если сессия не читается или токен отсутствует.
+var GetCSRFTokenFromSession = func(r *http.Request) (string, error) {
+	session, err := csrfStore.Get(r, csrfStoreName)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	token, ok := session.Values["csrfToken"].(string)
+	if !ok || token == "" {
+		return "", errors.New("csrfToken not exist")
+	}
+
+	return token, nil
+}
+
+// SetCSRFTokenInSession сохраняет CSRF токен в сессии.
+var SetCSRFTokenInSession = func(w http.ResponseWriter, r *http.Request, token string) error {
+	session, err := csrfStore.Get(r, csrfStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	session.Values["csrfToken"] = token
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// SetEmailChangeInSession сохраняет ожидающую подтверждения смену email в сессии входа
+// под ключом "emailChange".
+var SetEmailChangeInSession = func(w http.ResponseWriter, r *http.Request, change structs.EmailChange) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	jsonData, err := json.Marshal(change)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	session.Values["emailChange"] = jsonData
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// GetEmailChangeFromSession получает ожидающую подтверждения смену email из сессии входа.
+//
+// Возвращает ошибку, если смена email не запрашивалась или сессия истекла.
+var GetEmailChangeFromSession = func(r *http.Request) (structs.EmailChange, error) {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil {
+		return structs.EmailChange{}, errors.WithStack(err)
+	}
+
+	byteData, ok := session.Values["emailChange"].([]byte)
+	if !ok {
+		err := errors.New("emailChange not exist")
+		return structs.EmailChange{}, errors.WithStack(err)
+	}
+
+	var change structs.EmailChange
+	if err = json.Unmarshal(byteData, &change); err != nil {
+		return structs.EmailChange{}, errors.WithStack(err)
+	}
+
+	return change, nil
+}
+
+// DeleteEmailChangeFromSession удаляет смену email из сессии входа, не затрагивая остальные данные.
+var DeleteEmailChangeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	delete(session.Values, "emailChange")
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// SetPhoneChangeInSession сохраняет ожидающую подтверждения смену номера телефона в сессии входа
+// под ключом "phoneChange".
+var SetPhoneChangeInSession = func(w http.ResponseWriter, r *http.Request, change structs.PhoneChange) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	jsonData, err := json.Marshal(change)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	session.Values["phoneChange"] = jsonData
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// GetPhoneChangeFromSession получает ожидающую подтверждения смену номера телефона из сессии входа.
+//
+// Возвращает ошибку, если смена номера не запрашивалась или сессия истекла.
+var GetPhoneChangeFromSession = func(r *http.Request) (structs.PhoneChange, error) {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil {
+		return structs.PhoneChange{}, errors.WithStack(err)
+	}
+
+	byteData, ok := session.Values["phoneChange"].([]byte)
+	if !ok {
+		err := errors.New("phoneChange not exist")
+		return structs.PhoneChange{}, errors.WithStack(err)
+	}
+
+	var change structs.PhoneChange
+	if err = json.Unmarshal(byteData, &change); err != nil {
+		return structs.PhoneChange{}, errors.WithStack(err)
+	}
+
+	return change, nil
+}
+
+// DeletePhoneChangeFromSession удаляет смену номера телефона из сессии входа, не затрагивая остальные данные.
+var DeletePhoneChangeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	delete(session.Values, "phoneChange")
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// SetInviteCodeInSession сохраняет код приглашения в сессии входа под ключом "invite",
+// чтобы использовать его после возврата пользователя из Yandex OAuth.
+var SetInviteCodeInSession = func(w http.ResponseWriter, r *http.Request, code string) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	session.Values["invite"] = code
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// GetInviteCodeFromSession получает код приглашения из сессии входа.
+//
+// Возвращает пустую строку, если код не сохранялся.
+var GetInviteCodeFromSession = func(r *http.Request) (string, error) {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	code, _ := session.Values["invite"].(string)
+	return code, nil
+}
+
+// DeleteInviteCodeFromSession удаляет код приглашения из сессии входа, не затрагивая остальные данные.
+var DeleteInviteCodeFromSession = func(w http.ResponseWriter, r *http.Request) error {
+	session, err := loginStore.Get(r, loginStoreName)
+	if err != nil && session == nil {
+		return errors.WithStack(err)
+	}
+
+	delete(session.Values, "invite")
+	if err = session.Save(r, w); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
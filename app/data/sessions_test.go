@@ -9,8 +9,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/gimaevra94/auth/app/keyring"
 	"github.com/gimaevra94/auth/app/structs"
 )
 
@@ -639,3 +641,224 @@ func TestSessionIntegration(t *testing.T) {
 		}
 	})
 }
+
+// TestCSRFTokenInSession проверяет сохранение и получение CSRF токена.
+// Ожидается: ошибка при отсутствии токена, сохраненный токен читается из cookie сессии.
+func TestCSRFTokenInSession(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "12345678901234567890123456789012")
+	InitStore()
+
+	if _, err := GetCSRFTokenFromSession(httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Error("Expected error for missing csrfToken, got nil")
+	}
+
+	w := httptest.NewRecorder()
+	if err := SetCSRFTokenInSession(w, httptest.NewRequest("GET", "/", nil), "test-csrf-token"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	token, err := GetCSRFTokenFromSession(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if token != "test-csrf-token" {
+		t.Errorf("Expected token 'test-csrf-token', got '%s'", token)
+	}
+}
+
+// TestInitStore_KeyRotation проверяет ротацию ключей хранилищ сессий.
+// Ожидается: cookie, подписанная прежним основным ключом, читается после назначения нового ключа.
+func TestInitStore_KeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("CAPTCHA_STORE_SESSION_SECRET_KEY", "")
+
+	var keyringData structs.Keyring
+	if _, err := keyring.AddKey(&keyringData, keyring.SetCaptchaStore, 1700000000); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := keyring.Save(path, keyringData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	InitStore()
+
+	w := httptest.NewRecorder()
+	if err := SetCaptchaDataInSession(w, httptest.NewRequest("GET", "/", nil), "captchaCounter", int64(2)); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	newKey, err := keyring.AddKey(&keyringData, keyring.SetCaptchaStore, 1700000001)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := keyring.PromoteKey(&keyringData, keyring.SetCaptchaStore, newKey.Kid); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := keyring.Save(path, keyringData); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	InitStore()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	counter, err := GetCaptchaCounterFromSession(req)
+	if err != nil {
+		t.Fatalf("Expected cookie signed with previous key to be accepted, got %v", err)
+	}
+	if counter != 2 {
+		t.Errorf("Expected captchaCounter 2, got %d", counter)
+	}
+}
+
+// TestEmailChangeInSession проверяет сохранение, получение и удаление смены email.
+// Ожидается: ошибка при отсутствии смены, сохраненная смена читается из cookie, удаление не затрагивает данные пользователя.
+func TestEmailChangeInSession(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "12345678901234567890123456789012")
+	os.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	InitStore()
+
+	if _, err := GetEmailChangeFromSession(httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Error("Expected error for missing emailChange, got nil")
+	}
+
+	change := structs.EmailChange{PermanentId: "perm123", NewEmail: "new@example.com", ServerCode: "1234", ServerCodeSendedConter: 1, ServerCodeSendedAt: 100}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	if err := SetAuthDataInSession(w, req, structs.User{Login: "user"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := SetEmailChangeInSession(w, req, change); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+	cookies := w.Result().Cookies()
+	req.AddCookie(cookies[len(cookies)-1])
+
+	got, err := GetEmailChangeFromSession(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got != change {
+		t.Errorf("Expected %+v, got %+v", change, got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := DeleteEmailChangeFromSession(w, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	if _, err := GetEmailChangeFromSession(req); err == nil {
+		t.Error("Expected error after delete, got nil")
+	}
+	if user, err := GetAuthDataFromSession(req); err != nil || user.Login != "user" {
+		t.Errorf("Expected user data to be kept, got %+v, %v", user, err)
+	}
+}
+
+// TestPhoneChangeInSession проверяет сохранение смены номера телефона в сессии входа.
+// Ожидается: смена читается из cookie, после удаления отсутствует, а остальные данные сессии сохраняются.
+func TestPhoneChangeInSession(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "12345678901234567890123456789012")
+	os.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	InitStore()
+
+	if _, err := GetPhoneChangeFromSession(httptest.NewRequest("GET", "/", nil)); err == nil {
+		t.Error("Expected error for missing phoneChange, got nil")
+	}
+
+	change := structs.PhoneChange{PermanentId: "perm123", NewPhone: "+79991234567", ServerCode: "1234", ServerCodeSendedConter: 1, ServerCodeSendedAt: 100}
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/", nil)
+	if err := SetAuthDataInSession(w, req, structs.User{Login: "user"}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := SetPhoneChangeInSession(w, req, change); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+	cookies := w.Result().Cookies()
+	req.AddCookie(cookies[len(cookies)-1])
+
+	got, err := GetPhoneChangeFromSession(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if got != change {
+		t.Errorf("Expected %+v, got %+v", change, got)
+	}
+
+	w = httptest.NewRecorder()
+	if err := DeletePhoneChangeFromSession(w, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	if _, err := GetPhoneChangeFromSession(req); err == nil {
+		t.Error("Expected error after delete, got nil")
+	}
+	if user, err := GetAuthDataFromSession(req); err != nil || user.Login != "user" {
+		t.Errorf("Expected user data to be kept, got %+v, %v", user, err)
+	}
+}
+
+// TestInviteCodeInSession проверяет сохранение кода приглашения в сессии входа.
+// Ожидается: без сохраненного кода возвращается пустая строка, сохраненный код читается из cookie,
+// удаленный код больше не читается.
+func TestInviteCodeInSession(t *testing.T) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "12345678901234567890123456789012")
+	os.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	InitStore()
+
+	code, err := GetInviteCodeFromSession(httptest.NewRequest("GET", "/", nil))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if code != "" {
+		t.Errorf("Expected empty code, got %q", code)
+	}
+
+	w := httptest.NewRecorder()
+	if err := SetInviteCodeInSession(w, httptest.NewRequest("GET", "/yauth", nil), "invite123"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/ya_callback", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	code, err = GetInviteCodeFromSession(req)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if code != "invite123" {
+		t.Errorf("Expected invite123, got %q", code)
+	}
+
+	w = httptest.NewRecorder()
+	if err := DeleteInviteCodeFromSession(w, req); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	req = httptest.NewRequest("GET", "/home", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	if code, err := GetInviteCodeFromSession(req); err != nil || code != "" {
+		t.Errorf("Expected invite code to be deleted, got %q, %v", code, err)
+	}
+}
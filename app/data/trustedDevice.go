@@ -0,0 +1,121 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл содержит функции для доверенных устройств:
+//   - SetTrustedDeviceInDb: сохраняет доверенное устройство пользователя
+//   - IsTrustedDeviceInDb: проверяет, что устройство доверено пользователю и доверие действует
+//   - SetTrustedDevicesCancelledInDbTx: отменяет доверие ко всем устройствам пользователя
+//   - SetTrustedDeviceInCookies: сохраняет идентификатор доверенного устройства в cookie
+//   - GetTrustedDeviceFromCookies: получает идентификатор доверенного устройства из cookie
+//
+// Доверие хранится в таблице trusted_device, как сессии в temporary_id: cookie содержит
+// только случайный идентификатор устройства с HMAC-подписью, поэтому доверие отменяется
+// на сервере (при смене и сбросе пароля, по ссылке "это был не я", при завершении сессий
+// и блокировке аккаунта администратором). Браузер хранит доверие только для последнего
+// аккаунта, подтвердившего вход кодом с него.
+package data
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// trustedDeviceCookieName - имя cookie доверенного устройства.
+const trustedDeviceCookieName = "trustedDevice"
+
+// TrustedDeviceExp - срок доверия к устройству в секундах (30 дней).
+const TrustedDeviceExp = 30 * 24 * 60 * 60
+
+// SQL-запросы для доверенных устройств
+const (
+	TrustedDeviceInsertQuery           = "insert into trusted_device (deviceId, permanentId, expiresAt, cancelled) values (?, ?, ?, ?)"
+	TrustedDeviceCountSelectQuery      = "select count(*) from trusted_device where deviceId = ? and permanentId = ? and expiresAt > ? and cancelled = false"
+	TrustedDevicesCancelledUpdateQuery = "update trusted_device set cancelled = true where permanentId = ? and cancelled = false"
+)
+
+// SetTrustedDeviceInDb сохраняет устройство deviceId доверенным устройством пользователя
+// permanentId до момента expiresAt.
+var SetTrustedDeviceInDb = func(deviceId, permanentId string, expiresAt int64) error {
+	if _, err := Db.Exec(TrustedDeviceInsertQuery, deviceId, permanentId, expiresAt, false); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// IsTrustedDeviceInDb проверяет, что устройство deviceId доверено пользователю permanentId,
+// доверие не отменено и не истекло к now.
+var IsTrustedDeviceInDb = func(deviceId, permanentId string, now int64) (bool, error) {
+	var count int
+	if err := Db.QueryRow(TrustedDeviceCountSelectQuery, deviceId, permanentId, now).Scan(&count); err != nil {
+		return false, errors.WithStack(err)
+	}
+	return count > 0, nil
+}
+
+// SetTrustedDevicesCancelledInDbTx отменяет доверие ко всем устройствам пользователя:
+// следующий вход с любого из них снова потребует код.
+var SetTrustedDevicesCancelledInDbTx = func(tx *sql.Tx, permanentId string) error {
+	if _, err := tx.Exec(TrustedDevicesCancelledUpdateQuery, permanentId); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// trustedDeviceSignedValue возвращает подписываемую строку для идентификатора доверенного устройства.
+//
+// Строка начинается с назначения, поэтому подпись не совпадает
+// с подписью временного ID.
+func trustedDeviceSignedValue(deviceId string) string {
+	return trustedDeviceCookieName + ":" + deviceId
+}
+
+// SetTrustedDeviceInCookies сохраняет в cookie подписанный идентификатор доверенного устройства
+// на TrustedDeviceExp секунд.
+//
+// Флаги Secure, SameSite, домен и префикс __Host- берутся из настроек cookie.
+// Если ключ подписи не задан, возвращает ErrCookieSigningKeyNotSet.
+var SetTrustedDeviceInCookies = func(w http.ResponseWriter, deviceId string) error {
+	signature, err := signCookieValue(trustedDeviceSignedValue(deviceId))
+	if err != nil {
+		return err
+	}
+
+	config := loadCookieConfig()
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName(config, trustedDeviceCookieName),
+		Path:     "/",
+		Domain:   config.domain,
+		HttpOnly: true,
+		Secure:   config.secure,
+		SameSite: config.sameSite,
+		Value:    deviceId + "." + signature,
+		MaxAge:   TrustedDeviceExp,
+	})
+	return nil
+}
+
+// GetTrustedDeviceFromCookies получает идентификатор доверенного устройства из cookie.
+//
+// Возвращает ошибку, если cookie нет, формат значения неверен или подпись не совпадает.
+var GetTrustedDeviceFromCookies = func(r *http.Request) (string, error) {
+	config := loadCookieConfig()
+	cookie, err := r.Cookie(cookieName(config, trustedDeviceCookieName))
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	deviceId, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || deviceId == "" {
+		return "", errors.New("trustedDevice signature invalid")
+	}
+	valid, err := verifyCookieSignature(trustedDeviceSignedValue(deviceId), signature)
+	if err != nil {
+		return "", err
+	}
+	if !valid {
+		return "", errors.New("trustedDevice signature invalid")
+	}
+	return deviceId, nil
+}
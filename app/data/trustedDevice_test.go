@@ -0,0 +1,121 @@
+// Package data предоставляет функции для работы с базой данных сессиями и cookie.
+//
+// Файл тестирует доверенные устройства.
+package data
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTrustedDeviceInCookies проверяет cookie доверенного устройства.
+// Ожидается: подписанный идентификатор читается обратно; измененное значение, подпись
+// другим ключом и отсутствие cookie отклоняются; без ключа подписи cookie не устанавливается.
+func TestTrustedDeviceInCookies(t *testing.T) {
+	t.Setenv("COOKIE_SIGNING_KEY", "test-signing-key")
+
+	w := httptest.NewRecorder()
+	require.NoError(t, SetTrustedDeviceInCookies(w, "device-123"))
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	cookie := cookies[0]
+	assert.Equal(t, "trustedDevice", cookie.Name)
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, TrustedDeviceExp, cookie.MaxAge)
+	assert.True(t, strings.HasPrefix(cookie.Value, "device-123."))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(cookie)
+	deviceId, err := GetTrustedDeviceFromCookies(req)
+	require.NoError(t, err)
+	assert.Equal(t, "device-123", deviceId)
+
+	_, signature, _ := strings.Cut(cookie.Value, ".")
+	for _, value := range []string{
+		"device-456." + signature,
+		"device-123." + signature + "x",
+		"." + signature,
+		signature,
+		"",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Cookie", "trustedDevice="+value)
+		_, err := GetTrustedDeviceFromCookies(req)
+		assert.Error(t, err, "Измененное значение %q не должно приниматься", value)
+	}
+
+	t.Setenv("COOKIE_SIGNING_KEY", "other-signing-key")
+	_, err = GetTrustedDeviceFromCookies(req)
+	assert.Error(t, err, "Подпись другим ключом не должна приниматься")
+
+	_, err = GetTrustedDeviceFromCookies(httptest.NewRequest("GET", "/", nil))
+	assert.Error(t, err)
+
+	t.Setenv("COOKIE_SIGNING_KEY", "")
+	w = httptest.NewRecorder()
+	assert.ErrorIs(t, SetTrustedDeviceInCookies(w, "device-123"), ErrCookieSigningKeyNotSet)
+	assert.Empty(t, w.Result().Cookies())
+}
+
+// TestTrustedDeviceInDb проверяет сохранение, проверку и отмену доверенных устройств.
+// Ожидается: запросы с идентификатором устройства, пользователем и сроком,
+// устройство доверено только при найденной записи, ошибки БД возвращаются.
+func TestTrustedDeviceInDb(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+	oldDb := Db
+	Db = db
+	defer func() { Db = oldDb }()
+
+	mock.ExpectExec(TrustedDeviceInsertQuery).
+		WithArgs("device-123", "perm123", int64(1700000000+TrustedDeviceExp), false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(TrustedDeviceInsertQuery).
+		WithArgs("device-456", "perm123", int64(1700000000+TrustedDeviceExp), false).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectQuery(TrustedDeviceCountSelectQuery).
+		WithArgs("device-123", "perm123", int64(1700000060)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery(TrustedDeviceCountSelectQuery).
+		WithArgs("device-123", "perm456", int64(1700000060)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery(TrustedDeviceCountSelectQuery).
+		WithArgs("device-123", "perm123", int64(1700000060)).
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectBegin()
+	mock.ExpectExec(TrustedDevicesCancelledUpdateQuery).
+		WithArgs("perm123").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(TrustedDevicesCancelledUpdateQuery).
+		WithArgs("perm456").
+		WillReturnError(sql.ErrConnDone)
+	mock.ExpectRollback()
+
+	assert.NoError(t, SetTrustedDeviceInDb("device-123", "perm123", 1700000000+TrustedDeviceExp))
+	assert.Error(t, SetTrustedDeviceInDb("device-456", "perm123", 1700000000+TrustedDeviceExp))
+
+	trusted, err := IsTrustedDeviceInDb("device-123", "perm123", 1700000060)
+	assert.NoError(t, err)
+	assert.True(t, trusted)
+	trusted, err = IsTrustedDeviceInDb("device-123", "perm456", 1700000060)
+	assert.NoError(t, err)
+	assert.False(t, trusted, "Устройство другого пользователя не должно быть доверенным")
+	_, err = IsTrustedDeviceInDb("device-123", "perm123", 1700000060)
+	assert.Error(t, err)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	assert.NoError(t, SetTrustedDevicesCancelledInDbTx(tx, "perm123"))
+	assert.Error(t, SetTrustedDevicesCancelledInDbTx(tx, "perm456"))
+	tx.Rollback()
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
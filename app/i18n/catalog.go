@@ -0,0 +1,676 @@
+// Package i18n предоставляет каталог сообщений и выбор языка интерфейса.
+//
+// Файл содержит каталог переводов:
+//   - catalog: сообщения для пользователя, надписи страниц и тексты писем
+//   - requirements: требования к вводу, которые показываются вместе с сообщениями об ошибках
+//
+// Ключи сообщений для пользователя (например, userNotExist) передаются в параметре msg
+// и сравниваются в шаблонах; ключи надписей страниц и писем начинаются с имени страницы
+// или письма. Набор ключей для всех языков одинаков.
+package i18n
+
+var catalog = map[string]map[string]string{
+	En: {
+		// Сообщения для пользователя
+		"loginInvalid":                "Login is invalid",
+		"emailInvalid":                "Email is invalid",
+		"passwordInvalid":             "Password is invalid",
+		"captchaRequired":             "Pass the verification reCAPTCHA.",
+		"userAlreadyExist":            "User already exists",
+		"userNotExist":                "User does not exist",
+		"wrongCode":                   "Wrong code",
+		"failedMailSendingStatus":     "Failed to send password reset link",
+		"successfulMailSendingStatus": "Password reset link has been sent",
+		"serverCodeHasBeenSend":       "Auth code has been sent. You can send it again in 1 minute.",
+		"serverCodeSendCooldown":      "Auth code has already been sent. Please wait before requesting a new one.",
+		"serverCodeSendQuotaExceeded": "Too many auth codes have been requested for this email. Try again later.",
+		"serverCodeSendSessionLimit":  "Too many auth codes have been requested. Please start again.",
+		"sessionIdleExpired":          "Your session has expired due to inactivity. Please sign in again.",
+		"sessionAbsoluteExpired":      "Your session has expired. Please sign in again.",
+		"csrfTokenInvalid":            "The form has expired or was submitted from another site. Reload the page and try again.",
+		"loginChanged":                "Login has been changed.",
+		"loginUnchanged":              "New login is the same as the current one.",
+		"emailUnchanged":              "New email is the same as the current one.",
+		"emailChangeCodeSent":         "Confirmation code has been sent to the new email.",
+		"emailChanged":                "Email has been changed. A notification has been sent to the previous address.",
+		"emailChangeNotPending":       "There is no pending email change. Request a new code.",
+		"emailChangeAttemptsExceeded": "Too many wrong codes. The email change has been cancelled, try again later.",
+		"emailChangeUndone":           "Email change has been undone and all sessions have been signed out. We recommend resetting your password.",
+		"emailChangeUndoInvalid":      "The link is invalid or has expired.",
+		"phoneInvalid":                "Phone number is invalid",
+		"phoneAlreadyExist":           "This phone number is already used by another account.",
+		"phoneUnchanged":              "New phone number is the same as the current one.",
+		"phoneChangeCodeSent":         "Confirmation code has been sent to the new phone number.",
+		"phoneChanged":                "Phone number has been changed.",
+		"phoneChangeNotPending":       "There is no pending phone number change. Request a new code.",
+		"phoneRemoved":                "Phone number has been removed.",
+		"phoneNotSet":                 "No phone number is set.",
+		"smsUnavailable":              "Sending codes by SMS is not available. Choose email.",
+		"signInCodeSent":              "You are signing in from a new device. Enter the code sent to your email to confirm it's you.",
+		"signInCodeSentSMS":           "You are signing in from a new device. Enter the code sent to your phone by SMS to confirm it's you.",
+		"signUpPhoneConfirmed":        "Phone number confirmed. Now enter the code sent to your email.",
+		"signInCodeDeviceMismatch":    "The code was requested from another device. Sign in again.",
+		"signInCodeAttemptsExceeded":  "Too many wrong codes. Sign-in from a new device is blocked for a while, try again later.",
+		"signInCodeExpired":           "The code has expired. Sign in again.",
+		"securityAlertRevoked":        "All sessions have been signed out. If your account has a password, a reset link has been sent to your email.",
+		"securityAlertInvalid":        "The link is invalid, has expired or has already been used.",
+		"unsubscribed":                "You will no longer receive this notification. You can turn it back on in notification settings.",
+		"unsubscribeInvalid":          "The unsubscribe link is invalid or has expired.",
+		"currentPasswordWrong":        "Current password is wrong",
+		"tooManyAttempts":             "Too many failed attempts. Please try again later.",
+		"passwordsNotMatch":           "Passwords do not match",
+		"passwordUnchanged":           "New password is the same as the current one.",
+		"passwordChanged":             "Password has been changed.",
+		"passwordResetDone":           "Password has been set successfully.",
+		"accountDeletionLinkSent":     "A link to confirm account deletion has been sent to your email.",
+		"accountDeletionScheduled":    "Your account is scheduled for deletion and all sessions have been signed out. Sign in before the grace period ends to cancel the deletion.",
+		"accountDeletionLinkInvalid":  "The account deletion link is invalid or has expired.",
+		"yauthPasswordNotSet":         "Please sign in by Yandex and set password",
+		"passwordAlreadySet":          "Password has already been set. Use the change password form.",
+		"loginAndPasswordSet":         "Login and password have been set. You can now sign in with them or by Yandex.",
+		"accountDisabled":             "Your account has been disabled. Please contact support.",
+		"accountBanned":               "Your account has been banned.",
+		"accountStatusReason":         " Reason: %s.",
+		"accountStatusUntil":          " The restriction ends at %s.",
+		"accountStatusInvalid":        "Choose disabled or banned status and a whole number of days.",
+		"adminUserBanned":             "Account has been banned and all sessions have been signed out.",
+		"permissionRequired":          "You do not have permission to access this page.",
+		"adminSelfAction":             "You cannot disable your own account.",
+		"adminUserDisabled":           "Account has been disabled and all sessions have been signed out.",
+		"adminUserEnabled":            "Account has been enabled.",
+		"adminUserLoggedOut":          "All sessions of the account have been signed out.",
+		"adminPasswordResetSent":      "Password reset link has been sent to the user's email.",
+		"adminResetUnavailable":       "The account has no password sign-in. The user should sign in by Yandex and set a password.",
+		"adminEmailChanged":           "Email has been changed.",
+		"roleNotExist":                "Role does not exist.",
+		"roleGranted":                 "Role has been granted.",
+		"roleRevoked":                 "Role has been revoked.",
+		"adminSelfRoleRevoke":         "You cannot revoke your own role.",
+		"signUpClosed":                "Registration is closed.",
+		"inviteRequired":              "Registration is by invitation only. Enter your invite code.",
+		"inviteInvalid":               "The invite code is invalid, has already been used or has expired.",
+		"inviteEmailMismatch":         "This invite is for a different email address.",
+		"emailDomainNotAllowed":       "Registration with this email domain is not allowed.",
+		"disposableEmail":             "Registration with disposable email addresses is not allowed.",
+		"inviteCreated":               "Invite has been created.",
+		"inviteRevoked":               "Invite has been revoked.",
+		"inviteFormInvalid":           "Enter a valid email or leave it empty, and a whole number of days.",
+		"localeChanged":               "Language has been changed.",
+		"localeInvalid":               "Choose one of the offered languages.",
+		"notificationsSaved":          "Notification settings have been saved.",
+
+		// Общие надписи форм
+		"locale.en":               "English",
+		"locale.ru":               "Русский",
+		"form.or":                 "or",
+		"form.email":              "Email",
+		"form.phone":              "Phone (international format, e.g. +7 999 123-45-67)",
+		"form.login":              "Login",
+		"form.password":           "Password",
+		"form.newPassword":        "New Password",
+		"form.confirm":            "Confirm Password",
+		"form.current":            "Current Password",
+		"form.rememberMe":         "Remember me",
+		"form.loading":            "Loading...",
+		"form.days":               "Days (empty for no expiry)",
+		"nav.home":                "Home",
+		"nav.signIn":              "Sign In",
+		"nav.signUp":              "Sign Up",
+		"nav.users":               "Users",
+		"nav.invites":             "Invites",
+		"nav.resetPassword":       "Reset Password",
+		"nav.changeLogin":         "Change Login",
+		"nav.changeEmail":         "Change Email",
+		"nav.changePhone":         "Change Phone",
+		"nav.deleteAccount":       "Delete Account",
+		"nav.undoEmailChange":     "Undo Email Change",
+		"nav.templates":           "Templates",
+		"nav.notifications":       "Notifications",
+		"nav.securityAlertRevoke": "This Wasn't Me",
+		"nav.unsubscribe":         "Unsubscribe",
+
+		// Страницы
+		"signUp.title":           "Sign Up",
+		"signUp.retryAfter":      "Try again in %d s.",
+		"signUp.username":        "Username",
+		"signUp.inviteCode":      "Invite code",
+		"signUp.codeChannel":     "Send the verification code by",
+		"signUp.channelEmail":    "Email",
+		"signUp.channelSMS":      "SMS",
+		"signUp.yandex":          "Sign up with Yandex",
+		"signUp.haveAccount":     "Already have an account?",
+		"code.pageTitle":         "Verification Code",
+		"code.title":             "Verification",
+		"code.retryAfter":        "You can request a new code in %d s.",
+		"code.sent":              "We've sent a verification code to your email. Please enter it below.",
+		"code.sentSMS":           "We've sent a verification code to your phone by SMS. Please enter it below.",
+		"code.submit":            "Verify",
+		"code.notReceived":       "Didn't receive the code?",
+		"code.sendAgain":         "Send again",
+		"code.sendSMSInstead":    "Send the code by SMS instead",
+		"code.sendEmailInstead":  "Send the code to email instead",
+		"code.resendIn":          "Resend available in",
+		"code.seconds":           "s",
+		"signIn.title":           "Sign In",
+		"signIn.loginOrEmail":    "Username or Email",
+		"signIn.yandex":          "Sign in with Yandex",
+		"signIn.forgotPassword":  "Forgot your password?",
+		"signIn.noAccount":       "Don't have an account?",
+		"home.title":             "Home",
+		"home.welcome":           "Welcome",
+		"home.profile":           "Profile",
+		"home.signOut":           "Sign Out",
+		"home.signedIn":          "You have successfully signed in. You can now use all the features of the application.",
+		"reset.title":            "Password Reset",
+		"reset.enterEmail":       "Enter your email to reset your password.",
+		"reset.submit":           "Submit",
+		"reset.goToSignUp":       "Go to Sign-up Page",
+		"newPassword.title":      "Set New Password",
+		"newPassword.old":        "Old Password",
+		"newPassword.confirm":    "Confirm New Password",
+		"newPassword.submit":     "Set Password",
+		"forbidden.title":        "Forbidden",
+		"forbidden.back":         "Back to Sign In",
+		"profile.title":          "Profile",
+		"profile.codeSentTo":     "Code sent to %s",
+		"profile.confirmEmail":   "Confirm Email",
+		"profile.confirmPhone":   "Confirm Phone",
+		"profile.removePhone":    "Remove Phone",
+		"profile.signOutOthers":  "Sign out other sessions",
+		"profile.changePassword": "Change Password",
+		"profile.setPassword":    "Set a login and password to sign in without Yandex.",
+		"profile.setLoginAndPwd": "Set Login and Password",
+		"profile.export":         "Download My Data",
+		"profile.deleteByEmail":  "Confirm Deletion by Email",
+		"profile.language":       "Language",
+		"profile.changeLanguage": "Change Language",
+		"emailUndo.text":         "The previous email address will be restored and all sessions of the account will be signed out.",
+		"securityAlert.text":     "All sessions of the account will be signed out and a password reset link will be sent to your email.",
+		"unsubscribe.text":       "You will no longer receive this notification by email. Security notices are always sent.",
+		"deletion.text":          "The account will be deleted after the grace period and all sessions will be signed out. Sign in before then to cancel the deletion.",
+
+		// Настройки уведомлений
+		"notifications.title":                "Notification Settings",
+		"notifications.newDeviceLogin":       "Sign-in from a new device",
+		"notifications.suspiciousLogin":      "Suspicious sign-in",
+		"notifications.passwordChange":       "Password changed",
+		"notifications.emailChange":          "Email changed",
+		"notifications.passwordResetRequest": "Password reset requested",
+		"notifications.oauthLink":            "Sign-in method linked",
+		"notifications.sessionRevoke":        "All sessions signed out",
+		"notifications.accountLock":          "Account locked",
+		"notifications.securityDigest":       "Weekly security digest",
+		"notifications.critical":             "Security notice, always sent.",
+		"notifications.save":                 "Save",
+
+		// Страницы администратора
+		"admin.usersTitle":     "Admin: Users",
+		"admin.userTitle":      "Admin: User",
+		"admin.invitesTitle":   "Admin: Invites",
+		"admin.user":           "User",
+		"admin.loginOrEmail":   "Login or Email",
+		"admin.search":         "Search",
+		"admin.status":         "Status",
+		"admin.until":          "until %s",
+		"admin.roles":          "Roles",
+		"admin.passwordSet":    "set",
+		"admin.passwordNotSet": "not set",
+		"admin.deletion":       "Deletion",
+		"admin.deletionAfter":  "scheduled after %s",
+		"admin.enable":         "Enable Account",
+		"admin.reason":         "Reason",
+		"admin.disable":        "Disable Account",
+		"admin.signOutAll":     "Sign Out All Sessions",
+		"admin.sendReset":      "Send Password Reset Email",
+		"admin.role":           "Role",
+		"admin.grantRole":      "Grant Role",
+		"admin.revokeRole":     "Revoke %s",
+		"admin.sessions":       "Sessions",
+		"admin.userAgent":      "User Agent",
+		"admin.signedIn":       "Signed In",
+		"admin.lastActivity":   "Last Activity",
+		"admin.yandex":         "Yandex",
+		"admin.sessionEnded":   "ended",
+		"admin.sessionActive":  "active",
+		"admin.profileChanges": "Profile Changes",
+		"admin.field":          "Field",
+		"admin.oldValue":       "Old Value",
+		"admin.newValue":       "New Value",
+		"admin.changedAt":      "Changed At",
+		"admin.undone":         "undone",
+		"admin.codeSends":      "Auth Codes Sent",
+		"admin.sentAt":         "Sent At",
+		"admin.actions":        "Admin Actions",
+		"admin.action":         "Action",
+		"admin.detail":         "Detail",
+		"admin.admin":          "Admin",
+		"admin.at":             "At",
+		"admin.inviteEmail":    "Email (empty for any address)",
+		"admin.createInvite":   "Create Invite",
+		"admin.link":           "Link",
+		"admin.created":        "Created",
+		"admin.expires":        "Expires",
+		"admin.state":          "State",
+		"admin.inviteUsed":     "used %s by",
+		"admin.inviteRevoked":  "revoked",
+		"admin.inviteActive":   "active",
+		"admin.revoke":         "Revoke",
+		"admin.templatesTitle": "Admin: Templates",
+		"admin.templatesDir":   "Templates are loaded from %s",
+		"admin.templatesBuilt": "Embedded templates are used",
+		"admin.templatesLive":  "Changed files are reloaded without a restart",
+		"admin.pages":          "Pages",
+		"admin.emails":         "Emails",
+		"admin.textVersion":    "text",
+
+		// Письма
+		"mail.authCode.subject":          "Auth code",
+		"mail.authCode.title":            "Email Verification",
+		"mail.authCode.yourCode":         "Your verification code:",
+		"mail.authCode.enter":            "Enter this code to continue.",
+		"sms.authCode":                   "Your verification code: %s. Do not share it with anyone.",
+		"mail.suspiciousLogin.subject":   "Suspicious login alert!",
+		"mail.suspiciousLogin.title":     "Suspicious login attempt detected",
+		"mail.suspiciousLogin.from":      "Login attempt from: %s.",
+		"mail.suspiciousLogin.advice":    "If unauthorized, change your password immediately.",
+		"mail.passwordReset.subject":     "Password reset request",
+		"mail.passwordReset.title":       "Password Reset",
+		"mail.passwordReset.requested":   "You have requested a password reset. Open the link below to reset your password:",
+		"mail.passwordReset.fallback":    "If you don't see the button or it doesn't work, copy and paste this link into your browser:",
+		"mail.passwordReset.ignore":      "If you did not request a password reset, please ignore this email.",
+		"mail.newDeviceLogin.subject":    "New device login",
+		"mail.newDeviceLogin.title":      "New device login",
+		"mail.newDeviceLogin.detected":   "Detected a login from a new device.",
+		"mail.newDeviceLogin.advice":     "If this was not you, change your password.",
+		"mail.emailChange.subject":       "Email address changed",
+		"mail.emailChange.title":         "Email address changed",
+		"mail.emailChange.changed":       "The email address of your account has been changed to %s.",
+		"mail.emailChange.undo":          "If this was not you, undo the change. All sessions will be signed out:",
+		"mail.passwordChange.subject":    "Password changed",
+		"mail.passwordChange.title":      "Password changed",
+		"mail.passwordChange.changed":    "The password of your account has been changed.",
+		"mail.oauthLink.subject":         "Sign-in method linked",
+		"mail.oauthLink.title":           "Sign-in method linked",
+		"mail.oauthLink.text":            "A login and password have been linked to your Yandex account. You can now also sign in with them.",
+		"mail.sessionRevoke.subject":     "Sessions signed out",
+		"mail.sessionRevoke.title":       "Sessions signed out",
+		"mail.sessionRevoke.text":        "All sessions of your account have been signed out. Sign in again to continue.",
+		"mail.accountLock.subject":       "Account locked",
+		"mail.accountLock.title":         "Account locked",
+		"mail.accountLock.text":          "Your account has been locked and all sessions have been signed out.",
+		"mail.securityAlert.time":        "Time: %s",
+		"mail.securityAlert.ip":          "IP address: %s",
+		"mail.securityAlert.device":      "Device: %s",
+		"mail.securityAlert.byAdmin":     "The change was made by an administrator.",
+		"mail.securityAlert.revoke":      "If this was not you, sign out all sessions and reset your password:",
+		"mail.accountDeletion.subject":   "Account deletion request",
+		"mail.accountDeletion.title":     "Account deletion request",
+		"mail.accountDeletion.requested": "Deletion of your account has been requested. The link is valid for 15 minutes.",
+		"mail.accountDeletion.ignore":    "If this was not you, ignore this email and change your password.",
+		"mail.accountDeletion.confirm":   "Confirm Account Deletion",
+		"mail.securityDigest.subject":    "Weekly security digest",
+		"mail.securityDigest.title":      "Weekly security digest",
+		"mail.securityDigest.since":      "Account activity since %s:",
+		"mail.securityDigest.sessions":   "Sign-ins",
+		"mail.securityDigest.changes":    "Profile changes",
+		"mail.securityDigest.noActivity": "There were no sign-ins or profile changes.",
+		"mail.securityDigest.advice":     "If you do not recognize this activity, change your password.",
+		"mail.securityDigest.settings":   "Manage notifications:",
+	},
+	Ru: {
+		// Сообщения для пользователя
+		"loginInvalid":                "Некорректный логин",
+		"emailInvalid":                "Некорректный email",
+		"passwordInvalid":             "Некорректный пароль",
+		"captchaRequired":             "Пройдите проверку reCAPTCHA.",
+		"userAlreadyExist":            "Пользователь уже существует",
+		"userNotExist":                "Пользователь не найден",
+		"wrongCode":                   "Неверный код",
+		"failedMailSendingStatus":     "Не удалось отправить ссылку для сброса пароля",
+		"successfulMailSendingStatus": "Ссылка для сброса пароля отправлена",
+		"serverCodeHasBeenSend":       "Код подтверждения отправлен. Повторно отправить его можно через 1 минуту.",
+		"serverCodeSendCooldown":      "Код подтверждения уже отправлен. Подождите, прежде чем запрашивать новый.",
+		"serverCodeSendQuotaExceeded": "Для этого email запрошено слишком много кодов. Попробуйте позже.",
+		"serverCodeSendSessionLimit":  "Запрошено слишком много кодов. Начните заново.",
+		"sessionIdleExpired":          "Сеанс завершен из-за бездействия. Войдите снова.",
+		"sessionAbsoluteExpired":      "Срок действия сеанса истек. Войдите снова.",
+		"csrfTokenInvalid":            "Форма устарела или отправлена с другого сайта. Обновите страницу и попробуйте снова.",
+		"loginChanged":                "Логин изменен.",
+		"loginUnchanged":              "Новый логин совпадает с текущим.",
+		"emailUnchanged":              "Новый email совпадает с текущим.",
+		"emailChangeCodeSent":         "Код подтверждения отправлен на новый email.",
+		"emailChanged":                "Email изменен. Уведомление отправлено на прежний адрес.",
+		"emailChangeNotPending":       "Нет незавершенной смены email. Запросите новый код.",
+		"emailChangeAttemptsExceeded": "Слишком много неверных кодов. Смена email отменена, повторите попытку позже.",
+		"emailChangeUndone":           "Смена email отменена, все сеансы завершены. Рекомендуем сбросить пароль.",
+		"emailChangeUndoInvalid":      "Ссылка недействительна или устарела.",
+		"phoneInvalid":                "Некорректный номер телефона",
+		"phoneAlreadyExist":           "Этот номер телефона уже используется другим аккаунтом.",
+		"phoneUnchanged":              "Новый номер телефона совпадает с текущим.",
+		"phoneChangeCodeSent":         "Код подтверждения отправлен на новый номер телефона.",
+		"phoneChanged":                "Номер телефона изменен.",
+		"phoneChangeNotPending":       "Нет незавершенной смены номера телефона. Запросите новый код.",
+		"phoneRemoved":                "Номер телефона удален.",
+		"phoneNotSet":                 "Номер телефона не указан.",
+		"smsUnavailable":              "Отправка кодов в SMS недоступна. Выберите email.",
+		"signInCodeSent":              "Вы входите с нового устройства. Чтобы подтвердить, что это вы, введите код, отправленный на ваш email.",
+		"signInCodeSentSMS":           "Вы входите с нового устройства. Чтобы подтвердить, что это вы, введите код, отправленный в SMS на ваш телефон.",
+		"signUpPhoneConfirmed":        "Номер телефона подтвержден. Теперь введите код, отправленный на ваш email.",
+		"signInCodeDeviceMismatch":    "Код был запрошен с другого устройства. Войдите снова.",
+		"signInCodeAttemptsExceeded":  "Слишком много неверных кодов. Вход с нового устройства временно заблокирован, попробуйте позже.",
+		"signInCodeExpired":           "Срок действия кода истек. Войдите снова.",
+		"securityAlertRevoked":        "Все сеансы завершены. Если у аккаунта есть пароль, ссылка для его сброса отправлена на email.",
+		"securityAlertInvalid":        "Ссылка недействительна, устарела или уже использована.",
+		"unsubscribed":                "Вы больше не будете получать это уведомление. Его можно снова включить в настройках уведомлений.",
+		"unsubscribeInvalid":          "Ссылка для отписки недействительна или устарела.",
+		"currentPasswordWrong":        "Неверный текущий пароль",
+		"tooManyAttempts":             "Слишком много неудачных попыток. Повторите попытку позже.",
+		"passwordsNotMatch":           "Пароли не совпадают",
+		"passwordUnchanged":           "Новый пароль совпадает с текущим.",
+		"passwordChanged":             "Пароль изменен.",
+		"passwordResetDone":           "Новый пароль установлен.",
+		"accountDeletionLinkSent":     "Ссылка для подтверждения удаления аккаунта отправлена на ваш email.",
+		"accountDeletionScheduled":    "Аккаунт будет удален, все сеансы завершены. Чтобы отменить удаление, войдите до окончания срока ожидания.",
+		"accountDeletionLinkInvalid":  "Ссылка для удаления аккаунта недействительна или устарела.",
+		"yauthPasswordNotSet":         "Войдите через Яндекс и задайте пароль",
+		"passwordAlreadySet":          "Пароль уже задан. Воспользуйтесь формой смены пароля.",
+		"loginAndPasswordSet":         "Логин и пароль заданы. Теперь можно входить с ними или через Яндекс.",
+		"accountDisabled":             "Ваш аккаунт отключен. Обратитесь в поддержку.",
+		"accountBanned":               "Ваш аккаунт заблокирован.",
+		"accountStatusReason":         " Причина: %s.",
+		"accountStatusUntil":          " Ограничение действует до %s.",
+		"accountStatusInvalid":        "Выберите статус disabled или banned и целое число дней.",
+		"adminUserBanned":             "Аккаунт заблокирован, все сеансы завершены.",
+		"permissionRequired":          "У вас нет доступа к этой странице.",
+		"adminSelfAction":             "Нельзя отключить собственный аккаунт.",
+		"adminUserDisabled":           "Аккаунт отключен, все сеансы завершены.",
+		"adminUserEnabled":            "Аккаунт включен.",
+		"adminUserLoggedOut":          "Все сеансы аккаунта завершены.",
+		"adminPasswordResetSent":      "Ссылка для сброса пароля отправлена на email пользователя.",
+		"adminResetUnavailable":       "У аккаунта нет входа по паролю. Пользователю нужно войти через Яндекс и задать пароль.",
+		"adminEmailChanged":           "Email изменен.",
+		"roleNotExist":                "Роль не существует.",
+		"roleGranted":                 "Роль назначена.",
+		"roleRevoked":                 "Роль снята.",
+		"adminSelfRoleRevoke":         "Нельзя снять роль с самого себя.",
+		"signUpClosed":                "Регистрация закрыта.",
+		"inviteRequired":              "Регистрация только по приглашениям. Введите код приглашения.",
+		"inviteInvalid":               "Код приглашения недействителен, уже использован или устарел.",
+		"inviteEmailMismatch":         "Это приглашение выдано для другого email.",
+		"emailDomainNotAllowed":       "Регистрация с email этого домена запрещена.",
+		"disposableEmail":             "Регистрация с одноразовых email запрещена.",
+		"inviteCreated":               "Приглашение создано.",
+		"inviteRevoked":               "Приглашение отозвано.",
+		"inviteFormInvalid":           "Введите корректный email или оставьте поле пустым, и целое число дней.",
+		"localeChanged":               "Язык изменен.",
+		"localeInvalid":               "Выберите один из предложенных языков.",
+		"notificationsSaved":          "Настройки уведомлений сохранены.",
+
+		// Общие надписи форм
+		"locale.en":               "English",
+		"locale.ru":               "Русский",
+		"form.or":                 "или",
+		"form.email":              "Email",
+		"form.phone":              "Телефон (в международном формате, например +7 999 123-45-67)",
+		"form.login":              "Логин",
+		"form.password":           "Пароль",
+		"form.newPassword":        "Новый пароль",
+		"form.confirm":            "Подтвердите пароль",
+		"form.current":            "Текущий пароль",
+		"form.rememberMe":         "Запомнить меня",
+		"form.loading":            "Загрузка...",
+		"form.days":               "Дней (пусто - бессрочно)",
+		"nav.home":                "Главная",
+		"nav.signIn":              "Войти",
+		"nav.signUp":              "Зарегистрироваться",
+		"nav.users":               "Пользователи",
+		"nav.invites":             "Приглашения",
+		"nav.resetPassword":       "Сбросить пароль",
+		"nav.changeLogin":         "Изменить логин",
+		"nav.changeEmail":         "Изменить email",
+		"nav.changePhone":         "Изменить телефон",
+		"nav.deleteAccount":       "Удалить аккаунт",
+		"nav.undoEmailChange":     "Отменить смену email",
+		"nav.securityAlertRevoke": "Это был не я",
+		"nav.unsubscribe":         "Отписаться",
+		"nav.templates":           "Шаблоны",
+		"nav.notifications":       "Уведомления",
+
+		// Страницы
+		"signUp.title":           "Регистрация",
+		"signUp.retryAfter":      "Повторите через %d с.",
+		"signUp.username":        "Имя пользователя",
+		"signUp.inviteCode":      "Код приглашения",
+		"signUp.codeChannel":     "Отправить код подтверждения",
+		"signUp.channelEmail":    "На email",
+		"signUp.channelSMS":      "В SMS",
+		"signUp.yandex":          "Зарегистрироваться через Яндекс",
+		"signUp.haveAccount":     "Уже есть аккаунт?",
+		"code.pageTitle":         "Код подтверждения",
+		"code.title":             "Подтверждение",
+		"code.retryAfter":        "Новый код можно запросить через %d с.",
+		"code.sent":              "Мы отправили код подтверждения на ваш email. Введите его ниже.",
+		"code.sentSMS":           "Мы отправили код подтверждения в SMS на ваш телефон. Введите его ниже.",
+		"code.submit":            "Подтвердить",
+		"code.notReceived":       "Не получили код?",
+		"code.sendAgain":         "Отправить снова",
+		"code.sendSMSInstead":    "Получить код в SMS",
+		"code.sendEmailInstead":  "Получить код на email",
+		"code.resendIn":          "Повторная отправка через",
+		"code.seconds":           "с",
+		"signIn.title":           "Вход",
+		"signIn.loginOrEmail":    "Логин или email",
+		"signIn.yandex":          "Войти через Яндекс",
+		"signIn.forgotPassword":  "Забыли пароль?",
+		"signIn.noAccount":       "Нет аккаунта?",
+		"home.title":             "Главная",
+		"home.welcome":           "Добро пожаловать",
+		"home.profile":           "Профиль",
+		"home.signOut":           "Выйти",
+		"home.signedIn":          "Вы успешно вошли. Теперь вам доступны все возможности приложения.",
+		"reset.title":            "Сброс пароля",
+		"reset.enterEmail":       "Введите email, чтобы сбросить пароль.",
+		"reset.submit":           "Отправить",
+		"reset.goToSignUp":       "Перейти к регистрации",
+		"newPassword.title":      "Новый пароль",
+		"newPassword.old":        "Старый пароль",
+		"newPassword.confirm":    "Подтвердите новый пароль",
+		"newPassword.submit":     "Установить пароль",
+		"forbidden.title":        "Доступ запрещен",
+		"forbidden.back":         "Вернуться ко входу",
+		"profile.title":          "Профиль",
+		"profile.codeSentTo":     "Код отправлен на %s",
+		"profile.confirmEmail":   "Подтвердить email",
+		"profile.confirmPhone":   "Подтвердить телефон",
+		"profile.removePhone":    "Удалить телефон",
+		"profile.signOutOthers":  "Завершить другие сеансы",
+		"profile.changePassword": "Изменить пароль",
+		"profile.setPassword":    "Задайте логин и пароль, чтобы входить без Яндекса.",
+		"profile.setLoginAndPwd": "Задать логин и пароль",
+		"profile.export":         "Скачать мои данные",
+		"profile.deleteByEmail":  "Подтвердить удаление по email",
+		"profile.language":       "Язык",
+		"profile.changeLanguage": "Изменить язык",
+		"emailUndo.text":         "Прежний email будет восстановлен, а все сеансы аккаунта завершены.",
+		"securityAlert.text":     "Все сеансы аккаунта будут завершены, а ссылка для сброса пароля отправлена на email.",
+		"unsubscribe.text":       "Вы больше не будете получать это уведомление по email. Уведомления безопасности отправляются всегда.",
+		"deletion.text":          "Аккаунт будет удален по окончании срока ожидания, все сеансы будут завершены. Чтобы отменить удаление, войдите до этого срока.",
+
+		// Настройки уведомлений
+		"notifications.title":                "Настройки уведомлений",
+		"notifications.newDeviceLogin":       "Вход с нового устройства",
+		"notifications.suspiciousLogin":      "Подозрительный вход",
+		"notifications.passwordChange":       "Смена пароля",
+		"notifications.emailChange":          "Смена email",
+		"notifications.passwordResetRequest": "Запрос сброса пароля",
+		"notifications.oauthLink":            "Привязка способа входа",
+		"notifications.sessionRevoke":        "Завершение всех сеансов",
+		"notifications.accountLock":          "Блокировка аккаунта",
+		"notifications.securityDigest":       "Еженедельная сводка безопасности",
+		"notifications.critical":             "Уведомление безопасности, отправляется всегда.",
+		"notifications.save":                 "Сохранить",
+
+		// Страницы администратора
+		"admin.usersTitle":     "Администрирование: пользователи",
+		"admin.userTitle":      "Администрирование: пользователь",
+		"admin.invitesTitle":   "Администрирование: приглашения",
+		"admin.user":           "Пользователь",
+		"admin.loginOrEmail":   "Логин или email",
+		"admin.search":         "Найти",
+		"admin.status":         "Статус",
+		"admin.until":          "до %s",
+		"admin.roles":          "Роли",
+		"admin.passwordSet":    "задан",
+		"admin.passwordNotSet": "не задан",
+		"admin.deletion":       "Удаление",
+		"admin.deletionAfter":  "запланировано после %s",
+		"admin.enable":         "Включить аккаунт",
+		"admin.reason":         "Причина",
+		"admin.disable":        "Отключить аккаунт",
+		"admin.signOutAll":     "Завершить все сеансы",
+		"admin.sendReset":      "Отправить письмо для сброса пароля",
+		"admin.role":           "Роль",
+		"admin.grantRole":      "Назначить роль",
+		"admin.revokeRole":     "Снять роль %s",
+		"admin.sessions":       "Сеансы",
+		"admin.userAgent":      "User Agent",
+		"admin.signedIn":       "Вход",
+		"admin.lastActivity":   "Последняя активность",
+		"admin.yandex":         "Яндекс",
+		"admin.sessionEnded":   "завершен",
+		"admin.sessionActive":  "активен",
+		"admin.profileChanges": "Изменения профиля",
+		"admin.field":          "Поле",
+		"admin.oldValue":       "Прежнее значение",
+		"admin.newValue":       "Новое значение",
+		"admin.changedAt":      "Изменено",
+		"admin.undone":         "отменено",
+		"admin.codeSends":      "Отправленные коды",
+		"admin.sentAt":         "Отправлен",
+		"admin.actions":        "Действия администраторов",
+		"admin.action":         "Действие",
+		"admin.detail":         "Подробности",
+		"admin.admin":          "Администратор",
+		"admin.at":             "Время",
+		"admin.inviteEmail":    "Email (пусто - любой адрес)",
+		"admin.createInvite":   "Создать приглашение",
+		"admin.link":           "Ссылка",
+		"admin.created":        "Создано",
+		"admin.expires":        "Истекает",
+		"admin.state":          "Состояние",
+		"admin.inviteUsed":     "использовано %s пользователем",
+		"admin.inviteRevoked":  "отозвано",
+		"admin.inviteActive":   "действует",
+		"admin.revoke":         "Отозвать",
+		"admin.templatesTitle": "Администрирование: шаблоны",
+		"admin.templatesDir":   "Шаблоны загружены из %s",
+		"admin.templatesBuilt": "Используются встроенные шаблоны",
+		"admin.templatesLive":  "Измененные файлы загружаются без перезапуска",
+		"admin.pages":          "Страницы",
+		"admin.emails":         "Письма",
+		"admin.textVersion":    "текст",
+
+		// Письма
+		"mail.authCode.subject":          "Код подтверждения",
+		"mail.authCode.title":            "Подтверждение email",
+		"mail.authCode.yourCode":         "Ваш код подтверждения:",
+		"mail.authCode.enter":            "Введите этот код, чтобы продолжить.",
+		"sms.authCode":                   "Ваш код подтверждения: %s. Никому его не сообщайте.",
+		"mail.suspiciousLogin.subject":   "Подозрительный вход!",
+		"mail.suspiciousLogin.title":     "Обнаружена подозрительная попытка входа",
+		"mail.suspiciousLogin.from":      "Попытка входа с устройства: %s.",
+		"mail.suspiciousLogin.advice":    "Если это были не вы, немедленно смените пароль.",
+		"mail.passwordReset.subject":     "Запрос на сброс пароля",
+		"mail.passwordReset.title":       "Сброс пароля",
+		"mail.passwordReset.requested":   "Вы запросили сброс пароля. Чтобы сбросить пароль, откройте ссылку ниже:",
+		"mail.passwordReset.fallback":    "Если кнопка не отображается или не работает, скопируйте ссылку в адресную строку браузера:",
+		"mail.passwordReset.ignore":      "Если вы не запрашивали сброс пароля, просто проигнорируйте это письмо.",
+		"mail.newDeviceLogin.subject":    "Вход с нового устройства",
+		"mail.newDeviceLogin.title":      "Вход с нового устройства",
+		"mail.newDeviceLogin.detected":   "Обнаружен вход в аккаунт с нового устройства.",
+		"mail.newDeviceLogin.advice":     "Если это были не вы, смените пароль.",
+		"mail.emailChange.subject":       "Email изменен",
+		"mail.emailChange.title":         "Email изменен",
+		"mail.emailChange.changed":       "Email вашего аккаунта изменен на %s.",
+		"mail.emailChange.undo":          "Если это были не вы, отмените изменение. Все сеансы будут завершены:",
+		"mail.passwordChange.subject":    "Пароль изменен",
+		"mail.passwordChange.title":      "Пароль изменен",
+		"mail.passwordChange.changed":    "Пароль вашего аккаунта изменен.",
+		"mail.oauthLink.subject":         "Привязан способ входа",
+		"mail.oauthLink.title":           "Привязан способ входа",
+		"mail.oauthLink.text":            "К вашему аккаунту Яндекса привязаны логин и пароль. Теперь вы можете входить и с ними.",
+		"mail.sessionRevoke.subject":     "Сеансы завершены",
+		"mail.sessionRevoke.title":       "Сеансы завершены",
+		"mail.sessionRevoke.text":        "Все сеансы вашего аккаунта завершены. Войдите снова, чтобы продолжить.",
+		"mail.accountLock.subject":       "Аккаунт заблокирован",
+		"mail.accountLock.title":         "Аккаунт заблокирован",
+		"mail.accountLock.text":          "Ваш аккаунт заблокирован, все сеансы завершены.",
+		"mail.securityAlert.time":        "Время: %s",
+		"mail.securityAlert.ip":          "IP-адрес: %s",
+		"mail.securityAlert.device":      "Устройство: %s",
+		"mail.securityAlert.byAdmin":     "Изменение выполнил администратор.",
+		"mail.securityAlert.revoke":      "Если это были не вы, завершите все сеансы и сбросьте пароль:",
+		"mail.accountDeletion.subject":   "Запрос на удаление аккаунта",
+		"mail.accountDeletion.title":     "Запрос на удаление аккаунта",
+		"mail.accountDeletion.requested": "Запрошено удаление вашего аккаунта. Ссылка действительна 15 минут.",
+		"mail.accountDeletion.ignore":    "Если это были не вы, проигнорируйте письмо и смените пароль.",
+		"mail.accountDeletion.confirm":   "Подтвердить удаление аккаунта",
+		"mail.securityDigest.subject":    "Еженедельная сводка безопасности",
+		"mail.securityDigest.title":      "Еженедельная сводка безопасности",
+		"mail.securityDigest.since":      "Активность в аккаунте с %s:",
+		"mail.securityDigest.sessions":   "Входы",
+		"mail.securityDigest.changes":    "Изменения профиля",
+		"mail.securityDigest.noActivity": "Входов и изменений профиля не было.",
+		"mail.securityDigest.advice":     "Если вы не узнаете эту активность, смените пароль.",
+		"mail.securityDigest.settings":   "Настроить уведомления:",
+	},
+}
+
+var requirements = map[string]map[string][]string{
+	En: {
+		"loginInvalid": {
+			"3-30 characters long",
+			"Latin or Cyrillic letters",
+			"Numbers 0-9",
+		},
+		"emailInvalid": {
+			"Must contain Latin letters, numbers and allowed special characters: . _ % + -",
+			"Must contain exactly one '@' symbol",
+			"Domain must be valid and end with .com, .org, etc.",
+		},
+		"phoneInvalid": {
+			"Starts with + and the country code",
+			"8 to 15 digits",
+			"Digits may be separated by spaces, dashes or brackets",
+		},
+		"passwordInvalid": {
+			"8-30 characters long",
+			"Latin letters only",
+			"Numbers 0-9",
+			"Special symbols: !@#$%^&*",
+		},
+	},
+	Ru: {
+		"loginInvalid": {
+			"От 3 до 30 символов",
+			"Латинские или кириллические буквы",
+			"Цифры 0-9",
+		},
+		"emailInvalid": {
+			"Латинские буквы, цифры и допустимые символы: . _ % + -",
+			"Ровно один символ '@'",
+			"Существующий домен, например .com или .org",
+		},
+		"phoneInvalid": {
+			"Начинается с + и кода страны",
+			"От 8 до 15 цифр",
+			"Цифры можно разделять пробелами, дефисами или скобками",
+		},
+		"passwordInvalid": {
+			"От 8 до 30 символов",
+			"Только латинские буквы",
+			"Цифры 0-9",
+			"Специальные символы: !@#$%^&*",
+		},
+	},
+}
@@ -0,0 +1,40 @@
+// Package i18n предоставляет тесты для каталога сообщений и выбора языка.
+//
+// Файл тестирует полноту каталога переводов.
+package i18n
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestCatalogComplete проверяет, что каталог переведен на все языки.
+// Ожидается: у каждого языка тот же набор непустых текстов и требований, что у английского.
+func TestCatalogComplete(t *testing.T) {
+	for _, locale := range Locales {
+		texts, ok := catalog[locale]
+		if !assert.True(t, ok, locale) {
+			continue
+		}
+		assert.Len(t, texts, len(catalog[En]), locale)
+		for key := range catalog[En] {
+			assert.NotEmpty(t, strings.TrimSpace(texts[key]), locale+": "+key)
+			assert.Equal(t, strings.Count(catalog[En][key], "%"), strings.Count(texts[key], "%"), locale+": "+key)
+		}
+
+		assert.Len(t, requirements[locale], len(requirements[En]), locale)
+		for key, reqs := range requirements[En] {
+			assert.Len(t, requirements[locale][key], len(reqs), locale+": "+key)
+		}
+	}
+}
+
+// TestCatalogLocaleNames проверяет названия языков для переключателя в профиле.
+// Ожидается: для каждого поддерживаемого языка есть название.
+func TestCatalogLocaleNames(t *testing.T) {
+	for _, locale := range Locales {
+		assert.True(t, Has("locale."+locale), locale)
+	}
+}
@@ -0,0 +1,185 @@
+// Package i18n предоставляет каталог сообщений и выбор языка интерфейса.
+//
+// Файл содержит:
+//   - Text и Requirements: переводы сообщений, надписей страниц и писем из каталога
+//   - Msg и Reqs: то же на языке запроса
+//   - Locale: язык запроса
+//   - Middleware: выбирает язык для каждого запроса
+//
+// Язык выбирается в порядке: параметр lang (сохраняется в cookie), cookie с языком
+// (в нее же при входе переносится язык из профиля), заголовок Accept-Language,
+// язык по умолчанию DEFAULT_LOCALE.
+package i18n
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+)
+
+// Поддерживаемые языки.
+const (
+	En = "en"
+	Ru = "ru"
+)
+
+// Locales - поддерживаемые языки в порядке показа в профиле.
+var Locales = []string{En, Ru}
+
+// DefaultLocale возвращает язык по умолчанию.
+//
+// Использует переменную окружения DEFAULT_LOCALE (по умолчанию en);
+// неподдерживаемое значение заменяется на en.
+func DefaultLocale() string {
+	if locale, ok := Match(os.Getenv("DEFAULT_LOCALE")); ok {
+		return locale
+	}
+	return En
+}
+
+// Match возвращает поддерживаемый язык для языкового тега (ru, ru-RU, EN_us).
+func Match(tag string) (string, bool) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := catalog[tag]; ok {
+		return tag, true
+	}
+	return "", false
+}
+
+// Text возвращает текст по ключу key на языке locale.
+//
+// Если перевода нет, возвращает текст на английском, а если нет и его - сам ключ.
+// С аргументами args текст используется как формат fmt.Sprintf.
+func Text(locale, key string, args ...any) string {
+	text, ok := catalog[locale][key]
+	if !ok {
+		text, ok = catalog[En][key]
+	}
+	if !ok {
+		return key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Requirements возвращает требования к вводу для сообщения key на языке locale
+// или nil, если у сообщения нет требований.
+func Requirements(locale, key string) []string {
+	if reqs, ok := requirements[locale][key]; ok {
+		return reqs
+	}
+	return requirements[En][key]
+}
+
+// Has проверяет, что в каталоге есть текст с ключом key.
+//
+// Используется для ключей сообщений из параметра msg: неизвестные ключи игнорируются.
+func Has(key string) bool {
+	_, ok := catalog[En][key]
+	return ok
+}
+
+// Msg возвращает текст по ключу key на языке запроса r.
+func Msg(r *http.Request, key string, args ...any) string {
+	return Text(Locale(r), key, args...)
+}
+
+// Reqs возвращает требования к вводу для сообщения key на языке запроса r.
+func Reqs(r *http.Request, key string) []string {
+	return Requirements(Locale(r), key)
+}
+
+// Locale возвращает язык запроса.
+//
+// Берет язык, выбранный Middleware; если middleware не применялся, выбирает его сам.
+func Locale(r *http.Request) string {
+	if locale, ok := r.Context().Value(consts.LocaleCtxKey).(string); ok {
+		return locale
+	}
+	return requestLocale(r)
+}
+
+// FromHeader возвращает язык ответа из заголовка Content-Language, установленного Middleware,
+// или язык по умолчанию.
+func FromHeader(header http.Header) string {
+	if locale, ok := Match(header.Get("Content-Language")); ok {
+		return locale
+	}
+	return DefaultLocale()
+}
+
+// Middleware выбирает язык запроса и кладет его в контекст.
+//
+// Язык из параметра lang сохраняется в cookie, чтобы переключатель языка действовал
+// на следующих страницах. Выбранный язык указывается в заголовке Content-Language.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if locale, ok := Match(r.URL.Query().Get("lang")); ok && locale != data.GetLocaleFromCookies(r) {
+			data.SetLocaleInCookies(w, locale)
+		}
+
+		locale := requestLocale(r)
+		w.Header().Set("Content-Language", locale)
+		w.Header().Add("Vary", "Accept-Language, Cookie")
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), consts.LocaleCtxKey, locale)))
+	})
+}
+
+// requestLocale выбирает язык по параметру lang, cookie и Accept-Language.
+func requestLocale(r *http.Request) string {
+	if locale, ok := Match(r.URL.Query().Get("lang")); ok {
+		return locale
+	}
+	if locale, ok := Match(data.GetLocaleFromCookies(r)); ok {
+		return locale
+	}
+	if locale, ok := acceptLanguage(r.Header.Get("Accept-Language")); ok {
+		return locale
+	}
+	return DefaultLocale()
+}
+
+// acceptLanguage выбирает поддерживаемый язык с наибольшим весом q из заголовка Accept-Language.
+//
+// Языки с одинаковым весом выбираются в порядке перечисления, q=0 означает отказ от языка.
+func acceptLanguage(header string) (string, bool) {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+
+	for _, tag := range tags {
+		if locale, ok := Match(tag.tag); ok {
+			return locale, true
+		}
+	}
+	return "", false
+}
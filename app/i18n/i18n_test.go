@@ -0,0 +1,153 @@
+// Package i18n предоставляет тесты для каталога сообщений и выбора языка.
+//
+// Файл тестирует выбор языка запроса и получение текстов из каталога.
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMatch проверяет сопоставление языковых тегов с поддерживаемыми языками.
+// Ожидается: регион и регистр игнорируются, неподдерживаемый язык не находится.
+func TestMatch(t *testing.T) {
+	tests := map[string]string{
+		"ru":    Ru,
+		"ru-RU": Ru,
+		"EN_us": En,
+		" en ":  En,
+		"de":    "",
+		"":      "",
+	}
+	for tag, want := range tests {
+		locale, ok := Match(tag)
+		assert.Equal(t, want, locale, tag)
+		assert.Equal(t, want != "", ok, tag)
+	}
+}
+
+// TestDefaultLocale проверяет язык по умолчанию.
+// Ожидается: используется DEFAULT_LOCALE, неподдерживаемое значение заменяется на en.
+func TestDefaultLocale(t *testing.T) {
+	t.Setenv("DEFAULT_LOCALE", "")
+	assert.Equal(t, En, DefaultLocale())
+
+	t.Setenv("DEFAULT_LOCALE", "ru-RU")
+	assert.Equal(t, Ru, DefaultLocale())
+
+	t.Setenv("DEFAULT_LOCALE", "de")
+	assert.Equal(t, En, DefaultLocale())
+}
+
+// TestText проверяет получение текста из каталога.
+// Ожидается: текст на нужном языке, форматирование аргументов, запасной английский текст и ключ.
+func TestText(t *testing.T) {
+	assert.Equal(t, "User does not exist", Text(En, "userNotExist"))
+	assert.NotEqual(t, Text(En, "userNotExist"), Text(Ru, "userNotExist"))
+	assert.Equal(t, Text(En, "userNotExist"), Text("de", "userNotExist"))
+	assert.Equal(t, " Reason: spam.", Text(En, "accountStatusReason", "spam"))
+	assert.Equal(t, "unknownKey", Text(Ru, "unknownKey"))
+}
+
+// TestRequirements проверяет получение требований к вводу.
+// Ожидается: требования есть у сообщений об ошибках ввода и отсутствуют у остальных.
+func TestRequirements(t *testing.T) {
+	assert.NotEmpty(t, Requirements(En, "passwordInvalid"))
+	assert.NotEmpty(t, Requirements(Ru, "passwordInvalid"))
+	assert.Equal(t, Requirements(En, "loginInvalid"), Requirements("de", "loginInvalid"))
+	assert.Nil(t, Requirements(En, "userNotExist"))
+}
+
+// TestHas проверяет проверку ключей сообщений.
+// Ожидается: true только для ключей из каталога.
+func TestHas(t *testing.T) {
+	assert.True(t, Has("userNotExist"))
+	assert.False(t, Has("<script>alert(1)</script>"))
+}
+
+// TestAcceptLanguage проверяет разбор заголовка Accept-Language.
+// Ожидается: выбирается поддерживаемый язык с наибольшим весом, q=0 исключает язык.
+func TestAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "ru-RU,ru;q=0.9,en;q=0.8", want: Ru},
+		{header: "en;q=0.5, ru;q=0.8", want: Ru},
+		{header: "de, en;q=0.1", want: En},
+		{header: "ru;q=0, en;q=0.1", want: En},
+		{header: "ru, en", want: Ru},
+		{header: "ru;q=abc", want: ""},
+		{header: "de", want: ""},
+		{header: "", want: ""},
+	}
+	for _, tt := range tests {
+		locale, ok := acceptLanguage(tt.header)
+		assert.Equal(t, tt.want, locale, tt.header)
+		assert.Equal(t, tt.want != "", ok, tt.header)
+	}
+}
+
+// TestMiddleware проверяет выбор языка запроса.
+// Ожидается: язык из lang сохраняется в cookie и имеет приоритет над cookie и Accept-Language,
+// язык попадает в контекст и заголовок Content-Language.
+func TestMiddleware(t *testing.T) {
+	var got string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = Locale(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/sign-in?lang=ru", nil)
+	r.Header.Set("Accept-Language", "en")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, Ru, got)
+	assert.Equal(t, Ru, w.Header().Get("Content-Language"))
+	assert.Equal(t, Ru, FromHeader(w.Header()))
+	assert.Contains(t, w.Header().Get("Vary"), "Accept-Language")
+	cookies := w.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, Ru, cookies[0].Value)
+	}
+
+	// Cookie с языком важнее Accept-Language и не перезаписывается без lang
+	r = httptest.NewRequest(http.MethodGet, "/sign-in", nil)
+	r.Header.Set("Accept-Language", "en")
+	r.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, Ru, got)
+	assert.Empty(t, w.Result().Cookies())
+
+	r = httptest.NewRequest(http.MethodGet, "/sign-in?lang=de", nil)
+	r.Header.Set("Accept-Language", "ru;q=0.5, en;q=0.9")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, En, got)
+	assert.Empty(t, w.Result().Cookies())
+}
+
+// TestLocale проверяет язык запроса без Middleware.
+// Ожидается: язык из контекста, иначе выбранный по запросу, иначе язык по умолчанию.
+func TestLocale(t *testing.T) {
+	t.Setenv("DEFAULT_LOCALE", "")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, En, Locale(r))
+	assert.Equal(t, Text(En, "wrongCode"), Msg(r, "wrongCode"))
+
+	r.Header.Set("Accept-Language", "ru")
+	assert.Equal(t, Ru, Locale(r))
+	assert.Equal(t, Text(Ru, "wrongCode"), Msg(r, "wrongCode"))
+	assert.Equal(t, Requirements(Ru, "emailInvalid"), Reqs(r, "emailInvalid"))
+
+	r = r.WithContext(context.WithValue(r.Context(), consts.LocaleCtxKey, En))
+	assert.Equal(t, En, Locale(r))
+
+	assert.Equal(t, En, FromHeader(http.Header{}))
+}
@@ -0,0 +1,233 @@
+// Package keyring предоставляет ключи подписи с поддержкой ротации.
+//
+// Файл содержит функции для асимметричных ключей JWT:
+//   - loadPrivateKeyFile: загружает закрытый ключ RS256 или EdDSA из PEM файла
+//   - thumbprint: вычисляет kid как отпечаток открытого ключа (RFC 7638)
+//   - JWKS: формирует набор открытых ключей для публикации
+//   - ImportKey: добавляет в связку ключ из PEM файла
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+type cachedPrivateKey struct {
+	modTime time.Time
+	key     JWTKey
+}
+
+var (
+	privateKeysMu sync.Mutex
+	privateKeys   = map[string]cachedPrivateKey{}
+)
+
+// loadPrivateKeyFile загружает закрытый ключ из PEM файла.
+//
+// Поддерживает RS256 (PKCS#1 или PKCS#8) и EdDSA (Ed25519, PKCS#8).
+// Разобранный ключ кешируется до изменения файла.
+func loadPrivateKeyFile(alg, path string) (JWTKey, error) {
+	if path == "" {
+		return JWTKey{}, errors.Errorf("private key file is not set for %s", alg)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+
+	cacheKey := alg + ":" + path
+	privateKeysMu.Lock()
+	defer privateKeysMu.Unlock()
+
+	if cachedKey, ok := privateKeys[cacheKey]; ok && cachedKey.modTime.Equal(info.ModTime()) {
+		return cachedKey.key, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+
+	var jwtKey JWTKey
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(content)
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		jwtKey = JWTKey{Method: jwt.SigningMethodRS256, SignKey: privateKey, VerifyKey: &privateKey.PublicKey}
+	case jwt.SigningMethodEdDSA.Alg():
+		parsed, err := jwt.ParseEdPrivateKeyFromPEM(content)
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		privateKey, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return JWTKey{}, errors.New("private key is not an Ed25519 key")
+		}
+		jwtKey = JWTKey{Method: jwt.SigningMethodEdDSA, SignKey: privateKey, VerifyKey: privateKey.Public().(ed25519.PublicKey)}
+	default:
+		return JWTKey{}, errors.Errorf("unsupported signing algorithm: %s", alg)
+	}
+
+	privateKeys[cacheKey] = cachedPrivateKey{modTime: info.ModTime(), key: jwtKey}
+	return jwtKey, nil
+}
+
+// publicJWK возвращает открытый ключ в формате JWK без kid и alg.
+func publicJWK(publicKey interface{}) (structs.JWK, error) {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return structs.JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return structs.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+		}, nil
+	}
+	return structs.JWK{}, errors.New("unsupported public key type")
+}
+
+// thumbprint вычисляет отпечаток открытого ключа по RFC 7638.
+func thumbprint(publicKey interface{}) (string, error) {
+	jwk, err := publicJWK(publicKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var members interface{}
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256(canonical)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWKS формирует набор открытых ключей для проверки JWT сторонними сервисами.
+//
+// Включает основной и активные асимметричные ключи связки и ключ из
+// JWT_PRIVATE_KEY_FILE, если JWT_SIGNING_ALG задает RS256 или EdDSA.
+// Ключи HS256 не публикуются.
+var JWKS = func() (structs.JWKS, error) {
+	keyring, err := Load()
+	if err != nil {
+		return structs.JWKS{}, errors.WithStack(err)
+	}
+
+	jwks := structs.JWKS{Keys: []structs.JWK{}}
+	add := func(jwtKey JWTKey) error {
+		jwk, err := publicJWK(jwtKey.VerifyKey)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		jwk.Kid = jwtKey.Kid
+		jwk.Alg = jwtKey.Method.Alg()
+		jwk.Use = "sig"
+		jwks.Keys = append(jwks.Keys, jwk)
+		return nil
+	}
+
+	for _, key := range keyring.JWT {
+		if key.Status == StatusRetired || key.Alg == "" || key.Alg == jwt.SigningMethodHS256.Alg() {
+			continue
+		}
+		jwtKey, err := jwtKeyFromSigningKey(key)
+		if err != nil {
+			return structs.JWKS{}, errors.WithStack(err)
+		}
+		if err := add(jwtKey); err != nil {
+			return structs.JWKS{}, errors.WithStack(err)
+		}
+	}
+
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" && alg != jwt.SigningMethodHS256.Alg() {
+		envKey, err := envJWTKey()
+		if err != nil {
+			return structs.JWKS{}, errors.WithStack(err)
+		}
+		if err := add(envKey); err != nil {
+			return structs.JWKS{}, errors.WithStack(err)
+		}
+	}
+
+	return jwks, nil
+}
+
+// ImportKey добавляет в набор jwt асимметричный ключ из PEM файла.
+//
+// kid вычисляется как отпечаток открытого ключа. Как и в AddKey, ключ становится
+// основным, только если в наборе нет основного ключа, иначе добавляется активным,
+// чтобы открытый ключ появился в JWKS до начала подписи им.
+func ImportKey(keyring *structs.Keyring, alg, path string, now int64) (structs.SigningKey, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	jwtKey, err := loadPrivateKeyFile(alg, path)
+	if err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	kid, err := thumbprint(jwtKey.VerifyKey)
+	if err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	for _, existing := range keyring.JWT {
+		if existing.Kid == kid {
+			return structs.SigningKey{}, errors.Errorf("key %s already exists", kid)
+		}
+	}
+
+	key := structs.SigningKey{
+		Kid:            kid,
+		Alg:            alg,
+		PrivateKeyFile: path,
+		Status:         StatusPrimary,
+		CreatedAt:      now,
+	}
+	for _, existing := range keyring.JWT {
+		if existing.Status == StatusPrimary {
+			key.Status = StatusActive
+			break
+		}
+	}
+
+	keyring.JWT = append(keyring.JWT, key)
+	return key, nil
+}
@@ -0,0 +1,138 @@
+// Package keyring предоставляет ключи подписи с поддержкой ротации.
+//
+// Файл тестирует асимметричные ключи JWT и формирование JWKS.
+package keyring
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePrivateKeyPEM генерирует закрытый ключ алгоритма alg и сохраняет его в PEM файл PKCS#8.
+func writePrivateKeyPEM(t *testing.T, alg string) string {
+	t.Helper()
+
+	var privateKey interface{}
+	switch alg {
+	case "RS256":
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		privateKey = rsaKey
+	case "EdDSA":
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		privateKey = edKey
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), alg+".pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+// TestLoadPrivateKeyFile проверяет загрузку закрытых ключей RS256 и EdDSA.
+// Ожидается: ключи подписи и проверки нужного типа, ошибка для неизвестного алгоритма и пустого пути.
+func TestLoadPrivateKeyFile(t *testing.T) {
+	rsaKey, err := loadPrivateKeyFile("RS256", writePrivateKeyPEM(t, "RS256"))
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256, rsaKey.Method)
+	assert.IsType(t, &rsa.PublicKey{}, rsaKey.VerifyKey)
+
+	edKey, err := loadPrivateKeyFile("EdDSA", writePrivateKeyPEM(t, "EdDSA"))
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodEdDSA, edKey.Method)
+	assert.IsType(t, ed25519.PublicKey{}, edKey.VerifyKey)
+
+	_, err = loadPrivateKeyFile("EdDSA", writePrivateKeyPEM(t, "RS256"))
+	assert.Error(t, err)
+	_, err = loadPrivateKeyFile("HS512", writePrivateKeyPEM(t, "RS256"))
+	assert.Error(t, err)
+	_, err = loadPrivateKeyFile("RS256", "")
+	assert.Error(t, err)
+}
+
+// TestImportKeyAndJWKS проверяет импорт асимметричных ключей и публикацию JWKS.
+// Ожидается: kid - отпечаток ключа, второй ключ активный, JWKS без HS256 и выведенных ключей.
+func TestImportKeyAndJWKS(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("JWT_SECRET", "env-secret")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	var keyring structs.Keyring
+	_, err := AddKey(&keyring, SetJWT, 1700000000)
+	require.NoError(t, err)
+
+	rsaPath := writePrivateKeyPEM(t, "RS256")
+	rsaKey, err := ImportKey(&keyring, "RS256", rsaPath, 1700000001)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, rsaKey.Status)
+	assert.Equal(t, "RS256", rsaKey.Alg)
+	_, err = ImportKey(&keyring, "RS256", rsaPath, 1700000002)
+	assert.Error(t, err, "Повторный импорт того же ключа должен отклоняться")
+
+	edKey, err := ImportKey(&keyring, "EdDSA", writePrivateKeyPEM(t, "EdDSA"), 1700000003)
+	require.NoError(t, err)
+	require.NoError(t, Save(path, keyring))
+
+	jwks, err := JWKS()
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, structs.JWK{Kty: "RSA", Kid: rsaKey.Kid, Use: "sig", Alg: "RS256", N: jwks.Keys[0].N, E: "AQAB"}, jwks.Keys[0])
+	assert.Equal(t, "OKP", jwks.Keys[1].Kty)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Crv)
+	assert.Equal(t, edKey.Kid, jwks.Keys[1].Kid)
+
+	require.NoError(t, PromoteKey(&keyring, SetJWT, edKey.Kid))
+	require.NoError(t, RetireKey(&keyring, SetJWT, rsaKey.Kid))
+	require.NoError(t, Save(path, keyring))
+
+	signingKey, err := JWTSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, edKey.Kid, signingKey.Kid)
+	assert.Equal(t, jwt.SigningMethodEdDSA, signingKey.Method)
+
+	jwks, err = JWKS()
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, edKey.Kid, jwks.Keys[0].Kid)
+}
+
+// TestEnvAsymmetricKey проверяет асимметричный ключ из переменных окружения.
+// Ожидается: kid - отпечаток ключа, ключ проверяется по kid и публикуется в JWKS, JWT_SECRET остается ключом "env".
+func TestEnvAsymmetricKey(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "env-secret")
+	t.Setenv("JWT_SIGNING_ALG", "RS256")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writePrivateKeyPEM(t, "RS256"))
+
+	signingKey, err := JWTSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256, signingKey.Method)
+	assert.NotEqual(t, EnvKid, signingKey.Kid)
+
+	verificationKey, err := JWTVerificationKey(signingKey.Kid)
+	require.NoError(t, err)
+	assert.Equal(t, signingKey.VerifyKey, verificationKey.VerifyKey)
+
+	legacyKey, err := JWTVerificationKey(EnvKid)
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodHS256, legacyKey.Method)
+
+	jwks, err := JWKS()
+	require.NoError(t, err)
+	require.Len(t, jwks.Keys, 1)
+	assert.Equal(t, signingKey.Kid, jwks.Keys[0].Kid)
+}
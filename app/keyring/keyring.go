@@ -0,0 +1,508 @@
+// Package keyring предоставляет ключи подписи с поддержкой ротации.
+//
+// Файл содержит функции работы со связкой ключей:
+//   - Load: загружает связку ключей из файла KEYRING_FILE
+//   - Save: атомарно сохраняет связку ключей в файл
+//   - JWTSigningKey: возвращает основной ключ подписи JWT (HS256, RS256 или EdDSA)
+//   - JWTVerificationKey: возвращает ключ проверки JWT по kid
+//   - LoginStoreKeyPairs, CaptchaStoreKeyPairs, CSRFStoreKeyPairs: ключи хранилищ сессий
+//   - CookieSigningKeys: ключи HMAC-подписи cookie с временным ID и доверенным устройством
+//   - AddKey, PromoteKey, RetireKey: операции ротации ключей
+//
+// Каждый набор ключей содержит один основной ключ (primary), которым подписываются
+// новые данные, и активные ключи (active), которые принимаются только при проверке.
+// Выведенные ключи (retired) не используются. Ключи из переменных окружения
+// (JWT_SECRET, LOGIN_STORE_SESSION_*, CAPTCHA_STORE_SESSION_SECRET_KEY, COOKIE_SIGNING_KEY) используются
+// для подписи, если в наборе нет ключей, и остаются действительными для проверки,
+// пока заданы, чтобы переход на связку ключей не завершал существующие сессии.
+package keyring
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/golang-jwt/jwt"
+	"github.com/pkg/errors"
+)
+
+const (
+	StatusPrimary = "primary"
+	StatusActive  = "active"
+	StatusRetired = "retired"
+)
+
+const (
+	SetJWT          = "jwt"
+	SetLoginStore   = "loginStore"
+	SetCaptchaStore = "captchaStore"
+	SetCookie       = "cookie"
+)
+
+// EnvKid - kid токенов, подписанных ключом JWT_SECRET из переменных окружения.
+const EnvKid = "env"
+
+var (
+	cacheMu       sync.Mutex
+	cachedPath    string
+	cachedModTime time.Time
+	cached        structs.Keyring
+)
+
+// Load загружает связку ключей из файла, указанного в KEYRING_FILE.
+//
+// Если переменная не задана или файл отсутствует, возвращает пустую связку.
+// Файл перечитывается только при изменении времени модификации.
+var Load = func() (structs.Keyring, error) {
+	path := os.Getenv("KEYRING_FILE")
+	if path == "" {
+		return structs.Keyring{}, nil
+	}
+	return LoadFile(path)
+}
+
+// LoadFile загружает связку ключей из указанного файла.
+//
+// Отсутствующий файл считается пустой связкой.
+func LoadFile(path string) (structs.Keyring, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return structs.Keyring{}, nil
+		}
+		return structs.Keyring{}, errors.WithStack(err)
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if path == cachedPath && info.ModTime().Equal(cachedModTime) {
+		return copyKeyring(cached), nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return structs.Keyring{}, errors.WithStack(err)
+	}
+
+	var keyring structs.Keyring
+	if err := json.Unmarshal(content, &keyring); err != nil {
+		return structs.Keyring{}, errors.WithStack(err)
+	}
+
+	cachedPath, cachedModTime, cached = path, info.ModTime(), keyring
+	return copyKeyring(keyring), nil
+}
+
+// Save атомарно сохраняет связку ключей в файл с правами 0600.
+func Save(path string, keyring structs.Keyring) error {
+	content, err := json.MarshalIndent(keyring, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.WithStack(err)
+	}
+
+	cacheMu.Lock()
+	cachedPath = ""
+	cacheMu.Unlock()
+	return nil
+}
+
+// copyKeyring возвращает копию связки ключей, не разделяющую срезы с оригиналом.
+func copyKeyring(keyring structs.Keyring) structs.Keyring {
+	return structs.Keyring{
+		JWT:          append([]structs.SigningKey(nil), keyring.JWT...),
+		LoginStore:   append([]structs.SigningKey(nil), keyring.LoginStore...),
+		CaptchaStore: append([]structs.SigningKey(nil), keyring.CaptchaStore...),
+		Cookie:       append([]structs.SigningKey(nil), keyring.Cookie...),
+	}
+}
+
+// keySet возвращает указатель на набор ключей по имени.
+func keySet(keyring *structs.Keyring, set string) (*[]structs.SigningKey, error) {
+	switch set {
+	case SetJWT:
+		return &keyring.JWT, nil
+	case SetLoginStore:
+		return &keyring.LoginStore, nil
+	case SetCaptchaStore:
+		return &keyring.CaptchaStore, nil
+	case SetCookie:
+		return &keyring.Cookie, nil
+	}
+	return nil, errors.Errorf("unknown key set: %s", set)
+}
+
+// decodeSecret декодирует секрет ключа из base64.
+func decodeSecret(secret string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return decoded, nil
+}
+
+// orderedKeys возвращает действующие ключи набора: основной первым, затем активные.
+//
+// Возвращает ошибку, если в непустом наборе нет основного ключа.
+func orderedKeys(keys []structs.SigningKey) ([]structs.SigningKey, error) {
+	var primary []structs.SigningKey
+	var active []structs.SigningKey
+	for _, key := range keys {
+		switch key.Status {
+		case StatusPrimary:
+			primary = append(primary, key)
+		case StatusActive:
+			active = append(active, key)
+		}
+	}
+	if len(keys) > 0 && len(primary) != 1 {
+		return nil, errors.New("key set must have exactly one primary key")
+	}
+	return append(primary, active...), nil
+}
+
+// JWTKey описывает ключ JWT: kid, алгоритм подписи и ключи подписи и проверки.
+//
+// Для HS256 SignKey и VerifyKey - общий секрет, для RS256 и EdDSA - закрытый
+// и открытый ключи соответственно.
+type JWTKey struct {
+	Kid       string
+	Method    jwt.SigningMethod
+	SignKey   interface{}
+	VerifyKey interface{}
+}
+
+// jwtKeyFromSigningKey строит JWTKey из записи связки ключей.
+func jwtKeyFromSigningKey(key structs.SigningKey) (JWTKey, error) {
+	if key.Alg == "" || key.Alg == jwt.SigningMethodHS256.Alg() {
+		secret, err := decodeSecret(key.Secret)
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		return JWTKey{Kid: key.Kid, Method: jwt.SigningMethodHS256, SignKey: secret, VerifyKey: secret}, nil
+	}
+
+	jwtKey, err := loadPrivateKeyFile(key.Alg, key.PrivateKeyFile)
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+	jwtKey.Kid = key.Kid
+	return jwtKey, nil
+}
+
+// envJWTKey возвращает ключ JWT из переменных окружения.
+//
+// При JWT_SIGNING_ALG=RS256 или EdDSA загружает закрытый ключ из JWT_PRIVATE_KEY_FILE,
+// kid вычисляется как отпечаток открытого ключа (RFC 7638).
+// Иначе использует JWT_SECRET для HS256 с kid "env".
+func envJWTKey() (JWTKey, error) {
+	alg := os.Getenv("JWT_SIGNING_ALG")
+	if alg != "" && alg != jwt.SigningMethodHS256.Alg() {
+		jwtKey, err := loadPrivateKeyFile(alg, os.Getenv("JWT_PRIVATE_KEY_FILE"))
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		jwtKey.Kid, err = thumbprint(jwtKey.VerifyKey)
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		return jwtKey, nil
+	}
+	return envHMACKey()
+}
+
+// envHMACKey возвращает ключ HS256 из JWT_SECRET с kid "env".
+func envHMACKey() (JWTKey, error) {
+	jwtSecret := os.Getenv("JWT_SECRET")
+	if jwtSecret == "" {
+		return JWTKey{}, errors.New("JWT_SECRET environment variable is not set")
+	}
+	return JWTKey{Kid: EnvKid, Method: jwt.SigningMethodHS256, SignKey: []byte(jwtSecret), VerifyKey: []byte(jwtSecret)}, nil
+}
+
+// JWTSigningKey возвращает основной ключ подписи JWT.
+//
+// Если в связке нет ключей JWT, использует ключ из переменных окружения.
+var JWTSigningKey = func() (JWTKey, error) {
+	keyring, err := Load()
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+
+	keys, err := orderedKeys(keyring.JWT)
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+	if len(keys) > 0 {
+		return jwtKeyFromSigningKey(keys[0])
+	}
+
+	return envJWTKey()
+}
+
+// JWTVerificationKey возвращает ключ проверки JWT по kid.
+//
+// Токены без kid или с kid "env" проверяются ключом JWT_SECRET.
+// Остальные kid ищутся среди основного и активных ключей связки,
+// затем сравниваются с отпечатком ключа из JWT_PRIVATE_KEY_FILE.
+var JWTVerificationKey = func(kid string) (JWTKey, error) {
+	if kid == "" || kid == EnvKid {
+		return envHMACKey()
+	}
+
+	keyring, err := Load()
+	if err != nil {
+		return JWTKey{}, errors.WithStack(err)
+	}
+
+	for _, key := range keyring.JWT {
+		if key.Kid == kid && key.Status != StatusRetired {
+			return jwtKeyFromSigningKey(key)
+		}
+	}
+
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" && alg != jwt.SigningMethodHS256.Alg() {
+		envKey, err := envJWTKey()
+		if err != nil {
+			return JWTKey{}, errors.WithStack(err)
+		}
+		if envKey.Kid == kid {
+			return envKey, nil
+		}
+	}
+
+	return JWTKey{}, errors.Errorf("unknown kid: %s", kid)
+}
+
+// storeKeyPairs собирает пары ключей (ключ подписи, ключ шифрования) для securecookie.
+//
+// Первая пара используется для кодирования, все - для декодирования.
+// Пара из переменных окружения добавляется последней, если она задана.
+func storeKeyPairs(keys []structs.SigningKey, withEncryption bool, envHashKey, envBlockKey string) ([][]byte, error) {
+	ordered, err := orderedKeys(keys)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var pairs [][]byte
+	for _, key := range ordered {
+		hashKey, err := decodeSecret(key.Secret)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var blockKey []byte
+		if withEncryption {
+			blockKey, err = decodeSecret(key.EncryptionSecret)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		pairs = append(pairs, hashKey, blockKey)
+	}
+
+	if envHashKey != "" || len(pairs) == 0 {
+		var envBlock []byte
+		if withEncryption {
+			envBlock = []byte(envBlockKey)
+		}
+		pairs = append(pairs, []byte(envHashKey), envBlock)
+	}
+
+	return pairs, nil
+}
+
+// LoginStoreKeyPairs возвращает пары ключей хранилища сессий входа.
+var LoginStoreKeyPairs = func() ([][]byte, error) {
+	keyring, err := Load()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return storeKeyPairs(keyring.LoginStore, true, os.Getenv("LOGIN_STORE_SESSION_AUTH_KEY"), os.Getenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY"))
+}
+
+// CaptchaStoreKeyPairs возвращает ключи хранилища сессий капчи (без шифрования).
+var CaptchaStoreKeyPairs = func() ([][]byte, error) {
+	keyring, err := Load()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return storeKeyPairs(keyring.CaptchaStore, false, os.Getenv("CAPTCHA_STORE_SESSION_SECRET_KEY"), "")
+}
+
+// CSRFStoreKeyPairs возвращает ключи хранилища CSRF токенов.
+//
+// Используются ключи подписи хранилища сессий входа без шифрования.
+var CSRFStoreKeyPairs = func() ([][]byte, error) {
+	keyring, err := Load()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return storeKeyPairs(keyring.LoginStore, false, os.Getenv("LOGIN_STORE_SESSION_AUTH_KEY"), "")
+}
+
+// CookieSigningKeys возвращает ключи HMAC-подписи cookie: основной первым, затем активные.
+//
+// Набор cookie отделен от ключей хранилищ сессий, поэтому ключ LOGIN_STORE_SESSION_AUTH_KEY
+// для подписи cookie не используется. Ключ COOKIE_SIGNING_KEY добавляется последним, если он задан.
+// Если ключей нет, возвращает пустой список.
+var CookieSigningKeys = func() ([][]byte, error) {
+	keyring, err := Load()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ordered, err := orderedKeys(keyring.Cookie)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var keys [][]byte
+	for _, key := range ordered {
+		secret, err := decodeSecret(key.Secret)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		keys = append(keys, secret)
+	}
+
+	if envKey := os.Getenv("COOKIE_SIGNING_KEY"); envKey != "" {
+		keys = append(keys, []byte(envKey))
+	}
+
+	return keys, nil
+}
+
+// randomSecret генерирует случайный секрет длиной 32 байта в base64.
+func randomSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// AddKey добавляет в набор новый случайный ключ.
+//
+// Если в наборе нет основного ключа, новый ключ становится основным,
+// иначе добавляется как активный, чтобы его можно было разослать на все
+// экземпляры приложения до переключения подписи командой promote.
+func AddKey(keyring *structs.Keyring, set string, now int64) (structs.SigningKey, error) {
+	keys, err := keySet(keyring, set)
+	if err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	secret, err := randomSecret()
+	if err != nil {
+		return structs.SigningKey{}, errors.WithStack(err)
+	}
+
+	key := structs.SigningKey{
+		Kid:       time.Unix(now, 0).UTC().Format("20060102") + "-" + hex.EncodeToString(suffix),
+		Secret:    secret,
+		Status:    StatusPrimary,
+		CreatedAt: now,
+	}
+
+	if set == SetLoginStore {
+		key.EncryptionSecret, err = randomSecret()
+		if err != nil {
+			return structs.SigningKey{}, errors.WithStack(err)
+		}
+	}
+
+	for _, existing := range *keys {
+		if existing.Status == StatusPrimary {
+			key.Status = StatusActive
+			break
+		}
+	}
+
+	*keys = append(*keys, key)
+	return key, nil
+}
+
+// PromoteKey делает ключ основным, а прежний основной ключ - активным.
+func PromoteKey(keyring *structs.Keyring, set, kid string) error {
+	keys, err := keySet(keyring, set)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	index := -1
+	for i, key := range *keys {
+		if key.Kid == kid {
+			index = i
+		}
+	}
+	if index == -1 {
+		return errors.Errorf("key %s not found in set %s", kid, set)
+	}
+	if (*keys)[index].Status == StatusRetired {
+		return errors.Errorf("key %s is retired", kid)
+	}
+
+	for i := range *keys {
+		if (*keys)[i].Status == StatusPrimary {
+			(*keys)[i].Status = StatusActive
+		}
+	}
+	(*keys)[index].Status = StatusPrimary
+	return nil
+}
+
+// RetireKey выводит ключ из использования.
+//
+// Основной ключ вывести нельзя - сначала нужно назначить другой основной ключ.
+func RetireKey(keyring *structs.Keyring, set, kid string) error {
+	keys, err := keySet(keyring, set)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for i, key := range *keys {
+		if key.Kid != kid {
+			continue
+		}
+		if key.Status == StatusPrimary {
+			return errors.Errorf("key %s is primary, promote another key first", kid)
+		}
+		(*keys)[i].Status = StatusRetired
+		return nil
+	}
+
+	return errors.Errorf("key %s not found in set %s", kid, set)
+}
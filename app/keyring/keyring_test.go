@@ -0,0 +1,184 @@
+// Package keyring предоставляет ключи подписи с поддержкой ротации.
+//
+// Файл тестирует загрузку, сохранение и ротацию связки ключей.
+package keyring
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRotation проверяет добавление, назначение и вывод ключей.
+// Ожидается: первый ключ основной, следующий активный, promote меняет основной, основной нельзя вывести.
+func TestRotation(t *testing.T) {
+	var keyring structs.Keyring
+
+	first, err := AddKey(&keyring, SetJWT, 1700000000)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPrimary, first.Status)
+	assert.Empty(t, first.EncryptionSecret)
+
+	second, err := AddKey(&keyring, SetJWT, 1700000001)
+	require.NoError(t, err)
+	assert.Equal(t, StatusActive, second.Status)
+	assert.NotEqual(t, first.Kid, second.Kid)
+
+	assert.Error(t, RetireKey(&keyring, SetJWT, first.Kid))
+
+	require.NoError(t, PromoteKey(&keyring, SetJWT, second.Kid))
+	assert.Equal(t, StatusActive, keyring.JWT[0].Status)
+	assert.Equal(t, StatusPrimary, keyring.JWT[1].Status)
+
+	require.NoError(t, RetireKey(&keyring, SetJWT, first.Kid))
+	assert.Equal(t, StatusRetired, keyring.JWT[0].Status)
+	assert.Error(t, PromoteKey(&keyring, SetJWT, first.Kid))
+
+	assert.Error(t, PromoteKey(&keyring, SetJWT, "missing"))
+	_, err = AddKey(&keyring, "unknown", 1700000000)
+	assert.Error(t, err)
+
+	loginKey, err := AddKey(&keyring, SetLoginStore, 1700000000)
+	require.NoError(t, err)
+	blockKey, err := base64.StdEncoding.DecodeString(loginKey.EncryptionSecret)
+	require.NoError(t, err)
+	assert.Len(t, blockKey, 32)
+}
+
+// TestJWTKeys проверяет выбор ключей подписи и проверки JWT.
+// Ожидается: подпись основным ключом связки, проверка по kid, JWT_SECRET для токенов без kid.
+func TestJWTKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("JWT_SECRET", "env-secret")
+
+	signingKey, err := JWTSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, EnvKid, signingKey.Kid)
+	assert.Equal(t, jwt.SigningMethodHS256, signingKey.Method)
+	assert.Equal(t, []byte("env-secret"), signingKey.SignKey)
+
+	var keyring structs.Keyring
+	oldKey, err := AddKey(&keyring, SetJWT, 1700000000)
+	require.NoError(t, err)
+	newKey, err := AddKey(&keyring, SetJWT, 1700000001)
+	require.NoError(t, err)
+	require.NoError(t, PromoteKey(&keyring, SetJWT, newKey.Kid))
+	require.NoError(t, Save(path, keyring))
+
+	signingKey, err = JWTSigningKey()
+	require.NoError(t, err)
+	assert.Equal(t, newKey.Kid, signingKey.Kid)
+	assert.Equal(t, newKey.Secret, base64.StdEncoding.EncodeToString(signingKey.SignKey.([]byte)))
+
+	oldVerificationKey, err := JWTVerificationKey(oldKey.Kid)
+	require.NoError(t, err)
+	assert.Equal(t, oldKey.Secret, base64.StdEncoding.EncodeToString(oldVerificationKey.VerifyKey.([]byte)))
+
+	envVerificationKey, err := JWTVerificationKey("")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("env-secret"), envVerificationKey.VerifyKey)
+
+	require.NoError(t, RetireKey(&keyring, SetJWT, oldKey.Kid))
+	require.NoError(t, Save(path, keyring))
+	_, err = JWTVerificationKey(oldKey.Kid)
+	assert.Error(t, err)
+	_, err = JWTVerificationKey("missing")
+	assert.Error(t, err)
+}
+
+// TestStoreKeyPairs проверяет сборку пар ключей для хранилищ сессий.
+// Ожидается: основной ключ первым, затем активные, пара из окружения последней.
+func TestStoreKeyPairs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "env-auth")
+	t.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "env-encryption")
+
+	pairs, err := LoginStoreKeyPairs()
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{[]byte("env-auth"), []byte("env-encryption")}, pairs)
+
+	var keyring structs.Keyring
+	primary, err := AddKey(&keyring, SetLoginStore, 1700000000)
+	require.NoError(t, err)
+	_, err = AddKey(&keyring, SetLoginStore, 1700000001)
+	require.NoError(t, err)
+	require.NoError(t, Save(path, keyring))
+
+	pairs, err = LoginStoreKeyPairs()
+	require.NoError(t, err)
+	require.Len(t, pairs, 6)
+	assert.Equal(t, primary.Secret, base64.StdEncoding.EncodeToString(pairs[0]))
+	assert.Equal(t, primary.EncryptionSecret, base64.StdEncoding.EncodeToString(pairs[1]))
+	assert.Equal(t, []byte("env-auth"), pairs[4])
+
+	pairs, err = CSRFStoreKeyPairs()
+	require.NoError(t, err)
+	require.Len(t, pairs, 6)
+	assert.Nil(t, pairs[1])
+
+	keyring.LoginStore[0].Status = StatusActive
+	require.NoError(t, Save(path, keyring))
+	_, err = LoginStoreKeyPairs()
+	assert.Error(t, err)
+}
+
+// TestCookieSigningKeys проверяет сборку ключей подписи cookie.
+// Ожидается: ключ хранилища сессий не используется, основной ключ набора cookie первым,
+// затем активные, COOKIE_SIGNING_KEY последним.
+func TestCookieSigningKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "env-auth")
+	t.Setenv("COOKIE_SIGNING_KEY", "")
+
+	keys, err := CookieSigningKeys()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	t.Setenv("COOKIE_SIGNING_KEY", "env-cookie")
+	var keyring structs.Keyring
+	active, err := AddKey(&keyring, SetCookie, 1700000000)
+	require.NoError(t, err)
+	primary, err := AddKey(&keyring, SetCookie, 1700000001)
+	require.NoError(t, err)
+	require.NoError(t, PromoteKey(&keyring, SetCookie, primary.Kid))
+	require.NoError(t, Save(path, keyring))
+
+	keys, err = CookieSigningKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+	assert.Equal(t, primary.Secret, base64.StdEncoding.EncodeToString(keys[0]))
+	assert.Equal(t, active.Secret, base64.StdEncoding.EncodeToString(keys[1]))
+	assert.Equal(t, []byte("env-cookie"), keys[2])
+	assert.Empty(t, primary.EncryptionSecret)
+}
+
+// TestLoadFile проверяет загрузку отсутствующего файла и сохранение связки.
+// Ожидается: пустая связка для отсутствующего файла, сохраненная связка читается обратно.
+func TestLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	keyring, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, keyring.JWT)
+
+	_, err = AddKey(&keyring, SetCaptchaStore, 1700000000)
+	require.NoError(t, err)
+	require.NoError(t, Save(path, keyring))
+
+	loaded, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, keyring.CaptchaStore, loaded.CaptchaStore)
+
+	loaded.CaptchaStore[0].Status = StatusRetired
+	reloaded, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPrimary, reloaded.CaptchaStore[0].Status)
+}
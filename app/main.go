@@ -6,17 +6,26 @@
 //   - initDb: инициализация подключения к базе данных
 //   - initRouter: настройка маршрутизатора HTTP-запросов
 //   - serverStart: запуск HTTP-сервера
+//   - purgeDueAccounts: периодическое удаление аккаунтов с истекшим сроком ожидания
+//   - sendOutboxMails: фоновая отправка писем из очереди
+//   - sendSecurityDigests: периодическая отправка еженедельных сводок безопасности
+//
+// Служебные команды командной строки находятся в commands.go.
 package main
 
 import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gimaevra94/auth/app/auth"
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/tools"
 	"github.com/go-chi/chi"
 	"github.com/joho/godotenv"
 	"github.com/pkg/errors"
@@ -31,16 +40,73 @@ const (
 	yandexCallbackURL                      = "/ya_callback"
 	setNewPasswordURL                      = "/set-new-password"
 	logoutURL                              = "/logout"
+	accessTokenURL                         = "/token"
+	profileLoginURL                        = "/profile/login"
+	profileEmailURL                        = "/profile/email"
+	profileEmailConfirmURL                 = "/profile/email/confirm"
+	profileEmailUndoURL                    = "/profile/email/undo"
+	profilePhoneURL                        = "/profile/phone"
+	profilePhoneConfirmURL                 = "/profile/phone/confirm"
+	profilePhoneRemoveURL                  = "/profile/phone/remove"
+	profilePasswordURL                     = "/profile/password"
+	profileSetPasswordURL                  = "/profile/set-password"
+	profileExportURL                       = "/profile/export"
+	profileDeleteURL                       = "/profile/delete"
+	profileDeleteConfirmURL                = "/profile/delete/confirm"
+	profileLocaleURL                       = "/profile/locale"
+	securityRevokeURL                      = "/security/revoke"
+	adminUserDisableURL                    = "/admin/user/disable"
+	adminUserEnableURL                     = "/admin/user/enable"
+	adminUserLogoutURL                     = "/admin/user/logout"
+	adminUserPasswordResetURL              = "/admin/user/password-reset"
+	adminUserLoginURL                      = "/admin/user/login"
+	adminUserEmailURL                      = "/admin/user/email"
+	adminUserRoleGrantURL                  = "/admin/user/role/grant"
+	adminUserRoleRevokeURL                 = "/admin/user/role/revoke"
+	adminInviteCreateURL                   = "/admin/invites/create"
+	adminInviteRevokeURL                   = "/admin/invites/revoke"
+	adminTemplatesURL                      = "/admin/templates"
+	adminTemplatePreviewURL                = "/admin/templates/preview"
 )
 
+// accountPurgeInterval задает период удаления аккаунтов с истекшим сроком ожидания.
+const accountPurgeInterval = time.Hour
+
+// securityDigestInterval задает период проверки, кому пора отправить сводку безопасности.
+const securityDigestInterval = time.Hour
+
+// mailOutboxInterval задает период проверки очереди писем.
+const mailOutboxInterval = 5 * time.Second
+
 // main является точкой входа в приложение.
 //
-// Последовательно инициализирует окружение, базу данных, хранилище сессий
-// и маршрутизатор, затем запускает HTTP-сервер.
+// Последовательно инициализирует окружение, шаблоны, базу данных, хранилище сессий
+// и маршрутизатор, затем запускает HTTP-сервер. Если не задан ключ подписи cookie
+// или шаблоны из TEMPLATES_DIR не проходят проверку, сервер не запускается.
+// Если переданы аргументы командной строки, выполняет служебную команду вместо запуска сервера.
 func main() {
 	initEnv()
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:], os.Stdout); err != nil {
+			log.Printf("%+v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := data.CheckCookieSigningKey(); err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
+	if err := tmpls.LoadTmpls(); err != nil {
+		log.Printf("%+v", err)
+		os.Exit(1)
+	}
 	initDb()
 	data.InitStore()
+	go purgeDueAccounts(accountPurgeInterval)
+	go sendSecurityDigests(securityDigestInterval)
+	sendOutboxMails(mailOutboxInterval, mailOutboxWorkers())
 	r := initRouter()
 	if err := serverStart(r); err != nil {
 		log.Printf("%+v", err)
@@ -101,9 +167,12 @@ func initDb() {
 //
 // Регистрирует все обработчики маршрутов для аутентификации,
 // авторизации, сброса пароля и других функций приложения.
+// Все маршруты проходят через выбор языка и CSRF защиту, POST запросы без валидного токена отклоняются.
 // Возвращает настроенный маршрутизатор chi.Mux.
 func initRouter() *chi.Mux {
 	r := chi.NewRouter()
+	r.Use(i18n.Middleware)
+	r.Use(auth.CSRFProtector)
 
 	r.Get("/public/styles.css", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/css; charset=utf-8")
@@ -119,7 +188,10 @@ func initRouter() *chi.Mux {
 		http.Redirect(w, r, consts.SignUpURL, http.StatusFound)
 	})
 
-	r.With(auth.AuthGuardForSignUpAndSignInPath).Get(consts.SignUpURL, tmpls.SignUp)
+	r.Get("/.well-known/jwks.json", auth.JWKS)
+	r.With(auth.AuthGuardForHomePath).Get(accessTokenURL, auth.AccessToken)
+
+	r.With(auth.AuthGuardForSignUpAndSignInPath).Get(consts.SignUpURL, auth.SignUpPage)
 	r.Post(CheckInDbAndValidateSignUpUserInputURL, auth.CheckInDbAndValidateSignUpUserInput)
 	r.With(auth.AuthGuardForServerAuthCodeSendPath).Get(consts.ServerAuthCodeSendURL, tmpls.ServerAuthCodeSend)
 	r.With(auth.AuthGuardForServerAuthCodeSendPath).Get(consts.ServerAuthCodeSendAgainURL, auth.ServerAuthCodeSend)
@@ -138,7 +210,47 @@ func initRouter() *chi.Mux {
 	r.Post(setNewPasswordURL, auth.SetNewPassword)
 
 	r.With(auth.AuthGuardForHomePath).Get(consts.HomeURL, tmpls.Home)
-	r.With(auth.AuthGuardForHomePath).Get(logoutURL, auth.Logout)
+	r.With(auth.AuthGuardForHomePath).Post(logoutURL, auth.Logout)
+
+	r.With(auth.AuthGuardForHomePath).Get(consts.ProfileURL, auth.Profile)
+	r.With(auth.AuthGuardForHomePath).Post(profileLoginURL, auth.ChangeLogin)
+	r.With(auth.AuthGuardForHomePath).Post(profileEmailURL, auth.ChangeEmail)
+	r.With(auth.AuthGuardForHomePath).Post(profileEmailConfirmURL, auth.ConfirmEmailChange)
+	r.Get(profileEmailUndoURL, tmpls.EmailChangeUndo)
+	r.Post(profileEmailUndoURL, auth.UndoEmailChange)
+	r.With(auth.AuthGuardForHomePath).Post(profilePhoneURL, auth.ChangePhone)
+	r.With(auth.AuthGuardForHomePath).Post(profilePhoneConfirmURL, auth.ConfirmPhoneChange)
+	r.With(auth.AuthGuardForHomePath).Post(profilePhoneRemoveURL, auth.RemovePhone)
+	r.With(auth.AuthGuardForHomePath).Post(profilePasswordURL, auth.ChangePassword)
+	r.With(auth.AuthGuardForHomePath).Post(profileSetPasswordURL, auth.SetLoginAndPassword)
+	r.With(auth.AuthGuardForHomePath).Get(profileExportURL, auth.ExportAccountData)
+	r.With(auth.AuthGuardForHomePath).Post(profileDeleteURL, auth.DeleteAccount)
+	r.Get(profileDeleteConfirmURL, tmpls.AccountDeletionConfirm)
+	r.Post(profileDeleteConfirmURL, auth.ConfirmAccountDeletion)
+	r.With(auth.AuthGuardForHomePath).Post(profileLocaleURL, auth.ChangeLocale)
+	r.Get(securityRevokeURL, tmpls.SecurityAlertRevoke)
+	r.Post(securityRevokeURL, auth.RevokeBySecurityAlert)
+	r.Get(consts.UnsubscribeURL, tmpls.Unsubscribe)
+	r.Post(consts.UnsubscribeURL, auth.Unsubscribe)
+	r.With(auth.AuthGuardForHomePath).Get(consts.ProfileNotificationsURL, auth.NotificationSettings)
+	r.With(auth.AuthGuardForHomePath).Post(consts.ProfileNotificationsURL, auth.ChangeNotificationSettings)
+
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Get(consts.AdminURL, auth.AdminUsers)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Get(consts.AdminUserURL, auth.AdminUser)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserDisableURL, auth.AdminDisableUser)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserEnableURL, auth.AdminEnableUser)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserLogoutURL, auth.AdminLogoutUser)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserPasswordResetURL, auth.AdminSendPasswordReset)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserLoginURL, auth.AdminChangeLogin)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers)).Post(adminUserEmailURL, auth.AdminChangeEmail)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers, consts.PermissionRolesManage)).Post(adminUserRoleGrantURL, auth.AdminGrantRole)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionAdminUsers, consts.PermissionRolesManage)).Post(adminUserRoleRevokeURL, auth.AdminRevokeRole)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionInvitesManage)).Get(consts.AdminInvitesURL, auth.AdminInvites)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionInvitesManage)).Post(adminInviteCreateURL, auth.AdminCreateInvite)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionInvitesManage)).Post(adminInviteRevokeURL, auth.AdminRevokeInvite)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionTemplatesPreview)).Get(adminTemplatesURL, tmpls.AdminTemplates)
+	r.With(auth.AuthGuardForHomePath, auth.RequirePermission(consts.PermissionTemplatesPreview)).Get(adminTemplatePreviewURL, tmpls.TemplatePreview)
+
 	r.Get("/clear", data.ClearCookiesDev)
 	r.Get(consts.Err500URL, tmpls.Err500)
 
@@ -148,8 +260,21 @@ func initRouter() *chi.Mux {
 // serverStart запускает HTTPS сервер на указанном порту.
 //
 // Для HTTPS используются сертификаты из certs/app_cert/.
+// В профиле разработки (APP_PROFILE=dev) запускает обычный HTTP сервер
+// на адресе из DEV_HTTP_ADDR (по умолчанию ":8080").
 // Возвращает ошибку в случае неудачного запуска сервера.
 func serverStart(r *chi.Mux) error {
+	if data.IsDevProfile() {
+		addr := os.Getenv("DEV_HTTP_ADDR")
+		if addr == "" {
+			addr = ":8080"
+		}
+		if err := http.ListenAndServe(addr, r); err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	}
+
 	certFile := "/app/cert/app-cert.pem"
 	keyFile := "/app/cert/app-key.pem"
 	if err := http.ListenAndServeTLS(":443", certFile, keyFile, r); err != nil {
@@ -157,3 +282,90 @@ func serverStart(r *chi.Mux) error {
 	}
 	return nil
 }
+
+// purgeDueAccounts безвозвратно удаляет аккаунты, срок ожидания удаления которых истек.
+//
+// Выполняется при запуске сервера и затем с периодом interval.
+// Ошибки выводятся в лог и не останавливают сервер.
+// Без подключения к базе данных удаление не выполняется.
+func purgeDueAccounts(interval time.Duration) {
+	if data.Db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := data.DeleteDueAccountsFromDb(time.Now().Unix())
+		if err != nil {
+			log.Printf("%+v", err)
+		} else if deleted > 0 {
+			log.Printf("deleted %d accounts after grace period", deleted)
+		}
+		<-ticker.C
+	}
+}
+
+// sendSecurityDigests отправляет еженедельные сводки безопасности пользователям, которые их включили.
+//
+// Выполняется при запуске сервера и затем с периодом interval.
+// Ошибки выводятся в лог и не останавливают сервер.
+// Без подключения к базе данных сводки не отправляются.
+func sendSecurityDigests(interval time.Duration) {
+	if data.Db == nil {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		sent, err := auth.SendSecurityDigests(time.Now().Unix())
+		if err != nil {
+			log.Printf("%+v", err)
+		} else if sent > 0 {
+			log.Printf("sent %d security digests", sent)
+		}
+		<-ticker.C
+	}
+}
+
+// mailOutboxWorkers возвращает число горутин отправки писем.
+//
+// Использует переменную окружения MAIL_OUTBOX_WORKERS (по умолчанию 2).
+func mailOutboxWorkers() int {
+	if value, err := strconv.Atoi(os.Getenv("MAIL_OUTBOX_WORKERS")); err == nil && value > 0 {
+		return value
+	}
+	return 2
+}
+
+// sendOutboxMails запускает workers горутин, отправляющих письма из очереди.
+//
+// Каждая горутина обрабатывает очередь с периодом interval и без паузы, пока в ней
+// есть письма к отправке. Ошибки выводятся в лог и не останавливают сервер.
+// Без подключения к базе данных горутины не запускаются.
+func sendOutboxMails(interval time.Duration, workers int) {
+	if data.Db == nil {
+		return
+	}
+
+	for i := 0; i < workers; i++ {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				sent, failed, err := tools.ProcessMailOutbox(time.Now().Unix())
+				if err != nil {
+					log.Printf("%+v", err)
+				}
+				if err == nil && sent+failed > 0 {
+					continue
+				}
+				<-ticker.C
+			}
+		}()
+	}
+}
@@ -11,7 +11,7 @@ import (
 
 	"github.com/gimaevra94/auth/app/auth"
 	"github.com/gimaevra94/auth/app/consts"
-	"github.com/gimaevra94/auth/app/tmpls"
+	"github.com/gimaevra94/auth/app/data"
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -39,6 +39,15 @@ func (m *MockHttpServer) ListenAndServe(addr string, handler http.Handler) error
 	return args.Error(0)
 }
 
+// TestMain инициализирует хранилища сессий, необходимые CSRF защите роутера.
+func TestMain(m *testing.M) {
+	os.Setenv("LOGIN_STORE_SESSION_AUTH_KEY", "12345678901234567890123456789012")
+	os.Setenv("LOGIN_STORE_SESSION_ENCRYPTION_KEY", "12345678901234567890123456789012")
+	os.Setenv("CAPTCHA_STORE_SESSION_SECRET_KEY", "12345678901234567890123456789012")
+	data.InitStore()
+	os.Exit(m.Run())
+}
+
 // TestInitEnv проверяет инициализацию переменных окружения.
 // Ожидается: успешная инициализация при наличии всех необходимых переменных.
 func TestInitEnv(t *testing.T) {
@@ -272,12 +281,12 @@ func TestInitRouterHandlerTypes(t *testing.T) {
 // Ожидается: корректная обработка запросов через мок обработчики.
 func TestInitRouterWithMockHandlers(t *testing.T) {
 	originalAuthHandler := auth.CheckInDbAndValidateSignUpUserInput
-	originalTmplHandler := tmpls.SignUp
+	originalTmplHandler := auth.SignUpPage
 	originalAuthGuard := auth.AuthGuardForSignUpAndSignInPath
 
 	defer func() {
 		auth.CheckInDbAndValidateSignUpUserInput = originalAuthHandler
-		tmpls.SignUp = originalTmplHandler
+		auth.SignUpPage = originalTmplHandler
 		auth.AuthGuardForSignUpAndSignInPath = originalAuthGuard
 	}()
 
@@ -291,7 +300,7 @@ func TestInitRouterWithMockHandlers(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("mock template handler"))
 	}
-	tmpls.SignUp = mockTmplHandler
+	auth.SignUpPage = mockTmplHandler
 
 	mockAuthGuard := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -304,7 +313,17 @@ func TestInitRouterWithMockHandlers(t *testing.T) {
 	r := initRouter()
 
 	t.Run("mock_auth_handler", func(t *testing.T) {
+		getReq := httptest.NewRequest("GET", "/", nil)
+		getRr := httptest.NewRecorder()
+		r.ServeHTTP(getRr, getReq)
+		csrfToken := getRr.Header().Get(consts.CSRFTokenHeader)
+		assert.NotEmpty(t, csrfToken)
+
 		req := httptest.NewRequest("POST", CheckInDbAndValidateSignUpUserInputURL, nil)
+		for _, cookie := range getRr.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+		req.Header.Set(consts.CSRFTokenHeader, csrfToken)
 		rr := httptest.NewRecorder()
 
 		r.ServeHTTP(rr, req)
@@ -313,6 +332,16 @@ func TestInitRouterWithMockHandlers(t *testing.T) {
 		assert.Equal(t, "mock auth handler", rr.Body.String())
 	})
 
+	t.Run("post_without_csrf_token", func(t *testing.T) {
+		req := httptest.NewRequest("POST", CheckInDbAndValidateSignUpUserInputURL, nil)
+		rr := httptest.NewRecorder()
+
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+		assert.NotEqual(t, "mock auth handler", rr.Body.String())
+	})
+
 	t.Run("mock_template_handler", func(t *testing.T) {
 		req := httptest.NewRequest("GET", consts.SignUpURL, nil)
 		rr := httptest.NewRecorder()
@@ -9,17 +9,369 @@ type User struct {
 	Password               string `sql:"passwordHash"`
 	ServerCode             string
 	ServerCodeSendedConter int
+	ServerCodeSendedAt     int64
 	UserAgent              string
+	InviteCode             string
+	Phone                  string
+	PhoneVerified          bool
+	CodeChannel            string
+	PermanentId            string
+	RememberMe             bool
+	SecondFactor           bool
+	CodeVerified           bool
 }
 
 type MsgForUser struct {
 	Msg                string
+	MsgKey             string
 	ShowCaptcha        bool
 	ShowForgotPassword bool
 	Regs               []string
+	RetryAfter         int64
+	CSRFToken          string
+	InviteCode         string
+	InviteRequired     bool
+	SMSEnabled         bool
+	CodeChannel        string
+	AltCodeChannel     string
+}
+
+type ServerAuthCodeSendStats struct {
+	LastHour          int
+	LastDay           int
+	LastSentAt        int64
+	FirstInLastHourAt int64
+	FirstInLastDayAt  int64
 }
 
 type PasswordResetTokenClaims struct {
 	jwt.StandardClaims
-	Email string `json:"email"`
+	Purpose string `json:"purpose"`
+	Email   string `json:"email"`
+}
+
+type RefreshTokenClaims struct {
+	jwt.StandardClaims
+	Purpose string   `json:"purpose"`
+	Roles   []string `json:"roles,omitempty"`
+}
+
+type EmailChangeUndoTokenClaims struct {
+	jwt.StandardClaims
+	Purpose  string `json:"purpose"`
+	OldEmail string `json:"oldEmail"`
+	NewEmail string `json:"newEmail"`
+}
+
+type EmailChange struct {
+	PermanentId            string
+	NewEmail               string
+	ServerCode             string
+	ServerCodeSendedConter int
+	ServerCodeSendedAt     int64
+}
+
+type PhoneChange struct {
+	PermanentId            string
+	NewPhone               string
+	ServerCode             string
+	ServerCodeSendedConter int
+	ServerCodeSendedAt     int64
+}
+
+type ProfileChange struct {
+	PermanentId string
+	Field       string
+	OldValue    string
+	NewValue    string
+}
+
+type Profile struct {
+	Login        string
+	Email        string
+	PendingEmail string
+	Phone        string
+	PendingPhone string
+	SMSEnabled   bool
+	HasPassword  bool
+	Msg          string
+	Regs         []string
+	RetryAfter   int64
+	CSRFToken    string
+}
+
+type SecurityAlertTokenClaims struct {
+	jwt.StandardClaims
+	Purpose          string `json:"purpose"`
+	AlertPermanentId string `json:"alertPermanentId"`
+	AlertEmail       string `json:"alertEmail"`
+	Event            string `json:"event"`
+}
+
+type SecurityAlert struct {
+	Event      string
+	OccurredAt int64
+	IP         string
+	UserAgent  string
+	ByAdmin    bool
+	RevokeLink string
+}
+
+type UnsubscribeTokenClaims struct {
+	jwt.StandardClaims
+	Purpose          string `json:"purpose"`
+	UnsubscribeEmail string `json:"unsubscribeEmail"`
+	Setting          string `json:"setting"`
+}
+
+type AccountDeletionTokenClaims struct {
+	jwt.StandardClaims
+	Purpose     string `json:"purpose"`
+	PermanentId string `json:"permanentId"`
+}
+
+type ExportedLogin struct {
+	Login     string `json:"login"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedEmail struct {
+	Email     string `json:"email"`
+	Yauth     bool   `json:"yauth"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedPhone struct {
+	Phone     string `json:"phone"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedSession struct {
+	UserAgent      string `json:"userAgent"`
+	Yauth          bool   `json:"yauth"`
+	RememberMe     bool   `json:"rememberMe"`
+	CreatedAt      int64  `json:"createdAt"`
+	LastActivityAt int64  `json:"lastActivityAt"`
+	Cancelled      bool   `json:"cancelled"`
+}
+
+type ExportedRefreshToken struct {
+	UserAgent string `json:"userAgent"`
+	Yauth     bool   `json:"yauth"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedProfileChange struct {
+	Field     string `json:"field"`
+	OldValue  string `json:"oldValue"`
+	NewValue  string `json:"newValue"`
+	ChangedAt int64  `json:"changedAt"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedCodeSend struct {
+	Email  string `json:"email"`
+	SentAt int64  `json:"sentAt"`
+}
+
+type ExportedResetToken struct {
+	Email     string `json:"email"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedAccountDeletion struct {
+	RequestedAt int64 `json:"requestedAt"`
+	DeleteAfter int64 `json:"deleteAfter"`
+	Cancelled   bool  `json:"cancelled"`
+}
+
+type ExportedAccountStatus struct {
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+	CreatedAt int64  `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type ExportedRole struct {
+	Role      string `json:"role"`
+	GrantedAt int64  `json:"grantedAt"`
+	Cancelled bool   `json:"cancelled"`
+}
+
+type AccountExport struct {
+	PermanentId      string                    `json:"permanentId"`
+	ExportedAt       int64                     `json:"exportedAt"`
+	Logins           []ExportedLogin           `json:"logins"`
+	Emails           []ExportedEmail           `json:"emails"`
+	Phones           []ExportedPhone           `json:"phones"`
+	PasswordCount    int                       `json:"passwordCount"`
+	Sessions         []ExportedSession         `json:"sessions"`
+	RefreshTokens    []ExportedRefreshToken    `json:"refreshTokens"`
+	ProfileChanges   []ExportedProfileChange   `json:"profileChanges"`
+	CodeSends        []ExportedCodeSend        `json:"codeSends"`
+	ResetTokens      []ExportedResetToken      `json:"resetTokens"`
+	AccountDeletions []ExportedAccountDeletion `json:"accountDeletions"`
+	AccountStatuses  []ExportedAccountStatus   `json:"accountStatuses"`
+	Roles            []ExportedRole            `json:"roles"`
+}
+
+type AdminAction struct {
+	AdminPermanentId  string
+	AdminLogin        string
+	TargetPermanentId string
+	Action            string
+	Detail            string
+	CreatedAt         int64
+}
+
+type AccountStatus struct {
+	PermanentId string
+	Status      string
+	Reason      string
+	CreatedAt   int64
+	ExpiresAt   int64
+}
+
+type AdminUser struct {
+	PermanentId string
+	Login       string
+	Email       string
+	Status      AccountStatus
+}
+
+type AdminSearchPage struct {
+	Query            string
+	Users            []AdminUser
+	CanManageInvites bool
+	Msg              string
+	CSRFToken        string
+}
+
+type AdminUserPage struct {
+	User           AdminUser
+	Roles          []string
+	AllRoles       []Role
+	CanManageRoles bool
+	DeleteAfter    int64
+	Account        AccountExport
+	Actions        []AdminAction
+	Msg            string
+	CSRFToken      string
+}
+
+type Invite struct {
+	Code      string
+	Email     string
+	CreatedBy string
+	CreatedAt int64
+	ExpiresAt int64
+	UsedBy    string
+	UsedAt    int64
+	Cancelled bool
+}
+
+type OutboxMail struct {
+	IdempotencyKey string
+	ContentHash    string
+	Sender         string
+	Recipient      string
+	Subject        string
+	Message        []byte
+	Attempts       int
+	CreatedAt      int64
+}
+
+type AdminInvitesPage struct {
+	Invites   []Invite
+	Msg       string
+	CSRFToken string
+}
+
+type NotificationSetting struct {
+	Name     string
+	Enabled  bool
+	Critical bool
+}
+
+type NotificationSettingsPage struct {
+	Settings  []NotificationSetting
+	Msg       string
+	CSRFToken string
+}
+
+type SecurityDigest struct {
+	Since          int64
+	Sessions       []ExportedSession
+	ProfileChanges []ExportedProfileChange
+	SettingsLink   string
+}
+
+type AdminTemplatesPage struct {
+	Pages  []string
+	Emails []string
+	Dir    string
+	Reload bool
+}
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+type Access struct {
+	PermanentId string
+	Roles       []string
+	Permissions []string
+}
+
+type SessionActivity struct {
+	RememberMe     bool
+	Yauth          bool
+	CreatedAt      int64
+	LastActivityAt int64
+}
+
+type SigningKey struct {
+	Kid              string `json:"kid"`
+	Secret           string `json:"secret"`
+	EncryptionSecret string `json:"encryptionSecret,omitempty"`
+	Alg              string `json:"alg,omitempty"`
+	PrivateKeyFile   string `json:"privateKeyFile,omitempty"`
+	Status           string `json:"status"`
+	CreatedAt        int64  `json:"createdAt"`
+}
+
+type Keyring struct {
+	JWT          []SigningKey `json:"jwt"`
+	LoginStore   []SigningKey `json:"loginStore"`
+	CaptchaStore []SigningKey `json:"captchaStore"`
+	Cookie       []SigningKey `json:"cookie"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type AccessTokenClaims struct {
+	jwt.StandardClaims
+	Purpose string `json:"purpose"`
+}
+
+type AccessTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
 }
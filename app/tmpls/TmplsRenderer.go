@@ -2,14 +2,20 @@
 //
 // Файл содержит:
 //   - Must: вспомогательная функция для обработки шаблонов
+//   - tmplFuncs: функции, доступные в шаблонах
 //   - TmplsRenderer: основная функция для рендеринга шаблонов
-//   - BaseTmpl и другие шаблоны: набор HTML-шаблонов для различных страниц приложения
+//   - LocalizedTmpl: текущие шаблоны с надписями на выбранном языке
+//   - BaseTmpl и другие шаблоны: набор встроенных HTML-шаблонов для различных страниц приложения
+//
+// Встроенные шаблоны можно заменить файлами из каталога TEMPLATES_DIR (см. loader.go).
 package tmpls
 
 import (
 	"html/template"
 	"net/http"
+	"time"
 
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/pkg/errors"
 )
 
@@ -20,26 +26,113 @@ func Must(t *template.Template, err error) *template.Template {
 	return template.Must(t, err)
 }
 
-// Объявление глобальных переменных для хранения скомпилированных шаблонов.
+// tmplFuncs содержит функции, доступные в шаблонах:
+//   - unixTime: форматирует Unix-время в UTC, для нулевого значения возвращает "-"
+//   - locales: поддерживаемые языки для переключателя языка
+//   - publicURL: абсолютная ссылка на страницу приложения (см. PublicURL)
+//   - t и lang: текст из каталога i18n и язык шаблона (см. localeFuncs)
+var tmplFuncs = template.FuncMap{
+	"unixTime": func(unix int64) string {
+		if unix == 0 {
+			return "-"
+		}
+		return time.Unix(unix, 0).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"locales": func() []string {
+		return i18n.Locales
+	},
+	"publicURL": PublicURL,
+}
+
+// localeFuncs возвращает функции шаблона, зависящие от языка locale:
+//   - t: текст по ключу из каталога i18n, с аргументами - форматированный
+//   - lang: язык шаблона для атрибута lang
+func localeFuncs(locale string) map[string]any {
+	return map[string]any{
+		"t": func(key string, args ...any) string {
+			return i18n.Text(locale, key, args...)
+		},
+		"lang": func() string {
+			return locale
+		},
+	}
+}
+
+// htmlTmplSources содержит встроенные HTML-шаблоны страниц и писем.
 //
-// BaseTmpl: базовый шаблон, используемый как основа для всех страниц
-// Остальные шаблоны: специфичные шаблоны для различных страниц приложения
-var (
-	BaseTmpl = Must(template.New("base").Parse(baseTMPL))
-	_        = Must(BaseTmpl.Parse(signUpTMPL))
-	_        = Must(BaseTmpl.Parse(signInTMPL))
-	_        = Must(BaseTmpl.Parse(homeTMPL))
-	_        = Must(BaseTmpl.Parse(serverAuthCodeSendTMPL))
-	_        = Must(BaseTmpl.Parse(emailMsgWithServerAuthCodeTMPL))
-	_        = Must(BaseTmpl.Parse(emailMsgAboutSuspiciousLoginEmailTMPL))
-	_        = Must(BaseTmpl.Parse(generatePasswordResetLinkTMPL))
-	_        = Must(BaseTmpl.Parse(emailMsgWithPasswordResetLinkTMPL))
-	_        = Must(BaseTmpl.Parse(setNewPasswordTMPL))
-	_        = Must(BaseTmpl.Parse(emailMsgAboutNewDeviceLoginEmailTMPL))
-)
+// Имя источника используется как имя файла при выгрузке шаблонов (см. ExportTmpls);
+// шаблоны из каталога TEMPLATES_DIR разбираются после встроенных и заменяют их.
+var htmlTmplSources = []tmplSource{
+	{name: "base", text: baseTMPL},
+	{name: "signUp", text: signUpTMPL},
+	{name: "signIn", text: signInTMPL},
+	{name: "home", text: homeTMPL},
+	{name: "serverAuthCodeSend", text: serverAuthCodeSendTMPL},
+	{name: "emailMsgWithServerAuthCode", text: emailMsgWithServerAuthCodeTMPL},
+	{name: "emailMsgAboutSuspiciousLoginEmail", text: emailMsgAboutSuspiciousLoginEmailTMPL},
+	{name: "generatePasswordResetLink", text: generatePasswordResetLinkTMPL},
+	{name: "emailMsgWithPasswordResetLink", text: emailMsgWithPasswordResetLinkTMPL},
+	{name: "setNewPassword", text: setNewPasswordTMPL},
+	{name: "emailMsgAboutNewDeviceLoginEmail", text: emailMsgAboutNewDeviceLoginEmailTMPL},
+	{name: "err403", text: err403TMPL},
+	{name: "profile", text: profileTMPL},
+	{name: "emailMsgAboutEmailChange", text: emailMsgAboutEmailChangeTMPL},
+	{name: "emailChangeUndo", text: emailChangeUndoTMPL},
+	{name: "emailMsgAboutPasswordChange", text: emailMsgAboutPasswordChangeTMPL},
+	{name: "emailMsgWithAccountDeletionLink", text: emailMsgWithAccountDeletionLinkTMPL},
+	{name: "accountDeletionConfirm", text: accountDeletionConfirmTMPL},
+	{name: "adminUsers", text: adminUsersTMPL},
+	{name: "adminUser", text: adminUserTMPL},
+	{name: "adminInvites", text: adminInvitesTMPL},
+	{name: "adminTemplates", text: adminTemplatesTMPL},
+	{name: "notificationSettings", text: notificationSettingsTMPL},
+	{name: "emailMsgSecurityDigest", text: emailMsgSecurityDigestTMPL},
+	{name: "securityAlertDetails", text: securityAlertDetailsTMPL},
+	{name: "emailMsgSecurityAlert", text: emailMsgSecurityAlertTMPL},
+	{name: "securityAlertRevoke", text: securityAlertRevokeTMPL},
+	{name: "unsubscribe", text: unsubscribeTMPL},
+}
+
+// BaseTmpl содержит встроенные шаблоны всех страниц и писем (надписи на английском).
+//
+// Обработчики передают его в TmplsRenderer, который выполняет вместо него
+// текущие шаблоны на языке ответа (см. LocalizedTmpl).
+var BaseTmpl = Must(parseHTMLTmpls(nil))
+
+// parseHTMLTmpls разбирает встроенные HTML-шаблоны, а затем шаблоны overrides,
+// которые заменяют встроенные с теми же именами.
+func parseHTMLTmpls(overrides []tmplSource) (*template.Template, error) {
+	tmpl := template.New("base").Funcs(tmplFuncs).Funcs(localeFuncs(i18n.En))
+	for _, source := range htmlTmplSources {
+		if _, err := tmpl.Parse(source.text); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	for _, source := range overrides {
+		if _, err := tmpl.New(source.name).Parse(source.text); err != nil {
+			return nil, errors.Wrapf(err, "template file %s", source.name)
+		}
+	}
+	return tmpl, nil
+}
+
+// LocalizedTmpl возвращает текущие HTML-шаблоны с надписями на языке locale
+// или на языке по умолчанию, если язык не поддерживается.
+//
+// Шаблоны включают переопределения из TEMPLATES_DIR (см. LoadTmpls).
+func LocalizedTmpl(locale string) *template.Template {
+	tmpls := currentTmplSet().html
+	if tmpl, ok := tmpls[locale]; ok {
+		return tmpl
+	}
+	return tmpls[i18n.DefaultLocale()]
+}
 
 // TmplsRenderer выполняет рендеринг HTML-шаблона и записывает результат в ResponseWriter.
 //
+// Вместо BaseTmpl выполняет его копию на языке ответа (заголовок Content-Language,
+// установленный i18n.Middleware).
+//
 // Принимает:
 //   - w: ResponseWriter для записи результата
 //   - tmpl: скомпилированный шаблон
@@ -48,6 +141,9 @@ var (
 //
 // Возвращает ошибку, обёрнутую в стек вызовов для удобной отладки.
 var TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
+	if tmpl == BaseTmpl {
+		tmpl = LocalizedTmpl(i18n.FromHeader(w.Header()))
+	}
 	if err := tmpl.ExecuteTemplate(w, templateName, data); err != nil {
 		return errors.WithStack(err)
 	}
@@ -58,7 +154,7 @@ const (
 	baseTMPL = `
 {{ define "base" }}
 <!DOCTYPE html>
-<html lang="ru">
+<html lang="{{lang}}">
 <head>
 	<meta charset="UTF-8">
 	<title>{{ block "title" . }}Default Title{{ end }}</title>
@@ -78,16 +174,17 @@ const (
 	signUpTMPL = `
 {{ define "signUp" }}
 <!DOCTYPE html>
-<html lang="ru">
+<html lang="{{lang}}">
 <head>
 	<meta charset="UTF-8">
-	<title>Sign Up</title>
+	<title>{{t "signUp.title"}}</title>
 	<link rel="stylesheet" href="/public/styles.css">
 </head>
 <body>
 	<div class="container">
-		<h1>Sign Up</h1>
+		<h1>{{t "signUp.title"}}</h1>
 		{{if .Msg}}<div class="error-msg">{{.Msg}}</div>{{end}}
+		{{if .RetryAfter}}<div class="error-msg">{{t "signUp.retryAfter" .RetryAfter}}</div>{{end}}
 		{{if .Regs}}
 		<div class="requirements-list">
 			{{range .Regs}}
@@ -96,44 +193,63 @@ const (
 		</div>
 		{{end}}
 		<form method="POST" action="/check-in-db-and-validate-sign-up-user-input" Id="signup-form">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
 			<div class="form-group">
-				<label for="username">Username</label>
+				<label for="username">{{t "signUp.username"}}</label>
 				<input type="text" Id="username" name="login">
 			</div>
 			<div class="form-group">
-				<label for="email">Email</label>
+				<label for="email">{{t "form.email"}}</label>
 				<input type="email" Id="email" name="email">
 			</div>
 			<div class="form-group">
-				<label for="password">Password</label>
+				<label for="password">{{t "form.password"}}</label>
 				<input type="password" Id="password" name="password">
 			</div>
+			{{if .SMSEnabled}}
+			<div class="form-group">
+				<label>{{t "signUp.codeChannel"}}</label>
+				<label><input type="radio" name="codeChannel" value="email"{{if ne .CodeChannel "sms"}} checked{{end}}> {{t "signUp.channelEmail"}}</label>
+				<label><input type="radio" name="codeChannel" value="sms"{{if eq .CodeChannel "sms"}} checked{{end}}> {{t "signUp.channelSMS"}}</label>
+			</div>
+			<div class="form-group">
+				<label for="phone">{{t "form.phone"}}</label>
+				<input type="tel" Id="phone" name="phone" autocomplete="tel">
+			</div>
+			{{end}}
+			{{if or .InviteRequired .InviteCode}}
+			<div class="form-group">
+				<label for="invite">{{t "signUp.inviteCode"}}</label>
+				<input type="text" Id="invite" name="invite" value="{{.InviteCode}}">
+			</div>
+			{{end}}
 			<div class="form-group">
 				<label>
 					<input type="checkbox" name="rememberMe" value="true">
-					Remember me
+					{{t "form.rememberMe"}}
 				</label>
 			</div>
 			{{if .ShowCaptcha}}
 			<div class="g-recaptcha g-recaptcha-centered" data-sitekey="6LfUPt4rAAAAAAEU_lnGN9DbW_QngiTObsj8ro0D"></div>
 			{{end}}
-			<button type="submit" class="btn" Id="signup-button">Sign Up</button>
+			<button type="submit" class="btn" Id="signup-button">{{t "signUp.title"}}</button>
 		</form>
 		<div class="divIder signin-gap-fix">
-			<span>or</span>
+			<span>{{t "form.or"}}</span>
 		</div>
 		<form method="GET" action="/yauth">
-			<button type="submit" class="oauth-btn">Sign up with Yandex</button>
+			{{if .InviteCode}}<input type="hidden" name="invite" value="{{.InviteCode}}">{{end}}
+			<button type="submit" class="oauth-btn">{{t "signUp.yandex"}}</button>
 		</form>
 		<div class="login-link">
-			Already have an account? <a href="/sign-in">Sign In</a>
+			{{t "signUp.haveAccount"}} <a href="/sign-in">{{t "nav.signIn"}}</a>
 		</div>
 	</div>
 	<script>
 		document.getElementById('signup-form').addEventListener('submit', function() {
 			const button = document.getElementById('signup-button');
 			button.disabled = true;
-			button.textContent = 'Loading...';
+			button.textContent = '{{t "form.loading"}}';
 		});
 	</script>
 
@@ -149,10 +265,10 @@ const (
 	serverAuthCodeSendTMPL = `
 {{ define "serverAuthCodeSend" }}
 <!DOCTYPE html>
-<html lang="ru">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
-    <title>Verification Code</title>
+    <title>{{t "code.pageTitle"}}</title>
     <link rel="stylesheet" href="/public/styles.css">
     <style>
         #clientCode {
@@ -182,12 +298,14 @@ const (
 </head>
 <body>
     <div class="container">
-        <h1>Verification</h1>
+        <h1>{{t "code.title"}}</h1>
         {{if .Msg}}<div class="error-msg">{{.Msg}}</div>{{end}}
-        <p class="msg">We've sent a verification code to your email. Please enter it below.</p>
+        {{if .RetryAfter}}<div class="error-msg">{{t "code.retryAfter" .RetryAfter}}</div>{{end}}
+        <p class="msg">{{if eq .CodeChannel "sms"}}{{t "code.sentSMS"}}{{else}}{{t "code.sent"}}{{end}}</p>
         <form method="POST" action="/code-validate" id="codeForm">
+            <input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
             <div class="form-group-centered">
-                <label for="clientCode">Verification Code</label>
+                <label for="clientCode">{{t "code.pageTitle"}}</label>
                 <input type="text" id="clientCode" name="clientCode" required maxlength="6" pattern="[0-9]*" inputmode="numeric">
             </div>
             {{if .ShowCaptcha}}
@@ -195,17 +313,22 @@ const (
                 <div class="g-recaptcha" data-sitekey="6LfUPt4rAAAAAAEU_lnGN9DbW_QngiTObsj8ro0D"></div>
             </div>
             {{end}}
-            <button type="submit" class="btn">Verify</button>
+            <button type="submit" class="btn">{{t "code.submit"}}</button>
         </form>
         <div class="login-link">
-            Didn't receive the code? 
+            {{t "code.notReceived"}}
             <span id="resend-container">
-                <a href="/server-auth-code-send-again" id="resend-link">Send again</a>
+                <a href="/server-auth-code-send-again" id="resend-link">{{t "code.sendAgain"}}</a>
             </span>
             <span id="resend-timer" style="display: none;">
-                Resend available in <span id="countdown">60</span>s
+                {{t "code.resendIn"}} <span id="countdown">60</span>{{t "code.seconds"}}
             </span>
         </div>
+        {{if .AltCodeChannel}}
+        <div class="login-link">
+            <a href="/server-auth-code-send-again?channel={{.AltCodeChannel}}">{{if eq .AltCodeChannel "sms"}}{{t "code.sendSMSInstead"}}{{else}}{{t "code.sendEmailInstead"}}{{end}}</a>
+        </div>
+        {{end}}
     </div>
 
     {{if .ShowCaptcha}}
@@ -221,6 +344,11 @@ const (
             
             const COOLDOWN_SECONDS = 60;
             const STORAGE_KEY = 'resendCooldownEnd';
+            const SERVER_RETRY_AFTER = {{if .RetryAfter}}{{.RetryAfter}}{{else}}0{{end}};
+
+            if (SERVER_RETRY_AFTER > 0) {
+                localStorage.setItem(STORAGE_KEY, Math.floor(Date.now() / 1000) + SERVER_RETRY_AFTER);
+            }
             
             function checkCooldown() {
                 const now = Math.floor(Date.now() / 1000);
@@ -274,10 +402,10 @@ const (
 	signInTMPL = `
 {{ define "signIn" }}
 <!DOCTYPE html>
-<html lang="ru">
+<html lang="{{lang}}">
 <head>
 	<meta charset="UTF-8">
-	<title>Sign In</title>
+	<title>{{t "signIn.title"}}</title>
 	<link rel="stylesheet" href="/public/styles.css">
 	<style>
 		.error-highlight {
@@ -288,18 +416,10 @@ const (
 </head>
 <body>
 	<div class="container">
-		<h1>Sign In</h1>
+		<h1>{{t "signIn.title"}}</h1>
 		{{if .Msg}}
-			{{if eq .Msg "User does not exist"}}
-			<div class="error-msg">User does not exist</div>
-			{{else if eq .Msg "Pass the verification reCAPTCHA."}}
-			<div class="error-msg">{{.Msg}}</div>
-			{{else if eq .Msg "Please sign in by Yandex and set password"}}
+			{{if eq .MsgKey "yauthPasswordNotSet"}}
 			<div class="yandex-hint">{{.Msg}}</div>
-			{{else if eq .Msg "Login is invalid"}}
-			<div class="error-msg">{{.Msg}}</div>
-			{{else if eq .Msg "Password is invalid"}}
-			<div class="error-msg">{{.Msg}}</div>
 			{{else}}
 			<div class="error-msg">{{.Msg}}</div>
 			{{end}}
@@ -312,38 +432,39 @@ const (
 		</div>
 		{{end}}
 		<form method="POST" action="/check-in-db-and-validate-sign-in-user-input">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
 			<div class="form-group">
-				<label for="login">Username</label>
-				<input type="text" Id="login" name="login">
+				<label for="login">{{t "signIn.loginOrEmail"}}</label>
+				<input type="text" Id="login" name="login" autocomplete="username">
 			</div>
 			<div class="form-group">
-				<label for="password">Password</label>
+				<label for="password">{{t "form.password"}}</label>
 				<input type="password" Id="password" name="password">
 			</div>
              <div class="form-group">
  <label>
  <input type="checkbox" name="rememberMe" value="true">
- Remember me
+ {{t "form.rememberMe"}}
  </label>
  </div>
 			{{if .ShowCaptcha}}
 			<div class="g-recaptcha g-recaptcha-centered" data-sitekey="6LfUPt4rAAAAAAEU_lnGN9DbW_QngiTObsj8ro0D"></div>
 			{{end}}
-			<button type="submit" class="btn">Sign In</button>
+			<button type="submit" class="btn">{{t "signIn.title"}}</button>
 		</form>
 		<div class="divIder">
-			<span>or</span>
+			<span>{{t "form.or"}}</span>
 		</div>
 		<form method="GET" action="/yauth">
-			<button type="submit" class="oauth-btn">Sign in with Yandex</button>
+			<button type="submit" class="oauth-btn">{{t "signIn.yandex"}}</button>
 		</form>
 		{{if .ShowForgotPassword}}
 		<div class="error-msg reset-hint">
-			Forgot your password? <a href="/generate-password-reset-link">Reset Password</a>
+			{{t "signIn.forgotPassword"}} <a href="/generate-password-reset-link">{{t "nav.resetPassword"}}</a>
 		</div>
 		{{end}}
 		<div class="login-link signin-gap-fix">
-			Don't have an account? <a href="/sign-up">Sign Up</a>
+			{{t "signIn.noAccount"}} <a href="/sign-up">{{t "nav.signUp"}}</a>
 		</div>
 	</div>
 	{{if .ShowCaptcha}}
@@ -357,24 +478,26 @@ const (
 	homeTMPL = `
 {{ define "home" }}
 <!DOCTYPE html>
-<html lang="ru">
+<html lang="{{lang}}">
 <head>
 	<meta charset="UTF-8">
-	<title>Home</title>
+	<title>{{t "home.title"}}</title>
 	<link rel="stylesheet" href="/public/styles.css">
 </head>
 <body>
 	<div class="container">
 		<div class="header">
-			<h1>Welcome</h1>
+			<h1>{{t "home.welcome"}}</h1>
 			<div class="header-buttons">
-				<form method="GET" action="/logout">
-					<button type="submit" class="btn btn-danger">Sign Out</button>
+				<a href="/profile" class="btn">{{t "home.profile"}}</a>
+				<form method="POST" action="/logout">
+					<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+					<button type="submit" class="btn btn-danger">{{t "home.signOut"}}</button>
 				</form>
 			</div>
 		</div>
 		<div class="welcome">
-			<p>You have successfully signed in. You can now use all the features of the application.</p>
+			<p>{{t "home.signedIn"}}</p>
 		</div>
 	</div>
 </body>
@@ -384,34 +507,31 @@ const (
 	generatePasswordResetLinkTMPL = `
 {{ define "generatePasswordResetLink" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
 	<meta charset="UTF-8">
-	<title>Password Reset</title>
+	<title>{{t "reset.title"}}</title>
 	<link rel="stylesheet" href="/public/styles.css">
 </head>
 <body>
 	<div class="container">
 		{{if not .Msg}}
-		<h1>Password Reset</h1>
-		<p class="msg">Enter your email to reset your password.</p>
+		<h1>{{t "reset.title"}}</h1>
+		<p class="msg">{{t "reset.enterEmail"}}</p>
 		<form method="POST" action="/generate-password-reset-link">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
 			<div class="form-group">
-				<label for="email">Email</label>
+				<label for="email">{{t "form.email"}}</label>
 				<input type="email" Id="email" name="email" required autocomplete="email">
 			</div>
-			<button type="submit" class="btn">Submit</button>
+			<button type="submit" class="btn">{{t "reset.submit"}}</button>
 		</form>
 		{{else}}
-			{{if eq .Msg "Password reset link has been sent."}}
-				<div class="msg success-msg" style="text-align:center; padding: 1.5rem 0;">{{.Msg}}</div>
-			{{else if eq .Msg "Password reset link has been sent to your email."}}
-				<div class="msg success-msg" style="text-align:center; padding: 1.5rem 0;">{{.Msg}}</div>
-			{{else if eq .Msg "Password reset link has been sent"}}
+			{{if eq .MsgKey "successfulMailSendingStatus"}}
 				<div class="msg success-msg" style="text-align:center; padding: 1.5rem 0;">{{.Msg}}</div>
 			{{else}}
 				<div class="error-msg" style="text-align:center; padding: 1.5rem 0;">{{.Msg}}</div>
-				<a href="/sign-up" class="btn" style="margin-top: 1rem;">Go to Sign-up Page</a>
+				<a href="/sign-up" class="btn" style="margin-top: 1rem;">{{t "reset.goToSignUp"}}</a>
 			{{end}}
 		{{end}}
 	</div>
@@ -422,11 +542,11 @@ const (
 	emailMsgWithServerAuthCodeTMPL = `
 {{ define "emailMsgWithServerAuthCode" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="wIdth=device-wIdth, initial-scale=1">
-    <title>Email Verification Code</title>
+    <title>{{t "mail.authCode.title"}}</title>
     <style>
         :root {
             --primary-color: #2563eb;
@@ -482,10 +602,10 @@ const (
 </head>
 <body>
     <div class="container">
-        <h1>Email Verification</h1>
-        <p>Your verification code:</p>
+        <h1>{{t "mail.authCode.title"}}</h1>
+        <p>{{t "mail.authCode.yourCode"}}</p>
         <div class="code-box">{{.Code}}</div>
-        <p>Enter this code to continue.</p>
+        <p>{{t "mail.authCode.enter"}}</p>
     </div>
 </body>
 </html>
@@ -494,11 +614,11 @@ const (
 	emailMsgAboutSuspiciousLoginEmailTMPL = `
 {{ define "emailMsgAboutSuspiciousLoginEmail" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="wIdth=device-wIdth, initial-scale=1">
-    <title>Suspicious login attempt</title>
+    <title>{{t "mail.suspiciousLogin.title"}}</title>
     <style>
         :root {
             --primary-color: #dc2626;
@@ -545,9 +665,9 @@ const (
 </head>
 <body>
     <div class="container">
-    <h1>Suspicious login attempt detected</h1>
-    <p>Login attempt from: {{.UserAgent}}.</p>
-    <p>If unauthorized, change your password immediately.</p>
+    <h1>{{t "mail.suspiciousLogin.title"}}</h1>
+    <p>{{t "mail.suspiciousLogin.from" .UserAgent}}</p>
+    <p>{{t "mail.suspiciousLogin.advice"}}</p>
 </div>
 </body>
 </html>
@@ -556,11 +676,11 @@ const (
 	emailMsgWithPasswordResetLinkTMPL = `
 {{ define "emailMsgWithPasswordResetLink" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="wIdth=device-wIdth, initial-scale=1">
-    <title>Password Reset</title>
+    <title>{{t "mail.passwordReset.title"}}</title>
     <style>
         :root {
             --primary-color: #2563eb;
@@ -609,8 +729,8 @@ const (
 </head>
 <body>
     <div class="container">
-        <h1>Password Reset</h1>
-        <p>You have requested a password reset. Please click the button below to reset your password:</p>
+        <h1>{{t "mail.passwordReset.title"}}</h1>
+        <p>{{t "mail.passwordReset.requested"}}</p>
         <p>
             <a href="{{.ResetLink}}" target="_blank" rel="noopener" role="button" style="
                 display:inline-block;
@@ -620,12 +740,13 @@ const (
                 padding:10px 20px;
                 border-radius:6px;
                 font-weight:600;">
-                Reset Password
+                {{t "nav.resetPassword"}}
             </a>
         </p>
-        <p>If you don't see the button or it doesn't work, you can simply click this link, or copy and paste it into your browser:</p>
+        <p>{{t "mail.passwordReset.fallback"}}</p>
         <p>{{.ResetLink}}</p>
-        <p>If you dId not request a password reset, please ignore this email.</p>
+        <p>{{t "mail.passwordReset.ignore"}}</p>
+        {{template "securityAlertDetails" .Alert}}
     </div>
 </body>
 </html>
@@ -634,32 +755,33 @@ const (
 	setNewPasswordTMPL = `
 {{ define "setNewPassword" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="wIdth=device-wIdth, initial-scale=1">
-    <title>Set New Password</title>
+    <title>{{t "newPassword.title"}}</title>
     <link rel="stylesheet" href="/public/styles.css">
 </head>
 <body>
     <div class="container">
-        <h1>Set New Password</h1>
+        <h1>{{t "newPassword.title"}}</h1>
         {{if .Msg}}<div class="error-msg">{{.Msg}}</div>{{end}}
         <form method="POST" action="/set-new-password">
+            <input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
             <div class="form-group">
-                <label for="oldPassword">Old Password</label>
+                <label for="oldPassword">{{t "newPassword.old"}}</label>
                 <input type="password" Id="oldPassword" name="oldPassword" required autocomplete="current-password">
             </div>
             <div class="form-group">
-                <label for="newPassword">New Password</label>
+                <label for="newPassword">{{t "form.newPassword"}}</label>
                 <input type="password" Id="newPassword" name="newPassword" required autocomplete="new-password">
             </div>
             <div class="form-group">
-                <label for="confirmPassword">Confirm New Password</label>
+                <label for="confirmPassword">{{t "newPassword.confirm"}}</label>
                 <input type="password" Id="confirmPassword" name="confirmPassword" required autocomplete="new-password">
             </div>
             <input type="hIdden" name="token" value="{{.Token}}">
-            <button type="submit" class="btn">Set Password</button>
+            <button type="submit" class="btn">{{t "newPassword.submit"}}</button>
         </form>
     </div>
 </body>
@@ -669,11 +791,11 @@ const (
 	emailMsgAboutNewDeviceLoginEmailTMPL = `
 {{ define "emailMsgAboutNewDeviceLoginEmail" }}
 <!DOCTYPE html>
-<html lang="en">
+<html lang="{{lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="wIdth=device-wIdth, initial-scale=1">
-    <title>New device login</title>
+    <title>{{t "mail.newDeviceLogin.title"}}</title>
     <style>
         :root {
             --primary-color: #2563eb;
@@ -716,12 +838,936 @@ const (
 </head>
 <body>
 <div class="container">
-    <h1>New device login</h1>
-    <p>Detected a login from a new device</p>
-    <p>If this was not you, change your password</p>
+    <h1>{{t "mail.newDeviceLogin.title"}}</h1>
+    <p>{{t "mail.newDeviceLogin.detected"}}</p>
+    <p>{{t "mail.newDeviceLogin.advice"}}</p>
+</div>
+</body>
+</html>
+{{ end }}
+`
+	err403TMPL = `
+{{ define "err403" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "forbidden.title"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<h1>403</h1>
+		<div class="error-msg">{{.Msg}}</div>
+		<div class="login-link">
+			<a href="/sign-in">{{t "forbidden.back"}}</a>
+		</div>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	profileTMPL = `
+{{ define "profile" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "profile.title"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "profile.title"}}</h1>
+			<div class="header-buttons">
+				<a href="/profile/notifications" class="btn">{{t "nav.notifications"}}</a>
+				<a href="/home" class="btn">{{t "nav.home"}}</a>
+			</div>
+		</div>
+		{{if .Msg}}
+		<div class="msg">{{.Msg}}</div>
+		{{if .Regs}}
+		<ul class="requirements">
+			{{range .Regs}}<li>{{.}}</li>{{end}}
+		</ul>
+		{{end}}
+		{{end}}
+		{{if .Login}}
+		<form method="POST" action="/profile/login">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="login">{{t "form.login"}}</label>
+				<input type="text" id="login" name="login" value="{{.Login}}" required autocomplete="username">
+			</div>
+			<button type="submit" class="btn">{{t "nav.changeLogin"}}</button>
+		</form>
+		{{end}}
+		<form method="POST" action="/profile/email">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="email">{{t "form.email"}}</label>
+				<input type="email" id="email" name="email" value="{{.Email}}" required autocomplete="email">
+			</div>
+			<button type="submit" class="btn">{{t "nav.changeEmail"}}</button>
+		</form>
+		{{if .PendingEmail}}
+		<form method="POST" action="/profile/email/confirm">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="clientCode">{{t "profile.codeSentTo" .PendingEmail}}</label>
+				<input type="text" id="clientCode" name="clientCode" required autocomplete="one-time-code">
+			</div>
+			<button type="submit" class="btn">{{t "profile.confirmEmail"}}</button>
+		</form>
+		{{end}}
+		{{if .SMSEnabled}}
+		<form method="POST" action="/profile/phone">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="phone">{{t "form.phone"}}</label>
+				<input type="tel" id="phone" name="phone" value="{{.Phone}}" required autocomplete="tel">
+			</div>
+			<button type="submit" class="btn">{{t "nav.changePhone"}}</button>
+		</form>
+		{{if .PendingPhone}}
+		<form method="POST" action="/profile/phone/confirm">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="phoneCode">{{t "profile.codeSentTo" .PendingPhone}}</label>
+				<input type="text" id="phoneCode" name="clientCode" required autocomplete="one-time-code">
+			</div>
+			<button type="submit" class="btn">{{t "profile.confirmPhone"}}</button>
+		</form>
+		{{end}}
+		{{end}}
+		{{if .Phone}}
+		<form method="POST" action="/profile/phone/remove">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			{{if not .SMSEnabled}}<p>{{t "form.phone"}}: {{.Phone}}</p>{{end}}
+			<button type="submit" class="btn btn-danger">{{t "profile.removePhone"}}</button>
+		</form>
+		{{end}}
+		{{if .HasPassword}}
+		<form method="POST" action="/profile/password">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="currentPassword">{{t "form.current"}}</label>
+				<input type="password" id="currentPassword" name="currentPassword" required autocomplete="current-password">
+			</div>
+			<div class="form-group">
+				<label for="newPassword">{{t "form.newPassword"}}</label>
+				<input type="password" id="newPassword" name="newPassword" required autocomplete="new-password">
+			</div>
+			<div class="form-group">
+				<label for="confirmPassword">{{t "form.confirm"}}</label>
+				<input type="password" id="confirmPassword" name="confirmPassword" required autocomplete="new-password">
+			</div>
+			<div class="form-group">
+				<label><input type="checkbox" name="signOutOtherSessions" value="true"> {{t "profile.signOutOthers"}}</label>
+			</div>
+			<button type="submit" class="btn">{{t "profile.changePassword"}}</button>
+		</form>
+		{{else}}
+		<form method="POST" action="/profile/set-password">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<p>{{t "profile.setPassword"}}</p>
+			{{if not .Login}}
+			<div class="form-group">
+				<label for="newLogin">{{t "form.login"}}</label>
+				<input type="text" id="newLogin" name="login" required autocomplete="username">
+			</div>
+			{{end}}
+			<div class="form-group">
+				<label for="setPassword">{{t "form.password"}}</label>
+				<input type="password" id="setPassword" name="newPassword" required autocomplete="new-password">
+			</div>
+			<div class="form-group">
+				<label for="setConfirmPassword">{{t "form.confirm"}}</label>
+				<input type="password" id="setConfirmPassword" name="confirmPassword" required autocomplete="new-password">
+			</div>
+			<button type="submit" class="btn">{{t "profile.setLoginAndPwd"}}</button>
+		</form>
+		{{end}}
+		<div class="form-group">
+			<a href="/profile/export" class="btn">{{t "profile.export"}}</a>
+		</div>
+		<form method="POST" action="/profile/delete">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="deletePassword">{{t "form.current"}}</label>
+				<input type="password" id="deletePassword" name="currentPassword" autocomplete="current-password">
+			</div>
+			<button type="submit" name="confirmBy" value="password" class="btn btn-danger">{{t "nav.deleteAccount"}}</button>
+			<button type="submit" name="confirmBy" value="email" class="btn btn-danger">{{t "profile.deleteByEmail"}}</button>
+		</form>
+		<form method="POST" action="/profile/locale">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="locale">{{t "profile.language"}}</label>
+				<select id="locale" name="locale">
+					{{range locales}}
+					<option value="{{.}}"{{if eq . lang}} selected{{end}}>{{t (print "locale." .)}}</option>
+					{{end}}
+				</select>
+			</div>
+			<button type="submit" class="btn">{{t "profile.changeLanguage"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	emailMsgAboutEmailChangeTMPL = `
+{{ define "emailMsgAboutEmailChange" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{t "mail.emailChange.title"}}</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background-color: #1f2937;
+            color: #e5e7eb;
+            line-height: 1.5;
+            padding: 20px;
+        }
+        .container {
+            max-width: 400px;
+            margin: 2rem auto;
+            padding: 2rem;
+            background: #374151;
+            border-radius: 8px;
+            text-align: center;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin-bottom: 1rem;
+            color: #2563eb;
+        }
+        p {
+            margin-bottom: 1.5rem;
+            color: #e5e7eb;
+        }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>{{t "mail.emailChange.title"}}</h1>
+    <p>{{t "mail.emailChange.changed" .NewEmail}}</p>
+    {{if .UndoLink}}
+    <p>{{t "mail.emailChange.undo"}}</p>
+    <p>
+        <a href="{{.UndoLink}}" target="_blank" rel="noopener" role="button" style="
+            display:inline-block;
+            background-color:#2563eb;
+            color:#ffffff;
+            text-decoration:none;
+            padding:10px 20px;
+            border-radius:6px;
+            font-weight:600;">
+            {{t "nav.undoEmailChange"}}
+        </a>
+    </p>
+    <p>{{.UndoLink}}</p>
+    {{end}}
+    {{template "securityAlertDetails" .Alert}}
 </div>
 </body>
 </html>
 {{ end }}
+`
+	emailChangeUndoTMPL = `
+{{ define "emailChangeUndo" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "nav.undoEmailChange"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<h1>{{t "nav.undoEmailChange"}}</h1>
+		<p class="msg">{{t "emailUndo.text"}}</p>
+		<form method="POST" action="/profile/email/undo">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button type="submit" class="btn btn-danger">{{t "nav.undoEmailChange"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	emailMsgAboutPasswordChangeTMPL = `
+{{ define "emailMsgAboutPasswordChange" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{t "mail.passwordChange.title"}}</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background-color: #1f2937;
+            color: #e5e7eb;
+            line-height: 1.5;
+            padding: 20px;
+        }
+        .container {
+            max-width: 400px;
+            margin: 2rem auto;
+            padding: 2rem;
+            background: #374151;
+            border-radius: 8px;
+            text-align: center;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin-bottom: 1rem;
+            color: #2563eb;
+        }
+        p {
+            margin-bottom: 1.5rem;
+            color: #e5e7eb;
+        }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>{{t "mail.passwordChange.title"}}</h1>
+    <p>{{t "mail.passwordChange.changed"}}</p>
+    {{template "securityAlertDetails" .Alert}}
+</div>
+</body>
+</html>
+{{ end }}
+`
+	emailMsgWithAccountDeletionLinkTMPL = `
+{{ define "emailMsgWithAccountDeletionLink" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{t "mail.accountDeletion.title"}}</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background-color: #1f2937;
+            color: #e5e7eb;
+            line-height: 1.5;
+            padding: 20px;
+        }
+        .container {
+            max-width: 400px;
+            margin: 2rem auto;
+            padding: 2rem;
+            background: #374151;
+            border-radius: 8px;
+            text-align: center;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin-bottom: 1rem;
+            color: #2563eb;
+        }
+        p {
+            margin-bottom: 1.5rem;
+            color: #e5e7eb;
+        }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>{{t "mail.accountDeletion.title"}}</h1>
+    <p>{{t "mail.accountDeletion.requested"}}</p>
+    <p>{{t "mail.accountDeletion.ignore"}}</p>
+    <p>
+        <a href="{{.DeletionLink}}" target="_blank" rel="noopener" role="button" style="
+            display:inline-block;
+            background-color:#2563eb;
+            color:#ffffff;
+            text-decoration:none;
+            padding:10px 20px;
+            border-radius:6px;
+            font-weight:600;">
+            {{t "mail.accountDeletion.confirm"}}
+        </a>
+    </p>
+    <p>{{.DeletionLink}}</p>
+</div>
+</body>
+</html>
+{{ end }}
+`
+	accountDeletionConfirmTMPL = `
+{{ define "accountDeletionConfirm" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "nav.deleteAccount"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<h1>{{t "nav.deleteAccount"}}</h1>
+		<p class="msg">{{t "deletion.text"}}</p>
+		<form method="POST" action="/profile/delete/confirm">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button type="submit" class="btn btn-danger">{{t "nav.deleteAccount"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	adminUsersTMPL = `
+{{ define "adminUsers" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "admin.usersTitle"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "nav.users"}}</h1>
+			<div class="header-buttons">
+				{{if .CanManageInvites}}<a href="/admin/invites" class="btn">{{t "nav.invites"}}</a>{{end}}
+				<a href="/home" class="btn">{{t "nav.home"}}</a>
+			</div>
+		</div>
+		{{if .Msg}}
+		<div class="msg">{{.Msg}}</div>
+		{{end}}
+		<form method="GET" action="/admin">
+			<div class="form-group">
+				<label for="q">{{t "admin.loginOrEmail"}}</label>
+				<input type="text" id="q" name="q" value="{{.Query}}" required>
+			</div>
+			<button type="submit" class="btn">{{t "admin.search"}}</button>
+		</form>
+		{{if .Users}}
+		<table>
+			<tr><th>{{t "form.login"}}</th><th>{{t "form.email"}}</th><th>{{t "admin.status"}}</th></tr>
+			{{range .Users}}
+			<tr>
+				<td><a href="/admin/user?id={{.PermanentId}}">{{if .Login}}{{.Login}}{{else}}-{{end}}</a></td>
+				<td>{{.Email}}</td>
+				<td>{{.Status.Status}}</td>
+			</tr>
+			{{end}}
+		</table>
+		{{end}}
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	adminUserTMPL = `
+{{ define "adminUser" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "admin.userTitle"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "admin.user"}}</h1>
+			<div class="header-buttons">
+				<a href="/admin" class="btn">{{t "nav.users"}}</a>
+			</div>
+		</div>
+		{{if .Msg}}
+		<div class="msg">{{.Msg}}</div>
+		{{end}}
+		<table>
+			<tr><th>Id</th><td>{{.User.PermanentId}}</td></tr>
+			<tr><th>{{t "form.login"}}</th><td>{{if .User.Login}}{{.User.Login}}{{else}}-{{end}}</td></tr>
+			<tr><th>{{t "form.email"}}</th><td>{{.User.Email}}</td></tr>
+			<tr><th>{{t "admin.status"}}</th><td>{{.User.Status.Status}}{{if .User.Status.Reason}} ({{.User.Status.Reason}}){{end}}{{if .User.Status.ExpiresAt}} {{t "admin.until" (unixTime .User.Status.ExpiresAt)}}{{end}}</td></tr>
+			<tr><th>{{t "admin.roles"}}</th><td>{{range $i, $role := .Roles}}{{if $i}}, {{end}}{{$role}}{{else}}-{{end}}</td></tr>
+			<tr><th>{{t "form.password"}}</th><td>{{if .Account.PasswordCount}}{{t "admin.passwordSet"}}{{else}}{{t "admin.passwordNotSet"}}{{end}}</td></tr>
+			{{if .DeleteAfter}}
+			<tr><th>{{t "admin.deletion"}}</th><td>{{t "admin.deletionAfter" (unixTime .DeleteAfter)}}</td></tr>
+			{{end}}
+		</table>
+
+		{{if or (eq .User.Status.Status "disabled") (eq .User.Status.Status "banned")}}
+		<form method="POST" action="/admin/user/enable">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<button type="submit" class="btn">{{t "admin.enable"}}</button>
+		</form>
+		{{else}}
+		<form method="POST" action="/admin/user/disable">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<div class="form-group">
+				<label for="status">{{t "admin.status"}}</label>
+				<select id="status" name="status">
+					<option value="disabled">disabled</option>
+					<option value="banned">banned</option>
+				</select>
+			</div>
+			<div class="form-group">
+				<label for="reason">{{t "admin.reason"}}</label>
+				<input type="text" id="reason" name="reason" maxlength="255">
+			</div>
+			<div class="form-group">
+				<label for="days">{{t "form.days"}}</label>
+				<input type="number" id="days" name="days" min="1">
+			</div>
+			<button type="submit" class="btn btn-danger">{{t "admin.disable"}}</button>
+		</form>
+		{{end}}
+		<form method="POST" action="/admin/user/logout">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<button type="submit" class="btn">{{t "admin.signOutAll"}}</button>
+		</form>
+		<form method="POST" action="/admin/user/password-reset">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<button type="submit" class="btn">{{t "admin.sendReset"}}</button>
+		</form>
+		<form method="POST" action="/admin/user/login">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<div class="form-group">
+				<label for="login">{{t "form.login"}}</label>
+				<input type="text" id="login" name="login" value="{{.User.Login}}" required>
+			</div>
+			<button type="submit" class="btn">{{t "nav.changeLogin"}}</button>
+		</form>
+		<form method="POST" action="/admin/user/email">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<div class="form-group">
+				<label for="email">{{t "form.email"}}</label>
+				<input type="email" id="email" name="email" value="{{.User.Email}}" required>
+			</div>
+			<button type="submit" class="btn">{{t "nav.changeEmail"}}</button>
+		</form>
+		{{if .CanManageRoles}}
+		<form method="POST" action="/admin/user/role/grant">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="id" value="{{.User.PermanentId}}">
+			<div class="form-group">
+				<label for="grantRole">{{t "admin.role"}}</label>
+				<select id="grantRole" name="role" required>
+					{{range .AllRoles}}
+					<option value="{{.Name}}">{{.Name}}{{if .Description}} - {{.Description}}{{end}}</option>
+					{{end}}
+				</select>
+			</div>
+			<button type="submit" class="btn">{{t "admin.grantRole"}}</button>
+		</form>
+		{{range .Roles}}
+		<form method="POST" action="/admin/user/role/revoke">
+			<input type="hidden" name="csrfToken" value="{{$.CSRFToken}}">
+			<input type="hidden" name="id" value="{{$.User.PermanentId}}">
+			<input type="hidden" name="role" value="{{.}}">
+			<button type="submit" class="btn btn-danger">{{t "admin.revokeRole" .}}</button>
+		</form>
+		{{end}}
+		{{end}}
+
+		<h2>{{t "admin.sessions"}}</h2>
+		<table>
+			<tr><th>{{t "admin.userAgent"}}</th><th>{{t "admin.signedIn"}}</th><th>{{t "admin.lastActivity"}}</th><th>{{t "admin.status"}}</th></tr>
+			{{range .Account.Sessions}}
+			<tr>
+				<td>{{.UserAgent}}{{if .Yauth}} ({{t "admin.yandex"}}){{end}}</td>
+				<td>{{unixTime .CreatedAt}}</td>
+				<td>{{unixTime .LastActivityAt}}</td>
+				<td>{{if .Cancelled}}{{t "admin.sessionEnded"}}{{else}}{{t "admin.sessionActive"}}{{end}}</td>
+			</tr>
+			{{end}}
+		</table>
+
+		<h2>{{t "admin.profileChanges"}}</h2>
+		<table>
+			<tr><th>{{t "admin.field"}}</th><th>{{t "admin.oldValue"}}</th><th>{{t "admin.newValue"}}</th><th>{{t "admin.changedAt"}}</th></tr>
+			{{range .Account.ProfileChanges}}
+			<tr>
+				<td>{{.Field}}{{if .Cancelled}} ({{t "admin.undone"}}){{end}}</td>
+				<td>{{.OldValue}}</td>
+				<td>{{.NewValue}}</td>
+				<td>{{unixTime .ChangedAt}}</td>
+			</tr>
+			{{end}}
+		</table>
+
+		<h2>{{t "admin.codeSends"}}</h2>
+		<table>
+			<tr><th>{{t "form.email"}}</th><th>{{t "admin.sentAt"}}</th></tr>
+			{{range .Account.CodeSends}}
+			<tr><td>{{.Email}}</td><td>{{unixTime .SentAt}}</td></tr>
+			{{end}}
+		</table>
+
+		<h2>{{t "admin.actions"}}</h2>
+		<table>
+			<tr><th>{{t "admin.action"}}</th><th>{{t "admin.detail"}}</th><th>{{t "admin.admin"}}</th><th>{{t "admin.at"}}</th></tr>
+			{{range .Actions}}
+			<tr>
+				<td>{{.Action}}</td>
+				<td>{{.Detail}}</td>
+				<td>{{if .AdminLogin}}{{.AdminLogin}}{{else}}{{.AdminPermanentId}}{{end}}</td>
+				<td>{{unixTime .CreatedAt}}</td>
+			</tr>
+			{{end}}
+		</table>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	adminInvitesTMPL = `
+{{ define "adminInvites" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "admin.invitesTitle"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "nav.invites"}}</h1>
+			<div class="header-buttons">
+				<a href="/home" class="btn">{{t "nav.home"}}</a>
+			</div>
+		</div>
+		{{if .Msg}}
+		<div class="msg">{{.Msg}}</div>
+		{{end}}
+		<form method="POST" action="/admin/invites/create">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<div class="form-group">
+				<label for="email">{{t "admin.inviteEmail"}}</label>
+				<input type="email" id="email" name="email">
+			</div>
+			<div class="form-group">
+				<label for="days">{{t "form.days"}}</label>
+				<input type="number" id="days" name="days" min="1">
+			</div>
+			<button type="submit" class="btn">{{t "admin.createInvite"}}</button>
+		</form>
+		{{if .Invites}}
+		<table>
+			<tr><th>{{t "admin.link"}}</th><th>{{t "form.email"}}</th><th>{{t "admin.created"}}</th><th>{{t "admin.expires"}}</th><th>{{t "admin.state"}}</th><th></th></tr>
+			{{range .Invites}}
+			<tr>
+				<td>{{publicURL "/sign-up"}}?invite={{.Code}}</td>
+				<td>{{if .Email}}{{.Email}}{{else}}-{{end}}</td>
+				<td>{{unixTime .CreatedAt}}</td>
+				<td>{{unixTime .ExpiresAt}}</td>
+				<td>{{if .UsedAt}}{{t "admin.inviteUsed" (unixTime .UsedAt)}} <a href="/admin/user?id={{.UsedBy}}">{{.UsedBy}}</a>{{else if .Cancelled}}{{t "admin.inviteRevoked"}}{{else}}{{t "admin.inviteActive"}}{{end}}</td>
+				<td>
+					{{if not (or .UsedAt .Cancelled)}}
+					<form method="POST" action="/admin/invites/revoke">
+						<input type="hidden" name="csrfToken" value="{{$.CSRFToken}}">
+						<input type="hidden" name="code" value="{{.Code}}">
+						<button type="submit" class="btn btn-danger">{{t "admin.revoke"}}</button>
+					</form>
+					{{end}}
+				</td>
+			</tr>
+			{{end}}
+		</table>
+		{{end}}
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	adminTemplatesTMPL = `
+{{ define "adminTemplates" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "admin.templatesTitle"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "nav.templates"}}</h1>
+			<div class="header-buttons">
+				<a href="/home" class="btn">{{t "nav.home"}}</a>
+			</div>
+		</div>
+		<div class="msg">{{if .Dir}}{{t "admin.templatesDir" .Dir}}{{else}}{{t "admin.templatesBuilt"}}{{end}}{{if .Reload}}. {{t "admin.templatesLive"}}{{end}}</div>
+		<h2>{{t "admin.pages"}}</h2>
+		<table>
+			{{range .Pages}}
+			{{$name := .}}
+			<tr>
+				<td>{{$name}}</td>
+				<td>{{range locales}}<a href="/admin/templates/preview?name={{$name}}&locale={{.}}" target="_blank">{{t (print "locale." .)}}</a> {{end}}</td>
+			</tr>
+			{{end}}
+		</table>
+		<h2>{{t "admin.emails"}}</h2>
+		<table>
+			{{range .Emails}}
+			{{$name := .}}
+			<tr>
+				<td>{{$name}}</td>
+				<td>{{range locales}}<a href="/admin/templates/preview?name={{$name}}&locale={{.}}" target="_blank">{{t (print "locale." .)}}</a> (<a href="/admin/templates/preview?name={{$name}}&locale={{.}}&format=text" target="_blank">{{t "admin.textVersion"}}</a>) {{end}}</td>
+			</tr>
+			{{end}}
+		</table>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	notificationSettingsTMPL = `
+{{ define "notificationSettings" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "notifications.title"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<div class="header">
+			<h1>{{t "notifications.title"}}</h1>
+			<div class="header-buttons">
+				<a href="/profile" class="btn">{{t "profile.title"}}</a>
+			</div>
+		</div>
+		{{if .Msg}}
+		<div class="msg">{{.Msg}}</div>
+		{{end}}
+		<form method="POST" action="/profile/notifications">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			{{range .Settings}}
+			<div class="form-group">
+				{{if .Critical}}
+				<label><input type="checkbox" checked disabled> {{t (print "notifications." .Name)}}</label>
+				<small>{{t "notifications.critical"}}</small>
+				{{else}}
+				<label><input type="checkbox" name="{{.Name}}" value="true"{{if .Enabled}} checked{{end}}> {{t (print "notifications." .Name)}}</label>
+				{{end}}
+			</div>
+			{{end}}
+			<button type="submit" class="btn">{{t "notifications.save"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	emailMsgSecurityDigestTMPL = `
+{{ define "emailMsgSecurityDigest" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{t "mail.securityDigest.title"}}</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background-color: #1f2937;
+            color: #e5e7eb;
+            line-height: 1.5;
+            padding: 20px;
+        }
+        .container {
+            max-width: 400px;
+            margin: 2rem auto;
+            padding: 2rem;
+            background: #374151;
+            border-radius: 8px;
+            text-align: center;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin-bottom: 1rem;
+            color: #2563eb;
+        }
+        h2 {
+            font-size: 1.1rem;
+            margin-bottom: 0.5rem;
+        }
+        p, ul {
+            margin-bottom: 1.5rem;
+            color: #e5e7eb;
+        }
+        ul { list-style: none; }
+        a { color: #2563eb; }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>{{t "mail.securityDigest.title"}}</h1>
+    <p>{{t "mail.securityDigest.since" (unixTime .Since)}}</p>
+    {{if or .Sessions .ProfileChanges}}
+    {{if .Sessions}}
+    <h2>{{t "mail.securityDigest.sessions"}}</h2>
+    <ul>
+        {{range .Sessions}}<li>{{unixTime .CreatedAt}} - {{.UserAgent}}</li>{{end}}
+    </ul>
+    {{end}}
+    {{if .ProfileChanges}}
+    <h2>{{t "mail.securityDigest.changes"}}</h2>
+    <ul>
+        {{range .ProfileChanges}}<li>{{unixTime .ChangedAt}} - {{.Field}}</li>{{end}}
+    </ul>
+    {{end}}
+    {{else}}
+    <p>{{t "mail.securityDigest.noActivity"}}</p>
+    {{end}}
+    <p>{{t "mail.securityDigest.advice"}}</p>
+    <p>{{t "mail.securityDigest.settings"}} <a href="{{.SettingsLink}}" target="_blank" rel="noopener">{{.SettingsLink}}</a></p>
+</div>
+</body>
+</html>
+{{ end }}
+`
+	securityAlertDetailsTMPL = `
+{{ define "securityAlertDetails" }}
+{{if .OccurredAt}}
+<p>{{t "mail.securityAlert.time" (unixTime .OccurredAt)}}</p>
+{{if .ByAdmin}}
+<p>{{t "mail.securityAlert.byAdmin"}}</p>
+{{else}}
+<p>{{t "mail.securityAlert.ip" .IP}}</p>
+<p>{{t "mail.securityAlert.device" .UserAgent}}</p>
+{{end}}
+{{end}}
+{{if .RevokeLink}}
+<p>{{t "mail.securityAlert.revoke"}}</p>
+<p>
+    <a href="{{.RevokeLink}}" target="_blank" rel="noopener" role="button" style="
+        display:inline-block;
+        background-color:#dc2626;
+        color:#ffffff;
+        text-decoration:none;
+        padding:10px 20px;
+        border-radius:6px;
+        font-weight:600;">
+        {{t "nav.securityAlertRevoke"}}
+    </a>
+</p>
+<p>{{.RevokeLink}}</p>
+{{end}}
+{{ end }}
+`
+	emailMsgSecurityAlertTMPL = `
+{{ define "emailMsgSecurityAlert" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1">
+    <title>{{t (print "mail." .Alert.Event ".title")}}</title>
+    <style>
+        * { margin: 0; padding: 0; box-sizing: border-box; }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+            background-color: #1f2937;
+            color: #e5e7eb;
+            line-height: 1.5;
+            padding: 20px;
+        }
+        .container {
+            max-width: 400px;
+            margin: 2rem auto;
+            padding: 2rem;
+            background: #374151;
+            border-radius: 8px;
+            text-align: center;
+        }
+        h1 {
+            font-size: 1.5rem;
+            margin-bottom: 1rem;
+            color: #2563eb;
+        }
+        p {
+            margin-bottom: 1.5rem;
+            color: #e5e7eb;
+        }
+    </style>
+</head>
+<body>
+<div class="container">
+    <h1>{{t (print "mail." .Alert.Event ".title")}}</h1>
+    <p>{{t (print "mail." .Alert.Event ".text")}}</p>
+    {{template "securityAlertDetails" .Alert}}
+</div>
+</body>
+</html>
+{{ end }}
+`
+	securityAlertRevokeTMPL = `
+{{ define "securityAlertRevoke" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "nav.securityAlertRevoke"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<h1>{{t "nav.securityAlertRevoke"}}</h1>
+		<p class="msg">{{t "securityAlert.text"}}</p>
+		<form method="POST" action="/security/revoke">
+			<input type="hidden" name="csrfToken" value="{{.CSRFToken}}">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button type="submit" class="btn btn-danger">{{t "nav.securityAlertRevoke"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
+`
+	unsubscribeTMPL = `
+{{ define "unsubscribe" }}
+<!DOCTYPE html>
+<html lang="{{lang}}">
+<head>
+	<meta charset="UTF-8">
+	<title>{{t "nav.unsubscribe"}}</title>
+	<link rel="stylesheet" href="/public/styles.css">
+</head>
+<body>
+	<div class="container">
+		<h1>{{t "nav.unsubscribe"}}</h1>
+		<p class="msg">{{t "unsubscribe.text"}}</p>
+		<form method="POST" action="/unsubscribe">
+			<input type="hidden" name="token" value="{{.Token}}">
+			<button type="submit" class="btn">{{t "nav.unsubscribe"}}</button>
+		</form>
+	</div>
+</body>
+</html>
+{{ end }}
 `
 )
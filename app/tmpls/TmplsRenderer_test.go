@@ -10,6 +10,8 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
 	"github.com/pkg/errors"
 )
 
@@ -74,6 +76,11 @@ func TestBaseTmplCompilation(t *testing.T) {
 		"serverAuthCodeSend",
 		"generatePasswordResetLink",
 		"setNewPassword",
+		"profile",
+		"emailChangeUndo",
+		"accountDeletionConfirm",
+		"securityAlertRevoke",
+		"unsubscribe",
 	}
 
 	// Проверяем наличие каждого шаблона в базовом шаблоне
@@ -177,25 +184,32 @@ func TestTmplsRendererWithData(t *testing.T) {
 			name:         "signUp with message",
 			templateName: "signUp",
 			data: struct {
-				Msg         string
-				Regs        []string
-				ShowCaptcha bool
+				Msg            string
+				Regs           []string
+				ShowCaptcha    bool
+				RetryAfter     int64
+				CSRFToken      string
+				InviteCode     string
+				InviteRequired bool
+				SMSEnabled     bool
+				CodeChannel    string
 			}{Msg: "Test Error Message", Regs: []string{}, ShowCaptcha: false},
 			expectedText: "Test Error Message",
 		},
 		{
 			name:         "generatePasswordResetLink with message",
 			templateName: "generatePasswordResetLink",
-			data:         struct{ Msg string }{Msg: "Password reset sent"},
+			data:         structs.MsgForUser{Msg: "Password reset sent"},
 			expectedText: "Password reset sent",
 		},
 		{
 			name:         "setNewPassword with message and token",
 			templateName: "setNewPassword",
 			data: struct {
-				Msg   string
-				Token string
-			}{Msg: "Set new password", Token: "abc123"},
+				Msg       string
+				Token     string
+				CSRFToken string
+			}{Msg: "Set new password", Token: "abc123", CSRFToken: "csrf123"},
 			expectedText: "abc123",
 		},
 	}
@@ -240,13 +254,46 @@ func TestEmailTemplates(t *testing.T) {
 		{
 			name:         "emailMsgWithPasswordResetLink",
 			templateName: "emailMsgWithPasswordResetLink",
-			data:         struct{ ResetLink string }{ResetLink: "https://example.com/reset?token=abc123"},
+			data: struct {
+				ResetLink string
+				Alert     structs.SecurityAlert
+			}{ResetLink: "https://example.com/reset?token=abc123"},
 		},
 		{
 			name:         "emailMsgAboutNewDeviceLoginEmail",
 			templateName: "emailMsgAboutNewDeviceLoginEmail",
 			data:         struct{}{},
 		},
+		{
+			name:         "emailMsgAboutEmailChange",
+			templateName: "emailMsgAboutEmailChange",
+			data: struct {
+				NewEmail string
+				UndoLink string
+				Alert    structs.SecurityAlert
+			}{NewEmail: "new@example.com", UndoLink: "https://example.com/profile/email/undo?token=abc123"},
+		},
+		{
+			name:         "emailMsgAboutPasswordChange",
+			templateName: "emailMsgAboutPasswordChange",
+			data: struct {
+				Alert structs.SecurityAlert
+			}{Alert: structs.SecurityAlert{OccurredAt: 1704067200, IP: "203.0.113.10", UserAgent: "Mozilla/5.0", RevokeLink: "https://example.com/security/revoke?token=abc123"}},
+		},
+		{
+			name:         "emailMsgSecurityAlert",
+			templateName: "emailMsgSecurityAlert",
+			data: struct {
+				Alert structs.SecurityAlert
+			}{Alert: structs.SecurityAlert{Event: "sessionRevoke", OccurredAt: 1704067200, ByAdmin: true}},
+		},
+		{
+			name:         "emailMsgWithAccountDeletionLink",
+			templateName: "emailMsgWithAccountDeletionLink",
+			data: struct {
+				DeletionLink string
+			}{DeletionLink: "https://example.com/profile/delete/confirm?token=abc123"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -274,3 +321,217 @@ func TestEmailTemplates(t *testing.T) {
 		})
 	}
 }
+
+// TestProfileTemplate проверяет рендеринг страницы профиля.
+// Ожидается: текущие логин и email в формах, форма подтверждения кода только при ожидающей смене email.
+func TestProfileTemplate(t *testing.T) {
+	w := httptest.NewRecorder()
+	profile := structs.Profile{Login: "user123", Email: "old@example.com", HasPassword: true, CSRFToken: "csrf123"}
+	if err := TmplsRenderer(w, BaseTmpl, "profile", profile); err != nil {
+		t.Fatalf("failed to render profile: %v", err)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `value="user123"`) || !strings.Contains(body, `value="old@example.com"`) {
+		t.Errorf("expected current login and email in forms, got %q", body)
+	}
+	if strings.Contains(body, "/profile/email/confirm") {
+		t.Error("confirm form should be hidden without pending email change")
+	}
+
+	w = httptest.NewRecorder()
+	profile.PendingEmail = "new@example.com"
+	profile.Msg = "Confirmation code has been sent to the new email."
+	if err := TmplsRenderer(w, BaseTmpl, "profile", profile); err != nil {
+		t.Fatalf("failed to render profile: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/profile/password"`) || !strings.Contains(body, `name="signOutOtherSessions"`) {
+		t.Errorf("expected change password form, got %q", body)
+	}
+	if !strings.Contains(body, `href="/profile/export"`) || !strings.Contains(body, `action="/profile/delete"`) {
+		t.Errorf("expected data export link and delete account form, got %q", body)
+	}
+	if !strings.Contains(body, "/profile/email/confirm") || !strings.Contains(body, "new@example.com") {
+		t.Errorf("expected confirm form for pending email, got %q", body)
+	}
+	if !strings.Contains(body, profile.Msg) {
+		t.Errorf("expected message in profile page, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	profile = structs.Profile{Email: "user@yandex.ru", CSRFToken: "csrf123"}
+	if err := TmplsRenderer(w, BaseTmpl, "profile", profile); err != nil {
+		t.Fatalf("failed to render profile: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/profile/set-password"`) || !strings.Contains(body, `id="newLogin"`) {
+		t.Errorf("expected set login and password form for account without password, got %q", body)
+	}
+	if strings.Contains(body, `action="/profile/password"`) || strings.Contains(body, `action="/profile/login"`) {
+		t.Errorf("change password and login forms should be hidden for account without login and password, got %q", body)
+	}
+	if strings.Contains(body, `action="/profile/phone"`) || strings.Contains(body, `action="/profile/phone/remove"`) {
+		t.Errorf("phone forms should be hidden without SMS and phone, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	profile = structs.Profile{Email: "user@example.com", Phone: "+79991234567", PendingPhone: "+79997654321", SMSEnabled: true, CSRFToken: "csrf123"}
+	if err := TmplsRenderer(w, BaseTmpl, "profile", profile); err != nil {
+		t.Fatalf("failed to render profile: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/profile/phone"`) || !strings.Contains(body, `value="&#43;79991234567"`) {
+		t.Errorf("expected change phone form with current phone, got %q", body)
+	}
+	if !strings.Contains(body, `action="/profile/phone/confirm"`) || !strings.Contains(body, "&#43;79997654321") {
+		t.Errorf("expected confirm form for pending phone, got %q", body)
+	}
+	if !strings.Contains(body, `action="/profile/phone/remove"`) {
+		t.Errorf("expected remove phone form, got %q", body)
+	}
+}
+
+// TestAdminTemplates проверяет рендеринг страниц администратора.
+// Ожидается: результаты поиска со ссылками на пользователей, формы действий с CSRF токеном,
+// сессии, журнал действий администраторов и приглашения с формой отзыва неиспользованных.
+func TestAdminTemplates(t *testing.T) {
+	w := httptest.NewRecorder()
+	search := structs.AdminSearchPage{Query: "user", Users: []structs.AdminUser{{PermanentId: "perm123", Login: "user123", Email: "user@example.com", Status: structs.AccountStatus{Status: "banned"}}}}
+	if err := TmplsRenderer(w, BaseTmpl, "adminUsers", search); err != nil {
+		t.Fatalf("failed to render adminUsers: %v", err)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `href="/admin/user?id=perm123"`) || !strings.Contains(body, "banned") {
+		t.Errorf("expected found user with link and status, got %q", body)
+	}
+	if strings.Contains(body, `href="/admin/invites"`) {
+		t.Error("invites link should be hidden without invites.manage permission")
+	}
+
+	w = httptest.NewRecorder()
+	page := structs.AdminUserPage{
+		User:        structs.AdminUser{PermanentId: "perm123", Login: "user123", Email: "user@example.com", Status: structs.AccountStatus{Status: "active"}},
+		DeleteAfter: 100,
+		Account:     structs.AccountExport{Sessions: []structs.ExportedSession{{UserAgent: "test-agent", CreatedAt: 10, LastActivityAt: 20}}},
+		Actions:     []structs.AdminAction{{AdminLogin: "admin", Action: "logout", CreatedAt: 30}},
+		CSRFToken:   "csrf123",
+	}
+	if err := TmplsRenderer(w, BaseTmpl, "adminUser", page); err != nil {
+		t.Fatalf("failed to render adminUser: %v", err)
+	}
+	body = w.Body.String()
+	for _, action := range []string{"disable", "logout", "password-reset", "login", "email"} {
+		if !strings.Contains(body, `action="/admin/user/`+action+`"`) {
+			t.Errorf("expected %s form, got %q", action, body)
+		}
+	}
+	if strings.Contains(body, `action="/admin/user/enable"`) {
+		t.Error("enable form should be hidden for active account")
+	}
+	if !strings.Contains(body, `name="csrfToken" value="csrf123"`) || !strings.Contains(body, `name="id" value="perm123"`) {
+		t.Errorf("expected csrf token and user id in forms, got %q", body)
+	}
+	if !strings.Contains(body, "test-agent") || !strings.Contains(body, "1970-01-01") || !strings.Contains(body, "admin") {
+		t.Errorf("expected sessions, deletion date and admin actions, got %q", body)
+	}
+	if strings.Contains(body, `action="/admin/user/role/grant"`) {
+		t.Error("role forms should be hidden without roles.manage permission")
+	}
+
+	w = httptest.NewRecorder()
+	page.Roles = []string{"support"}
+	page.AllRoles = []structs.Role{{Name: "admin"}, {Name: "support"}}
+	page.CanManageRoles = true
+	if err := TmplsRenderer(w, BaseTmpl, "adminUser", page); err != nil {
+		t.Fatalf("failed to render adminUser with roles: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/admin/user/role/grant"`) || !strings.Contains(body, `<option value="admin">`) {
+		t.Errorf("expected grant form with all roles, got %q", body)
+	}
+	if !strings.Contains(body, `action="/admin/user/role/revoke"`) || !strings.Contains(body, `name="role" value="support"`) {
+		t.Errorf("expected revoke form for granted role, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	page.User.Status = structs.AccountStatus{Status: "banned", Reason: "spam", ExpiresAt: 86400}
+	if err := TmplsRenderer(w, BaseTmpl, "adminUser", page); err != nil {
+		t.Fatalf("failed to render banned adminUser: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/admin/user/enable"`) || strings.Contains(body, `action="/admin/user/disable"`) {
+		t.Errorf("expected only enable form for banned account, got %q", body)
+	}
+	if !strings.Contains(body, "banned (spam) until 1970-01-02 00:00:00 UTC") {
+		t.Errorf("expected status with reason and expiry, got %q", body)
+	}
+	w = httptest.NewRecorder()
+	search.CanManageInvites = true
+	if err := TmplsRenderer(w, BaseTmpl, "adminUsers", search); err != nil {
+		t.Fatalf("failed to render adminUsers with invites link: %v", err)
+	}
+	if !strings.Contains(w.Body.String(), `href="/admin/invites"`) {
+		t.Errorf("expected invites link, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	invites := structs.AdminInvitesPage{
+		Invites: []structs.Invite{
+			{Code: "code1", Email: "user@example.com", CreatedAt: 10},
+			{Code: "code2", CreatedAt: 10, UsedBy: "perm123", UsedAt: 20},
+		},
+		CSRFToken: "csrf123",
+	}
+	if err := TmplsRenderer(w, BaseTmpl, "adminInvites", invites); err != nil {
+		t.Fatalf("failed to render adminInvites: %v", err)
+	}
+	body = w.Body.String()
+	if !strings.Contains(body, `action="/admin/invites/create"`) || !strings.Contains(body, "/sign-up?invite=code1") {
+		t.Errorf("expected create form and invite link, got %q", body)
+	}
+	if !strings.Contains(body, `name="code" value="code1"`) || strings.Contains(body, `name="code" value="code2"`) {
+		t.Errorf("expected revoke form only for unused invite, got %q", body)
+	}
+	if !strings.Contains(body, `href="/admin/user?id=perm123"`) {
+		t.Errorf("expected link to account created by invite, got %q", body)
+	}
+}
+
+// TestLocalizedTemplates проверяет выбор языка шаблонов.
+// Ожидается: страница рендерится на языке из Content-Language, письма - на языке locale,
+// неизвестный язык заменяется языком по умолчанию.
+func TestLocalizedTemplates(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Language", i18n.Ru)
+	if err := TmplsRenderer(w, BaseTmpl, "signIn", structs.MsgForUser{CSRFToken: "csrf123"}); err != nil {
+		t.Fatalf("failed to render signIn: %v", err)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `<html lang="ru">`) || !strings.Contains(body, i18n.Text(i18n.Ru, "signIn.title")) {
+		t.Errorf("expected Russian page, got %q", body)
+	}
+	if strings.Contains(body, i18n.Text(i18n.En, "signIn.title")+"<") {
+		t.Errorf("expected no English title, got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	if err := TmplsRenderer(w, BaseTmpl, "signIn", structs.MsgForUser{}); err != nil {
+		t.Fatalf("failed to render signIn: %v", err)
+	}
+	if !strings.Contains(w.Body.String(), `<html lang="en">`) {
+		t.Errorf("expected English page without Content-Language, got %q", w.Body.String())
+	}
+
+	var text strings.Builder
+	data := struct{ Code string }{Code: "1234"}
+	if err := LocalizedEmailTextTmpl(i18n.Ru).ExecuteTemplate(&text, "emailMsgWithServerAuthCodeText", data); err != nil {
+		t.Fatalf("failed to render email text: %v", err)
+	}
+	if !strings.Contains(text.String(), i18n.Text(i18n.Ru, "mail.authCode.yourCode")+" 1234") {
+		t.Errorf("expected Russian email text, got %q", text.String())
+	}
+
+	if LocalizedTmpl("de") != LocalizedTmpl(i18n.DefaultLocale()) {
+		t.Error("expected default locale templates for unknown locale")
+	}
+}
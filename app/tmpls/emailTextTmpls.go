@@ -0,0 +1,153 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл содержит текстовые версии писем (text/plain), которые отправляются вместе с HTML-версиями
+// в письмах multipart/alternative. Шаблон каждого письма называется так же, как HTML-шаблон,
+// с суффиксом Text и получает те же данные. Файлы *.txt из каталога TEMPLATES_DIR
+// заменяют встроенные шаблоны (см. loader.go).
+package tmpls
+
+import (
+	texttemplate "text/template"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/pkg/errors"
+)
+
+// EmailTextTmpl содержит встроенные текстовые шаблоны писем (надписи на английском).
+var EmailTextTmpl = texttemplate.Must(parseEmailTextTmpls(nil))
+
+// parseEmailTextTmpls разбирает встроенные текстовые шаблоны писем, а затем шаблоны overrides,
+// которые заменяют встроенные с теми же именами.
+func parseEmailTextTmpls(overrides []tmplSource) (*texttemplate.Template, error) {
+	tmpl, err := texttemplate.New("emailText").Funcs(texttemplate.FuncMap(tmplFuncs)).Funcs(localeFuncs(i18n.En)).Parse(emailTextTMPL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, source := range overrides {
+		if _, err := tmpl.New(source.name).Parse(source.text); err != nil {
+			return nil, errors.Wrapf(err, "template file %s", source.name)
+		}
+	}
+	return tmpl, nil
+}
+
+// LocalizedEmailTextTmpl возвращает текущие текстовые шаблоны писем на языке locale
+// или на языке по умолчанию, если язык не поддерживается.
+func LocalizedEmailTextTmpl(locale string) *texttemplate.Template {
+	tmpls := currentTmplSet().text
+	if tmpl, ok := tmpls[locale]; ok {
+		return tmpl
+	}
+	return tmpls[i18n.DefaultLocale()]
+}
+
+const emailTextTMPL = `
+{{- define "emailMsgWithServerAuthCodeText" -}}
+{{t "mail.authCode.title"}}
+
+{{t "mail.authCode.yourCode"}} {{.Code}}
+
+{{t "mail.authCode.enter"}}
+{{ end }}
+
+{{- define "emailMsgAboutSuspiciousLoginEmailText" -}}
+{{t "mail.suspiciousLogin.title"}}
+
+{{t "mail.suspiciousLogin.from" .UserAgent}}
+
+{{t "mail.suspiciousLogin.advice"}}
+{{ end }}
+
+{{- define "emailMsgWithPasswordResetLinkText" -}}
+{{t "mail.passwordReset.title"}}
+
+{{t "mail.passwordReset.requested"}}
+
+{{.ResetLink}}
+
+{{t "mail.passwordReset.ignore"}}
+{{template "securityAlertDetailsText" .Alert}}
+{{- end }}
+
+{{- define "emailMsgAboutNewDeviceLoginEmailText" -}}
+{{t "mail.newDeviceLogin.title"}}
+
+{{t "mail.newDeviceLogin.detected"}}
+
+{{t "mail.newDeviceLogin.advice"}}
+{{ end }}
+
+{{- define "emailMsgAboutEmailChangeText" -}}
+{{t "mail.emailChange.title"}}
+
+{{t "mail.emailChange.changed" .NewEmail}}
+{{if .UndoLink}}
+{{t "mail.emailChange.undo"}}
+
+{{.UndoLink}}
+{{end}}
+{{- template "securityAlertDetailsText" .Alert}}
+{{- end }}
+
+{{- define "emailMsgAboutPasswordChangeText" -}}
+{{t "mail.passwordChange.title"}}
+
+{{t "mail.passwordChange.changed"}}
+{{template "securityAlertDetailsText" .Alert}}
+{{- end }}
+
+{{- define "emailMsgWithAccountDeletionLinkText" -}}
+{{t "mail.accountDeletion.title"}}
+
+{{t "mail.accountDeletion.requested"}}
+
+{{.DeletionLink}}
+
+{{t "mail.accountDeletion.ignore"}}
+{{ end }}
+
+{{- define "emailMsgSecurityDigestText" -}}
+{{t "mail.securityDigest.title"}}
+
+{{t "mail.securityDigest.since" (unixTime .Since)}}
+{{if or .Sessions .ProfileChanges}}
+{{- if .Sessions}}
+{{t "mail.securityDigest.sessions"}}
+{{range .Sessions}}- {{unixTime .CreatedAt}} {{.UserAgent}}
+{{end}}
+{{- end}}
+{{- if .ProfileChanges}}
+{{t "mail.securityDigest.changes"}}
+{{range .ProfileChanges}}- {{unixTime .ChangedAt}} {{.Field}}
+{{end}}
+{{- end}}
+{{- else}}
+{{t "mail.securityDigest.noActivity"}}
+{{end}}
+{{t "mail.securityDigest.advice"}}
+
+{{t "mail.securityDigest.settings"}} {{.SettingsLink}}
+{{ end }}
+
+{{- define "emailMsgSecurityAlertText" -}}
+{{t (print "mail." .Alert.Event ".title")}}
+
+{{t (print "mail." .Alert.Event ".text")}}
+{{template "securityAlertDetailsText" .Alert}}
+{{- end }}
+
+{{- define "securityAlertDetailsText" -}}
+{{if .OccurredAt}}
+{{t "mail.securityAlert.time" (unixTime .OccurredAt)}}
+{{if .ByAdmin}}{{t "mail.securityAlert.byAdmin"}}
+{{else}}{{t "mail.securityAlert.ip" .IP}}
+{{t "mail.securityAlert.device" .UserAgent}}
+{{end}}
+{{- end}}
+{{- if .RevokeLink}}
+{{t "mail.securityAlert.revoke"}}
+
+{{.RevokeLink}}
+{{end}}
+{{- end }}
+`
@@ -0,0 +1,332 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл содержит загрузку шаблонов:
+//   - LoadTmpls: загружает шаблоны при запуске с учетом каталога TEMPLATES_DIR
+//   - CheckTmpls: проверяет шаблоны каталога без запуска сервера
+//   - ExportTmpls: выгружает встроенные шаблоны в каталог для редактирования
+//   - currentTmplSet: текущие шаблоны, перезагружаемые при TEMPLATES_RELOAD
+//
+// Шаблоны встроены в приложение. Файлы *.html (страницы и HTML-версии писем) и *.txt
+// (текстовые версии писем) из каталога TEMPLATES_DIR разбираются после встроенных:
+// блок {{define "имя"}} в файле заменяет встроенный шаблон с тем же именем.
+package tmpls
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/pkg/errors"
+)
+
+// tmplSource - исходный текст шаблонов и имя, под которым он разбирается.
+type tmplSource struct {
+	name string
+	text string
+}
+
+// tmplSet - шаблоны страниц и писем, собранные из встроенных шаблонов и каталога dir,
+// с копиями для каждого языка из i18n.Locales.
+type tmplSet struct {
+	dir     string
+	reload  bool
+	version string
+	html    map[string]*template.Template
+	text    map[string]*texttemplate.Template
+}
+
+// pageTmplNames - шаблоны страниц, которые должны быть определены.
+var pageTmplNames = []string{
+	"signUp",
+	"signIn",
+	"serverAuthCodeSend",
+	"home",
+	"generatePasswordResetLink",
+	"setNewPassword",
+	"err403",
+	"profile",
+	"emailChangeUndo",
+	"accountDeletionConfirm",
+	"adminUsers",
+	"adminUser",
+	"adminInvites",
+	"adminTemplates",
+	"notificationSettings",
+	"securityAlertRevoke",
+	"unsubscribe",
+}
+
+// emailTmplNames - HTML-шаблоны писем, которые должны быть определены;
+// текстовые версии называются так же с суффиксом Text.
+var emailTmplNames = []string{
+	"emailMsgWithServerAuthCode",
+	"emailMsgAboutSuspiciousLoginEmail",
+	"emailMsgAboutNewDeviceLoginEmail",
+	"emailMsgWithPasswordResetLink",
+	"emailMsgAboutEmailChange",
+	"emailMsgAboutPasswordChange",
+	"emailMsgWithAccountDeletionLink",
+	"emailMsgSecurityDigest",
+	"emailMsgSecurityAlert",
+}
+
+// currentTmpls содержит текущие шаблоны; до вызова LoadTmpls - только встроенные.
+var currentTmpls atomic.Pointer[tmplSet]
+
+// reloadMu не дает нескольким запросам перезагружать шаблоны одновременно.
+var reloadMu sync.Mutex
+
+func init() {
+	set, err := loadTmplSet("")
+	if err != nil {
+		panic(err)
+	}
+	currentTmpls.Store(set)
+}
+
+// LoadTmpls загружает шаблоны при запуске сервера.
+//
+// Использует переменные окружения:
+//   - TEMPLATES_DIR: каталог с шаблонами, заменяющими встроенные (по умолчанию не задан)
+//   - TEMPLATES_RELOAD: true - перезагружать шаблоны при изменении файлов каталога (для разработки)
+//
+// Возвращает ошибку, если шаблон не разбирается, не определен или не выполняется с примером данных.
+func LoadTmpls() error {
+	dir := os.Getenv("TEMPLATES_DIR")
+	set, err := loadTmplSet(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	set.reload = dir != "" && os.Getenv("TEMPLATES_RELOAD") == "true"
+	currentTmpls.Store(set)
+	return nil
+}
+
+// CheckTmpls проверяет шаблоны из каталога dir так же, как LoadTmpls при запуске.
+func CheckTmpls(dir string) error {
+	if _, err := loadTmplSet(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// ExportTmpls записывает встроенные шаблоны в каталог dir: HTML-шаблоны - по файлу <имя>.html,
+// текстовые версии писем - в emailText.txt. В каталоге переопределений достаточно оставить
+// измененные файлы, остальные шаблоны будут взяты из встроенных.
+func ExportTmpls(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, source := range htmlTmplSources {
+		if err := writeTmplFile(filepath.Join(dir, source.name+".html"), source.text); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := writeTmplFile(filepath.Join(dir, "emailText.txt"), emailTextTMPL); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// writeTmplFile записывает шаблон в файл, не заменяя существующий.
+func writeTmplFile(path, text string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := file.WriteString(strings.TrimPrefix(text, "\n")); err != nil {
+		file.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(file.Close())
+}
+
+// currentTmplSet возвращает текущие шаблоны.
+//
+// При TEMPLATES_RELOAD сравнивает файлы каталога с загруженными и при изменении
+// перезагружает шаблоны. Если новые шаблоны содержат ошибку, она логируется,
+// а страницы продолжают рендериться прежними шаблонами.
+func currentTmplSet() *tmplSet {
+	set := currentTmpls.Load()
+	if !set.reload {
+		return set
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	set = currentTmpls.Load()
+	version, err := tmplDirVersion(set.dir)
+	if err != nil {
+		log.Printf("%+v", err)
+		return set
+	}
+	if version == set.version {
+		return set
+	}
+
+	reloaded, err := loadTmplSet(set.dir)
+	if err != nil {
+		log.Printf("%+v", err)
+		// Ошибка логируется один раз: до следующего изменения файлов используются прежние шаблоны
+		failed := *set
+		failed.version = version
+		currentTmpls.Store(&failed)
+		return &failed
+	}
+	reloaded.reload = true
+	currentTmpls.Store(reloaded)
+	return reloaded
+}
+
+// loadTmplSet собирает шаблоны из встроенных и файлов каталога dir и проверяет их.
+func loadTmplSet(dir string) (*tmplSet, error) {
+	version, err := tmplDirVersion(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	htmlOverrides, textOverrides, err := readTmplDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	html, err := parseHTMLTmpls(htmlOverrides)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	text, err := parseEmailTextTmpls(textOverrides)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := checkTmplNames(html, text); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// html/template не позволяет копировать выполненные шаблоны,
+	// поэтому копии для языков создаются до проверки выполнением
+	set := &tmplSet{
+		dir:     dir,
+		version: version,
+		html:    map[string]*template.Template{},
+		text:    map[string]*texttemplate.Template{},
+	}
+	for _, locale := range i18n.Locales {
+		htmlClone, err := html.Clone()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		textClone, err := text.Clone()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		set.html[locale] = htmlClone.Funcs(localeFuncs(locale))
+		set.text[locale] = textClone.Funcs(localeFuncs(locale))
+	}
+
+	if err := checkTmplExecute(set); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return set, nil
+}
+
+// readTmplDir читает файлы шаблонов из каталога dir в порядке имен.
+//
+// Возвращает HTML-шаблоны (*.html) и текстовые шаблоны писем (*.txt);
+// остальные файлы и подкаталоги пропускаются. Для пустого dir возвращает пустые списки.
+func readTmplDir(dir string) ([]tmplSource, []tmplSource, error) {
+	if dir == "" {
+		return nil, nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	var html, text []tmplSource
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".html" && ext != ".txt") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+		source := tmplSource{name: entry.Name(), text: string(content)}
+		if ext == ".html" {
+			html = append(html, source)
+		} else {
+			text = append(text, source)
+		}
+	}
+	return html, text, nil
+}
+
+// tmplDirVersion возвращает отпечаток файлов каталога dir: имена, размеры и время изменения.
+func tmplDirVersion(dir string) (string, error) {
+	if dir == "" {
+		return "", nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var version strings.Builder
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(&version, "%s:%d:%d;", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	return version.String(), nil
+}
+
+// checkTmplNames проверяет, что определены все шаблоны страниц и писем.
+func checkTmplNames(html *template.Template, text *texttemplate.Template) error {
+	var missing []string
+	for _, name := range append(append([]string{}, pageTmplNames...), emailTmplNames...) {
+		if tmpl := html.Lookup(name); tmpl == nil || tmpl.Tree == nil {
+			missing = append(missing, name)
+		}
+	}
+	for _, name := range emailTmplNames {
+		if text.Lookup(name+"Text") == nil {
+			missing = append(missing, name+"Text")
+		}
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("templates not defined: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// checkTmplExecute выполняет все шаблоны с примерами данных из previewData,
+// чтобы ошибки в полях и функциях обнаруживались при загрузке, а не при рендеринге страницы.
+func checkTmplExecute(set *tmplSet) error {
+	for _, locale := range i18n.Locales {
+		for _, name := range pageTmplNames {
+			if err := set.html[locale].ExecuteTemplate(io.Discard, name, previewData(name)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		for _, name := range emailTmplNames {
+			if err := set.html[locale].ExecuteTemplate(io.Discard, name, previewData(name)); err != nil {
+				return errors.WithStack(err)
+			}
+			if err := set.text[locale].ExecuteTemplate(io.Discard, name+"Text", previewData(name)); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
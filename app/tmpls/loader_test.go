@@ -0,0 +1,166 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл тестирует загрузку шаблонов из каталога, их проверку и перезагрузку.
+package tmpls
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// keepCurrentTmpls восстанавливает текущие шаблоны после теста.
+func keepCurrentTmpls(t *testing.T) {
+	old := currentTmpls.Load()
+	t.Cleanup(func() { currentTmpls.Store(old) })
+}
+
+// writeTmplFiles записывает файлы шаблонов в каталог dir.
+func writeTmplFiles(t *testing.T, dir string, files map[string]string) {
+	for name, text := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0o644))
+	}
+}
+
+// renderSignIn рендерит страницу входа на языке locale текущими шаблонами.
+func renderSignIn(t *testing.T, locale string) string {
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Language", locale)
+	require.NoError(t, TmplsRenderer(w, BaseTmpl, "signIn", structs.MsgForUser{}))
+	return w.Body.String()
+}
+
+// TestLoadTmpls проверяет загрузку шаблонов из TEMPLATES_DIR.
+// Ожидается: шаблоны из файлов заменяют встроенные на всех языках, остальные шаблоны остаются встроенными.
+func TestLoadTmpls(t *testing.T) {
+	keepCurrentTmpls(t)
+	dir := t.TempDir()
+	writeTmplFiles(t, dir, map[string]string{
+		"signIn.html": `{{define "signIn"}}<html lang="{{lang}}">custom {{t "signIn.title"}}</html>{{end}}`,
+		"mail.txt":    `{{define "emailMsgWithServerAuthCodeText"}}code={{.Code}}{{end}}`,
+		"notes.md":    `{{define "signIn"}}ignored{{end}}`,
+	})
+	t.Setenv("TEMPLATES_DIR", dir)
+	t.Setenv("TEMPLATES_RELOAD", "")
+
+	require.NoError(t, LoadTmpls())
+	assert.Equal(t, dir, currentTmplSet().dir)
+	assert.False(t, currentTmplSet().reload)
+
+	assert.Equal(t, `<html lang="en">custom `+i18n.Text(i18n.En, "signIn.title")+`</html>`, renderSignIn(t, i18n.En))
+	assert.Equal(t, `<html lang="ru">custom `+i18n.Text(i18n.Ru, "signIn.title")+`</html>`, renderSignIn(t, i18n.Ru))
+
+	var text strings.Builder
+	require.NoError(t, LocalizedEmailTextTmpl(i18n.En).ExecuteTemplate(&text, "emailMsgWithServerAuthCodeText", struct{ Code string }{Code: "1234"}))
+	assert.Equal(t, "code=1234", text.String())
+
+	w := httptest.NewRecorder()
+	require.NoError(t, TmplsRenderer(w, BaseTmpl, "home", structs.MsgForUser{}))
+	assert.Contains(t, w.Body.String(), i18n.Text(i18n.En, "home.title"))
+}
+
+// TestLoadTmpls_Invalid проверяет отклонение неверных шаблонов.
+// Ожидается: ошибка с именем файла или шаблона, текущие шаблоны не меняются.
+func TestLoadTmpls_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "parse error",
+			files:   map[string]string{"signIn.html": `{{define "signIn"}}{{if}}{{end}}`},
+			wantErr: "signIn.html",
+		},
+		{
+			name:    "unknown field",
+			files:   map[string]string{"signIn.html": `{{define "signIn"}}{{.Unknown}}{{end}}`},
+			wantErr: "Unknown",
+		},
+		{
+			name:    "unknown function",
+			files:   map[string]string{"mail.txt": `{{define "emailMsgWithServerAuthCodeText"}}{{upper .Code}}{{end}}`},
+			wantErr: "upper",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keepCurrentTmpls(t)
+			before := currentTmpls.Load()
+			dir := t.TempDir()
+			writeTmplFiles(t, dir, tt.files)
+			t.Setenv("TEMPLATES_DIR", dir)
+
+			err := LoadTmpls()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+			assert.Same(t, before, currentTmpls.Load())
+		})
+	}
+
+	t.Setenv("TEMPLATES_DIR", filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, LoadTmpls())
+}
+
+// TestCheckTmplNames проверяет проверку обязательных шаблонов.
+// Ожидается: в ошибке перечислены все неопределенные шаблоны страниц и писем.
+func TestCheckTmplNames(t *testing.T) {
+	assert.NoError(t, checkTmplNames(BaseTmpl, EmailTextTmpl))
+
+	html := template.Must(template.New("base").Funcs(tmplFuncs).Funcs(localeFuncs(i18n.En)).Parse(signInTMPL))
+	err := checkTmplNames(html, EmailTextTmpl)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "signUp")
+	assert.Contains(t, err.Error(), "emailMsgWithServerAuthCode")
+	assert.NotContains(t, err.Error(), "signIn,")
+	assert.NotContains(t, err.Error(), "Text")
+}
+
+// TestCurrentTmplSet_Reload проверяет перезагрузку шаблонов при TEMPLATES_RELOAD.
+// Ожидается: измененный файл применяется без перезапуска, шаблон с ошибкой не заменяет рабочий.
+func TestCurrentTmplSet_Reload(t *testing.T) {
+	keepCurrentTmpls(t)
+	dir := t.TempDir()
+	writeTmplFiles(t, dir, map[string]string{"signIn.html": `{{define "signIn"}}first{{end}}`})
+	t.Setenv("TEMPLATES_DIR", dir)
+	t.Setenv("TEMPLATES_RELOAD", "true")
+
+	require.NoError(t, LoadTmpls())
+	assert.Equal(t, "first", renderSignIn(t, i18n.En))
+
+	writeTmplFiles(t, dir, map[string]string{"signIn.html": `{{define "signIn"}}second version{{end}}`})
+	assert.Equal(t, "second version", renderSignIn(t, i18n.En))
+	assert.True(t, currentTmplSet().reload)
+
+	writeTmplFiles(t, dir, map[string]string{"signIn.html": `{{define "signIn"}}{{.Unknown}}{{end}}`})
+	assert.Equal(t, "second version", renderSignIn(t, i18n.En))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "signIn.html")))
+	assert.Contains(t, renderSignIn(t, i18n.En), i18n.Text(i18n.En, "signIn.title"))
+}
+
+// TestExportTmpls проверяет выгрузку встроенных шаблонов.
+// Ожидается: выгруженный каталог проходит проверку, существующие файлы не заменяются.
+func TestExportTmpls(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "templates")
+	require.NoError(t, ExportTmpls(dir))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, len(htmlTmplSources)+1)
+	content, err := os.ReadFile(filepath.Join(dir, "signIn.html"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), `{{ define "signIn" }}`))
+
+	assert.NoError(t, CheckTmpls(dir))
+	assert.Error(t, ExportTmpls(dir))
+}
@@ -0,0 +1,207 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл содержит предпросмотр шаблонов:
+//   - AdminTemplates: список шаблонов страниц и писем со ссылками на предпросмотр
+//   - TemplatePreview: рендерит страницу или письмо с примером данных
+//   - previewData: примеры данных для каждого шаблона
+//
+// Примеры данных используются и при загрузке шаблонов (см. checkTmplExecute),
+// поэтому шаблон, который не выполняется с примером, не загружается.
+package tmpls
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+)
+
+// previewTime - время в примерах данных (2024-01-01 00:00:00 UTC).
+const previewTime = 1704067200
+
+// previewCSRFToken - CSRF токен в примерах данных: формы предпросмотра не отправляются.
+const previewCSRFToken = "preview"
+
+// AdminTemplates отображает список шаблонов страниц и писем со ссылками на предпросмотр
+// на каждом языке, а также каталог, из которого загружены шаблоны.
+// В случае ошибки логирует и перенаправляет на страницу 500.
+func AdminTemplates(w http.ResponseWriter, r *http.Request) {
+	set := currentTmplSet()
+	data := structs.AdminTemplatesPage{
+		Pages:  pageTmplNames,
+		Emails: emailTmplNames,
+		Dir:    set.dir,
+		Reload: set.reload,
+	}
+	if err := TmplsRenderer(w, BaseTmpl, "adminTemplates", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// TemplatePreview рендерит шаблон с примером данных.
+//
+// Принимает параметры URL query:
+//   - name: имя шаблона страницы или письма
+//   - locale: язык (по умолчанию язык запроса)
+//   - format: text - текстовая версия письма вместо HTML
+//
+// Для неизвестного шаблона отвечает 404. В случае ошибки логирует и перенаправляет на страницу 500.
+func TemplatePreview(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	isEmail := slices.Contains(emailTmplNames, name)
+	if !isEmail && !slices.Contains(pageTmplNames, name) {
+		http.NotFound(w, r)
+		return
+	}
+	locale, ok := i18n.Match(r.URL.Query().Get("locale"))
+	if !ok {
+		locale = i18n.Locale(r)
+	}
+
+	if r.URL.Query().Get("format") == "text" {
+		if !isEmail {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := LocalizedEmailTextTmpl(locale).ExecuteTemplate(w, name+"Text", previewData(name)); err != nil {
+			errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+			return
+		}
+		return
+	}
+
+	w.Header().Set("Content-Language", locale)
+	if err := TmplsRenderer(w, BaseTmpl, name, previewData(name)); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// previewData возвращает пример данных для шаблона name того же типа,
+// что передают обработчики и функции отправки писем.
+func previewData(name string) any {
+	user := structs.AdminUser{
+		PermanentId: "00000000-0000-0000-0000-000000000000",
+		Login:       "user123",
+		Email:       "user@example.com",
+		Status:      structs.AccountStatus{Status: "disabled", Reason: "spam", ExpiresAt: previewTime + 86400},
+	}
+	alert := structs.SecurityAlert{
+		Event:      "passwordChange",
+		OccurredAt: previewTime,
+		IP:         "203.0.113.10",
+		UserAgent:  "Mozilla/5.0",
+		RevokeLink: PublicURL("/security/revoke?token=token"),
+	}
+
+	switch name {
+	case "signUp":
+		return structs.MsgForUser{Msg: i18n.Text(i18n.En, "loginInvalid"), MsgKey: "loginInvalid", Regs: i18n.Requirements(i18n.En, "loginInvalid"), CSRFToken: previewCSRFToken, InviteRequired: true, SMSEnabled: true}
+	case "signIn":
+		return structs.MsgForUser{Msg: i18n.Text(i18n.En, "userNotExist"), MsgKey: "userNotExist", ShowForgotPassword: true, CSRFToken: previewCSRFToken}
+	case "serverAuthCodeSend":
+		return structs.MsgForUser{Msg: i18n.Text(i18n.En, "serverCodeHasBeenSend"), MsgKey: "serverCodeHasBeenSend", RetryAfter: 60, CSRFToken: previewCSRFToken}
+	case "home":
+		return structs.MsgForUser{CSRFToken: previewCSRFToken}
+	case "generatePasswordResetLink":
+		return structs.MsgForUser{Msg: i18n.Text(i18n.En, "successfulMailSendingStatus"), MsgKey: "successfulMailSendingStatus", CSRFToken: previewCSRFToken}
+	case "setNewPassword":
+		return struct {
+			Msg       string
+			Token     string
+			CSRFToken string
+		}{Msg: i18n.Text(i18n.En, "passwordsNotMatch"), Token: "token", CSRFToken: previewCSRFToken}
+	case "err403":
+		return structs.MsgForUser{Msg: i18n.Text(i18n.En, "csrfTokenInvalid"), MsgKey: "csrfTokenInvalid"}
+	case "profile":
+		return structs.Profile{Login: user.Login, Email: user.Email, PendingEmail: "new@example.com", Phone: "+79991234567", PendingPhone: "+79997654321", SMSEnabled: true, HasPassword: true, Msg: i18n.Text(i18n.En, "loginChanged"), CSRFToken: previewCSRFToken}
+	case "unsubscribe":
+		return struct{ Token string }{Token: "token"}
+	case "emailChangeUndo", "accountDeletionConfirm", "securityAlertRevoke":
+		return struct {
+			Token     string
+			CSRFToken string
+		}{Token: "token", CSRFToken: previewCSRFToken}
+	case "adminUsers":
+		return structs.AdminSearchPage{Query: "user", Users: []structs.AdminUser{user}, CanManageInvites: true, CSRFToken: previewCSRFToken}
+	case "adminUser":
+		return structs.AdminUserPage{
+			User:           user,
+			Roles:          []string{"admin"},
+			AllRoles:       []structs.Role{{Name: "admin", Description: "Administrator"}},
+			CanManageRoles: true,
+			DeleteAfter:    previewTime + 30*86400,
+			Account: structs.AccountExport{
+				PasswordCount:  1,
+				Sessions:       []structs.ExportedSession{{UserAgent: "Mozilla/5.0", CreatedAt: previewTime, LastActivityAt: previewTime + 3600}},
+				ProfileChanges: []structs.ExportedProfileChange{{Field: "login", OldValue: "user", NewValue: user.Login, ChangedAt: previewTime}},
+				CodeSends:      []structs.ExportedCodeSend{{Email: user.Email, SentAt: previewTime}},
+			},
+			Actions:   []structs.AdminAction{{AdminLogin: "admin", Action: "disable", Detail: "spam", CreatedAt: previewTime}},
+			CSRFToken: previewCSRFToken,
+		}
+	case "adminInvites":
+		return structs.AdminInvitesPage{
+			Invites: []structs.Invite{
+				{Code: "code1", Email: user.Email, CreatedAt: previewTime, ExpiresAt: previewTime + 7*86400},
+				{Code: "code2", CreatedAt: previewTime, UsedBy: user.PermanentId, UsedAt: previewTime + 3600},
+			},
+			CSRFToken: previewCSRFToken,
+		}
+	case "adminTemplates":
+		return structs.AdminTemplatesPage{Pages: pageTmplNames, Emails: emailTmplNames}
+	case "notificationSettings":
+		return structs.NotificationSettingsPage{
+			Settings: []structs.NotificationSetting{
+				{Name: "newDeviceLogin", Enabled: true},
+				{Name: "suspiciousLogin", Enabled: true, Critical: true},
+				{Name: "securityDigest"},
+			},
+			Msg:       i18n.Text(i18n.En, "notificationsSaved"),
+			CSRFToken: previewCSRFToken,
+		}
+	case "emailMsgWithServerAuthCode":
+		return struct{ Code string }{Code: "1234"}
+	case "emailMsgAboutSuspiciousLoginEmail":
+		return struct{ UserAgent string }{UserAgent: "Mozilla/5.0"}
+	case "emailMsgAboutNewDeviceLoginEmail":
+		return struct {
+			Login     string
+			UserAgent string
+		}{Login: user.Login, UserAgent: "Mozilla/5.0"}
+	case "emailMsgWithPasswordResetLink":
+		alert.Event = "passwordResetRequest"
+		return struct {
+			ResetLink string
+			Alert     structs.SecurityAlert
+		}{ResetLink: PublicURL("/set-new-password?token=token"), Alert: alert}
+	case "emailMsgAboutPasswordChange":
+		return struct{ Alert structs.SecurityAlert }{Alert: alert}
+	case "emailMsgAboutEmailChange":
+		alert.Event = "emailChange"
+		return struct {
+			NewEmail string
+			UndoLink string
+			Alert    structs.SecurityAlert
+		}{NewEmail: "new@example.com", UndoLink: PublicURL("/profile/email/undo?token=token"), Alert: alert}
+	case "emailMsgSecurityAlert":
+		alert.Event = "sessionRevoke"
+		alert.ByAdmin = true
+		return struct{ Alert structs.SecurityAlert }{Alert: alert}
+	case "emailMsgWithAccountDeletionLink":
+		return struct{ DeletionLink string }{DeletionLink: PublicURL("/profile/delete/confirm?token=token")}
+	case "emailMsgSecurityDigest":
+		return structs.SecurityDigest{
+			Since:          previewTime,
+			Sessions:       []structs.ExportedSession{{UserAgent: "Mozilla/5.0", CreatedAt: previewTime + 3600}},
+			ProfileChanges: []structs.ExportedProfileChange{{Field: "login", ChangedAt: previewTime + 7200}},
+			SettingsLink:   PublicURL(consts.ProfileNotificationsURL),
+		}
+	}
+	return nil
+}
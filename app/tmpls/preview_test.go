@@ -0,0 +1,102 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл тестирует предпросмотр шаблонов.
+package tmpls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPreviewData проверяет примеры данных.
+// Ожидается: пример есть для каждого шаблона страницы и письма.
+func TestPreviewData(t *testing.T) {
+	for _, name := range append(append([]string{}, pageTmplNames...), emailTmplNames...) {
+		assert.NotNil(t, previewData(name), name)
+	}
+	assert.Nil(t, previewData("unknown"))
+}
+
+// TestAdminTemplatesPage проверяет список шаблонов.
+// Ожидается: ссылки на предпросмотр каждой страницы и каждого письма, в том числе текстовой версии.
+func TestAdminTemplatesPage(t *testing.T) {
+	w := httptest.NewRecorder()
+	AdminTemplates(w, httptest.NewRequest(http.MethodGet, "/admin/templates", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, i18n.Text(i18n.En, "admin.templatesBuilt"))
+	for _, name := range pageTmplNames {
+		assert.Contains(t, body, "/admin/templates/preview?name="+name+"&locale=ru")
+	}
+	for _, name := range emailTmplNames {
+		assert.Contains(t, body, "/admin/templates/preview?name="+name+"&locale=en&format=text")
+	}
+}
+
+// TestTemplatePreview проверяет предпросмотр шаблонов.
+// Ожидается: страница и письмо рендерятся с примером данных на выбранном языке,
+// для неизвестного шаблона и текстовой версии страницы - 404.
+func TestTemplatePreview(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode int
+		expectedType string
+		expectedText string
+	}{
+		{
+			name:         "page",
+			query:        "name=signIn&locale=ru",
+			expectedCode: http.StatusOK,
+			expectedText: i18n.Text(i18n.Ru, "signIn.title"),
+		},
+		{
+			name:         "email html",
+			query:        "name=emailMsgWithServerAuthCode&locale=en",
+			expectedCode: http.StatusOK,
+			expectedText: "1234",
+		},
+		{
+			name:         "email text",
+			query:        "name=emailMsgWithServerAuthCode&locale=ru&format=text",
+			expectedCode: http.StatusOK,
+			expectedType: "text/plain; charset=utf-8",
+			expectedText: i18n.Text(i18n.Ru, "mail.authCode.yourCode") + " 1234",
+		},
+		{
+			name:         "security digest text",
+			query:        "name=emailMsgSecurityDigest&locale=ru&format=text",
+			expectedCode: http.StatusOK,
+			expectedType: "text/plain; charset=utf-8",
+			expectedText: i18n.Text(i18n.Ru, "mail.securityDigest.sessions") + "\n- 2024-01-01 01:00:00 UTC Mozilla/5.0",
+		},
+		{
+			name:         "unknown template",
+			query:        "name=base",
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			name:         "text version of page",
+			query:        "name=signIn&format=text",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			TemplatePreview(w, httptest.NewRequest(http.MethodGet, "/admin/templates/preview?"+tt.query, nil))
+
+			assert.Equal(t, tt.expectedCode, w.Code)
+			if tt.expectedType != "" {
+				assert.Equal(t, tt.expectedType, w.Header().Get("Content-Type"))
+			}
+			assert.Contains(t, w.Body.String(), tt.expectedText)
+		})
+	}
+}
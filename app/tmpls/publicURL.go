@@ -0,0 +1,29 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл содержит публичный адрес приложения:
+//   - PublicURL: формирует абсолютную ссылку на страницу приложения
+//
+// Абсолютные ссылки нужны в письмах и на страницах, которые пользователь открывает
+// вне текущего запроса: сброс пароля, отмена смены email, приглашения и т.п.
+package tmpls
+
+import (
+	"os"
+	"strings"
+)
+
+// defaultPublicBaseURL - публичный адрес приложения, если PUBLIC_BASE_URL не задан.
+const defaultPublicBaseURL = "http://localhost:8080"
+
+// PublicURL формирует абсолютную ссылку на страницу path приложения.
+//
+// Публичный адрес берется из переменной окружения PUBLIC_BASE_URL
+// (по умолчанию http://localhost:8080), завершающий "/" отбрасывается.
+// В шаблонах доступна как функция publicURL.
+func PublicURL(path string) string {
+	baseURL := os.Getenv("PUBLIC_BASE_URL")
+	if baseURL == "" {
+		baseURL = defaultPublicBaseURL
+	}
+	return strings.TrimRight(baseURL, "/") + path
+}
@@ -0,0 +1,20 @@
+// Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
+//
+// Файл тестирует формирование абсолютных ссылок.
+package tmpls
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPublicURL проверяет формирование абсолютной ссылки.
+// Ожидается: адрес по умолчанию без PUBLIC_BASE_URL, настроенный адрес без двойного "/".
+func TestPublicURL(t *testing.T) {
+	t.Setenv("PUBLIC_BASE_URL", "")
+	assert.Equal(t, "http://localhost:8080/sign-up", PublicURL("/sign-up"))
+
+	t.Setenv("PUBLIC_BASE_URL", "https://auth.example.com/")
+	assert.Equal(t, "https://auth.example.com/sign-up?invite=code", PublicURL("/sign-up?invite=code"))
+}
@@ -1,14 +1,21 @@
 // Package tmpls предоставляет функции и шаблоны для рендеринга HTML-страниц.
 //
 // Файл содержит обработчики для рендеринга страниц приложения:
-//   - SignUp: страница регистрации
 //   - SignIn: страница входа
 //   - ServerAuthCodeSend: страница отправки кода сервера
 //   - Home: главная страница
 //   - Logout: страница выхода
 //   - GeneratePasswordResetLink: страница генерации ссылки сброса пароля
 //   - SetNewPassword: страница установки нового пароля
+//   - EmailChangeUndo: страница подтверждения отмены смены email
+//   - AccountDeletionConfirm: страница подтверждения удаления аккаунта по ссылке из письма
+//   - SecurityAlertRevoke: страница подтверждения по ссылке "это был не я" из уведомления безопасности
+//   - Unsubscribe: страница подтверждения отписки по ссылке из уведомления
 //   - Err500: страница ошибки 500
+//   - Err403: страница ошибки 403 при неверном CSRF токене
+//   - Forbidden: страница ошибки 403 с сообщением
+//   - msgFromQuery: сообщение по ключу из параметра msg
+//   - CSRFToken: получает CSRF токен текущего запроса
 package tmpls
 
 import (
@@ -16,26 +23,19 @@ import (
 
 	"github.com/gimaevra94/auth/app/consts"
 	"github.com/gimaevra94/auth/app/errs"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 )
 
-// SignUp отображает страницу регистрации.
-//
-// Рендерит шаблон signUp с базовым шаблоном BaseTmpl.
-// В случае ошибки логирует и перенаправляет на страницу 500.
-var SignUp = func(w http.ResponseWriter, r *http.Request) {
-	if err := TmplsRenderer(w, BaseTmpl, "signUp", nil); err != nil {
-		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
-		return
-	}
-}
-
 // SignIn отображает страницу входа.
 //
+// Принимает параметр msg из URL query как ключ сообщения из каталога i18n
+// (например, при завершении сессии по бездействию); неизвестные ключи игнорируются.
 // Рендерит шаблон signIn с базовым шаблоном BaseTmpl.
 // В случае ошибки логирует и перенаправляет на страницу 500.
 func SignIn(w http.ResponseWriter, r *http.Request) {
-	if err := TmplsRenderer(w, BaseTmpl, "signIn", nil); err != nil {
+	data := msgFromQuery(r)
+	if err := TmplsRenderer(w, BaseTmpl, "signIn", data); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -43,10 +43,22 @@ func SignIn(w http.ResponseWriter, r *http.Request) {
 
 // ServerAuthCodeSend отображает страницу отправки кода сервера.
 //
+// Параметр channel=sms из URL query меняет текст страницы: код отправлен в SMS.
+// Параметр altChannel (sms или email) добавляет ссылку для получения кода другим способом
+// при подтверждении входа; доступность способа проверяет auth.ServerAuthCodeSend.
+// Параметр msg - ключ сообщения из каталога i18n (например, при подтверждении входа
+// с нового устройства); неизвестные ключи игнорируются.
 // Рендерит шаблон serverAuthCodeSend с базовым шаблоном BaseTmpl.
 // В случае ошибки логирует и перенаправляет на страницу 500.
 func ServerAuthCodeSend(w http.ResponseWriter, r *http.Request) {
-	if err := TmplsRenderer(w, BaseTmpl, "serverAuthCodeSend", nil); err != nil {
+	data := msgFromQuery(r)
+	if r.URL.Query().Get("channel") == consts.CodeChannelSMS {
+		data.CodeChannel = consts.CodeChannelSMS
+	}
+	if altChannel := r.URL.Query().Get("altChannel"); altChannel == consts.CodeChannelSMS || altChannel == consts.CodeChannelEmail {
+		data.AltCodeChannel = altChannel
+	}
+	if err := TmplsRenderer(w, BaseTmpl, "serverAuthCodeSend", data); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -57,7 +69,8 @@ func ServerAuthCodeSend(w http.ResponseWriter, r *http.Request) {
 // Рендерит шаблон home с базовым шаблоном BaseTmpl.
 // В случае ошибки логирует и перенаправляет на страницу 500.
 func Home(w http.ResponseWriter, r *http.Request) {
-	if err := TmplsRenderer(w, BaseTmpl, "home", nil); err != nil {
+	data := structs.MsgForUser{CSRFToken: CSRFToken(r)}
+	if err := TmplsRenderer(w, BaseTmpl, "home", data); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
@@ -76,12 +89,11 @@ func Logout(w http.ResponseWriter, r *http.Request) {
 
 // GeneratePasswordResetLink отображает страницу генерации ссылки сброса пароля.
 //
-// Принимает параметр msg из URL query и передает его в шаблон.
+// Принимает параметр msg из URL query как ключ сообщения из каталога i18n.
 // Рендерит шаблон generatePasswordResetLink с базовым шаблоном BaseTmpl.
 // В случае ошибки логирует и перенаправляет на страницу 500.
 func GeneratePasswordResetLink(w http.ResponseWriter, r *http.Request) {
-	msg := r.URL.Query().Get("msg")
-	data := structs.MsgForUser{Msg: msg}
+	data := msgFromQuery(r)
 	if err := TmplsRenderer(w, BaseTmpl, "generatePasswordResetLink", data); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
@@ -90,23 +102,131 @@ func GeneratePasswordResetLink(w http.ResponseWriter, r *http.Request) {
 
 // SetNewPassword отображает страницу установки нового пароля.
 //
-// Принимает параметры msg и token из URL query и передает их в шаблон.
+// Принимает параметры msg (ключ сообщения из каталога i18n) и token из URL query
+// и передает их в шаблон вместе с CSRF токеном.
 // Рендерит шаблон setNewPassword с базовым шаблоном BaseTmpl.
 // В случае ошибки логирует и перенаправляет на страницу 500.
 func SetNewPassword(w http.ResponseWriter, r *http.Request) {
 	data := struct {
-		Msg   string
-		Token string
-	}{Msg: r.URL.Query().Get("msg"), Token: r.URL.Query().Get("token")}
+		Msg       string
+		Token     string
+		CSRFToken string
+	}{Msg: msgFromQuery(r).Msg, Token: r.URL.Query().Get("token"), CSRFToken: CSRFToken(r)}
 	if err := TmplsRenderer(w, BaseTmpl, "setNewPassword", data); err != nil {
 		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
 		return
 	}
 }
 
+// EmailChangeUndo отображает страницу подтверждения отмены смены email.
+//
+// Принимает параметр token из URL query и передает его в форму вместе с CSRF токеном.
+// Сама отмена выполняется POST запросом, чтобы переход по ссылке из письма
+// (в том числе предварительная загрузка почтовым клиентом) ничего не менял.
+// В случае ошибки логирует и перенаправляет на страницу 500.
+func EmailChangeUndo(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Token     string
+		CSRFToken string
+	}{Token: r.URL.Query().Get("token"), CSRFToken: CSRFToken(r)}
+	if err := TmplsRenderer(w, BaseTmpl, "emailChangeUndo", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// AccountDeletionConfirm отображает страницу подтверждения удаления аккаунта.
+//
+// Как и EmailChangeUndo, передает token из URL query в POST форму,
+// чтобы удаление не запускалось предварительной загрузкой ссылки.
+// В случае ошибки логирует и перенаправляет на страницу 500.
+func AccountDeletionConfirm(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Token     string
+		CSRFToken string
+	}{Token: r.URL.Query().Get("token"), CSRFToken: CSRFToken(r)}
+	if err := TmplsRenderer(w, BaseTmpl, "accountDeletionConfirm", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// SecurityAlertRevoke отображает страницу подтверждения по ссылке "это был не я".
+//
+// Как и EmailChangeUndo, передает token из URL query в POST форму:
+// сессии завершаются только после подтверждения пользователем.
+// В случае ошибки логирует и перенаправляет на страницу 500.
+func SecurityAlertRevoke(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Token     string
+		CSRFToken string
+	}{Token: r.URL.Query().Get("token"), CSRFToken: CSRFToken(r)}
+	if err := TmplsRenderer(w, BaseTmpl, "securityAlertRevoke", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// Unsubscribe отображает страницу подтверждения отписки от уведомления.
+//
+// Передает token из URL query в POST форму: переход по ссылке (в том числе
+// проверка ссылок почтовым сервисом) уведомление не отключает.
+// CSRF токен не нужен - запрос подтверждается подписанным токеном ссылки.
+// В случае ошибки логирует и перенаправляет на страницу 500.
+func Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Token string
+	}{Token: r.URL.Query().Get("token")}
+	if err := TmplsRenderer(w, BaseTmpl, "unsubscribe", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
 // Err500 отображает страницу ошибки 500.
 //
 // Отправляет статический файл 500.html клиенту.
 func Err500(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "../public/500.html")
 }
+
+// Err403 отображает страницу ошибки 403.
+//
+// Используется при отсутствии или несовпадении CSRF токена.
+func Err403(w http.ResponseWriter, r *http.Request) {
+	Forbidden(w, r, "csrfTokenInvalid")
+}
+
+// Forbidden отображает страницу ошибки 403 с сообщением по ключу msgKey из каталога i18n.
+//
+// Используется, например, при попытке открыть раздел администратора без прав.
+// Устанавливает статус 403 и рендерит шаблон err403 с базовым шаблоном BaseTmpl.
+func Forbidden(w http.ResponseWriter, r *http.Request, msgKey string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusForbidden)
+	data := structs.MsgForUser{Msg: i18n.Msg(r, msgKey), MsgKey: msgKey}
+	if err := TmplsRenderer(w, BaseTmpl, "err403", data); err != nil {
+		errs.LogAndRedirectIfErrNotNill(w, r, err, consts.Err500URL)
+		return
+	}
+}
+
+// msgFromQuery возвращает данные шаблона с CSRF токеном и сообщением по ключу
+// из параметра msg URL query на языке запроса; неизвестные ключи игнорируются.
+func msgFromQuery(r *http.Request) structs.MsgForUser {
+	data := structs.MsgForUser{CSRFToken: CSRFToken(r)}
+	if msgKey := r.URL.Query().Get("msg"); i18n.Has(msgKey) {
+		data.Msg = i18n.Msg(r, msgKey)
+		data.MsgKey = msgKey
+	}
+	return data
+}
+
+// CSRFToken возвращает CSRF токен текущего запроса.
+//
+// Токен кладется в контекст запроса middleware auth.CSRFProtector.
+// Если middleware не применялся, возвращает пустую строку.
+func CSRFToken(r *http.Request) string {
+	token, _ := r.Context().Value(consts.CSRFTokenCtxKey).(string)
+	return token
+}
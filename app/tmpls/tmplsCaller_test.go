@@ -4,6 +4,7 @@
 package tmpls
 
 import (
+	"context"
 	"html/template"
 	"net/http"
 	"net/http/httptest"
@@ -12,74 +13,13 @@ import (
 	"testing"
 
 	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/i18n"
 	"github.com/gimaevra94/auth/app/structs"
 )
 
 // MockTmplsRenderer имитирует функцию рендеринга шаблонов для тестирования.
 type MockTmplsRenderer func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error
 
-// TestSignUp проверяет рендеринг страницы регистрации.
-// Ожидается: HTTP 200 при успехе, HTTP 302 при ошибке рендеринга.
-func TestSignUp(t *testing.T) {
-	tests := []struct {
-		name           string
-		rendererError  error
-		expectedStatus int
-		expectedBody   string
-	}{
-		{
-			name:           "successful render",
-			rendererError:  nil,
-			expectedStatus: http.StatusOK,
-			expectedBody:   "signUp template rendered",
-		},
-		{
-			name:           "renderer error triggers redirect",
-			rendererError:  http.ErrBodyNotAllowed,
-			expectedStatus: http.StatusFound,
-			expectedBody:   "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			originalRenderer := TmplsRenderer
-			defer func() { TmplsRenderer = originalRenderer }()
-
-			TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
-				if tt.rendererError != nil {
-					return tt.rendererError
-				}
-				w.WriteHeader(http.StatusOK)
-				w.Write([]byte("signUp template rendered"))
-				return nil
-			}
-
-			req := httptest.NewRequest("GET", "/sign-up", nil)
-			w := httptest.NewRecorder()
-
-			SignUp(w, req)
-
-			resp := w.Result()
-			if resp.StatusCode != tt.expectedStatus {
-				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
-			}
-
-			body := w.Body.String()
-			if tt.expectedBody != "" && !strings.Contains(body, tt.expectedBody) {
-				t.Errorf("expected body to contain %q, got %q", tt.expectedBody, body)
-			}
-
-			if tt.rendererError != nil {
-				location := resp.Header.Get("Location")
-				if location != consts.Err500URL {
-					t.Errorf("expected redirect to %s, got %s", consts.Err500URL, location)
-				}
-			}
-		})
-	}
-}
-
 // TestSignIn проверяет рендеринг страницы входа.
 // Ожидается: HTTP 200 при успехе, HTTP 302 при ошибке рендеринга.
 func TestSignIn(t *testing.T) {
@@ -204,6 +144,55 @@ func TestServerAuthCodeSend(t *testing.T) {
 	}
 }
 
+// TestServerAuthCodeSend_SMS проверяет текст страницы ввода кода, отправленного в SMS.
+// Ожидается: с параметром channel=sms - текст об SMS, без него - о письме;
+// с параметром altChannel - ссылка для получения кода другим способом.
+func TestServerAuthCodeSend_SMS(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send?channel=sms", nil))
+	if !strings.Contains(w.Body.String(), template.HTMLEscapeString(i18n.Text(i18n.En, "code.sentSMS"))) {
+		t.Errorf("expected SMS text, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send", nil))
+	if !strings.Contains(w.Body.String(), template.HTMLEscapeString(i18n.Text(i18n.En, "code.sent"))) {
+		t.Errorf("expected email text, got %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "channel=") {
+		t.Errorf("unexpected alternative channel link, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send?altChannel=sms", nil))
+	if !strings.Contains(w.Body.String(), "/server-auth-code-send-again?channel=sms") ||
+		!strings.Contains(w.Body.String(), template.HTMLEscapeString(i18n.Text(i18n.En, "code.sendSMSInstead"))) {
+		t.Errorf("expected SMS link, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send?altChannel=fax", nil))
+	if strings.Contains(w.Body.String(), "channel=fax") {
+		t.Errorf("unknown channel should be ignored, got %q", w.Body.String())
+	}
+}
+
+// TestServerAuthCodeSend_Msg проверяет сообщение из параметра msg на странице ввода кода.
+// Ожидается: сообщение о входе с нового устройства, неизвестный ключ игнорируется.
+func TestServerAuthCodeSend_Msg(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send?msg=signInCodeSent", nil))
+	if !strings.Contains(w.Body.String(), template.HTMLEscapeString(i18n.Text(i18n.En, "signInCodeSent"))) {
+		t.Errorf("expected sign-in message, got %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ServerAuthCodeSend(w, httptest.NewRequest("GET", "/server-auth-code-send?msg=unknownKey", nil))
+	if strings.Contains(w.Body.String(), "unknownKey") {
+		t.Errorf("unknown message key should be ignored, got %q", w.Body.String())
+	}
+}
+
 // TestHome проверяет рендеринг домашней страницы.
 // Ожидается: HTTP 200 при успехе, HTTP 302 при ошибке рендеринга.
 func TestHome(t *testing.T) {
@@ -347,24 +336,24 @@ func TestGeneratePasswordResetLink(t *testing.T) {
 		},
 		{
 			name:           "with message parameter",
-			queryParams:    "msg=test+message",
+			queryParams:    "msg=successfulMailSendingStatus",
 			rendererError:  nil,
 			expectedStatus: http.StatusOK,
-			expectedData:   structs.MsgForUser{Msg: "test message"},
+			expectedData:   structs.MsgForUser{Msg: i18n.Text(i18n.En, "successfulMailSendingStatus")},
 		},
 		{
 			name:           "renderer error triggers redirect",
-			queryParams:    "msg=error+test",
+			queryParams:    "msg=userNotExist",
 			rendererError:  http.ErrBodyNotAllowed,
 			expectedStatus: http.StatusFound,
-			expectedData:   structs.MsgForUser{Msg: "error test"},
+			expectedData:   structs.MsgForUser{Msg: i18n.Text(i18n.En, "userNotExist")},
 		},
 		{
-			name:           "URL encoded message",
+			name:           "message outside the catalog is ignored",
 			queryParams:    "msg=" + url.QueryEscape("special chars & symbols"),
 			rendererError:  nil,
 			expectedStatus: http.StatusOK,
-			expectedData:   structs.MsgForUser{Msg: "special chars & symbols"},
+			expectedData:   structs.MsgForUser{Msg: ""},
 		},
 	}
 
@@ -434,10 +423,10 @@ func TestSetNewPassword(t *testing.T) {
 		},
 		{
 			name:           "with message only",
-			queryParams:    "msg=test+message",
+			queryParams:    "msg=passwordsNotMatch",
 			rendererError:  nil,
 			expectedStatus: http.StatusOK,
-			expectedMsg:    "test message",
+			expectedMsg:    i18n.Text(i18n.En, "passwordsNotMatch"),
 			expectedToken:  "",
 		},
 		{
@@ -450,18 +439,18 @@ func TestSetNewPassword(t *testing.T) {
 		},
 		{
 			name:           "with both parameters",
-			queryParams:    "msg=reset+required&token=xyz789",
+			queryParams:    "msg=passwordInvalid&token=xyz789",
 			rendererError:  nil,
 			expectedStatus: http.StatusOK,
-			expectedMsg:    "reset required",
+			expectedMsg:    i18n.Text(i18n.En, "passwordInvalid"),
 			expectedToken:  "xyz789",
 		},
 		{
 			name:           "renderer error triggers redirect",
-			queryParams:    "msg=error&token=error123",
+			queryParams:    "msg=passwordsNotMatch&token=error123",
 			rendererError:  http.ErrBodyNotAllowed,
 			expectedStatus: http.StatusFound,
-			expectedMsg:    "error",
+			expectedMsg:    i18n.Text(i18n.En, "passwordsNotMatch"),
 			expectedToken:  "error123",
 		},
 		{
@@ -469,7 +458,7 @@ func TestSetNewPassword(t *testing.T) {
 			queryParams:    "msg=" + url.QueryEscape("special & chars") + "&token=" + url.QueryEscape("token-with-special-chars-!@#"),
 			rendererError:  nil,
 			expectedStatus: http.StatusOK,
-			expectedMsg:    "special & chars",
+			expectedMsg:    "",
 			expectedToken:  "token-with-special-chars-!@#",
 		},
 	}
@@ -480,16 +469,18 @@ func TestSetNewPassword(t *testing.T) {
 			defer func() { TmplsRenderer = originalRenderer }()
 
 			var capturedData struct {
-				Msg   string
-				Token string
+				Msg       string
+				Token     string
+				CSRFToken string
 			}
 			TmplsRenderer = func(w http.ResponseWriter, tmpl *template.Template, templateName string, data interface{}) error {
 				if tt.rendererError != nil {
 					return tt.rendererError
 				}
 				capturedData = data.(struct {
-					Msg   string
-					Token string
+					Msg       string
+					Token     string
+					CSRFToken string
 				})
 				w.WriteHeader(http.StatusOK)
 				w.Write([]byte("setNewPassword template rendered"))
@@ -556,6 +547,142 @@ func TestErr500(t *testing.T) {
 	}
 }
 
+// TestErr403 проверяет рендеринг страницы ошибки 403.
+// Ожидается: HTTP 403 и сообщение о неверном CSRF токене.
+func TestErr403(t *testing.T) {
+	req := httptest.NewRequest("POST", "/set-new-password", nil)
+	w := httptest.NewRecorder()
+
+	Err403(w, req)
+
+	resp := w.Result()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+	if !strings.Contains(w.Body.String(), i18n.Text(i18n.En, "csrfTokenInvalid")) {
+		t.Errorf("expected body to contain csrfTokenInvalid message, got %q", w.Body.String())
+	}
+}
+
+// TestForbidden проверяет рендеринг страницы 403 с сообщением по ключу.
+// Ожидается: HTTP 403 и сообщение о правах администратора.
+func TestForbidden(t *testing.T) {
+	req := httptest.NewRequest("GET", "/admin", nil)
+	w := httptest.NewRecorder()
+
+	Forbidden(w, req, "permissionRequired")
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("expected status %d, got %d", http.StatusForbidden, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), i18n.Text(i18n.En, "permissionRequired")) {
+		t.Errorf("expected body to contain permissionRequired message, got %q", w.Body.String())
+	}
+}
+
+// TestCSRFToken проверяет получение CSRF токена из контекста запроса и его вывод в форму.
+// Ожидается: токен из контекста или пустая строка, скрытое поле csrfToken на странице входа.
+func TestCSRFToken(t *testing.T) {
+	req := httptest.NewRequest("GET", "/sign-up", nil)
+	if token := CSRFToken(req); token != "" {
+		t.Errorf("expected empty token, got %q", token)
+	}
+
+	req = req.WithContext(context.WithValue(req.Context(), consts.CSRFTokenCtxKey, "csrf123"))
+	if token := CSRFToken(req); token != "csrf123" {
+		t.Errorf("expected token %q, got %q", "csrf123", token)
+	}
+
+	w := httptest.NewRecorder()
+	SignIn(w, req)
+	if !strings.Contains(w.Body.String(), `name="csrfToken" value="csrf123"`) {
+		t.Errorf("expected signIn form to contain csrf token field, got %q", w.Body.String())
+	}
+}
+
+// TestEmailChangeUndo проверяет страницу подтверждения отмены смены email.
+// Ожидается: токен из query и CSRF токен в POST форме.
+func TestEmailChangeUndo(t *testing.T) {
+	req := httptest.NewRequest("GET", "/profile/email/undo?token=undo123", nil)
+	req = req.WithContext(context.WithValue(req.Context(), consts.CSRFTokenCtxKey, "csrf123"))
+	w := httptest.NewRecorder()
+
+	EmailChangeUndo(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `method="POST" action="/profile/email/undo"`) {
+		t.Errorf("expected POST form, got %q", body)
+	}
+	if !strings.Contains(body, `name="token" value="undo123"`) || !strings.Contains(body, `name="csrfToken" value="csrf123"`) {
+		t.Errorf("expected token and csrf token fields, got %q", body)
+	}
+}
+
+// TestAccountDeletionConfirm проверяет страницу подтверждения удаления аккаунта.
+// Ожидается: токен из query и CSRF токен в POST форме.
+func TestAccountDeletionConfirm(t *testing.T) {
+	req := httptest.NewRequest("GET", "/profile/delete/confirm?token=delete123", nil)
+	req = req.WithContext(context.WithValue(req.Context(), consts.CSRFTokenCtxKey, "csrf123"))
+	w := httptest.NewRecorder()
+
+	AccountDeletionConfirm(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `method="POST" action="/profile/delete/confirm"`) {
+		t.Errorf("expected POST form, got %q", body)
+	}
+	if !strings.Contains(body, `name="token" value="delete123"`) || !strings.Contains(body, `name="csrfToken" value="csrf123"`) {
+		t.Errorf("expected token and csrf token fields, got %q", body)
+	}
+}
+
+// TestSecurityAlertRevoke проверяет страницу подтверждения по ссылке "это был не я".
+// Ожидается: токен из query и CSRF токен в POST форме.
+func TestSecurityAlertRevoke(t *testing.T) {
+	req := httptest.NewRequest("GET", "/security/revoke?token=alert123", nil)
+	req = req.WithContext(context.WithValue(req.Context(), consts.CSRFTokenCtxKey, "csrf123"))
+	w := httptest.NewRecorder()
+
+	SecurityAlertRevoke(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `method="POST" action="/security/revoke"`) {
+		t.Errorf("expected POST form, got %q", body)
+	}
+	if !strings.Contains(body, `name="token" value="alert123"`) || !strings.Contains(body, `name="csrfToken" value="csrf123"`) {
+		t.Errorf("expected token and csrf token fields, got %q", body)
+	}
+}
+
+// TestUnsubscribe проверяет страницу подтверждения отписки от уведомления.
+// Ожидается: токен из query в POST форме без CSRF токена.
+func TestUnsubscribe(t *testing.T) {
+	req := httptest.NewRequest("GET", "/unsubscribe?token=unsub123", nil)
+	w := httptest.NewRecorder()
+
+	Unsubscribe(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `method="POST" action="/unsubscribe"`) {
+		t.Errorf("expected POST form, got %q", body)
+	}
+	if !strings.Contains(body, `name="token" value="unsub123"`) {
+		t.Errorf("expected token field, got %q", body)
+	}
+}
+
 // TestConcurrentRequests проверяет обработку одновременных запросов.
 // Ожидается: корректная обработка всех запросов без гонок данных.
 func TestConcurrentRequests(t *testing.T) {
@@ -571,7 +698,6 @@ func TestConcurrentRequests(t *testing.T) {
 	}
 
 	functions := []func(w http.ResponseWriter, r *http.Request){
-		SignUp,
 		SignIn,
 		ServerAuthCodeSend,
 		Home,
@@ -612,7 +738,7 @@ func TestErrorHandlingBehavior(t *testing.T) {
 	req := httptest.NewRequest("GET", "/test", nil)
 	w := httptest.NewRecorder()
 
-	SignUp(w, req)
+	SignIn(w, req)
 
 	resp := w.Result()
 	if resp.StatusCode != http.StatusFound {
@@ -638,7 +764,6 @@ func TestDifferentHTTPMethods(t *testing.T) {
 	}
 
 	functions := map[string]func(w http.ResponseWriter, r *http.Request){
-		"SignUp":                    SignUp,
 		"SignIn":                    SignIn,
 		"ServerAuthCodeSend":        ServerAuthCodeSend,
 		"Home":                      Home,
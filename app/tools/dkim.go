@@ -0,0 +1,300 @@
+// Package tools предоставляет функции для валидации данных, геренации токенов и отправки email-уведомлений.
+//
+// Файл содержит DKIM-подпись исходящих писем (RFC 6376):
+//   - newDKIMSigner: загружает домен, селектор и закрытый ключ из окружения
+//   - loadDKIMPrivateKey: читает закрытый ключ из файла и кеширует его
+//   - dkimSigner.sign: добавляет в письмо заголовок DKIM-Signature
+//   - dkimMailer: подписывает письма перед доставкой
+//
+// Поддерживаются алгоритмы rsa-sha256 и ed25519-sha256 (RFC 8463), заголовки и тело
+// приводятся к каноническому виду relaxed/relaxed.
+package tools
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Алгоритмы DKIM-подписи (значение тега a=).
+const (
+	dkimAlgRSA     = "rsa-sha256"
+	dkimAlgEd25519 = "ed25519-sha256"
+)
+
+// dkimMinRSABits - наименьший допустимый размер ключа RSA (RFC 8301).
+const dkimMinRSABits = 1024
+
+// dkimSignedHeaders - заголовки, которые покрывает подпись, если они есть в письме.
+var dkimSignedHeaders = []string{
+	"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+var (
+	dkimKeyCacheMu       sync.Mutex
+	cachedDKIMKeyPath    string
+	cachedDKIMKeyModTime time.Time
+	cachedDKIMKey        crypto.Signer
+)
+
+// dkimSigner подписывает письма ключом key от имени домена domain.
+type dkimSigner struct {
+	domain   string
+	selector string
+	key      crypto.Signer
+}
+
+// newDKIMSigner загружает параметры DKIM-подписи.
+//
+// Использует переменные окружения:
+//   - DKIM_SELECTOR: селектор, под которым открытый ключ опубликован в DNS
+//   - DKIM_PRIVATE_KEY_FILE: PEM-файл закрытого ключа RSA (PKCS#1/PKCS#8) или Ed25519 (PKCS#8)
+//   - DKIM_DOMAIN: домен подписи (по умолчанию домен SERVER_EMAIL)
+//
+// Возвращает false, если селектор и ключ не заданы и письма подписывать не нужно.
+func newDKIMSigner() (dkimSigner, bool, error) {
+	selector, keyFile := os.Getenv("DKIM_SELECTOR"), os.Getenv("DKIM_PRIVATE_KEY_FILE")
+	if selector == "" && keyFile == "" {
+		return dkimSigner{}, false, nil
+	}
+	if selector == "" || keyFile == "" {
+		return dkimSigner{}, false, errors.New("DKIM_SELECTOR and DKIM_PRIVATE_KEY_FILE must be set together")
+	}
+
+	domain := os.Getenv("DKIM_DOMAIN")
+	if domain == "" {
+		serverEmail := os.Getenv("SERVER_EMAIL")
+		domain = serverEmail[strings.LastIndex(serverEmail, "@")+1:]
+	}
+	if domain == "" {
+		return dkimSigner{}, false, errors.New("DKIM_DOMAIN is not set")
+	}
+
+	key, err := loadDKIMPrivateKey(keyFile)
+	if err != nil {
+		return dkimSigner{}, false, errors.WithStack(err)
+	}
+	return dkimSigner{domain: domain, selector: selector, key: key}, true, nil
+}
+
+// loadDKIMPrivateKey загружает закрытый ключ DKIM из файла path.
+//
+// newMailer вызывается для каждой отправки, поэтому ключ разбирается один раз
+// и файл перечитывается только при изменении пути или времени модификации
+// (например, при замене ключа), как связка ключей в keyring.LoadFile.
+func loadDKIMPrivateKey(path string) (crypto.Signer, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dkimKeyCacheMu.Lock()
+	defer dkimKeyCacheMu.Unlock()
+
+	if path == cachedDKIMKeyPath && info.ModTime().Equal(cachedDKIMKeyModTime) {
+		return cachedDKIMKey, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	key, err := parseDKIMPrivateKey(content)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cachedDKIMKeyPath, cachedDKIMKeyModTime, cachedDKIMKey = path, info.ModTime(), key
+	return key, nil
+}
+
+// parseDKIMPrivateKey разбирает закрытый ключ RSA или Ed25519 в формате PEM.
+func parseDKIMPrivateKey(content []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("DKIM private key is not PEM encoded")
+	}
+
+	var parsed any
+	var err error
+	if block.Type == "RSA PRIVATE KEY" {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	switch key := parsed.(type) {
+	case *rsa.PrivateKey:
+		if key.N.BitLen() < dkimMinRSABits {
+			return nil, errors.Errorf("DKIM RSA key must be at least %d bits", dkimMinRSABits)
+		}
+		return key, nil
+	case ed25519.PrivateKey:
+		return key, nil
+	}
+	return nil, errors.New("DKIM private key is neither RSA nor Ed25519")
+}
+
+// algorithm возвращает значение тега a= для ключа подписи.
+func (s dkimSigner) algorithm() string {
+	if _, ok := s.key.(ed25519.PrivateKey); ok {
+		return dkimAlgEd25519
+	}
+	return dkimAlgRSA
+}
+
+// sign возвращает письмо msg с заголовком DKIM-Signature в начале.
+//
+// Подпись покрывает тело и те заголовки из dkimSignedHeaders, которые есть в письме.
+func (s dkimSigner) sign(msg []byte, now time.Time) ([]byte, error) {
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("mail message has no body separator")
+	}
+	headers := splitMailHeaders(string(msg[:headerEnd+2]))
+	bodyHash := sha256.Sum256(dkimRelaxedBody(msg[headerEnd+4:]))
+
+	var signed []string
+	var hashed strings.Builder
+	for _, name := range dkimSignedHeaders {
+		if header, ok := lastMailHeader(headers, name); ok {
+			signed = append(signed, strings.ToLower(name))
+			hashed.WriteString(dkimRelaxedHeader(header))
+		}
+	}
+
+	// Теги размещаются на отдельных строках: при каноническом виде relaxed переносы
+	// строк не влияют на подпись.
+	signature := "DKIM-Signature: v=1; a=" + s.algorithm() + "; c=relaxed/relaxed;\r\n" +
+		" d=" + s.domain + "; s=" + s.selector + "; t=" + strconv.FormatInt(now.Unix(), 10) + ";\r\n" +
+		" h=" + strings.Join(signed, ":") + ";\r\n" +
+		" bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]) + ";\r\n" +
+		" b="
+	hashed.WriteString(strings.TrimSuffix(dkimRelaxedHeader(signature+"\r\n"), "\r\n"))
+	digest := sha256.Sum256([]byte(hashed.String()))
+
+	// Ed25519 подписывает сам хеш (RFC 8463), RSA - хеш в формате PKCS#1 v1.5.
+	var opts crypto.SignerOpts = crypto.SHA256
+	if s.algorithm() == dkimAlgEd25519 {
+		opts = crypto.Hash(0)
+	}
+	b, err := s.key.Sign(rand.Reader, digest[:], opts)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(b)
+	var result bytes.Buffer
+	result.WriteString(signature)
+	for len(encoded) > 72 {
+		result.WriteString(encoded[:72] + "\r\n ")
+		encoded = encoded[72:]
+	}
+	result.WriteString(encoded + "\r\n")
+	result.Write(msg)
+	return result.Bytes(), nil
+}
+
+// splitMailHeaders разбивает блок заголовков на заголовки вместе с их продолжениями.
+func splitMailHeaders(block string) []string {
+	var headers []string
+	for _, line := range strings.SplitAfter(block, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(headers) > 0 {
+			headers[len(headers)-1] += line
+			continue
+		}
+		headers = append(headers, line)
+	}
+	return headers
+}
+
+// lastMailHeader возвращает последний заголовок с именем name (RFC 6376, раздел 5.4.2).
+func lastMailHeader(headers []string, name string) (string, bool) {
+	for i := len(headers) - 1; i >= 0; i-- {
+		headerName, _, ok := strings.Cut(headers[i], ":")
+		if ok && strings.EqualFold(strings.TrimRight(headerName, " \t"), name) {
+			return headers[i], true
+		}
+	}
+	return "", false
+}
+
+// dkimRelaxedHeader приводит заголовок к каноническому виду relaxed (RFC 6376, раздел 3.4.2).
+func dkimRelaxedHeader(header string) string {
+	name, value, _ := strings.Cut(header, ":")
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.Join(strings.Fields(value), " ") + "\r\n"
+}
+
+// dkimRelaxedBody приводит тело письма к каноническому виду relaxed (RFC 6376, раздел 3.4.4).
+func dkimRelaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(compactWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compactWhitespace заменяет последовательности пробелов и табуляций одним пробелом.
+func compactWhitespace(line string) string {
+	var result strings.Builder
+	space := false
+	for _, r := range line {
+		if r == ' ' || r == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			result.WriteByte(' ')
+			space = false
+		}
+		result.WriteRune(r)
+	}
+	if space {
+		result.WriteByte(' ')
+	}
+	return result.String()
+}
+
+// dkimMailer подписывает письма и передает их способу доставки mailer.
+type dkimMailer struct {
+	mailer Mailer
+	signer dkimSigner
+}
+
+// Send подписывает письмо и доставляет его.
+func (m dkimMailer) Send(from string, to []string, msg []byte) error {
+	signed, err := m.signer.sign(msg, time.Now())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := m.mailer.Send(from, to, signed); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package tools
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dkimSignatureValue находит значение тега b= в заголовке DKIM-Signature.
+var dkimSignatureValue = regexp.MustCompile(`(^|;)(\s*b=)[^;]*`)
+
+// verifyDKIM проверяет первую подпись DKIM-Signature письма открытым ключом publicKey
+// так же, как это делает получатель после запроса ключа из DNS.
+//
+// Имя, повторенное в теге h=, выбирает следующий снизу экземпляр заголовка, а если
+// экземпляров больше нет - пустую строку (RFC 6376, раздел 5.4.2).
+func verifyDKIM(msg []byte, publicKey crypto.PublicKey) (map[string]string, error) {
+	raw := string(msg)
+	headerEnd := strings.Index(raw, "\r\n\r\n")
+	if headerEnd < 0 {
+		return nil, errors.New("no body separator")
+	}
+	headers := splitMailHeaders(raw[:headerEnd+2])
+	if len(headers) == 0 || !strings.HasPrefix(headers[0], "DKIM-Signature:") {
+		return nil, errors.New("no DKIM-Signature header")
+	}
+
+	tags := map[string]string{}
+	_, value, _ := strings.Cut(headers[0], ":")
+	for _, tag := range strings.Split(value, ";") {
+		name, tagValue, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(name)] = strings.Join(strings.Fields(tagValue), "")
+	}
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody([]byte(raw[headerEnd+4:])))
+	if base64.StdEncoding.EncodeToString(bodyHash[:]) != tags["bh"] {
+		return tags, errors.New("body hash mismatch")
+	}
+
+	var hashed strings.Builder
+	// below - индекс последнего выбранного экземпляра заголовка с этим именем;
+	// следующий экземпляр ищется выше него.
+	below := map[string]int{}
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.ToLower(name)
+		from, ok := below[name]
+		if !ok {
+			from = len(headers)
+		}
+		below[name] = 0
+		for i := from - 1; i > 0; i-- {
+			if header, ok := lastMailHeader(headers[i:i+1], name); ok {
+				hashed.WriteString(dkimRelaxedHeader(header))
+				below[name] = i
+				break
+			}
+		}
+	}
+	unsigned := dkimSignatureValue.ReplaceAllString(headers[0], "$1$2")
+	hashed.WriteString(strings.TrimSuffix(dkimRelaxedHeader(unsigned), "\r\n"))
+	digest := sha256.Sum256([]byte(hashed.String()))
+
+	signature, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return tags, errors.WithStack(err)
+	}
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return tags, rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, digest[:], signature) {
+			return tags, errors.New("ed25519 signature mismatch")
+		}
+		return tags, nil
+	}
+	return tags, errors.New("unsupported public key")
+}
+
+// writePEM сохраняет ключ в PEM-файл во временном каталоге теста.
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dkim.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+	return path
+}
+
+// TestDKIMRelaxedCanonicalization проверяет канонический вид relaxed на примере из RFC 6376, раздел 3.4.5.
+// Ожидается: имена заголовков в нижнем регистре, пробелы свернуты, пустые строки в конце тела удалены.
+func TestDKIMRelaxedCanonicalization(t *testing.T) {
+	headers := splitMailHeaders("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+	require.Len(t, headers, 2)
+	assert.Equal(t, "a:X\r\n", dkimRelaxedHeader(headers[0]))
+	assert.Equal(t, "b:Y Z\r\n", dkimRelaxedHeader(headers[1]))
+
+	assert.Equal(t, " C\r\nD E\r\n", string(dkimRelaxedBody([]byte(" C \r\nD \t E\r\n\r\n\r\n"))))
+	assert.Empty(t, dkimRelaxedBody([]byte("\r\n\r\n")))
+	assert.Equal(t, "end\r\n", string(dkimRelaxedBody([]byte("end"))))
+}
+
+// rfc8463Message - пример письма из RFC 8463, приложение A.
+const rfc8463Message = "From: Joe SixPack <joe@football.example.com>\r\n" +
+	"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+	"Subject: Is dinner ready?\r\n" +
+	"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+	"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+	"\r\n" +
+	"Hi.\r\n" +
+	"\r\n" +
+	"We lost the game.  Are you hungry yet?\r\n" +
+	"\r\n" +
+	"Joe.\r\n"
+
+// TestDKIMRFC8463Vector проверяет канонический вид и подпись Ed25519 на примере из RFC 8463, приложение A.
+// Ожидается: хеш тела совпадает с bh= из RFC, подпись из RFC проходит проверку открытым ключом из RFC,
+// письмо, подписанное ключом из RFC, проходит ту же проверку.
+func TestDKIMRFC8463Vector(t *testing.T) {
+	seed, err := base64.StdEncoding.DecodeString("nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A=")
+	require.NoError(t, err)
+	publicKey, err := base64.StdEncoding.DecodeString("11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=")
+	require.NoError(t, err)
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	require.Equal(t, ed25519.PublicKey(publicKey), privateKey.Public())
+
+	bodyHash := sha256.Sum256(dkimRelaxedBody([]byte(rfc8463Message[strings.Index(rfc8463Message, "\r\n\r\n")+4:])))
+	assert.Equal(t, "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=", base64.StdEncoding.EncodeToString(bodyHash[:]))
+
+	signed := "DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;\r\n" +
+		" d=football.example.com; i=@football.example.com;\r\n" +
+		" q=dns/txt; s=brisbane; t=1528637909; h=from : to :\r\n" +
+		" subject : date : message-id : from : subject : date;\r\n" +
+		" bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;\r\n" +
+		" b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus\r\n" +
+		" Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==\r\n" +
+		rfc8463Message
+	_, err = verifyDKIM([]byte(signed), ed25519.PublicKey(publicKey))
+	require.NoError(t, err)
+
+	signer := dkimSigner{domain: "football.example.com", selector: "brisbane", key: privateKey}
+	ours, err := signer.sign([]byte(rfc8463Message), time.Unix(1528637909, 0))
+	require.NoError(t, err)
+	tags, err := verifyDKIM(ours, ed25519.PublicKey(publicKey))
+	require.NoError(t, err)
+	assert.Equal(t, "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=", tags["bh"])
+	assert.Equal(t, "from:to:subject:date:message-id", tags["h"])
+}
+
+// TestDKIMSignerSign проверяет DKIM-подпись письма ключами RSA и Ed25519.
+// Ожидается: подпись проходит проверку открытым ключом, покрывает стандартные заголовки,
+// изменение заголовка или тела письма делает подпись недействительной.
+func TestDKIMSignerSign(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	message := mimeMessage{
+		from:            "server@example.com",
+		to:              "user@example.com",
+		subject:         "Смена пароля",
+		date:            time.Unix(1700000000, 0),
+		messageId:       "key1@example.com",
+		listUnsubscribe: "https://example.com/unsubscribe?token=abc",
+		text:            "Password changed  \n",
+		html:            "<p>Password changed</p>\n",
+	}
+	msg, err := message.bytes()
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		key       crypto.Signer
+		publicKey crypto.PublicKey
+		alg       string
+	}{
+		"rsa":     {rsaKey, &rsaKey.PublicKey, dkimAlgRSA},
+		"ed25519": {edKey, edKey.Public(), dkimAlgEd25519},
+	} {
+		t.Run(name, func(t *testing.T) {
+			signer := dkimSigner{domain: "example.com", selector: "mail", key: tc.key}
+			signed, err := signer.sign(msg, time.Unix(1700000100, 0))
+			require.NoError(t, err)
+
+			tags, err := verifyDKIM(signed, tc.publicKey)
+			require.NoError(t, err)
+			assert.Equal(t, "1", tags["v"])
+			assert.Equal(t, tc.alg, tags["a"])
+			assert.Equal(t, "relaxed/relaxed", tags["c"])
+			assert.Equal(t, "example.com", tags["d"])
+			assert.Equal(t, "mail", tags["s"])
+			assert.Equal(t, "1700000100", tags["t"])
+			assert.Equal(t, "from:to:subject:date:message-id:mime-version:content-type:list-unsubscribe:list-unsubscribe-post", tags["h"])
+			assert.True(t, strings.HasSuffix(string(signed), string(msg)))
+
+			_, _, html := decodeMail(t, signed)
+			assert.Equal(t, "<p>Password changed</p>\r\n", html)
+
+			tampered := strings.Replace(string(signed), "To: user@example.com", "To: victim@example.com", 1)
+			_, err = verifyDKIM([]byte(tampered), tc.publicKey)
+			assert.Error(t, err)
+
+			tampered = strings.Replace(string(signed), "Password changed</p>", "Password kept</p>", 1)
+			_, err = verifyDKIM([]byte(tampered), tc.publicKey)
+			assert.ErrorContains(t, err, "body hash mismatch")
+
+			// Изменение пробелов допускается каноническим видом relaxed.
+			relaxed := strings.Replace(string(signed), "MIME-Version: 1.0", "MIME-Version:   1.0 ", 1)
+			_, err = verifyDKIM([]byte(relaxed), tc.publicKey)
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err = dkimSigner{domain: "example.com", selector: "mail", key: edKey}.sign([]byte("Subject: x"), time.Now())
+	assert.Error(t, err)
+}
+
+// TestNewDKIMSigner проверяет загрузку параметров DKIM из окружения.
+// Ожидается: без селектора и ключа подпись отключена, ключи RSA (PKCS#1/PKCS#8) и Ed25519
+// загружаются, домен по умолчанию берется из SERVER_EMAIL, некорректные параметры отклоняются.
+func TestNewDKIMSigner(t *testing.T) {
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+	t.Setenv("DKIM_DOMAIN", "")
+	t.Setenv("DKIM_SELECTOR", "")
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", "")
+	_, ok, err := newDKIMSigner()
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	t.Setenv("DKIM_SELECTOR", "mail")
+	_, _, err = newDKIMSigner()
+	assert.Error(t, err)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)))
+	signer, ok, err := newDKIMSigner()
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "example.com", signer.domain)
+	assert.Equal(t, "mail", signer.selector)
+	assert.Equal(t, dkimAlgRSA, signer.algorithm())
+
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", writePEM(t, "PRIVATE KEY", der))
+	t.Setenv("DKIM_DOMAIN", "mail.example.com")
+	signer, _, err = newDKIMSigner()
+	require.NoError(t, err)
+	assert.Equal(t, "mail.example.com", signer.domain)
+	assert.Equal(t, dkimAlgRSA, signer.algorithm())
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err = x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", writePEM(t, "PRIVATE KEY", der))
+	signer, _, err = newDKIMSigner()
+	require.NoError(t, err)
+	assert.Equal(t, dkimAlgEd25519, signer.algorithm())
+
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", writePEM(t, "PRIVATE KEY", []byte("garbage")))
+	_, _, err = newDKIMSigner()
+	assert.Error(t, err)
+
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", filepath.Join(t.TempDir(), "missing.pem"))
+	_, _, err = newDKIMSigner()
+	assert.Error(t, err)
+}
+
+// TestLoadDKIMPrivateKey проверяет кеширование закрытого ключа DKIM.
+// Ожидается: файл читается заново только после изменения времени модификации.
+func TestLoadDKIMPrivateKey(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+	path := writePEM(t, "PRIVATE KEY", der)
+	modTime := time.Unix(1700000000, 0)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	key, err := loadDKIMPrivateKey(path)
+	require.NoError(t, err)
+	assert.Equal(t, edKey, key)
+
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+	key, err = loadDKIMPrivateKey(path)
+	require.NoError(t, err, "Ключ с неизменным временем модификации должен браться из кеша")
+	assert.Equal(t, edKey, key)
+
+	require.NoError(t, os.Chtimes(path, modTime.Add(time.Second), modTime.Add(time.Second)))
+	_, err = loadDKIMPrivateKey(path)
+	assert.Error(t, err, "Измененный файл должен перечитываться")
+}
+
+// TestNewMailerDKIM проверяет подключение DKIM-подписи к способу доставки.
+// Ожидается: при заданных DKIM_SELECTOR и DKIM_PRIVATE_KEY_FILE письма доставляются подписанными,
+// некорректные параметры DKIM возвращают ошибку.
+func TestNewMailerDKIM(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(edKey)
+	require.NoError(t, err)
+
+	t.Setenv("MAIL_DRIVER", "log")
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+	t.Setenv("DKIM_DOMAIN", "")
+	t.Setenv("DKIM_SELECTOR", "mail")
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", writePEM(t, "PRIVATE KEY", der))
+	mailer, err := newMailer()
+	require.NoError(t, err)
+	require.IsType(t, dkimMailer{}, mailer)
+	assert.Equal(t, logMailer{}, mailer.(dkimMailer).mailer)
+
+	var delivered []byte
+	signing := mailer.(dkimMailer)
+	signing.mailer = mailerFunc(func(from string, to []string, msg []byte) error {
+		delivered = msg
+		return nil
+	})
+	mail, err := newOutboxMail("server@example.com", "user@example.com", authCodeSubject, "code", "<p>code</p>", "", 100)
+	require.NoError(t, err)
+	require.NoError(t, signing.Send(mail.Sender, []string{mail.Recipient}, mail.Message))
+	_, err = verifyDKIM(delivered, edKey.Public())
+	assert.NoError(t, err)
+
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", "")
+	_, err = newMailer()
+	assert.Error(t, err)
+}
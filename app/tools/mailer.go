@@ -0,0 +1,331 @@
+// Package tools предоставляет функции для валидации данных, геренации токенов и отправки email-уведомлений.
+//
+// Файл содержит способы доставки писем:
+//   - Mailer: интерфейс отправки готового письма
+//   - smtpMailer: отправляет письма через SMTP-сервер (порт, TLS/STARTTLS и механизм аутентификации настраиваются)
+//   - maildirMailer: сохраняет письма в каталог в формате Maildir (для разработки)
+//   - logMailer: выводит письма в лог (для разработки)
+//   - newMailer: выбирает способ доставки по переменной окружения MAIL_DRIVER и подключает DKIM-подпись
+package tools
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Способы доставки писем (значения MAIL_DRIVER).
+const (
+	mailDriverSMTP = "smtp"
+	mailDriverFile = "file"
+	mailDriverLog  = "log"
+)
+
+// Режимы шифрования соединения с SMTP-сервером (значения SMTP_SECURITY).
+const (
+	smtpSecurityStartTLS = "starttls"
+	smtpSecurityTLS      = "tls"
+	smtpSecurityNone     = "none"
+)
+
+// Механизмы аутентификации на SMTP-сервере (значения SMTP_AUTH).
+const (
+	smtpAuthPlain   = "plain"
+	smtpAuthLogin   = "login"
+	smtpAuthCRAMMD5 = "cram-md5"
+	smtpAuthNone    = "none"
+)
+
+// smtpTimeout ограничивает время соединения с SMTP-сервером.
+const smtpTimeout = 30 * time.Second
+
+// Mailer доставляет готовое письмо msg от from получателям to.
+type Mailer interface {
+	Send(from string, to []string, msg []byte) error
+}
+
+// newMailer создает способ доставки писем.
+//
+// Использует переменные окружения:
+//   - MAIL_DRIVER: smtp (по умолчанию), file или log
+//   - SMTP_HOST, SMTP_PORT, SMTP_SECURITY, SMTP_AUTH, SMTP_USERNAME: параметры smtp (см. newSMTPMailer)
+//   - MAIL_DIR: каталог Maildir для file (по умолчанию mail)
+//   - DKIM_SELECTOR, DKIM_PRIVATE_KEY_FILE, DKIM_DOMAIN: параметры DKIM-подписи (см. newDKIMSigner)
+//
+// Если DKIM настроен, письма подписываются перед доставкой.
+// Возвращает ошибку для неизвестного способа доставки и некорректных параметров DKIM.
+var newMailer = func() (Mailer, error) {
+	mailer, err := newMailDriver()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	signer, ok, err := newDKIMSigner()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if !ok {
+		return mailer, nil
+	}
+	return dkimMailer{mailer: mailer, signer: signer}, nil
+}
+
+// newMailDriver создает способ доставки писем по переменной окружения MAIL_DRIVER.
+func newMailDriver() (Mailer, error) {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "", mailDriverSMTP:
+		return newSMTPMailer()
+	case mailDriverFile:
+		dir := os.Getenv("MAIL_DIR")
+		if dir == "" {
+			dir = "mail"
+		}
+		return maildirMailer{dir: dir}, nil
+	case mailDriverLog:
+		return logMailer{}, nil
+	default:
+		return nil, errors.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// smtpMailer отправляет письма через SMTP-сервер.
+type smtpMailer struct {
+	host     string
+	port     int
+	security string
+	auth     string
+	username string
+	password string
+}
+
+// newSMTPMailer загружает параметры SMTP-сервера.
+//
+// Использует переменные окружения:
+//   - SMTP_HOST: адрес сервера (по умолчанию smtp.yandex.ru)
+//   - SMTP_SECURITY: starttls (по умолчанию), tls (неявный TLS) или none
+//   - SMTP_PORT: порт (по умолчанию 465 для tls, 587 для starttls, 25 для none)
+//   - SMTP_AUTH: plain (по умолчанию), login, cram-md5 или none
+//   - SMTP_USERNAME: имя пользователя (по умолчанию SERVER_EMAIL)
+//   - SERVER_EMAIL_PASSWORD: пароль
+func newSMTPMailer() (smtpMailer, error) {
+	mailer := smtpMailer{
+		host:     os.Getenv("SMTP_HOST"),
+		security: strings.ToLower(os.Getenv("SMTP_SECURITY")),
+		auth:     strings.ToLower(os.Getenv("SMTP_AUTH")),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SERVER_EMAIL_PASSWORD"),
+	}
+	if mailer.host == "" {
+		mailer.host = "smtp.yandex.ru"
+	}
+	if mailer.username == "" {
+		mailer.username = os.Getenv("SERVER_EMAIL")
+	}
+
+	switch mailer.security {
+	case "":
+		mailer.security = smtpSecurityStartTLS
+		mailer.port = 587
+	case smtpSecurityStartTLS:
+		mailer.port = 587
+	case smtpSecurityTLS:
+		mailer.port = 465
+	case smtpSecurityNone:
+		mailer.port = 25
+	default:
+		return smtpMailer{}, errors.Errorf("unknown SMTP_SECURITY %q", mailer.security)
+	}
+
+	switch mailer.auth {
+	case "":
+		mailer.auth = smtpAuthPlain
+	case smtpAuthPlain, smtpAuthLogin, smtpAuthCRAMMD5, smtpAuthNone:
+	default:
+		return smtpMailer{}, errors.Errorf("unknown SMTP_AUTH %q", mailer.auth)
+	}
+
+	if value := os.Getenv("SMTP_PORT"); value != "" {
+		port, err := strconv.Atoi(value)
+		if err != nil || port <= 0 || port > 65535 {
+			return smtpMailer{}, errors.Errorf("invalid SMTP_PORT %q", value)
+		}
+		mailer.port = port
+	}
+	return mailer, nil
+}
+
+// smtpAuth возвращает данные аутентификации для механизма SMTP_AUTH или nil для none.
+func (m smtpMailer) smtpAuth() smtp.Auth {
+	switch m.auth {
+	case smtpAuthLogin:
+		return loginAuth{host: m.host, username: m.username, password: m.password}
+	case smtpAuthCRAMMD5:
+		return smtp.CRAMMD5Auth(m.username, m.password)
+	case smtpAuthNone:
+		return nil
+	default:
+		return smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+}
+
+// Send отправляет письмо через SMTP-сервер.
+//
+// В режиме tls соединение шифруется сразу, в режиме starttls - командой STARTTLS,
+// которую сервер обязан поддерживать. Аутентификация выполняется, если выбран механизм.
+func (m smtpMailer) Send(from string, to []string, msg []byte) error {
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	tlsConfig := &tls.Config{ServerName: m.host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+
+	var conn net.Conn
+	var err error
+	if m.security == smtpSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := conn.SetDeadline(time.Now().Add(smtpTimeout)); err != nil {
+		conn.Close()
+		return errors.WithStack(err)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return errors.WithStack(err)
+	}
+	defer client.Close()
+
+	if m.security == smtpSecurityStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if auth := m.smtpAuth(); auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := writer.Write(msg); err != nil {
+		writer.Close()
+		return errors.WithStack(err)
+	}
+	if err := writer.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := client.Quit(); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// loginAuth реализует механизм аутентификации LOGIN, которого нет в net/smtp.
+//
+// Как и smtp.PlainAuth, передает пароль только по TLS или на localhost.
+type loginAuth struct {
+	host     string
+	username string
+	password string
+}
+
+// Start начинает аутентификацию LOGIN.
+func (a loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next отвечает на запросы сервера "Username:" и "Password:".
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	default:
+		return nil, errors.Errorf("unexpected server challenge %q", fromServer)
+	}
+}
+
+// maildirMailer сохраняет письма в каталог dir в формате Maildir.
+//
+// Письмо записывается в dir/tmp и переносится в dir/new, поэтому почтовые клиенты
+// и наблюдающие за каталогом программы не видят его недописанным.
+type maildirMailer struct {
+	dir string
+}
+
+// Send сохраняет письмо в dir/new, создавая подкаталоги Maildir при необходимости.
+func (m maildirMailer) Send(from string, to []string, msg []byte) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(m.dir, sub), 0o700); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), uuid.New().String(), strings.ReplaceAll(hostname, "/", "_"))
+
+	tmpPath := filepath.Join(m.dir, "tmp", name)
+	if err := os.WriteFile(tmpPath, msg, 0o600); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(m.dir, "new", name)); err != nil {
+		os.Remove(tmpPath)
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// logMailer выводит письма в лог вместо отправки.
+//
+// Письма содержат коды и ссылки для входа, поэтому использовать его можно только при разработке.
+type logMailer struct{}
+
+// Send выводит отправителя, получателей и письмо целиком в лог.
+func (logMailer) Send(from string, to []string, msg []byte) error {
+	log.Printf("Mail from %s to %s:\n%s", from, strings.Join(to, ", "), msg)
+	return nil
+}
@@ -0,0 +1,282 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startFakeSMTPServer запускает SMTP-сервер без TLS, принимающий одно соединение.
+// Возвращает порт и канал с командами клиента (для DATA - текст письма).
+func startFakeSMTPServer(t *testing.T) (int, <-chan []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	transcript := make(chan []string, 1)
+	go func() {
+		var lines []string
+		defer func() { transcript <- lines }()
+
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		readLine := func() string {
+			line, _ := reader.ReadString('\n')
+			return strings.TrimRight(line, "\r\n")
+		}
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		for {
+			line := readLine()
+			if line == "" {
+				return
+			}
+			lines = append(lines, line)
+			switch command := strings.ToUpper(strings.Fields(line)[0]); {
+			case command == "EHLO":
+				reply("250-localhost")
+				reply("250 AUTH PLAIN LOGIN")
+			case strings.HasPrefix(strings.ToUpper(line), "AUTH LOGIN"):
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				lines = append(lines, readLine())
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				lines = append(lines, readLine())
+				reply("235 Authenticated")
+			case command == "AUTH":
+				reply("235 Authenticated")
+			case command == "DATA":
+				reply("354 Go ahead")
+				var body []string
+				for {
+					dataLine := readLine()
+					if dataLine == "." {
+						break
+					}
+					body = append(body, dataLine)
+				}
+				lines = append(lines, strings.Join(body, "\n"))
+				reply("250 Queued")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	return port, transcript
+}
+
+// TestNewMailer проверяет выбор способа доставки писем.
+// Ожидается: по умолчанию smtp, file с каталогом MAIL_DIR, log, неизвестный способ - ошибка.
+func TestNewMailer(t *testing.T) {
+	t.Setenv("DKIM_SELECTOR", "")
+	t.Setenv("DKIM_PRIVATE_KEY_FILE", "")
+	t.Setenv("MAIL_DRIVER", "")
+	mailer, err := newMailer()
+	require.NoError(t, err)
+	assert.IsType(t, smtpMailer{}, mailer)
+
+	t.Setenv("MAIL_DRIVER", "file")
+	t.Setenv("MAIL_DIR", "")
+	mailer, err = newMailer()
+	require.NoError(t, err)
+	assert.Equal(t, maildirMailer{dir: "mail"}, mailer)
+
+	t.Setenv("MAIL_DIR", "/tmp/mail")
+	mailer, err = newMailer()
+	require.NoError(t, err)
+	assert.Equal(t, maildirMailer{dir: "/tmp/mail"}, mailer)
+
+	t.Setenv("MAIL_DRIVER", "log")
+	mailer, err = newMailer()
+	require.NoError(t, err)
+	assert.Equal(t, logMailer{}, mailer)
+
+	t.Setenv("MAIL_DRIVER", "sendmail")
+	_, err = newMailer()
+	assert.Error(t, err)
+}
+
+// TestNewSMTPMailer проверяет загрузку параметров SMTP-сервера.
+// Ожидается: по умолчанию smtp.yandex.ru:587 со STARTTLS и PLAIN от имени SERVER_EMAIL,
+// порт по умолчанию зависит от режима шифрования, некорректные значения отклоняются.
+func TestNewSMTPMailer(t *testing.T) {
+	for _, key := range []string{"SMTP_HOST", "SMTP_PORT", "SMTP_SECURITY", "SMTP_AUTH", "SMTP_USERNAME"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+	t.Setenv("SERVER_EMAIL_PASSWORD", "password")
+
+	mailer, err := newSMTPMailer()
+	require.NoError(t, err)
+	assert.Equal(t, smtpMailer{
+		host:     "smtp.yandex.ru",
+		port:     587,
+		security: smtpSecurityStartTLS,
+		auth:     smtpAuthPlain,
+		username: "server@example.com",
+		password: "password",
+	}, mailer)
+
+	t.Setenv("SMTP_SECURITY", "TLS")
+	mailer, err = newSMTPMailer()
+	require.NoError(t, err)
+	assert.Equal(t, 465, mailer.port)
+
+	t.Setenv("SMTP_SECURITY", "none")
+	mailer, err = newSMTPMailer()
+	require.NoError(t, err)
+	assert.Equal(t, 25, mailer.port)
+
+	t.Setenv("SMTP_HOST", "mail.example.com")
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("SMTP_AUTH", "login")
+	t.Setenv("SMTP_USERNAME", "mailer")
+	mailer, err = newSMTPMailer()
+	require.NoError(t, err)
+	assert.Equal(t, "mail.example.com", mailer.host)
+	assert.Equal(t, 2525, mailer.port)
+	assert.Equal(t, smtpAuthLogin, mailer.auth)
+	assert.Equal(t, "mailer", mailer.username)
+
+	for key, value := range map[string]string{"SMTP_SECURITY": "ssl", "SMTP_AUTH": "xoauth2", "SMTP_PORT": "port"} {
+		t.Run(key, func(t *testing.T) {
+			t.Setenv(key, value)
+			_, err := newSMTPMailer()
+			assert.Error(t, err)
+		})
+	}
+}
+
+// TestSMTPMailerSend проверяет отправку письма через SMTP-сервер.
+// Ожидается: клиент аутентифицируется выбранным механизмом, передает отправителя,
+// получателей и письмо; без механизма аутентификация не выполняется.
+func TestSMTPMailerSend(t *testing.T) {
+	tests := []struct {
+		name string
+		auth string
+		want []string
+	}{
+		{name: "plain", auth: smtpAuthPlain, want: []string{"AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00server@example.com\x00password"))}},
+		{name: "login", auth: smtpAuthLogin, want: []string{"AUTH LOGIN", base64.StdEncoding.EncodeToString([]byte("server@example.com")), base64.StdEncoding.EncodeToString([]byte("password"))}},
+		{name: "none", auth: smtpAuthNone, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port, transcript := startFakeSMTPServer(t)
+			mailer := smtpMailer{host: "127.0.0.1", port: port, security: smtpSecurityNone, auth: tt.auth, username: "server@example.com", password: "password"}
+
+			err := mailer.Send("server@example.com", []string{"user@example.com"}, []byte("Subject: Test\r\n\r\nHello"))
+			require.NoError(t, err)
+
+			lines := <-transcript
+			require.Len(t, lines, 6+len(tt.want))
+			assert.Equal(t, "EHLO localhost", lines[0])
+			assert.Equal(t, tt.want, lines[1:1+len(tt.want)])
+			rest := lines[1+len(tt.want):]
+			assert.Equal(t, "MAIL FROM:<server@example.com>", rest[0])
+			assert.Equal(t, "RCPT TO:<user@example.com>", rest[1])
+			assert.Equal(t, "DATA", rest[2])
+			assert.Equal(t, "Subject: Test\n\nHello", rest[3])
+			assert.Equal(t, "QUIT", rest[4])
+		})
+	}
+}
+
+// TestSMTPMailerSendStartTLSRequired проверяет, что в режиме starttls письмо не уходит
+// по незашифрованному соединению, если сервер не поддерживает STARTTLS.
+func TestSMTPMailerSendStartTLSRequired(t *testing.T) {
+	port, transcript := startFakeSMTPServer(t)
+	mailer := smtpMailer{host: "127.0.0.1", port: port, security: smtpSecurityStartTLS, auth: smtpAuthPlain}
+
+	err := mailer.Send("server@example.com", []string{"user@example.com"}, []byte("Hello"))
+	assert.ErrorContains(t, err, "STARTTLS")
+
+	lines := <-transcript
+	for _, line := range lines {
+		assert.NotContains(t, line, "MAIL FROM")
+	}
+}
+
+// TestLoginAuth проверяет механизм LOGIN.
+// Ожидается: пароль не передается по незашифрованному соединению с удаленным сервером.
+func TestLoginAuth(t *testing.T) {
+	auth := loginAuth{host: "mail.example.com", username: "user", password: "password"}
+
+	_, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com"})
+	assert.Error(t, err)
+	_, _, err = auth.Start(&smtp.ServerInfo{Name: "other.example.com", TLS: true})
+	assert.Error(t, err)
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "mail.example.com", TLS: true})
+	require.NoError(t, err)
+	assert.Equal(t, "LOGIN", mechanism)
+
+	response, err := auth.Next([]byte("Username:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "user", string(response))
+	response, err = auth.Next([]byte("Password:"), true)
+	require.NoError(t, err)
+	assert.Equal(t, "password", string(response))
+	_, err = auth.Next([]byte("Token:"), true)
+	assert.Error(t, err)
+}
+
+// TestMaildirMailerSend проверяет сохранение писем в каталог Maildir.
+// Ожидается: каждое письмо - отдельный файл в new, tmp после записи пуст.
+func TestMaildirMailerSend(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	mailer := maildirMailer{dir: dir}
+
+	require.NoError(t, mailer.Send("server@example.com", []string{"user@example.com"}, []byte("first")))
+	require.NoError(t, mailer.Send("server@example.com", []string{"user@example.com"}, []byte("second")))
+
+	entries, err := os.ReadDir(filepath.Join(dir, "new"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	var contents []string
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(dir, "new", entry.Name()))
+		require.NoError(t, err)
+		contents = append(contents, string(content))
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, contents)
+
+	tmpEntries, err := os.ReadDir(filepath.Join(dir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmpEntries)
+	assert.DirExists(t, filepath.Join(dir, "cur"))
+}
+
+// TestLogMailerSend проверяет вывод писем в лог.
+func TestLogMailerSend(t *testing.T) {
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	require.NoError(t, logMailer{}.Send("server@example.com", []string{"a@example.com", "b@example.com"}, []byte("Subject: Test")))
+
+	assert.Contains(t, logOutput.String(), "Mail from server@example.com to a@example.com, b@example.com")
+	assert.Contains(t, logOutput.String(), "Subject: Test")
+}
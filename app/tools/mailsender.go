@@ -5,30 +5,52 @@
 //   - SuspiciousLoginEmailSend: отправляет уведомление о подозрительном входе
 //   - PasswordResetEmailSend: отправляет ссылку для сброса пароля
 //   - ServerAuthCodeSend: отправляет код аутентификации сервера
+//   - EmailChangeNotificationSend: уведомляет прежний email о смене адреса
+//   - PasswordChangeNotificationSend: уведомляет пользователя о смене пароля
+//   - AccountDeletionLinkSend: отправляет ссылку для подтверждения удаления аккаунта
+//   - SecurityDigestSend: отправляет еженедельную сводку безопасности
+//   - OAuthLinkNotificationSend, SessionRevokeNotificationSend, AccountLockNotificationSend:
+//     уведомляют о привязке способа входа, завершении сессий и блокировке аккаунта
+//
+// Уведомления безопасности содержат сведения о событии (время, IP, устройство)
+// и ссылку "это был не я" из structs.SecurityAlert.
+// Письма ставятся в очередь и доставляются через Mailer, выбранный newMailer
+// (см. outbox.go и mailer.go); коды аутентификации отправляются сразу.
+// Тема и текст письма берутся из каталога i18n на языке locale.
 package tools
 
 import (
 	"bytes"
 	"crypto/rand"
+	"log"
 	mathrand "math/rand"
 	"math/big"
-	"net/smtp"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/gimaevra94/auth/app/consts"
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/pkg/errors"
 )
 
+// Виды писем. Значения используются как ключи mailTmplNames и mailSubjectKeys,
+// тема письма берется из каталога i18n на языке получателя.
 var (
 	authCodeSubject        = "Auth code"
 	suspiciousLoginSubject = "Suspicious login alert!"
 	newDeviceLoginSubject  = "New device login"
 	passwordResetSubject   = "Password reset request"
-	
-	// sendMailFunc позволяет подменить функцию отправки для тестов
-	sendMailFunc = smtp.SendMail
+	emailChangeSubject     = "Email address changed"
+	passwordChangeSubject  = "Password changed"
+	accountDeletionSubject = "Account deletion request"
+	securityDigestSubject  = "Weekly security digest"
+	oauthLinkSubject       = "Sign-in method linked"
+	sessionRevokeSubject   = "Sessions signed out"
+	accountLockSubject     = "Account locked"
 )
 
 // serverAuthCodeGenerate генерирует случайный 4-значный код аутентификации.
@@ -55,187 +77,282 @@ func init() {
 
 // SendNewDeviceLoginEmail отправляет уведомление о входе с нового устройства.
 //
-// Принимает логин пользователя, email и User-Agent.
+// Принимает язык письма, логин пользователя, email и User-Agent.
 // Формирует и отправляет email с информацией о входе.
-var SendNewDeviceLoginEmail = func(login, userEmail, userAgent string) error {
-	serverEmail := os.Getenv("SERVER_EMAIL")
-	if serverEmail == "" {
-		return errors.New("SERVER_EMAIL environment variable is not set")
-	}
-	if userEmail == "" {
-		return nil // Не отправляем email если отсутствует email пользователя
-	}
-	
-	sMTPServerAuthSubject, sMTPServerAddr := sMTPServerAuth(serverEmail)
+var SendNewDeviceLoginEmail = func(locale, login, userEmail, userAgent string) error {
 	data := struct {
-		login     string
-		userAgent string
-	}{login: login, userAgent: userAgent}
-
-	msg, err := executeTmpl(serverEmail, userEmail, newDeviceLoginSubject, data)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+		Login     string
+		UserAgent string
+	}{Login: login, UserAgent: userAgent}
 
-	if err := mailSend(serverEmail, userEmail, sMTPServerAuthSubject, sMTPServerAddr, msg); err != nil {
+	if err := mailSend(locale, userEmail, newDeviceLoginSubject, data); err != nil {
 		return errors.WithStack(err)
 	}
-
 	return nil
 }
 
-// sMTPServerAuth создает аутентификационные данные для SMTP-сервера.
+// mailSend формирует письмо вида emailSubject на языке locale и ставит его в очередь на userEmail.
 //
-// Принимает email сервера и возвращает объект аутентификации и адрес SMTP-сервера.
-func sMTPServerAuth(serverEmail string) (smtp.Auth, string) {
-	serverPassword := os.Getenv("SERVER_EMAIL_PASSWORD")
-	sMTPServerAddr := "smtp.yandex.ru"
-	sMTPServerAuthSubject := smtp.PlainAuth("", serverEmail, serverPassword, sMTPServerAddr)
-	return sMTPServerAuthSubject, sMTPServerAddr
+// Письмо отправляет ProcessMailOutbox, поэтому недоступность почтового сервера
+// не мешает обработчику завершить запрос. Отправителем указывается SERVER_EMAIL.
+// Возвращает ошибку, если переменная не задана; письмо на пустой адрес не отправляется.
+func mailSend(locale, userEmail, emailSubject string, data any) error {
+	mail, ok, err := newMail(locale, userEmail, emailSubject, data)
+	if err != nil || !ok {
+		return err
+	}
+	if err := enqueueMail(mail); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
 }
 
-// mailSend отправляет email через SMTP-сервер.
+// newMail формирует письмо вида emailSubject на языке locale для очереди.
 //
-// Принимает email отправителя, получателя, данные аутентификации, адрес сервера и сообщение.
-// Выполняет отправку письма.
-func mailSend(serverEmail, userEmail string, sMTPServerAuthSubject smtp.Auth, sMTPServerAddr string, msg []byte) error {
+// Возвращает false, если адрес получателя пустой и письмо отправлять не нужно.
+func newMail(locale, userEmail, emailSubject string, data any) (structs.OutboxMail, bool, error) {
+	serverEmail := os.Getenv("SERVER_EMAIL")
 	if serverEmail == "" {
-		return errors.New("server email cannot be empty")
+		return structs.OutboxMail{}, false, errors.New("SERVER_EMAIL environment variable is not set")
 	}
-	
-	from := serverEmail
-	to := []string{userEmail}
-	addr := sMTPServerAddr + ":587"
-	if err := sendMailFunc(addr, sMTPServerAuthSubject, from, to, msg); err != nil {
-		return errors.WithStack(err)
+	if userEmail == "" {
+		return structs.OutboxMail{}, false, nil // Не отправляем email если отсутствует email пользователя
 	}
-	return nil
+
+	text, html, err := executeTmpl(locale, emailSubject, data)
+	if err != nil {
+		return structs.OutboxMail{}, false, errors.WithStack(err)
+	}
+	subject := emailSubject
+	if key, ok := mailSubjectKeys[emailSubject]; ok {
+		subject = i18n.Text(locale, key)
+	}
+	mail, err := newOutboxMail(serverEmail, userEmail, subject, text, html, unsubscribeLink(userEmail, emailSubject), time.Now().Unix())
+	if err != nil {
+		return structs.OutboxMail{}, false, errors.WithStack(err)
+	}
+	return mail, true, nil
 }
 
-// executeTmpl формирует email-сообщение на основе шаблона.
-//
-// Принимает email отправителя, получателя, тему и данные для шаблона.
-// Возвращает готовое email-сообщение в формате байтов.
-func executeTmpl(serverEmail, userEmail, emailSubject string, data any) ([]byte, error) {
-	var body bytes.Buffer
-
-	switch emailSubject {
-	case authCodeSubject:
-		if err := tmpls.BaseTmpl.ExecuteTemplate(&body, "emailMsgWithServerAuthCode", data); err != nil {
-			return []byte{}, errors.WithStack(err)
-		}
+// mailTmplNames связывает вид письма с именем HTML-шаблона в tmpls.BaseTmpl;
+// текстовый шаблон в tmpls.EmailTextTmpl называется так же с суффиксом Text.
+var mailTmplNames = map[string]string{
+	authCodeSubject:        "emailMsgWithServerAuthCode",
+	suspiciousLoginSubject: "emailMsgAboutSuspiciousLoginEmail",
+	newDeviceLoginSubject:  "emailMsgAboutNewDeviceLoginEmail",
+	passwordResetSubject:   "emailMsgWithPasswordResetLink",
+	emailChangeSubject:     "emailMsgAboutEmailChange",
+	passwordChangeSubject:  "emailMsgAboutPasswordChange",
+	accountDeletionSubject: "emailMsgWithAccountDeletionLink",
+	securityDigestSubject:  "emailMsgSecurityDigest",
+	oauthLinkSubject:       "emailMsgSecurityAlert",
+	sessionRevokeSubject:   "emailMsgSecurityAlert",
+	accountLockSubject:     "emailMsgSecurityAlert",
+}
 
-	case suspiciousLoginSubject:
-		if err := tmpls.BaseTmpl.ExecuteTemplate(&body, "emailMsgAboutSuspiciousLoginEmail", data); err != nil {
-			return []byte{}, errors.WithStack(err)
-		}
+// mailSubjectKeys связывает вид письма с ключом темы в каталоге i18n.
+var mailSubjectKeys = map[string]string{
+	authCodeSubject:        "mail.authCode.subject",
+	suspiciousLoginSubject: "mail.suspiciousLogin.subject",
+	newDeviceLoginSubject:  "mail.newDeviceLogin.subject",
+	passwordResetSubject:   "mail.passwordReset.subject",
+	emailChangeSubject:     "mail.emailChange.subject",
+	passwordChangeSubject:  "mail.passwordChange.subject",
+	accountDeletionSubject: "mail.accountDeletion.subject",
+	securityDigestSubject:  "mail.securityDigest.subject",
+	oauthLinkSubject:       "mail.oauthLink.subject",
+	sessionRevokeSubject:   "mail.sessionRevoke.subject",
+	accountLockSubject:     "mail.accountLock.subject",
+}
 
-	case newDeviceLoginSubject:
-		if err := tmpls.BaseTmpl.ExecuteTemplate(&body, "emailMsgAboutNewDeviceLoginEmail", data); err != nil {
-			return []byte{}, errors.WithStack(err)
-		}
+// notificationSubjects связывает вид письма с настройкой уведомления, которую пользователь
+// может отключить; в такие письма добавляется заголовок List-Unsubscribe.
+// Критичные уведомления безопасности, коды и ссылки, запрошенные пользователем, его не содержат.
+var notificationSubjects = map[string]string{
+	newDeviceLoginSubject: data.NotificationNewDeviceLogin,
+	securityDigestSubject: data.NotificationSecurityDigest,
+}
 
-	case passwordResetSubject:
-		if err := tmpls.BaseTmpl.ExecuteTemplate(&body, "emailMsgWithPasswordResetLink", data); err != nil {
-			return []byte{}, errors.WithStack(err)
-		}
+// executeTmpl формирует текстовую и HTML-версии письма вида emailSubject на языке locale.
+//
+// Для вида письма без шаблона возвращает пустые версии.
+func executeTmpl(locale, emailSubject string, data any) (string, string, error) {
+	tmplName, ok := mailTmplNames[emailSubject]
+	if !ok {
+		return "", "", nil
 	}
 
-	msg := []byte(
-		"From: " + serverEmail + "\r\n" +
-			"To: " + userEmail + "\r\n" +
-			"Subject: " + emailSubject + "\r\n" +
-			"MIME-Version: 1.0\r\n" +
-			"Content-Type: text/html; charset=\"UTF-8\"\r\n" +
-			"\r\n" +
-			body.String(),
-	)
+	var text, html bytes.Buffer
+	if err := tmpls.LocalizedEmailTextTmpl(locale).ExecuteTemplate(&text, tmplName+"Text", data); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	if err := tmpls.LocalizedTmpl(locale).ExecuteTemplate(&html, tmplName, data); err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	return text.String(), html.String(), nil
+}
 
-	return msg, nil
+// unsubscribeLink возвращает ссылку отписки userEmail от уведомления вида emailSubject
+// для заголовка List-Unsubscribe или пустую строку, если уведомление отключить нельзя.
+//
+// Ссылка ведет на consts.UnsubscribeURL и принимает одношаговую отписку (RFC 8058).
+// Ошибка только логируется: уведомление отправляется без заголовка.
+func unsubscribeLink(userEmail, emailSubject string) string {
+	setting, ok := notificationSubjects[emailSubject]
+	if !ok {
+		return ""
+	}
+	link, err := GenerateUnsubscribeLink(userEmail, setting, tmpls.PublicURL(consts.UnsubscribeURL))
+	if err != nil {
+		log.Printf("%+v", err)
+		return ""
+	}
+	return link
 }
 
 // SuspiciousLoginEmailSend отправляет уведомление о подозрительном входе.
 //
-// Принимает email пользователя и User-Agent.
+// Принимает язык письма, email пользователя и User-Agent.
 // Формирует и отправляет email с предупреждением о подозрительной активности.
-var SuspiciousLoginEmailSend = func(userEmail, userAgent string) error {
-	serverEmail := os.Getenv("SERVER_EMAIL")
-	if serverEmail == "" {
-		return errors.New("SERVER_EMAIL environment variable is not set")
-	}
-	if userEmail == "" {
-		return nil // Не отправляем email если отсутствует email пользователя
-	}
-	
-	sMTPServerAuthSubject, sMTPServerAddr := sMTPServerAuth(serverEmail)
+var SuspiciousLoginEmailSend = func(locale, userEmail, userAgent string) error {
 	data := struct {
 		UserAgent string
 	}{UserAgent: userAgent}
 
-	msg, err := executeTmpl(serverEmail, userEmail, suspiciousLoginSubject, data)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	if err := mailSend(serverEmail, userEmail, sMTPServerAuthSubject, sMTPServerAddr, msg); err != nil {
+	if err := mailSend(locale, userEmail, suspiciousLoginSubject, data); err != nil {
 		return errors.WithStack(err)
 	}
-
 	return nil
 }
 
 // PasswordResetEmailSend отправляет ссылку для сброса пароля.
 //
-// Принимает email пользователя и ссылку для сброса.
+// Принимает язык письма, email пользователя, ссылку для сброса и сведения о запросе.
 // Формирует и отправляет email с инструкциями по сбросу пароля.
-var PasswordResetEmailSend = func(userEmail, resetLink string) error {
-	serverEmail := os.Getenv("SERVER_EMAIL")
-	if serverEmail == "" {
-		return errors.New("SERVER_EMAIL environment variable is not set")
-	}
-	if userEmail == "" {
-		return nil // Не отправляем email если отсутствует email пользователя
-	}
-	
-	sMTPServerAuthSubject, sMTPServerAddr := sMTPServerAuth(serverEmail)
-	data := struct{ ResetLink string }{ResetLink: resetLink}
+var PasswordResetEmailSend = func(locale, userEmail, resetLink string, alert structs.SecurityAlert) error {
+	data := struct {
+		ResetLink string
+		Alert     structs.SecurityAlert
+	}{ResetLink: resetLink, Alert: alert}
 
-	msg, err := executeTmpl(serverEmail, userEmail, passwordResetSubject, data)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	if err := mailSend(serverEmail, userEmail, sMTPServerAuthSubject, sMTPServerAddr, msg); err != nil {
+	if err := mailSend(locale, userEmail, passwordResetSubject, data); err != nil {
 		return errors.WithStack(err)
 	}
-
 	return nil
 }
 
 // ServerAuthCodeSend отправляет код аутентификации сервера.
 //
-// Принимает email пользователя.
-// Генерирует код и отправляет его на указанный email.
+// Принимает язык письма и email пользователя.
+// Генерирует код и отправляет его на указанный email сразу, не дожидаясь очереди:
+// пользователь ждет код на странице. Если отправка не удалась за MAIL_SYNC_TIMEOUT,
+// письмо ставится в очередь и будет отправлено повторно.
 // Возвращает сгенерированный код и ошибку, если она возникла.
-var ServerAuthCodeSend = func(userEmail string) (string, error) {
-	serverEmail := os.Getenv("SERVER_EMAIL")
-	if serverEmail == "" {
-		return "", errors.New("SERVER_EMAIL environment variable is not set")
-	}
-	if userEmail == "" {
-		return "", nil // Не отправляем email если отсутствует email пользователя
-	}
-	
+var ServerAuthCodeSend = func(locale, userEmail string) (string, error) {
 	authServerCode := serverAuthCodeGenerate()
-	sMTPServerAuthSubject, sMTPServerAddr := sMTPServerAuth(serverEmail)
 	data_ := struct{ Code string }{Code: authServerCode}
 
-	msg, err := executeTmpl(serverEmail, userEmail, authCodeSubject, data_)
+	mail, ok, err := newMail(locale, userEmail, authCodeSubject, data_)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
+	if !ok {
+		return "", nil
+	}
 
-	if err := mailSend(serverEmail, userEmail, sMTPServerAuthSubject, sMTPServerAddr, msg); err != nil {
-		return "", errors.WithStack(err)
+	if err := sendMailWithTimeout(mail, mailSyncTimeout()); err != nil {
+		log.Printf("%+v", err)
+		if err := enqueueMail(mail); err != nil {
+			return "", errors.WithStack(err)
+		}
 	}
 
 	return authServerCode, nil
 }
+
+// EmailChangeNotificationSend уведомляет прежний email о смене адреса.
+//
+// Принимает язык письма, прежний и новый email, ссылку для отмены смены и сведения о смене.
+// Формирует и отправляет письмо на прежний адрес. Без undoLink (смену выполнил
+// администратор) блок отмены в письме не показывается.
+var EmailChangeNotificationSend = func(locale, oldEmail, newEmail, undoLink string, alert structs.SecurityAlert) error {
+	data := struct {
+		NewEmail string
+		UndoLink string
+		Alert    structs.SecurityAlert
+	}{NewEmail: newEmail, UndoLink: undoLink, Alert: alert}
+
+	if err := mailSend(locale, oldEmail, emailChangeSubject, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// PasswordChangeNotificationSend уведомляет пользователя о смене пароля.
+//
+// Принимает язык письма, email пользователя и сведения о смене со ссылкой "это был не я",
+// которой можно воспользоваться, если пароль сменил не пользователь.
+var PasswordChangeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+	data := struct {
+		Alert structs.SecurityAlert
+	}{Alert: alert}
+
+	if err := mailSend(locale, email, passwordChangeSubject, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// AccountDeletionLinkSend отправляет ссылку для подтверждения удаления аккаунта.
+//
+// Используется, когда пользователь подтверждает удаление через email, а не паролем.
+// Письмо формируется на языке locale.
+var AccountDeletionLinkSend = func(locale, email, deletionLink string) error {
+	data := struct {
+		DeletionLink string
+	}{DeletionLink: deletionLink}
+
+	if err := mailSend(locale, email, accountDeletionSubject, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// SecurityDigestSend отправляет еженедельную сводку безопасности.
+//
+// Принимает язык письма, email пользователя и сводку: входы и изменения профиля
+// за неделю и ссылку на настройки уведомлений, где сводку можно отключить.
+var SecurityDigestSend = func(locale, email string, digest structs.SecurityDigest) error {
+	if err := mailSend(locale, email, securityDigestSubject, digest); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// securityAlertSend отправляет уведомление безопасности вида emailSubject
+// с общим шаблоном emailMsgSecurityAlert.
+func securityAlertSend(locale, email, emailSubject string, alert structs.SecurityAlert) error {
+	data := struct {
+		Alert structs.SecurityAlert
+	}{Alert: alert}
+
+	if err := mailSend(locale, email, emailSubject, data); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// OAuthLinkNotificationSend уведомляет пользователя о привязке нового способа входа к аккаунту.
+var OAuthLinkNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+	return securityAlertSend(locale, email, oauthLinkSubject, alert)
+}
+
+// SessionRevokeNotificationSend уведомляет пользователя о завершении всех его сессий.
+var SessionRevokeNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+	return securityAlertSend(locale, email, sessionRevokeSubject, alert)
+}
+
+// AccountLockNotificationSend уведомляет пользователя о блокировке аккаунта.
+var AccountLockNotificationSend = func(locale, email string, alert structs.SecurityAlert) error {
+	return securityAlertSend(locale, email, accountLockSubject, alert)
+}
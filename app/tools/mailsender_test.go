@@ -1,25 +1,28 @@
 package tools
 
 import (
-	"net/smtp"
+	"mime"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
 	"github.com/gimaevra94/auth/app/tmpls"
 	"github.com/pkg/errors"
 )
 
-type mockSMTPClient struct {
+type mockMailer struct {
 	shouldFail bool
 	sentFrom   string
 	sentTo     []string
 	sentMsg    []byte
 }
 
-func (m *mockSMTPClient) SendMail(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+func (m *mockMailer) Send(from string, to []string, msg []byte) error {
 	if m.shouldFail {
-		return errors.New("SMTP send failed")
+		return errors.New("mail send failed")
 	}
 	m.sentFrom = from
 	m.sentTo = to
@@ -27,10 +30,24 @@ func (m *mockSMTPClient) SendMail(addr string, auth smtp.Auth, from string, to [
 	return nil
 }
 
-var mockClient = &mockSMTPClient{}
+var mockClient = &mockMailer{}
 
-func mockSendMail(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
-	return mockClient.SendMail(addr, auth, from, to, msg)
+func mockNewMailer() (Mailer, error) {
+	return mockClient, nil
+}
+
+// mockMailDelivery подменяет отправку и очередь писем на mockClient и возвращает функцию восстановления.
+func mockMailDelivery() func() {
+	originalNewMailer := newMailer
+	originalEnqueueMail := enqueueMail
+	newMailer = mockNewMailer
+	enqueueMail = func(mail structs.OutboxMail) error {
+		return mockClient.Send(mail.Sender, []string{mail.Recipient}, mail.Message)
+	}
+	return func() {
+		newMailer = originalNewMailer
+		enqueueMail = originalEnqueueMail
+	}
 }
 
 func TestServerAuthCodeGenerate(t *testing.T) {
@@ -66,144 +83,119 @@ func TestServerAuthCodeGenerate(t *testing.T) {
 	}
 }
 
-func TestSMTPServerAuth(t *testing.T) {
-	serverEmail := "test@example.com"
-	os.Setenv("SERVER_EMAIL_PASSWORD", "testpassword")
-	defer os.Unsetenv("SERVER_EMAIL_PASSWORD")
-
-	auth, addr := sMTPServerAuth(serverEmail)
-
-	if auth == nil {
-		t.Error("Expected non-nil auth object")
-	}
-
-	if addr != "smtp.yandex.ru" {
-		t.Errorf("Expected address 'smtp.yandex.ru', got '%s'", addr)
-	}
-
-	serverEmail = ""
-	auth, addr = sMTPServerAuth(serverEmail)
-
-	if auth == nil {
-		t.Error("Expected non-nil auth object even with empty server email")
-	}
-}
-
 func TestExecuteTmpl(t *testing.T) {
-	serverEmail := "server@example.com"
-	userEmail := "user@example.com"
-
 	data := struct{ Code string }{Code: "1234"}
-	msg, err := executeTmpl(serverEmail, userEmail, authCodeSubject, data)
+	text, html, err := executeTmpl(i18n.En, authCodeSubject, data)
 	if err != nil {
 		t.Fatalf("Failed to execute auth code template: %v", err)
 	}
-
-	msgStr := string(msg)
-	if !strings.Contains(msgStr, "From: "+serverEmail) {
-		t.Error("Missing From header")
-	}
-	if !strings.Contains(msgStr, "To: "+userEmail) {
-		t.Error("Missing To header")
-	}
-	if !strings.Contains(msgStr, "Subject: "+authCodeSubject) {
-		t.Error("Missing Subject header")
-	}
-	if !strings.Contains(msgStr, "MIME-Version: 1.0") {
-		t.Error("Missing MIME-Version header")
-	}
-	if !strings.Contains(msgStr, "Content-Type: text/html; charset=\"UTF-8\"") {
-		t.Error("Missing Content-Type header")
+	if !strings.Contains(text, "1234") || !strings.Contains(html, "1234") {
+		t.Error("Auth code 1234 not found in email text and html")
 	}
-	if !strings.Contains(msgStr, "1234") {
-		t.Error("Auth code 1234 not found in email body")
+	if strings.Contains(text, "<") {
+		t.Error("Text version should not contain HTML")
 	}
 
-	data2 := struct{ UserAgent string }{UserAgent: "Mozilla/5.0"}
-	msg, err = executeTmpl(serverEmail, userEmail, suspiciousLoginSubject, data2)
+	data2 := struct{ UserAgent string }{UserAgent: "Mozilla/5.0 <script>"}
+	text, html, err = executeTmpl(i18n.En, suspiciousLoginSubject, data2)
 	if err != nil {
 		t.Fatalf("Failed to execute suspicious login template: %v", err)
 	}
-
-	if !strings.Contains(string(msg), "Subject: "+suspiciousLoginSubject) {
-		t.Error("Wrong subject in suspicious login email")
+	if !strings.Contains(text, "Mozilla/5.0 <script>") {
+		t.Error("User-Agent should be in the text version as is")
 	}
-	if !strings.Contains(string(msg), "Mozilla/5.0") {
-		t.Error("User-Agent Mozilla/5.0 not found in suspicious login email body")
+	if !strings.Contains(html, "Mozilla/5.0 &lt;script&gt;") {
+		t.Error("User-Agent should be escaped in the html version")
 	}
 
 	data3 := struct {
 		login     string
 		userAgent string
 	}{login: "testuser", userAgent: "Chrome"}
-	msg, err = executeTmpl(serverEmail, userEmail, newDeviceLoginSubject, data3)
+	text, html, err = executeTmpl(i18n.En, newDeviceLoginSubject, data3)
 	if err != nil {
 		t.Fatalf("Failed to execute new device login template: %v", err)
 	}
-
-	if !strings.Contains(string(msg), "Subject: "+newDeviceLoginSubject) {
-		t.Error("Wrong subject in new device login email")
-	}
-
-	if !strings.Contains(string(msg), "new device") {
-		t.Error("New device login information not found in email body")
-	}
-
-	if !strings.Contains(string(msg), "login") {
-		t.Error("Login information not found in new device login email body")
+	if !strings.Contains(text, "new device") || !strings.Contains(html, "new device") {
+		t.Error("New device login information not found in email text and html")
 	}
 
-	data4 := struct{ ResetLink string }{ResetLink: "https://example.com/reset"}
-	msg, err = executeTmpl(serverEmail, userEmail, passwordResetSubject, data4)
+	data4 := struct {
+		ResetLink string
+		Alert     structs.SecurityAlert
+	}{ResetLink: "https://example.com/reset"}
+	text, html, err = executeTmpl(i18n.En, passwordResetSubject, data4)
 	if err != nil {
 		t.Fatalf("Failed to execute password reset template: %v", err)
 	}
-
-	if !strings.Contains(string(msg), "Subject: "+passwordResetSubject) {
-		t.Error("Wrong subject in password reset email")
-	}
-	if !strings.Contains(string(msg), "https://example.com/reset") {
-		t.Error("Reset link https://example.com/reset not found in password reset email body")
+	if !strings.Contains(text, "https://example.com/reset") || !strings.Contains(html, "https://example.com/reset") {
+		t.Error("Reset link https://example.com/reset not found in password reset email text and html")
 	}
 
-	_, err = executeTmpl(serverEmail, userEmail, "Unknown Subject", data)
+	text, html, err = executeTmpl(i18n.En, "Unknown Subject", data)
 	if err != nil {
 		t.Errorf("Unexpected error with unknown subject: %v", err)
 	}
+	if text != "" || html != "" {
+		t.Error("Unknown subject should produce an empty email")
+	}
 
-	_, err = executeTmpl("", "", authCodeSubject, data)
-	if err != nil {
-		t.Errorf("Should handle empty parameters gracefully: %v", err)
+	for subject, tmplName := range mailTmplNames {
+		if tmpls.BaseTmpl.Lookup(tmplName) == nil || tmpls.EmailTextTmpl.Lookup(tmplName+"Text") == nil {
+			t.Errorf("HTML or text template for %s is missing", subject)
+		}
 	}
 }
 
 func TestMailSend(t *testing.T) {
-	originalSendMailFunc := sendMailFunc
-	defer func() { sendMailFunc = originalSendMailFunc }()
-	sendMailFunc = mockSendMail
-	
-	serverEmail := "server@example.com"
-	userEmail := "user@example.com"
-	auth := smtp.PlainAuth("", serverEmail, "password", "smtp.example.com")
-	addr := "smtp.example.com"
-	msg := []byte("Test message")
+	defer mockMailDelivery()()
+
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+	data := struct{ Code string }{Code: "1234"}
 
 	mockClient.shouldFail = false
-	err := mailSend(serverEmail, userEmail, auth, addr, msg)
+	err := mailSend(i18n.En, "user@example.com", authCodeSubject, data)
 	if err != nil {
 		t.Errorf("Unexpected error in mailSend: %v", err)
 	}
+	if mockClient.sentFrom != "server@example.com" {
+		t.Errorf("Mail should be sent from SERVER_EMAIL, got %s", mockClient.sentFrom)
+	}
+	if len(mockClient.sentTo) != 1 || mockClient.sentTo[0] != "user@example.com" {
+		t.Errorf("Mail should be sent to the user email, got %v", mockClient.sentTo)
+	}
+	header, text, _ := decodeMail(t, mockClient.sentMsg)
+	if !strings.Contains(text, "1234") {
+		t.Error("Message should contain the rendered template")
+	}
+	if !strings.HasSuffix(header.Get("Message-ID"), "@example.com>") {
+		t.Errorf("Message should have Message-ID header, got %q", header.Get("Message-ID"))
+	}
+	if header.Get("List-Unsubscribe") != "" {
+		t.Error("Auth code message should not have List-Unsubscribe header")
+	}
 
-	err = mailSend("", userEmail, auth, addr, msg)
+	err = mailSend(i18n.En, "user@example.com\r\nBcc: victim@example.com", authCodeSubject, data)
+	if err == nil {
+		t.Error("Expected error with CR/LF in recipient")
+	}
+
+	mockClient.shouldFail = true
+	err = mailSend(i18n.En, "user@example.com", authCodeSubject, data)
+	mockClient.shouldFail = false
+	if err == nil {
+		t.Error("Expected error when mail cannot be queued")
+	}
+
+	t.Setenv("SERVER_EMAIL", "")
+	err = mailSend(i18n.En, "user@example.com", authCodeSubject, data)
 	if err == nil {
 		t.Error("Expected error with empty server email")
 	}
 }
 
 func TestSendNewDeviceLoginEmail(t *testing.T) {
-	originalSendMailFunc := sendMailFunc
-	defer func() { sendMailFunc = originalSendMailFunc }()
-	sendMailFunc = mockSendMail
+	defer mockMailDelivery()()
 	
 	os.Setenv("SERVER_EMAIL", "server@example.com")
 	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
@@ -217,26 +209,24 @@ func TestSendNewDeviceLoginEmail(t *testing.T) {
 	userAgent := "Mozilla/5.0 (Windows NT 10.0; Win64; x64)"
 
 	mockClient.shouldFail = false
-	err := SendNewDeviceLoginEmail(login, userEmail, userAgent)
+	err := SendNewDeviceLoginEmail(i18n.En, login, userEmail, userAgent)
 	if err != nil {
 		t.Errorf("Unexpected error in SendNewDeviceLoginEmail: %v", err)
 	}
 
-	err = SendNewDeviceLoginEmail("", userEmail, userAgent)
+	err = SendNewDeviceLoginEmail(i18n.En, "", userEmail, userAgent)
 	if err != nil {
 		t.Errorf("Should handle empty login gracefully: %v", err)
 	}
 
-	err = SendNewDeviceLoginEmail(login, "", userAgent)
+	err = SendNewDeviceLoginEmail(i18n.En, login, "", userAgent)
 	if err != nil {
 		t.Errorf("Should handle empty user email gracefully: %v", err)
 	}
 }
 
 func TestSuspiciousLoginEmailSend(t *testing.T) {
-	originalSendMailFunc := sendMailFunc
-	defer func() { sendMailFunc = originalSendMailFunc }()
-	sendMailFunc = mockSendMail
+	defer mockMailDelivery()()
 	
 	os.Setenv("SERVER_EMAIL", "server@example.com")
 	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
@@ -249,26 +239,24 @@ func TestSuspiciousLoginEmailSend(t *testing.T) {
 	userAgent := "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7)"
 
 	mockClient.shouldFail = false
-	err := SuspiciousLoginEmailSend(userEmail, userAgent)
+	err := SuspiciousLoginEmailSend(i18n.En, userEmail, userAgent)
 	if err != nil {
 		t.Errorf("Unexpected error in SuspiciousLoginEmailSend: %v", err)
 	}
 
-	err = SuspiciousLoginEmailSend("", userAgent)
+	err = SuspiciousLoginEmailSend(i18n.En, "", userAgent)
 	if err != nil {
 		t.Errorf("Should handle empty user email gracefully: %v", err)
 	}
 
-	err = SuspiciousLoginEmailSend(userEmail, "")
+	err = SuspiciousLoginEmailSend(i18n.En, userEmail, "")
 	if err != nil {
 		t.Errorf("Should handle empty user agent gracefully: %v", err)
 	}
 }
 
 func TestPasswordResetEmailSend(t *testing.T) {
-	originalSendMailFunc := sendMailFunc
-	defer func() { sendMailFunc = originalSendMailFunc }()
-	sendMailFunc = mockSendMail
+	defer mockMailDelivery()()
 	
 	os.Setenv("SERVER_EMAIL", "server@example.com")
 	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
@@ -281,26 +269,37 @@ func TestPasswordResetEmailSend(t *testing.T) {
 	resetLink := "https://example.com/reset?token=abc123"
 
 	mockClient.shouldFail = false
-	err := PasswordResetEmailSend(userEmail, resetLink)
+	alert := structs.SecurityAlert{
+		Event:      "passwordResetRequest",
+		OccurredAt: 1700000000,
+		IP:         "203.0.113.10",
+		UserAgent:  "Test Browser",
+		RevokeLink: "https://example.com/security/revoke?token=alert123",
+	}
+	err := PasswordResetEmailSend(i18n.En, userEmail, resetLink, alert)
 	if err != nil {
 		t.Errorf("Unexpected error in PasswordResetEmailSend: %v", err)
 	}
+	_, text, html := decodeMail(t, mockClient.sentMsg)
+	for _, want := range []string{resetLink, "203.0.113.10", "Test Browser", alert.RevokeLink} {
+		if !strings.Contains(text, want) || !strings.Contains(html, want) {
+			t.Errorf("Message should contain %s", want)
+		}
+	}
 
-	err = PasswordResetEmailSend("", resetLink)
+	err = PasswordResetEmailSend(i18n.En, "", resetLink, alert)
 	if err != nil {
 		t.Errorf("Should handle empty user email gracefully: %v", err)
 	}
 
-	err = PasswordResetEmailSend(userEmail, "")
+	err = PasswordResetEmailSend(i18n.En, userEmail, "", structs.SecurityAlert{})
 	if err != nil {
 		t.Errorf("Should handle empty reset link gracefully: %v", err)
 	}
 }
 
 func TestServerAuthCodeSend(t *testing.T) {
-	originalSendMailFunc := sendMailFunc
-	defer func() { sendMailFunc = originalSendMailFunc }()
-	sendMailFunc = mockSendMail
+	defer mockMailDelivery()()
 	
 	os.Setenv("SERVER_EMAIL", "server@example.com")
 	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
@@ -312,7 +311,7 @@ func TestServerAuthCodeSend(t *testing.T) {
 	userEmail := "user@example.com"
 
 	mockClient.shouldFail = false
-	code, err := ServerAuthCodeSend(userEmail)
+	code, err := ServerAuthCodeSend(i18n.En, userEmail)
 	if err != nil {
 		t.Errorf("Unexpected error in ServerAuthCodeSend: %v", err)
 	}
@@ -327,7 +326,7 @@ func TestServerAuthCodeSend(t *testing.T) {
 		}
 	}
 
-	_, err = ServerAuthCodeSend("")
+	_, err = ServerAuthCodeSend(i18n.En, "")
 	if err != nil {
 		t.Errorf("Should handle empty user email gracefully: %v", err)
 	}
@@ -343,6 +342,13 @@ func TestEmailSubjects(t *testing.T) {
 		{"SuspiciousLoginSubject", suspiciousLoginSubject, "Suspicious login alert!"},
 		{"NewDeviceLoginSubject", newDeviceLoginSubject, "New device login"},
 		{"PasswordResetSubject", passwordResetSubject, "Password reset request"},
+		{"EmailChangeSubject", emailChangeSubject, "Email address changed"},
+		{"PasswordChangeSubject", passwordChangeSubject, "Password changed"},
+		{"AccountDeletionSubject", accountDeletionSubject, "Account deletion request"},
+		{"SecurityDigestSubject", securityDigestSubject, "Weekly security digest"},
+		{"OAuthLinkSubject", oauthLinkSubject, "Sign-in method linked"},
+		{"SessionRevokeSubject", sessionRevokeSubject, "Sessions signed out"},
+		{"AccountLockSubject", accountLockSubject, "Account locked"},
 	}
 
 	for _, tt := range tests {
@@ -364,22 +370,22 @@ func TestErrorHandling(t *testing.T) {
 
 	userEmail := "user@example.com"
 
-	_, err := ServerAuthCodeSend(userEmail)
+	_, err := ServerAuthCodeSend(i18n.En, userEmail)
 	if err == nil {
 		t.Error("Expected error when SERVER_EMAIL is not set")
 	}
 
-	err = SendNewDeviceLoginEmail("testuser", userEmail, "Mozilla/5.0")
+	err = SendNewDeviceLoginEmail(i18n.En, "testuser", userEmail, "Mozilla/5.0")
 	if err == nil {
 		t.Error("Expected error when SERVER_EMAIL is not set")
 	}
 
-	err = SuspiciousLoginEmailSend(userEmail, "Mozilla/5.0")
+	err = SuspiciousLoginEmailSend(i18n.En, userEmail, "Mozilla/5.0")
 	if err == nil {
 		t.Error("Expected error when SERVER_EMAIL is not set")
 	}
 
-	err = PasswordResetEmailSend(userEmail, "https://example.com/reset")
+	err = PasswordResetEmailSend(i18n.En, userEmail, "https://example.com/reset", structs.SecurityAlert{})
 	if err == nil {
 		t.Error("Expected error when SERVER_EMAIL is not set")
 	}
@@ -428,13 +434,11 @@ func BenchmarkServerAuthCodeGenerate(b *testing.B) {
 }
 
 func BenchmarkExecuteTmpl(b *testing.B) {
-	serverEmail := "server@example.com"
-	userEmail := "user@example.com"
 	data := struct{ Code string }{Code: "1234"}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, _ = executeTmpl(serverEmail, userEmail, authCodeSubject, data)
+		_, _, _ = executeTmpl(i18n.En, authCodeSubject, data)
 	}
 }
 
@@ -444,7 +448,9 @@ func TestTemplateIntegration(t *testing.T) {
 		return
 	}
 
-	serverEmail := "server@example.com"
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "unsubscribe-secret")
 	userEmail := "user@example.com"
 
 	testCases := []struct {
@@ -473,58 +479,281 @@ func TestTemplateIntegration(t *testing.T) {
 		{
 			name:    "PasswordReset",
 			subject: passwordResetSubject,
-			data:    struct{ ResetLink string }{ResetLink: "https://example.com/reset"},
+			data: struct {
+				ResetLink string
+				Alert     structs.SecurityAlert
+			}{ResetLink: "https://example.com/reset"},
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			msg, err := executeTmpl(serverEmail, userEmail, tc.subject, tc.data)
-			if err != nil {
-				t.Fatalf("Failed to execute template %s: %v", tc.name, err)
+			mail, ok, err := newMail(i18n.En, userEmail, tc.subject, tc.data)
+			if err != nil || !ok {
+				t.Fatalf("Failed to build message %s: %v", tc.name, err)
 			}
 
-			msgStr := string(msg)
+			header, text, html := decodeMail(t, mail.Message)
 
-			requiredHeaders := []string{
-				"From: " + serverEmail,
-				"To: " + userEmail,
-				"Subject: " + tc.subject,
-				"MIME-Version: 1.0",
-				"Content-Type: text/html; charset=\"UTF-8\"",
+			requiredHeaders := map[string]string{
+				"From":         "server@example.com",
+				"To":           userEmail,
+				"Subject":      tc.subject,
+				"MIME-Version": "1.0",
+				"Message-ID":   "<" + mail.IdempotencyKey + "@example.com>",
 			}
-
-			for _, header := range requiredHeaders {
-				if !strings.Contains(msgStr, header) {
-					t.Errorf("Missing required header in %s: %s", tc.name, header)
+			for name, value := range requiredHeaders {
+				if header.Get(name) != value {
+					t.Errorf("Header %s in %s: expected %q, got %q", name, tc.name, value, header.Get(name))
 				}
 			}
+			if _, err := header.Date(); err != nil {
+				t.Errorf("Missing or invalid Date header in %s: %v", tc.name, err)
+			}
+			if _, optional := notificationSubjects[tc.subject]; optional != (header.Get("List-Unsubscribe") != "") {
+				t.Errorf("List-Unsubscribe header should be set only for optional notifications, %s", tc.name)
+			}
 
-			if !strings.Contains(msgStr, "\r\n\r\n") {
-				t.Errorf("Email body appears to be empty in %s", tc.name)
+			if text == "" || html == "" {
+				t.Errorf("Email text or html appears to be empty in %s", tc.name)
 			}
-			
+
 			switch tc.name {
 			case "AuthCode":
-				if !strings.Contains(msgStr, "1234") {
+				if !strings.Contains(text, "1234") || !strings.Contains(html, "1234") {
 					t.Errorf("Auth code 1234 not found in %s email body", tc.name)
 				}
 			case "SuspiciousLogin":
-				if !strings.Contains(msgStr, "Test Browser") {
+				if !strings.Contains(text, "Test Browser") || !strings.Contains(html, "Test Browser") {
 					t.Errorf("User-Agent Test Browser not found in %s email body", tc.name)
 				}
 			case "NewDeviceLogin":
-				if !strings.Contains(msgStr, "new device") {
+				if !strings.Contains(text, "new device") || !strings.Contains(html, "new device") {
 					t.Errorf("New device login information not found in %s email body", tc.name)
 				}
-				if !strings.Contains(msgStr, "login") {
+				if !strings.Contains(text, "login") {
 					t.Errorf("Login information not found in %s email body", tc.name)
 				}
 			case "PasswordReset":
-				if !strings.Contains(msgStr, "https://example.com/reset") {
+				if !strings.Contains(text, "https://example.com/reset") || !strings.Contains(html, "https://example.com/reset") {
 					t.Errorf("Reset link not found in %s email body", tc.name)
 				}
 			}
 		})
 	}
 }
+
+func TestEmailChangeNotificationSend(t *testing.T) {
+	defer mockMailDelivery()()
+
+	os.Setenv("SERVER_EMAIL", "server@example.com")
+	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
+	defer func() {
+		os.Unsetenv("SERVER_EMAIL")
+		os.Unsetenv("SERVER_EMAIL_PASSWORD")
+	}()
+
+	undoLink := "https://example.com/profile/email/undo?token=abc123"
+
+	mockClient.shouldFail = false
+	err := EmailChangeNotificationSend(i18n.En, "old@example.com", "new@example.com", undoLink, structs.SecurityAlert{})
+	if err != nil {
+		t.Errorf("Unexpected error in EmailChangeNotificationSend: %v", err)
+	}
+	if len(mockClient.sentTo) != 1 || mockClient.sentTo[0] != "old@example.com" {
+		t.Errorf("Notification should be sent to the previous email, got %v", mockClient.sentTo)
+	}
+	header, text, html := decodeMail(t, mockClient.sentMsg)
+	if header.Get("Subject") != emailChangeSubject {
+		t.Error("Message should contain email change subject")
+	}
+	if !strings.Contains(text, "new@example.com") || !strings.Contains(text, undoLink) || !strings.Contains(html, undoLink) {
+		t.Error("Message should contain the new email and the undo link")
+	}
+
+	err = EmailChangeNotificationSend(i18n.En, "", "new@example.com", undoLink, structs.SecurityAlert{})
+	if err != nil {
+		t.Errorf("Should handle empty previous email gracefully: %v", err)
+	}
+
+	// Смену администратора отменить по ссылке нельзя: блока отмены нет, указано, кто изменил
+	alert := structs.SecurityAlert{Event: "emailChange", OccurredAt: 1700000000, ByAdmin: true}
+	err = EmailChangeNotificationSend(i18n.En, "old@example.com", "new@example.com", "", alert)
+	if err != nil {
+		t.Errorf("Unexpected error in EmailChangeNotificationSend: %v", err)
+	}
+	_, text, html = decodeMail(t, mockClient.sentMsg)
+	undoText := i18n.Text(i18n.En, "mail.emailChange.undo")
+	if strings.Contains(text, undoText) || strings.Contains(html, undoText) {
+		t.Error("Message without undo link should not offer to undo the change")
+	}
+	byAdmin := i18n.Text(i18n.En, "mail.securityAlert.byAdmin")
+	if !strings.Contains(text, byAdmin) || !strings.Contains(html, byAdmin) {
+		t.Error("Message should say the change was made by an administrator")
+	}
+}
+
+func TestPasswordChangeNotificationSend(t *testing.T) {
+	defer mockMailDelivery()()
+
+	os.Setenv("SERVER_EMAIL", "server@example.com")
+	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
+	defer func() {
+		os.Unsetenv("SERVER_EMAIL")
+		os.Unsetenv("SERVER_EMAIL_PASSWORD")
+	}()
+
+	alert := structs.SecurityAlert{
+		Event:      "passwordChange",
+		OccurredAt: 1700000000,
+		IP:         "203.0.113.10",
+		UserAgent:  "Test Browser",
+		RevokeLink: "https://example.com/security/revoke?token=alert123",
+	}
+
+	mockClient.shouldFail = false
+	err := PasswordChangeNotificationSend(i18n.En, "user@example.com", alert)
+	if err != nil {
+		t.Errorf("Unexpected error in PasswordChangeNotificationSend: %v", err)
+	}
+	if len(mockClient.sentTo) != 1 || mockClient.sentTo[0] != "user@example.com" {
+		t.Errorf("Notification should be sent to the user email, got %v", mockClient.sentTo)
+	}
+	header, text, html := decodeMail(t, mockClient.sentMsg)
+	if header.Get("Subject") != passwordChangeSubject {
+		t.Error("Message should contain password change subject")
+	}
+	for _, want := range []string{"203.0.113.10", "Test Browser", alert.RevokeLink} {
+		if !strings.Contains(text, want) || !strings.Contains(html, want) {
+			t.Errorf("Message should contain %s", want)
+		}
+	}
+
+	err = PasswordChangeNotificationSend(i18n.En, "", alert)
+	if err != nil {
+		t.Errorf("Should handle empty email gracefully: %v", err)
+	}
+}
+
+func TestAccountDeletionLinkSend(t *testing.T) {
+	defer mockMailDelivery()()
+
+	os.Setenv("SERVER_EMAIL", "server@example.com")
+	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
+	defer func() {
+		os.Unsetenv("SERVER_EMAIL")
+		os.Unsetenv("SERVER_EMAIL_PASSWORD")
+	}()
+
+	deletionLink := "https://example.com/profile/delete/confirm?token=abc123"
+
+	mockClient.shouldFail = false
+	err := AccountDeletionLinkSend(i18n.En, "user@example.com", deletionLink)
+	if err != nil {
+		t.Errorf("Unexpected error in AccountDeletionLinkSend: %v", err)
+	}
+	if len(mockClient.sentTo) != 1 || mockClient.sentTo[0] != "user@example.com" {
+		t.Errorf("Link should be sent to the user email, got %v", mockClient.sentTo)
+	}
+	header, text, html := decodeMail(t, mockClient.sentMsg)
+	if header.Get("Subject") != accountDeletionSubject {
+		t.Error("Message should contain account deletion subject")
+	}
+	if !strings.Contains(text, deletionLink) || !strings.Contains(html, deletionLink) {
+		t.Error("Message should contain the deletion link")
+	}
+}
+
+func TestSecurityDigestSend(t *testing.T) {
+	defer mockMailDelivery()()
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "unsubscribe-secret")
+	t.Setenv("PUBLIC_BASE_URL", "https://auth.example.com")
+
+	os.Setenv("SERVER_EMAIL", "server@example.com")
+	os.Setenv("SERVER_EMAIL_PASSWORD", "password")
+	defer func() {
+		os.Unsetenv("SERVER_EMAIL")
+		os.Unsetenv("SERVER_EMAIL_PASSWORD")
+	}()
+
+	digest := structs.SecurityDigest{
+		Since:          1704067200,
+		Sessions:       []structs.ExportedSession{{UserAgent: "Mozilla/5.0 Digest", CreatedAt: 1704070800}},
+		ProfileChanges: []structs.ExportedProfileChange{{Field: "login", ChangedAt: 1704074400}},
+		SettingsLink:   "https://example.com/profile/notifications",
+	}
+
+	mockClient.shouldFail = false
+	err := SecurityDigestSend(i18n.En, "user@example.com", digest)
+	if err != nil {
+		t.Errorf("Unexpected error in SecurityDigestSend: %v", err)
+	}
+	if len(mockClient.sentTo) != 1 || mockClient.sentTo[0] != "user@example.com" {
+		t.Errorf("Digest should be sent to the user email, got %v", mockClient.sentTo)
+	}
+	header, text, html := decodeMail(t, mockClient.sentMsg)
+	if header.Get("Subject") != securityDigestSubject {
+		t.Error("Message should contain security digest subject")
+	}
+	if !strings.HasPrefix(header.Get("List-Unsubscribe"), "<https://auth.example.com/unsubscribe?token=") {
+		t.Errorf("Digest should contain one-click List-Unsubscribe link, got %q", header.Get("List-Unsubscribe"))
+	}
+	for _, part := range []string{text, html} {
+		if !strings.Contains(part, "Mozilla/5.0 Digest") || !strings.Contains(part, "2024-01-01 01:00:00 UTC") || !strings.Contains(part, digest.SettingsLink) {
+			t.Errorf("Message should contain sessions, times and settings link, got %s", part)
+		}
+	}
+}
+
+func TestSecurityAlertSend(t *testing.T) {
+	alert := structs.SecurityAlert{
+		OccurredAt: 1704067200,
+		IP:         "203.0.113.10",
+		UserAgent:  "Test Browser",
+		RevokeLink: "https://example.com/security/revoke?token=alert123",
+	}
+
+	tests := []struct {
+		name    string
+		send    func(locale, email string, alert structs.SecurityAlert) error
+		event   string
+		subject string
+	}{
+		{"OAuthLink", OAuthLinkNotificationSend, "oauthLink", oauthLinkSubject},
+		{"SessionRevoke", SessionRevokeNotificationSend, "sessionRevoke", sessionRevokeSubject},
+		{"AccountLock", AccountLockNotificationSend, "accountLock", accountLockSubject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer mockMailDelivery()()
+			t.Setenv("SERVER_EMAIL", "server@example.com")
+
+			alert.Event = tt.event
+			if err := tt.send(i18n.Ru, "user@example.com", alert); err != nil {
+				t.Fatalf("Unexpected error in %s: %v", tt.name, err)
+			}
+
+			header, text, html := decodeMail(t, mockClient.sentMsg)
+			subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+			if err != nil || subject != i18n.Text(i18n.Ru, "mail."+tt.event+".subject") {
+				t.Errorf("Subject should be localized, got %q", header.Get("Subject"))
+			}
+			if header.Get("List-Unsubscribe") != "" {
+				t.Error("Security alert cannot be turned off and should not contain List-Unsubscribe header")
+			}
+			for _, want := range []string{
+				i18n.Text(i18n.Ru, "mail."+tt.event+".text"),
+				"2024-01-01 00:00:00 UTC",
+				"203.0.113.10",
+				"Test Browser",
+				alert.RevokeLink,
+			} {
+				if !strings.Contains(text, want) || !strings.Contains(html, want) {
+					t.Errorf("Message should contain %s", want)
+				}
+			}
+		})
+	}
+}
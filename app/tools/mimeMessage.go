@@ -0,0 +1,126 @@
+// Package tools предоставляет функции для валидации данных, геренации токенов и отправки email-уведомлений.
+//
+// Файл содержит сборку письма в формате MIME:
+//   - mimeMessage: заголовки и текстовая и HTML-версии письма
+//   - mimeMessage.bytes: собирает письмо multipart/alternative
+//
+// Заголовки с не-ASCII символами кодируются по RFC 2047, части письма - quoted-printable.
+// Значения заголовков с CR или LF отклоняются, чтобы данные пользователя не могли
+// добавить в письмо свои заголовки.
+package tools
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrHeaderInjection возвращается, если значение заголовка письма содержит CR или LF.
+var ErrHeaderInjection = errors.New("mail header value contains CR or LF")
+
+// mimeMessage описывает письмо.
+//
+// ListUnsubscribe - ссылка одношаговой отписки (RFC 8058) для заголовков List-Unsubscribe
+// и List-Unsubscribe-Post; пустое значение означает, что заголовки не нужны
+// (письма с кодами и ссылками для входа и критичные уведомления).
+type mimeMessage struct {
+	from            string
+	to              string
+	subject         string
+	date            time.Time
+	messageId       string
+	listUnsubscribe string
+	text            string
+	html            string
+}
+
+// bytes собирает письмо multipart/alternative с текстовой и HTML-частями.
+//
+// Возвращает ErrHeaderInjection, если значение заголовка содержит CR или LF,
+// и ошибку, если адрес отправителя или получателя некорректен.
+func (m mimeMessage) bytes() ([]byte, error) {
+	for _, value := range []string{m.from, m.to, m.subject, m.messageId, m.listUnsubscribe} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errors.WithStack(ErrHeaderInjection)
+		}
+	}
+
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	to, err := mail.ParseAddress(m.to)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=UTF-8", m.text},
+		{"text/html; charset=UTF-8", m.html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Закодированная тема и параметр boundary переносятся на следующие строки,
+	// чтобы строки заголовков не превышали 78 символов.
+	var msg bytes.Buffer
+	header := func(name, value string) {
+		if !strings.HasPrefix(value, "\r\n") {
+			value = " " + value
+		}
+		msg.WriteString(name + ":" + value + "\r\n")
+	}
+	header("From", formatAddress(from))
+	header("To", formatAddress(to))
+	subject := mime.QEncoding.Encode("UTF-8", m.subject)
+	if subject != m.subject {
+		subject = "\r\n " + strings.ReplaceAll(subject, "?= =?", "?=\r\n =?")
+	}
+	header("Subject", subject)
+	header("Date", m.date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+m.messageId+">")
+	if m.listUnsubscribe != "" {
+		header("List-Unsubscribe", "<"+m.listUnsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", strings.Replace(mime.FormatMediaType("multipart/alternative", map[string]string{"boundary": parts.Boundary()}), "; ", ";\r\n ", 1))
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes(), nil
+}
+
+// formatAddress возвращает адрес без угловых скобок, если у него нет имени,
+// иначе имя в кодировке RFC 2047 и адрес в угловых скобках.
+func formatAddress(address *mail.Address) string {
+	if address.Name == "" {
+		return address.Address
+	}
+	return address.String()
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeMail разбирает письмо multipart/alternative и возвращает заголовки
+// и декодированные текстовую и HTML-части.
+func decodeMail(t *testing.T, msg []byte) (mail.Header, string, string) {
+	t.Helper()
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	require.NoError(t, err)
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	parts := map[string]string{}
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "quoted-printable", part.Header.Get("Content-Transfer-Encoding"))
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		parts[part.Header.Get("Content-Type")] = string(content)
+	}
+	require.Len(t, parts, 2)
+	return parsed.Header, parts["text/plain; charset=UTF-8"], parts["text/html; charset=UTF-8"]
+}
+
+// TestMimeMessageBytes проверяет сборку письма.
+// Ожидается: письмо с заголовками From, To, Date, Message-ID, MIME-Version,
+// темой в кодировке RFC 2047 и двумя частями quoted-printable.
+func TestMimeMessageBytes(t *testing.T) {
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	longLink := "https://example.com/reset?token=" + strings.Repeat("a", 200)
+	message := mimeMessage{
+		from:      "server@example.com",
+		to:        "user@example.com",
+		subject:   "Сброс пароля",
+		date:      date,
+		messageId: "key1@example.com",
+		text:      "Reset: " + longLink + "\n",
+		html:      "<p>Привет</p>\n<a href=\"" + longLink + "\">Reset</a>\n",
+	}
+
+	msg, err := message.bytes()
+	require.NoError(t, err)
+	assert.NotContains(t, strings.ReplaceAll(string(msg), "\r\n", ""), "\n", "all lines should end with CRLF")
+	for _, line := range strings.Split(string(msg), "\r\n") {
+		assert.LessOrEqual(t, len(line), 78)
+	}
+
+	header, text, html := decodeMail(t, msg)
+	assert.Equal(t, "server@example.com", header.Get("From"))
+	assert.Equal(t, "user@example.com", header.Get("To"))
+	assert.True(t, strings.HasPrefix(header.Get("Subject"), "=?UTF-8?q?"))
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	require.NoError(t, err)
+	assert.Equal(t, "Сброс пароля", subject)
+	assert.Equal(t, "<key1@example.com>", header.Get("Message-ID"))
+	assert.Equal(t, "1.0", header.Get("MIME-Version"))
+	parsedDate, err := header.Date()
+	require.NoError(t, err)
+	assert.True(t, date.Equal(parsedDate))
+	assert.Empty(t, header.Get("List-Unsubscribe"))
+	assert.Equal(t, "Reset: "+longLink+"\r\n", text)
+	assert.Equal(t, "<p>Привет</p>\r\n<a href=\""+longLink+"\">Reset</a>\r\n", html)
+
+	message.subject = "Password changed"
+	message.listUnsubscribe = "https://example.com/unsubscribe?token=abc"
+	msg, err = message.bytes()
+	require.NoError(t, err)
+	header, _, _ = decodeMail(t, msg)
+	assert.Equal(t, "Password changed", header.Get("Subject"))
+	assert.Equal(t, "<https://example.com/unsubscribe?token=abc>", header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", header.Get("List-Unsubscribe-Post"))
+}
+
+// TestMimeMessageBytesHeaderInjection проверяет защиту от внедрения заголовков.
+// Ожидается: CR или LF в любом заголовке и некорректный адрес отклоняются.
+func TestMimeMessageBytesHeaderInjection(t *testing.T) {
+	valid := mimeMessage{from: "server@example.com", to: "user@example.com", subject: "Subject", messageId: "key1@example.com"}
+	_, err := valid.bytes()
+	require.NoError(t, err)
+
+	injections := map[string]func(m *mimeMessage){
+		"from":            func(m *mimeMessage) { m.from = "server@example.com\r\nBcc: victim@example.com" },
+		"to":              func(m *mimeMessage) { m.to = "user@example.com\nBcc: victim@example.com" },
+		"subject":         func(m *mimeMessage) { m.subject = "Subject\rBcc: victim@example.com" },
+		"messageId":       func(m *mimeMessage) { m.messageId = "key1@example.com\r\nX-Injected: 1" },
+		"listUnsubscribe": func(m *mimeMessage) { m.listUnsubscribe = "mailto:a@example.com\r\nX-Injected: 1" },
+	}
+	for name, inject := range injections {
+		t.Run(name, func(t *testing.T) {
+			message := valid
+			inject(&message)
+			_, err := message.bytes()
+			assert.ErrorIs(t, err, ErrHeaderInjection)
+		})
+	}
+
+	message := valid
+	message.to = "not an address"
+	_, err = message.bytes()
+	assert.Error(t, err)
+}
@@ -0,0 +1,195 @@
+// Package tools предоставляет функции для валидации данных, геренации токенов и отправки email-уведомлений.
+//
+// Файл содержит очередь исходящих писем:
+//   - enqueueMail: сохраняет письмо в очередь (таблица mail_outbox)
+//   - sendMailWithTimeout: отправляет письмо сразу, ограничивая время ожидания
+//   - ProcessMailOutbox: отправляет письма из очереди с повторами и экспоненциальной задержкой
+//
+// Письма получают хеш содержимого, ключ идемпотентности и заголовок Message-ID на его основе:
+// одинаковое письмо на тот же адрес в течение mailIdempotencyWindow после предыдущего
+// ставится в очередь один раз, а повторно доставленное письмо почтовые клиенты
+// распознают как дубликат.
+package tools
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mailIdempotencyWindow - сколько секунд после письма такое же письмо считается дубликатом.
+	mailIdempotencyWindow = 10 * 60
+	// mailOutboxBatch - сколько писем обработчик выбирает из очереди за раз.
+	mailOutboxBatch = 10
+	// mailOutboxLease - на сколько секунд выбранные письма закрепляются за обработчиком.
+	mailOutboxLease = 10 * 60
+	// mailRetryBaseDelay и mailRetryMaxDelay - первая и наибольшая задержка перед повтором в секундах.
+	mailRetryBaseDelay = 60
+	mailRetryMaxDelay  = 6 * 60 * 60
+)
+
+// mailMaxAttempts возвращает число попыток отправки, после которого письмо переводится в dead.
+//
+// Использует переменную окружения MAIL_MAX_ATTEMPTS (по умолчанию 8).
+func mailMaxAttempts() int {
+	if value, err := strconv.Atoi(os.Getenv("MAIL_MAX_ATTEMPTS")); err == nil && value > 0 {
+		return value
+	}
+	return 8
+}
+
+// mailSyncTimeout возвращает время ожидания немедленной отправки.
+//
+// Использует переменную окружения MAIL_SYNC_TIMEOUT в секундах (по умолчанию 10).
+func mailSyncTimeout() time.Duration {
+	if value, err := strconv.Atoi(os.Getenv("MAIL_SYNC_TIMEOUT")); err == nil && value > 0 {
+		return time.Duration(value) * time.Second
+	}
+	return 10 * time.Second
+}
+
+// mailRetryDelay возвращает задержку в секундах перед попыткой после attempts неудачных:
+// 1, 2, 4 ... минуты, но не больше mailRetryMaxDelay.
+func mailRetryDelay(attempts int) int64 {
+	delay := int64(mailRetryBaseDelay)
+	for i := 1; i < attempts && delay < mailRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > mailRetryMaxDelay {
+		delay = mailRetryMaxDelay
+	}
+	return delay
+}
+
+// newOutboxMail собирает письмо для очереди с хешем содержимого и ключом идемпотентности.
+//
+// Хеш вычисляется по получателю, теме и версиям письма, ключ - по хешу и now;
+// ключ используется в заголовке Message-ID. Непустая ссылка listUnsubscribe
+// добавляется в заголовок List-Unsubscribe.
+func newOutboxMail(serverEmail, userEmail, emailSubject, text, html, listUnsubscribe string, now int64) (structs.OutboxMail, error) {
+	contentHash := mailHash(userEmail, emailSubject, text, html)
+	idempotencyKey := mailHash(contentHash, strconv.FormatInt(now, 10))
+
+	message := mimeMessage{
+		from:            serverEmail,
+		to:              userEmail,
+		subject:         emailSubject,
+		date:            time.Unix(now, 0),
+		messageId:       idempotencyKey + "@" + serverEmail[strings.LastIndex(serverEmail, "@")+1:],
+		listUnsubscribe: listUnsubscribe,
+		text:            text,
+		html:            html,
+	}
+	msg, err := message.bytes()
+	if err != nil {
+		return structs.OutboxMail{}, errors.WithStack(err)
+	}
+
+	return structs.OutboxMail{
+		IdempotencyKey: idempotencyKey,
+		ContentHash:    contentHash,
+		Sender:         serverEmail,
+		Recipient:      userEmail,
+		Subject:        emailSubject,
+		Message:        msg,
+		CreatedAt:      now,
+	}, nil
+}
+
+// mailHash возвращает шестнадцатеричный SHA-256 частей, разделенных нулевым байтом.
+func mailHash(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// enqueueMail сохраняет письмо в очередь; его отправит ProcessMailOutbox.
+//
+// Письмо не добавляется, если такое же было поставлено в очередь за последние mailIdempotencyWindow секунд.
+var enqueueMail = func(mail structs.OutboxMail) error {
+	if err := data.SetOutboxMailInDb(mail, mail.CreatedAt-mailIdempotencyWindow); err != nil {
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// sendMailWithTimeout отправляет письмо сразу и ждет результата не дольше timeout.
+//
+// По истечении timeout возвращает ошибку, но начатая отправка не прерывается
+// и письмо может быть доставлено позже.
+func sendMailWithTimeout(mail structs.OutboxMail, timeout time.Duration) error {
+	mailer, err := newMailer()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- mailer.Send(mail.Sender, []string{mail.Recipient}, mail.Message)
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return nil
+	case <-time.After(timeout):
+		return errors.Errorf("mail send timed out after %s", timeout)
+	}
+}
+
+// ProcessMailOutbox отправляет письма из очереди, время отправки которых наступило к now.
+//
+// Выбирает не более mailOutboxBatch писем. Неудачная попытка откладывает письмо
+// на mailRetryDelay, после mailMaxAttempts попыток письмо переводится в dead и больше
+// не отправляется. Безопасно вызывается из нескольких горутин и процессов.
+// Возвращает количество отправленных и неотправленных писем.
+var ProcessMailOutbox = func(now int64) (int, int, error) {
+	mailer, err := newMailer()
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	mails, err := data.ClaimOutboxMailsFromDb(now, now+mailOutboxLease, mailOutboxBatch)
+	if err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+
+	sent, failed := 0, 0
+	maxAttempts := mailMaxAttempts()
+	for _, mail := range mails {
+		attempts := mail.Attempts + 1
+		sendErr := mailer.Send(mail.Sender, []string{mail.Recipient}, mail.Message)
+		if sendErr == nil {
+			if err := data.SetOutboxMailSentInDb(mail.IdempotencyKey, attempts, time.Now().Unix()); err != nil {
+				return sent, failed, errors.WithStack(err)
+			}
+			sent++
+			continue
+		}
+
+		failed++
+		status, nextAttemptAt := data.OutboxStatusPending, now+mailRetryDelay(attempts)
+		if attempts >= maxAttempts {
+			status = data.OutboxStatusDead
+			log.Printf("mail %s to %s is dead after %d attempts: %v", mail.IdempotencyKey, mail.Recipient, attempts, sendErr)
+		}
+		if err := data.SetOutboxMailFailedInDb(mail.IdempotencyKey, status, attempts, nextAttemptAt, sendErr.Error()); err != nil {
+			return sent, failed, errors.WithStack(err)
+		}
+	}
+	return sent, failed, nil
+}
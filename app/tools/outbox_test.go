@@ -0,0 +1,272 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gimaevra94/auth/app/data"
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/gimaevra94/auth/app/structs"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingMailer не завершает отправку, пока не закрыт канал release.
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m blockingMailer) Send(from string, to []string, msg []byte) error {
+	<-m.release
+	return nil
+}
+
+// TestMailRetryDelay проверяет экспоненциальную задержку перед повтором.
+// Ожидается: 1, 2, 4 минуты и т.д., но не больше mailRetryMaxDelay.
+func TestMailRetryDelay(t *testing.T) {
+	assert.Equal(t, int64(60), mailRetryDelay(1))
+	assert.Equal(t, int64(120), mailRetryDelay(2))
+	assert.Equal(t, int64(480), mailRetryDelay(4))
+	assert.Equal(t, int64(mailRetryMaxDelay), mailRetryDelay(10))
+	assert.Equal(t, int64(mailRetryMaxDelay), mailRetryDelay(1000))
+}
+
+// TestMailOutboxSettings проверяет настройки очереди из окружения.
+// Ожидается: значения по умолчанию для пустых и некорректных переменных.
+func TestMailOutboxSettings(t *testing.T) {
+	t.Setenv("MAIL_MAX_ATTEMPTS", "")
+	t.Setenv("MAIL_SYNC_TIMEOUT", "")
+	assert.Equal(t, 8, mailMaxAttempts())
+	assert.Equal(t, 10*time.Second, mailSyncTimeout())
+
+	t.Setenv("MAIL_MAX_ATTEMPTS", "3")
+	t.Setenv("MAIL_SYNC_TIMEOUT", "2")
+	assert.Equal(t, 3, mailMaxAttempts())
+	assert.Equal(t, 2*time.Second, mailSyncTimeout())
+
+	t.Setenv("MAIL_MAX_ATTEMPTS", "0")
+	t.Setenv("MAIL_SYNC_TIMEOUT", "soon")
+	assert.Equal(t, 8, mailMaxAttempts())
+	assert.Equal(t, 10*time.Second, mailSyncTimeout())
+}
+
+// TestNewOutboxMail проверяет хеш содержимого и ключ идемпотентности письма.
+// Ожидается: одинаковое письмо получает один хеш в любое время, другое письмо - другой хеш;
+// ключ зависит от времени и используется в Message-ID, дата - время постановки в очередь.
+func TestNewOutboxMail(t *testing.T) {
+	now := int64(mailIdempotencyWindow * 100)
+	newTestMail := func(userEmail, emailSubject, text string, now int64) structs.OutboxMail {
+		mail, err := newOutboxMail("server@example.com", userEmail, emailSubject, text, "<p>"+text+"</p>", "", now)
+		require.NoError(t, err)
+		return mail
+	}
+	mail := newTestMail("user@example.com", authCodeSubject, "body", now)
+
+	assert.Len(t, mail.IdempotencyKey, 64)
+	assert.Len(t, mail.ContentHash, 64)
+	assert.Equal(t, "server@example.com", mail.Sender)
+	assert.Equal(t, "user@example.com", mail.Recipient)
+	assert.Equal(t, authCodeSubject, mail.Subject)
+	assert.Equal(t, now, mail.CreatedAt)
+	header, text, html := decodeMail(t, mail.Message)
+	assert.Equal(t, "<"+mail.IdempotencyKey+"@example.com>", header.Get("Message-ID"))
+	date, err := header.Date()
+	require.NoError(t, err)
+	assert.Equal(t, now, date.Unix())
+	assert.Equal(t, "body", text)
+	assert.Equal(t, "<p>body</p>", html)
+
+	same := newTestMail("user@example.com", authCodeSubject, "body", now+1)
+	assert.Equal(t, mail.ContentHash, same.ContentHash)
+	assert.NotEqual(t, mail.IdempotencyKey, same.IdempotencyKey)
+
+	for _, other := range []structs.OutboxMail{
+		newTestMail("other@example.com", authCodeSubject, "body", now),
+		newTestMail("user@example.com", passwordResetSubject, "body", now),
+		newTestMail("user@example.com", authCodeSubject, "other body", now),
+	} {
+		assert.NotEqual(t, mail.ContentHash, other.ContentHash)
+		assert.NotEqual(t, mail.IdempotencyKey, other.IdempotencyKey)
+	}
+
+	_, err = newOutboxMail("server@example.com", "user@example.com\r\nBcc: victim@example.com", authCodeSubject, "body", "", "", now)
+	assert.ErrorIs(t, err, ErrHeaderInjection)
+}
+
+// TestNewOutboxMailListUnsubscribe проверяет заголовки отписки.
+// Ожидается: непустая ссылка попадает в List-Unsubscribe вместе с List-Unsubscribe-Post,
+// без ссылки заголовков нет; ссылка не меняет хеш содержимого.
+func TestNewOutboxMailListUnsubscribe(t *testing.T) {
+	mail, err := newOutboxMail("server@example.com", "user@example.com", newDeviceLoginSubject, "body", "", "https://example.com/unsubscribe?token=abc", 100)
+	require.NoError(t, err)
+	header, _, _ := decodeMail(t, mail.Message)
+	assert.Equal(t, "<https://example.com/unsubscribe?token=abc>", header.Get("List-Unsubscribe"))
+	assert.Equal(t, "List-Unsubscribe=One-Click", header.Get("List-Unsubscribe-Post"))
+
+	plain, err := newOutboxMail("server@example.com", "user@example.com", newDeviceLoginSubject, "body", "", "", 100)
+	require.NoError(t, err)
+	header, _, _ = decodeMail(t, plain.Message)
+	assert.Empty(t, header.Get("List-Unsubscribe"))
+	assert.Empty(t, header.Get("List-Unsubscribe-Post"))
+	assert.Equal(t, mail.ContentHash, plain.ContentHash)
+}
+
+// TestEnqueueMail проверяет постановку письма в очередь.
+// Ожидается: дубликаты ищутся за последние mailIdempotencyWindow секунд до постановки.
+func TestEnqueueMail(t *testing.T) {
+	originalSet := data.SetOutboxMailInDb
+	defer func() { data.SetOutboxMailInDb = originalSet }()
+	mail, err := newOutboxMail("server@example.com", "user@example.com", authCodeSubject, "body", "", "", 1000)
+	require.NoError(t, err)
+
+	var gotSince int64
+	data.SetOutboxMailInDb = func(got structs.OutboxMail, since int64) error {
+		assert.Equal(t, mail, got)
+		gotSince = since
+		return nil
+	}
+	require.NoError(t, enqueueMail(mail))
+	assert.Equal(t, int64(1000-mailIdempotencyWindow), gotSince)
+
+	data.SetOutboxMailInDb = func(structs.OutboxMail, int64) error { return errors.New("db is down") }
+	assert.Error(t, enqueueMail(mail))
+}
+
+// TestSendMailWithTimeout проверяет немедленную отправку с ограничением времени.
+// Ожидается: ошибка отправщика возвращается, зависшая отправка прерывается по timeout.
+func TestSendMailWithTimeout(t *testing.T) {
+	originalNewMailer := newMailer
+	defer func() { newMailer = originalNewMailer }()
+	mail, err := newOutboxMail("server@example.com", "user@example.com", authCodeSubject, "body", "", "", 100)
+	require.NoError(t, err)
+
+	newMailer = mockNewMailer
+	mockClient.shouldFail = false
+	assert.NoError(t, sendMailWithTimeout(mail, time.Second))
+	assert.Equal(t, []string{"user@example.com"}, mockClient.sentTo)
+
+	mockClient.shouldFail = true
+	assert.Error(t, sendMailWithTimeout(mail, time.Second))
+	mockClient.shouldFail = false
+
+	release := make(chan struct{})
+	defer close(release)
+	newMailer = func() (Mailer, error) { return blockingMailer{release: release}, nil }
+	err = sendMailWithTimeout(mail, 10*time.Millisecond)
+	assert.ErrorContains(t, err, "timed out")
+}
+
+// TestServerAuthCodeSendFallback проверяет отправку кода при недоступном почтовом сервере.
+// Ожидается: код возвращается без ошибки, письмо с кодом ставится в очередь.
+func TestServerAuthCodeSendFallback(t *testing.T) {
+	originalNewMailer := newMailer
+	originalEnqueueMail := enqueueMail
+	defer func() {
+		newMailer = originalNewMailer
+		enqueueMail = originalEnqueueMail
+	}()
+	t.Setenv("SERVER_EMAIL", "server@example.com")
+
+	newMailer = func() (Mailer, error) { return nil, errors.New("smtp is down") }
+	var queued []structs.OutboxMail
+	enqueueMail = func(mail structs.OutboxMail) error {
+		queued = append(queued, mail)
+		return nil
+	}
+
+	code, err := ServerAuthCodeSend(i18n.En, "user@example.com")
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	assert.Equal(t, "user@example.com", queued[0].Recipient)
+	assert.Contains(t, string(queued[0].Message), code)
+
+	enqueueMail = func(mail structs.OutboxMail) error { return errors.New("db is down") }
+	_, err = ServerAuthCodeSend(i18n.En, "user@example.com")
+	assert.Error(t, err)
+}
+
+// TestProcessMailOutbox проверяет обработку очереди писем.
+// Ожидается: отправленное письмо отмечается sent, неотправленное откладывается
+// с экспоненциальной задержкой, после последней попытки переводится в dead.
+func TestProcessMailOutbox(t *testing.T) {
+	originalNewMailer := newMailer
+	originalClaim := data.ClaimOutboxMailsFromDb
+	originalSent := data.SetOutboxMailSentInDb
+	originalFailed := data.SetOutboxMailFailedInDb
+	defer func() {
+		newMailer = originalNewMailer
+		data.ClaimOutboxMailsFromDb = originalClaim
+		data.SetOutboxMailSentInDb = originalSent
+		data.SetOutboxMailFailedInDb = originalFailed
+	}()
+	t.Setenv("MAIL_MAX_ATTEMPTS", "3")
+
+	var sentTo []string
+	newMailer = func() (Mailer, error) {
+		return mailerFunc(func(from string, to []string, msg []byte) error {
+			if strings.HasPrefix(to[0], "down") {
+				return errors.New("mailbox unavailable")
+			}
+			sentTo = append(sentTo, to[0])
+			return nil
+		}), nil
+	}
+
+	const now = int64(1000)
+	data.ClaimOutboxMailsFromDb = func(claimNow, lockedUntil int64, limit int) ([]structs.OutboxMail, error) {
+		assert.Equal(t, now, claimNow)
+		assert.Equal(t, now+mailOutboxLease, lockedUntil)
+		assert.Equal(t, mailOutboxBatch, limit)
+		return []structs.OutboxMail{
+			{IdempotencyKey: "key1", Recipient: "user@example.com", Attempts: 1},
+			{IdempotencyKey: "key2", Recipient: "down@example.com", Attempts: 1},
+			{IdempotencyKey: "key3", Recipient: "down2@example.com", Attempts: 2},
+		}, nil
+	}
+
+	type failure struct {
+		status        string
+		attempts      int
+		nextAttemptAt int64
+		lastError     string
+	}
+	sent := map[string]int{}
+	failures := map[string]failure{}
+	data.SetOutboxMailSentInDb = func(key string, attempts int, sentAt int64) error {
+		sent[key] = attempts
+		return nil
+	}
+	data.SetOutboxMailFailedInDb = func(key, status string, attempts int, nextAttemptAt int64, lastError string) error {
+		failures[key] = failure{status, attempts, nextAttemptAt, lastError}
+		return nil
+	}
+
+	sentCount, failedCount, err := ProcessMailOutbox(now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, sentCount)
+	assert.Equal(t, 2, failedCount)
+	assert.Equal(t, []string{"user@example.com"}, sentTo)
+	assert.Equal(t, map[string]int{"key1": 2}, sent)
+	assert.Equal(t, failure{data.OutboxStatusPending, 2, now + 120, "mailbox unavailable"}, failures["key2"])
+	assert.Equal(t, data.OutboxStatusDead, failures["key3"].status)
+	assert.Equal(t, 3, failures["key3"].attempts)
+
+	data.ClaimOutboxMailsFromDb = func(claimNow, lockedUntil int64, limit int) ([]structs.OutboxMail, error) {
+		return nil, errors.New("db is down")
+	}
+	_, _, err = ProcessMailOutbox(now)
+	assert.Error(t, err)
+
+	newMailer = func() (Mailer, error) { return nil, errors.New("unknown MAIL_DRIVER") }
+	_, _, err = ProcessMailOutbox(now)
+	assert.Error(t, err)
+}
+
+// mailerFunc позволяет использовать функцию как Mailer.
+type mailerFunc func(from string, to []string, msg []byte) error
+
+func (f mailerFunc) Send(from string, to []string, msg []byte) error {
+	return f(from, to, msg)
+}
@@ -0,0 +1,197 @@
+// Package tools предоставляет функции для валидации данных, геренации токенов и отправки email-уведомлений.
+//
+// Файл содержит отправку кодов подтверждения в SMS:
+//   - SMSSender: интерфейс отправки SMS
+//   - httpSMSSender: отправляет SMS через HTTP-шлюз
+//   - logSMSSender: выводит SMS в лог (для разработки)
+//   - FakeSMSSender: запоминает отправленные SMS (для тестов)
+//   - newSMSSender: выбирает способ отправки по переменной окружения SMS_DRIVER
+//   - SMSEnabled: проверяет, настроена ли отправка SMS
+//   - ServerAuthCodeSMSSend: отправляет код аутентификации сервера в SMS
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/pkg/errors"
+)
+
+// Способы отправки SMS (значения SMS_DRIVER).
+const (
+	smsDriverHTTP = "http"
+	smsDriverLog  = "log"
+)
+
+// smsTimeout ограничивает время запроса к SMS-шлюзу.
+const smsTimeout = 10 * time.Second
+
+// SMSSender отправляет SMS с текстом text на номер phone в формате E.164.
+type SMSSender interface {
+	Send(phone, text string) error
+}
+
+// SMSEnabled проверяет, настроена ли отправка SMS.
+//
+// Без SMS_DRIVER номер телефона нельзя подтвердить, и коды отправляются только на email.
+func SMSEnabled() bool {
+	return os.Getenv("SMS_DRIVER") != ""
+}
+
+// newSMSSender создает способ отправки SMS.
+//
+// Использует переменные окружения:
+//   - SMS_DRIVER: http или log
+//   - SMS_GATEWAY_URL, SMS_GATEWAY_TOKEN, SMS_SENDER: параметры http (см. newHTTPSMSSender)
+//
+// Возвращает ошибку, если отправка SMS не настроена или способ неизвестен.
+var newSMSSender = func() (SMSSender, error) {
+	switch driver := os.Getenv("SMS_DRIVER"); driver {
+	case smsDriverHTTP:
+		return newHTTPSMSSender()
+	case smsDriverLog:
+		return logSMSSender{}, nil
+	case "":
+		return nil, errors.New("SMS_DRIVER environment variable is not set")
+	default:
+		return nil, errors.Errorf("unknown SMS_DRIVER %q", driver)
+	}
+}
+
+// httpSMSSender отправляет SMS через HTTP-шлюз.
+type httpSMSSender struct {
+	url    string
+	token  string
+	sender string
+	client *http.Client
+}
+
+// smsGatewayRequest - тело запроса к SMS-шлюзу.
+type smsGatewayRequest struct {
+	To   string `json:"to"`
+	From string `json:"from,omitempty"`
+	Text string `json:"text"`
+}
+
+// newHTTPSMSSender загружает параметры SMS-шлюза.
+//
+// Использует переменные окружения:
+//   - SMS_GATEWAY_URL: адрес, на который отправляется POST-запрос (обязательно)
+//   - SMS_GATEWAY_TOKEN: токен для заголовка Authorization: Bearer (необязательно)
+//   - SMS_SENDER: имя или номер отправителя (необязательно)
+func newHTTPSMSSender() (httpSMSSender, error) {
+	sender := httpSMSSender{
+		url:    os.Getenv("SMS_GATEWAY_URL"),
+		token:  os.Getenv("SMS_GATEWAY_TOKEN"),
+		sender: os.Getenv("SMS_SENDER"),
+		client: &http.Client{Timeout: smsTimeout},
+	}
+	if sender.url == "" {
+		return httpSMSSender{}, errors.New("SMS_GATEWAY_URL environment variable is not set")
+	}
+	return sender, nil
+}
+
+// Send отправляет SMS POST-запросом с JSON {"to", "from", "text"}.
+//
+// Ответ с кодом не из диапазона 2xx считается ошибкой, начало тела ответа
+// добавляется в текст ошибки.
+func (s httpSMSSender) Send(phone, text string) error {
+	body, err := json.Marshal(smsGatewayRequest{To: phone, From: s.sender, Text: text})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return errors.Errorf("SMS gateway responded %s: %s", resp.Status, respBody)
+	}
+	return nil
+}
+
+// logSMSSender выводит SMS в лог вместо отправки.
+//
+// SMS содержат коды подтверждения, поэтому использовать его можно только при разработке.
+type logSMSSender struct{}
+
+// Send выводит номер и текст SMS в лог.
+func (logSMSSender) Send(phone, text string) error {
+	log.Printf("SMS to %s: %s", phone, text)
+	return nil
+}
+
+// SMS - сообщение, запомненное FakeSMSSender.
+type SMS struct {
+	Phone string
+	Text  string
+}
+
+// FakeSMSSender запоминает SMS вместо отправки, чтобы тесты могли проверить их.
+//
+// Если задано Err, Send возвращает эту ошибку и сообщение не запоминается.
+type FakeSMSSender struct {
+	Err error
+
+	mu   sync.Mutex
+	sent []SMS
+}
+
+// Send запоминает SMS.
+func (s *FakeSMSSender) Send(phone, text string) error {
+	if s.Err != nil {
+		return s.Err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, SMS{Phone: phone, Text: text})
+	return nil
+}
+
+// Sent возвращает копию отправленных SMS в порядке отправки.
+func (s *FakeSMSSender) Sent() []SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SMS(nil), s.sent...)
+}
+
+// ServerAuthCodeSMSSend отправляет код аутентификации сервера в SMS.
+//
+// Принимает язык сообщения и номер телефона в формате E.164.
+// Генерирует код и отправляет его сразу, как и письмо с кодом: пользователь ждет код на странице.
+// Очереди для SMS нет, поэтому ошибка шлюза возвращается вызывающему.
+// Возвращает сгенерированный код и ошибку, если она возникла.
+var ServerAuthCodeSMSSend = func(locale, phone string) (string, error) {
+	sender, err := newSMSSender()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	authServerCode := serverAuthCodeGenerate()
+	if err := sender.Send(phone, i18n.Text(locale, "sms.authCode", authServerCode)); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return authServerCode, nil
+}
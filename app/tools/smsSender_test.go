@@ -0,0 +1,120 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gimaevra94/auth/app/i18n"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewSMSSender проверяет выбор способа отправки SMS.
+// Ожидается: http с адресом шлюза, log, без SMS_DRIVER, без адреса шлюза и для неизвестного способа - ошибка.
+func TestNewSMSSender(t *testing.T) {
+	t.Setenv("SMS_DRIVER", "")
+	assert.False(t, SMSEnabled())
+	_, err := newSMSSender()
+	assert.Error(t, err)
+
+	t.Setenv("SMS_DRIVER", "http")
+	t.Setenv("SMS_GATEWAY_URL", "")
+	assert.True(t, SMSEnabled())
+	_, err = newSMSSender()
+	assert.Error(t, err)
+
+	t.Setenv("SMS_GATEWAY_URL", "https://sms.example.com/send")
+	t.Setenv("SMS_GATEWAY_TOKEN", "secret")
+	t.Setenv("SMS_SENDER", "Auth")
+	sender, err := newSMSSender()
+	require.NoError(t, err)
+	httpSender, ok := sender.(httpSMSSender)
+	require.True(t, ok)
+	assert.Equal(t, "https://sms.example.com/send", httpSender.url)
+	assert.Equal(t, "secret", httpSender.token)
+	assert.Equal(t, "Auth", httpSender.sender)
+
+	t.Setenv("SMS_DRIVER", "log")
+	sender, err = newSMSSender()
+	require.NoError(t, err)
+	assert.Equal(t, logSMSSender{}, sender)
+
+	t.Setenv("SMS_DRIVER", "carrier-pigeon")
+	_, err = newSMSSender()
+	assert.Error(t, err)
+}
+
+// TestHTTPSMSSenderSend проверяет запрос к SMS-шлюзу.
+// Ожидается: POST с JSON и токеном в заголовке Authorization; ответ не 2xx - ошибка с телом ответа.
+func TestHTTPSMSSenderSend(t *testing.T) {
+	var received smsGatewayRequest
+	var authorization, contentType string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		authorization = r.Header.Get("Authorization")
+		contentType = r.Header.Get("Content-Type")
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+		w.Write([]byte("quota exceeded"))
+	}))
+	defer server.Close()
+
+	sender := httpSMSSender{url: server.URL, token: "secret", sender: "Auth", client: server.Client()}
+	require.NoError(t, sender.Send("+79991234567", "Code: 1234"))
+	assert.Equal(t, smsGatewayRequest{To: "+79991234567", From: "Auth", Text: "Code: 1234"}, received)
+	assert.Equal(t, "Bearer secret", authorization)
+	assert.Equal(t, "application/json", contentType)
+
+	sender.token = ""
+	require.NoError(t, sender.Send("+79991234567", "Code: 1234"))
+	assert.Empty(t, authorization)
+
+	status = http.StatusTooManyRequests
+	err := sender.Send("+79991234567", "Code: 1234")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "429")
+	assert.Contains(t, err.Error(), "quota exceeded")
+}
+
+// TestLogSMSSenderSend проверяет вывод SMS в лог.
+func TestLogSMSSenderSend(t *testing.T) {
+	var logOutput bytes.Buffer
+	log.SetOutput(&logOutput)
+	defer log.SetOutput(os.Stderr)
+
+	require.NoError(t, logSMSSender{}.Send("+79991234567", "Code: 1234"))
+
+	assert.Contains(t, logOutput.String(), "SMS to +79991234567: Code: 1234")
+}
+
+// TestServerAuthCodeSMSSend проверяет отправку кода в SMS.
+// Ожидается: сгенерированный код в тексте на языке получателя; ошибка шлюза и ненастроенная
+// отправка SMS возвращаются.
+func TestServerAuthCodeSMSSend(t *testing.T) {
+	fake := &FakeSMSSender{}
+	originalNewSMSSender := newSMSSender
+	newSMSSender = func() (SMSSender, error) { return fake, nil }
+	defer func() { newSMSSender = originalNewSMSSender }()
+
+	code, err := ServerAuthCodeSMSSend(i18n.Ru, "+79991234567")
+	require.NoError(t, err)
+	assert.Len(t, code, 4)
+	assert.Equal(t, []SMS{{Phone: "+79991234567", Text: i18n.Text(i18n.Ru, "sms.authCode", code)}}, fake.Sent())
+	assert.Contains(t, fake.Sent()[0].Text, code)
+
+	fake.Err = errors.New("gateway error")
+	_, err = ServerAuthCodeSMSSend(i18n.En, "+79991234567")
+	assert.Error(t, err)
+	assert.Len(t, fake.Sent(), 1)
+
+	newSMSSender = func() (SMSSender, error) { return nil, errors.New("SMS_DRIVER environment variable is not set") }
+	_, err = ServerAuthCodeSMSSend(i18n.En, "+79991234567")
+	assert.Error(t, err)
+}
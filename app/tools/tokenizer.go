@@ -2,27 +2,47 @@
 //
 // Файл содержит функции для генерации JWT токенов:
 //   - GenerateRefreshToken: генерирует refresh токен для аутентификации
+//   - GenerateAccessToken: генерирует access токен для сторонних сервисов
 //   - GeneratePasswordResetLink: генерирует ссылку для сброса пароля с токеном
+//   - GenerateEmailChangeUndoLink: генерирует ссылку для отмены смены email с токеном
+//   - GenerateAccountDeletionLink: генерирует ссылку для подтверждения удаления аккаунта с токеном
+//   - GenerateSecurityAlertLink: генерирует ссылку "это был не я" для уведомления безопасности с токеном
+//   - GenerateUnsubscribeLink: генерирует ссылку отписки от уведомления с токеном
 package tools
 
 import (
-	"os"
 	"time"
 
+	"github.com/gimaevra94/auth/app/keyring"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/golang-jwt/jwt"
 	"github.com/pkg/errors"
 )
 
+// Назначения токенов (claim purpose). Все токены подписываются одной связкой ключей,
+// поэтому валидатор принимает только токен своего назначения.
+const (
+	tokenPurposeRefresh         = "refresh"
+	tokenPurposeAccess          = "access"
+	tokenPurposePasswordReset   = "password-reset"
+	tokenPurposeEmailChangeUndo = "email-change-undo"
+	tokenPurposeAccountDeletion = "account-deletion"
+	tokenPurposeSecurityAlert   = "security-alert"
+	tokenPurposeUnsubscribe     = "unsubscribe"
+)
+
 // GenerateRefreshToken генерирует JWT refresh токен.
 //
-// Принимает время жизни токена и флаг "запомнить меня".
+// Принимает время жизни токена, флаг "запомнить меня" и роли пользователя.
 // Если флаг установлен в false, использует время жизни 24 часа по умолчанию.
+// Роли записываются в claim roles и нужны только для информации: права
+// проверяются по БД на каждый запрос (см. auth.RequirePermission).
+// Подписывает токен основным ключом связки ключей (HS256, RS256 или EdDSA) и указывает его kid в заголовке.
 // Возвращает подписанный JWT токен или ошибку.
-var GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
+var GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool, roles []string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
 	}
 
 	refreshTokenExp24Hours := 24 * 60 * 60
@@ -32,13 +52,18 @@ var GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, e
 
 	refreshTokenExpiresAt := time.Now().Unix() + int64(refreshTokenExp)
 	refreshTokenIssuedAt := time.Now().Unix()
-	standardClaims := jwt.StandardClaims{
-		ExpiresAt: refreshTokenExpiresAt,
-		IssuedAt:  refreshTokenIssuedAt,
+	claims := structs.RefreshTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: refreshTokenExpiresAt,
+			IssuedAt:  refreshTokenIssuedAt,
+		},
+		Purpose: tokenPurposeRefresh,
+		Roles:   roles,
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, standardClaims)
-	signedrefreshToken, err := refreshToken.SignedString([]byte(jwtSecret))
+	refreshToken := jwt.NewWithClaims(signingKey.Method, claims)
+	refreshToken.Header["kid"] = signingKey.Kid
+	signedrefreshToken, err := refreshToken.SignedString(signingKey.SignKey)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -46,15 +71,51 @@ var GenerateRefreshToken = func(refreshTokenExp int, rememberMe bool) (string, e
 	return signedrefreshToken, nil
 }
 
+// AccessTokenExp - время жизни access токена в секундах (15 минут).
+const AccessTokenExp = 15 * 60
+
+// GenerateAccessToken генерирует JWT access токен пользователя permanentId для сторонних сервисов.
+//
+// Токен живет AccessTokenExp секунд и содержит permanentId в claim sub. Подписывается основным
+// ключом связки ключей, и при ключе RS256 или EdDSA сторонний сервис проверяет его без общего
+// секрета по открытому ключу из /.well-known/jwks.json (kid в заголовке, claim purpose = "access").
+// Возвращает подписанный JWT токен или ошибку.
+var GenerateAccessToken = func(permanentId string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now()
+	accessTokenClaims := structs.AccessTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject:   permanentId,
+			ExpiresAt: now.Add(AccessTokenExp * time.Second).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Purpose: tokenPurposeAccess,
+	}
+
+	accessToken := jwt.NewWithClaims(signingKey.Method, accessTokenClaims)
+	accessToken.Header["kid"] = signingKey.Kid
+	signedAccessToken, err := accessToken.SignedString(signingKey.SignKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return signedAccessToken, nil
+}
+
 // GeneratePasswordResetLink генерирует ссылку для сброса пароля с JWT токеном.
 //
 // Принимает email пользователя и базовый URL.
 // Создает токен со сроком действия 15 минут, содержащий email.
+// Подписывает токен основным ключом связки ключей (HS256, RS256 или EdDSA) и указывает его kid в заголовке.
 // Возвращает полную ссылку для сброса пароля или ошибку.
 var GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
 	}
 
 	passwordResetTokenExp15Minutes := time.Now().Add(15 * time.Minute)
@@ -65,11 +126,13 @@ var GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
 			ExpiresAt: passwordResetTokenExp15MinutesExpiresAt,
 			IssuedAt:  passwordResetTokenExp15MinutesIssuedAt,
 		},
-		Email: email,
+		Purpose: tokenPurposePasswordReset,
+		Email:   email,
 	}
 
-	resetToken := jwt.NewWithClaims(jwt.SigningMethodHS256, passwordResetTokenClaims)
-	signedPasswordResetToken, err := resetToken.SignedString([]byte(jwtSecret))
+	resetToken := jwt.NewWithClaims(signingKey.Method, passwordResetTokenClaims)
+	resetToken.Header["kid"] = signingKey.Kid
+	signedPasswordResetToken, err := resetToken.SignedString(signingKey.SignKey)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -77,3 +140,140 @@ var GeneratePasswordResetLink = func(email, baseURL string) (string, error) {
 	passwordResetLink := baseURL + "?token=" + signedPasswordResetToken
 	return passwordResetLink, nil
 }
+
+// GenerateEmailChangeUndoLink генерирует ссылку для отмены смены email с JWT токеном.
+//
+// Принимает прежний и новый email и базовый URL.
+// Создает токен со сроком действия 7 дней, чтобы владелец прежнего адреса
+// успел отменить смену, если она выполнена без его ведома.
+// Подписывает токен основным ключом связки ключей и указывает его kid в заголовке.
+// Возвращает полную ссылку для отмены смены email или ошибку.
+var GenerateEmailChangeUndoLink = func(oldEmail, newEmail, baseURL string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now()
+	undoTokenClaims := structs.EmailChangeUndoTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(7 * 24 * time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Purpose:  tokenPurposeEmailChangeUndo,
+		OldEmail: oldEmail,
+		NewEmail: newEmail,
+	}
+
+	undoToken := jwt.NewWithClaims(signingKey.Method, undoTokenClaims)
+	undoToken.Header["kid"] = signingKey.Kid
+	signedUndoToken, err := undoToken.SignedString(signingKey.SignKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return baseURL + "?token=" + signedUndoToken, nil
+}
+
+// GenerateAccountDeletionLink генерирует ссылку для подтверждения удаления аккаунта с JWT токеном.
+//
+// Принимает permanentId пользователя и базовый URL.
+// Создает токен со сроком действия 15 минут, как у ссылки сброса пароля.
+// Подписывает токен основным ключом связки ключей и указывает его kid в заголовке.
+// Возвращает полную ссылку для подтверждения удаления или ошибку.
+var GenerateAccountDeletionLink = func(permanentId, baseURL string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now()
+	deletionTokenClaims := structs.AccountDeletionTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(15 * time.Minute).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Purpose:     tokenPurposeAccountDeletion,
+		PermanentId: permanentId,
+	}
+
+	deletionToken := jwt.NewWithClaims(signingKey.Method, deletionTokenClaims)
+	deletionToken.Header["kid"] = signingKey.Kid
+	signedDeletionToken, err := deletionToken.SignedString(signingKey.SignKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return baseURL + "?token=" + signedDeletionToken, nil
+}
+
+// GenerateSecurityAlertLink генерирует ссылку "это был не я" для уведомления безопасности с JWT токеном.
+//
+// Принимает permanentId пользователя, адрес, на который отправляется уведомление,
+// событие, о котором уведомление, и базовый URL.
+// Создает токен со сроком действия 7 дней, как у ссылки отмены смены email:
+// пользователь может прочитать уведомление не сразу.
+// Подписывает токен основным ключом связки ключей и указывает его kid в заголовке.
+// Возвращает полную ссылку или ошибку.
+var GenerateSecurityAlertLink = func(permanentId, email, event, baseURL string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now()
+	alertTokenClaims := structs.SecurityAlertTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(7 * 24 * time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Purpose:          tokenPurposeSecurityAlert,
+		AlertPermanentId: permanentId,
+		AlertEmail:       email,
+		Event:            event,
+	}
+
+	alertToken := jwt.NewWithClaims(signingKey.Method, alertTokenClaims)
+	alertToken.Header["kid"] = signingKey.Kid
+	signedAlertToken, err := alertToken.SignedString(signingKey.SignKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return baseURL + "?token=" + signedAlertToken, nil
+}
+
+// GenerateUnsubscribeLink генерирует ссылку отписки от уведомления setting с JWT токеном.
+//
+// Принимает email получателя, вид уведомления и базовый URL.
+// Создает токен со сроком действия 30 дней: ссылка из заголовка List-Unsubscribe
+// должна работать и для давно полученного письма. Повторная отписка ничего не меняет,
+// поэтому токен не сохраняется и может использоваться несколько раз.
+// Подписывает токен основным ключом связки ключей и указывает его kid в заголовке.
+// Возвращает полную ссылку или ошибку.
+var GenerateUnsubscribeLink = func(email, setting, baseURL string) (string, error) {
+	signingKey, err := keyring.JWTSigningKey()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	now := time.Now()
+	unsubscribeTokenClaims := structs.UnsubscribeTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(30 * 24 * time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		Purpose:          tokenPurposeUnsubscribe,
+		UnsubscribeEmail: email,
+		Setting:          setting,
+	}
+
+	unsubscribeToken := jwt.NewWithClaims(signingKey.Method, unsubscribeTokenClaims)
+	unsubscribeToken.Header["kid"] = signingKey.Kid
+	signedUnsubscribeToken, err := unsubscribeToken.SignedString(signingKey.SignKey)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return baseURL + "?token=" + signedUnsubscribeToken, nil
+}
@@ -1,10 +1,19 @@
 package tools
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/gimaevra94/auth/app/keyring"
 	"github.com/gimaevra94/auth/app/structs"
 	"github.com/golang-jwt/jwt"
 	"github.com/stretchr/testify/assert"
@@ -62,7 +71,7 @@ func TestGenerateRefreshToken(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GenerateRefreshToken(tt.refreshTokenExp, tt.rememberMe)
+			got, err := GenerateRefreshToken(tt.refreshTokenExp, tt.rememberMe, nil)
 
 			if tt.wantErr {
 				assert.Error(t, err, tt.description)
@@ -105,10 +114,44 @@ func TestGenerateRefreshToken_MissingJWTSecret(t *testing.T) {
 		}
 	}()
 
-	_, err := GenerateRefreshToken(3600, true)
+	_, err := GenerateRefreshToken(3600, true, nil)
 	assert.Error(t, err, "Должна быть ошибка при отсутствующем JWT_SECRET")
 }
 
+func TestGenerateRefreshToken_Roles(t *testing.T) {
+	originalSecret := os.Getenv("JWT_SECRET")
+	testSecret := "test-secret-key"
+	os.Setenv("JWT_SECRET", testSecret)
+	defer func() {
+		if originalSecret != "" {
+			os.Setenv("JWT_SECRET", originalSecret)
+		} else {
+			os.Unsetenv("JWT_SECRET")
+		}
+	}()
+
+	token, err := GenerateRefreshToken(3600, true, []string{"admin", "support"})
+	require.NoError(t, err)
+
+	claims := &structs.RefreshTokenClaims{}
+	_, err = jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSecret), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"admin", "support"}, claims.Roles, "Роли пользователя должны быть в claim roles")
+	assert.NoError(t, RefreshTokenValidate(token))
+
+	token, err = GenerateRefreshToken(3600, true, nil)
+	require.NoError(t, err)
+
+	rawClaims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token, rawClaims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(testSecret), nil
+	})
+	require.NoError(t, err)
+	assert.NotContains(t, rawClaims, "roles", "Без ролей claim roles не записывается")
+}
+
 func TestGeneratePasswordResetLink(t *testing.T) {
 	originalSecret := os.Getenv("JWT_SECRET")
 	testSecret := "test-secret-key-for-password-reset"
@@ -228,7 +271,7 @@ func TestGenerateRefreshToken_TokenExpiration(t *testing.T) {
 	}()
 
 	shortExp := 1 
-	token, err := GenerateRefreshToken(shortExp, true)
+	token, err := GenerateRefreshToken(shortExp, true, nil)
 	require.NoError(t, err)
 
 	parsedToken, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -288,7 +331,7 @@ func BenchmarkGenerateRefreshToken(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		GenerateRefreshToken(3600, true)
+		GenerateRefreshToken(3600, true, nil)
 	}
 }
 
@@ -308,3 +351,280 @@ func BenchmarkGeneratePasswordResetLink(b *testing.B) {
 		GeneratePasswordResetLink("test@example.com", "https://example.com/reset")
 	}
 }
+
+func TestGenerateRefreshToken_KeyRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv("KEYRING_FILE", path)
+	t.Setenv("JWT_SECRET", "legacy-env-secret")
+
+	legacyToken, err := GenerateRefreshToken(3600, true, nil)
+	require.NoError(t, err)
+
+	var keyringData structs.Keyring
+	oldKey, err := keyring.AddKey(&keyringData, keyring.SetJWT, time.Now().Unix())
+	require.NoError(t, err)
+	require.NoError(t, keyring.Save(path, keyringData))
+
+	oldToken, err := GenerateRefreshToken(3600, true, nil)
+	require.NoError(t, err)
+	parsed, _, err := new(jwt.Parser).ParseUnverified(oldToken, &jwt.StandardClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, oldKey.Kid, parsed.Header["kid"], "Токен должен содержать kid основного ключа")
+
+	newKey, err := keyring.AddKey(&keyringData, keyring.SetJWT, time.Now().Unix())
+	require.NoError(t, err)
+	require.NoError(t, keyring.PromoteKey(&keyringData, keyring.SetJWT, newKey.Kid))
+	require.NoError(t, keyring.Save(path, keyringData))
+
+	resetLink, err := GeneratePasswordResetLink("user@example.com", "https://example.com/reset")
+	require.NoError(t, err)
+	resetToken := resetLink[len("https://example.com/reset?token="):]
+
+	assert.NoError(t, RefreshTokenValidate(legacyToken), "Токен, подписанный JWT_SECRET, должен оставаться валидным")
+	assert.NoError(t, RefreshTokenValidate(oldToken), "Токен прежнего ключа должен проверяться до вывода ключа")
+	claims, err := ResetTokenValidate(resetToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", claims.Email)
+
+	require.NoError(t, keyring.RetireKey(&keyringData, keyring.SetJWT, oldKey.Kid))
+	require.NoError(t, keyring.Save(path, keyringData))
+	assert.Error(t, RefreshTokenValidate(oldToken), "Токен выведенного ключа должен отклоняться")
+}
+
+// writePrivateKeyPEM генерирует закрытый ключ алгоритма alg и сохраняет его в PEM файл PKCS#8.
+func writePrivateKeyPEM(t *testing.T, alg string) string {
+	t.Helper()
+
+	var privateKey interface{}
+	switch alg {
+	case "RS256":
+		rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+		privateKey = rsaKey
+	case "EdDSA":
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		privateKey = edKey
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), alg+".pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	return path
+}
+
+// TestGenerateTokens_AsymmetricKeys проверяет подпись и проверку токенов ключами RS256 и EdDSA.
+// Ожидается: токены подписаны алгоритмом ключа и проходят проверку.
+func TestGenerateTokens_AsymmetricKeys(t *testing.T) {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+			t.Setenv("JWT_SECRET", "legacy-env-secret")
+			t.Setenv("JWT_SIGNING_ALG", alg)
+			t.Setenv("JWT_PRIVATE_KEY_FILE", writePrivateKeyPEM(t, alg))
+
+			refreshToken, err := GenerateRefreshToken(3600, true, nil)
+			require.NoError(t, err)
+			parsed, _, err := new(jwt.Parser).ParseUnverified(refreshToken, &jwt.StandardClaims{})
+			require.NoError(t, err)
+			assert.Equal(t, alg, parsed.Header["alg"])
+			assert.NoError(t, RefreshTokenValidate(refreshToken))
+
+			resetLink, err := GeneratePasswordResetLink("user@example.com", "https://example.com/reset")
+			require.NoError(t, err)
+			claims, err := ResetTokenValidate(resetLink[len("https://example.com/reset?token="):])
+			require.NoError(t, err)
+			assert.Equal(t, "user@example.com", claims.Email)
+		})
+	}
+}
+
+// TestTokenValidate_AlgorithmConfusion проверяет защиту от подмены алгоритма.
+// Ожидается: токен HS256, подписанный открытым ключом RS256 с его kid, отклоняется.
+func TestTokenValidate_AlgorithmConfusion(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "legacy-env-secret")
+	t.Setenv("JWT_SIGNING_ALG", "RS256")
+	t.Setenv("JWT_PRIVATE_KEY_FILE", writePrivateKeyPEM(t, "RS256"))
+
+	signingKey, err := keyring.JWTSigningKey()
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(signingKey.VerifyKey)
+	require.NoError(t, err)
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER})
+
+	forgedToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	forgedToken.Header["kid"] = signingKey.Kid
+	signedForgedToken, err := forgedToken.SignedString(publicKeyPEM)
+	require.NoError(t, err)
+
+	assert.Error(t, RefreshTokenValidate(signedForgedToken))
+	_, err = ResetTokenValidate(signedForgedToken)
+	assert.Error(t, err)
+}
+
+// TestGenerateEmailChangeUndoLink проверяет ссылку отмены смены email.
+// Ожидается: токен содержит прежний и новый email, живет 7 дней и не принимается как токен другого ключа.
+func TestGenerateEmailChangeUndoLink(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "undo-secret")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	undoLink, err := GenerateEmailChangeUndoLink("old@example.com", "new@example.com", "https://example.com/profile/email/undo")
+	require.NoError(t, err)
+	prefix := "https://example.com/profile/email/undo?token="
+	require.True(t, len(undoLink) > len(prefix) && undoLink[:len(prefix)] == prefix)
+	undoToken := undoLink[len(prefix):]
+
+	claims, err := EmailChangeUndoTokenValidate(undoToken)
+	require.NoError(t, err)
+	assert.Equal(t, "old@example.com", claims.OldEmail)
+	assert.Equal(t, "new@example.com", claims.NewEmail)
+	assert.InDelta(t, time.Now().Add(7*24*time.Hour).Unix(), claims.ExpiresAt, 5)
+
+	t.Setenv("JWT_SECRET", "other-secret")
+	_, err = EmailChangeUndoTokenValidate(undoToken)
+	assert.Error(t, err, "Токен, подписанный другим ключом, должен отклоняться")
+}
+
+// TestGenerateAccountDeletionLink проверяет ссылку подтверждения удаления аккаунта.
+// Ожидается: токен содержит permanentId, живет 15 минут, токены других назначений отклоняются.
+func TestGenerateAccountDeletionLink(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "deletion-secret")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	deletionLink, err := GenerateAccountDeletionLink("perm123", "https://example.com/profile/delete/confirm")
+	require.NoError(t, err)
+	prefix := "https://example.com/profile/delete/confirm?token="
+	require.True(t, len(deletionLink) > len(prefix) && deletionLink[:len(prefix)] == prefix)
+	deletionToken := deletionLink[len(prefix):]
+
+	claims, err := AccountDeletionTokenValidate(deletionToken)
+	require.NoError(t, err)
+	assert.Equal(t, "perm123", claims.PermanentId)
+	assert.InDelta(t, time.Now().Add(15*time.Minute).Unix(), claims.ExpiresAt, 5)
+
+	undoLink, err := GenerateEmailChangeUndoLink("old@example.com", "new@example.com", "https://example.com/profile/email/undo")
+	require.NoError(t, err)
+	_, err = AccountDeletionTokenValidate(undoLink[len("https://example.com/profile/email/undo?token="):])
+	assert.Error(t, err, "Токен другого назначения без permanentId должен отклоняться")
+
+	t.Setenv("JWT_SECRET", "other-secret")
+	_, err = AccountDeletionTokenValidate(deletionToken)
+	assert.Error(t, err, "Токен, подписанный другим ключом, должен отклоняться")
+}
+
+func TestGenerateSecurityAlertLink(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "alert-secret")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	alertLink, err := GenerateSecurityAlertLink("perm123", "user@example.com", "passwordChange", "https://example.com/security/revoke")
+	require.NoError(t, err)
+	prefix := "https://example.com/security/revoke?token="
+	require.True(t, len(alertLink) > len(prefix) && alertLink[:len(prefix)] == prefix)
+	alertToken := alertLink[len(prefix):]
+
+	claims, err := SecurityAlertTokenValidate(alertToken)
+	require.NoError(t, err)
+	assert.Equal(t, "perm123", claims.AlertPermanentId)
+	assert.Equal(t, "user@example.com", claims.AlertEmail)
+	assert.Equal(t, "passwordChange", claims.Event)
+	assert.InDelta(t, time.Now().Add(7*24*time.Hour).Unix(), claims.ExpiresAt, 5)
+
+	_, err = AccountDeletionTokenValidate(alertToken)
+	assert.Error(t, err, "Токен уведомления не должен подтверждать удаление аккаунта")
+
+	deletionLink, err := GenerateAccountDeletionLink("perm123", "https://example.com/profile/delete/confirm")
+	require.NoError(t, err)
+	_, err = SecurityAlertTokenValidate(deletionLink[len("https://example.com/profile/delete/confirm?token="):])
+	assert.Error(t, err, "Токен другого назначения должен отклоняться")
+
+	t.Setenv("JWT_SECRET", "other-secret")
+	_, err = SecurityAlertTokenValidate(alertToken)
+	assert.Error(t, err, "Токен, подписанный другим ключом, должен отклоняться")
+}
+
+// TestGenerateUnsubscribeLink проверяет ссылку отписки от уведомления.
+// Ожидается: токен содержит email и вид уведомления, действует 30 дней;
+// токены других назначений и подписанные другим ключом отклоняются.
+func TestGenerateUnsubscribeLink(t *testing.T) {
+	t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+	t.Setenv("JWT_SECRET", "unsubscribe-secret")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	link, err := GenerateUnsubscribeLink("user@example.com", "newDeviceLogin", "https://example.com/unsubscribe")
+	require.NoError(t, err)
+	prefix := "https://example.com/unsubscribe?token="
+	require.True(t, len(link) > len(prefix) && link[:len(prefix)] == prefix)
+	token := link[len(prefix):]
+
+	claims, err := UnsubscribeTokenValidate(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user@example.com", claims.UnsubscribeEmail)
+	assert.Equal(t, "newDeviceLogin", claims.Setting)
+	assert.InDelta(t, time.Now().Add(30*24*time.Hour).Unix(), claims.ExpiresAt, 5)
+
+	alertLink, err := GenerateSecurityAlertLink("perm123", "user@example.com", "passwordChange", "https://example.com/security/revoke")
+	require.NoError(t, err)
+	_, err = UnsubscribeTokenValidate(alertLink[len("https://example.com/security/revoke?token="):])
+	assert.Error(t, err, "Токен другого назначения должен отклоняться")
+
+	t.Setenv("JWT_SECRET", "other-secret")
+	_, err = UnsubscribeTokenValidate(token)
+	assert.Error(t, err, "Токен, подписанный другим ключом, должен отклоняться")
+}
+
+// TestGenerateAccessToken_VerifiableWithJWKS проверяет access токен так, как это делает сторонний сервис.
+// Ожидается: токен проверяется открытым ключом из JWKS по kid из заголовка,
+// содержит permanentId и назначение access и отклоняется валидаторами других токенов.
+func TestGenerateAccessToken_VerifiableWithJWKS(t *testing.T) {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			t.Setenv("KEYRING_FILE", filepath.Join(t.TempDir(), "keyring.json"))
+			t.Setenv("JWT_SECRET", "legacy-env-secret")
+			t.Setenv("JWT_SIGNING_ALG", alg)
+			t.Setenv("JWT_PRIVATE_KEY_FILE", writePrivateKeyPEM(t, alg))
+
+			accessToken, err := GenerateAccessToken("perm123")
+			require.NoError(t, err)
+
+			jwks, err := keyring.JWKS()
+			require.NoError(t, err)
+			publicKey := func(token *jwt.Token) (interface{}, error) {
+				for _, jwk := range jwks.Keys {
+					if jwk.Kid != token.Header["kid"] || jwk.Alg != token.Method.Alg() {
+						continue
+					}
+					switch jwk.Kty {
+					case "RSA":
+						n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+						require.NoError(t, err)
+						e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+						require.NoError(t, err)
+						return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+					case "OKP":
+						x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+						require.NoError(t, err)
+						return ed25519.PublicKey(x), nil
+					}
+				}
+				return nil, jwt.ErrInvalidKey
+			}
+
+			claims := &structs.AccessTokenClaims{}
+			_, err = jwt.ParseWithClaims(accessToken, claims, publicKey)
+			require.NoError(t, err)
+			assert.Equal(t, "perm123", claims.Subject)
+			assert.Equal(t, "access", claims.Purpose)
+			assert.InDelta(t, time.Now().Add(AccessTokenExp*time.Second).Unix(), claims.ExpiresAt, 5)
+
+			validated, err := AccessTokenValidate(accessToken)
+			require.NoError(t, err)
+			assert.Equal(t, "perm123", validated.Subject)
+			assert.Error(t, RefreshTokenValidate(accessToken), "Access токен не должен приниматься как refresh")
+		})
+	}
+}
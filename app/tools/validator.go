@@ -3,17 +3,25 @@
 // Файл содержит функции для валидации различных типов данных:
 //   - InputValidate: проверяет корректность логина, email и пароля
 //   - RefreshTokenValidate: проверяет валидность refresh токена
+//   - AccessTokenValidate: проверяет и декодирует access токен
 //   - CodeValidate: сравнивает клиентский и серверный коды
 //   - EmailValidate: проверяет корректность email
+//   - PhoneNormalize: проверяет номер телефона и приводит его к формату E.164
 //   - PasswordValidate: проверяет корректность пароля
 //   - ResetTokenValidate: проверяет и декодирует токен сброса пароля
+//   - LoginValidate: проверяет корректность логина
+//   - EmailChangeUndoTokenValidate: проверяет и декодирует токен отмены смены email
+//   - AccountDeletionTokenValidate: проверяет и декодирует токен подтверждения удаления аккаунта
+//   - SecurityAlertTokenValidate: проверяет и декодирует токен ссылки "это был не я"
+//   - UnsubscribeTokenValidate: проверяет и декодирует токен ссылки отписки от уведомления
 package tools
 
 import (
 	"net/http"
-	"os"
 	"regexp"
+	"strings"
 
+	"github.com/gimaevra94/auth/app/keyring"
 	"github.com/gimaevra94/auth/app/structs"
 
 	"github.com/golang-jwt/jwt"
@@ -24,15 +32,27 @@ var (
 	loginRegex    = regexp.MustCompile(`^[a-zA-Zа-яА-ЯёЁ0-9]{3,30}$`)
 	emailRegex    = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(\.[a-zA-Z]{2,})+$`)
 	passwordRegex = regexp.MustCompile(`^[a-zA-Zа-яА-ЯёЁ\d!@#$%^&*\-\)]{4,30}$`)
+	phoneRegex    = regexp.MustCompile(`^\+[1-9][0-9]{7,14}$`)
 )
 
+// phoneSeparators удаляет из номера телефона пробелы, дефисы, точки и скобки,
+// которыми пользователи разделяют цифры при вводе.
+var phoneSeparators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+
 // InputValidate проверяет корректность введенных данных пользователя.
 //
 // Валидирует логин, пароль и email (только для регистрации).
+// При входе поле логина принимает и email: значение с символом "@" проверяется как email.
 // Возвращает ключ ошибки при невалидных данных.
 var InputValidate = func(r *http.Request, login, email, password string, IsSignIn bool) (string, error) {
 	var errMsgKey string
-	if login == "" || !loginRegex.MatchString(login) {
+	if IsSignIn && strings.Contains(login, "@") {
+		if !emailRegex.MatchString(login) {
+			err := errors.New("emailInvalid")
+			errMsgKey = "emailInvalid"
+			return errMsgKey, errors.WithStack(err)
+		}
+	} else if login == "" || !loginRegex.MatchString(login) {
 		err := errors.New("loginInvalid")
 		errMsgKey = "loginInvalid"
 		return errMsgKey, errors.WithStack(err)
@@ -55,24 +75,49 @@ var InputValidate = func(r *http.Request, login, email, password string, IsSignI
 	return errMsgKey, nil
 }
 
-// RefreshTokenValidate проверяет валидность refresh токена.
+// keyFunc выбирает ключ проверки JWT по kid из заголовка токена.
 //
-// Декодирует JWT токен и проверяет его подпись и срок действия.
-// Возвращает ошибку при невалидном токене.
-var RefreshTokenValidate = func(refreshToken string) error {
-	signedToken, err := jwt.ParseWithClaims(refreshToken, &jwt.StandardClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok || t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-			err := errors.New("unexpected signing method")
-			return nil, errors.WithStack(err)
-		}
-		jwtSecret := []byte(os.Getenv("JWT_SECRET"))
-		return jwtSecret, nil
-	})
+// Алгоритм токена должен совпадать с алгоритмом ключа.
+func keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	verificationKey, err := keyring.JWTVerificationKey(kid)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if token.Method.Alg() != verificationKey.Method.Alg() {
+		return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return verificationKey.VerifyKey, nil
+}
+
+// parseToken проверяет подпись и срок действия JWT и декодирует его в claims.
+//
+// Ключ проверки выбирается keyFunc. Назначение токена (claim purpose) и обязательные
+// поля проверяет вызывающий валидатор: все токены подписываются одной связкой ключей.
+func parseToken(signedToken string, claims jwt.Claims) error {
+	tok, err := jwt.ParseWithClaims(signedToken, claims, keyFunc)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	if !signedToken.Valid {
+	if !tok.Valid {
+		return errors.New("token invalid")
+	}
+
+	return nil
+}
+
+// RefreshTokenValidate проверяет валидность refresh токена.
+//
+// Декодирует JWT токен и проверяет его подпись, срок действия и назначение (см. parseToken).
+// Возвращает ошибку при невалидном токене или токене другого назначения.
+var RefreshTokenValidate = func(refreshToken string) error {
+	claims := &structs.RefreshTokenClaims{}
+	if err := parseToken(refreshToken, claims); err != nil {
+		return err
+	}
+
+	if claims.Purpose != tokenPurposeRefresh {
 		err := errors.New("Refresh token invalid")
 		return errors.WithStack(err)
 	}
@@ -80,6 +125,24 @@ var RefreshTokenValidate = func(refreshToken string) error {
 	return nil
 }
 
+// AccessTokenValidate проверяет и декодирует access токен.
+//
+// Валидирует JWT токен (см. parseToken) и извлекает из него permanentId (claim sub).
+// Токен другого назначения или без sub отклоняется. Так же токен проверяют сторонние
+// сервисы по открытым ключам из /.well-known/jwks.json.
+var AccessTokenValidate = func(signedToken string) (*structs.AccessTokenClaims, error) {
+	claims := &structs.AccessTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != tokenPurposeAccess || claims.Subject == "" {
+		return nil, errors.New("token invalid")
+	}
+
+	return claims, nil
+}
+
 // CodeValidate сравнивает клиентский и серверный коды.
 //
 // Проверяет наличие клиентского кода и его соответствие серверному.
@@ -109,6 +172,25 @@ var EmailValidate = func(email string) error {
 	return nil
 }
 
+// PhoneNormalize проверяет номер телефона и приводит его к формату E.164.
+//
+// Принимает номер в международном формате: с "+" или "00" перед кодом страны,
+// цифры можно разделять пробелами, дефисами, точками и скобками.
+// Возвращает номер вида +79991234567 (от 8 до 15 цифр, код страны не начинается с 0)
+// или ошибку для некорректного номера.
+var PhoneNormalize = func(phone string) (string, error) {
+	normalized := phoneSeparators.Replace(strings.TrimSpace(phone))
+	if strings.HasPrefix(normalized, "00") {
+		normalized = "+" + strings.TrimPrefix(normalized, "00")
+	}
+
+	if !phoneRegex.MatchString(normalized) {
+		err := errors.New("phone invalid")
+		return "", errors.WithStack(err)
+	}
+	return normalized, nil
+}
+
 // PasswordValidate проверяет корректность пароля.
 //
 // Проверяет соответствие пароля требованиям безопасности с использованием регулярного выражения.
@@ -123,23 +205,97 @@ var PasswordValidate = func(password string) error {
 
 // ResetTokenValidate проверяет и декодирует токен сброса пароля.
 //
-// Валидирует JWT токен и извлекает из него claims с email пользователя.
+// Валидирует JWT токен (см. parseToken) и извлекает из него claims с email пользователя.
+// Токен другого назначения или без email отклоняется.
 // Возвращает структуру с данными токена при успешной валидации.
 var ResetTokenValidate = func(signedToken string) (*structs.PasswordResetTokenClaims, error) {
 	claims := &structs.PasswordResetTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
+	}
 
-	tok, err := jwt.ParseWithClaims(signedToken, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(os.Getenv("JWT_SECRET")), nil
-	})
+	if claims.Purpose != tokenPurposePasswordReset || claims.Email == "" {
+		return nil, errors.New("token invalid")
+	}
 
-	if err != nil {
-		return nil, errors.WithStack(err)
+	return claims, nil
+}
+
+// LoginValidate проверяет корректность логина.
+//
+// Проверяет соответствие логина регулярному выражению loginRegex.
+// Возвращает ошибку при невалидном логине.
+var LoginValidate = func(login string) error {
+	if login == "" || !loginRegex.MatchString(login) {
+		err := errors.New("login invalid")
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+// EmailChangeUndoTokenValidate проверяет и декодирует токен отмены смены email.
+//
+// Валидирует JWT токен (см. parseToken) и извлекает из него прежний и новый email.
+// Токен другого назначения или без одного из адресов отклоняется.
+// Возвращает структуру с данными токена при успешной валидации.
+var EmailChangeUndoTokenValidate = func(signedToken string) (*structs.EmailChangeUndoTokenClaims, error) {
+	claims := &structs.EmailChangeUndoTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
 	}
 
-	if !tok.Valid {
+	if claims.Purpose != tokenPurposeEmailChangeUndo || claims.OldEmail == "" || claims.NewEmail == "" {
+		return nil, errors.New("token invalid")
+	}
+
+	return claims, nil
+}
+
+// AccountDeletionTokenValidate проверяет и декодирует токен подтверждения удаления аккаунта.
+//
+// Валидирует JWT токен (см. parseToken) и извлекает из него permanentId.
+// Токен другого назначения или без permanentId отклоняется.
+var AccountDeletionTokenValidate = func(signedToken string) (*structs.AccountDeletionTokenClaims, error) {
+	claims := &structs.AccountDeletionTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != tokenPurposeAccountDeletion || claims.PermanentId == "" {
+		return nil, errors.New("token invalid")
+	}
+
+	return claims, nil
+}
+
+// SecurityAlertTokenValidate проверяет и декодирует токен ссылки "это был не я".
+//
+// Валидирует JWT токен (см. parseToken) и извлекает из него permanentId, адрес уведомления и событие.
+// Токен другого назначения или без одного из этих полей отклоняется.
+var SecurityAlertTokenValidate = func(signedToken string) (*structs.SecurityAlertTokenClaims, error) {
+	claims := &structs.SecurityAlertTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != tokenPurposeSecurityAlert || claims.AlertPermanentId == "" || claims.AlertEmail == "" || claims.Event == "" {
+		return nil, errors.New("token invalid")
+	}
+
+	return claims, nil
+}
+
+// UnsubscribeTokenValidate проверяет и декодирует токен ссылки отписки от уведомления.
+//
+// Валидирует JWT токен (см. parseToken) и извлекает из него email и вид уведомления.
+// Токен другого назначения или без одного из этих полей отклоняется.
+var UnsubscribeTokenValidate = func(signedToken string) (*structs.UnsubscribeTokenClaims, error) {
+	claims := &structs.UnsubscribeTokenClaims{}
+	if err := parseToken(signedToken, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Purpose != tokenPurposeUnsubscribe || claims.UnsubscribeEmail == "" || claims.Setting == "" {
 		return nil, errors.New("token invalid")
 	}
 
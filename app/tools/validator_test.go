@@ -51,6 +51,30 @@ func TestInputValidate_SignIn_InvalidLogin(t *testing.T) {
 	}
 }
 
+func TestInputValidate_SignIn_Email(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+
+	errMsgKey, err := InputValidate(r, "user@example.com", "", "password123", true)
+	if errMsgKey != "" || err != nil {
+		t.Errorf("Expected email to be accepted as sign-in login, got %s, %v", errMsgKey, err)
+	}
+
+	errMsgKey, err = InputValidate(r, "user@", "", "password123", true)
+	if errMsgKey != "emailInvalid" || err == nil {
+		t.Errorf("Expected emailInvalid for malformed email, got %s, %v", errMsgKey, err)
+	}
+
+	errMsgKey, err = InputValidate(r, "user@example.com", "", "", true)
+	if errMsgKey != "passwordInvalid" || err == nil {
+		t.Errorf("Expected passwordInvalid for email with empty password, got %s, %v", errMsgKey, err)
+	}
+
+	errMsgKey, _ = InputValidate(r, "user@example.com", "user@example.com", "password123", false)
+	if errMsgKey != "loginInvalid" {
+		t.Errorf("Expected email to be rejected as sign-up login, got %s", errMsgKey)
+	}
+}
+
 func TestInputValidate_SignIn_InvalidPassword(t *testing.T) {
 	r := httptest.NewRequest("POST", "/", nil)
 
@@ -196,8 +220,11 @@ func TestRefreshTokenValidate_ValidToken(t *testing.T) {
 	os.Setenv("JWT_SECRET", "test_secret")
 	defer os.Unsetenv("JWT_SECRET")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, structs.RefreshTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Purpose: tokenPurposeRefresh,
 	})
 
 	signedToken, err := token.SignedString([]byte("test_secret"))
@@ -391,6 +418,47 @@ func TestEmailValidate_CyrillicEmail(t *testing.T) {
 	}
 }
 
+func TestPhoneNormalize_ValidPhones(t *testing.T) {
+	testCases := map[string]string{
+		"+79991234567":       "+79991234567",
+		"+7 (999) 123-45-67": "+79991234567",
+		"0079991234567":      "+79991234567",
+		" +1.202.555.0143 ":  "+12025550143",
+		"+44 20 7946 0958":   "+442079460958",
+		"+123456789012345":   "+123456789012345",
+	}
+
+	for phone, expected := range testCases {
+		normalized, err := PhoneNormalize(phone)
+
+		if err != nil {
+			t.Errorf("Expected no error for phone %q, got %v", phone, err)
+		}
+		if normalized != expected {
+			t.Errorf("Expected %s for phone %q, got %s", expected, phone, normalized)
+		}
+	}
+}
+
+func TestPhoneNormalize_InvalidPhones(t *testing.T) {
+	testCases := []string{
+		"",
+		"89991234567",
+		"+0791234567",
+		"+7999",
+		"+1234567890123456",
+		"+7999123456a",
+		"+7 999 123 45 67 ext 1",
+		"++79991234567",
+	}
+
+	for _, phone := range testCases {
+		if _, err := PhoneNormalize(phone); err == nil {
+			t.Errorf("Expected error for phone %q, got nil", phone)
+		}
+	}
+}
+
 func TestPasswordValidate_ValidPasswords(t *testing.T) {
 	testCases := []string{
 		"pass",
@@ -482,7 +550,8 @@ func TestResetTokenValidate_ValidToken(t *testing.T) {
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(time.Hour).Unix(),
 		},
-		Email: "test@example.com",
+		Purpose: tokenPurposePasswordReset,
+		Email:   "test@example.com",
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -609,8 +678,11 @@ func TestResetTokenValidate_MissingEmailClaim(t *testing.T) {
 	os.Setenv("JWT_SECRET", "test_secret")
 	defer os.Unsetenv("JWT_SECRET")
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
-		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, structs.PasswordResetTokenClaims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Purpose: tokenPurposePasswordReset,
 	})
 	signedToken, err := token.SignedString([]byte("test_secret"))
 	if err != nil {
@@ -619,12 +691,70 @@ func TestResetTokenValidate_MissingEmailClaim(t *testing.T) {
 
 	result, err := ResetTokenValidate(signedToken)
 
-	if err != nil {
+	if err == nil {
+		t.Error("Expected error for token without email, got nil")
+	}
+
+	if result != nil {
+		t.Errorf("Expected nil result for token without email, got %v", result)
+	}
+}
+
+// TestTokenValidate_Purpose проверяет назначение токенов и обязательные поля.
+// Ожидается: валидатор отклоняет токен другого назначения, даже если в нем есть нужные поля,
+// и токен своего назначения без обязательного поля.
+func TestTokenValidate_Purpose(t *testing.T) {
+	os.Setenv("JWT_SECRET", "test_secret")
+	defer os.Unsetenv("JWT_SECRET")
+
+	sign := func(claims jwt.Claims) string {
+		signedToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test_secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signedToken
+	}
+	standardClaims := jwt.StandardClaims{ExpiresAt: time.Now().Add(time.Hour).Unix()}
+
+	resetToken := sign(structs.PasswordResetTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposePasswordReset, Email: "user@example.com"})
+	if err := RefreshTokenValidate(resetToken); err == nil {
+		t.Error("Expected reset token to be rejected as refresh token")
+	}
+
+	refreshToken := sign(structs.RefreshTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeRefresh})
+	if _, err := ResetTokenValidate(refreshToken); err == nil {
+		t.Error("Expected refresh token to be rejected as reset token")
+	}
+	if _, err := AccessTokenValidate(refreshToken); err == nil {
+		t.Error("Expected refresh token to be rejected as access token")
+	}
+
+	accessTokenWithoutSubject := sign(structs.AccessTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeAccess})
+	if _, err := AccessTokenValidate(accessTokenWithoutSubject); err == nil {
+		t.Error("Expected access token without subject to be rejected")
+	}
+
+	unsubscribeToken := sign(structs.UnsubscribeTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeUnsubscribe, UnsubscribeEmail: "user@example.com", Setting: "newDeviceLogin"})
+	if _, err := ResetTokenValidate(unsubscribeToken); err == nil {
+		t.Error("Expected unsubscribe token to be rejected as reset token")
+	}
+
+	undoToken := sign(structs.EmailChangeUndoTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeEmailChangeUndo, OldEmail: "old@example.com", NewEmail: "new@example.com"})
+	if _, err := EmailChangeUndoTokenValidate(undoToken); err != nil {
 		t.Errorf("Expected no error, got %v", err)
 	}
+	if _, err := ResetTokenValidate(undoToken); err == nil {
+		t.Error("Expected undo token to be rejected as reset token")
+	}
+
+	undoTokenWithoutNewEmail := sign(structs.EmailChangeUndoTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeEmailChangeUndo, OldEmail: "old@example.com"})
+	if _, err := EmailChangeUndoTokenValidate(undoTokenWithoutNewEmail); err == nil {
+		t.Error("Expected undo token without new email to be rejected")
+	}
 
-	if result.Email != "" {
-		t.Errorf("Expected empty email, got %s", result.Email)
+	deletionToken := sign(structs.AccountDeletionTokenClaims{StandardClaims: standardClaims, Purpose: tokenPurposeAccountDeletion, PermanentId: "perm123"})
+	if _, err := SecurityAlertTokenValidate(deletionToken); err == nil {
+		t.Error("Expected deletion token to be rejected as security alert token")
 	}
 }
 
@@ -726,3 +856,26 @@ func TestRegexPatterns_PasswordRegex(t *testing.T) {
 		}
 	}
 }
+
+func TestLoginValidate(t *testing.T) {
+	testCases := map[string]bool{
+		"user123":               true,
+		"Пользователь":          true,
+		"ab":                    false,
+		"":                      false,
+		"user name":             false,
+		"user@name":             false,
+		strings.Repeat("a", 30): true,
+		strings.Repeat("a", 31): false,
+	}
+
+	for login, valid := range testCases {
+		err := LoginValidate(login)
+		if valid && err != nil {
+			t.Errorf("Expected login %q to be valid, got %v", login, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected login %q to be invalid", login)
+		}
+	}
+}
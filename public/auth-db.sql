@@ -1,14 +1,29 @@
 CREATE TABLE login (
     permanentId CHAR(36) NOT NULL,
     login VARCHAR(64) NOT NULL,
-    cancelled BOOLEAN NOT NULL
+    cancelled BOOLEAN NOT NULL,
+    -- действующий логин; у прежних логинов NULL, поэтому уникальность их не касается
+    activeLogin VARCHAR(64) AS (IF(cancelled, NULL, login)) STORED,
+    UNIQUE INDEX idx_login_active_login (activeLogin)
 ) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE email (
     permanentId CHAR(36) NOT NULL,
     email VARCHAR(128) NOT NULL,
     yauth BOOLEAN NOT NULL,
-    cancelled BOOLEAN NOT NULL
+    cancelled BOOLEAN NOT NULL,
+    -- действующий email; email от Yandex и email для входа по паролю уникальны отдельно
+    activeEmail VARCHAR(128) AS (IF(cancelled, NULL, email)) STORED,
+    UNIQUE INDEX idx_email_active_email (activeEmail, yauth)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE phone (
+    permanentId CHAR(36) NOT NULL,
+    phone VARCHAR(16) NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    -- действующий номер; у прежних номеров NULL, поэтому уникальность их не касается
+    activePhone VARCHAR(16) AS (IF(cancelled, NULL, phone)) STORED,
+    UNIQUE INDEX idx_phone_active_phone (activePhone)
 ) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE password_hash (
@@ -22,6 +37,9 @@ CREATE TABLE temporary_id (
     temporaryId CHAR(36) NOT NULL,
     userAgent VARCHAR(255) NOT NULL,
     yauth BOOLEAN NOT NULL,
+    rememberMe BOOLEAN NOT NULL,
+    createdAt BIGINT NOT NULL,
+    lastActivityAt BIGINT NOT NULL,
     cancelled BOOLEAN NOT NULL
 ) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
 
@@ -35,5 +53,147 @@ CREATE TABLE refresh_token (
 
 CREATE TABLE reset_token (
     token VARCHAR(255) NOT NULL,
+    -- email, на который отправлена ссылка сброса
+    email VARCHAR(128) NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    INDEX idx_reset_token_email (email)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE server_auth_code_send (
+    -- email или номер телефона, на который отправлен код
+    email VARCHAR(128) NOT NULL,
+    sentAt BIGINT NOT NULL,
+    INDEX idx_server_auth_code_send_email_sent_at (email, sentAt)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE failed_attempt (
+    permanentId CHAR(36) NOT NULL,
+    -- вид подтверждения: currentPassword, emailChangeCode, signInCode
+    kind VARCHAR(32) NOT NULL,
+    attemptedAt BIGINT NOT NULL,
+    INDEX idx_failed_attempt_permanent_id_kind (permanentId, kind, attemptedAt)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE profile_change (
+    permanentId CHAR(36) NOT NULL,
+    field VARCHAR(16) NOT NULL,
+    oldValue VARCHAR(128) NOT NULL,
+    newValue VARCHAR(128) NOT NULL,
+    undoToken VARCHAR(1024) NOT NULL,
+    changedAt BIGINT NOT NULL,
     cancelled BOOLEAN NOT NULL
-) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
\ No newline at end of file
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE account_deletion (
+    permanentId CHAR(36) NOT NULL,
+    requestedAt BIGINT NOT NULL,
+    deleteAfter BIGINT NOT NULL,
+    cancelled BOOLEAN NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE account_deletion_token (
+    token VARCHAR(1024) NOT NULL,
+    permanentId CHAR(36) NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    INDEX idx_account_deletion_token_permanent_id (permanentId)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE account_status (
+    permanentId CHAR(36) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    reason VARCHAR(255) NOT NULL,
+    createdAt BIGINT NOT NULL,
+    expiresAt BIGINT NOT NULL,
+    cancelled BOOLEAN NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE admin_action (
+    adminPermanentId CHAR(36) NOT NULL,
+    adminLogin VARCHAR(128) NOT NULL,
+    targetPermanentId CHAR(36) NOT NULL,
+    action VARCHAR(32) NOT NULL,
+    detail VARCHAR(255) NOT NULL,
+    createdAt BIGINT NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE role (
+    name VARCHAR(64) NOT NULL,
+    description VARCHAR(255) NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE role_permission (
+    role VARCHAR(64) NOT NULL,
+    permission VARCHAR(64) NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE user_role (
+    permanentId CHAR(36) NOT NULL,
+    role VARCHAR(64) NOT NULL,
+    grantedAt BIGINT NOT NULL,
+    cancelled BOOLEAN NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE user_locale (
+    permanentId CHAR(36) NOT NULL PRIMARY KEY,
+    locale VARCHAR(8) NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE notification_setting (
+    permanentId CHAR(36) NOT NULL,
+    setting VARCHAR(32) NOT NULL,
+    enabled BOOLEAN NOT NULL,
+    PRIMARY KEY (permanentId, setting),
+    INDEX idx_notification_setting (setting, enabled)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE security_alert_token (
+    token VARCHAR(1024) NOT NULL,
+    permanentId CHAR(36) NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    INDEX idx_security_alert_token_permanent_id (permanentId)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE trusted_device (
+    deviceId CHAR(36) NOT NULL PRIMARY KEY,
+    permanentId CHAR(36) NOT NULL,
+    expiresAt BIGINT NOT NULL,
+    cancelled BOOLEAN NOT NULL,
+    INDEX idx_trusted_device_permanent_id (permanentId)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE security_digest (
+    permanentId CHAR(36) NOT NULL PRIMARY KEY,
+    sentAt BIGINT NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE invite (
+    code CHAR(36) NOT NULL,
+    email VARCHAR(128) NOT NULL,
+    createdBy CHAR(36) NOT NULL,
+    createdAt BIGINT NOT NULL,
+    expiresAt BIGINT NOT NULL,
+    usedBy CHAR(36) NOT NULL,
+    usedAt BIGINT NOT NULL,
+    cancelled BOOLEAN NOT NULL
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE mail_outbox (
+    idempotencyKey CHAR(64) NOT NULL PRIMARY KEY,
+    contentHash CHAR(64) NOT NULL,
+    sender VARCHAR(128) NOT NULL,
+    recipient VARCHAR(128) NOT NULL,
+    subject VARCHAR(128) NOT NULL,
+    message MEDIUMBLOB NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    attempts INT NOT NULL,
+    nextAttemptAt BIGINT NOT NULL,
+    lockedUntil BIGINT NOT NULL,
+    lastError VARCHAR(255) NOT NULL,
+    createdAt BIGINT NOT NULL,
+    sentAt BIGINT NOT NULL,
+    INDEX mail_outbox_due (status, nextAttemptAt),
+    INDEX mail_outbox_content (contentHash, createdAt)
+) ENGINE=INNODB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO role (name, description) VALUES ('admin', 'User management, role assignment and invites');
+INSERT INTO role_permission (role, permission) VALUES ('admin', 'admin.users'), ('admin', 'roles.manage'), ('admin', 'invites.manage'), ('admin', 'templates.preview');